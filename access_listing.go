@@ -0,0 +1,62 @@
+package twingate
+
+import (
+	"context"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// listAccess reads the groups and service accounts with access to each
+// managed resource, keyed by resource ID, for access_listing. Resources
+// whose access cannot be read are logged and left out. The caller holds
+// syncMutex, which is released while the access is read.
+func (t *TwingateApp) listAccess(ctx context.Context) map[string][]AccessPrincipal {
+	names := make([]string, 0, len(t.resources))
+	for name := range t.resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ids := make([]string, len(names))
+	for i, name := range names {
+		ids[i] = t.resources[name].ID
+	}
+
+	access := make(map[string][]AccessPrincipal, len(names))
+	t.withoutSyncLock(func() {
+		for i, id := range ids {
+			if ctx.Err() != nil {
+				break
+			}
+			principals, err := t.api.GetResourceAccess(ctx, id)
+			if err != nil {
+				t.log(ctx).Warn("Failed to list resource access",
+					zap.String("name", names[i]),
+					zap.String("id", id),
+					zap.Error(err))
+				continue
+			}
+			access[id] = principals
+		}
+	})
+	return access
+}
+
+// addSummaryAccess lists the access of each existing resource in summary,
+// for access_listing.
+func (t *TwingateApp) addSummaryAccess(ctx context.Context, summary *SyncSummary) {
+	for i, item := range summary.Resources {
+		if item.ID == "" {
+			continue
+		}
+		principals, err := t.api.GetResourceAccess(ctx, item.ID)
+		if err != nil {
+			t.log(ctx).Warn("Failed to list resource access",
+				zap.String("name", item.Name),
+				zap.String("id", item.ID),
+				zap.Error(err))
+			continue
+		}
+		summary.Resources[i].Access = principals
+	}
+}
@@ -0,0 +1,54 @@
+package twingate
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestAccessListing(t *testing.T) {
+	mock := &MockTwingateClient{
+		Resources: map[string]Resource{
+			"r1": newTestResource("r1", "app.example.com", "10.0.0.1", "net1"),
+			"r2": newTestResource("r2", "admin.example.com", "10.0.0.1", "net1"),
+		},
+		Grants: map[string][]string{"r1": {"g-eng", "g-ops"}},
+	}
+	app := &TwingateApp{
+		Tenant:        "acme",
+		AccessListing: true,
+		api:           mock,
+		logger:        zap.NewNop(),
+		resources: map[string]Resource{
+			"app.example.com":   mock.Resources["r1"],
+			"admin.example.com": mock.Resources["r2"],
+		},
+	}
+	app.syncMutex.Lock()
+	app.access = app.listAccess(context.Background())
+	app.syncMutex.Unlock()
+
+	status := app.ownStatus()
+	for _, res := range status.Resources {
+		switch res.Name {
+		case "app.example.com":
+			if len(res.Access) != 2 || res.Access[0].ID != "g-eng" || res.Access[1].Type != "Group" {
+				t.Errorf("app.example.com access = %+v", res.Access)
+			}
+		case "admin.example.com":
+			if len(res.Access) != 0 {
+				t.Errorf("admin.example.com should have no access, got %+v", res.Access)
+			}
+		}
+	}
+
+	summary := &SyncSummary{Resources: []ResourceSummary{
+		{Name: "app.example.com", ID: "r1", Action: "unchanged"},
+		{Name: "new.example.com", Action: "create"},
+	}}
+	app.addSummaryAccess(context.Background(), summary)
+	if len(summary.Resources[0].Access) != 2 || summary.Resources[1].Access != nil {
+		t.Errorf("only existing resources should list access, got %+v", summary.Resources)
+	}
+}
@@ -0,0 +1,88 @@
+package twingate
+
+import (
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(AccessLogHandler{})
+	httpcaddyfile.RegisterHandlerDirective("twingate_log", parseAccessLogHandler)
+	httpcaddyfile.RegisterDirectiveOrder("twingate_log", httpcaddyfile.Before, "request_header")
+}
+
+// AccessLogHandler annotates the access log entry of each request with the
+// Twingate resource managed for the requested host, so HTTP traffic can be
+// correlated with Twingate access analytics.
+type AccessLogHandler struct{}
+
+func (AccessLogHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.twingate_log",
+		New: func() caddy.Module { return new(AccessLogHandler) },
+	}
+}
+
+func (AccessLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	extra, ok := r.Context().Value(caddyhttp.ExtraLogFieldsCtxKey).(*caddyhttp.ExtraLogFields)
+	if !ok {
+		return next.ServeHTTP(w, r)
+	}
+
+	for _, field := range resourceLogFields(currentApp(), r.Host) {
+		extra.Set(field)
+	}
+
+	return next.ServeHTTP(w, r)
+}
+
+// resourceLogFields returns the log fields describing the resource managed
+// for host, or nil if there is none.
+func resourceLogFields(app *TwingateApp, host string) []zap.Field {
+	if app == nil {
+		return nil
+	}
+
+	resource, found := app.LookupResource(host)
+	if !found {
+		return nil
+	}
+
+	return []zap.Field{
+		zap.String("twingate_resource", resource.Name),
+		zap.String("twingate_resource_id", resource.ID),
+	}
+}
+
+// UnmarshalCaddyfile parses the twingate_log directive, which takes no
+// arguments.
+func (AccessLogHandler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		if d.NextBlock(0) {
+			return d.Errf("twingate_log does not take a block")
+		}
+	}
+	return nil
+}
+
+func parseAccessLogHandler(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(AccessLogHandler)
+	if err := handler.UnmarshalCaddyfile(h.Dispenser); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+var (
+	_ caddy.Module                = (*AccessLogHandler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*AccessLogHandler)(nil)
+	_ caddyfile.Unmarshaler       = (*AccessLogHandler)(nil)
+)
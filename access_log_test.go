@@ -0,0 +1,31 @@
+package twingate
+
+import (
+	"testing"
+)
+
+func TestResourceLogFields(t *testing.T) {
+	app := &TwingateApp{
+		resources: map[string]Resource{
+			"api.example.com": newTestResource("r1", "api.example.com", "10.0.0.1", "net1"),
+		},
+	}
+
+	fields := resourceLogFields(app, "api.example.com:443")
+	if len(fields) != 2 {
+		t.Fatalf("expected 2 fields, got %d", len(fields))
+	}
+	if fields[0].Key != "twingate_resource" || fields[0].String != "api.example.com" {
+		t.Errorf("unexpected resource field: %+v", fields[0])
+	}
+	if fields[1].Key != "twingate_resource_id" || fields[1].String != "r1" {
+		t.Errorf("unexpected resource ID field: %+v", fields[1])
+	}
+
+	if fields := resourceLogFields(app, "unknown.example.com"); fields != nil {
+		t.Errorf("expected no fields for an unmanaged host, got %+v", fields)
+	}
+	if fields := resourceLogFields(nil, "api.example.com"); fields != nil {
+		t.Errorf("expected no fields without a running app, got %+v", fields)
+	}
+}
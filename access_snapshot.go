@@ -0,0 +1,136 @@
+package twingate
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// RestoreAccessConfig controls whether a resource recreated because its
+// host came back gets the access it had when it was deleted. Enabled by
+// default.
+type RestoreAccessConfig struct {
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Window is how long after a deletion the access is restored.
+	// Defaults to 7 days, as long as the deletion journal keeps it.
+	Window caddy.Duration `json:"window,omitempty"`
+}
+
+func (c *RestoreAccessConfig) window() time.Duration {
+	if c != nil && c.Window > 0 {
+		return time.Duration(c.Window)
+	}
+	return deletedRetention
+}
+
+// AccessSnapshot is the access to a resource as it was just before the
+// plugin deleted or updated it, kept in the sync state so it can be
+// applied again if the resource is recreated.
+type AccessSnapshot struct {
+	Principals []AccessPrincipal `json:"principals,omitempty"`
+	CapturedAt time.Time         `json:"captured_at"`
+}
+
+// captureAccess lists the current access to a resource.
+func captureAccess(ctx context.Context, client TwingateAPI, resourceID string) (*AccessSnapshot, error) {
+	principals, err := client.GetResourceAccess(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessSnapshot{Principals: principals, CapturedAt: time.Now()}, nil
+}
+
+// recordSnapshot captures the access to a resource about to be updated.
+// An update does not remove access, so a failed capture is logged and the
+// update goes ahead.
+func (r *ResourceSyncer) recordSnapshot(ctx context.Context, resourceID string) {
+	snapshot, err := captureAccess(ctx, r.client, resourceID)
+	if err != nil {
+		r.logger.Warn("Failed to capture resource access before update",
+			zap.String("id", resourceID),
+			zap.Error(err))
+		return
+	}
+	if r.snapshots != nil {
+		r.snapshots[resourceID] = *snapshot
+	}
+}
+
+// principals returns the access a journaled resource had: its snapshot
+// or, for entries journaled before snapshots were taken, the groups the
+// plugin granted.
+func (d DeletedResource) principals() []AccessPrincipal {
+	if d.Access != nil {
+		return d.Access.Principals
+	}
+	principals := make([]AccessPrincipal, len(d.GroupIDs))
+	for i, id := range d.GroupIDs {
+		principals[i] = AccessPrincipal{ID: id, Type: "Group"}
+	}
+	return principals
+}
+
+// reapplyAccess grants a resource recreated from a journal entry the
+// access the deleted resource had, leaving out the groups already granted
+// on creation. It returns the principals granted.
+func reapplyAccess(ctx context.Context, client TwingateAPI, resourceID string, entry DeletedResource, granted []string) ([]AccessPrincipal, error) {
+	principals := slices.DeleteFunc(slices.Clone(entry.principals()), func(p AccessPrincipal) bool {
+		return p.SecurityPolicyID == "" && slices.Contains(granted, p.ID)
+	})
+	if len(principals) == 0 {
+		return nil, nil
+	}
+	if err := client.AddResourceAccess(ctx, resourceID, principals); err != nil {
+		return nil, err
+	}
+	return principals, nil
+}
+
+// returningResources returns the latest journal entry of each name
+// deleted within window of now.
+func returningResources(journal []DeletedResource, window time.Duration, now time.Time) map[string]DeletedResource {
+	returning := make(map[string]DeletedResource)
+	for _, entry := range journal {
+		if now.Sub(entry.DeletedAt) <= window {
+			returning[entry.Name] = entry
+		}
+	}
+	return returning
+}
+
+// restoreAccess gives a resource created for a returning host the access
+// its deleted predecessor had. The journal entry is consumed either way;
+// a failure is logged, as the new resource exists regardless.
+func (r *ResourceSyncer) restoreAccess(ctx context.Context, resourceID string, entry DeletedResource, groupIDs []string) {
+	r.restored[entry.Name] = entry.ID
+
+	principals, err := reapplyAccess(ctx, r.client, resourceID, entry, groupIDs)
+	if err != nil {
+		r.logger.Error("Failed to restore access to returning resource",
+			zap.String("id", resourceID),
+			zap.String("name", entry.Name),
+			zap.String("old_id", entry.ID),
+			zap.Error(err))
+		return
+	}
+	if len(principals) == 0 {
+		return
+	}
+
+	r.logger.Info("Restored access to returning resource",
+		zap.String("id", resourceID),
+		zap.String("name", entry.Name),
+		zap.String("old_id", entry.ID),
+		zap.Int("principals", len(principals)))
+	var groups []string
+	for _, principal := range principals {
+		if principal.Type == "Group" {
+			groups = append(groups, principal.ID)
+		}
+	}
+	r.recordGranted(resourceID, groups)
+}
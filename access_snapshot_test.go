@@ -0,0 +1,178 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+)
+
+// failingAccessClient cannot list resource access.
+type failingAccessClient struct {
+	*MockTwingateClient
+}
+
+func (failingAccessClient) GetResourceAccess(context.Context, string) ([]AccessPrincipal, error) {
+	return nil, errors.New("access query failed")
+}
+
+func newSnapshotTestApp(t *testing.T, client TwingateAPI) *TwingateApp {
+	return &TwingateApp{
+		Tenant: "acme",
+		api:    client,
+		logger: zap.NewNop(),
+		state:  newStateStore(&certmagic.FileStorage{Path: t.TempDir()}, "acme"),
+	}
+}
+
+func TestJournalCapturesAccess(t *testing.T) {
+	ctx := context.Background()
+	client := &MockTwingateClient{
+		Resources: map[string]Resource{"r1": newTestResource("r1", "shop.example.com", "10.0.0.1", "net1")},
+		// g2 was granted in the console
+		Grants: map[string][]string{"r1": {"g1", "g2"}},
+	}
+	app := newSnapshotTestApp(t, client)
+
+	deleted, errs := app.newSyncer(ctx).deleteStaleResources(ctx, nil, "net1", &CleanupConfig{Enabled: true})
+	if deleted != 1 || errs != 0 {
+		t.Fatalf("deleted = %d, errors = %d, want 1 and 0", deleted, errs)
+	}
+
+	state, _ := app.state.load(ctx)
+	if len(state.Deleted) != 1 || state.Deleted[0].Access == nil {
+		t.Fatalf("journal should hold an access snapshot: %+v", state.Deleted)
+	}
+	access := state.Deleted[0].Access
+	if len(access.Principals) != 2 || access.Principals[1].ID != "g2" || access.CapturedAt.IsZero() {
+		t.Errorf("unexpected access snapshot: %+v", access)
+	}
+
+	// Without a snapshot the resource is kept
+	client = &MockTwingateClient{
+		Resources: map[string]Resource{"r1": newTestResource("r1", "shop.example.com", "10.0.0.1", "net1")},
+	}
+	app = newSnapshotTestApp(t, failingAccessClient{client})
+	deleted, errs = app.newSyncer(ctx).deleteStaleResources(ctx, nil, "net1", &CleanupConfig{Enabled: true})
+	if deleted != 0 || errs != 1 || len(client.DeletedIDs) != 0 {
+		t.Errorf("deleted = %d, errors = %d, DeletedIDs = %v, want the resource kept", deleted, errs, client.DeletedIDs)
+	}
+}
+
+func TestUpdateCapturesAccess(t *testing.T) {
+	ctx := context.Background()
+	client := &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{"r1": newTestResource("r1", "app.example.com", "10.0.0.1", "net1")},
+		Grants:    map[string][]string{"r1": {"g1"}},
+	}
+	app := newSnapshotTestApp(t, client)
+	state, _ := app.state.load(ctx)
+	state.Managed["r1"] = ManagedResource{Name: "app.example.com"}
+	if err := app.state.save(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+
+	syncer := app.newSyncer(ctx)
+	mappings := []ResourceMapping{{Name: "app.example.com", Address: "10.0.0.2"}}
+	if err := syncer.SyncResources(ctx, mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	app.recordManaged(ctx, syncer)
+
+	state, _ = app.state.load(ctx)
+	access := state.Managed["r1"].Access
+	if access == nil || len(access.Principals) != 1 || access.Principals[0].ID != "g1" {
+		t.Errorf("managed resource should hold the access from before the update, got %+v", access)
+	}
+}
+
+func TestReturningHostRestoresAccess(t *testing.T) {
+	ctx := context.Background()
+	journaled := DeletedResource{
+		ID:              "old1",
+		Name:            "shop.example.com",
+		Address:         "10.0.0.1",
+		RemoteNetworkID: "net1",
+		GroupIDs:        []string{"g1"},
+		Access: &AccessSnapshot{Principals: []AccessPrincipal{
+			{ID: "g1", Type: "Group"},
+			{ID: "g2", Type: "Group", SecurityPolicyID: "p1"},
+			{ID: "sa1", Type: "ServiceAccount"},
+		}},
+	}
+	mappings := []ResourceMapping{{Name: "shop.example.com", Address: "10.0.0.1"}}
+
+	tests := []struct {
+		name      string
+		restore   *RestoreAccessConfig
+		deletedAt time.Duration
+		want      []string
+	}{
+		{"within window", nil, time.Hour, []string{"g1", "g2", "sa1"}},
+		{"past window", &RestoreAccessConfig{Window: caddy.Duration(30 * time.Minute)}, time.Hour, nil},
+		{"disabled", &RestoreAccessConfig{Disabled: true}, time.Hour, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &MockTwingateClient{
+				Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+			}
+			app := newSnapshotTestApp(t, client)
+			app.RestoreAccess = tt.restore
+			entry := journaled
+			entry.DeletedAt = time.Now().Add(-tt.deletedAt)
+			state, _ := app.state.load(ctx)
+			state.Deleted = []DeletedResource{entry}
+			if err := app.state.save(ctx, state); err != nil {
+				t.Fatal(err)
+			}
+
+			syncer := app.newSyncer(ctx)
+			app.loadSyncState(ctx, syncer)
+			if err := syncer.SyncResources(ctx, mappings, "", nil); err != nil {
+				t.Fatalf("SyncResources() failed: %v", err)
+			}
+			app.recordManaged(ctx, syncer)
+
+			created := syncer.SyncedResources()["shop.example.com"]
+			got := append(slices.Clone(client.Grants[created.ID]), client.ServiceAccounts[created.ID]...)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("grants = %v, want %v", got, tt.want)
+			}
+			state, _ = app.state.load(ctx)
+			if consumed := len(state.Deleted) == 0; consumed != (tt.want != nil) {
+				t.Errorf("journal = %+v, consumed = %v", state.Deleted, consumed)
+			}
+		})
+	}
+}
+
+func TestUnmarshalCaddyfile_RestoreAccess(t *testing.T) {
+	for input, want := range map[string]RestoreAccessConfig{
+		"restore_access off": {Disabled: true},
+		"restore_access 24h": {Window: caddy.Duration(24 * time.Hour)},
+	} {
+		app := &TwingateApp{}
+		err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n\ttenant acme\n\t" + input + "\n}"))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", input, err)
+		}
+		if app.RestoreAccess == nil || *app.RestoreAccess != want {
+			t.Errorf("%s: RestoreAccess = %+v, want %+v", input, app.RestoreAccess, want)
+		}
+	}
+
+	for _, input := range []string{"restore_access", "restore_access soon", "restore_access 1h 2h"} {
+		app := &TwingateApp{}
+		if err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n\ttenant acme\n\t" + input + "\n}")); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultAddressCheckTimeout bounds each connection attempt of the
+	// address check unless configured otherwise.
+	defaultAddressCheckTimeout = 3 * time.Second
+
+	// maxProbePorts caps the ports tried per address, so a wide port
+	// range does not turn the check into a port scan.
+	maxProbePorts = 16
+
+	// probeConcurrency bounds the addresses checked at once.
+	probeConcurrency = 8
+)
+
+// AddressCheckConfig turns on a check, after each successful sync, that
+// the resources pointing at Caddy reach one of its listeners. The check
+// connects to each resource's address the way the connector would, from
+// Caddy's host, so an address that does not lead back to Caddy is flagged
+// in /twingate/status. A resource's alias that resolves from Caddy's host
+// must resolve to its address.
+type AddressCheckConfig struct {
+	// Timeout of each connection attempt. Defaults to 3s.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+}
+
+func (c *AddressCheckConfig) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout)
+	}
+	return defaultAddressCheckTimeout
+}
+
+// AddressProblem is a resource whose address did not reach a Caddy
+// listener in the last address check.
+type AddressProblem struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Ports   []int  `json:"ports,omitempty"`
+	Error   string `json:"error"`
+}
+
+// checkAddresses checks the addresses of the synced mappings against the
+// TCP ports of the HTTP servers, or the TCP ports a mapping restricts
+// itself to. Extra resources, CIDR ranges and wildcards do not point at a
+// single Caddy listener and are not checked. The caller holds syncMutex,
+// which is released while the checks run.
+func (t *TwingateApp) checkAddresses(ctx context.Context, mappings []ResourceMapping) []AddressProblem {
+	var ports []int
+	if httpApp, err := t.httpApp(ctx); err == nil {
+		ports = listenerPorts(httpApp)
+	}
+
+	extra := make(map[string]bool, len(t.ExtraResources))
+	for _, e := range t.ExtraResources {
+		extra[e.Name] = true
+	}
+	var checked []ResourceMapping
+	for _, m := range mappings {
+		if !extra[m.Name] {
+			checked = append(checked, m)
+		}
+	}
+
+	var problems []AddressProblem
+	t.withoutSyncLock(func() {
+		problems = probeAddresses(ctx, checked, ports, t.AddressCheck.timeout())
+	})
+	for _, p := range problems {
+		t.log(ctx).Warn("Resource address does not reach Caddy",
+			zap.String("name", p.Name),
+			zap.String("address", p.Address),
+			zap.Ints("ports", p.Ports),
+			zap.String("error", p.Error))
+	}
+	t.log(ctx).Debug("Address check complete",
+		zap.Int("resources", len(checked)),
+		zap.Int("problems", len(problems)))
+	return problems
+}
+
+// listenerPorts returns the TCP ports the HTTP servers listen on.
+func listenerPorts(httpApp *caddyhttp.App) []int {
+	var ports []int
+	for _, server := range httpApp.Servers {
+		for _, listen := range server.Listen {
+			na, err := caddy.ParseNetworkAddress(listen)
+			if err != nil || na.IsUnixNetwork() || na.Network != "" && !strings.HasPrefix(na.Network, "tcp") {
+				continue
+			}
+			for port := na.StartPort; port <= na.EndPort; port++ {
+				ports = append(ports, int(port))
+			}
+		}
+	}
+	slices.Sort(ports)
+	return slices.Compact(ports)
+}
+
+// probeAddresses connects to the address of each mapping on its ports, up
+// to maxProbePorts of them, and resolves its alias. It returns the mappings
+// no port accepted a connection for or whose alias resolves elsewhere.
+// Mappings sharing an address and ports, as the sites of one Caddy usually
+// do, are probed once, and the probes run concurrently.
+func probeAddresses(ctx context.Context, mappings []ResourceMapping, ports []int, timeout time.Duration) []AddressProblem {
+	type probe struct {
+		mapping ResourceMapping
+		ports   []int
+		key     string
+		alias   string
+	}
+	var probes []probe
+	checks := make(map[string]func() error)
+	for _, m := range mappings {
+		if m.Address == "" || strings.Contains(m.Address, "/") || strings.Contains(m.Address, "*") {
+			continue
+		}
+		mappingPorts := ports
+		if m.Protocols != nil && m.Protocols.TCP.Policy == ProtocolRestricted {
+			mappingPorts = nil
+			for _, r := range m.Protocols.TCP.Ports {
+				for port := r.Start; port <= r.End; port++ {
+					mappingPorts = append(mappingPorts, port)
+				}
+			}
+		}
+		if len(mappingPorts) == 0 {
+			continue
+		}
+		if len(mappingPorts) > maxProbePorts {
+			mappingPorts = mappingPorts[:maxProbePorts]
+		}
+
+		p := probe{mapping: m, ports: mappingPorts, key: m.Address + " " + fmt.Sprint(mappingPorts)}
+		checks[p.key] = func() error {
+			return probeAddress(ctx, m.Address, mappingPorts, timeout)
+		}
+		if m.Alias != nil && *m.Alias != "" {
+			alias := *m.Alias
+			p.alias = "alias " + alias + " " + m.Address
+			checks[p.alias] = func() error {
+				return checkAlias(ctx, alias, m.Address, timeout)
+			}
+		}
+		probes = append(probes, p)
+	}
+
+	results := runChecks(checks)
+	var problems []AddressProblem
+	for _, p := range probes {
+		err := results[p.key]
+		if err == nil && p.alias != "" {
+			err = results[p.alias]
+		}
+		if err != nil {
+			problems = append(problems, AddressProblem{
+				Name:    p.mapping.Name,
+				Address: p.mapping.Address,
+				Ports:   p.ports,
+				Error:   err.Error(),
+			})
+		}
+	}
+	return problems
+}
+
+// runChecks runs checks, probeConcurrency at a time, and returns their
+// errors by key.
+func runChecks(checks map[string]func() error) map[string]error {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]error, len(checks))
+		slots   = make(chan struct{}, probeConcurrency)
+	)
+	for key, check := range checks {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			err := check()
+			<-slots
+
+			mu.Lock()
+			results[key] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// checkAlias resolves alias and returns an error if it resolves to other
+// addresses than address. An alias that does not resolve from Caddy's
+// host, as one only Twingate clients resolve, passes.
+func checkAlias(ctx context.Context, alias, address string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resolved, err := net.DefaultResolver.LookupHost(ctx, alias)
+	if err != nil {
+		return nil
+	}
+	want := []string{address}
+	if net.ParseIP(address) == nil {
+		// An address that does not resolve is reported by its probe
+		if want, err = net.DefaultResolver.LookupHost(ctx, address); err != nil {
+			return nil
+		}
+	}
+	for _, ip := range resolved {
+		if slices.Contains(want, ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("alias %s resolves to %s, not to the address", alias, strings.Join(resolved, ", "))
+}
+
+// probeAddress resolves a DNS name address and connects to it on each port
+// until one accepts.
+func probeAddress(ctx context.Context, address string, ports []int, timeout time.Duration) error {
+	if net.ParseIP(address) == nil {
+		lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+		_, err := net.DefaultResolver.LookupHost(lookupCtx, address)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("address does not resolve: %w", err)
+		}
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	var err error
+	for _, port := range ports {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+	}
+	return fmt.Errorf("no listener accepted a connection: %w", err)
+}
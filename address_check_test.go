@@ -0,0 +1,120 @@
+package twingate
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestListenerPorts(t *testing.T) {
+	httpApp := &caddyhttp.App{Servers: map[string]*caddyhttp.Server{
+		"srv0": {Listen: []string{":443", "udp/:443"}},
+		"srv1": {Listen: []string{"10.0.0.1:80", "tcp/:8000-8001", "unix//run/caddy.sock"}},
+	}}
+	if got, want := listenerPorts(httpApp), []int{80, 443, 8000, 8001}; !slices.Equal(got, want) {
+		t.Errorf("listenerPorts() = %v, want %v", got, want)
+	}
+}
+
+func TestProbeAddresses(t *testing.T) {
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	openPort := open.Addr().(*net.TCPAddr).Port
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	restricted := &ProtocolsInput{
+		TCP: ProtocolInput{Policy: ProtocolRestricted, Ports: []PortRangeInput{{Start: closedPort, End: closedPort}}},
+		UDP: ProtocolInput{Policy: ProtocolRestricted},
+	}
+	// Aliases given as IPs resolve to themselves
+	localAlias, movedAlias := "127.0.0.1", "127.0.0.2"
+	mappings := []ResourceMapping{
+		{Name: "app.example.com", Address: "127.0.0.1"},
+		{Name: "api.example.com", Address: "127.0.0.1"},
+		{Name: "db.example.com", Address: "127.0.0.1", Protocols: restricted},
+		{Name: "lab-net", Address: "10.10.0.0/24"},
+		{Name: "*.example.com", Address: "*.example.com"},
+		{Name: "gone.example.com", Address: "gone.invalid"},
+		{Name: "local.example.com", Address: "127.0.0.1", Alias: &localAlias},
+		{Name: "moved.example.com", Address: "127.0.0.1", Alias: &movedAlias},
+	}
+
+	problems := probeAddresses(context.Background(), mappings, []int{closedPort, openPort}, time.Second)
+
+	var names []string
+	for _, p := range problems {
+		names = append(names, p.Name)
+	}
+	if want := []string{"db.example.com", "gone.example.com", "moved.example.com"}; !slices.Equal(names, want) {
+		t.Fatalf("flagged %v, want %v: %+v", names, want, problems)
+	}
+	if !slices.Equal(problems[0].Ports, []int{closedPort}) {
+		t.Errorf("db.example.com should only be probed on its own port, got %v", problems[0].Ports)
+	}
+	if !strings.Contains(problems[1].Error, "does not resolve") {
+		t.Errorf("unexpected error for an unresolvable address: %s", problems[1].Error)
+	}
+	if !strings.Contains(problems[2].Error, "alias 127.0.0.2 resolves to 127.0.0.2") {
+		t.Errorf("unexpected error for an alias resolving elsewhere: %s", problems[2].Error)
+	}
+}
+
+func TestProbeAddressesCapsPorts(t *testing.T) {
+	wide := &ProtocolsInput{
+		TCP: ProtocolInput{Policy: ProtocolRestricted, Ports: []PortRangeInput{{Start: 1, End: 65535}}},
+		UDP: ProtocolInput{Policy: ProtocolRestricted},
+	}
+	mappings := []ResourceMapping{{Name: "gone.example.com", Address: "gone.invalid", Protocols: wide}}
+
+	problems := probeAddresses(context.Background(), mappings, nil, time.Second)
+	if len(problems) != 1 || len(problems[0].Ports) != maxProbePorts {
+		t.Errorf("expected the probe capped at %d ports, got %+v", maxProbePorts, problems)
+	}
+}
+
+func TestUnmarshalCaddyfile_AddressCheck(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		address_check 500ms
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.AddressCheck == nil || app.AddressCheck.timeout() != 500*time.Millisecond {
+		t.Errorf("AddressCheck = %+v, want timeout 500ms", app.AddressCheck)
+	}
+
+	app = &TwingateApp{}
+	if err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		address_check
+	}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.AddressCheck == nil || app.AddressCheck.timeout() != defaultAddressCheckTimeout {
+		t.Errorf("AddressCheck = %+v, want default timeout", app.AddressCheck)
+	}
+
+	if err := (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		address_check soon
+	}`)); err == nil {
+		t.Error("expected error for an invalid timeout")
+	}
+}
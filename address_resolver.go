@@ -0,0 +1,312 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(StaticResolver{})
+	caddy.RegisterModule(OutboundResolver{})
+	caddy.RegisterModule(InterfaceResolver{})
+	caddy.RegisterModule(PublicHTTPResolver{})
+	caddy.RegisterModule(DNSResolver{})
+}
+
+// AddressResolver finds the addresses of this Caddy server that resources
+// point at when caddy_address is not set. Resolvers are Caddy modules in
+// the twingate.address_resolvers namespace, so other plugins can add their
+// own.
+type AddressResolver interface {
+	// ResolveAddresses returns one or more IPv4 addresses or DNS names.
+	ResolveAddresses(ctx context.Context) ([]string, error)
+}
+
+// defaultOutboundTarget is the address dialed to find the outbound
+// interface. No packets are sent.
+const defaultOutboundTarget = "8.8.8.8:80"
+
+// defaultPublicIPURL is the service the public_http resolver asks for the
+// public IP unless another is configured.
+const defaultPublicIPURL = "https://api.ipify.org"
+
+// StaticResolver returns a fixed list of addresses.
+type StaticResolver struct {
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+func (StaticResolver) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "twingate.address_resolvers.static",
+		New: func() caddy.Module { return new(StaticResolver) },
+	}
+}
+
+func (s StaticResolver) ResolveAddresses(context.Context) ([]string, error) {
+	if len(s.Addresses) == 0 {
+		return nil, fmt.Errorf("no addresses configured")
+	}
+	return s.Addresses, nil
+}
+
+// UnmarshalCaddyfile sets up the resolver from Caddyfile tokens. Syntax:
+//
+//	address_resolver static <address>...
+func (s *StaticResolver) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // resolver name
+	s.Addresses = d.RemainingArgs()
+	if len(s.Addresses) == 0 {
+		return d.ArgErr()
+	}
+	return nil
+}
+
+// OutboundResolver returns the local IP of the interface used to reach
+// Target. This is the default resolver.
+type OutboundResolver struct {
+	// Target is the host:port the route is looked up for. Defaults to
+	// 8.8.8.8:80.
+	Target string `json:"target,omitempty"`
+}
+
+func (OutboundResolver) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "twingate.address_resolvers.outbound",
+		New: func() caddy.Module { return new(OutboundResolver) },
+	}
+}
+
+func (o OutboundResolver) ResolveAddresses(context.Context) ([]string, error) {
+	target := o.Target
+	if target == "" {
+		target = defaultOutboundTarget
+	}
+	ip, err := outboundIP(target)
+	if err != nil {
+		return nil, err
+	}
+	return []string{ip}, nil
+}
+
+// UnmarshalCaddyfile sets up the resolver from Caddyfile tokens. Syntax:
+//
+//	address_resolver outbound [<target>]
+func (o *OutboundResolver) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // resolver name
+	if d.NextArg() {
+		o.Target = d.Val()
+	}
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	return nil
+}
+
+// InterfaceResolver returns the first IPv4 address of a network interface.
+type InterfaceResolver struct {
+	Name string `json:"name,omitempty"`
+}
+
+func (InterfaceResolver) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "twingate.address_resolvers.interface",
+		New: func() caddy.Module { return new(InterfaceResolver) },
+	}
+}
+
+func (i InterfaceResolver) ResolveAddresses(context.Context) ([]string, error) {
+	iface, err := net.InterfaceByName(i.Name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", i.Name, err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return []string{ipNet.IP.String()}, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", i.Name)
+}
+
+// UnmarshalCaddyfile sets up the resolver from Caddyfile tokens. Syntax:
+//
+//	address_resolver interface <name>
+func (i *InterfaceResolver) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // resolver name
+	if !d.NextArg() {
+		return d.ArgErr()
+	}
+	i.Name = d.Val()
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	return nil
+}
+
+// PublicHTTPResolver asks an HTTP service for the server's public IP, for
+// connectors that reach Caddy through its public address. The service must
+// answer with the bare IP.
+type PublicHTTPResolver struct {
+	// URL of the service. Defaults to https://api.ipify.org.
+	URL string `json:"url,omitempty"`
+
+	// Timeout of the request. Defaults to 10s.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+}
+
+func (PublicHTTPResolver) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "twingate.address_resolvers.public_http",
+		New: func() caddy.Module { return new(PublicHTTPResolver) },
+	}
+}
+
+func (p PublicHTTPResolver) ResolveAddresses(ctx context.Context) ([]string, error) {
+	url := p.URL
+	if url == "" {
+		url = defaultPublicIPURL
+	}
+	timeout := time.Duration(p.Timeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := egressHTTPClient(ctx).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("public IP lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return nil, fmt.Errorf("public IP lookup failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("public IP lookup failed: %s", resp.Status)
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil || ip.To4() == nil {
+		return nil, fmt.Errorf("public IP lookup returned no IPv4 address: %q", body)
+	}
+	return []string{ip.String()}, nil
+}
+
+// UnmarshalCaddyfile sets up the resolver from Caddyfile tokens. Syntax:
+//
+//	address_resolver public_http [<url>] {
+//	    timeout <duration>
+//	}
+func (p *PublicHTTPResolver) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // resolver name
+	if d.NextArg() {
+		if err := validateAPIEndpoint(d.Val()); err != nil {
+			return d.Errf("url: %v", err)
+		}
+		p.URL = d.Val()
+	}
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		switch d.Val() {
+		case "timeout":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			dur, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return d.Errf("invalid timeout: %v", err)
+			}
+			p.Timeout = caddy.Duration(dur)
+		default:
+			return d.Errf("unrecognized public_http option: %s", d.Val())
+		}
+	}
+	return nil
+}
+
+// DNSResolver looks up the IPv4 addresses of a name, such as a record
+// maintained by the host's provisioning. Unlike a DNS name in
+// caddy_address, which the connector resolves, the name is resolved when
+// the config is loaded and each address becomes a resource of its own.
+type DNSResolver struct {
+	Name string `json:"name,omitempty"`
+}
+
+func (DNSResolver) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "twingate.address_resolvers.dns",
+		New: func() caddy.Module { return new(DNSResolver) },
+	}
+}
+
+func (r DNSResolver) ResolveAddresses(ctx context.Context) ([]string, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", r.Name)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	slices.Sort(addrs)
+	return slices.Compact(addrs), nil
+}
+
+// UnmarshalCaddyfile sets up the resolver from Caddyfile tokens. Syntax:
+//
+//	address_resolver dns <name>
+func (r *DNSResolver) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // resolver name
+	if !d.NextArg() {
+		return d.ArgErr()
+	}
+	r.Name = d.Val()
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	return nil
+}
+
+// outboundIP returns the local IP of the interface used to reach target.
+func outboundIP(target string) (string, error) {
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect outbound IP: %w", err)
+	}
+	defer conn.Close()
+
+	localAddr := conn.LocalAddr().(*net.UDPAddr)
+	return localAddr.IP.String(), nil
+}
+
+var (
+	_ AddressResolver       = (*StaticResolver)(nil)
+	_ AddressResolver       = (*OutboundResolver)(nil)
+	_ AddressResolver       = (*InterfaceResolver)(nil)
+	_ AddressResolver       = (*PublicHTTPResolver)(nil)
+	_ AddressResolver       = (*DNSResolver)(nil)
+	_ caddyfile.Unmarshaler = (*StaticResolver)(nil)
+	_ caddyfile.Unmarshaler = (*OutboundResolver)(nil)
+	_ caddyfile.Unmarshaler = (*InterfaceResolver)(nil)
+	_ caddyfile.Unmarshaler = (*PublicHTTPResolver)(nil)
+	_ caddyfile.Unmarshaler = (*DNSResolver)(nil)
+)
@@ -0,0 +1,87 @@
+package twingate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestStaticResolver(t *testing.T) {
+	addrs, err := StaticResolver{Addresses: []string{"10.0.0.1", "caddy.internal"}}.ResolveAddresses(context.Background())
+	if err != nil || !slices.Equal(addrs, []string{"10.0.0.1", "caddy.internal"}) {
+		t.Errorf("ResolveAddresses() = %v, %v", addrs, err)
+	}
+	if _, err := (StaticResolver{}).ResolveAddresses(context.Background()); err == nil {
+		t.Error("expected error without addresses")
+	}
+}
+
+func TestInterfaceResolver(t *testing.T) {
+	addrs, err := InterfaceResolver{Name: "lo"}.ResolveAddresses(context.Background())
+	if err != nil {
+		t.Skipf("no loopback interface named lo: %v", err)
+	}
+	if !slices.Equal(addrs, []string{"127.0.0.1"}) {
+		t.Errorf("ResolveAddresses() = %v, want [127.0.0.1]", addrs)
+	}
+
+	if _, err := (InterfaceResolver{Name: "does-not-exist0"}).ResolveAddresses(context.Background()); err == nil {
+		t.Error("expected error for unknown interface")
+	}
+}
+
+func TestPublicHTTPResolver(t *testing.T) {
+	body := "203.0.113.7\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	resolver := PublicHTTPResolver{URL: srv.URL}
+	addrs, err := resolver.ResolveAddresses(context.Background())
+	if err != nil || !slices.Equal(addrs, []string{"203.0.113.7"}) {
+		t.Errorf("ResolveAddresses() = %v, %v", addrs, err)
+	}
+
+	body = "<html>not an IP</html>"
+	if _, err := resolver.ResolveAddresses(context.Background()); err == nil {
+		t.Error("expected error for a response that is not an IP")
+	}
+}
+
+func TestDNSResolver(t *testing.T) {
+	addrs, err := DNSResolver{Name: "localhost"}.ResolveAddresses(context.Background())
+	if err != nil {
+		t.Skipf("localhost does not resolve: %v", err)
+	}
+	if !slices.Contains(addrs, "127.0.0.1") {
+		t.Errorf("ResolveAddresses() = %v, want 127.0.0.1", addrs)
+	}
+}
+
+func TestResolveCaddyAddressesWithResolver(t *testing.T) {
+	app := &TwingateApp{
+		logger:   zap.NewNop(),
+		resolver: StaticResolver{Addresses: []string{"10.0.0.9"}},
+	}
+	addrs, err := app.resolveCaddyAddresses(context.Background())
+	if err != nil || !slices.Equal(addrs, []string{"10.0.0.9"}) {
+		t.Errorf("resolveCaddyAddresses() = %v, %v", addrs, err)
+	}
+
+	// caddy_address takes precedence
+	app.CaddyAddress = "10.0.0.1"
+	if addrs, _ := app.resolveCaddyAddresses(context.Background()); !slices.Equal(addrs, []string{"10.0.0.1"}) {
+		t.Errorf("resolveCaddyAddresses() = %v, want caddy_address", addrs)
+	}
+
+	app.CaddyAddress = ""
+	app.resolver = StaticResolver{Addresses: []string{"not an address"}}
+	if _, err := app.resolveCaddyAddresses(context.Background()); err == nil {
+		t.Error("expected error for an invalid resolved address")
+	}
+}
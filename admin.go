@@ -0,0 +1,702 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(adminAPI{})
+}
+
+// adminAPI exposes the running Twingate app on Caddy's admin endpoint
+// under /twingate/.
+type adminAPI struct{}
+
+func (adminAPI) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.twingate",
+		New: func() caddy.Module { return new(adminAPI) },
+	}
+}
+
+func (a *adminAPI) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/twingate/mappings",
+			Handler: caddy.AdminHandlerFunc(a.handleMappings),
+		},
+		{
+			Pattern: "/twingate/status",
+			Handler: caddy.AdminHandlerFunc(a.handleStatus),
+		},
+		{
+			Pattern: "/twingate/summary",
+			Handler: caddy.AdminHandlerFunc(a.handleSummary),
+		},
+		{
+			Pattern: "/twingate/config",
+			Handler: caddy.AdminHandlerFunc(a.handleConfig),
+		},
+		{
+			Pattern: "/twingate/healthz",
+			Handler: caddy.AdminHandlerFunc(a.handleHealthz),
+		},
+		{
+			Pattern: "/twingate/cleanup",
+			Handler: caddy.AdminHandlerFunc(a.handleCleanup),
+		},
+		{
+			Pattern: "/twingate/cleanup/abort",
+			Handler: caddy.AdminHandlerFunc(a.handleCleanupAbort),
+		},
+		{
+			Pattern: "/twingate/failures",
+			Handler: caddy.AdminHandlerFunc(a.handleFailures),
+		},
+		{
+			Pattern: "/twingate/failures/retry",
+			Handler: caddy.AdminHandlerFunc(a.handleRetryFailures),
+		},
+		{
+			Pattern: "/twingate/undo-delete",
+			Handler: caddy.AdminHandlerFunc(a.handleUndoDelete),
+		},
+		{
+			Pattern: "/twingate/approve",
+			Handler: caddy.AdminHandlerFunc(a.handleApprove),
+		},
+	}
+}
+
+// Status describes the state of the running app as of its last sync.
+type Status struct {
+	// Version is the plugin's version.
+	Version string `json:"version"`
+
+	Tenant        string           `json:"tenant"`
+	Label         string           `json:"label,omitempty"`
+	LastSync      *time.Time       `json:"last_sync,omitempty"`
+	ResourceCount int              `json:"resource_count"`
+	Resources     []StatusResource `json:"resources"`
+
+	// LastSyncAPI counts the API calls made by the last sync.
+	LastSyncAPI *APIStats `json:"last_sync_api,omitempty"`
+
+	// LastSyncError is the error of the last sync attempt, if it failed.
+	LastSyncError string `json:"last_sync_error,omitempty"`
+
+	// LastSyncID is the sync ID of the last sync attempt, as found in its
+	// log lines, events and report.
+	LastSyncID string `json:"last_sync_id,omitempty"`
+
+	// Drifts are the attributes the last sync found changed outside Caddy.
+	Drifts []Drift `json:"drifts,omitempty"`
+
+	// ReadOnly is set for a read_only app, whose Resources are the
+	// existing resources its last sync matched and Plan the changes that
+	// sync would have made.
+	ReadOnly bool         `json:"read_only,omitempty"`
+	Plan     *SyncSummary `json:"plan,omitempty"`
+
+	// Pending is the plan held for approval, with approval_required set.
+	Pending *PendingPlan `json:"pending,omitempty"`
+
+	// Failing lists the resources awaiting retry after failing to sync.
+	Failing []StatusFailure `json:"failing,omitempty"`
+
+	// AddressProblems lists the resources whose address did not reach
+	// Caddy in the last address check.
+	AddressProblems []AddressProblem `json:"address_problems,omitempty"`
+
+	// Flapping lists the resources held because syncs keep creating and
+	// deleting them.
+	Flapping []string `json:"flapping,omitempty"`
+
+	// CircuitBreaker is the state of the API circuit breaker.
+	CircuitBreaker *BreakerStatus `json:"circuit_breaker,omitempty"`
+
+	// SyncQueue shows the running sync and the one queued after it.
+	SyncQueue *SyncQueueStatus `json:"sync_queue,omitempty"`
+
+	// RateLimit is the API rate limit as last reported by the API.
+	RateLimit *RateLimitStatus `json:"rate_limit,omitempty"`
+
+	// Schema is what the tenant's API schema supports, once probed.
+	Schema *SchemaCapabilities `json:"schema,omitempty"`
+
+	// Tenants holds the status of each tenant block.
+	Tenants []*Status `json:"tenants,omitempty"`
+}
+
+// StatusFailure is a resource whose sync failed and is queued for retry.
+// Tenant is only set in /twingate/failures, which lists every tenant
+// block's failures together.
+type StatusFailure struct {
+	Tenant    string    `json:"tenant,omitempty"`
+	Name      string    `json:"name"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	NextRetry time.Time `json:"next_retry"`
+	GaveUp    bool      `json:"gave_up,omitempty"`
+}
+
+// StatusResource is a managed resource, traced back to the host it was
+// created for when its name had to be sanitized.
+type StatusResource struct {
+	Name    string `json:"name"`
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Host    string `json:"host,omitempty"`
+
+	// SecurityPolicy is the policy that applies to the resource, with
+	// security_posture enabled.
+	SecurityPolicy *ResourcePolicy `json:"security_policy,omitempty"`
+
+	// Access lists the groups and service accounts with access to the
+	// resource, with access_listing enabled.
+	Access []AccessPrincipal `json:"access,omitempty"`
+
+	// ExpiresAt is when the resource is deleted, for a site with a ttl.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (a *adminAPI) handleStatus(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, app.status())
+}
+
+// Manifest is the desired state the plugin manages: every resource it
+// would sync, with the remote network of each resolved.
+type Manifest struct {
+	Tenant    string            `json:"tenant"`
+	Label     string            `json:"label,omitempty"`
+	Resources []ResourceMapping `json:"resources"`
+
+	// Tenants holds the manifest of each tenant block.
+	Tenants []*Manifest `json:"tenants,omitempty"`
+}
+
+// handleMappings returns the manifest of currently discovered mappings.
+func (a *adminAPI) handleMappings(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	manifest, err := app.manifest(r.Context())
+	if err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+
+	return writeJSON(w, manifest)
+}
+
+// handleSummary previews what the next sync would change.
+func (a *adminAPI) handleSummary(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	summary, err := app.summary(r.Context())
+	if err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+
+	return writeJSON(w, summary)
+}
+
+// runningApp returns the running app, or an API error if there is none.
+func runningApp() (*TwingateApp, error) {
+	app := currentApp()
+	if app == nil {
+		return nil, caddy.APIError{
+			HTTPStatus: http.StatusServiceUnavailable,
+			Err:        fmt.Errorf("twingate app is not running"),
+		}
+	}
+	return app, nil
+}
+
+// checkWritable returns an API error if the app is read_only.
+func (t *TwingateApp) checkWritable() error {
+	if t.ReadOnly {
+		return caddy.APIError{
+			HTTPStatus: http.StatusConflict,
+			Err:        errReadOnly,
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
+
+// status reports the resources from the last successful sync, sorted by
+// name, followed by the status of each tenant block.
+func (t *TwingateApp) status() *Status {
+	status := t.ownStatus()
+	for _, label := range t.tenantLabels() {
+		status.Tenants = append(status.Tenants, t.Tenants[label].status())
+	}
+	return status
+}
+
+func (t *TwingateApp) ownStatus() *Status {
+	t.syncMutex.RLock()
+	defer t.syncMutex.RUnlock()
+
+	hosts := make(map[string]string, len(t.renamed))
+	for host, name := range t.renamed {
+		hosts[name] = host
+	}
+
+	status := &Status{
+		Version:         pluginVersion(),
+		Tenant:          t.Tenant,
+		Label:           t.label,
+		ResourceCount:   len(t.resources),
+		Resources:       make([]StatusResource, 0, len(t.resources)),
+		LastSyncAPI:     t.lastAPIStats,
+		LastSyncID:      t.lastSyncID,
+		SyncQueue:       t.syncs.status(),
+		Drifts:          t.lastDrifts,
+		ReadOnly:        t.ReadOnly,
+		Plan:            t.lastPlan,
+		Pending:         t.pending,
+		AddressProblems: t.addressProblems,
+		Flapping:        t.flapping,
+	}
+	if !t.lastSync.IsZero() {
+		lastSync := t.lastSync
+		status.LastSync = &lastSync
+	}
+	if t.lastSyncErr != nil {
+		status.LastSyncError = t.lastSyncErr.Error()
+	}
+	if t.client != nil && t.client.breaker != nil {
+		status.CircuitBreaker = t.client.breaker.status()
+	}
+	if t.client != nil {
+		status.Schema = t.client.schema.Load()
+		status.RateLimit = t.client.rateLimit.snapshot()
+	}
+	if t.retries != nil {
+		status.Failing = t.retries.statusFailures()
+	}
+
+	for name, res := range t.resources {
+		item := StatusResource{
+			Name:    name,
+			ID:      res.ID,
+			Address: res.Address.Value,
+			Host:    hosts[name],
+		}
+		if policy, ok := t.posture[res.ID]; ok {
+			item.SecurityPolicy = &policy
+		}
+		item.Access = t.access[res.ID]
+		if expiresAt, ok := t.expiries[name]; ok {
+			item.ExpiresAt = &expiresAt
+		}
+		status.Resources = append(status.Resources, item)
+	}
+	sort.Slice(status.Resources, func(i, j int) bool {
+		return status.Resources[i].Name < status.Resources[j].Name
+	})
+
+	return status
+}
+
+// manifest discovers the current mappings and fills in each one's
+// effective remote network, followed by the manifest of each tenant block.
+func (t *TwingateApp) manifest(ctx context.Context) (*Manifest, error) {
+	manifest := &Manifest{
+		Tenant:    t.Tenant,
+		Label:     t.label,
+		Resources: []ResourceMapping{},
+	}
+	for _, label := range t.tenantLabels() {
+		tenant, err := t.Tenants[label].manifest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("tenant block %s: %w", label, err)
+		}
+		manifest.Tenants = append(manifest.Tenants, tenant)
+	}
+	if t.Tenant == "" {
+		return manifest, nil
+	}
+
+	mappings, err := t.discoverMappings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultNetwork := t.remoteNetworkName()
+	for i := range mappings {
+		if mappings[i].RemoteNetwork == "" {
+			mappings[i].RemoteNetwork = defaultNetwork
+		}
+	}
+
+	manifest.Resources = mappings
+	return manifest, nil
+}
+
+// handleConfig returns the redacted capabilities of the running app.
+func (a *adminAPI) handleConfig(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, app.capabilities())
+}
+
+// handleHealthz reports whether syncs are succeeding, responding 503 once
+// the app or a tenant block has failed unhealthy_after syncs in a row.
+func (a *adminAPI) handleHealthz(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	health := app.health()
+	if !health.Healthy {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return json.NewEncoder(w).Encode(health)
+	}
+	return writeJSON(w, health)
+}
+
+// CleanupRequest runs a resource cleanup outside of a sync. With DryRun
+// the stale resources are only listed. Otherwise IDs names the stale
+// resources to delete, typically those listed by a dry run and confirmed
+// by an operator.
+type CleanupRequest struct {
+	DryRun bool     `json:"dry_run,omitempty"`
+	IDs    []string `json:"ids,omitempty"`
+}
+
+// handleCleanup lists or deletes the stale resources of the running app.
+func (a *adminAPI) handleCleanup(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	var req CleanupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("decoding request: %v", err),
+		}
+	}
+	if (len(req.IDs) > 0) == req.DryRun {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("either ids or dry_run is required"),
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	if !req.DryRun {
+		if err := app.checkWritable(); err != nil {
+			return err
+		}
+	}
+
+	cleaned, err := app.runCleanup(r.Context(), req.DryRun, req.IDs)
+	if errors.Is(err, errCleanupRunning) {
+		return caddy.APIError{
+			HTTPStatus: http.StatusConflict,
+			Err:        err,
+		}
+	}
+	if err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+	if cleaned == nil {
+		cleaned = []CleanedResource{}
+	}
+	return writeJSON(w, map[string]any{"resources": cleaned})
+}
+
+// handleCleanupAbort stops a resource cleanup in progress before its next
+// deletion. Resources already deleted stay deleted.
+func (a *adminAPI) handleCleanupAbort(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, map[string]bool{"aborted": app.abortCleanup()})
+}
+
+// UndoDeleteRequest selects the journaled resources to recreate: the most
+// recent deletion of each of Names, or with All every deletion within
+// Since, a duration such as "1h", or all journaled ones without it.
+type UndoDeleteRequest struct {
+	Names []string `json:"names,omitempty"`
+	All   bool     `json:"all,omitempty"`
+	Since string   `json:"since,omitempty"`
+}
+
+// handleUndoDelete recreates resources deleted by the plugin from its
+// deletion journal.
+func (a *adminAPI) handleUndoDelete(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	var req UndoDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("decoding request: %v", err),
+		}
+	}
+	if (len(req.Names) > 0) == req.All {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("either names or all is required"),
+		}
+	}
+	var since time.Duration
+	if req.Since != "" {
+		var err error
+		since, err = caddy.ParseDuration(req.Since)
+		if err != nil || since <= 0 {
+			return caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        fmt.Errorf("invalid since: %s", req.Since),
+			}
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	if err := app.checkWritable(); err != nil {
+		return err
+	}
+
+	restored, err := app.undoDelete(r.Context(), req.Names, since)
+	if err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+	if restored == nil {
+		restored = []RestoredResource{}
+	}
+	return writeJSON(w, map[string]any{"restored": restored})
+}
+
+// handleFailures lists the resources whose sync failed, with their last
+// error, attempts and next retry.
+func (a *adminAPI) handleFailures(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	failures := app.failures()
+	if failures == nil {
+		failures = []StatusFailure{}
+	}
+	return writeJSON(w, map[string]any{"failures": failures})
+}
+
+// RetryFailuresRequest selects the failed resources to retry now: Names,
+// or with All every one.
+type RetryFailuresRequest struct {
+	Names []string `json:"names,omitempty"`
+	All   bool     `json:"all,omitempty"`
+}
+
+// handleRetryFailures retries failed resources without waiting for their
+// next retry.
+func (a *adminAPI) handleRetryFailures(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	var req RetryFailuresRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("decoding request: %v", err),
+		}
+	}
+	if (len(req.Names) > 0) == req.All {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("either names or all is required"),
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	if err := app.checkWritable(); err != nil {
+		return err
+	}
+	if app.ApprovalRequired {
+		return caddy.APIError{
+			HTTPStatus: http.StatusConflict,
+			Err:        errApprovalRequired,
+		}
+	}
+
+	retried := app.forceRetry(r.Context(), req.Names)
+	if retried == nil {
+		retried = []RetriedResource{}
+	}
+	return writeJSON(w, map[string]any{"retried": retried})
+}
+
+// ApproveRequest selects the pending plans to approve: those with the
+// given IDs, or all of them.
+type ApproveRequest struct {
+	IDs []string `json:"ids,omitempty"`
+	All bool     `json:"all,omitempty"`
+}
+
+// handleApprove lists the plans held for approval, or, on POST, runs the
+// syncs of the selected ones.
+func (a *adminAPI) handleApprove(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+	default:
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	app, err := runningApp()
+	if err != nil {
+		return err
+	}
+
+	if r.Method == http.MethodGet {
+		pending := app.pendingPlans()
+		if pending == nil {
+			pending = []*PendingPlan{}
+		}
+		return writeJSON(w, map[string]any{"pending": pending})
+	}
+
+	var req ApproveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("decoding request: %v", err),
+		}
+	}
+	if (len(req.IDs) > 0) == req.All {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("either ids or all is required"),
+		}
+	}
+
+	approved := app.approve(r.Context(), req.IDs)
+	if approved == nil {
+		approved = []ApprovedPlan{}
+	}
+	return writeJSON(w, map[string]any{"approved": approved})
+}
+
+var _ caddy.AdminRouter = (*adminAPI)(nil)
@@ -0,0 +1,99 @@
+package twingate
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// AliasRewrite exposes discovered hosts under another domain: a host
+// ending in From gets an alias ending in To instead, so app.example.com
+// with From example.com and To internal.corp becomes app.internal.corp.
+type AliasRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (rw AliasRewrite) validate() error {
+	if !isDNSName(rw.From) || !isDNSName(rw.To) {
+		return fmt.Errorf("%s => %s: both domains must be valid DNS names", rw.From, rw.To)
+	}
+	return nil
+}
+
+// rewrite returns host with the From suffix replaced by To, and whether
+// host ends in From.
+func (rw AliasRewrite) rewrite(host string) (string, bool) {
+	from := strings.ToLower(rw.From)
+	if host == from {
+		return rw.To, true
+	}
+	if prefix, ok := strings.CutSuffix(host, "."+from); ok {
+		return prefix + "." + rw.To, true
+	}
+	return "", false
+}
+
+// rewriteAlias returns the alias for host after applying the alias
+// rewrites, the first matching rewrite winning, or else the alias suffix,
+// which replaces everything after the host's first label. It returns host
+// unchanged when neither applies.
+func (t *TwingateApp) rewriteAlias(host string) string {
+	host = strings.ToLower(host)
+	for _, rw := range t.AliasRewrites {
+		if alias, ok := rw.rewrite(host); ok {
+			return alias
+		}
+	}
+	if t.AliasSuffix != "" {
+		label, _, _ := strings.Cut(host, ".")
+		return label + "." + t.AliasSuffix
+	}
+	return host
+}
+
+// rewriteAliases applies the alias rewrites to discovered mappings in
+// place. The original alias is kept so resources created before the
+// rewrite are matched and updated rather than duplicated. A host whose
+// rewritten alias another host already has, such as two hosts sharing a
+// first label under alias_suffix, keeps its own alias instead.
+func (t *TwingateApp) rewriteAliases(mappings []ResourceMapping) []ResourceMapping {
+	if len(t.AliasRewrites) == 0 && t.AliasSuffix == "" {
+		return mappings
+	}
+
+	// hosts maps each alias to the host that was given it.
+	hosts := make(map[string]string)
+	for _, m := range mappings {
+		if m.Alias != nil && t.rewriteAlias(*m.Alias) == strings.ToLower(*m.Alias) {
+			hosts[strings.ToLower(*m.Alias)] = *m.Alias
+		}
+	}
+	for i := range mappings {
+		m := &mappings[i]
+		if m.Alias == nil {
+			continue
+		}
+		alias := t.rewriteAlias(*m.Alias)
+		if alias == *m.Alias {
+			continue
+		}
+		if host, ok := hosts[alias]; ok && !strings.EqualFold(host, *m.Alias) {
+			t.logger.Warn("Rewritten alias collides with another host's, keeping the host alias",
+				zap.String("name", m.Name),
+				zap.String("host_alias", *m.Alias),
+				zap.String("alias", alias),
+				zap.String("other_host", host))
+			continue
+		}
+		hosts[alias] = *m.Alias
+		t.logger.Debug("Rewrote resource alias",
+			zap.String("name", m.Name),
+			zap.String("host_alias", *m.Alias),
+			zap.String("alias", alias))
+		m.OriginalAlias = *m.Alias
+		m.Alias = &alias
+	}
+	return mappings
+}
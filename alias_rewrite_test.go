@@ -0,0 +1,100 @@
+package twingate
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRewriteAlias(t *testing.T) {
+	app := &TwingateApp{
+		AliasRewrites: []AliasRewrite{
+			{From: "example.com", To: "internal.corp"},
+			{From: "example.org", To: "org.internal.corp"},
+		},
+		AliasSuffix: "other.corp",
+	}
+
+	for host, want := range map[string]string{
+		"app.example.com":     "app.internal.corp",
+		"a.b.example.com":     "a.b.internal.corp",
+		"example.com":         "internal.corp",
+		"App.Example.org":     "app.org.internal.corp",
+		"app.notexample.com":  "app.other.corp",
+		"app.sub.example.net": "app.other.corp",
+		"localhost":           "localhost.other.corp",
+	} {
+		if got := app.rewriteAlias(host); got != want {
+			t.Errorf("rewriteAlias(%q) = %q, want %q", host, got, want)
+		}
+	}
+
+	app.AliasSuffix = ""
+	if got := app.rewriteAlias("app.example.net"); got != "app.example.net" {
+		t.Errorf("unmatched host should keep its alias, got %q", got)
+	}
+}
+
+func TestRewriteAliases(t *testing.T) {
+	app := &TwingateApp{
+		logger:        zap.NewNop(),
+		AliasRewrites: []AliasRewrite{{From: "example.com", To: "internal.corp"}},
+	}
+	alias, other := "app.example.com", "app.example.net"
+	mappings := app.rewriteAliases([]ResourceMapping{
+		{Name: "app.example.com", Alias: &alias},
+		{Name: "app.example.net", Alias: &other},
+		{Name: "*.example.com"},
+	})
+
+	if got := mappings[0]; *got.Alias != "app.internal.corp" || got.OriginalAlias != "app.example.com" {
+		t.Errorf("expected rewritten alias, got %q (original %q)", *got.Alias, got.OriginalAlias)
+	}
+	if got := mappings[1]; *got.Alias != "app.example.net" || got.OriginalAlias != "" {
+		t.Errorf("unmatched alias should be unchanged, got %q (original %q)", *got.Alias, got.OriginalAlias)
+	}
+	if mappings[2].Alias != nil {
+		t.Errorf("mapping without alias should not get one, got %q", *mappings[2].Alias)
+	}
+}
+
+func TestRewriteAliasesSkipsCollisions(t *testing.T) {
+	app := &TwingateApp{
+		logger:      zap.NewNop(),
+		AliasSuffix: "internal.corp",
+	}
+	first, second, taken := "app.example.com", "app.example.net", "db.internal.corp"
+	other := "db.example.com"
+	mappings := app.rewriteAliases([]ResourceMapping{
+		{Name: first, Alias: &first},
+		{Name: second, Alias: &second},
+		{Name: other, Alias: &other},
+		{Name: taken, Alias: &taken},
+	})
+
+	if got := mappings[0]; *got.Alias != "app.internal.corp" {
+		t.Errorf("first host should get the rewritten alias, got %q", *got.Alias)
+	}
+	if got := mappings[1]; *got.Alias != "app.example.net" || got.OriginalAlias != "" {
+		t.Errorf("colliding host should keep its alias, got %q (original %q)", *got.Alias, got.OriginalAlias)
+	}
+	if got := mappings[2]; *got.Alias != "db.example.com" {
+		t.Errorf("host colliding with an unrewritten alias should keep its alias, got %q", *got.Alias)
+	}
+	if got := mappings[3]; *got.Alias != "db.internal.corp" {
+		t.Errorf("unrewritten alias should be unchanged, got %q", *got.Alias)
+	}
+}
+
+func TestValidateAliasRewrites(t *testing.T) {
+	t.Setenv("TWINGATE_API_KEY", "test-key")
+
+	for name, app := range map[string]*TwingateApp{
+		"suffix":  {Tenant: "acme", AliasSuffix: "-bad-.corp"},
+		"rewrite": {Tenant: "acme", AliasRewrites: []AliasRewrite{{From: "example.com", To: "internal corp"}}},
+	} {
+		if err := app.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package twingate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	graphql "github.com/hasura/go-graphql-client"
+)
+
+// Known causes of failed resource mutations, matched with errors.Is on
+// the errors returned by CreateResource, UpdateResource and DeleteResource.
+var (
+	ErrDuplicateAlias   = errors.New("duplicate alias")
+	ErrInvalidAddress   = errors.New("invalid address")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidAPIKey    = errors.New("invalid API key")
+)
+
+// HintedError is an API error with a known cause and a hint on how to fix
+// it. The original error message is kept as is.
+type HintedError struct {
+	Err   error
+	Cause error
+	Hint  string
+}
+
+func (e *HintedError) Error() string {
+	return e.Err.Error() + " (" + e.Hint + ")"
+}
+
+func (e *HintedError) Unwrap() []error {
+	return []error{e.Err, e.Cause}
+}
+
+// AliasConflictError is returned before a resource is created when its
+// alias is already used by another resource in the tenant.
+type AliasConflictError struct {
+	Alias           string
+	ResourceID      string
+	ResourceName    string
+	RemoteNetworkID string
+}
+
+func (e *AliasConflictError) Error() string {
+	return fmt.Sprintf("alias %s is already used by resource %s (%s) in remote network %s",
+		e.Alias, e.ResourceName, e.ResourceID, e.RemoteNetworkID)
+}
+
+func (e *AliasConflictError) Unwrap() error {
+	return ErrDuplicateAlias
+}
+
+// withHint wraps err in a HintedError when it matches a known Twingate
+// error. Other errors are returned unchanged.
+func withHint(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var netErr graphql.NetworkError
+	if errors.As(err, &netErr) {
+		switch netErr.StatusCode() {
+		case http.StatusUnauthorized:
+			return &HintedError{Err: err, Cause: ErrInvalidAPIKey,
+				Hint: "the API key was rejected; check that it is set correctly and has not been revoked"}
+		case http.StatusForbidden:
+			return permissionDenied(err)
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "alias") && containsAny(msg, "already", "exists", "duplicate", "taken", "in use", "unique"):
+		return &HintedError{Err: err, Cause: ErrDuplicateAlias,
+			Hint: "another resource already uses this alias; give the site a different alias or remove it from the other resource in the Twingate console"}
+	case strings.Contains(msg, "address") && containsAny(msg, "invalid", "not a valid", "malformed"):
+		return &HintedError{Err: err, Cause: ErrInvalidAddress,
+			Hint: "Twingate accepts an IP address, CIDR range or DNS name; check caddy_address and address_mode"}
+	case containsAny(msg, "permission", "forbidden", "not authorized", "unauthorized", "read-only", "read only", "access denied"):
+		return permissionDenied(err)
+	}
+	return err
+}
+
+func permissionDenied(err error) error {
+	return &HintedError{Err: err, Cause: ErrPermissionDenied,
+		Hint: "the API key needs Read/Write permission; create one under Settings > API in the Twingate admin console"}
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hasura/go-graphql-client"
+	"go.uber.org/zap"
+)
+
+func TestWithHint(t *testing.T) {
+	tests := []struct {
+		msg   string
+		cause error
+	}{
+		{"resource creation failed: Alias already exists", ErrDuplicateAlias},
+		{"resource update failed: alias must be unique", ErrDuplicateAlias},
+		{"resource creation failed: Invalid address: 10.0.0.300", ErrInvalidAddress},
+		{"failed to delete resource: Permission denied", ErrPermissionDenied},
+		{"resource creation failed: API key is read-only", ErrPermissionDenied},
+		{"resource creation failed: remote network not found", nil},
+	}
+	for _, tt := range tests {
+		err := withHint(errors.New(tt.msg))
+		if tt.cause == nil {
+			var hinted *HintedError
+			if errors.As(err, &hinted) {
+				t.Errorf("%q should not get a hint, got %v", tt.msg, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.cause) {
+			t.Errorf("%q: errors.Is(%v) = false, want cause %v", tt.msg, err, tt.cause)
+		}
+		if !strings.HasPrefix(err.Error(), tt.msg+" (") {
+			t.Errorf("%q: message should keep the original and add a hint, got %q", tt.msg, err)
+		}
+	}
+
+	if withHint(nil) != nil {
+		t.Error("withHint(nil) should be nil")
+	}
+}
+
+func TestCreateResource_HintsDuplicateAlias(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		return map[string]any{"resourceCreate": map[string]any{
+			"ok": false, "error": "Alias already exists", "entity": nil,
+		}}
+	})
+
+	_, err := client.CreateResource(context.Background(), ResourceCreateInput{
+		Name: "api.example.com", Address: "10.0.0.1", RemoteNetworkID: "net1", Alias: "api.internal",
+	})
+	if !errors.Is(err, ErrDuplicateAlias) {
+		t.Fatalf("expected duplicate alias error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "different alias") {
+		t.Errorf("error should carry a hint: %v", err)
+	}
+}
+
+func TestDeleteResource_HintsReadOnlyKey(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		return errors.New("Permission denied")
+	})
+
+	err := client.DeleteResource(context.Background(), "r1")
+	if !errors.Is(err, ErrPermissionDenied) || !strings.Contains(err.Error(), "Read/Write") {
+		t.Errorf("expected permission error with a Read/Write hint, got %v", err)
+	}
+}
+
+func TestUpdateResource_HintsRejectedKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+	client := &TwingateClient{
+		client: graphql.NewClient(server.URL, server.Client()),
+		logger: zap.NewNop(),
+	}
+
+	name := "api.example.com"
+	_, err := client.UpdateResource(context.Background(), ResourceUpdateInput{ID: "r1", Name: &name})
+	if !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected invalid API key error, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hasura/go-graphql-client"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// API call operations, as recorded in APIStats and metrics.
+const (
+	operationQuery    = "query"
+	operationMutation = "mutation"
+)
+
+// Classes of failed API calls.
+const (
+	APIErrorRateLimited = "rate_limited"
+	APIErrorHTTP        = "http"
+	APIErrorNetwork     = "network"
+	APIErrorTimeout     = "timeout"
+	APIErrorGraphQL     = "graphql"
+)
+
+// APIStats counts the GraphQL calls made during a sync.
+type APIStats struct {
+	Queries   int `json:"queries"`
+	Mutations int `json:"mutations"`
+
+	// LatencyMS is the total time spent waiting on the API.
+	LatencyMS int64 `json:"latency_ms"`
+
+	// Errors counts failed calls by class, such as rate_limited.
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+// Calls returns the total number of calls.
+func (s APIStats) Calls() int {
+	return s.Queries + s.Mutations
+}
+
+// apiStats collects APIStats for the calls made with a context returned by
+// withAPIStats. Calls may be made concurrently.
+type apiStats struct {
+	mu      sync.Mutex
+	stats   APIStats
+	latency time.Duration
+}
+
+type apiStatsKey struct{}
+
+// withAPIStats returns a context that records the API calls made with it.
+func withAPIStats(ctx context.Context) (context.Context, *apiStats) {
+	stats := &apiStats{}
+	return context.WithValue(ctx, apiStatsKey{}, stats), stats
+}
+
+func (s *apiStats) record(operation string, took time.Duration, errClass string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if operation == operationMutation {
+		s.stats.Mutations++
+	} else {
+		s.stats.Queries++
+	}
+	s.latency += took
+	if errClass != "" {
+		if s.stats.Errors == nil {
+			s.stats.Errors = make(map[string]int)
+		}
+		s.stats.Errors[errClass]++
+	}
+}
+
+func (s *apiStats) snapshot() APIStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.LatencyMS = s.latency.Milliseconds()
+	if s.stats.Errors != nil {
+		stats.Errors = make(map[string]int, len(s.stats.Errors))
+		for class, n := range s.stats.Errors {
+			stats.Errors[class] = n
+		}
+	}
+	return stats
+}
+
+func (c *TwingateClient) query(ctx context.Context, q any, variables map[string]any) error {
+	if err := c.breaker.allow(ctx); err != nil {
+		return err
+	}
+	started := time.Now()
+	err := c.client.Query(ctx, q, variables)
+	recordAPICall(ctx, operationQuery, time.Since(started), err)
+	c.breaker.record(err)
+	return err
+}
+
+func (c *TwingateClient) mutate(ctx context.Context, m any, variables map[string]any) error {
+	if err := c.breaker.allow(ctx); err != nil {
+		return err
+	}
+	started := time.Now()
+	err := c.client.Mutate(withMutationID(ctx, m, variables), m, variables)
+	recordAPICall(ctx, operationMutation, time.Since(started), err)
+	c.breaker.record(err)
+	return err
+}
+
+// recordAPICall counts a call in the metrics and in the context's stats.
+func recordAPICall(ctx context.Context, operation string, took time.Duration, err error) {
+	class := classifyAPIError(err)
+
+	initMetrics()
+	result := class
+	if result == "" {
+		result = "ok"
+	}
+	requests := twingateMetrics.apiRequests.WithLabelValues(operation, result)
+	duration := twingateMetrics.apiDuration.WithLabelValues(operation)
+	// The sync ID is attached as an exemplar rather than a label, which
+	// would give each sync its own series.
+	if id := syncIDFrom(ctx); id != "" {
+		exemplar := prometheus.Labels{"sync_id": id}
+		requests.(prometheus.ExemplarAdder).AddWithExemplar(1, exemplar)
+		duration.(prometheus.ExemplarObserver).ObserveWithExemplar(took.Seconds(), exemplar)
+	} else {
+		requests.Inc()
+		duration.Observe(took.Seconds())
+	}
+
+	if stats, ok := ctx.Value(apiStatsKey{}).(*apiStats); ok {
+		stats.record(operation, took, class)
+	}
+	markProgress(ctx)
+}
+
+// classifyAPIError returns the class of a failed call, or "" for nil.
+func classifyAPIError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var netErr graphql.NetworkError
+	if errors.As(err, &netErr) {
+		if netErr.StatusCode() == http.StatusTooManyRequests {
+			return APIErrorRateLimited
+		}
+		return APIErrorHTTP
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return APIErrorTimeout
+	}
+	var opErr net.Error
+	if errors.As(err, &opErr) {
+		if opErr.Timeout() {
+			return APIErrorTimeout
+		}
+		return APIErrorNetwork
+	}
+	return APIErrorGraphQL
+}
+
+// recordAPIStats logs the API calls made by a sync, warning when they
+// exceed the configured budget, and keeps them for the status endpoint.
+// The caller holds syncMutex.
+func (t *TwingateApp) recordAPIStats(ctx context.Context, stats APIStats) {
+	t.lastAPIStats = &stats
+
+	fields := []zap.Field{
+		zap.Int("queries", stats.Queries),
+		zap.Int("mutations", stats.Mutations),
+		zap.Int64("latency_ms", stats.LatencyMS),
+		zap.Any("errors", stats.Errors),
+	}
+	if t.APICallBudget > 0 && stats.Calls() > t.APICallBudget {
+		t.log(ctx).Warn("Sync exceeded its API call budget",
+			append(fields, zap.Int("budget", t.APICallBudget))...)
+		return
+	}
+	t.log(ctx).Info("Twingate API usage for sync", fields...)
+}
@@ -0,0 +1,81 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hasura/go-graphql-client"
+	"go.uber.org/zap"
+)
+
+func TestAPIStats_CountsCalls(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if strings.Contains(req.Query, "resourceDelete") {
+			return map[string]any{"resourceDelete": map[string]any{"ok": true, "error": nil}}
+		}
+		return errors.New("Cannot query field")
+	})
+
+	ctx, stats := withAPIStats(context.Background())
+	_ = client.DeleteResource(ctx, "r1")
+	_, _ = client.GetUser(ctx, "u1")
+
+	// Calls made without the stats context are not counted
+	_ = client.DeleteResource(context.Background(), "r2")
+
+	got := stats.snapshot()
+	if got.Queries != 1 || got.Mutations != 1 || got.Calls() != 2 {
+		t.Errorf("stats = %+v, want 1 query and 1 mutation", got)
+	}
+	if got.Errors[APIErrorGraphQL] != 1 {
+		t.Errorf("errors = %v, want one graphql error", got.Errors)
+	}
+}
+
+func TestClassifyAPIError(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	client := graphql.NewClient(server.URL, server.Client())
+
+	httpError := func(code int) error {
+		status = code
+		var query struct {
+			User struct{ ID string } `graphql:"user(id: \"u1\")"`
+		}
+		return client.Query(context.Background(), &query, nil)
+	}
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{httpError(http.StatusTooManyRequests), APIErrorRateLimited},
+		{httpError(http.StatusBadGateway), APIErrorHTTP},
+		{fmt.Errorf("request: %w", context.DeadlineExceeded), APIErrorTimeout},
+		{errors.New("Cannot query field"), APIErrorGraphQL},
+	}
+	for _, tt := range tests {
+		if got := classifyAPIError(tt.err); got != tt.want {
+			t.Errorf("classifyAPIError(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRecordAPIStats(t *testing.T) {
+	app := &TwingateApp{APICallBudget: 1, logger: zap.NewNop()}
+	app.recordAPIStats(context.Background(), APIStats{Queries: 2, Mutations: 1})
+
+	status := app.status()
+	if status.LastSyncAPI == nil || status.LastSyncAPI.Calls() != 3 {
+		t.Errorf("status LastSyncAPI = %+v, want 3 calls", status.LastSyncAPI)
+	}
+}
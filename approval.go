@@ -0,0 +1,175 @@
+package twingate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errApprovalRequired is returned for changes outside a sync, such as a
+// forced retry, while approval_required is set.
+var errApprovalRequired = errors.New("approval_required is set, changes wait for an approved sync")
+
+// PendingPlan is a sync plan held until it is approved, with
+// approval_required set. Its ID is derived from the changes it lists, so
+// the next sync finding the same changes keeps the same ID.
+type PendingPlan struct {
+	ID         string       `json:"id"`
+	Tenant     string       `json:"tenant"`
+	Label      string       `json:"label,omitempty"`
+	ComputedAt time.Time    `json:"computed_at"`
+	Plan       *SyncSummary `json:"plan"`
+}
+
+// ApprovedPlan is the outcome of approving a pending plan. Applied is set
+// once the sync ran the plan; a plan that no longer matches the tenant is
+// replaced by a new Pending one instead.
+type ApprovedPlan struct {
+	ID      string       `json:"id"`
+	Tenant  string       `json:"tenant"`
+	Label   string       `json:"label,omitempty"`
+	Applied bool         `json:"applied"`
+	Error   string       `json:"error,omitempty"`
+	Pending *PendingPlan `json:"pending,omitempty"`
+}
+
+// holdForApproval plans the sync and reports whether it must wait for
+// approval. A plan without changes, or the one last approved, goes ahead.
+func (t *TwingateApp) holdForApproval(ctx context.Context, syncer *ResourceSyncer, mappings []ResourceMapping) (bool, error) {
+	logger := t.log(ctx)
+
+	plan, err := syncer.GetSyncSummary(ctx, mappings, t.remoteNetworkName(), t.ResourceCleanup)
+	if err != nil {
+		return false, fmt.Errorf("failed to plan sync: %w", err)
+	}
+	if err := t.planExpired(ctx, plan); err != nil {
+		return false, err
+	}
+	plan.Tenant = t.Tenant
+	plan.Label = t.label
+
+	id := planID(plan)
+	switch {
+	case id == "":
+		t.pending = nil
+		return false, nil
+	case id == t.approved:
+		t.pending = nil
+		t.approved = ""
+		logger.Info("Running approved sync plan", zap.String("plan_id", id))
+		return false, nil
+	}
+
+	if t.pending == nil || t.pending.ID != id {
+		t.pending = &PendingPlan{
+			ID:         id,
+			Tenant:     t.Tenant,
+			Label:      t.label,
+			ComputedAt: time.Now(),
+			Plan:       plan,
+		}
+		t.emit(ctx, "twingate_sync_pending_approval", map[string]any{
+			"plan_id": id,
+			"create":  plan.ResourcesToCreate,
+			"update":  plan.ResourcesToUpdate,
+			"delete":  plan.ResourcesToDelete,
+		})
+	}
+	logger.Warn("Sync held for approval, tenant left unchanged",
+		zap.String("plan_id", id),
+		zap.Int("create", plan.ResourcesToCreate),
+		zap.Int("update", plan.ResourcesToUpdate),
+		zap.Int("delete", plan.ResourcesToDelete))
+	return true, nil
+}
+
+// planID returns a hash of the changes the plan lists, or "" if it lists
+// none.
+func planID(plan *SyncSummary) string {
+	var changes []string
+	for _, network := range plan.Networks {
+		if network.Action == "create" {
+			changes = append(changes, "network\x00"+network.Name)
+		}
+	}
+	for _, item := range plan.Resources {
+		switch item.Action {
+		case "create", "update", "rename", "delete":
+			changes = append(changes, strings.Join([]string{
+				item.Action, item.Name, item.ID, item.Address, item.RemoteNetwork,
+				strings.Join(item.Changes, ","), item.inputs,
+			}, "\x00"))
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	sort.Strings(changes)
+
+	sum := sha256.Sum256([]byte(strings.Join(changes, "\n")))
+	return hex.EncodeToString(sum[:6])
+}
+
+// pendingPlans lists the plans held for approval in the app and each
+// tenant block.
+func (t *TwingateApp) pendingPlans() []*PendingPlan {
+	var plans []*PendingPlan
+	t.syncMutex.RLock()
+	if t.pending != nil {
+		plans = append(plans, t.pending)
+	}
+	t.syncMutex.RUnlock()
+
+	for _, label := range t.tenantLabels() {
+		plans = append(plans, t.Tenants[label].pendingPlans()...)
+	}
+	return plans
+}
+
+// approve runs the syncs of the pending plans with the given IDs, or of
+// all of them if none are given, in the app and each tenant block.
+func (t *TwingateApp) approve(ctx context.Context, ids []string) []ApprovedPlan {
+	var approved []ApprovedPlan
+
+	t.syncMutex.Lock()
+	pending := t.pending
+	if pending != nil && (len(ids) == 0 || slices.Contains(ids, pending.ID)) {
+		t.approved = pending.ID
+	} else {
+		pending = nil
+	}
+	t.syncMutex.Unlock()
+
+	if pending != nil {
+		t.log(ctx).Info("Sync plan approved",
+			zap.String("plan_id", pending.ID))
+		result := ApprovedPlan{ID: pending.ID, Tenant: t.Tenant, Label: t.label}
+		if err := t.requestSync(ctx, "approve"); err != nil {
+			result.Error = err.Error()
+		}
+
+		t.syncMutex.Lock()
+		if t.approved == pending.ID {
+			// The sync found other changes and held them instead
+			t.approved = ""
+			result.Pending = t.pending
+		} else {
+			result.Applied = result.Error == ""
+		}
+		t.syncMutex.Unlock()
+		approved = append(approved, result)
+	}
+
+	for _, label := range t.tenantLabels() {
+		approved = append(approved, t.Tenants[label].approve(ctx, ids)...)
+	}
+	return approved
+}
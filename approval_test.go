@@ -0,0 +1,313 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// newApprovalApp returns an app requiring approval that syncs the routes
+// of sourceCaddyJSON into mock.
+func newApprovalApp(t *testing.T, mock *MockTwingateClient) *TwingateApp {
+	t.Helper()
+	app := newSnapshotTestApp(t, mock)
+	app.CaddyAddress = "10.0.0.5"
+	app.RoutesFrom = &RoutesSource{File: writeSourceConfig(t)}
+	app.ApprovalRequired = true
+	return app
+}
+
+// countCalls returns how many calls to mock start with prefix.
+func countCalls(mock *MockTwingateClient, prefix string) int {
+	count := 0
+	for _, call := range mock.CallLog {
+		if strings.HasPrefix(call, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestApprovalRequired(t *testing.T) {
+	initMetrics()
+	ctx := context.Background()
+
+	mock := &MockTwingateClient{}
+	app := newApprovalApp(t, mock)
+
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if countCalls(mock, "CreateResource") > 0 {
+		t.Fatalf("a held sync should not create resources: %v", mock.CallLog)
+	}
+	pending := app.pendingPlans()
+	if len(pending) != 1 || pending[0].Plan.ResourcesToCreate != 1 || pending[0].Tenant != "acme" {
+		t.Fatalf("unexpected pending plans: %+v", pending)
+	}
+	id := pending[0].ID
+
+	// The same changes keep the pending plan
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if app.pending == nil || app.pending.ID != id || app.pending != pending[0] {
+		t.Errorf("pending plan should be kept: %+v", app.pending)
+	}
+
+	if approved := app.approve(ctx, []string{"other"}); len(approved) != 0 {
+		t.Errorf("an unknown ID should approve nothing: %+v", approved)
+	}
+
+	approved := app.approve(ctx, []string{id})
+	if len(approved) != 1 || !approved[0].Applied || approved[0].ID != id || approved[0].Error != "" {
+		t.Fatalf("unexpected approval: %+v", approved)
+	}
+	if countCalls(mock, "CreateResource") == 0 || app.pending != nil || app.approved != "" {
+		t.Errorf("approved plan should have run: pending %+v, calls %v", app.pending, mock.CallLog)
+	}
+
+	// A sync without changes is not held
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if app.pending != nil {
+		t.Errorf("nothing should be pending: %+v", app.pending)
+	}
+}
+
+func TestApprovalRequired_ChangedPlan(t *testing.T) {
+	initMetrics()
+	ctx := context.Background()
+
+	mock := &MockTwingateClient{}
+	app := newApprovalApp(t, mock)
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	old := app.pending
+
+	// The tenant would now change differently than the plan approved
+	app.CaddyAddress = "10.0.0.6"
+	approved := app.approve(ctx, nil)
+	if len(approved) != 1 || approved[0].Applied || approved[0].Pending == nil || approved[0].Pending.ID == old.ID {
+		t.Fatalf("a changed plan should be held instead: %+v", approved)
+	}
+	if countCalls(mock, "CreateResource") > 0 || app.approved != "" {
+		t.Errorf("the changed plan should not run: %v", mock.CallLog)
+	}
+}
+
+func TestPlanID(t *testing.T) {
+	unchanged := &SyncSummary{Resources: []ResourceSummary{{Name: "a.example.com", Action: "unchanged"}}}
+	if id := planID(unchanged); id != "" {
+		t.Errorf("planID() = %q for a plan without changes", id)
+	}
+
+	create := ResourceSummary{Name: "a.example.com", Action: "create", Address: "10.0.0.1"}
+	remove := ResourceSummary{Name: "b.example.com", Action: "delete", ID: "r2", Address: "10.0.0.1"}
+	id := planID(&SyncSummary{Resources: []ResourceSummary{create, remove}})
+	if id == "" || id != planID(&SyncSummary{Resources: []ResourceSummary{remove, create}}) {
+		t.Errorf("planID() should not depend on order, got %q", id)
+	}
+	create.Address = "10.0.0.2"
+	if id == planID(&SyncSummary{Resources: []ResourceSummary{create, remove}}) {
+		t.Error("planID() should change with the changes")
+	}
+	network := &SyncSummary{Networks: []NetworkSummary{{Name: "IoT", Action: "create"}}}
+	if planID(network) == "" {
+		t.Error("creating a remote network is a change")
+	}
+}
+
+func TestAdminAPI_Approve(t *testing.T) {
+	initMetrics()
+
+	mock := &MockTwingateClient{}
+	app := newApprovalApp(t, mock)
+	if err := app.requestSync(context.Background(), "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	setActiveApp(t, app)
+
+	a := &adminAPI{}
+	rec := httptest.NewRecorder()
+	if err := a.handleApprove(rec, httptest.NewRequest(http.MethodGet, "/twingate/approve", nil)); err != nil {
+		t.Fatalf("handleApprove() failed: %v", err)
+	}
+	var listed struct{ Pending []*PendingPlan }
+	if err := json.NewDecoder(rec.Body).Decode(&listed); err != nil {
+		t.Fatalf("invalid pending JSON: %v", err)
+	}
+	if len(listed.Pending) != 1 || listed.Pending[0].ID != app.pending.ID {
+		t.Fatalf("unexpected pending plans: %+v", listed.Pending)
+	}
+
+	err := a.handleApprove(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/twingate/approve", strings.NewReader(`{}`)))
+	var apiErr caddy.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusBadRequest {
+		t.Errorf("handleApprove() error = %v, want 400", err)
+	}
+
+	rec = httptest.NewRecorder()
+	if err := a.handleApprove(rec, httptest.NewRequest(http.MethodPost, "/twingate/approve", strings.NewReader(`{"all": true}`))); err != nil {
+		t.Fatalf("handleApprove() failed: %v", err)
+	}
+	var result struct{ Approved []ApprovedPlan }
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid approve JSON: %v", err)
+	}
+	if len(result.Approved) != 1 || !result.Approved[0].Applied || len(app.status().Resources) != 1 {
+		t.Errorf("unexpected approval: %+v", result.Approved)
+	}
+}
+
+func TestRenderPendingPlans(t *testing.T) {
+	plans := []*PendingPlan{
+		{ID: "abc123", Tenant: "acme", Plan: &SyncSummary{
+			ResourcesToCreate: 1,
+			Resources:         []ResourceSummary{{Name: "app.example.com", Action: "create", Address: "10.0.0.5", RemoteNetwork: "Caddy-Managed"}},
+		}},
+		{ID: "def456", Tenant: "partner", Label: "b", Plan: &SyncSummary{}},
+	}
+	var out strings.Builder
+	if err := renderPendingPlans(&out, plans); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Plan abc123 for tenant acme: 1 to create, 0 to update, 0 to delete",
+		"create  app.example.com",
+		"Plan def456 for tenant block b (tenant partner)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestUnmarshalCaddyfile_ApprovalRequired(t *testing.T) {
+	for input, want := range map[string]bool{
+		"approval_required":       true,
+		"approval_required true":  true,
+		"approval_required false": false,
+	} {
+		app := &TwingateApp{}
+		err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n\t\ttenant acme\n\t\t" + input + "\n\t}"))
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", input, err)
+		}
+		if app.ApprovalRequired != want {
+			t.Errorf("%q: ApprovalRequired = %v, want %v", input, app.ApprovalRequired, want)
+		}
+	}
+
+	for _, input := range []string{
+		"approval_required maybe",
+		"approval_required true false",
+	} {
+		err := (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n\t\ttenant acme\n\t\t" + input + "\n\t}"))
+		if err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+
+	app := &TwingateApp{Tenant: "acme", ReadOnly: true, ApprovalRequired: true}
+	if err := app.Validate(); err == nil {
+		t.Error("expected error combining read_only and approval_required")
+	}
+}
+
+func TestApprovalRequired_NoRetries(t *testing.T) {
+	initMetrics()
+	ctx := context.Background()
+
+	mock := &MockTwingateClient{}
+	app := newApprovalApp(t, mock)
+	app.retries = newRetryQueue(nil)
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if app.pending == nil {
+		t.Fatal("the sync should be held for approval")
+	}
+
+	// A retry restored from a previous instance is due
+	mapping := ResourceMapping{Name: "api.example.com", Address: "10.0.0.1"}
+	app.retries.restore([]retryEntry{{Mapping: mapping, NetworkID: "net1", Attempts: 1}})
+	app.retryDue(ctx)
+
+	if countCalls(mock, "CreateResource") > 0 || countCalls(mock, "UpdateResource") > 0 {
+		t.Errorf("a retry should not change the tenant while a plan is held: %v", mock.CallLog)
+	}
+	if len(app.retries.snapshot()) != 1 {
+		t.Errorf("the retry should stay queued: %+v", app.retries.snapshot())
+	}
+}
+
+func TestApprovalRequired_AccessChange(t *testing.T) {
+	initMetrics()
+	ctx := context.Background()
+
+	mock := &MockTwingateClient{Groups: map[string]string{"Admins": "g1"}}
+	app := newApprovalApp(t, mock)
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if approved := app.approve(ctx, nil); len(approved) != 1 || !approved[0].Applied {
+		t.Fatalf("unexpected approval: %+v", approved)
+	}
+
+	// Granting access to the site is held like any other change
+	rewriteSourceConfig(t, app.RoutesFrom.File, `{"handler": "twingate", "groups": ["Admins"]}`)
+	mock.CallLog = nil
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if countCalls(mock, "UpdateResource") > 0 || len(mock.Grants) != 0 {
+		t.Fatalf("access should not be granted without approval: %v", mock.CallLog)
+	}
+	if app.pending == nil || app.pending.Plan.ResourcesToUpdate != 1 ||
+		!slices.Contains(app.pending.Plan.Resources[0].Changes, FieldGroups) {
+		t.Fatalf("the grant should be held for approval: %+v", app.pending)
+	}
+	first := app.pending.ID
+
+	// Another group makes another plan
+	mock.Groups["Engineering"] = "g2"
+	rewriteSourceConfig(t, app.RoutesFrom.File, `{"handler": "twingate", "groups": ["Engineering"]}`)
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if app.pending == nil || app.pending.ID == first {
+		t.Errorf("a different grant should change the plan ID: %+v", app.pending)
+	}
+}
+
+func TestAdminAPI_RetryFailuresApprovalRequired(t *testing.T) {
+	initMetrics()
+
+	mock := &MockTwingateClient{}
+	app := newApprovalApp(t, mock)
+	app.retries = newRetryQueue(nil)
+	app.retries.fail(ResourceMapping{Name: "app.example.com", Address: "10.0.0.5"}, "net1", errors.New("transient"))
+	setActiveApp(t, app)
+
+	err := (&adminAPI{}).handleRetryFailures(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/twingate/failures/retry", strings.NewReader(`{"all": true}`)))
+	var apiErr caddy.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusConflict {
+		t.Errorf("handleRetryFailures() error = %v, want 409", err)
+	}
+	if countCalls(mock, "CreateResource") > 0 {
+		t.Errorf("a forced retry should not change the tenant: %v", mock.CallLog)
+	}
+}
@@ -0,0 +1,243 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/hasura/go-graphql-client"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBreakerThreshold   = 5
+	defaultBreakerMinInterval = 30 * time.Second
+	defaultBreakerMaxInterval = 10 * time.Minute
+)
+
+// Circuit breaker states, as reported in the status and metrics.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// ErrCircuitOpen is returned, without calling the API, while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open, Twingate API unavailable")
+
+// BreakerConfig configures the circuit breaker that stops API calls while
+// the Twingate API is down.
+type BreakerConfig struct {
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Threshold is the number of consecutive failed calls that opens the
+	// breaker. Defaults to 5.
+	Threshold int `json:"threshold,omitempty"`
+
+	// MinInterval is the time before the first probe once the breaker
+	// opens, doubled after each failed probe up to MaxInterval. They
+	// default to 30s and 10m.
+	MinInterval caddy.Duration `json:"min_interval,omitempty"`
+	MaxInterval caddy.Duration `json:"max_interval,omitempty"`
+}
+
+// BreakerStatus is the state of a circuit breaker.
+type BreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	NextProbe           *time.Time `json:"next_probe,omitempty"`
+}
+
+// circuitBreaker counts consecutive API calls that failed because the API
+// was unreachable or erroring. After threshold of them it opens and
+// rejects calls until the probe interval has passed, then lets a single
+// call through as a probe. A successful probe closes it; a failed one
+// reopens it for twice as long, up to maxInterval.
+type circuitBreaker struct {
+	mu sync.Mutex
+
+	disabled    bool
+	threshold   int
+	minInterval time.Duration
+	maxInterval time.Duration
+
+	state     string
+	failures  int
+	interval  time.Duration
+	nextProbe time.Time
+	probing   bool
+
+	endpoint string
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+func newCircuitBreaker(endpoint string, logger *zap.Logger) *circuitBreaker {
+	b := &circuitBreaker{state: BreakerClosed, endpoint: endpoint, logger: logger, now: time.Now}
+	b.configure(nil)
+	return b
+}
+
+// configure applies cfg, keeping the breaker's current state. The breaker
+// is shared by every app instance using the same client, so the last
+// started configuration applies.
+func (b *circuitBreaker) configure(cfg *BreakerConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.disabled = false
+	b.threshold = defaultBreakerThreshold
+	b.minInterval = defaultBreakerMinInterval
+	b.maxInterval = defaultBreakerMaxInterval
+	if cfg == nil {
+		return
+	}
+	b.disabled = cfg.Disabled
+	if cfg.Threshold > 0 {
+		b.threshold = cfg.Threshold
+	}
+	if cfg.MinInterval > 0 {
+		b.minInterval = time.Duration(cfg.MinInterval)
+	}
+	if cfg.MaxInterval > 0 {
+		b.maxInterval = time.Duration(cfg.MaxInterval)
+	}
+	if b.maxInterval < b.minInterval {
+		b.maxInterval = b.minInterval
+	}
+}
+
+// allow reports whether a call made with ctx may be made, returning
+// ErrCircuitOpen if not. A call allowed while the breaker is not closed is
+// its probe, unless ctx bypasses the breaker.
+func (b *circuitBreaker) allow(ctx context.Context) error {
+	if b == nil || ctx.Value(breakerBypassKey{}) != nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.disabled || b.state == BreakerClosed {
+		return nil
+	}
+	if b.probing || b.now().Before(b.nextProbe) {
+		return fmt.Errorf("%w until %s", ErrCircuitOpen, b.nextProbe.Format(time.RFC3339))
+	}
+	b.probing = true
+	b.setState(BreakerHalfOpen)
+	b.logger.Info("Probing Twingate API after circuit breaker opened")
+	return nil
+}
+
+type breakerBypassKey struct{}
+
+// bypassBreaker returns a context whose calls the breaker lets through
+// even while open. Connection tests use it, so a config loaded while the
+// API was failing can still check it; their outcome is recorded as any
+// other, so a successful test closes the breaker.
+func bypassBreaker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, breakerBypassKey{}, true)
+}
+
+// record counts the outcome of an allowed call.
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.probing
+	b.probing = false
+
+	if !breakerFailure(err) {
+		if b.state != BreakerClosed {
+			b.logger.Info("Twingate API reachable again, circuit breaker closed",
+				zap.Int("failures", b.failures))
+		}
+		b.failures = 0
+		b.interval = 0
+		b.setState(BreakerClosed)
+		return
+	}
+
+	b.failures++
+	if b.disabled || !probe && b.failures < b.threshold {
+		return
+	}
+
+	switch {
+	case b.interval == 0:
+		b.interval = b.minInterval
+	case probe:
+		b.interval = min(2*b.interval, b.maxInterval)
+	}
+	b.nextProbe = b.now().Add(b.interval)
+	b.setState(BreakerOpen)
+	b.logger.Warn("Twingate API failing, circuit breaker open",
+		zap.Int("consecutive_failures", b.failures),
+		zap.Time("next_probe", b.nextProbe),
+		zap.Error(err))
+}
+
+// ready reports whether a call made now would be let through.
+func (b *circuitBreaker) ready() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.disabled || b.state == BreakerClosed || !b.probing && !b.now().Before(b.nextProbe)
+}
+
+// status returns the breaker's state.
+func (b *circuitBreaker) status() *BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := &BreakerStatus{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != BreakerClosed {
+		nextProbe := b.nextProbe
+		status.NextProbe = &nextProbe
+	}
+	return status
+}
+
+// setState must be called with b.mu held.
+func (b *circuitBreaker) setState(state string) {
+	b.state = state
+	if twingateMetrics.breakerState == nil {
+		return
+	}
+	for _, s := range []string{BreakerClosed, BreakerOpen, BreakerHalfOpen} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		twingateMetrics.breakerState.WithLabelValues(b.endpoint, s).Set(value)
+	}
+}
+
+// breakerFailure reports whether err means the API is unavailable: a
+// network error, a timeout or a server error. Rate limiting and GraphQL
+// errors mean it is up.
+func breakerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr graphql.NetworkError
+	if errors.As(err, &netErr) {
+		return netErr.StatusCode() >= http.StatusInternalServerError
+	}
+	switch classifyAPIError(err) {
+	case APIErrorNetwork, APIErrorTimeout:
+		return true
+	}
+	return false
+}
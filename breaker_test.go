@@ -0,0 +1,148 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/hasura/go-graphql-client"
+	"go.uber.org/zap"
+)
+
+func TestCircuitBreakerOpensAndProbes(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker("test", zap.NewNop())
+	b.now = func() time.Time { return now }
+	b.configure(&BreakerConfig{
+		Threshold:   2,
+		MinInterval: caddy.Duration(time.Minute),
+		MaxInterval: caddy.Duration(3 * time.Minute),
+	})
+	timeout := context.DeadlineExceeded
+
+	b.record(timeout)
+	if err := b.allow(context.Background()); err != nil {
+		t.Fatalf("breaker should stay closed below the threshold, got %v", err)
+	}
+	b.record(timeout)
+	if err := b.allow(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("breaker should open at the threshold, got %v", err)
+	}
+
+	// Each failed probe doubles the interval, up to the maximum
+	for _, interval := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		now = now.Add(interval - time.Second)
+		if b.ready() {
+			t.Fatalf("breaker should not probe before %v", interval)
+		}
+		now = now.Add(time.Second)
+		if err := b.allow(context.Background()); err != nil {
+			t.Fatalf("breaker should allow a probe after %v, got %v", interval, err)
+		}
+		if err := b.allow(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("breaker should allow one probe at a time, got %v", err)
+		}
+		if status := b.status(); status.State != BreakerHalfOpen {
+			t.Errorf("state during probe = %s, want %s", status.State, BreakerHalfOpen)
+		}
+		b.record(timeout)
+	}
+
+	now = now.Add(3 * time.Minute)
+	if err := b.allow(context.Background()); err != nil {
+		t.Fatalf("probe not allowed: %v", err)
+	}
+	b.record(nil)
+	if status := b.status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 || status.NextProbe != nil {
+		t.Errorf("successful probe should close the breaker, got %+v", status)
+	}
+}
+
+func TestCircuitBreakerIgnoresAPIErrors(t *testing.T) {
+	b := newCircuitBreaker("test", zap.NewNop())
+	b.configure(&BreakerConfig{Threshold: 1})
+
+	for _, err := range []error{errors.New("resource not found"), context.Canceled} {
+		b.record(err)
+		if err := b.allow(context.Background()); err != nil {
+			t.Errorf("breaker opened on a non-availability error: %v", err)
+		}
+	}
+
+	b.configure(&BreakerConfig{Disabled: true, Threshold: 1})
+	b.record(context.DeadlineExceeded)
+	if err := b.allow(context.Background()); err != nil {
+		t.Errorf("disabled breaker should allow calls, got %v", err)
+	}
+}
+
+func TestClientStopsCallingWhenBreakerOpen(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	client := &TwingateClient{
+		client:  graphql.NewClient(server.URL, server.Client()),
+		logger:  zap.NewNop(),
+		breaker: newCircuitBreaker("test", zap.NewNop()),
+	}
+	client.breaker.configure(&BreakerConfig{Threshold: 2})
+
+	for range 4 {
+		client.GetRemoteNetworks(context.Background())
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("made %d requests, want 2 before the breaker opened", n)
+	}
+	_, err := client.GetRemoteNetworks(context.Background())
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("error = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestConnectionTestBypassesOpenBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if failing.Load() {
+			return errors.New("unavailable")
+		}
+		return map[string]any{"remoteNetworks": map[string]any{"edges": []any{}}}
+	})
+	client.breaker = newCircuitBreaker("test", zap.NewNop())
+	client.breaker.configure(&BreakerConfig{Threshold: 1})
+
+	// A network failure opens the breaker
+	client.breaker.record(context.DeadlineExceeded)
+	if _, err := client.GetRemoteNetworks(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("error = %v, want ErrCircuitOpen", err)
+	}
+
+	failing.Store(false)
+	pooled := &pooledClient{client: client}
+	if err := pooled.testConnection(context.Background(), true); err != nil {
+		t.Fatalf("the connection test should reach the API through the open breaker: %v", err)
+	}
+	if state := client.breaker.status().State; state != BreakerClosed {
+		t.Errorf("a successful connection test should close the breaker, state = %s", state)
+	}
+}
+
+func TestRetryQueueKeepsAttemptsWhileBreakerOpen(t *testing.T) {
+	q := newRetryQueue(nil)
+	mapping := ResourceMapping{Name: "api.example.com"}
+
+	q.fail(mapping, "net1", ErrCircuitOpen)
+	entry, _ := q.fail(mapping, "net1", errors.New("boom"))
+	if entry.Attempts != 1 {
+		t.Errorf("Attempts = %d, want only the call that reached the API counted", entry.Attempts)
+	}
+}
@@ -2,9 +2,11 @@ package twingate
 
 import (
 	"encoding/json"
-	"net"
 	"strconv"
+	"strings"
 
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 )
@@ -12,69 +14,11 @@ import (
 func parseTwingateApp(d *caddyfile.Dispenser, _ any) (any, error) {
 	app := &TwingateApp{}
 
-	for d.Next() {
-		for d.NextBlock(0) {
-			switch d.Val() {
-			case "tenant":
-				if !d.NextArg() {
-					return nil, d.ArgErr()
-				}
-				app.Tenant = d.Val()
-
-			case "remote_network":
-				if !d.NextArg() {
-					return nil, d.ArgErr()
-				}
-				app.RemoteNetwork = d.Val()
-
-			case "caddy_address":
-				if !d.NextArg() {
-					return nil, d.ArgErr()
-				}
-				addr := d.Val()
-
-				if net.ParseIP(addr) == nil {
-					return nil, d.Errf("caddy_address must be a valid IP address, got: %s", addr)
-				}
-				app.CaddyAddress = addr
-
-			case "resource_cleanup":
-				cleanup := &CleanupConfig{}
-				for d.NextBlock(1) {
-					switch d.Val() {
-					case "enabled":
-						if !d.NextArg() {
-							return nil, d.ArgErr()
-						}
-						enabled, err := strconv.ParseBool(d.Val())
-						if err != nil {
-							return nil, d.Errf("enabled must be true or false, got: %s", d.Val())
-						}
-						cleanup.Enabled = enabled
-
-					case "dry_run":
-						if !d.NextArg() {
-							return nil, d.ArgErr()
-						}
-						dryRun, err := strconv.ParseBool(d.Val())
-						if err != nil {
-							return nil, d.Errf("dry_run must be true or false, got: %s", d.Val())
-						}
-						cleanup.DryRun = dryRun
-
-					default:
-						return nil, d.Errf("unrecognized resource_cleanup directive: %s", d.Val())
-					}
-				}
-				app.ResourceCleanup = cleanup
-
-			default:
-				return nil, d.Errf("unrecognized directive: %s", d.Val())
-			}
-		}
+	if err := app.UnmarshalCaddyfile(d); err != nil {
+		return nil, err
 	}
 
-	if app.Tenant == "" {
+	if app.Tenant == "" && len(app.Tenants) == 0 {
 		return nil, d.Err("tenant is required")
 	}
 
@@ -94,67 +38,1126 @@ func parseTwingateApp(d *caddyfile.Dispenser, _ any) (any, error) {
 func (t *TwingateApp) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 	for d.Next() {
 		for d.NextBlock(0) {
+			if err := t.unmarshalOption(d); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// unmarshalOption parses the option at the dispenser's current token.
+func (t *TwingateApp) unmarshalOption(d *caddyfile.Dispenser) error {
+	nesting := d.Nesting()
+	switch d.Val() {
+	case "tenant":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		t.Tenant = d.Val()
+
+	case "api_endpoint":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		if err := validateAPIEndpoint(d.Val()); err != nil {
+			return d.Errf("api_endpoint: %v", err)
+		}
+		t.APIEndpoint = d.Val()
+
+	case "tenant_lookup_url":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		if err := validateLookupURL(d.Val()); err != nil {
+			return d.Errf("tenant_lookup_url: %v", err)
+		}
+		t.TenantLookupURL = d.Val()
+
+	case "api_key_env":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		t.APIKeyEnv = d.Val()
+
+	case "hosts":
+		patterns := d.RemainingArgs()
+		if len(patterns) == 0 {
+			return d.ArgErr()
+		}
+		t.Hosts = append(t.Hosts, patterns...)
+
+	case "tenants":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for d.NextBlock(nesting) {
+			label := d.Val()
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			if _, ok := t.Tenants[label]; ok {
+				return d.Errf("duplicate tenant block: %s", label)
+			}
+
+			tenant := &TwingateApp{}
+			for tenantNesting := d.Nesting(); d.NextBlock(tenantNesting); {
+				if d.Val() == "tenants" {
+					return d.Err("tenants blocks cannot be nested")
+				}
+				if err := tenant.unmarshalOption(d); err != nil {
+					return err
+				}
+			}
+			if tenant.Tenant == "" {
+				return d.Errf("tenant block %s: tenant is required", label)
+			}
+
+			if t.Tenants == nil {
+				t.Tenants = make(map[string]*TwingateApp)
+			}
+			t.Tenants[label] = tenant
+		}
+
+	case "address_resolver":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		name := d.Val()
+		unm, err := caddyfile.UnmarshalModule(d, "twingate.address_resolvers."+name)
+		if err != nil {
+			return err
+		}
+		t.AddressResolverRaw = caddyconfig.JSONModuleObject(unm, "resolver", name, nil)
+
+	case "discoverer":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		name := d.Val()
+		unm, err := caddyfile.UnmarshalModule(d, "twingate.discoverers."+name)
+		if err != nil {
+			return err
+		}
+		t.DiscoverersRaw = append(t.DiscoverersRaw, caddyconfig.JSONModuleObject(unm, "discoverer", name, nil))
+
+	case "hook":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		name := d.Val()
+		unm, err := caddyfile.UnmarshalModule(d, "twingate.hooks."+name)
+		if err != nil {
+			return err
+		}
+		t.HooksRaw = append(t.HooksRaw, caddyconfig.JSONModuleObject(unm, "hook", name, nil))
+
+	case "remote_network":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		t.RemoteNetwork = d.Val()
+
+	case "remote_network_id":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		t.RemoteNetworkID = d.Val()
+
+	case "caddy_address":
+		addrs := d.RemainingArgs()
+		if len(addrs) == 0 {
+			return d.ArgErr()
+		}
+		for _, addr := range addrs {
+			if err := validateCaddyAddress(addr); err != nil {
+				return d.Errf("caddy_address: %v", err)
+			}
+		}
+		if len(addrs) == 1 {
+			t.CaddyAddress = addrs[0]
+		} else {
+			t.CaddyAddresses = addrs
+		}
+
+	case "nodes":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		fleet, err := parseNodes(d)
+		if err != nil {
+			return err
+		}
+		t.Fleet = fleet
+
+	case "resource_cleanup":
+		cleanup := t.ResourceCleanup
+		if cleanup == nil {
+			cleanup = &CleanupConfig{}
+		}
+		for d.NextBlock(nesting) {
 			switch d.Val() {
-			case "tenant":
+			case "enabled":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				enabled, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return d.Errf("enabled must be true or false, got: %s", d.Val())
+				}
+				cleanup.Enabled = enabled
+
+			case "dry_run":
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				t.Tenant = d.Val()
+				dryRun, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return d.Errf("dry_run must be true or false, got: %s", d.Val())
+				}
+				cleanup.DryRun = dryRun
 
-			case "remote_network":
+			case "revoke_access":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				revoke, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return d.Errf("revoke_access must be true or false, got: %s", d.Val())
+				}
+				cleanup.RevokeAccess = revoke
+
+			case "batch_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				size, err := strconv.Atoi(d.Val())
+				if err != nil || size < 1 {
+					return d.Errf("batch_size must be a positive integer, got: %s", d.Val())
+				}
+				cleanup.BatchSize = size
+
+			case "batch_pause":
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				t.RemoteNetwork = d.Val()
+				pause, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid batch_pause: %v", err)
+				}
+				cleanup.BatchPause = caddy.Duration(pause)
+
+			default:
+				return d.Errf("unrecognized resource_cleanup directive: %s", d.Val())
+			}
+		}
+		t.ResourceCleanup = cleanup
+
+	case "cleanup_scope":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		if err := validateCleanupScope(d.Val()); err != nil {
+			return d.Errf("cleanup_scope: %v", err)
+		}
+		if t.ResourceCleanup == nil {
+			t.ResourceCleanup = &CleanupConfig{}
+		}
+		t.ResourceCleanup.Scope = d.Val()
+		if d.NextArg() {
+			return d.ArgErr()
+		}
 
-			case "caddy_address":
+	case "retry":
+		retry := &RetryConfig{}
+		if d.NextArg() {
+			if d.Val() != "off" {
+				return d.Errf("retry takes a block or 'off', got: %s", d.Val())
+			}
+			retry.Disabled = true
+		}
+		for d.NextBlock(nesting) {
+			switch d.Val() {
+			case "initial_delay", "max_delay":
+				opt := d.Val()
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				addr := d.Val()
+				delay, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid %s: %v", opt, err)
+				}
+				if opt == "initial_delay" {
+					retry.InitialDelay = caddy.Duration(delay)
+				} else {
+					retry.MaxDelay = caddy.Duration(delay)
+				}
 
-				if net.ParseIP(addr) == nil {
-					return d.Errf("caddy_address must be a valid IP address, got: %s", addr)
+			case "max_attempts":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				attempts, err := strconv.Atoi(d.Val())
+				if err != nil || attempts < 1 {
+					return d.Errf("max_attempts must be a positive integer, got: %s", d.Val())
 				}
-				t.CaddyAddress = addr
+				retry.MaxAttempts = attempts
 
-			case "resource_cleanup":
-				cleanup := &CleanupConfig{}
-				for d.NextBlock(1) {
-					switch d.Val() {
-					case "enabled":
-						if !d.NextArg() {
-							return d.ArgErr()
-						}
-						enabled, err := strconv.ParseBool(d.Val())
-						if err != nil {
-							return d.Errf("enabled must be true or false, got: %s", d.Val())
-						}
-						cleanup.Enabled = enabled
+			default:
+				return d.Errf("unrecognized retry directive: %s", d.Val())
+			}
+		}
+		t.Retry = retry
 
-					case "dry_run":
-						if !d.NextArg() {
-							return d.ArgErr()
-						}
-						dryRun, err := strconv.ParseBool(d.Val())
-						if err != nil {
-							return d.Errf("dry_run must be true or false, got: %s", d.Val())
-						}
-						cleanup.DryRun = dryRun
+	case "profile":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		name := d.Val()
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		if _, ok := t.Profiles[name]; ok {
+			return d.Errf("profile %s is defined more than once", name)
+		}
+		profile, err := parseProfile(d)
+		if err != nil {
+			return err
+		}
+		if t.Profiles == nil {
+			t.Profiles = make(map[string]Profile)
+		}
+		t.Profiles[name] = profile
+
+	case "default_access":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		access, err := parseDefaultAccess(d)
+		if err != nil {
+			return err
+		}
+		t.DefaultAccess = access
+
+	case "warmup":
+		warmup := &WarmupConfig{}
+		if d.NextArg() {
+			rate, err := strconv.Atoi(d.Val())
+			if err != nil || rate < 1 {
+				return d.Errf("warmup rate must be a positive integer, got: %s", d.Val())
+			}
+			warmup.Rate = rate
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.Warmup = warmup
 
-					default:
-						return d.Errf("unrecognized resource_cleanup directive: %s", d.Val())
-					}
+	case "address_check":
+		check := &AddressCheckConfig{}
+		if d.NextArg() {
+			timeout, err := caddy.ParseDuration(d.Val())
+			if err != nil || timeout <= 0 {
+				return d.Errf("address_check timeout must be a positive duration, got: %s", d.Val())
+			}
+			check.Timeout = caddy.Duration(timeout)
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.AddressCheck = check
+
+	case "restore_access":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		restore := &RestoreAccessConfig{}
+		if d.Val() == "off" {
+			restore.Disabled = true
+		} else {
+			window, err := caddy.ParseDuration(d.Val())
+			if err != nil || window <= 0 {
+				return d.Errf("restore_access takes a window or 'off', got: %s", d.Val())
+			}
+			restore.Window = caddy.Duration(window)
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.RestoreAccess = restore
+
+	case "proxy_url":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		if err := validateProxyURL(d.Val()); err != nil {
+			return d.Errf("proxy_url: %v", err)
+		}
+		t.ProxyURL = d.Val()
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+
+	case "tls_client_auth":
+		args := d.RemainingArgs()
+		switch len(args) {
+		case 1:
+			t.TLSClientAuth = &ClientTLSConfig{Automate: args[0]}
+		case 2:
+			t.TLSClientAuth = &ClientTLSConfig{CertFile: args[0], KeyFile: args[1]}
+		default:
+			return d.ArgErr()
+		}
+
+	case "churn_limit":
+		churn := &ChurnLimitConfig{}
+		switch {
+		case !d.NextArg():
+			// churn_limit alone turns detection on with the defaults
+		case d.Val() == "off":
+			churn.Disabled = true
+		default:
+			changes, err := strconv.Atoi(d.Val())
+			if err != nil || changes < 2 {
+				return d.Errf("churn_limit takes a number of changes of at least 2 or 'off', got: %s", d.Val())
+			}
+			churn.Changes = changes
+			if d.NextArg() {
+				window, err := caddy.ParseDuration(d.Val())
+				if err != nil || window <= 0 {
+					return d.Errf("churn_limit window must be a positive duration, got: %s", d.Val())
 				}
-				t.ResourceCleanup = cleanup
+				churn.Window = caddy.Duration(window)
+			}
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.ChurnLimit = churn
+
+	case "circuit_breaker":
+		breaker := &BreakerConfig{}
+		if d.NextArg() {
+			if d.Val() != "off" {
+				return d.Errf("circuit_breaker takes a block or 'off', got: %s", d.Val())
+			}
+			breaker.Disabled = true
+		}
+		for d.NextBlock(nesting) {
+			switch d.Val() {
+			case "min_interval", "max_interval":
+				opt := d.Val()
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				interval, err := caddy.ParseDuration(d.Val())
+				if err != nil || interval <= 0 {
+					return d.Errf("%s must be a positive duration, got: %s", opt, d.Val())
+				}
+				if opt == "min_interval" {
+					breaker.MinInterval = caddy.Duration(interval)
+				} else {
+					breaker.MaxInterval = caddy.Duration(interval)
+				}
+
+			case "threshold":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				threshold, err := strconv.Atoi(d.Val())
+				if err != nil || threshold < 1 {
+					return d.Errf("threshold must be a positive integer, got: %s", d.Val())
+				}
+				breaker.Threshold = threshold
 
 			default:
-				return d.Errf("unrecognized directive: %s", d.Val())
+				return d.Errf("unrecognized circuit_breaker directive: %s", d.Val())
 			}
 		}
-	}
+		t.CircuitBreaker = breaker
+
+	case "rate_limit_warning":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		if _, _, err := parseRateLimitWarning(d.Val()); err != nil {
+			return d.Errf("rate_limit_warning %v", err)
+		}
+		t.RateLimitWarning = d.Val()
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+
+	case "extra_resource":
+		args := d.RemainingArgs()
+		if len(args) != 2 {
+			return d.ArgErr()
+		}
+		extra := ExtraResource{Name: args[0], Address: args[1]}
+		if err := extra.validate(); err != nil {
+			return d.Errf("extra_resource: %v", err)
+		}
+		t.ExtraResources = append(t.ExtraResources, extra)
+
+	case "extra_resources":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for d.NextBlock(nesting) {
+			extra, err := parseExtraResource(d)
+			if err != nil {
+				return err
+			}
+			t.ExtraResources = append(t.ExtraResources, extra)
+		}
+
+	case "catch_all":
+		catchAll, err := parseCatchAll(d)
+		if err != nil {
+			return err
+		}
+		t.CatchAll = &catchAll
+
+	case "adopt":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.Adopt = true
+
+	case "access_check":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.AccessCheck = true
+
+	case "access_listing":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.AccessListing = true
+
+	case "security_posture":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.SecurityPosture = true
+
+	case "match_on":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		switch d.Val() {
+		case MatchOnAlias, MatchOnName, MatchOnNameOrAlias:
+			t.MatchOn = d.Val()
+		default:
+			return d.Errf("match_on must be %q, %q or %q, got: %s", MatchOnAlias, MatchOnName, MatchOnNameOrAlias, d.Val())
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+
+	case "report_path":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		t.ReportPath = d.Val()
+
+	case "report_keep":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		keep, err := strconv.Atoi(d.Val())
+		if err != nil || keep < 1 {
+			return d.Errf("report_keep must be a positive integer, got: %s", d.Val())
+		}
+		t.ReportKeep = keep
+
+	case "resync_on":
+		events := d.RemainingArgs()
+		if len(events) == 0 {
+			events = []string{DefaultResyncEvent}
+		}
+		t.ResyncOn = append(t.ResyncOn, events...)
+
+	case "sync_trigger":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		trigger := &SyncTriggerConfig{}
+		for d.NextBlock(nesting) {
+			switch d.Val() {
+			case "signal":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				if _, _, err := triggerSignal(d.Val()); err != nil {
+					return d.Errf("sync_trigger: %v", err)
+				}
+				trigger.Signal = d.Val()
+
+			case "file":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				trigger.File = d.Val()
+
+			case "poll_interval":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				interval, err := caddy.ParseDuration(d.Val())
+				if err != nil || interval <= 0 {
+					return d.Errf("invalid poll_interval: %s", d.Val())
+				}
+				trigger.PollInterval = caddy.Duration(interval)
+
+			default:
+				return d.Errf("unrecognized sync_trigger directive: %s", d.Val())
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+		}
+		if trigger.Signal == "" && trigger.File == "" {
+			return d.Err("sync_trigger needs a signal or a file")
+		}
+		t.SyncTrigger = trigger
+
+	case "routes_from":
+		src := &RoutesSource{}
+		if d.NextArg() {
+			if strings.HasPrefix(d.Val(), "http://") || strings.HasPrefix(d.Val(), "https://") {
+				src.Admin = d.Val()
+			} else {
+				src.File = d.Val()
+			}
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for d.NextBlock(nesting) {
+			switch d.Val() {
+			case "file":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				src.File = d.Val()
+
+			case "admin":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				src.Admin = d.Val()
+
+			case "poll_interval":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				interval, err := caddy.ParseDuration(d.Val())
+				if err != nil || interval <= 0 {
+					return d.Errf("invalid poll_interval: %s", d.Val())
+				}
+				src.PollInterval = caddy.Duration(interval)
+
+			default:
+				return d.Errf("unrecognized routes_from directive: %s", d.Val())
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+		}
+		if err := src.validate(); err != nil {
+			return d.Err(err.Error())
+		}
+		t.RoutesFrom = src
+
+	case "managed_fields":
+		fields := d.RemainingArgs()
+		if len(fields) == 0 {
+			return d.ArgErr()
+		}
+		if err := validateManagedFields(fields); err != nil {
+			return d.Errf("managed_fields: %v", err)
+		}
+		t.ManagedFields = append(t.ManagedFields, fields...)
+
+	case "alias_suffix":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		if !isDNSName(d.Val()) {
+			return d.Errf("alias_suffix '%s' is not a valid DNS name", d.Val())
+		}
+		t.AliasSuffix = d.Val()
+
+	case "alias_rewrite":
+		args := d.RemainingArgs()
+		if len(args) != 2 {
+			return d.ArgErr()
+		}
+		rw := AliasRewrite{From: args[0], To: args[1]}
+		if err := rw.validate(); err != nil {
+			return d.Errf("alias_rewrite: %v", err)
+		}
+		t.AliasRewrites = append(t.AliasRewrites, rw)
+
+	case "api_call_budget":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		budget, err := strconv.Atoi(d.Val())
+		if err != nil || budget < 0 {
+			return d.Errf("api_call_budget must be a non-negative integer, got: %s", d.Val())
+		}
+		t.APICallBudget = budget
+
+	case "log_level":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		if err := validateLogLevel(d.Val()); err != nil {
+			return d.Err(err.Error())
+		}
+		t.LogLevel = d.Val()
+
+	case "redact_addresses":
+		t.RedactAddresses = true
+		if d.NextArg() {
+			redact, err := strconv.ParseBool(d.Val())
+			if err != nil {
+				return d.Errf("redact_addresses must be true or false, got: %s", d.Val())
+			}
+			t.RedactAddresses = redact
+		}
+
+	case "unhealthy_after":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		n, err := strconv.Atoi(d.Val())
+		if err != nil || n < 1 {
+			return d.Errf("unhealthy_after must be a positive integer, got: %s", d.Val())
+		}
+		t.UnhealthyAfter = n
+
+	case "error_policy":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		if _, err := parseErrorPolicy(d.Val()); err != nil {
+			return d.Err(err.Error())
+		}
+		t.ErrorPolicy = d.Val()
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+
+	case "drift_policy":
+		args := d.RemainingArgs()
+		if t.DriftPolicy == nil {
+			t.DriftPolicy = &DriftPolicy{}
+		}
+		switch len(args) {
+		case 1:
+			t.DriftPolicy.Default = args[0]
+		case 2:
+			if t.DriftPolicy.Fields == nil {
+				t.DriftPolicy.Fields = make(map[string]string)
+			}
+			t.DriftPolicy.Fields[args[0]] = args[1]
+		default:
+			return d.ArgErr()
+		}
+		if err := t.DriftPolicy.validate(); err != nil {
+			return d.Errf("drift_policy: %v", err)
+		}
+
+	case "host_feed":
+		feed := &HostFeedConfig{}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for d.NextBlock(nesting) {
+			switch d.Val() {
+			case "ttl":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				ttl, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid ttl: %v", err)
+				}
+				feed.TTL = caddy.Duration(ttl)
+
+			case "allow":
+				patterns := d.RemainingArgs()
+				if len(patterns) == 0 {
+					return d.ArgErr()
+				}
+				feed.Allow = append(feed.Allow, patterns...)
+
+			default:
+				return d.Errf("unrecognized host_feed directive: %s", d.Val())
+			}
+		}
+		t.HostFeed = feed
+
+	case "address_mode":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		switch d.Val() {
+		case AddressModeIP, AddressModeDNSHost:
+			t.AddressMode = d.Val()
+		default:
+			return d.Errf("address_mode must be %q or %q, got: %s", AddressModeIP, AddressModeDNSHost, d.Val())
+		}
+
+	case "skip_connection_test":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.SkipConnectionTest = true
+
+	case "read_only":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.ReadOnly = true
+
+	case "approval_required":
+		t.ApprovalRequired = true
+		if d.NextArg() {
+			required, err := strconv.ParseBool(d.Val())
+			if err != nil {
+				return d.Errf("approval_required must be true or false, got: %s", d.Val())
+			}
+			t.ApprovalRequired = required
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+
+	case "error_routes":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		t.ErrorRoutes = true
+
+	case "wildcard_hosts":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		switch d.Val() {
+		case WildcardAlias, WildcardAddress:
+			t.WildcardHosts = d.Val()
+		default:
+			return d.Errf("wildcard_hosts must be %q or %q, got: %s", WildcardAlias, WildcardAddress, d.Val())
+		}
 
+	case "initial_sync":
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		switch d.Val() {
+		case InitialSyncProvision, InitialSyncStart:
+			t.InitialSync = d.Val()
+		default:
+			return d.Errf("initial_sync must be %q or %q, got: %s", InitialSyncProvision, InitialSyncStart, d.Val())
+		}
+
+	case "systemd":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		cfg := &SystemdConfig{}
+		for d.NextBlock(nesting) {
+			switch d.Val() {
+			case "ready":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				cfg.Ready = d.Val()
+
+			case "ready_timeout", "stall_timeout":
+				opt := d.Val()
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				timeout, err := caddy.ParseDuration(d.Val())
+				if err != nil || timeout <= 0 {
+					return d.Errf("invalid %s: %s", opt, d.Val())
+				}
+				if opt == "ready_timeout" {
+					cfg.ReadyTimeout = caddy.Duration(timeout)
+				} else {
+					cfg.StallTimeout = caddy.Duration(timeout)
+				}
+
+			case "watchdog":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				switch d.Val() {
+				case "on":
+				case "off":
+					cfg.DisableWatchdog = true
+				default:
+					return d.Errf("watchdog must be on or off, got: %s", d.Val())
+				}
+
+			default:
+				return d.Errf("unrecognized systemd directive: %s", d.Val())
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+		}
+		if err := cfg.validate(); err != nil {
+			return d.Err(err.Error())
+		}
+		t.Systemd = cfg
+
+	default:
+		return d.Errf("unrecognized directive: %s", d.Val())
+	}
 	return nil
 }
 
+// parseExtraResource parses one entry of an extra_resources block, either
+// on a single line or with a block of its own:
+//
+//	<name> <address>
+//	<name> {
+//	    address        <address>
+//	    alias          <alias>
+//	    groups         <names...>
+//	    remote_network <name>
+//	    profile        <name>
+//	}
+func parseExtraResource(d *caddyfile.Dispenser) (ExtraResource, error) {
+	extra := ExtraResource{Name: d.Val()}
+	if d.NextArg() {
+		extra.Address = d.Val()
+	}
+	if d.NextArg() {
+		return extra, d.ArgErr()
+	}
+
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		switch d.Val() {
+		case "address", "alias", "remote_network", "profile":
+			opt := d.Val()
+			if !d.NextArg() {
+				return extra, d.ArgErr()
+			}
+			switch opt {
+			case "address":
+				extra.Address = d.Val()
+			case "alias":
+				extra.Alias = d.Val()
+			case "remote_network":
+				extra.RemoteNetwork = d.Val()
+			case "profile":
+				extra.Profile = d.Val()
+			}
+
+		case "groups":
+			groups := d.RemainingArgs()
+			if len(groups) == 0 {
+				return extra, d.ArgErr()
+			}
+			extra.Groups = append(extra.Groups, groups...)
+
+		default:
+			return extra, d.Errf("unrecognized extra_resources directive: %s", d.Val())
+		}
+	}
+
+	if err := extra.validate(); err != nil {
+		return extra, d.Errf("extra_resources: %v", err)
+	}
+	return extra, nil
+}
+
+// parseCatchAll parses the catch_all option:
+//
+//	catch_all <name> [<alias>] {
+//	    groups         <names...>
+//	    remote_network <name>
+//	    profile        <name>
+//	}
+func parseCatchAll(d *caddyfile.Dispenser) (CatchAll, error) {
+	var catchAll CatchAll
+	if !d.NextArg() {
+		return catchAll, d.ArgErr()
+	}
+	catchAll.Name = d.Val()
+	if d.NextArg() {
+		catchAll.Alias = d.Val()
+	}
+	if d.NextArg() {
+		return catchAll, d.ArgErr()
+	}
+
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		switch d.Val() {
+		case "remote_network", "profile":
+			opt := d.Val()
+			if !d.NextArg() {
+				return catchAll, d.ArgErr()
+			}
+			if opt == "remote_network" {
+				catchAll.RemoteNetwork = d.Val()
+			} else {
+				catchAll.Profile = d.Val()
+			}
+
+		case "groups":
+			groups := d.RemainingArgs()
+			if len(groups) == 0 {
+				return catchAll, d.ArgErr()
+			}
+			catchAll.Groups = append(catchAll.Groups, groups...)
+
+		default:
+			return catchAll, d.Errf("unrecognized catch_all directive: %s", d.Val())
+		}
+	}
+
+	if err := catchAll.validate(); err != nil {
+		return catchAll, d.Errf("catch_all: %v", err)
+	}
+	return catchAll, nil
+}
+
+// parseNodes parses the block of the nodes option:
+//
+//	nodes {
+//	    <label> <address>
+//	    <label> <address> {
+//	        hosts <patterns...>
+//	    }
+//	    name_template <template>
+//	}
+func parseNodes(d *caddyfile.Dispenser) (*FleetConfig, error) {
+	fleet := &FleetConfig{Nodes: make(map[string]FleetNode)}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		if d.Val() == "name_template" {
+			if !d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			fleet.NameTemplate = d.Val()
+			if d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			continue
+		}
+
+		label := d.Val()
+		if _, ok := fleet.Nodes[label]; ok {
+			return nil, d.Errf("node %s is defined more than once", label)
+		}
+		if !d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		node := FleetNode{Address: d.Val()}
+		if d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		for nodeNesting := d.Nesting(); d.NextBlock(nodeNesting); {
+			switch d.Val() {
+			case "hosts":
+				patterns := d.RemainingArgs()
+				if len(patterns) == 0 {
+					return nil, d.ArgErr()
+				}
+				node.Hosts = append(node.Hosts, patterns...)
+
+			default:
+				return nil, d.Errf("unrecognized node directive: %s", d.Val())
+			}
+		}
+		fleet.Nodes[label] = node
+	}
+	if err := fleet.validate(); err != nil {
+		return nil, d.Err(err.Error())
+	}
+	return fleet, nil
+}
+
+// parseProfile parses the block of a profile option:
+//
+//	profile <name> {
+//	    groups         <names...>
+//	    remote_network <name>
+//	    policy         <name>
+//	}
+func parseProfile(d *caddyfile.Dispenser) (Profile, error) {
+	var profile Profile
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		switch d.Val() {
+		case "groups":
+			groups := d.RemainingArgs()
+			if len(groups) == 0 {
+				return profile, d.ArgErr()
+			}
+			profile.Groups = append(profile.Groups, groups...)
+
+		case "remote_network":
+			if !d.NextArg() {
+				return profile, d.ArgErr()
+			}
+			profile.RemoteNetwork = d.Val()
+
+		case "policy":
+			if !d.NextArg() {
+				return profile, d.ArgErr()
+			}
+			profile.Policy = d.Val()
+
+		default:
+			return profile, d.Errf("unrecognized profile directive: %s", d.Val())
+		}
+	}
+	return profile, nil
+}
+
+// parseDefaultAccess parses the block of the default_access option:
+//
+//	default_access {
+//	    group           <names...>
+//	    security_policy <name>
+//	}
+func parseDefaultAccess(d *caddyfile.Dispenser) (*DefaultAccess, error) {
+	access := &DefaultAccess{}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		switch d.Val() {
+		case "group", "groups":
+			groups := d.RemainingArgs()
+			if len(groups) == 0 {
+				return nil, d.ArgErr()
+			}
+			access.Groups = append(access.Groups, groups...)
+
+		case "security_policy":
+			if !d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			access.SecurityPolicy = d.Val()
+			if d.NextArg() {
+				return nil, d.ArgErr()
+			}
+
+		default:
+			return nil, d.Errf("unrecognized default_access directive: %s", d.Val())
+		}
+	}
+	if len(access.Groups) == 0 && access.SecurityPolicy == "" {
+		return nil, d.Err("default_access needs a group or a security_policy")
+	}
+	return access, nil
+}
+
 var _ caddyfile.Unmarshaler = (*TwingateApp)(nil)
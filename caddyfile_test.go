@@ -0,0 +1,679 @@
+package twingate
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func TestUnmarshalCaddyfile_InitialSync(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "default",
+			input: `twingate {
+				tenant acme
+			}`,
+			expected: "",
+		},
+		{
+			name: "start",
+			input: `twingate {
+				tenant acme
+				initial_sync start
+			}`,
+			expected: InitialSyncStart,
+		},
+		{
+			name: "provision",
+			input: `twingate {
+				tenant acme
+				initial_sync provision
+			}`,
+			expected: InitialSyncProvision,
+		},
+		{
+			name: "invalid value",
+			input: `twingate {
+				tenant acme
+				initial_sync later
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "missing value",
+			input: `twingate {
+				tenant acme
+				initial_sync
+			}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &TwingateApp{}
+			err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(tt.input))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if app.InitialSync != tt.expected {
+				t.Errorf("InitialSync = %q, want %q", app.InitialSync, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseTwingateApp_RequiresTenant(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`twingate {
+		remote_network Test
+	}`)
+
+	if _, err := parseTwingateApp(d, nil); err == nil {
+		t.Error("parseTwingateApp() should fail when tenant is missing")
+	}
+}
+
+func TestUnmarshalCaddyfile_CaddyAddress(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		caddy_address 10.0.0.11 10.0.0.12
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.CaddyAddress != "" {
+		t.Errorf("CaddyAddress = %q, want empty when several addresses are given", app.CaddyAddress)
+	}
+	if len(app.CaddyAddresses) != 2 {
+		t.Fatalf("CaddyAddresses = %v, want 2 entries", app.CaddyAddresses)
+	}
+
+	app = &TwingateApp{}
+	err = app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		caddy_address caddy.internal.example.com
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.CaddyAddress != "caddy.internal.example.com" {
+		t.Errorf("CaddyAddress = %q, want DNS name", app.CaddyAddress)
+	}
+
+	app = &TwingateApp{}
+	err = app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		caddy_address 10.0.0.1 bad_host!
+	}`))
+	if err == nil {
+		t.Error("expected error for invalid address")
+	}
+}
+
+func TestSiteConfigUnmarshalCaddyfile(t *testing.T) {
+	s := &SiteConfig{}
+	err := s.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		remote_network IoT
+		id cameras
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.RemoteNetwork != "IoT" {
+		t.Errorf("RemoteNetwork = %q, want %q", s.RemoteNetwork, "IoT")
+	}
+	if s.ID != "cameras" {
+		t.Errorf("ID = %q, want %q", s.ID, "cameras")
+	}
+
+	s = &SiteConfig{}
+	err = s.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		label team platform
+		label env prod
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Labels["team"] != "platform" || s.Labels["env"] != "prod" {
+		t.Errorf("Labels = %v, want team=platform env=prod", s.Labels)
+	}
+
+	s = &SiteConfig{}
+	err = s.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		label team
+	}`))
+	if err == nil {
+		t.Error("expected error for label without a value")
+	}
+
+	s = &SiteConfig{}
+	err = s.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+	}`))
+	if err == nil {
+		t.Error("expected error for app-level option inside a site block")
+	}
+}
+
+func TestUnmarshalCaddyfile_Retry(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		retry {
+			initial_delay 15s
+			max_delay 10m
+			max_attempts 5
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.Retry == nil || app.Retry.MaxAttempts != 5 || app.Retry.Disabled {
+		t.Fatalf("unexpected retry config: %+v", app.Retry)
+	}
+	if time.Duration(app.Retry.InitialDelay) != 15*time.Second || time.Duration(app.Retry.MaxDelay) != 10*time.Minute {
+		t.Errorf("unexpected delays: %+v", app.Retry)
+	}
+
+	app = &TwingateApp{}
+	err = app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		retry off
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.Retry == nil || !app.Retry.Disabled {
+		t.Errorf("expected retry to be disabled, got %+v", app.Retry)
+	}
+}
+
+func TestUnmarshalCaddyfile_AddressMode(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		address_mode dns_host
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.AddressMode != AddressModeDNSHost {
+		t.Errorf("AddressMode = %q, want %q", app.AddressMode, AddressModeDNSHost)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		address_mode cname
+	}`))
+	if err == nil {
+		t.Error("expected error for unknown address_mode")
+	}
+}
+
+func TestUnmarshalCaddyfile_Report(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		report_path /var/log/caddy/twingate.json
+		report_keep 30
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.ReportPath != "/var/log/caddy/twingate.json" || app.ReportKeep != 30 {
+		t.Errorf("unexpected report config: path=%q keep=%d", app.ReportPath, app.ReportKeep)
+	}
+}
+
+func TestUnmarshalCaddyfile_APICallBudget(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		api_call_budget 200
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.APICallBudget != 200 {
+		t.Errorf("APICallBudget = %d, want 200", app.APICallBudget)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		api_call_budget lots
+	}`))
+	if err == nil {
+		t.Error("expected error for non-numeric budget")
+	}
+}
+
+func TestUnmarshalCaddyfile_ManagedFields(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		managed_fields name address
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(app.ManagedFields) != 2 || app.ManagedFields[0] != FieldName || app.ManagedFields[1] != FieldAddress {
+		t.Errorf("ManagedFields = %v, want [name address]", app.ManagedFields)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		managed_fields address security_policy
+	}`))
+	if err == nil {
+		t.Error("expected error for unknown managed field")
+	}
+}
+
+func TestUnmarshalCaddyfile_Tenants(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		caddy_address 10.0.0.1
+		tenants {
+			a {
+				tenant customer-a
+				api_key_env TWINGATE_API_KEY_A
+				hosts *.customer-a.com
+				retry {
+					max_attempts 3
+				}
+			}
+			b {
+				tenant customer-b
+				api_key_env TWINGATE_API_KEY_B
+				hosts *.customer-b.com app.b.example
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if app.Tenant != "" || len(app.Tenants) != 2 {
+		t.Fatalf("expected a container app with 2 tenants, got %+v", app)
+	}
+	a := app.Tenants["a"]
+	if a.Tenant != "customer-a" || a.APIKeyEnv != "TWINGATE_API_KEY_A" || a.Retry == nil || a.Retry.MaxAttempts != 3 {
+		t.Errorf("unexpected tenant block a: %+v", a)
+	}
+	if b := app.Tenants["b"]; len(b.Hosts) != 2 {
+		t.Errorf("tenant block b hosts = %v, want 2 patterns", b.Hosts)
+	}
+}
+
+func TestUnmarshalCaddyfile_TenantsErrors(t *testing.T) {
+	for name, input := range map[string]string{
+		"missing tenant": `twingate {
+			tenants {
+				a {
+					hosts *.a.com
+				}
+			}
+		}`,
+		"duplicate label": `twingate {
+			tenants {
+				a {
+					tenant one
+				}
+				a {
+					tenant two
+				}
+			}
+		}`,
+		"nested": `twingate {
+			tenants {
+				a {
+					tenant one
+					tenants {
+						b {
+							tenant two
+						}
+					}
+				}
+			}
+		}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			app := &TwingateApp{}
+			if err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestUnmarshalCaddyfile_CleanupBatches(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		resource_cleanup {
+			enabled true
+			batch_size 20
+			batch_pause 30s
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.ResourceCleanup.BatchSize != 20 {
+		t.Errorf("BatchSize = %d, want 20", app.ResourceCleanup.BatchSize)
+	}
+	if time.Duration(app.ResourceCleanup.BatchPause) != 30*time.Second {
+		t.Errorf("BatchPause = %v, want 30s", time.Duration(app.ResourceCleanup.BatchPause))
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		resource_cleanup {
+			batch_size 0
+		}
+	}`))
+	if err == nil {
+		t.Error("expected error for zero batch_size")
+	}
+}
+
+func TestUnmarshalCaddyfile_CleanupScope(t *testing.T) {
+	for _, input := range []string{
+		`twingate {
+			tenant acme
+			cleanup_scope prefix:caddy-
+			resource_cleanup {
+				enabled true
+			}
+		}`,
+		`twingate {
+			tenant acme
+			resource_cleanup {
+				enabled true
+			}
+			cleanup_scope prefix:caddy-
+		}`,
+	} {
+		app := &TwingateApp{}
+		if err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !app.ResourceCleanup.Enabled || app.ResourceCleanup.Scope != "prefix:caddy-" {
+			t.Errorf("ResourceCleanup = %+v, want enabled with scope prefix:caddy-", app.ResourceCleanup)
+		}
+	}
+
+	for _, scope := range []string{"caddy-", "prefix:"} {
+		err := (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+			tenant acme
+			cleanup_scope ` + scope + `
+		}`))
+		if err == nil {
+			t.Errorf("expected error for cleanup_scope %q", scope)
+		}
+	}
+}
+
+func TestUnmarshalCaddyfile_UnhealthyAfter(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		unhealthy_after 5
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.UnhealthyAfter != 5 {
+		t.Errorf("UnhealthyAfter = %d, want 5", app.UnhealthyAfter)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		unhealthy_after 0
+	}`))
+	if err == nil {
+		t.Error("expected error for zero unhealthy_after")
+	}
+}
+
+func TestUnmarshalCaddyfile_Warmup(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		warmup 20
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.Warmup == nil || app.Warmup.rate() != 20 {
+		t.Errorf("Warmup = %+v, want rate 20", app.Warmup)
+	}
+
+	app = &TwingateApp{}
+	err = app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		warmup
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.Warmup == nil || app.Warmup.rate() != defaultWarmupRate {
+		t.Errorf("Warmup = %+v, want default rate", app.Warmup)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		warmup 0
+	}`))
+	if err == nil {
+		t.Error("expected error for zero warmup rate")
+	}
+}
+
+func TestUnmarshalCaddyfile_SkipConnectionTest(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		skip_connection_test
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !app.SkipConnectionTest {
+		t.Error("SkipConnectionTest should be set")
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		skip_connection_test yes
+	}`))
+	if err == nil {
+		t.Error("expected error for an argument to skip_connection_test")
+	}
+}
+
+func TestUnmarshalCaddyfile_CircuitBreaker(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		circuit_breaker {
+			threshold 3
+			min_interval 10s
+			max_interval 5m
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := BreakerConfig{Threshold: 3, MinInterval: caddy.Duration(10 * time.Second), MaxInterval: caddy.Duration(5 * time.Minute)}
+	if app.CircuitBreaker == nil || *app.CircuitBreaker != want {
+		t.Errorf("CircuitBreaker = %+v, want %+v", app.CircuitBreaker, want)
+	}
+
+	app = &TwingateApp{}
+	err = app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		circuit_breaker off
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.CircuitBreaker == nil || !app.CircuitBreaker.Disabled {
+		t.Errorf("CircuitBreaker = %+v, want disabled", app.CircuitBreaker)
+	}
+}
+
+func TestUnmarshalCaddyfile_Logging(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		log_level warn
+		redact_addresses
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.LogLevel != "warn" || !app.RedactAddresses {
+		t.Errorf("LogLevel = %q, RedactAddresses = %v, want warn and true", app.LogLevel, app.RedactAddresses)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		log_level verbose
+	}`))
+	if err == nil {
+		t.Error("expected error for unknown log_level")
+	}
+}
+
+func TestUnmarshalCaddyfile_TenantAuto(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant auto
+		tenant_lookup_url https://accounts.example.com/whoami
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.Tenant != TenantAuto || app.TenantLookupURL != "https://accounts.example.com/whoami" {
+		t.Errorf("Tenant = %q, TenantLookupURL = %q", app.Tenant, app.TenantLookupURL)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant auto
+		tenant_lookup_url accounts.example.com
+	}`))
+	if err == nil {
+		t.Error("expected error for tenant_lookup_url without a scheme")
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant auto
+		tenant_lookup_url http://accounts.example.com/whoami
+	}`))
+	if err == nil {
+		t.Errorf("expected error for a plain http tenant_lookup_url, got %v", err)
+	}
+}
+
+func TestUnmarshalCaddyfile_AliasRewrite(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		alias_suffix internal.corp
+		alias_rewrite example.com corp.internal
+		alias_rewrite example.org org.corp.internal
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.AliasSuffix != "internal.corp" {
+		t.Errorf("AliasSuffix = %q, want internal.corp", app.AliasSuffix)
+	}
+	want := []AliasRewrite{{From: "example.com", To: "corp.internal"}, {From: "example.org", To: "org.corp.internal"}}
+	if !slices.Equal(app.AliasRewrites, want) {
+		t.Errorf("AliasRewrites = %+v, want %+v", app.AliasRewrites, want)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		alias_rewrite example.com
+	}`))
+	if err == nil {
+		t.Error("expected error for alias_rewrite without a target")
+	}
+}
+
+func TestUnmarshalCaddyfile_AddressResolver(t *testing.T) {
+	for input, want := range map[string]string{
+		`address_resolver static 10.0.0.1 10.0.0.2`: `{"addresses":["10.0.0.1","10.0.0.2"],"resolver":"static"}`,
+		`address_resolver outbound 10.1.0.1:53`:     `{"resolver":"outbound","target":"10.1.0.1:53"}`,
+		`address_resolver interface eth0`:           `{"name":"eth0","resolver":"interface"}`,
+		`address_resolver dns caddy.internal`:       `{"name":"caddy.internal","resolver":"dns"}`,
+		`address_resolver public_http https://ip.example.com {
+			timeout 5s
+		}`: `{"resolver":"public_http","timeout":5000000000,"url":"https://ip.example.com"}`,
+	} {
+		app := &TwingateApp{}
+		err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\ntenant acme\n" + input + "\nremote_network Caddy\n}"))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", input, err)
+			continue
+		}
+		if string(app.AddressResolverRaw) != want {
+			t.Errorf("%s: AddressResolverRaw = %s, want %s", input, app.AddressResolverRaw, want)
+		}
+		if app.RemoteNetwork != "Caddy" {
+			t.Errorf("%s: options after the resolver were not parsed", input)
+		}
+	}
+
+	for _, input := range []string{
+		`address_resolver`,
+		`address_resolver unknown`,
+		`address_resolver interface`,
+	} {
+		err := (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n" + input + "\n}"))
+		if err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+func TestUnmarshalCaddyfile_ErrorRoutes(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		error_routes
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !app.ErrorRoutes {
+		t.Error("ErrorRoutes should be set")
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		error_routes yes
+	}`))
+	if err == nil {
+		t.Error("expected error for error_routes with an argument")
+	}
+}
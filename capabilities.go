@@ -0,0 +1,255 @@
+package twingate
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Capabilities summarizes how the app is configured, for support requests
+// and diagnostics. It is logged once provisioning succeeds and served at
+// /twingate/config. It never includes the API key, URLs lose their
+// credentials and query, and Caddy addresses are left out when
+// redact_addresses is set.
+type Capabilities struct {
+	// Version and Commit identify the plugin build.
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+
+	Tenant          string   `json:"tenant"`
+	Label           string   `json:"label,omitempty"`
+	APIEndpoint     string   `json:"api_endpoint"`
+	RemoteNetwork   string   `json:"remote_network"`
+	RemoteNetworkID string   `json:"remote_network_id,omitempty"`
+	AddressMode     string   `json:"address_mode"`
+	CaddyAddresses  []string `json:"caddy_addresses,omitempty"`
+	Resolver        string   `json:"address_resolver,omitempty"`
+	InitialSync     string   `json:"initial_sync"`
+	Cleanup         string   `json:"cleanup"`
+	CleanupScope    string   `json:"cleanup_scope,omitempty"`
+
+	// DiscoveredHosts is the number of resources the last discovery
+	// found.
+	DiscoveredHosts int `json:"discovered_hosts"`
+
+	// Features lists the optional features that are enabled, by option
+	// name.
+	Features []string `json:"features"`
+
+	// Effective is the app's JSON config as provisioned, with defaults
+	// filled in and secrets redacted. Tenant blocks are under Tenants.
+	Effective map[string]any `json:"effective,omitempty"`
+
+	// Tenants holds the capabilities of each tenant block.
+	Tenants []*Capabilities `json:"tenants,omitempty"`
+}
+
+// secretKeys are the words whose appearance in a config key marks its
+// value, such as a guest module's token, as a secret.
+var secretKeys = []string{"secret", "token", "password", "passwd", "credential"}
+
+// capabilities returns the capabilities of the app and its tenant blocks.
+func (t *TwingateApp) capabilities() *Capabilities {
+	caps := t.ownCapabilities()
+	caps.Effective = t.effectiveConfig()
+	for _, label := range t.tenantLabels() {
+		caps.Tenants = append(caps.Tenants, t.Tenants[label].capabilities())
+	}
+	return caps
+}
+
+func (t *TwingateApp) ownCapabilities() *Capabilities {
+	build := pluginBuild()
+	caps := &Capabilities{
+		Version:         build.Version,
+		Commit:          build.Commit,
+		Tenant:          t.Tenant,
+		Label:           t.label,
+		APIEndpoint:     redactURL(t.apiEndpoint()),
+		RemoteNetwork:   t.remoteNetworkName(),
+		RemoteNetworkID: t.RemoteNetworkID,
+		AddressMode:     t.AddressMode,
+		InitialSync:     t.InitialSync,
+		Cleanup:         "off",
+		Features:        t.features(),
+	}
+	if caps.AddressMode == "" {
+		caps.AddressMode = AddressModeIP
+	}
+	if caps.InitialSync == "" {
+		caps.InitialSync = InitialSyncProvision
+	}
+	if !t.RedactAddresses {
+		caps.CaddyAddresses = t.configuredAddresses()
+		if t.Fleet != nil {
+			caps.CaddyAddresses = t.Fleet.addresses()
+		}
+	}
+	if t.resolver != nil {
+		caps.Resolver = resolverName(t.resolver)
+	}
+	if cleanup := t.ResourceCleanup; cleanup != nil && cleanup.Enabled {
+		caps.Cleanup = "enabled"
+		if cleanup.DryRun {
+			caps.Cleanup = "dry_run"
+		}
+		caps.CleanupScope = cleanup.Scope
+	}
+
+	t.syncMutex.RLock()
+	caps.DiscoveredHosts = t.discovered
+	t.syncMutex.RUnlock()
+	return caps
+}
+
+// features returns the names of the optional features that are enabled.
+func (t *TwingateApp) features() []string {
+	enabled := []string{}
+	for _, f := range []struct {
+		name string
+		on   bool
+	}{
+		{"adopt", t.Adopt},
+		{"match_on", t.MatchOn != ""},
+		{"retry", t.Retry == nil || !t.Retry.Disabled},
+		{"circuit_breaker", t.CircuitBreaker == nil || !t.CircuitBreaker.Disabled},
+		{"restore_access", t.RestoreAccess == nil || !t.RestoreAccess.Disabled},
+		{"churn_limit", t.ChurnLimit.enabled()},
+		{"default_access", t.DefaultAccess != nil},
+		{"tls_client_auth", t.TLSClientAuth != nil},
+		{"proxy_url", t.ProxyURL != ""},
+		{"warmup", t.Warmup != nil},
+		{"address_check", t.AddressCheck != nil},
+		{"security_posture", t.SecurityPosture},
+		{"access_listing", t.AccessListing},
+		{"access_check", t.AccessCheck},
+		{"profiles", len(t.Profiles) > 0},
+		{"wildcard_hosts", t.WildcardHosts != ""},
+		{"error_routes", t.ErrorRoutes},
+		{"alias_rewrite", t.AliasSuffix != "" || len(t.AliasRewrites) > 0},
+		{"extra_resources", len(t.ExtraResources) > 0},
+		{"catch_all", t.CatchAll != nil},
+		{"discoverers", len(t.DiscoverersRaw) > 0},
+		{"hooks", len(t.HooksRaw) > 0},
+		{"host_feed", t.HostFeed != nil},
+		{"resync_on", len(t.ResyncOn) > 0},
+		{"sync_trigger", t.SyncTrigger != nil},
+		{"routes_from", t.RoutesFrom != nil},
+		{"nodes", t.Fleet != nil},
+		{"systemd", t.Systemd != nil},
+		{"managed_fields", len(t.ManagedFields) > 0},
+		{"drift_policy", t.DriftPolicy != nil},
+		{"report", t.ReportPath != ""},
+		{"redact_addresses", t.RedactAddresses},
+		{"skip_connection_test", t.SkipConnectionTest},
+		{"read_only", t.ReadOnly},
+		{"approval_required", t.ApprovalRequired},
+	} {
+		if f.on {
+			enabled = append(enabled, f.name)
+		}
+	}
+	return enabled
+}
+
+// logCapabilities logs the app's capabilities as a single entry.
+func (t *TwingateApp) logCapabilities() {
+	caps := t.ownCapabilities()
+	t.logger.Info("Twingate module provisioned successfully",
+		zap.String("version", caps.Version),
+		zap.String("commit", caps.Commit),
+		zap.String("tenant", caps.Tenant),
+		zap.String("endpoint", caps.APIEndpoint),
+		zap.String("remote_network", caps.RemoteNetwork),
+		zap.String("address_mode", caps.AddressMode),
+		zap.Strings("addresses", caps.CaddyAddresses),
+		zap.String("initial_sync", caps.InitialSync),
+		zap.String("cleanup", caps.Cleanup),
+		zap.Int("discovered_hosts", caps.DiscoveredHosts),
+		zap.Strings("features", caps.Features))
+}
+
+// effectiveConfig returns the app's own config as it would be written in
+// JSON, with the defaults it runs with filled in and secrets redacted, so
+// users can check how their Caddyfile options were adapted.
+func (t *TwingateApp) effectiveConfig() map[string]any {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil
+	}
+	var cfg map[string]any
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil
+	}
+	delete(cfg, "tenants")
+
+	caps := t.ownCapabilities()
+	cfg["tenant"] = caps.Tenant
+	if t.RemoteNetworkID == "" {
+		cfg["remote_network"] = caps.RemoteNetwork
+	}
+	cfg["address_mode"] = caps.AddressMode
+	cfg["initial_sync"] = caps.InitialSync
+	cfg["api_endpoint"] = caps.APIEndpoint
+	cfg["api_key_env"] = t.apiKeyEnv()
+	cfg["api_key"] = ""
+	if os.Getenv(t.apiKeyEnv()) != "" {
+		cfg["api_key"] = redacted
+	}
+	redactSecrets(cfg, t.RedactAddresses)
+	return cfg
+}
+
+// redactSecrets redacts, throughout a decoded JSON config, the values of
+// secret-looking keys and the credentials and queries of URLs, and with
+// addresses set the values of address keys.
+func redactSecrets(v any, addresses bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if key != "api_key" && isSecretKey(key) || addresses && isAddressKey(key) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactSecrets(value, addresses)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactSecrets(value, addresses)
+		}
+	case string:
+		if strings.Contains(v, "://") {
+			return redactURL(v)
+		}
+	}
+	return v
+}
+
+func isAddressKey(key string) bool {
+	return addressKeys[key] || key == "caddy_address" || key == "caddy_addresses"
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range secretKeys {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL strips the credentials, query and fragment from a URL.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
@@ -0,0 +1,30 @@
+package twingate
+
+import (
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	cfg := map[string]any{
+		"api_key_env": "TWINGATE_API_KEY",
+		"hooks": []any{map[string]any{
+			"hook":      "webhook",
+			"url":       "https://hooks.example.com/notify?token=abc",
+			"authToken": "s3cret",
+		}},
+		"extra_resources": []any{map[string]any{"name": "nas", "address": "10.0.5.20"}},
+	}
+	redactSecrets(cfg, true)
+
+	hook := cfg["hooks"].([]any)[0].(map[string]any)
+	if hook["url"] != "https://hooks.example.com/notify" || hook["authToken"] != redacted || hook["hook"] != "webhook" {
+		t.Errorf("hook config not redacted: %v", hook)
+	}
+	extra := cfg["extra_resources"].([]any)[0].(map[string]any)
+	if extra["address"] != redacted || extra["name"] != "nas" {
+		t.Errorf("extra resource not redacted: %v", extra)
+	}
+	if cfg["api_key_env"] != "TWINGATE_API_KEY" {
+		t.Errorf("api_key_env should be kept, got %v", cfg["api_key_env"])
+	}
+}
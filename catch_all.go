@@ -0,0 +1,168 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// catchAllIdentity identifies the catch-all resource, so renaming it
+// updates the existing resource in place.
+const catchAllIdentity = "catch_all"
+
+// CatchAll declares a resource for the sites Caddy falls back to when a
+// request names no configured host, such as a client reaching Caddy by IP.
+// It points at the Caddy address and is only synced while a server has a
+// fallback: a TLS connection policy with a default_sni, or a site that
+// matches any host.
+type CatchAll struct {
+	Name  string `json:"name"`
+	Alias string `json:"alias,omitempty"`
+
+	// Groups names the groups granted access to the resource.
+	Groups []string `json:"groups,omitempty"`
+
+	// RemoteNetwork overrides the app's remote network for this resource.
+	RemoteNetwork string `json:"remote_network,omitempty"`
+
+	// Profile names a profile whose settings apply where the resource
+	// sets none.
+	Profile string `json:"profile,omitempty"`
+}
+
+func (c CatchAll) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name cannot be empty")
+	}
+	if c.Alias != "" && !isDNSName(c.Alias) {
+		return fmt.Errorf("%s: alias '%s' is not a valid DNS name", c.Name, c.Alias)
+	}
+	return nil
+}
+
+// ToResourceMappings returns one mapping per Caddy address. Like the
+// mappings of a site, several addresses get resources named
+// "name@address" without an alias, since aliases must be unique.
+func (c CatchAll) ToResourceMappings(caddyAddresses []string) []ResourceMapping {
+	if len(caddyAddresses) == 1 {
+		mapping := ResourceMapping{
+			Name:          c.Name,
+			Address:       caddyAddresses[0],
+			Groups:        c.Groups,
+			RemoteNetwork: c.RemoteNetwork,
+			Identity:      catchAllIdentity,
+		}
+		if c.Alias != "" {
+			alias := c.Alias
+			mapping.Alias = &alias
+		}
+		return []ResourceMapping{mapping}
+	}
+
+	mappings := make([]ResourceMapping, len(caddyAddresses))
+	for i, addr := range caddyAddresses {
+		mappings[i] = ResourceMapping{
+			Name:          c.Name + "@" + addr,
+			Address:       addr,
+			Groups:        c.Groups,
+			RemoteNetwork: c.RemoteNetwork,
+			Identity:      catchAllIdentity + "@" + addr,
+		}
+	}
+	return mappings
+}
+
+// fallbackServers returns the names of the HTTP servers that have a
+// fallback site: a TLS connection policy with a default_sni, or a route
+// matching any host. Routes that only respond statically, like the HTTP
+// to HTTPS redirects added by automatic HTTPS, are not sites.
+func fallbackServers(httpApp *caddyhttp.App) []string {
+	var names []string
+	for name, server := range httpApp.Servers {
+		if hasDefaultSNI(server) || slices.ContainsFunc(server.Routes, isCatchAllRoute) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasDefaultSNI(server *caddyhttp.Server) bool {
+	for _, policy := range server.TLSConnPolicies {
+		if policy.DefaultSNI != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isCatchAllRoute reports whether a route is a site matching any host.
+func isCatchAllRoute(route caddyhttp.Route) bool {
+	handlers := routeHandlers(route)
+	if !slices.ContainsFunc(handlers, func(h routeHandler) bool { return h.name != "static_response" }) {
+		return false
+	}
+
+	sets := routeMatcherSets(route)
+	if len(sets) == 0 {
+		return true
+	}
+	for _, set := range sets {
+		if !slices.ContainsFunc(set, func(m caddyhttp.RequestMatcher) bool {
+			_, ok := m.(*caddyhttp.MatchHost)
+			return ok
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendCatchAll adds the catch-all resource to the mappings when it is
+// configured and a server has a fallback. Discovered mappings win when
+// names collide.
+func (t *TwingateApp) appendCatchAll(ctx context.Context, mappings []ResourceMapping, httpApp *caddyhttp.App, caddyAddresses []string) ([]ResourceMapping, error) {
+	if t.CatchAll == nil {
+		return mappings, nil
+	}
+	servers := fallbackServers(httpApp)
+	if len(servers) == 0 {
+		t.logger.Debug("No server has a default_sni or catch-all site, skipping catch_all resource",
+			zap.String("name", t.CatchAll.Name))
+		return mappings, nil
+	}
+	for _, m := range mappings {
+		if m.Name == t.CatchAll.Name {
+			t.logger.Warn("Catch-all resource has the same name as a discovered resource, ignoring it",
+				zap.String("name", t.CatchAll.Name))
+			return mappings, nil
+		}
+	}
+
+	// The catch-all always points at Caddy, even when sites are published
+	// by their host names.
+	if len(caddyAddresses) == 0 {
+		addrs, err := t.resolveCaddyAddresses(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("catch_all: %w", err)
+		}
+		caddyAddresses = addrs
+	}
+
+	catchAll := *t.CatchAll
+	// Profiles of the catch-all are checked by Validate.
+	profile := t.Profiles[catchAll.Profile]
+	catchAll.RemoteNetwork, catchAll.Groups = profile.fill(catchAll.RemoteNetwork, catchAll.Groups)
+	t.logger.Debug("Adding catch_all resource for fallback servers",
+		zap.String("name", catchAll.Name),
+		zap.Strings("servers", servers))
+	for _, mapping := range catchAll.ToResourceMappings(caddyAddresses) {
+		mapping.SecurityPolicy = profile.Policy
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
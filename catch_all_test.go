@@ -0,0 +1,112 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func TestFallbackServers(t *testing.T) {
+	var httpApp caddyhttp.App
+	err := json.Unmarshal([]byte(`{"servers": {
+		"hosts": {"routes": [
+			{"match": [{"host": ["app.example.com"]}], "handle": [{"handler": "reverse_proxy"}]}
+		]},
+		"redirects": {"routes": [
+			{"match": [{"protocol": "http"}], "handle": [{"handler": "static_response", "status_code": 308}]}
+		]},
+		"sni": {
+			"routes": [{"match": [{"host": ["app.example.com"]}], "handle": [{"handler": "reverse_proxy"}]}],
+			"tls_connection_policies": [{"default_sni": "app.example.com"}]
+		},
+		"by_ip": {"routes": [
+			{"match": [{"host": ["app.example.com"]}], "handle": [{"handler": "reverse_proxy"}]},
+			{"match": [{"path": ["/health"]}], "handle": [{"handler": "subroute"}]}
+		]}
+	}}`), &httpApp)
+	if err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+
+	if got, want := fallbackServers(&httpApp), []string{"by_ip", "sni"}; !slices.Equal(got, want) {
+		t.Errorf("fallbackServers() = %v, want %v", got, want)
+	}
+}
+
+func TestAppendCatchAll(t *testing.T) {
+	catchAll := caddyhttp.Route{
+		Handlers: []caddyhttp.MiddlewareHandler{&caddyhttp.StaticResponse{}, &caddyhttp.Subroute{}},
+	}
+	httpApp := &caddyhttp.App{Servers: map[string]*caddyhttp.Server{
+		"srv0": {Routes: caddyhttp.RouteList{catchAll}},
+	}}
+	app := &TwingateApp{
+		logger:   zap.NewNop(),
+		CatchAll: &CatchAll{Name: "caddy-default", Alias: "caddy.internal", Profile: "ops"},
+		Profiles: map[string]Profile{"ops": {Groups: []string{"Ops"}}},
+	}
+
+	mappings, err := app.appendCatchAll(context.Background(), []ResourceMapping{{Name: "app.example.com"}}, httpApp, []string{"10.0.0.1"})
+	if err != nil {
+		t.Fatalf("appendCatchAll() error = %v", err)
+	}
+	if len(mappings) != 2 {
+		t.Fatalf("expected 2 mappings, got %+v", mappings)
+	}
+	m := mappings[1]
+	if m.Name != "caddy-default" || m.Address != "10.0.0.1" || m.Alias == nil || *m.Alias != "caddy.internal" ||
+		m.Identity != catchAllIdentity || !slices.Equal(m.Groups, []string{"Ops"}) {
+		t.Errorf("unexpected catch-all mapping: %+v", m)
+	}
+	if app.CatchAll.Groups != nil {
+		t.Error("profile settings should not be written back to the config")
+	}
+
+	// Several addresses give one resource each, without an alias
+	mappings, _ = app.appendCatchAll(context.Background(), nil, httpApp, []string{"10.0.0.1", "10.0.0.2"})
+	if len(mappings) != 2 || mappings[1].Name != "caddy-default@10.0.0.2" || mappings[1].Alias != nil {
+		t.Errorf("unexpected mappings for several addresses: %+v", mappings)
+	}
+
+	// Without a fallback site nothing is added
+	hostOnly := caddyhttp.MatchHost{"app.example.com"}
+	httpApp.Servers["srv0"].Routes[0].MatcherSets = caddyhttp.MatcherSets{{&hostOnly}}
+	if mappings, _ := app.appendCatchAll(context.Background(), nil, httpApp, []string{"10.0.0.1"}); len(mappings) != 0 {
+		t.Errorf("expected no catch-all without a fallback, got %+v", mappings)
+	}
+}
+
+func TestUnmarshalCaddyfile_CatchAll(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		catch_all caddy-default caddy.internal {
+			groups Ops
+			remote_network Edge
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := app.CatchAll
+	if c == nil || c.Name != "caddy-default" || c.Alias != "caddy.internal" ||
+		!slices.Equal(c.Groups, []string{"Ops"}) || c.RemoteNetwork != "Edge" {
+		t.Errorf("unexpected catch_all: %+v", c)
+	}
+
+	for _, input := range []string{
+		"catch_all",
+		"catch_all caddy-default not_a_dns_name!",
+		"catch_all caddy-default {\n\t\t\taddress 10.0.0.1\n\t\t}",
+	} {
+		err := (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n\t\ttenant acme\n\t\t" + input + "\n\t}"))
+		if err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
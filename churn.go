@@ -0,0 +1,153 @@
+package twingate
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// ChurnLimitConfig controls the detection of flapping resources: resources
+// that successive syncs keep creating and deleting, typically because a
+// dynamic config adds and removes their host. Detection is off unless
+// configured.
+type ChurnLimitConfig struct {
+	// Disabled turns detection off for a config that sets it.
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Changes is the number of creations and deletions of a resource
+	// within Window at which it is flapping. Defaults to 4.
+	Changes int `json:"changes,omitempty"`
+
+	// Window is the period over which changes are counted. Defaults to
+	// 1h.
+	Window caddy.Duration `json:"window,omitempty"`
+}
+
+const (
+	defaultChurnChanges = 4
+	defaultChurnWindow  = time.Hour
+)
+
+func (c *ChurnLimitConfig) enabled() bool {
+	return c != nil && !c.Disabled
+}
+
+func (c *ChurnLimitConfig) changes() int {
+	if c != nil && c.Changes > 0 {
+		return c.Changes
+	}
+	return defaultChurnChanges
+}
+
+func (c *ChurnLimitConfig) window() time.Duration {
+	if c != nil && c.Window > 0 {
+		return time.Duration(c.Window)
+	}
+	return defaultChurnWindow
+}
+
+// flapping returns the names of the resources created or deleted at least
+// limit times within window of now, according to churn.
+func flapping(churn map[string][]time.Time, limit int, window time.Duration, now time.Time) map[string]bool {
+	names := make(map[string]bool)
+	for name, times := range churn {
+		recent := 0
+		for _, at := range times {
+			if now.Sub(at) <= window {
+				recent++
+			}
+		}
+		if recent >= limit {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// recordChurn adds the creations and deletions of a sync to the churn
+// history in the stored state, dropping changes older than the window.
+// Resources that start flapping are reported and from then on held: not
+// deleted when stale, so the sync stops recreating them. A held resource is
+// released once it has not flapped for a window.
+func (t *TwingateApp) recordChurn(ctx context.Context, syncer *ResourceSyncer) {
+	if !t.ChurnLimit.enabled() || t.state == nil {
+		return
+	}
+
+	var changed []string
+	for name, action := range syncer.Actions() {
+		if action == ActionCreated {
+			changed = append(changed, name)
+		}
+	}
+	for _, deletion := range syncer.Deletions() {
+		if !deletion.DryRun && deletion.Err == nil {
+			changed = append(changed, deletion.Resource.Name)
+		}
+	}
+
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+	if len(changed) == 0 && len(state.Churn) == 0 {
+		return
+	}
+
+	now := time.Now()
+	limit, window := t.ChurnLimit.changes(), t.ChurnLimit.window()
+	before := flapping(state.Churn, limit, window, now)
+
+	if state.Churn == nil {
+		state.Churn = make(map[string][]time.Time)
+	}
+	for _, name := range changed {
+		state.Churn[name] = append(state.Churn[name], now)
+	}
+	for name, times := range state.Churn {
+		times = slices.DeleteFunc(times, func(at time.Time) bool {
+			return now.Sub(at) > window
+		})
+		if len(times) == 0 {
+			delete(state.Churn, name)
+			continue
+		}
+		state.Churn[name] = times
+	}
+	if err := t.state.save(ctx, state); err != nil {
+		t.log(ctx).Warn("Failed to save Twingate sync state", zap.Error(err))
+		return
+	}
+
+	after := flapping(state.Churn, limit, window, now)
+	for _, name := range sortedKeys(after) {
+		if before[name] {
+			continue
+		}
+		t.log(ctx).Warn("Resource is flapping, holding it until it settles",
+			zap.String("name", name),
+			zap.Int("changes", len(state.Churn[name])),
+			zap.Duration("window", window))
+		t.emit(ctx, "twingate_resource_flapping", map[string]any{
+			"name":    name,
+			"changes": len(state.Churn[name]),
+			"window":  window.String(),
+		})
+	}
+	for _, name := range sortedKeys(before) {
+		if !after[name] {
+			t.log(ctx).Info("Resource stopped flapping, releasing it",
+				zap.String("name", name))
+		}
+	}
+
+	held := sortedKeys(after)
+	if twingateMetrics.resourcesFlapping != nil {
+		twingateMetrics.resourcesFlapping.WithLabelValues(t.Tenant).Set(float64(len(held)))
+	}
+	t.flapping = held
+}
@@ -0,0 +1,126 @@
+package twingate
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+)
+
+func TestFlapping(t *testing.T) {
+	now := time.Now()
+	churn := map[string][]time.Time{
+		"flap.example.com":  {now.Add(-50 * time.Minute), now.Add(-30 * time.Minute), now.Add(-10 * time.Minute)},
+		"calm.example.com":  {now.Add(-2 * time.Hour), now.Add(-90 * time.Minute), now.Add(-5 * time.Minute)},
+		"fresh.example.com": {now},
+	}
+	got := flapping(churn, 3, time.Hour, now)
+	if len(got) != 1 || !got["flap.example.com"] {
+		t.Errorf("flapping() = %v, want only flap.example.com", got)
+	}
+}
+
+func TestRecordChurnHoldsFlappingResource(t *testing.T) {
+	initMetrics()
+	ctx := context.Background()
+	client := &MockTwingateClient{Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}}}
+	app := &TwingateApp{
+		Tenant:     "acme",
+		ChurnLimit: &ChurnLimitConfig{Changes: 3},
+		api:        client,
+		logger:     zap.NewNop(),
+		state:      newStateStore(&certmagic.FileStorage{Path: t.TempDir()}, "acme"),
+	}
+
+	keep := ResourceMapping{Name: "keep.example.com", Address: "10.0.0.1"}
+	flap := ResourceMapping{Name: "flap.example.com", Address: "10.0.0.1"}
+	sync := func(mappings ...ResourceMapping) {
+		t.Helper()
+		syncer := app.newSyncer(ctx)
+		app.loadSyncState(ctx, syncer)
+		if err := syncer.SyncResources(ctx, mappings, "", &CleanupConfig{Enabled: true}); err != nil {
+			t.Fatalf("SyncResources() failed: %v", err)
+		}
+		app.recordChurn(ctx, syncer)
+	}
+	exists := func(name string) bool {
+		for _, res := range client.Resources {
+			if res.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Created, deleted and created again: the third change makes it flap.
+	sync(keep, flap)
+	sync(keep)
+	if exists("flap.example.com") || len(app.flapping) != 0 {
+		t.Fatalf("a resource should be deleted before it flaps, flapping = %v", app.flapping)
+	}
+	sync(keep, flap)
+	if !slices.Equal(app.flapping, []string{"flap.example.com"}) {
+		t.Fatalf("flapping = %v, want flap.example.com", app.flapping)
+	}
+
+	// Held, it survives its host going away.
+	sync(keep)
+	if !exists("flap.example.com") {
+		t.Error("a flapping resource should not be deleted")
+	}
+
+	// Once its changes are older than the window it is released.
+	state, _ := app.state.load(ctx)
+	for i := range state.Churn["flap.example.com"] {
+		state.Churn["flap.example.com"][i] = time.Now().Add(-2 * time.Hour)
+	}
+	if err := app.state.save(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+	sync(keep)
+	sync(keep)
+	if exists("flap.example.com") || len(app.flapping) != 0 {
+		t.Errorf("a settled resource should be cleaned up again, flapping = %v", app.flapping)
+	}
+}
+
+func TestChurnLimitOptIn(t *testing.T) {
+	var unset *ChurnLimitConfig
+	if unset.enabled() {
+		t.Error("churn_limit should be off unless configured")
+	}
+	if !(&ChurnLimitConfig{}).enabled() || (&ChurnLimitConfig{Disabled: true}).enabled() {
+		t.Error("a configured churn_limit should be on unless disabled")
+	}
+}
+
+func TestUnmarshalCaddyfile_ChurnLimit(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ChurnLimitConfig
+		wantErr bool
+	}{
+		{input: "churn_limit", want: ChurnLimitConfig{}},
+		{input: "churn_limit off", want: ChurnLimitConfig{Disabled: true}},
+		{input: "churn_limit 6", want: ChurnLimitConfig{Changes: 6}},
+		{input: "churn_limit 6 30m", want: ChurnLimitConfig{Changes: 6, Window: caddy.Duration(30 * time.Minute)}},
+		{input: "churn_limit 1", wantErr: true},
+		{input: "churn_limit 6 soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		var app TwingateApp
+		err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n" + tt.input + "\n}"))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && *app.ChurnLimit != tt.want {
+			t.Errorf("%s: ChurnLimit = %+v, want %+v", tt.input, *app.ChurnLimit, tt.want)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package twingate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errCleanupRunning refuses a cleanup while another is in progress.
+var errCleanupRunning = errors.New("a resource cleanup is already running")
+
+// cleanupControl lets the admin API abort a cleanup in progress.
+type cleanupControl struct {
+	running atomic.Bool
+	aborted atomic.Bool
+}
+
+func (c *cleanupControl) start() {
+	c.aborted.Store(false)
+	c.running.Store(true)
+}
+
+func (c *cleanupControl) stop() {
+	c.running.Store(false)
+}
+
+// abort stops the running cleanup before its next deletion. It reports
+// whether a cleanup was running.
+func (c *cleanupControl) abort() bool {
+	if !c.running.Load() {
+		return false
+	}
+	c.aborted.Store(true)
+	return true
+}
+
+func (c *cleanupControl) isAborted() bool {
+	return c != nil && c.aborted.Load()
+}
+
+// withoutSyncLock runs fn with syncMutex released. The caller holds
+// syncMutex.
+func (t *TwingateApp) withoutSyncLock(fn func()) {
+	t.syncMutex.Unlock()
+	defer t.syncMutex.Lock()
+	fn()
+}
+
+// abortCleanup aborts the cleanup of this app and its tenant blocks. It
+// reports whether any was running.
+func (t *TwingateApp) abortCleanup() bool {
+	aborted := t.cleanup.abort()
+	for _, label := range t.tenantLabels() {
+		if t.Tenants[label].abortCleanup() {
+			aborted = true
+		}
+	}
+	return aborted
+}
+
+// pauseBetweenBatches waits out the batch pause after a batch of deletions,
+// outside the caller's lock. It reports whether cleanup should continue,
+// which it should not once the context is done or the cleanup was aborted.
+func (r *ResourceSyncer) pauseBetweenBatches(ctx context.Context, cleanupConfig *CleanupConfig, deleted, remaining int) bool {
+	pause := time.Duration(cleanupConfig.BatchPause)
+	r.logger.Info("Deleted batch of stale resources",
+		zap.Int("deleted", deleted),
+		zap.Int("remaining", remaining),
+		zap.Duration("pause", pause))
+
+	if pause > 0 {
+		wait := func() {
+			timer := time.NewTimer(pause)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+			case <-timer.C:
+			}
+		}
+		if r.unlocked != nil {
+			r.unlocked(wait)
+		} else {
+			wait()
+		}
+	}
+	return ctx.Err() == nil && !r.cleanup.isAborted()
+}
+
+// lookupAccess lists the access to each stale resource. Resources whose
+// access could not be listed are left out of the result.
+func (r *ResourceSyncer) lookupAccess(ctx context.Context, resources []Resource) map[string][]AccessPrincipal {
+	access := make(map[string][]AccessPrincipal, len(resources))
+	for _, resource := range resources {
+		principals, err := r.client.GetResourceAccess(ctx, resource.ID)
+		if err != nil {
+			r.logger.Warn("Failed to list access to stale resource",
+				zap.String("id", resource.ID),
+				zap.String("name", resource.Name),
+				zap.Error(err))
+			continue
+		}
+		access[resource.ID] = principals
+	}
+	return access
+}
+
+// orderByAccess moves stale resources with fewer access grants ahead,
+// keeping the name order among equals, so a cleanup that is aborted or
+// stopped leaves the resources people can still reach for last. Resources
+// whose access could not be listed go last.
+func orderByAccess(resources []Resource, access map[string][]AccessPrincipal) {
+	grants := func(resource Resource) int {
+		principals, ok := access[resource.ID]
+		if !ok {
+			return math.MaxInt
+		}
+		return len(principals)
+	}
+	slices.SortStableFunc(resources, func(a, b Resource) int {
+		return cmp.Compare(grants(a), grants(b))
+	})
+}
+
+// revokeAccess removes the access of every group and service account to a
+// stale resource about to be deleted, and returns the principals it
+// revoked. The access listed when the cleanup started is used, or listed
+// again if that failed.
+func (r *ResourceSyncer) revokeAccess(ctx context.Context, resource Resource, access map[string][]AccessPrincipal) ([]AccessPrincipal, error) {
+	principals, ok := access[resource.ID]
+	if !ok {
+		var err error
+		if principals, err = r.client.GetResourceAccess(ctx, resource.ID); err != nil {
+			return nil, err
+		}
+	}
+	if len(principals) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(principals))
+	serviceAccounts := 0
+	for i, principal := range principals {
+		ids[i] = principal.ID
+		if principal.Type == "ServiceAccount" {
+			serviceAccounts++
+		}
+	}
+	r.logger.Info("Revoking access to stale resource",
+		zap.String("id", resource.ID),
+		zap.String("name", resource.Name),
+		zap.Int("groups", len(ids)-serviceAccounts),
+		zap.Int("service_accounts", serviceAccounts))
+	if err := r.client.RemoveResourceAccess(ctx, resource.ID, ids); err != nil {
+		return nil, err
+	}
+	return principals, nil
+}
+
+// regrantAccess gives back the access revoked from a stale resource whose
+// deletion then failed, so a resource that is kept stays reachable. A
+// failure is logged, as the deletion already counts as failed.
+func (r *ResourceSyncer) regrantAccess(ctx context.Context, resource Resource, principals []AccessPrincipal) {
+	if len(principals) == 0 {
+		return
+	}
+	if err := r.client.AddResourceAccess(ctx, resource.ID, principals); err != nil {
+		r.logger.Error("Failed to restore access to stale resource that was kept",
+			zap.String("id", resource.ID),
+			zap.String("name", resource.Name),
+			zap.Int("principals", len(principals)),
+			zap.Error(err))
+		return
+	}
+	r.logger.Info("Restored access to stale resource that was kept",
+		zap.String("id", resource.ID),
+		zap.String("name", resource.Name),
+		zap.Int("principals", len(principals)))
+}
+
+// syncedNetworks returns the remote networks earlier syncs reached, from
+// the stored state.
+func (t *TwingateApp) syncedNetworks(ctx context.Context) []string {
+	if t.state == nil {
+		return nil
+	}
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to load Twingate sync state", zap.Error(err))
+		return nil
+	}
+	return state.Networks
+}
+
+// CleanedResource is a stale resource found by a manual cleanup, and
+// whether it was deleted.
+type CleanedResource struct {
+	Tenant        string `json:"tenant"`
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Address       string `json:"address"`
+	RemoteNetwork string `json:"remote_network"`
+	Deleted       bool   `json:"deleted"`
+	Error         string `json:"error,omitempty"`
+}
+
+// runCleanup deletes the stale resources of this app and its tenant blocks
+// outside of a sync, whether or not resource cleanup is enabled. With
+// dryRun they are only listed; otherwise only those among ids are deleted,
+// so an operator deletes no more than they confirmed.
+func (t *TwingateApp) runCleanup(ctx context.Context, dryRun bool, ids []string) ([]CleanedResource, error) {
+	var cleaned []CleanedResource
+	if t.Tenant != "" {
+		var err error
+		cleaned, err = t.cleanupStale(ctx, dryRun, ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, label := range t.tenantLabels() {
+		tenant, err := t.Tenants[label].runCleanup(ctx, dryRun, ids)
+		if err != nil {
+			return nil, fmt.Errorf("tenant block %s: %w", label, err)
+		}
+		cleaned = append(cleaned, tenant...)
+	}
+	return cleaned, nil
+}
+
+// cleanupStale runs deleteStaleResources against each remote network the
+// current mappings sync to, and each network earlier syncs reached that no
+// site targets anymore, with the configured cleanup settings. Networks
+// that do not exist are skipped.
+func (t *TwingateApp) cleanupStale(ctx context.Context, dryRun bool, ids []string) ([]CleanedResource, error) {
+	t.syncMutex.Lock()
+	defer t.syncMutex.Unlock()
+
+	// A sync's cleanup releases the lock between batches
+	if t.cleanup.running.Load() {
+		return nil, errCleanupRunning
+	}
+
+	mappings, err := t.discoverMappings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// As in a sync, no hosts at all more likely means a broken config
+	// than that every resource is stale.
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("no hosts discovered, refusing to treat every resource as stale")
+	}
+	if err := t.resolveRemoteNetworkID(ctx); err != nil {
+		return nil, err
+	}
+
+	config := CleanupConfig{}
+	if t.ResourceCleanup != nil {
+		config = *t.ResourceCleanup
+	}
+	config.Enabled = true
+	config.DryRun = dryRun
+
+	syncer := t.newSyncer(ctx)
+	syncer.unlocked = t.withoutSyncLock
+	if !dryRun {
+		syncer.confirmed = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			syncer.confirmed[id] = true
+		}
+	}
+	syncer.cleanup.start()
+	defer syncer.cleanup.stop()
+
+	groups := groupMappingsByNetwork(sortMappings(mappings), t.remoteNetworkName())
+	// Every resource in a network whose last site was removed is stale
+	for _, name := range t.syncedNetworks(ctx) {
+		if _, ok := groups[name]; !ok {
+			groups[name] = nil
+		}
+	}
+	var cleaned []CleanedResource
+	for _, name := range sortedKeys(groups) {
+		network := syncer.defaultNetwork
+		if network == nil || network.Name != name {
+			network, err = t.api.GetRemoteNetworkByName(ctx, name)
+			if err != nil {
+				return cleaned, fmt.Errorf("failed to look up remote network %s: %w", name, err)
+			}
+		}
+		if network == nil {
+			continue
+		}
+
+		done := len(syncer.deletions)
+		syncer.deleteStaleResources(ctx, groups[name], network.ID, &config)
+		for _, deletion := range syncer.deletions[done:] {
+			result := CleanedResource{
+				Tenant:        t.Tenant,
+				ID:            deletion.Resource.ID,
+				Name:          deletion.Resource.Name,
+				Address:       deletion.Resource.Address.Value,
+				RemoteNetwork: name,
+				Deleted:       !deletion.DryRun && deletion.Err == nil,
+			}
+			if deletion.Err != nil {
+				result.Error = deletion.Err.Error()
+			}
+			cleaned = append(cleaned, result)
+		}
+	}
+	return cleaned, nil
+}
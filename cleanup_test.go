@@ -0,0 +1,310 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// abortingClient aborts the cleanup after a number of deletions, as the
+// admin API would mid-way through a runaway cleanup.
+type abortingClient struct {
+	*MockTwingateClient
+	control *cleanupControl
+	after   int
+}
+
+func (c *abortingClient) DeleteResource(ctx context.Context, resourceID string) error {
+	err := c.MockTwingateClient.DeleteResource(ctx, resourceID)
+	if len(c.DeletedIDs) == c.after {
+		c.control.abort()
+	}
+	return err
+}
+
+func staleMockClient(count int) *MockTwingateClient {
+	client := &MockTwingateClient{Resources: map[string]Resource{}}
+	for i := range count {
+		id := fmt.Sprintf("res%d", i)
+		res := Resource{ID: id, Name: fmt.Sprintf("stale%d.example.com", i)}
+		res.RemoteNetwork.ID = "net1"
+		client.Resources[id] = res
+	}
+	return client
+}
+
+func TestDeleteStaleResourcesInBatches(t *testing.T) {
+	client := staleMockClient(5)
+	syncer := &ResourceSyncer{client: client, logger: zap.NewNop(), cleanup: &cleanupControl{}}
+
+	cleanupConfig := &CleanupConfig{
+		Enabled:    true,
+		BatchSize:  2,
+		BatchPause: caddy.Duration(time.Millisecond),
+	}
+	syncer.cleanup.start()
+	deleted, errors := syncer.deleteStaleResources(context.Background(), nil, "net1", cleanupConfig)
+	syncer.cleanup.stop()
+
+	if deleted != 5 || errors != 0 {
+		t.Errorf("deleted = %d, errors = %d, want 5 and 0", deleted, errors)
+	}
+	if len(client.Resources) != 0 {
+		t.Errorf("%d resources left, want 0", len(client.Resources))
+	}
+}
+
+func TestDeleteStaleResourcesAbort(t *testing.T) {
+	control := &cleanupControl{}
+	client := &abortingClient{MockTwingateClient: staleMockClient(5), control: control, after: 2}
+	syncer := &ResourceSyncer{client: client, logger: zap.NewNop(), cleanup: control}
+
+	control.start()
+	deleted, errors := syncer.deleteStaleResources(context.Background(), nil, "net1", &CleanupConfig{Enabled: true})
+	control.stop()
+
+	if deleted != 2 || errors != 0 {
+		t.Errorf("deleted = %d, errors = %d, want 2 and 0", deleted, errors)
+	}
+	if len(client.Resources) != 3 {
+		t.Errorf("%d resources left, want 3", len(client.Resources))
+	}
+
+	// The next cleanup starts afresh.
+	control.start()
+	deleted, _ = syncer.deleteStaleResources(context.Background(), nil, "net1", &CleanupConfig{Enabled: true})
+	control.stop()
+	if deleted != 3 {
+		t.Errorf("deleted = %d after restart, want 3", deleted)
+	}
+}
+
+func TestDeleteStaleResourcesCanceledDuringPause(t *testing.T) {
+	client := staleMockClient(4)
+	syncer := &ResourceSyncer{client: client, logger: zap.NewNop()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	cleanupConfig := &CleanupConfig{
+		Enabled:    true,
+		BatchSize:  2,
+		BatchPause: caddy.Duration(time.Minute),
+	}
+	deleted, _ := syncer.deleteStaleResources(ctx, nil, "net1", cleanupConfig)
+	if deleted != 2 {
+		t.Errorf("deleted = %d, want 2", deleted)
+	}
+}
+
+func TestDeleteStaleResourcesPausesOutsideLock(t *testing.T) {
+	app := &TwingateApp{}
+	client := staleMockClient(4)
+	syncer := &ResourceSyncer{client: client, logger: zap.NewNop(), cleanup: &app.cleanup, unlocked: app.withoutSyncLock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cleanupConfig := &CleanupConfig{
+		Enabled:    true,
+		BatchSize:  2,
+		BatchPause: caddy.Duration(time.Minute),
+	}
+
+	done := make(chan int)
+	app.syncMutex.Lock()
+	syncer.cleanup.start()
+	go func() {
+		deleted, _ := syncer.deleteStaleResources(ctx, nil, "net1", cleanupConfig)
+		syncer.cleanup.stop()
+		app.syncMutex.Unlock()
+		done <- deleted
+	}()
+
+	// Readers get the lock during the pause, while a manual cleanup is
+	// refused until the running one ends
+	waitFor(t, func() bool {
+		if !app.syncMutex.TryRLock() {
+			return false
+		}
+		app.syncMutex.RUnlock()
+		return true
+	})
+	if _, err := app.cleanupStale(ctx, true, nil); !errors.Is(err, errCleanupRunning) {
+		t.Errorf("cleanupStale() error = %v, want errCleanupRunning", err)
+	}
+	cancel()
+	if deleted := <-done; deleted != 2 {
+		t.Errorf("deleted = %d, want 2", deleted)
+	}
+}
+
+func TestCleanupControlAbort(t *testing.T) {
+	var control cleanupControl
+	if control.abort() {
+		t.Error("abort should report false with no cleanup running")
+	}
+	if control.isAborted() {
+		t.Error("abort with no cleanup running should not stick")
+	}
+
+	control.start()
+	if !control.abort() || !control.isAborted() {
+		t.Error("abort should take effect while a cleanup runs")
+	}
+	control.stop()
+
+	var nilControl *cleanupControl
+	if nilControl.isAborted() {
+		t.Error("nil control should never be aborted")
+	}
+}
+
+func TestAppAbortCleanupTenants(t *testing.T) {
+	app := &TwingateApp{Tenants: map[string]*TwingateApp{"b": {}}}
+	app.Tenants["b"].cleanup.start()
+
+	if !app.abortCleanup() {
+		t.Error("abortCleanup should report the tenant block's running cleanup")
+	}
+	if !app.Tenants["b"].cleanup.isAborted() {
+		t.Error("tenant block cleanup was not aborted")
+	}
+}
+
+func TestDeleteStaleResourcesScope(t *testing.T) {
+	client := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{
+			"r1": newTestResource("r1", "caddy-api.example.com", "10.0.0.1", "net1"),
+			"r2": newTestResource("r2", "caddy-old.example.com", "10.0.0.1", "net1"),
+			"r3": newTestResource("r3", "manual.example.com", "10.0.0.2", "net1"),
+		},
+	}
+	syncer := &ResourceSyncer{client: client, logger: zap.NewNop()}
+
+	cleanupConfig := &CleanupConfig{Enabled: true, Scope: "prefix:caddy-"}
+	desired := []ResourceMapping{{Name: "caddy-api.example.com", Address: "10.0.0.1"}}
+
+	summary, err := syncer.GetSyncSummary(context.Background(), desired, "", cleanupConfig)
+	if err != nil {
+		t.Fatalf("GetSyncSummary() failed: %v", err)
+	}
+	if summary.ResourcesToDelete != 1 {
+		t.Errorf("summary plans %d deletions, want 1", summary.ResourcesToDelete)
+	}
+
+	deleted, errors := syncer.deleteStaleResources(context.Background(), desired, "net1", cleanupConfig)
+	if deleted != 1 || errors != 0 {
+		t.Errorf("deleted = %d, errors = %d, want 1 and 0", deleted, errors)
+	}
+	if len(client.DeletedIDs) != 1 || client.DeletedIDs[0] != "r2" {
+		t.Errorf("DeletedIDs = %v, want [r2]", client.DeletedIDs)
+	}
+}
+
+func TestDeleteStaleResourcesRevokeAccess(t *testing.T) {
+	newClient := func() *MockTwingateClient {
+		return &MockTwingateClient{
+			Resources: map[string]Resource{
+				"r1": newTestResource("r1", "a.example.com", "10.0.0.1", "net1"),
+				"r2": newTestResource("r2", "b.example.com", "10.0.0.1", "net1"),
+				"r3": newTestResource("r3", "c.example.com", "10.0.0.1", "net1"),
+			},
+			Grants: map[string][]string{"r1": {"g1", "g2"}, "r2": {"g1"}},
+		}
+	}
+	cleanupConfig := &CleanupConfig{Enabled: true, RevokeAccess: true}
+
+	client := newClient()
+	syncer := &ResourceSyncer{client: client, logger: zap.NewNop()}
+	deleted, errors := syncer.deleteStaleResources(context.Background(), nil, "net1", cleanupConfig)
+	if deleted != 3 || errors != 0 {
+		t.Errorf("deleted = %d, errors = %d, want 3 and 0", deleted, errors)
+	}
+	if want := []string{"r3", "r2", "r1"}; !slices.Equal(client.DeletedIDs, want) {
+		t.Errorf("DeletedIDs = %v, want fewest grants first %v", client.DeletedIDs, want)
+	}
+	var revoked []string
+	for _, call := range client.CallLog {
+		if strings.HasPrefix(call, "RemoveResourceAccess") {
+			revoked = append(revoked, call)
+		}
+	}
+	if want := []string{"RemoveResourceAccess(r2)", "RemoveResourceAccess(r1)"}; !slices.Equal(revoked, want) {
+		t.Errorf("revocations = %v, want %v", revoked, want)
+	}
+
+	// A resource whose access cannot be revoked is kept
+	client = newClient()
+	client.RevokeErr = fmt.Errorf("permission denied")
+	syncer = &ResourceSyncer{client: client, logger: zap.NewNop()}
+	deleted, errors = syncer.deleteStaleResources(context.Background(), nil, "net1", cleanupConfig)
+	if deleted != 1 || errors != 2 {
+		t.Errorf("deleted = %d, errors = %d, want 1 and 2", deleted, errors)
+	}
+	if want := []string{"r3"}; !slices.Equal(client.DeletedIDs, want) {
+		t.Errorf("DeletedIDs = %v, want %v", client.DeletedIDs, want)
+	}
+}
+
+func TestDeleteStaleResourcesRevokesServiceAccounts(t *testing.T) {
+	client := &MockTwingateClient{
+		Resources: map[string]Resource{
+			"r1": newTestResource("r1", "a.example.com", "10.0.0.1", "net1"),
+		},
+		Grants:          map[string][]string{"r1": {"g1"}},
+		ServiceAccounts: map[string][]string{"r1": {"sa1"}},
+	}
+	cleanupConfig := &CleanupConfig{Enabled: true, RevokeAccess: true}
+
+	// A failed deletion gives the revoked access back
+	client.DeleteErr = fmt.Errorf("internal error")
+	syncer := &ResourceSyncer{client: client, logger: zap.NewNop()}
+	deleted, errors := syncer.deleteStaleResources(context.Background(), nil, "net1", cleanupConfig)
+	if deleted != 0 || errors != 1 {
+		t.Errorf("deleted = %d, errors = %d, want 0 and 1", deleted, errors)
+	}
+	if !slices.Equal(client.Grants["r1"], []string{"g1"}) || !slices.Equal(client.ServiceAccounts["r1"], []string{"sa1"}) {
+		t.Errorf("access after failed deletion = %v and %v, want [g1] and [sa1]", client.Grants["r1"], client.ServiceAccounts["r1"])
+	}
+
+	client.DeleteErr = nil
+	deleted, errors = syncer.deleteStaleResources(context.Background(), nil, "net1", cleanupConfig)
+	if deleted != 1 || errors != 0 {
+		t.Errorf("deleted = %d, errors = %d, want 1 and 0", deleted, errors)
+	}
+	if len(client.Grants["r1"]) != 0 || len(client.ServiceAccounts["r1"]) != 0 {
+		t.Errorf("access after deletion = %v and %v, want none", client.Grants["r1"], client.ServiceAccounts["r1"])
+	}
+}
+
+func TestCleanupStaleReachesNetworksWithoutSites(t *testing.T) {
+	ctx := context.Background()
+	client := &MockTwingateClient{}
+	app := newSnapshotTestApp(t, client)
+	app.CaddyAddress = "10.0.0.5"
+	app.RoutesFrom = &RoutesSource{File: writeSourceConfig(t)}
+
+	// An earlier sync put a host in IoT, whose site is gone since
+	syncer := app.newSyncer(ctx)
+	mappings := []ResourceMapping{{Name: "camera.example.com", Address: "10.0.0.5", RemoteNetwork: "IoT"}}
+	if err := syncer.SyncResources(ctx, mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	app.recordManaged(ctx, syncer)
+
+	cleaned, err := app.cleanupStale(ctx, true, nil)
+	if err != nil {
+		t.Fatalf("cleanupStale() failed: %v", err)
+	}
+	if len(cleaned) != 1 || cleaned[0].Name != "camera.example.com" || cleaned[0].RemoteNetwork != "IoT" {
+		t.Errorf("cleaned = %+v, want camera.example.com in IoT", cleaned)
+	}
+}
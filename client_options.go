@@ -0,0 +1,88 @@
+package twingate
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/hasura/go-graphql-client"
+	"go.uber.org/zap"
+)
+
+// ClientOption configures a TwingateClient built by NewTwingateClient.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	httpClient *http.Client
+	modifiers  []func(*http.Request)
+	logger     *zap.Logger
+}
+
+// WithHTTPClient sends the client's requests through httpClient, for
+// example one whose Transport adds tracing, custom authentication or a
+// proxy requiring client certificates. httpClient is not modified; the
+// client uses a copy whose Transport also follows the API's rate limit. A
+// nil Transport means http.DefaultTransport, and a nil httpClient keeps
+// the default client.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(o *clientOptions) {
+		if httpClient != nil {
+			o.httpClient = httpClient
+		}
+	}
+}
+
+// WithRequestModifier calls modify on every request, after the API key,
+// content type, User-Agent and X-Request-ID headers are set, so it may add
+// headers or override them.
+// Modifiers run in the order they are given.
+func WithRequestModifier(modify func(*http.Request)) ClientOption {
+	return func(o *clientOptions) {
+		o.modifiers = append(o.modifiers, modify)
+	}
+}
+
+// WithLogger sets the client's logger. Without it the client does not log.
+func WithLogger(logger *zap.Logger) ClientOption {
+	return func(o *clientOptions) {
+		o.logger = logger
+	}
+}
+
+// NewTwingateClient returns a client for the Twingate GraphQL API at
+// endpoint, such as https://<tenant>.twingate.com/api/graphql/,
+// authenticating with apiKey. Without WithHTTPClient, requests time out
+// after 30 seconds.
+func NewTwingateClient(endpoint, apiKey string, opts ...ClientOption) *TwingateClient {
+	o := clientOptions{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		logger:     zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	rateLimit := newRateLimitTracker(redactURL(endpoint), o.logger)
+	httpClient := *o.httpClient
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	httpClient.Transport = rateLimitTransport{base: base, tracker: rateLimit}
+
+	graphqlClient := graphql.NewClient(endpoint, &httpClient).
+		WithRequestModifier(func(r *http.Request) {
+			r.Header.Set("X-API-KEY", apiKey)
+			r.Header.Set("Content-Type", "application/json")
+			identifyRequest(r)
+			for _, modify := range o.modifiers {
+				modify(r)
+			}
+		})
+
+	return &TwingateClient{
+		client:    graphqlClient,
+		logger:    o.logger,
+		breaker:   newCircuitBreaker(redactURL(endpoint), o.logger),
+		rateLimit: rateLimit,
+	}
+}
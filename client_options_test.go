@@ -0,0 +1,67 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewTwingateClient_Options(t *testing.T) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"remoteNetworks": map[string]any{"edges": []any{}},
+		}})
+	}))
+	defer server.Close()
+
+	var trips int
+	httpClient := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		trips++
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	client := NewTwingateClient(server.URL, "secret",
+		WithHTTPClient(httpClient),
+		WithRequestModifier(func(r *http.Request) { r.Header.Set("X-Trace-Id", "abc") }),
+		WithRequestModifier(func(r *http.Request) { r.Header.Set("X-Trace-Id", r.Header.Get("X-Trace-Id")+"-2") }),
+	)
+
+	if err := client.TestConnection(context.Background()); err != nil {
+		t.Fatalf("TestConnection() failed: %v", err)
+	}
+	if trips != 1 {
+		t.Errorf("expected the request to go through the custom transport, got %d trips", trips)
+	}
+	if headers.Get("X-API-KEY") != "secret" || headers.Get("X-Trace-Id") != "abc-2" {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+	if _, ok := httpClient.Transport.(roundTripperFunc); !ok {
+		t.Error("the given HTTP client should not be modified")
+	}
+}
+
+func TestNewTwingateClient_NilHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"remoteNetworks": map[string]any{"edges": []any{}},
+		}})
+	}))
+	defer server.Close()
+
+	client := NewTwingateClient(server.URL, "secret", WithHTTPClient(nil))
+	if err := client.TestConnection(context.Background()); err != nil {
+		t.Fatalf("TestConnection() failed: %v", err)
+	}
+}
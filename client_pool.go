@@ -0,0 +1,178 @@
+package twingate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// connectionTestTTL is how long a successful connection test is trusted
+// before a newly provisioned app instance re-runs it.
+const connectionTestTTL = time.Minute
+
+// clientPool shares TwingateClients across app instances, so frequent config
+// reloads reuse connections and skip redundant connection tests.
+var clientPool = caddy.NewUsagePool()
+
+type pooledClient struct {
+	client *TwingateClient
+	logs   *logSwitch
+
+	mu         sync.Mutex
+	lastTested time.Time
+	// lastRead is when the connection test last passed without the write
+	// test, for read_only instances.
+	lastRead time.Time
+}
+
+func (*pooledClient) Destruct() error { return nil }
+
+// testConnection runs TestConnection and TestWriteAccess unless both
+// succeeded within connectionTestTTL, then probes the API schema if the
+// client has not yet. With readOnly set TestWriteAccess is skipped, so a
+// read_only instance can use a key that cannot make changes; that does not
+// count as a test for instances that write.
+func (p *pooledClient) testConnection(ctx context.Context, readOnly bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	last := p.lastTested
+	if readOnly && p.lastRead.After(last) {
+		last = p.lastRead
+	}
+	if !last.IsZero() && time.Since(last) < connectionTestTTL {
+		p.client.logger.Debug("Skipping API connection test, recently verified",
+			zap.Time("last_tested", last))
+		return nil
+	}
+
+	// The test must reach the API even while the shared breaker is open.
+	ctx = bypassBreaker(ctx)
+	if err := p.client.TestConnection(ctx); err != nil {
+		return err
+	}
+	if readOnly {
+		p.client.detectSchema(ctx)
+		p.lastRead = time.Now()
+		return nil
+	}
+	if err := p.client.TestWriteAccess(ctx); err != nil {
+		return err
+	}
+	p.client.detectSchema(ctx)
+	p.lastTested = time.Now()
+	return nil
+}
+
+// clientPoolKey identifies a client by API endpoint, key and egress
+// settings without keeping the key itself in the pool's map.
+func clientPoolKey(endpoint, apiKey, egress string) string {
+	sum := sha256.Sum256([]byte(endpoint + "\x00" + apiKey + "\x00" + egress))
+	return hex.EncodeToString(sum[:])
+}
+
+// acquireClient returns the pooled client for key, calling build with the
+// logger the client is to use to create it if no live instance holds one.
+// A reused client logs through logger from then on, so it follows the
+// log settings of the latest instance. Callers must release it with
+// clientPool.Delete.
+func acquireClient(key string, logger *zap.Logger, build func(*zap.Logger) *TwingateClient) (*pooledClient, error) {
+	val, loaded, err := clientPool.LoadOrNew(key, func() (caddy.Destructor, error) {
+		logs := &logSwitch{}
+		return &pooledClient{client: build(logs.wrap(logger)), logs: logs}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pooled := val.(*pooledClient)
+	if loaded {
+		pooled.logs.set(logger.Core())
+		pooled.client.logger.Debug("Reusing pooled Twingate client")
+	}
+	return pooled, nil
+}
+
+// logSwitch is a zap core writing through whichever core was set last,
+// so a pooled client, and the breaker and rate limit state it keeps, log
+// with the settings of the instance that acquired it last.
+type logSwitch struct {
+	current atomic.Pointer[zapcore.Core]
+	fields  []zapcore.Field
+	parent  *logSwitch
+}
+
+// wrap returns logger writing through the switch, set to logger's core.
+func (s *logSwitch) wrap(logger *zap.Logger) *zap.Logger {
+	s.set(logger.Core())
+	return logger.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core { return s }))
+}
+
+func (s *logSwitch) set(core zapcore.Core) {
+	s.current.Store(&core)
+}
+
+// core returns the core set last, with the fields added by With.
+func (s *logSwitch) core() zapcore.Core {
+	if s.parent != nil {
+		return s.parent.core().With(s.fields)
+	}
+	return *s.current.Load()
+}
+
+func (s *logSwitch) Enabled(level zapcore.Level) bool {
+	return s.core().Enabled(level)
+}
+
+func (s *logSwitch) With(fields []zapcore.Field) zapcore.Core {
+	return &logSwitch{fields: fields, parent: s}
+}
+
+func (s *logSwitch) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return s.core().Check(entry, checked)
+}
+
+func (s *logSwitch) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return s.core().Write(entry, fields)
+}
+
+func (s *logSwitch) Sync() error {
+	return s.core().Sync()
+}
+
+func tenantEndpoint(tenant string) string {
+	return fmt.Sprintf("https://%s.twingate.com/api/graphql/", tenant)
+}
+
+// apiEndpoint returns the configured API endpoint, or the tenant's endpoint
+// if none is set.
+func (t *TwingateApp) apiEndpoint() string {
+	if t.APIEndpoint != "" {
+		return t.APIEndpoint
+	}
+	return tenantEndpoint(t.Tenant)
+}
+
+// validateAPIEndpoint checks that endpoint is an absolute http or https URL.
+func validateAPIEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("must be an http or https URL, got: %s", endpoint)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host: %s", endpoint)
+	}
+	return nil
+}
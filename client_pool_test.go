@@ -0,0 +1,155 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAcquireClientSharesAcrossInstances(t *testing.T) {
+	requests := 0
+	client := newTestClient(t, func(req graphqlRequest) any {
+		requests++
+		if strings.Contains(req.Query, "resourceUpdate") {
+			return map[string]any{"resourceUpdate": map[string]any{"ok": false, "error": "resource not found"}}
+		}
+		return map[string]any{
+			"remoteNetworks": map[string]any{"edges": []any{}},
+		}
+	})
+
+	key := clientPoolKey("acme", "secret", "")
+	builds := 0
+	build := func(*zap.Logger) *TwingateClient {
+		builds++
+		return client
+	}
+
+	first, err := acquireClient(key, zap.NewNop(), build)
+	if err != nil {
+		t.Fatalf("acquireClient() failed: %v", err)
+	}
+	second, err := acquireClient(key, zap.NewNop(), build)
+	if err != nil {
+		t.Fatalf("acquireClient() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = clientPool.Delete(key)
+		_, _ = clientPool.Delete(key)
+	})
+
+	if builds != 1 {
+		t.Errorf("expected client to be built once, got %d", builds)
+	}
+	if first != second {
+		t.Error("expected both instances to share the pooled client")
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := second.testConnection(context.Background(), false); err != nil {
+			t.Fatalf("testConnection() failed: %v", err)
+		}
+	}
+	// The connection test, the write test and the schema probe
+	if requests != 3 {
+		t.Errorf("expected connection and write tests and the schema probe to be cached, got %d API requests", requests)
+	}
+}
+
+func TestAcquireClientLogsWithLatestInstance(t *testing.T) {
+	key := clientPoolKey("acme", "logs", "")
+	build := func(logger *zap.Logger) *TwingateClient {
+		return NewTwingateClient("http://127.0.0.1:0/", "secret", WithLogger(logger))
+	}
+	t.Cleanup(func() {
+		_, _ = clientPool.Delete(key)
+		_, _ = clientPool.Delete(key)
+	})
+
+	firstCore, firstLogs := observer.New(zapcore.DebugLevel)
+	pooled, err := acquireClient(key, zap.New(firstCore), build)
+	if err != nil {
+		t.Fatalf("acquireClient() failed: %v", err)
+	}
+	pooled.client.breaker.logger.Warn("first")
+
+	// The reloaded instance logs only warnings
+	secondCore, secondLogs := observer.New(zapcore.WarnLevel)
+	if _, err := acquireClient(key, zap.New(secondCore), build); err != nil {
+		t.Fatalf("acquireClient() failed: %v", err)
+	}
+	pooled.client.log(context.Background()).Debug("dropped")
+	pooled.client.breaker.logger.Warn("second")
+
+	if firstLogs.Len() != 1 || firstLogs.All()[0].Message != "first" {
+		t.Errorf("first instance logs = %v, want only the entry before the reload", firstLogs.All())
+	}
+	if secondLogs.Len() != 1 || secondLogs.All()[0].Message != "second" {
+		t.Errorf("second instance logs = %v, want the warning after the reload", secondLogs.All())
+	}
+}
+
+func TestClientPoolKey(t *testing.T) {
+	acme := tenantEndpoint("acme")
+	if clientPoolKey(acme, "k1", "") == clientPoolKey(acme, "k2", "") {
+		t.Error("different API keys should not share a pool key")
+	}
+	if clientPoolKey(acme, "k1", "") == clientPoolKey(tenantEndpoint("other"), "k1", "") {
+		t.Error("different tenants should not share a pool key")
+	}
+	if clientPoolKey(acme, "k1", "") == clientPoolKey("http://127.0.0.1:8080/", "k1", "") {
+		t.Error("different API endpoints should not share a pool key")
+	}
+	if clientPoolKey(acme, "k1", "") != clientPoolKey(acme, "k1", "") {
+		t.Error("pool key should be stable")
+	}
+}
+
+func TestAPIEndpoint(t *testing.T) {
+	app := &TwingateApp{Tenant: "acme"}
+	if got := app.apiEndpoint(); got != "https://acme.twingate.com/api/graphql/" {
+		t.Errorf("apiEndpoint() = %q, want the tenant endpoint", got)
+	}
+
+	app.APIEndpoint = "http://127.0.0.1:8080/graphql"
+	if got := app.apiEndpoint(); got != app.APIEndpoint {
+		t.Errorf("apiEndpoint() = %q, want %q", got, app.APIEndpoint)
+	}
+
+	for _, endpoint := range []string{"127.0.0.1:8080", "ftp://example.com/", "http:///graphql"} {
+		if err := validateAPIEndpoint(endpoint); err == nil {
+			t.Errorf("validateAPIEndpoint(%q) should fail", endpoint)
+		}
+	}
+}
+
+func TestPooledClientReadOnlyConnectionTest(t *testing.T) {
+	writes := 0
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if strings.Contains(req.Query, "resourceUpdate") {
+			writes++
+			return errors.New("Permission denied: API key is read-only")
+		}
+		return map[string]any{
+			"remoteNetworks": map[string]any{"edges": []any{}},
+		}
+	})
+	pooled := &pooledClient{client: client}
+
+	if err := pooled.testConnection(context.Background(), true); err != nil {
+		t.Fatalf("a read_only instance should accept a read-only key: %v", err)
+	}
+	if writes != 0 {
+		t.Errorf("a read_only instance should not test write access, got %d write checks", writes)
+	}
+
+	// Another instance sharing the client still needs to write
+	if err := pooled.testConnection(context.Background(), false); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("testConnection() error = %v, want a permission error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package twingate
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddytls"
+)
+
+// ClientTLSConfig is the client certificate presented for mutual TLS to
+// the API endpoint, or to the egress proxy in front of it. Either CertFile
+// and KeyFile or Automate is set.
+type ClientTLSConfig struct {
+	// CertFile and KeyFile are the PEM files of the certificate and its
+	// key. They are read again for every new connection, so a renewed
+	// certificate is used without a config reload.
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+
+	// Automate names a certificate Caddy's tls app manages, by subject.
+	// Caddy obtains and renews it.
+	Automate string `json:"automate,omitempty"`
+}
+
+func (c *ClientTLSConfig) validate() error {
+	files := c.CertFile != "" || c.KeyFile != ""
+	switch {
+	case files && c.Automate != "":
+		return fmt.Errorf("tls_client_auth takes either certificate files or an automate name, not both")
+	case files && (c.CertFile == "" || c.KeyFile == ""):
+		return fmt.Errorf("tls_client_auth needs both a certificate and a key file")
+	case !files && c.Automate == "":
+		return fmt.Errorf("tls_client_auth needs certificate files or an automate name")
+	}
+	return nil
+}
+
+// identity distinguishes clients presenting different certificates in the
+// client pool.
+func (c *ClientTLSConfig) identity() string {
+	if c == nil {
+		return ""
+	}
+	return c.CertFile + "\x00" + c.KeyFile + "\x00" + c.Automate
+}
+
+// clientCertificate returns the function presenting the configured client
+// certificate during TLS handshakes. Certificate files are loaded once up
+// front so a bad path fails provisioning; automated certificates are
+// handed to the tls app to manage.
+func (c *ClientTLSConfig) clientCertificate(ctx caddy.Context) (func(*tls.CertificateRequestInfo) (*tls.Certificate, error), error) {
+	if c.Automate == "" {
+		if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		return func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("loading client certificate: %w", err)
+			}
+			return &cert, nil
+		}, nil
+	}
+
+	tlsAppIface, err := ctx.App("tls")
+	if err != nil {
+		return nil, fmt.Errorf("getting tls app: %w", err)
+	}
+	if err := tlsAppIface.(*caddytls.TLS).Manage([]string{c.Automate}); err != nil {
+		return nil, fmt.Errorf("managing client certificate: %w", err)
+	}
+	return func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		err := fmt.Errorf("no client certificate found for automate name: %s", c.Automate)
+		for _, cert := range caddytls.AllMatchingCertificates(c.Automate) {
+			if err = cri.SupportsCertificate(&cert.Certificate); err == nil {
+				return &cert.Certificate, nil
+			}
+		}
+		return nil, err
+	}, nil
+}
+
+// clientTLSConfig returns the TLS config presenting the configured client
+// certificate, if any, or nil without one. Provision builds it before
+// Validate runs, so the settings are checked here first: files and an
+// automate name together must not load one and manage the other.
+func (t *TwingateApp) clientTLSConfig(ctx caddy.Context) (*tls.Config, error) {
+	if t.TLSClientAuth == nil {
+		return nil, nil
+	}
+	if err := t.TLSClientAuth.validate(); err != nil {
+		return nil, err
+	}
+
+	getCertificate, err := t.TLSClientAuth.clientCertificate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tls_client_auth: %w", err)
+	}
+	return &tls.Config{GetClientCertificate: getCertificate}, nil
+}
@@ -0,0 +1,159 @@
+package twingate
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// writeClientCert writes a self-signed certificate for name and its key to
+// dir, returning their paths.
+func writeClientCert(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestUnmarshalCaddyfile_TLSClientAuth(t *testing.T) {
+	tests := []struct {
+		option  string
+		want    *ClientTLSConfig
+		wantErr bool
+	}{
+		{option: "tls_client_auth /etc/client.crt /etc/client.key", want: &ClientTLSConfig{CertFile: "/etc/client.crt", KeyFile: "/etc/client.key"}},
+		{option: "tls_client_auth egress.example.com", want: &ClientTLSConfig{Automate: "egress.example.com"}},
+		{option: "tls_client_auth", wantErr: true},
+		{option: "tls_client_auth a b c", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.option, func(t *testing.T) {
+			app := &TwingateApp{}
+			err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n tenant acme\n " + tt.option + "\n}"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalCaddyfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *app.TLSClientAuth != *tt.want {
+				t.Errorf("TLSClientAuth = %+v, want %+v", app.TLSClientAuth, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientTLSConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ClientTLSConfig
+		wantErr bool
+	}{
+		{name: "files", config: ClientTLSConfig{CertFile: "c", KeyFile: "k"}},
+		{name: "automate", config: ClientTLSConfig{Automate: "egress.example.com"}},
+		{name: "empty", wantErr: true},
+		{name: "certificate without key", config: ClientTLSConfig{CertFile: "c"}, wantErr: true},
+		{name: "files and automate", config: ClientTLSConfig{CertFile: "c", KeyFile: "k", Automate: "a"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientTLSConfigValidatesFirst(t *testing.T) {
+	// Conflicting settings fail before either certificate is loaded or
+	// handed to the tls app, which a zero caddy.Context has none of
+	dir := t.TempDir()
+	certFile, keyFile := writeClientCert(t, dir, "client")
+	app := &TwingateApp{TLSClientAuth: &ClientTLSConfig{CertFile: certFile, KeyFile: keyFile, Automate: "egress.example.com"}}
+	if _, err := app.clientTLSConfig(caddy.Context{}); err == nil || !strings.Contains(err.Error(), "not both") {
+		t.Errorf("clientTLSConfig() error = %v, want the conflict rejected", err)
+	}
+
+	app.TLSClientAuth = &ClientTLSConfig{CertFile: certFile}
+	if _, err := app.clientTLSConfig(caddy.Context{}); err == nil || !strings.Contains(err.Error(), "both a certificate and a key") {
+		t.Errorf("clientTLSConfig() error = %v, want the missing key rejected", err)
+	}
+}
+
+func TestClientTLSConfig_CertificateFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeClientCert(t, dir, "first")
+	config := &ClientTLSConfig{CertFile: certFile, KeyFile: keyFile}
+
+	getCertificate, err := config.clientCertificate(caddy.Context{})
+	if err != nil {
+		t.Fatalf("clientCertificate() failed: %v", err)
+	}
+	first, err := getCertificate(nil)
+	if err != nil {
+		t.Fatalf("getting the certificate failed: %v", err)
+	}
+
+	// A renewed certificate is used for the next connection
+	writeClientCert(t, dir, "second")
+	second, err := getCertificate(nil)
+	if err != nil {
+		t.Fatalf("getting the renewed certificate failed: %v", err)
+	}
+	if bytes.Equal(first.Certificate[0], second.Certificate[0]) {
+		t.Error("the renewed certificate should be read from the files")
+	}
+
+	// A missing pair fails up front
+	missing := &ClientTLSConfig{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile}
+	if _, err := missing.clientCertificate(caddy.Context{}); err == nil {
+		t.Error("clientCertificate() should fail for a missing certificate file")
+	}
+}
+
+func TestClientPoolKey_ClientCertificate(t *testing.T) {
+	files := &ClientTLSConfig{CertFile: "c", KeyFile: "k"}
+	if clientPoolKey("acme", "k1", files.identity()) == clientPoolKey("acme", "k1", "") {
+		t.Error("clients presenting a certificate should not share the pool entry of those without")
+	}
+	var none *ClientTLSConfig
+	if none.identity() != "" {
+		t.Errorf("identity() of no config = %q, want empty", none.identity())
+	}
+}
@@ -0,0 +1,24 @@
+// Command twingate-syncer runs the Twingate sync out of process, for
+// deployments that run a stock Caddy without the plugin. It is Caddy with
+// only the Twingate app and the modules it needs: its config holds a
+// twingate app whose routes_from option points at the other Caddy's
+// config, and it syncs whenever that config changes.
+//
+//	twingate-syncer run --config /etc/twingate-syncer/Caddyfile
+package main
+
+import (
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+
+	// Import the modules the Twingate app uses besides the HTTP app
+	_ "github.com/caddyserver/caddy/v2/modules/caddyevents"
+	_ "github.com/caddyserver/caddy/v2/modules/filestorage"
+	_ "github.com/caddyserver/caddy/v2/modules/logging"
+
+	// Import the Twingate plugin
+	_ "github.com/EngineeredDev/twingate-caddy"
+)
+
+func main() {
+	caddycmd.Main()
+}
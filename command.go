@@ -0,0 +1,476 @@
+package twingate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/caddyserver/caddy/v2"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "twingate",
+		Short: "Commands for the Twingate plugin",
+		Long: `
+Inspects the Twingate app of a running Caddy instance through its admin API.
+The admin address is taken from --address, or from the config given with
+--config, or defaults to localhost:2019.
+`,
+		CobraFunc: func(cmd *cobra.Command) {
+			exportCmd := &cobra.Command{
+				Use:   "export [--format terraform|json] [--address <admin>] [--config <path> [--adapter <name>]]",
+				Short: "Exports the resources the plugin manages",
+				Long: `
+Renders the resources discovered by the running instance as twingate_resource
+Terraform blocks, or as a JSON manifest, for migrating to infrastructure as
+code or auditing what the plugin manages. Nothing is changed in Twingate.
+`,
+				RunE: caddycmd.WrapCommandFuncForCobra(cmdExport),
+			}
+			exportCmd.Flags().StringP("format", "f", "json", "Output format: terraform or json")
+			addAdminFlags(exportCmd)
+			cmd.AddCommand(exportCmd)
+
+			statusCmd := &cobra.Command{
+				Use:   "status [--format text|json] [--address <admin>] [--config <path> [--adapter <name>]]",
+				Short: "Shows what the next sync would change",
+				Long: `
+Previews the next sync of the running instance: the remote networks and
+resources it would create, the resources it would update and why, and, when
+resource cleanup is enabled, the resources it would delete. Nothing is
+changed in Twingate.
+`,
+				RunE: caddycmd.WrapCommandFuncForCobra(cmdStatus),
+			}
+			statusCmd.Flags().StringP("format", "f", "text", "Output format: text or json")
+			addAdminFlags(statusCmd)
+			cmd.AddCommand(statusCmd)
+
+			undoCmd := &cobra.Command{
+				Use:   "undo-delete <name>... | --all [--since <duration>] [--address <admin>] [--config <path> [--adapter <name>]]",
+				Short: "Recreates resources deleted by the plugin",
+				Long: `
+Recreates resources the running instance deleted, from the journal it keeps
+of their name, address, alias, remote network and the groups it granted
+access to. Given names, the most recent deletion of each is undone; with
+--all, every journaled deletion, or those within --since. Restored resources
+get new IDs and are deleted again by the next cleanup unless the
+configuration wants them.
+`,
+				RunE: caddycmd.WrapCommandFuncForCobra(cmdUndoDelete),
+			}
+			undoCmd.Flags().Bool("all", false, "Undo all journaled deletions")
+			undoCmd.Flags().String("since", "", "With --all, only undo deletions within this duration, such as 1h")
+			addAdminFlags(undoCmd)
+			cmd.AddCommand(undoCmd)
+
+			cleanupCmd := &cobra.Command{
+				Use:   "cleanup [--yes] [--address <admin>] [--config <path> [--adapter <name>]]",
+				Short: "Deletes stale resources after confirmation",
+				Long: `
+Lists the resources the running instance considers stale: those in the remote
+networks it syncs to that no discovered host wants, within the cleanup scope.
+After confirmation, or right away with --yes, deletes them the same way an
+automatic cleanup does, journaling each deletion. Only the listed resources
+are deleted. Resource cleanup does not need to be enabled.
+`,
+				RunE: caddycmd.WrapCommandFuncForCobra(cmdCleanup),
+			}
+			cleanupCmd.Flags().BoolP("yes", "y", false, "Delete without asking for confirmation")
+			addAdminFlags(cleanupCmd)
+			cmd.AddCommand(cleanupCmd)
+
+			approveCmd := &cobra.Command{
+				Use:   "approve [<id>...] [--yes] [--address <admin>] [--config <path> [--adapter <name>]]",
+				Short: "Approves the sync plans held for approval",
+				Long: `
+With approval_required set, a sync that would change the tenant is held as a
+pending plan. Without IDs, lists the pending plans and, after confirmation,
+or right away with --yes, runs the syncs that apply them. Given IDs, runs
+those plans without asking. A plan no longer matching the tenant is not
+applied; the changes found instead are held as a new pending plan.
+`,
+				RunE: caddycmd.WrapCommandFuncForCobra(cmdApprove),
+			}
+			approveCmd.Flags().BoolP("yes", "y", false, "Approve without asking for confirmation")
+			addAdminFlags(approveCmd)
+			cmd.AddCommand(approveCmd)
+
+			versionCmd := &cobra.Command{
+				Use:   "version [--format text|json]",
+				Short: "Prints the version of the plugin",
+				Long: `
+Prints the version and git commit of the Twingate plugin built into this
+binary, and the Caddy and Go versions it was built with, to include when
+reporting a bug. The running instance is not contacted.
+`,
+				RunE: caddycmd.WrapCommandFuncForCobra(cmdVersion),
+			}
+			versionCmd.Flags().StringP("format", "f", "text", "Output format: text or json")
+			cmd.AddCommand(versionCmd)
+		},
+	})
+}
+
+// addAdminFlags adds the flags used to locate the admin API.
+func addAdminFlags(cmd *cobra.Command) {
+	cmd.Flags().String("address", "", "The address of Caddy's admin API")
+	cmd.Flags().StringP("config", "c", "", "Configuration file to read the admin address from")
+	cmd.Flags().StringP("adapter", "a", "", "Name of config adapter to apply")
+}
+
+// adminRequest sends a request to the admin API located by the admin flags.
+func adminRequest(fl caddycmd.Flags, method, uri string, body io.Reader) (*http.Response, error) {
+	adminAddr, err := caddycmd.DetermineAdminAPIAddress(fl.String("address"), nil, fl.String("config"), fl.String("adapter"))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't determine admin API address: %v", err)
+	}
+	return caddycmd.AdminAPIRequest(adminAddr, method, uri, nil, body)
+}
+
+func cmdExport(fl caddycmd.Flags) (int, error) {
+	format := fl.String("format")
+	if format != "json" && format != "terraform" {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("unsupported format %q, must be terraform or json", format)
+	}
+
+	resp, err := adminRequest(fl, http.MethodGet, "/twingate/mappings", nil)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	defer resp.Body.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding manifest: %v", err)
+	}
+
+	if format == "terraform" {
+		err = renderTerraform(os.Stdout, &manifest)
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(manifest)
+	}
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	return caddy.ExitCodeSuccess, nil
+}
+
+func cmdStatus(fl caddycmd.Flags) (int, error) {
+	format := fl.String("format")
+	if format != "text" && format != "json" {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("unsupported format %q, must be text or json", format)
+	}
+
+	resp, err := adminRequest(fl, http.MethodGet, "/twingate/summary", nil)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	defer resp.Body.Close()
+
+	var summary SyncSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding summary: %v", err)
+	}
+
+	if format == "text" {
+		err = renderSummary(os.Stdout, &summary)
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(summary)
+	}
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	return caddy.ExitCodeSuccess, nil
+}
+
+func cmdUndoDelete(fl caddycmd.Flags) (int, error) {
+	req := UndoDeleteRequest{
+		Names: fl.Args(),
+		All:   fl.Bool("all"),
+		Since: fl.String("since"),
+	}
+	if (len(req.Names) > 0) == req.All {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("give resource names or --all")
+	}
+	if req.Since != "" && !req.All {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("--since requires --all")
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	resp, err := adminRequest(fl, http.MethodPost, "/twingate/undo-delete", bytes.NewReader(body))
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Restored []RestoredResource `json:"restored"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding result: %v", err)
+	}
+
+	if len(result.Restored) == 0 {
+		fmt.Println("No journaled deletions matched")
+		return caddy.ExitCodeSuccess, nil
+	}
+	failed := 0
+	for _, res := range result.Restored {
+		if res.Error != "" {
+			fmt.Printf("failed   %s: %s\n", res.Name, res.Error)
+			failed++
+			continue
+		}
+		fmt.Printf("restored %s (%s, was %s)\n", res.Name, res.ID, res.OldID)
+	}
+	if failed > 0 {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("%d of %d resources could not be restored", failed, len(result.Restored))
+	}
+	return caddy.ExitCodeSuccess, nil
+}
+
+func cmdCleanup(fl caddycmd.Flags) (int, error) {
+	stale, err := requestCleanup(fl, CleanupRequest{DryRun: true})
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	if len(stale) == 0 {
+		fmt.Println("No stale resources")
+		return caddy.ExitCodeSuccess, nil
+	}
+
+	if err := renderCleanup(os.Stdout, stale); err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	if !fl.Bool("yes") && !confirmCleanup(os.Stdin, os.Stdout, len(stale)) {
+		fmt.Println("Cleanup cancelled, nothing was deleted")
+		return caddy.ExitCodeSuccess, nil
+	}
+
+	ids := make([]string, len(stale))
+	for i, res := range stale {
+		ids[i] = res.ID
+	}
+	cleaned, err := requestCleanup(fl, CleanupRequest{IDs: ids})
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	failed := 0
+	for _, res := range cleaned {
+		switch {
+		case res.Error != "":
+			fmt.Printf("failed  %s: %s\n", res.Name, res.Error)
+			failed++
+		case res.Deleted:
+			fmt.Printf("deleted %s (%s)\n", res.Name, res.ID)
+		}
+	}
+	if failed > 0 {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("%d of %d resources could not be deleted", failed, len(cleaned))
+	}
+	return caddy.ExitCodeSuccess, nil
+}
+
+// requestCleanup sends a cleanup request to the admin API and returns the
+// stale resources it found.
+func requestCleanup(fl caddycmd.Flags, req CleanupRequest) ([]CleanedResource, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := adminRequest(fl, http.MethodPost, "/twingate/cleanup", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Resources []CleanedResource `json:"resources"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding result: %v", err)
+	}
+	return result.Resources, nil
+}
+
+// renderCleanup writes the stale resources a cleanup would delete as a
+// table.
+func renderCleanup(w io.Writer, stale []CleanedResource) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d stale resources:\n", len(stale))
+	for _, res := range stale {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", res.Tenant, res.Name, res.ID, res.RemoteNetwork, res.Address)
+	}
+	return tw.Flush()
+}
+
+// confirmCleanup asks whether to delete count stale resources and reports
+// whether the answer read from in was yes. No answer is a no.
+func confirmCleanup(in io.Reader, out io.Writer, count int) bool {
+	fmt.Fprintf(out, "Delete these %d resources? [y/N] ", count)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func cmdApprove(fl caddycmd.Flags) (int, error) {
+	ids := fl.Args()
+	if len(ids) == 0 {
+		resp, err := adminRequest(fl, http.MethodGet, "/twingate/approve", nil)
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, err
+		}
+		defer resp.Body.Close()
+
+		var result struct {
+			Pending []*PendingPlan `json:"pending"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding pending plans: %v", err)
+		}
+		if len(result.Pending) == 0 {
+			fmt.Println("No plans pending approval")
+			return caddy.ExitCodeSuccess, nil
+		}
+
+		if err := renderPendingPlans(os.Stdout, result.Pending); err != nil {
+			return caddy.ExitCodeFailedStartup, err
+		}
+		if !fl.Bool("yes") && !confirmApprove(os.Stdin, os.Stdout, len(result.Pending)) {
+			fmt.Println("Approval cancelled, nothing was changed")
+			return caddy.ExitCodeSuccess, nil
+		}
+		for _, plan := range result.Pending {
+			ids = append(ids, plan.ID)
+		}
+	}
+
+	body, err := json.Marshal(ApproveRequest{IDs: ids})
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	resp, err := adminRequest(fl, http.MethodPost, "/twingate/approve", bytes.NewReader(body))
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Approved []ApprovedPlan `json:"approved"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding result: %v", err)
+	}
+
+	if len(result.Approved) == 0 {
+		fmt.Println("No pending plans matched")
+		return caddy.ExitCodeSuccess, nil
+	}
+	failed := 0
+	for _, plan := range result.Approved {
+		switch {
+		case plan.Applied:
+			fmt.Printf("applied %s (tenant %s)\n", plan.ID, plan.Tenant)
+		case plan.Pending != nil:
+			fmt.Printf("held    %s: the tenant changed, plan %s is pending instead\n", plan.ID, plan.Pending.ID)
+			failed++
+		default:
+			fmt.Printf("failed  %s: %s\n", plan.ID, plan.Error)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("%d of %d plans were not applied", failed, len(result.Approved))
+	}
+	return caddy.ExitCodeSuccess, nil
+}
+
+// renderPendingPlans writes each pending plan as a table of its resource
+// actions.
+func renderPendingPlans(w io.Writer, plans []*PendingPlan) error {
+	var b strings.Builder
+	for i, plan := range plans {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		title := fmt.Sprintf("Plan %s for tenant %s", plan.ID, plan.Tenant)
+		if plan.Label != "" {
+			title = fmt.Sprintf("Plan %s for tenant block %s (tenant %s)", plan.ID, plan.Label, plan.Tenant)
+		}
+		writeSummary(&b, plan.Plan, title)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func confirmApprove(in io.Reader, out io.Writer, count int) bool {
+	fmt.Fprintf(out, "Apply these %d plans? [y/N] ", count)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func cmdVersion(fl caddycmd.Flags) (int, error) {
+	format := fl.String("format")
+	if format != "text" && format != "json" {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("unsupported format %q, must be text or json", format)
+	}
+
+	var err error
+	if format == "text" {
+		err = renderVersion(os.Stdout, pluginBuild())
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(pluginBuild())
+	}
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	return caddy.ExitCodeSuccess, nil
+}
+
+// renderVersion writes the build info of the plugin as a list.
+func renderVersion(w io.Writer, build buildInfo) error {
+	commit := build.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	if build.Modified {
+		commit += " (modified)"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "twingate-caddy\t%s\n", build.Version)
+	fmt.Fprintf(tw, "commit\t%s\n", commit)
+	fmt.Fprintf(tw, "caddy\t%s\n", build.Caddy)
+	fmt.Fprintf(tw, "go\t%s\n", build.Go)
+	return tw.Flush()
+}
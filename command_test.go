@@ -0,0 +1,50 @@
+package twingate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfirmCleanup(t *testing.T) {
+	for input, want := range map[string]bool{
+		"y\n":   true,
+		"YES\n": true,
+		"n\n":   false,
+		"\n":    false,
+		"":      false,
+	} {
+		var out strings.Builder
+		if got := confirmCleanup(strings.NewReader(input), &out, 3); got != want {
+			t.Errorf("confirmCleanup(%q) = %v, want %v", input, got, want)
+		}
+		if !strings.Contains(out.String(), "Delete these 3 resources?") {
+			t.Errorf("unexpected prompt %q", out.String())
+		}
+	}
+}
+
+func TestRenderCleanup(t *testing.T) {
+	var out strings.Builder
+	stale := []CleanedResource{
+		{Tenant: "acme", ID: "r1", Name: "old.example.com", Address: "10.0.0.1", RemoteNetwork: "Caddy-Managed"},
+	}
+	if err := renderCleanup(&out, stale); err != nil {
+		t.Fatal(err)
+	}
+	want := "1 stale resources:\n  acme  old.example.com  r1  Caddy-Managed  10.0.0.1\n"
+	if out.String() != want {
+		t.Errorf("renderCleanup() = %q, want %q", out.String(), want)
+	}
+}
+
+func TestRenderVersion(t *testing.T) {
+	var out strings.Builder
+	build := buildInfo{Version: "v1.4.0", Commit: "0123456789ab", Modified: true, Caddy: "v2.8.4", Go: "go1.25.0"}
+	if err := renderVersion(&out, build); err != nil {
+		t.Fatal(err)
+	}
+	want := "twingate-caddy  v1.4.0\ncommit          0123456789ab (modified)\ncaddy           v2.8.4\ngo              go1.25.0\n"
+	if out.String() != want {
+		t.Errorf("renderVersion() = %q, want %q", out.String(), want)
+	}
+}
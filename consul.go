@@ -0,0 +1,373 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(ConsulDiscoverer{})
+}
+
+const (
+	// DefaultConsulAddress is the Consul HTTP API of the local agent.
+	DefaultConsulAddress = "http://127.0.0.1:8500"
+
+	// DefaultConsulTokenEnv is the environment variable the Consul ACL
+	// token is read from unless token_env names another.
+	DefaultConsulTokenEnv = "CONSUL_HTTP_TOKEN"
+
+	// DefaultServiceTag marks the services published to Twingate.
+	DefaultServiceTag = "twingate"
+)
+
+// Service meta keys read by ConsulDiscoverer. Consul meta keys cannot
+// contain dots, so labels use an underscore prefix.
+const (
+	consulMetaHost          = "twingate_host"
+	consulMetaGroups        = "twingate_groups"
+	consulMetaRemoteNetwork = "twingate_remote_network"
+	consulMetaLabelPrefix   = "twingate_label_"
+)
+
+// ConsulDiscoverer publishes the services registered in Consul's catalog
+// with a tag, for services that are not behind a Caddy route. A service is
+// named by its twingate_host meta, or by its name under HostSuffix, and
+// reached at its own address unless ViaCaddy is set. twingate_groups (comma
+// separated), twingate_remote_network and twingate_label_<key> meta set
+// its groups, remote network and labels.
+type ConsulDiscoverer struct {
+	// Address is the Consul HTTP API. Defaults to http://127.0.0.1:8500.
+	Address string `json:"address,omitempty"`
+
+	// Datacenter is the datacenter whose catalog is read. Defaults to
+	// the agent's.
+	Datacenter string `json:"datacenter,omitempty"`
+
+	// TokenEnv names the environment variable holding the ACL token.
+	// Defaults to CONSUL_HTTP_TOKEN; without a token, requests are
+	// anonymous.
+	TokenEnv string `json:"token_env,omitempty"`
+
+	// ServiceTag is the tag of the services to publish. Defaults to
+	// twingate.
+	ServiceTag string `json:"service_tag,omitempty"`
+
+	// HostSuffix names services without a twingate_host meta
+	// <service>.<suffix>. Without it, such services are skipped.
+	HostSuffix string `json:"host_suffix,omitempty"`
+
+	// ViaCaddy points the resources at Caddy, for services Caddy proxies
+	// without a route the plugin discovers. Otherwise they point at the
+	// service's own address, or at its Consul DNS name,
+	// <service>.service.consul, when its instances have several.
+	ViaCaddy bool `json:"via_caddy,omitempty"`
+
+	// RemoteNetwork and Groups apply to services that set none.
+	RemoteNetwork string   `json:"remote_network,omitempty"`
+	Groups        []string `json:"groups,omitempty"`
+
+	logger *zap.Logger
+}
+
+func (ConsulDiscoverer) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "twingate.discoverers.consul",
+		New: func() caddy.Module { return new(ConsulDiscoverer) },
+	}
+}
+
+func (c *ConsulDiscoverer) Provision(ctx caddy.Context) error {
+	c.logger = ctx.Logger()
+	return nil
+}
+
+func (c *ConsulDiscoverer) Validate() error {
+	if c.Address != "" {
+		if err := validateAPIEndpoint(c.Address); err != nil {
+			return fmt.Errorf("consul address: %w", err)
+		}
+	}
+	if c.HostSuffix != "" && !isDNSName(c.HostSuffix) {
+		return fmt.Errorf("consul host_suffix '%s' is not a valid DNS name", c.HostSuffix)
+	}
+	return nil
+}
+
+// consulService is an instance of a service in Consul's catalog.
+type consulService struct {
+	Address        string            `json:"Address"`
+	ServiceName    string            `json:"ServiceName"`
+	ServiceAddress string            `json:"ServiceAddress"`
+	ServicePort    int               `json:"ServicePort"`
+	ServiceMeta    map[string]string `json:"ServiceMeta"`
+}
+
+// address returns the instance's address, falling back to its node's.
+func (s consulService) address() string {
+	if s.ServiceAddress != "" {
+		return s.ServiceAddress
+	}
+	return s.Address
+}
+
+func (c *ConsulDiscoverer) DiscoverEndpoints(ctx context.Context) ([]Endpoint, error) {
+	var services map[string][]string
+	if err := c.get(ctx, "/v1/catalog/services", nil, &services); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(services))
+	for name, tags := range services {
+		if slices.Contains(tags, c.serviceTag()) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var endpoints []Endpoint
+	for _, name := range names {
+		var instances []consulService
+		query := url.Values{"tag": {c.serviceTag()}}
+		if err := c.get(ctx, "/v1/catalog/service/"+url.PathEscape(name), query, &instances); err != nil {
+			return nil, err
+		}
+		if ep, ok := c.endpoint(name, instances); ok {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	return endpoints, nil
+}
+
+// endpoint returns the endpoint of a service from its instances. The
+// meta of the first instance that sets a key applies.
+func (c *ConsulDiscoverer) endpoint(name string, instances []consulService) (Endpoint, bool) {
+	meta := make(map[string]string)
+	var addrs, upstreams []string
+	for _, inst := range instances {
+		for key, value := range inst.ServiceMeta {
+			if _, ok := meta[key]; !ok {
+				meta[key] = value
+			}
+		}
+		if addr := inst.address(); addr != "" {
+			addrs = append(addrs, addr)
+			upstreams = append(upstreams, net.JoinHostPort(addr, strconv.Itoa(inst.ServicePort)))
+		}
+	}
+
+	host := meta[consulMetaHost]
+	if host == "" && c.HostSuffix != "" {
+		host = name + "." + c.HostSuffix
+	}
+	if host == "" {
+		c.log().Debug("Skipping Consul service without a host",
+			zap.String("service", name))
+		return Endpoint{}, false
+	}
+	if !isDNSName(host) {
+		c.log().Warn("Skipping Consul service whose host is not a valid DNS name",
+			zap.String("service", name),
+			zap.String("host", host))
+		return Endpoint{}, false
+	}
+
+	ep := Endpoint{
+		Host:          host,
+		RemoteNetwork: c.RemoteNetwork,
+		Groups:        c.Groups,
+		Upstreams:     uniqueSorted(upstreams),
+	}
+	if network := meta[consulMetaRemoteNetwork]; network != "" {
+		ep.RemoteNetwork = network
+	}
+	if groups := splitList(meta[consulMetaGroups]); len(groups) > 0 {
+		ep.Groups = groups
+	}
+	for key, value := range meta {
+		if label, ok := strings.CutPrefix(key, consulMetaLabelPrefix); ok && label != "" {
+			if ep.Labels == nil {
+				ep.Labels = make(map[string]string)
+			}
+			ep.Labels[label] = value
+		}
+	}
+
+	if !c.ViaCaddy {
+		switch addrs = uniqueSorted(addrs); len(addrs) {
+		case 0:
+			c.log().Warn("Skipping Consul service without an address",
+				zap.String("service", name))
+			return Endpoint{}, false
+		case 1:
+			ep.Address = addrs[0]
+		default:
+			ep.Address = name + ".service.consul"
+		}
+		if err := validateCaddyAddress(ep.Address); err != nil {
+			c.log().Warn("Skipping Consul service with an unusable address",
+				zap.String("service", name),
+				zap.Error(err))
+			return Endpoint{}, false
+		}
+	}
+	return ep, true
+}
+
+// get decodes the response of a GET request to the Consul API into v.
+func (c *ConsulDiscoverer) get(ctx context.Context, path string, query url.Values, v any) error {
+	if c.Datacenter != "" {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("dc", c.Datacenter)
+	}
+	u := strings.TrimSuffix(c.address(), "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if token := os.Getenv(c.tokenEnv()); token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	resp, err := egressHTTPClient(ctx).Do(req)
+	if err != nil {
+		return fmt.Errorf("consul: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("consul %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("consul %s: decoding response: %w", path, err)
+	}
+	return nil
+}
+
+func (c *ConsulDiscoverer) address() string {
+	if c.Address != "" {
+		return c.Address
+	}
+	return DefaultConsulAddress
+}
+
+func (c *ConsulDiscoverer) tokenEnv() string {
+	if c.TokenEnv != "" {
+		return c.TokenEnv
+	}
+	return DefaultConsulTokenEnv
+}
+
+func (c *ConsulDiscoverer) serviceTag() string {
+	if c.ServiceTag != "" {
+		return c.ServiceTag
+	}
+	return DefaultServiceTag
+}
+
+func (c *ConsulDiscoverer) log() *zap.Logger {
+	if c.logger == nil {
+		return zap.NewNop()
+	}
+	return c.logger
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// UnmarshalCaddyfile sets up the discoverer from Caddyfile tokens. Syntax:
+//
+//	discoverer consul [<address>] {
+//	    address        <url>
+//	    datacenter     <name>
+//	    token_env      <variable>
+//	    service_tag    <tag>
+//	    host_suffix    <domain>
+//	    via_caddy
+//	    remote_network <name>
+//	    groups         <names...>
+//	}
+func (c *ConsulDiscoverer) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // discoverer name
+	if d.NextArg() {
+		c.Address = d.Val()
+	}
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		switch d.Val() {
+		case "address", "datacenter", "token_env", "service_tag", "host_suffix", "remote_network":
+			opt := d.Val()
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			switch opt {
+			case "address":
+				c.Address = d.Val()
+			case "datacenter":
+				c.Datacenter = d.Val()
+			case "token_env":
+				c.TokenEnv = d.Val()
+			case "service_tag":
+				c.ServiceTag = d.Val()
+			case "host_suffix":
+				c.HostSuffix = d.Val()
+			case "remote_network":
+				c.RemoteNetwork = d.Val()
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+		case "via_caddy":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.ViaCaddy = true
+		case "groups":
+			groups := d.RemainingArgs()
+			if len(groups) == 0 {
+				return d.ArgErr()
+			}
+			c.Groups = append(c.Groups, groups...)
+		default:
+			return d.Errf("unrecognized consul option: %s", d.Val())
+		}
+	}
+	return c.Validate()
+}
+
+var (
+	_ Discoverer            = (*ConsulDiscoverer)(nil)
+	_ caddy.Provisioner     = (*ConsulDiscoverer)(nil)
+	_ caddy.Validator       = (*ConsulDiscoverer)(nil)
+	_ caddyfile.Unmarshaler = (*ConsulDiscoverer)(nil)
+)
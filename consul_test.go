@@ -0,0 +1,159 @@
+package twingate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+// consulServer serves a catalog of three services, two of them tagged
+// twingate, and records the ACL token of the last request.
+func consulServer(t *testing.T, token *string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*token = r.Header.Get("X-Consul-Token")
+		if r.URL.Query().Get("dc") != "dc1" {
+			http.Error(w, "unknown datacenter", http.StatusInternalServerError)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/catalog/services":
+			w.Write([]byte(`{"api": ["twingate", "v2"], "db": ["primary"], "grafana": ["twingate"]}`))
+		case "/v1/catalog/service/api":
+			w.Write([]byte(`[
+				{"Address": "10.0.0.21", "ServiceAddress": "", "ServicePort": 8080,
+				 "ServiceMeta": {"twingate_host": "api.example.com", "twingate_groups": "Engineering, Ops", "twingate_label_team": "core"}},
+				{"Address": "10.0.0.22", "ServiceAddress": "10.0.1.22", "ServicePort": 8080, "ServiceMeta": {}}
+			]`))
+		case "/v1/catalog/service/grafana":
+			w.Write([]byte(`[{"Address": "10.0.0.30", "ServicePort": 3000, "ServiceMeta": {"twingate_remote_network": "Monitoring"}}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestConsulDiscoverEndpoints(t *testing.T) {
+	var token string
+	server := consulServer(t, &token)
+	t.Setenv("TEST_CONSUL_TOKEN", "secret")
+
+	c := &ConsulDiscoverer{
+		Address:    server.URL,
+		Datacenter: "dc1",
+		TokenEnv:   "TEST_CONSUL_TOKEN",
+		HostSuffix: "svc.example.com",
+		ViaCaddy:   true,
+		Groups:     []string{"Everyone"},
+		logger:     zap.NewNop(),
+	}
+	endpoints, err := c.DiscoverEndpoints(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverEndpoints() error = %v", err)
+	}
+	if token != "secret" {
+		t.Errorf("token = %q, want the one from token_env", token)
+	}
+	if len(endpoints) != 2 {
+		t.Fatalf("endpoints = %+v, want the two tagged services", endpoints)
+	}
+
+	api := endpoints[0]
+	if api.Host != "api.example.com" || api.Address != "" {
+		t.Errorf("api = %+v, want its meta host reached through Caddy", api)
+	}
+	if !slices.Equal(api.Groups, []string{"Engineering", "Ops"}) || api.Labels["team"] != "core" {
+		t.Errorf("api groups = %v, labels = %v", api.Groups, api.Labels)
+	}
+	if want := []string{"10.0.0.21:8080", "10.0.1.22:8080"}; !slices.Equal(api.Upstreams, want) {
+		t.Errorf("api upstreams = %v, want %v", api.Upstreams, want)
+	}
+
+	grafana := endpoints[1]
+	if grafana.Host != "grafana.svc.example.com" || grafana.RemoteNetwork != "Monitoring" || !slices.Equal(grafana.Groups, []string{"Everyone"}) {
+		t.Errorf("grafana = %+v", grafana)
+	}
+
+	// Without a host suffix, services without a twingate_host are skipped
+	c.HostSuffix = ""
+	if endpoints, err := c.DiscoverEndpoints(context.Background()); err != nil || len(endpoints) != 1 {
+		t.Errorf("DiscoverEndpoints() = %+v, %v, want only api", endpoints, err)
+	}
+
+	// Service names that do not make a DNS name are skipped too
+	c.HostSuffix = "svc.example.com"
+	if _, ok := c.endpoint("my_service", []consulService{{Address: "10.0.0.40"}}); ok {
+		t.Error("expected my_service.svc.example.com to be skipped")
+	}
+	if _, ok := c.endpoint("api", []consulService{{Address: "10.0.0.40", ServiceMeta: map[string]string{"twingate_host": "api example"}}}); ok {
+		t.Error("expected an invalid twingate_host to be skipped")
+	}
+
+	c.Datacenter = "dc2"
+	if _, err := c.DiscoverEndpoints(context.Background()); err == nil {
+		t.Error("expected a Consul error to fail discovery")
+	}
+}
+
+func TestConsulDiscoverEndpoints_Direct(t *testing.T) {
+	var token string
+	server := consulServer(t, &token)
+
+	c := &ConsulDiscoverer{Address: server.URL, Datacenter: "dc1", HostSuffix: "svc.example.com"}
+	endpoints, err := c.DiscoverEndpoints(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverEndpoints() error = %v", err)
+	}
+	if token != "" {
+		t.Errorf("token = %q, want none without the environment variable", token)
+	}
+	if len(endpoints) != 2 || endpoints[0].Address != "api.service.consul" || endpoints[1].Address != "10.0.0.30" {
+		t.Errorf("endpoints = %+v, want the Consul DNS name for api and grafana's address", endpoints)
+	}
+
+	// Direct endpoints keep their address rather than Caddy's
+	app := &TwingateApp{CaddyAddress: "10.0.0.5", logger: zap.NewNop()}
+	mappings := app.endpointMappings(endpoints[1], []string{"10.0.0.5"})
+	if len(mappings) != 1 || mappings[0].Address != "10.0.0.30" || mappings[0].Alias == nil {
+		t.Errorf("mappings = %+v", mappings)
+	}
+}
+
+func TestConsulDiscovererUnmarshalCaddyfile(t *testing.T) {
+	var c ConsulDiscoverer
+	err := c.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`consul http://consul.internal:8500 {
+		datacenter dc1
+		service_tag expose
+		host_suffix svc.example.com
+		via_caddy
+		groups Engineering
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Address != "http://consul.internal:8500" || c.Datacenter != "dc1" || c.serviceTag() != "expose" || c.HostSuffix != "svc.example.com" || !c.ViaCaddy {
+		t.Errorf("unexpected config: %+v", c)
+	}
+	if c.tokenEnv() != DefaultConsulTokenEnv {
+		t.Errorf("tokenEnv() = %q", c.tokenEnv())
+	}
+
+	for _, input := range []string{
+		"consul a b",
+		"consul consul.internal:8500",
+		"consul {\n\t\thost_suffix not_a_domain!\n\t}",
+		"consul {\n\t\tvia_caddy yes\n\t}",
+		"consul {\n\t\tbogus\n\t}",
+	} {
+		if err := (&ConsulDiscoverer{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
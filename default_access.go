@@ -0,0 +1,71 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// DefaultAccess is the access given to every resource the plugin creates.
+// It is applied only when a resource is created and never reconciled, so
+// access can be curated in the console afterwards.
+type DefaultAccess struct {
+	// Groups names the groups granted access to new resources, in
+	// addition to those the resource's own configuration grants.
+	Groups []string `json:"groups,omitempty"`
+
+	// SecurityPolicy names the security policy set on new resources.
+	// Empty leaves them under the tenant's default resource policy.
+	SecurityPolicy string `json:"security_policy,omitempty"`
+}
+
+// resolveDefaultPolicy looks up the security policy default_access sets
+// on new resources, failing if it does not exist. Without one, or once
+// resolved, it does nothing.
+func (t *TwingateApp) resolveDefaultPolicy(ctx context.Context) error {
+	if t.DefaultAccess == nil || t.DefaultAccess.SecurityPolicy == "" || t.defaultPolicy != nil {
+		return nil
+	}
+
+	policy, err := t.client.GetSecurityPolicyByName(ctx, t.DefaultAccess.SecurityPolicy)
+	if err != nil {
+		return fmt.Errorf("default_access: %w", err)
+	}
+	t.logger.Debug("Resolved default security policy",
+		zap.String("id", policy.ID),
+		zap.String("name", policy.Name))
+	t.defaultPolicy = policy
+	return nil
+}
+
+// withDefaultAccess returns the groups and security policy a new resource
+// is created with: groupIDs followed by the default groups not among them,
+// and the ID of policy, the security policy named by the resource's
+// profile, or else of the default policy, if any.
+func (r *ResourceSyncer) withDefaultAccess(ctx context.Context, groupIDs []string, policy string) ([]string, string, error) {
+	policyID := r.defaultPolicyID
+	if policy != "" {
+		id, ok := r.policyIDs[policy]
+		if !ok {
+			return nil, "", fmt.Errorf("security policy %q is not resolved", policy)
+		}
+		policyID = id
+	}
+	if r.defaultAccess == nil {
+		return groupIDs, policyID, nil
+	}
+
+	defaults, err := r.resolveGroups(ctx, r.defaultAccess.Groups)
+	if err != nil {
+		return nil, "", fmt.Errorf("default_access: %w", err)
+	}
+	merged := slices.Clone(groupIDs)
+	for _, id := range defaults {
+		if !slices.Contains(merged, id) {
+			merged = append(merged, id)
+		}
+	}
+	return merged, policyID, nil
+}
@@ -0,0 +1,122 @@
+package twingate
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+// createRecorder records the inputs of resource creations.
+type createRecorder struct {
+	*MockTwingateClient
+	inputs []ResourceCreateInput
+}
+
+func (c *createRecorder) CreateResource(ctx context.Context, input ResourceCreateInput) (*Resource, error) {
+	c.inputs = append(c.inputs, input)
+	return c.MockTwingateClient.CreateResource(ctx, input)
+}
+
+func TestSyncSingleResource_DefaultAccessOnlyOnCreate(t *testing.T) {
+	mock := &MockTwingateClient{Groups: map[string]string{"Everyone": "g-all", "Ops": "g-ops"}}
+	client := &createRecorder{MockTwingateClient: mock}
+	syncer := &ResourceSyncer{
+		client:          client,
+		logger:          zap.NewNop(),
+		defaultAccess:   &DefaultAccess{Groups: []string{"Ops", "Everyone"}},
+		defaultPolicyID: "p1",
+	}
+
+	mapping := ResourceMapping{Name: "app.example.com", Address: "10.0.0.1", Groups: []string{"Ops"}}
+	for i := 0; i < 2; i++ {
+		if _, err := syncer.syncSingleResource(context.Background(), mapping, "net1"); err != nil {
+			t.Fatalf("syncSingleResource() failed: %v", err)
+		}
+		if i == 0 {
+			// Access removed in the console before the update
+			mock.Grants["new1"] = nil
+		}
+	}
+
+	if len(client.inputs) != 1 {
+		t.Fatalf("expected a single creation, got %d", len(client.inputs))
+	}
+	if got := client.inputs[0]; !slices.Equal(got.GroupIDs, []string{"g-ops", "g-all"}) || got.SecurityPolicyID != "p1" {
+		t.Errorf("created with groups %v and policy %q, want the configured and default groups and p1", got.GroupIDs, got.SecurityPolicyID)
+	}
+	// The update grants only the configured group again.
+	if grants := mock.Grants["new1"]; !slices.Equal(grants, []string{"g-ops"}) {
+		t.Errorf("grants = %v, want the default group granted only on creation", grants)
+	}
+	if granted := syncer.Granted()["new1"]; !slices.Equal(granted, []string{"g-ops"}) {
+		t.Errorf("Granted() = %v after the update", granted)
+	}
+}
+
+func TestSyncSingleResource_UnknownDefaultGroup(t *testing.T) {
+	mock := &MockTwingateClient{}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop(), defaultAccess: &DefaultAccess{Groups: []string{"Everyone"}}}
+
+	_, err := syncer.syncSingleResource(context.Background(), ResourceMapping{Name: "app.example.com", Address: "10.0.0.1"}, "net1")
+	if err == nil || !strings.Contains(err.Error(), "default_access") {
+		t.Fatalf("expected a default_access error, got %v", err)
+	}
+	if len(mock.Resources) != 0 {
+		t.Error("no resource should be created without its default access")
+	}
+}
+
+func TestCreateResource_SecurityPolicy(t *testing.T) {
+	var got graphqlRequest
+	client := newTestClient(t, func(req graphqlRequest) any {
+		got = req
+		node := resourceNode("r1", "app.example.com", "10.0.0.1", "net1")["node"]
+		return map[string]any{"resourceCreate": map[string]any{"ok": true, "error": nil, "entity": node}}
+	})
+
+	input := ResourceCreateInput{Name: "app.example.com", Address: "10.0.0.1", RemoteNetworkID: "net1"}
+	if _, err := client.CreateResource(context.Background(), input); err != nil {
+		t.Fatalf("CreateResource() failed: %v", err)
+	}
+	if strings.Contains(got.Query, "securityPolicyId") {
+		t.Errorf("securityPolicyId should only be sent when set, got %s", got.Query)
+	}
+
+	input.SecurityPolicyID = "p1"
+	if _, err := client.CreateResource(context.Background(), input); err != nil {
+		t.Fatalf("CreateResource() failed: %v", err)
+	}
+	if got.Variables["securityPolicyId"] != "p1" {
+		t.Errorf("securityPolicyId = %v, want p1", got.Variables["securityPolicyId"])
+	}
+}
+
+func TestParseDefaultAccess(t *testing.T) {
+	var app TwingateApp
+	d := caddyfile.NewTestDispenser(`twingate {
+		default_access {
+			group Everyone
+			group Ops
+			security_policy "Require MFA"
+		}
+	}`)
+	if err := app.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile() failed: %v", err)
+	}
+	want := DefaultAccess{Groups: []string{"Everyone", "Ops"}, SecurityPolicy: "Require MFA"}
+	if app.DefaultAccess == nil || !slices.Equal(app.DefaultAccess.Groups, want.Groups) || app.DefaultAccess.SecurityPolicy != want.SecurityPolicy {
+		t.Errorf("DefaultAccess = %+v, want %+v", app.DefaultAccess, want)
+	}
+
+	d = caddyfile.NewTestDispenser(`twingate {
+		default_access {
+		}
+	}`)
+	if err := (&TwingateApp{}).UnmarshalCaddyfile(d); err == nil {
+		t.Error("an empty default_access block should be rejected")
+	}
+}
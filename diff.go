@@ -0,0 +1,59 @@
+package twingate
+
+import (
+	"maps"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// FieldChange is the old and new value of a changed resource attribute.
+type FieldChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// Diff holds the attributes an update changes, keyed by field name. It is
+// logged under a single diff key and encodes to JSON as
+// {"address":{"old":"10.0.0.1","new":"10.0.0.2"}}.
+type Diff map[string]FieldChange
+
+// set records that field changes from one value to another.
+func (d Diff) set(field, from, to string) {
+	d[field] = FieldChange{Old: from, New: to}
+}
+
+// fields returns the names of the changed fields in driftFields order.
+func (d Diff) fields() []string {
+	var fields []string
+	for _, field := range driftFields {
+		if _, ok := d[field]; ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// redacted returns a copy of d with the address values replaced.
+func (d Diff) redacted() Diff {
+	out := maps.Clone(d)
+	if _, ok := out[FieldAddress]; ok {
+		out.set(FieldAddress, redacted, redacted)
+	}
+	return out
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler, encoding the fields
+// in a stable order.
+func (d Diff) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, field := range d.fields() {
+		change := d[field]
+		enc.AddObject(field, zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			enc.AddString("old", change.Old)
+			enc.AddString("new", change.New)
+			return nil
+		}))
+	}
+	return nil
+}
+
+var _ zapcore.ObjectMarshaler = Diff(nil)
@@ -0,0 +1,35 @@
+package twingate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDiffEncoding(t *testing.T) {
+	diff := Diff{}
+	diff.set(FieldAlias, "", "api.internal")
+	diff.set(FieldAddress, "10.0.0.1", "10.0.0.2")
+
+	data, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	want := `{"address":{"old":"10.0.0.1","new":"10.0.0.2"},"alias":{"old":"","new":"api.internal"}}`
+	if string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	zap.New(core).Info("Successfully updated resource", zap.Object("diff", diff))
+	logged, ok := logs.All()[0].ContextMap()["diff"].(map[string]any)
+	if !ok || len(logged) != 2 {
+		t.Fatalf("logged diff = %v", logs.All()[0].ContextMap())
+	}
+	if got := logged[FieldAddress].(map[string]any); got["old"] != "10.0.0.1" || got["new"] != "10.0.0.2" {
+		t.Errorf("logged address change = %v", got)
+	}
+}
@@ -0,0 +1,86 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// Discoverer supplies endpoints from a source other than Caddy's routes,
+// such as Consul, Nomad or an inventory API. Discoverers are Caddy modules
+// in the twingate.discoverers namespace; the endpoints they return are
+// synced like those of the routes.
+type Discoverer interface {
+	DiscoverEndpoints(ctx context.Context) ([]Endpoint, error)
+}
+
+// discoverTimeout bounds each call to a discoverer.
+const discoverTimeout = 30 * time.Second
+
+// loadDiscoverers loads the configured discoverer modules.
+func (t *TwingateApp) loadDiscoverers(ctx caddy.Context) error {
+	if len(t.DiscoverersRaw) == 0 {
+		return nil
+	}
+	mods, err := ctx.LoadModule(t, "DiscoverersRaw")
+	if err != nil {
+		return fmt.Errorf("loading discoverers: %w", err)
+	}
+	for _, mod := range mods.([]any) {
+		t.discoverers = append(t.discoverers, mod.(Discoverer))
+	}
+	return nil
+}
+
+// appendDiscovered adds the endpoints of the configured discoverers to
+// endpoints. A host already present keeps its existing endpoint. Any
+// discoverer error fails the whole discovery, since syncing without its
+// endpoints would let cleanup delete their resources.
+func (t *TwingateApp) appendDiscovered(ctx context.Context, endpoints []Endpoint) ([]Endpoint, error) {
+	if len(t.discoverers) == 0 {
+		return endpoints, nil
+	}
+
+	known := make(map[string]bool, len(endpoints))
+	for _, ep := range endpoints {
+		known[strings.ToLower(ep.Host)] = true
+	}
+
+	for _, discoverer := range t.discoverers {
+		name := discovererName(discoverer)
+		discoverCtx, cancel := context.WithTimeout(t.withEgress(ctx), discoverTimeout)
+		found, err := discoverer.DiscoverEndpoints(discoverCtx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("discoverer %s: %w", name, err)
+		}
+
+		added := 0
+		for _, ep := range found {
+			host := strings.ToLower(ep.Host)
+			if host == "" || known[host] {
+				continue
+			}
+			known[host] = true
+			endpoints = append(endpoints, ep)
+			added++
+		}
+		t.logger.Debug("Discovered endpoints",
+			zap.String("discoverer", name),
+			zap.Int("found", len(found)),
+			zap.Int("added", added))
+	}
+	return endpoints, nil
+}
+
+// discovererName returns the module name of discoverer, such as consul.
+func discovererName(discoverer Discoverer) string {
+	if mod, ok := discoverer.(caddy.Module); ok {
+		return caddy.GetModuleName(mod)
+	}
+	return fmt.Sprintf("%T", discoverer)
+}
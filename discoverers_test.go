@@ -0,0 +1,106 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(testDiscoverer{})
+}
+
+// testDiscoverer returns the hosts it is configured with.
+type testDiscoverer struct {
+	Hosts []string `json:"hosts,omitempty"`
+	err   error
+}
+
+func (testDiscoverer) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "twingate.discoverers.test",
+		New: func() caddy.Module { return new(testDiscoverer) },
+	}
+}
+
+func (d testDiscoverer) DiscoverEndpoints(context.Context) ([]Endpoint, error) {
+	endpoints := make([]Endpoint, 0, len(d.Hosts))
+	for _, host := range d.Hosts {
+		endpoints = append(endpoints, Endpoint{Host: host})
+	}
+	return endpoints, d.err
+}
+
+func (d *testDiscoverer) UnmarshalCaddyfile(disp *caddyfile.Dispenser) error {
+	disp.Next() // discoverer name
+	d.Hosts = disp.RemainingArgs()
+	return nil
+}
+
+func TestAppendDiscovered(t *testing.T) {
+	app := &TwingateApp{
+		logger: zap.NewNop(),
+		discoverers: []Discoverer{
+			testDiscoverer{Hosts: []string{"consul.example.com", "App.example.com"}},
+			testDiscoverer{Hosts: []string{"consul.example.com", "nomad.example.com", ""}},
+		},
+	}
+
+	endpoints, err := app.appendDiscovered(context.Background(), []Endpoint{{Host: "app.example.com", Upstreams: []string{"localhost:9000"}}})
+	if err != nil {
+		t.Fatalf("appendDiscovered() error = %v", err)
+	}
+
+	var hosts []string
+	for _, ep := range endpoints {
+		hosts = append(hosts, ep.Host)
+	}
+	want := []string{"app.example.com", "consul.example.com", "nomad.example.com"}
+	if !slices.Equal(hosts, want) {
+		t.Errorf("hosts = %v, want %v", hosts, want)
+	}
+	if len(endpoints[0].Upstreams) != 1 {
+		t.Errorf("route endpoint should win over a discovered one, got %+v", endpoints[0])
+	}
+
+	app.discoverers = append(app.discoverers, testDiscoverer{err: errors.New("consul unreachable")})
+	if _, err := app.appendDiscovered(context.Background(), nil); err == nil {
+		t.Error("expected a discoverer error to fail discovery")
+	}
+}
+
+func TestUnmarshalCaddyfile_Discoverer(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		discoverer test a.example.com b.example.com
+		discoverer test c.example.com
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, raw := range app.DiscoverersRaw {
+		got = append(got, string(raw))
+	}
+	want := []string{
+		`{"discoverer":"test","hosts":["a.example.com","b.example.com"]}`,
+		`{"discoverer":"test","hosts":["c.example.com"]}`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("DiscoverersRaw = %v, want %v", got, want)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		discoverer unknown
+	}`))
+	if err == nil {
+		t.Error("expected error for unknown discoverer")
+	}
+}
@@ -0,0 +1,182 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Drift policies decide what happens when a resource attribute was changed
+// outside the plugin, such as in the Twingate console.
+const (
+	// DriftOverwrite restores the configured value. This is the default.
+	DriftOverwrite = "overwrite"
+	// DriftWarn keeps the console value and reports the drift.
+	DriftWarn = "warn"
+	// DriftIgnore keeps the console value without reporting it.
+	DriftIgnore = "ignore"
+)
+
+// driftFields are the attributes whose drift can be detected. Group grants
+// are not read back from the API, so they cannot drift.
+var driftFields = []string{FieldName, FieldAddress, FieldAlias}
+
+// DriftPolicy configures how drift is handled, by default and per field.
+type DriftPolicy struct {
+	Default string            `json:"default,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// policyFor returns the policy for field. A nil policy overwrites.
+func (p *DriftPolicy) policyFor(field string) string {
+	if p == nil {
+		return DriftOverwrite
+	}
+	if policy, ok := p.Fields[field]; ok {
+		return policy
+	}
+	if p.Default != "" {
+		return p.Default
+	}
+	return DriftOverwrite
+}
+
+func (p *DriftPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Default != "" {
+		if err := validateDriftPolicy(p.Default); err != nil {
+			return err
+		}
+	}
+	for field, policy := range p.Fields {
+		if !slices.Contains(driftFields, field) {
+			return fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(driftFields, ", "))
+		}
+		if err := validateDriftPolicy(policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateDriftPolicy(policy string) error {
+	switch policy {
+	case DriftOverwrite, DriftWarn, DriftIgnore:
+		return nil
+	}
+	return fmt.Errorf("policy must be %q, %q or %q, got: %s", DriftOverwrite, DriftWarn, DriftIgnore, policy)
+}
+
+// AppliedFields are the attribute values the plugin last set on a resource.
+// A current value that differs from them was changed outside the plugin.
+type AppliedFields struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Alias   string `json:"alias,omitempty"`
+
+	// Tagged is set when the plugin last applied tags to the resource, so
+	// removing every label clears them.
+	Tagged bool `json:"tagged,omitempty"`
+}
+
+func (a AppliedFields) get(field string) string {
+	switch field {
+	case FieldName:
+		return a.Name
+	case FieldAddress:
+		return a.Address
+	case FieldAlias:
+		return a.Alias
+	}
+	return ""
+}
+
+func (a *AppliedFields) set(field, value string) {
+	switch field {
+	case FieldName:
+		a.Name = value
+	case FieldAddress:
+		a.Address = value
+	case FieldAlias:
+		a.Alias = value
+	}
+}
+
+// Drift is a resource attribute found changed outside the plugin.
+type Drift struct {
+	ResourceID string `json:"resource_id"`
+	Name       string `json:"name"`
+	Field      string `json:"field"`
+	Applied    string `json:"applied"`
+	Actual     string `json:"actual"`
+	Policy     string `json:"policy"`
+}
+
+// reportDrift counts and emits an event for each drift found by a sync.
+// The syncer has already logged them.
+func (t *TwingateApp) reportDrift(ctx context.Context, drifts []Drift) {
+	for _, drift := range drifts {
+		twingateMetrics.drift.WithLabelValues(drift.Field, drift.Policy).Inc()
+		t.emit(ctx, "twingate_resource_drift", map[string]any{
+			"id":      drift.ResourceID,
+			"name":    drift.Name,
+			"field":   drift.Field,
+			"applied": drift.Applied,
+			"actual":  drift.Actual,
+			"policy":  drift.Policy,
+		})
+	}
+}
+
+// reconcileField reports whether an update should set field to desired.
+// A current value that differs from the last applied one is drift, handled
+// by the field's policy; without a record of the last applied value any
+// difference is a configuration change. A preview records the drift
+// without logging it, since it does not act on it.
+func (r *ResourceSyncer) reconcileField(existing *Resource, field, current, desired string, applied *AppliedFields, preview bool) bool {
+	if !r.manages(field) || current == desired {
+		return false
+	}
+	if applied == nil || current == applied.get(field) {
+		return true
+	}
+
+	policy := r.driftPolicy.policyFor(field)
+	fields := []zap.Field{
+		zap.String("resource_id", existing.ID),
+		zap.String("name", existing.Name),
+		zap.String("field", field),
+		zap.String("applied", applied.get(field)),
+		zap.String("actual", current),
+		zap.String("policy", policy),
+	}
+	if policy == DriftIgnore {
+		if !preview {
+			r.logger.Debug("Ignoring resource drift", fields...)
+		}
+		return false
+	}
+
+	r.drifts = append(r.drifts, Drift{
+		ResourceID: existing.ID,
+		Name:       existing.Name,
+		Field:      field,
+		Applied:    applied.get(field),
+		Actual:     current,
+		Policy:     policy,
+	})
+	switch {
+	case preview:
+		return policy != DriftWarn
+	case policy == DriftWarn:
+		r.logger.Warn("Resource was changed outside Caddy, keeping its value", fields...)
+		return false
+	}
+	r.logger.Info("Resource was changed outside Caddy, overwriting it", fields...)
+	return true
+}
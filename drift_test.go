@@ -0,0 +1,143 @@
+package twingate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func TestUpdateExistingResourceDrift(t *testing.T) {
+	applied := AppliedFields{Name: "api.example.com", Address: "10.0.0.1"}
+	mapping := ResourceMapping{Name: "api.example.com", Address: "10.0.0.1"}
+
+	tests := []struct {
+		name        string
+		policy      *DriftPolicy
+		wantAddress string
+		wantDrift   bool
+	}{
+		{"default overwrites", nil, "10.0.0.1", true},
+		{"warn keeps console value", &DriftPolicy{Default: DriftWarn}, "10.9.9.9", true},
+		{"ignore keeps console value silently", &DriftPolicy{Default: DriftIgnore}, "10.9.9.9", false},
+		{"field policy wins", &DriftPolicy{Default: DriftOverwrite, Fields: map[string]string{FieldAddress: DriftWarn}}, "10.9.9.9", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The address was changed in the console
+			existing := newTestResource("r1", "api.example.com", "10.9.9.9", "net1")
+			mock := &MockTwingateClient{Resources: map[string]Resource{"r1": existing}}
+			syncer := &ResourceSyncer{
+				client:      mock,
+				logger:      zap.NewNop(),
+				applied:     map[string]AppliedFields{"r1": applied},
+				driftPolicy: tt.policy,
+			}
+
+			if _, err := syncer.updateExistingResource(context.Background(), mapping, &existing, nil); err != nil {
+				t.Fatalf("updateExistingResource() failed: %v", err)
+			}
+
+			if got := mock.Resources["r1"].Address.Value; got != tt.wantAddress {
+				t.Errorf("address = %q, want %q", got, tt.wantAddress)
+			}
+			if got := len(syncer.Drifts()) == 1; got != tt.wantDrift {
+				t.Fatalf("drifts = %+v, want drift %v", syncer.Drifts(), tt.wantDrift)
+			}
+			if tt.wantDrift {
+				drift := syncer.Drifts()[0]
+				if drift.Field != FieldAddress || drift.Applied != "10.0.0.1" || drift.Actual != "10.9.9.9" {
+					t.Errorf("unexpected drift: %+v", drift)
+				}
+			}
+
+			// A kept console value is not recorded as applied, so the
+			// drift is reported again on the next sync.
+			if got := syncer.Applied()["r1"].Address; got != "10.0.0.1" {
+				t.Errorf("applied address = %q, want 10.0.0.1", got)
+			}
+		})
+	}
+}
+
+func TestUpdateExistingResourceConfigChangeIsNotDrift(t *testing.T) {
+	existing := newTestResource("r1", "api.example.com", "10.0.0.1", "net1")
+	mock := &MockTwingateClient{Resources: map[string]Resource{"r1": existing}}
+	syncer := &ResourceSyncer{
+		client:      mock,
+		logger:      zap.NewNop(),
+		applied:     map[string]AppliedFields{"r1": {Name: "api.example.com", Address: "10.0.0.1"}},
+		driftPolicy: &DriftPolicy{Default: DriftWarn},
+	}
+
+	mapping := ResourceMapping{Name: "api.example.com", Address: "10.0.0.2"}
+	if _, err := syncer.updateExistingResource(context.Background(), mapping, &existing, nil); err != nil {
+		t.Fatalf("updateExistingResource() failed: %v", err)
+	}
+
+	if got := mock.Resources["r1"].Address.Value; got != "10.0.0.2" {
+		t.Errorf("address = %q, want 10.0.0.2", got)
+	}
+	if len(syncer.Drifts()) != 0 {
+		t.Errorf("expected no drift, got %+v", syncer.Drifts())
+	}
+	if got := syncer.Applied()["r1"].Address; got != "10.0.0.2" {
+		t.Errorf("applied address = %q, want 10.0.0.2", got)
+	}
+}
+
+func TestGetSyncSummaryDriftPolicy(t *testing.T) {
+	alias := "api.example.com"
+	// The name and address were both changed in the console
+	existing := newTestResource("r1", "API (console)", "10.0.0.9", "net1")
+	existing.Alias = &alias
+	mock := &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{"r1": existing},
+	}
+	syncer := &ResourceSyncer{
+		client:      mock,
+		logger:      zap.NewNop(),
+		applied:     map[string]AppliedFields{"r1": {Name: "api.example.com", Address: "10.0.0.1", Alias: alias}},
+		driftPolicy: &DriftPolicy{Default: DriftWarn},
+	}
+
+	mappings := []ResourceMapping{{Name: "api.example.com", Address: "10.0.0.1", Alias: &alias}}
+	summary, err := syncer.GetSyncSummary(context.Background(), mappings, "", &CleanupConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("GetSyncSummary() failed: %v", err)
+	}
+	if len(summary.Resources) != 1 || summary.Resources[0].Action != "unchanged" {
+		t.Errorf("drift kept by the warn policy should not be planned: %+v", summary.Resources)
+	}
+	if summary.ResourcesToDelete != 0 {
+		t.Errorf("the resource matched by alias should not be planned for deletion: %+v", summary.Resources)
+	}
+	if len(syncer.Drifts()) != 2 {
+		t.Errorf("expected the drift of the name and address, got %+v", syncer.Drifts())
+	}
+}
+
+func TestUnmarshalCaddyfile_DriftPolicy(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		drift_policy warn
+		drift_policy alias ignore
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.DriftPolicy.policyFor(FieldAddress) != DriftWarn || app.DriftPolicy.policyFor(FieldAlias) != DriftIgnore {
+		t.Errorf("unexpected drift policy: %+v", app.DriftPolicy)
+	}
+
+	for _, bad := range []string{"drift_policy keep", "drift_policy groups warn", "drift_policy"} {
+		err := (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n" + bad + "\n}"))
+		if err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
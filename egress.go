@@ -0,0 +1,98 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyConfig returns the proxy settings of the API client: proxy_url for
+// both schemes if set, otherwise HTTP_PROXY and HTTPS_PROXY, with NO_PROXY
+// applying either way. The environment is read on every call, so a reload
+// picks up changes to it, unlike http.ProxyFromEnvironment which reads it
+// once per process.
+func (t *TwingateApp) proxyConfig() *httpproxy.Config {
+	config := httpproxy.FromEnvironment()
+	if t.ProxyURL != "" {
+		config.HTTPProxy = t.ProxyURL
+		config.HTTPSProxy = t.ProxyURL
+	}
+	return config
+}
+
+// egressKey identifies the proxy and client certificate the API client
+// uses, so clients pooled across reloads are only shared when both match.
+func (t *TwingateApp) egressKey() string {
+	proxy := t.proxyConfig()
+	return strings.Join([]string{t.TLSClientAuth.identity(), proxy.HTTPProxy, proxy.HTTPSProxy, proxy.NoProxy}, "\x00")
+}
+
+// egressClient returns the HTTP client of the app's outbound requests,
+// going through the configured proxy and presenting the configured client
+// certificate. The API client uses it, and so do tenant detection, the
+// routes_from admin API, discoverers and address resolvers.
+func (t *TwingateApp) egressClient(ctx caddy.Context) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	proxy := t.proxyConfig().ProxyFunc()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+
+	tlsConfig, err := t.clientTLSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: 30 * time.Second, Transport: transport}, nil
+}
+
+// clientOptions returns the options of the app's API client: its logger
+// and the egress client.
+func (t *TwingateApp) clientOptions() []ClientOption {
+	return []ClientOption{WithHTTPClient(t.httpClient), WithLogger(t.logger)}
+}
+
+// egressClientKey carries the app's egress client to the lookups modules
+// make on its behalf, such as those of discoverers and address resolvers.
+type egressClientKey struct{}
+
+// withEgress returns ctx carrying the app's egress client.
+func (t *TwingateApp) withEgress(ctx context.Context) context.Context {
+	if t.httpClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, egressClientKey{}, t.httpClient)
+}
+
+// egressHTTPClient returns the egress client carried by ctx, or
+// http.DefaultClient outside an app.
+func egressHTTPClient(ctx context.Context) *http.Client {
+	if client, ok := ctx.Value(egressClientKey{}).(*http.Client); ok {
+		return client
+	}
+	return http.DefaultClient
+}
+
+// validateProxyURL checks that proxy_url is an HTTP, HTTPS or SOCKS5
+// proxy URL.
+func validateProxyURL(proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("must be an http, https or socks5 URL, got: %s", redactURL(proxyURL))
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host: %s", redactURL(proxyURL))
+	}
+	return nil
+}
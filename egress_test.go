@@ -0,0 +1,124 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func TestUnmarshalCaddyfile_ProxyURL(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		proxy_url http://proxy.corp.example:3128
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.ProxyURL != "http://proxy.corp.example:3128" {
+		t.Errorf("ProxyURL = %q", app.ProxyURL)
+	}
+
+	for _, option := range []string{"proxy_url", "proxy_url ftp://proxy.corp.example", "proxy_url http://"} {
+		app := &TwingateApp{}
+		if err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n tenant acme\n " + option + "\n}")); err == nil {
+			t.Errorf("%q should fail to parse", option)
+		}
+	}
+}
+
+func TestClientOptions_ProxyURL(t *testing.T) {
+	t.Setenv("NO_PROXY", "")
+
+	// The proxy answers the requests forwarded to it itself
+	var forwarded []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.URL.String())
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"remoteNetworks": map[string]any{"edges": []any{}},
+		}})
+	}))
+	defer proxy.Close()
+
+	app := &TwingateApp{ProxyURL: proxy.URL, logger: zap.NewNop()}
+	httpClient, err := app.egressClient(caddy.Context{})
+	if err != nil {
+		t.Fatalf("egressClient() failed: %v", err)
+	}
+	app.httpClient = httpClient
+	client := NewTwingateClient("http://acme.twingate.example/api/graphql/", "secret", app.clientOptions()...)
+	if err := client.TestConnection(context.Background()); err != nil {
+		t.Fatalf("TestConnection() failed: %v", err)
+	}
+	if len(forwarded) != 1 || forwarded[0] != "http://acme.twingate.example/api/graphql/" {
+		t.Errorf("expected the request to go through the proxy, got %v", forwarded)
+	}
+}
+
+func TestProxyConfig(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://env-proxy.example:3128")
+	t.Setenv("NO_PROXY", "internal.example")
+	api, _ := url.Parse("https://acme.twingate.com/api/graphql/")
+	internal, _ := url.Parse("https://api.internal.example/api/graphql/")
+
+	// Without proxy_url the environment applies
+	app := &TwingateApp{}
+	proxy, err := app.proxyConfig().ProxyFunc()(api)
+	if err != nil || proxy == nil || proxy.Host != "env-proxy.example:3128" {
+		t.Errorf("proxy = %v, %v, want the HTTPS_PROXY one", proxy, err)
+	}
+
+	// proxy_url overrides the environment, but not NO_PROXY
+	app.ProxyURL = "http://proxy.corp.example:8080"
+	proxyFunc := app.proxyConfig().ProxyFunc()
+	if proxy, err := proxyFunc(api); err != nil || proxy == nil || proxy.Host != "proxy.corp.example:8080" {
+		t.Errorf("proxy = %v, %v, want proxy_url", proxy, err)
+	}
+	if proxy, err := proxyFunc(internal); err != nil || proxy != nil {
+		t.Errorf("proxy = %v, %v, want none for a NO_PROXY host", proxy, err)
+	}
+
+	// Clients using different proxies are not shared
+	other := &TwingateApp{ProxyURL: "http://other-proxy.example:8080"}
+	if clientPoolKey("acme", "k1", app.egressKey()) == clientPoolKey("acme", "k1", other.egressKey()) {
+		t.Error("clients using different proxies should not share a pool entry")
+	}
+}
+
+func TestEgressClientUsedForLookups(t *testing.T) {
+	t.Setenv("NO_PROXY", "")
+
+	var forwarded []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.URL.String())
+		_, _ = w.Write([]byte("203.0.113.7"))
+	}))
+	defer proxy.Close()
+
+	app := &TwingateApp{ProxyURL: proxy.URL}
+	httpClient, err := app.egressClient(caddy.Context{})
+	if err != nil {
+		t.Fatalf("egressClient() failed: %v", err)
+	}
+	app.httpClient = httpClient
+
+	resolver := PublicHTTPResolver{URL: "http://ip.example/"}
+	addrs, err := resolver.ResolveAddresses(app.withEgress(context.Background()))
+	if err != nil {
+		t.Fatalf("ResolveAddresses() failed: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "203.0.113.7" {
+		t.Errorf("addresses = %v", addrs)
+	}
+	if len(forwarded) != 1 || forwarded[0] != "http://ip.example/" {
+		t.Errorf("expected the lookup to go through the proxy, got %v", forwarded)
+	}
+}
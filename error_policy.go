@@ -0,0 +1,80 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Error policies decide whether a sync in which some resources failed
+// counts as failed. A failed initial sync fails Provision, so Caddy does
+// not start.
+const (
+	// ErrorPolicyFail fails the sync on any failed resource. This is the
+	// default.
+	ErrorPolicyFail = "fail"
+	// ErrorPolicyWarn logs the failed resources and lets the sync succeed.
+	ErrorPolicyWarn = "warn"
+	// ErrorPolicyThreshold, followed by a number such as "threshold:5",
+	// lets the sync succeed with up to that many failed resources.
+	ErrorPolicyThreshold = "threshold:"
+)
+
+// PartialSyncError is returned by SyncResources when the sync ran through
+// every remote network but some resources failed to upsert or delete.
+type PartialSyncError struct {
+	Upserts int
+	Deletes int
+}
+
+func (e *PartialSyncError) Error() string {
+	return fmt.Sprintf("sync completed with %d errors (upsert: %d, delete: %d)",
+		e.Failures(), e.Upserts, e.Deletes)
+}
+
+// Failures is the number of resources that failed.
+func (e *PartialSyncError) Failures() int {
+	return e.Upserts + e.Deletes
+}
+
+// parseErrorPolicy returns the number of failed resources policy lets a
+// sync succeed with, or -1 for any number.
+func parseErrorPolicy(policy string) (int, error) {
+	switch policy {
+	case "", ErrorPolicyFail:
+		return 0, nil
+	case ErrorPolicyWarn:
+		return -1, nil
+	}
+	if n, ok := strings.CutPrefix(policy, ErrorPolicyThreshold); ok {
+		if tolerated, err := strconv.Atoi(n); err == nil && tolerated >= 0 {
+			return tolerated, nil
+		}
+	}
+	return 0, fmt.Errorf("error_policy must be %q, %q or \"%s<n>\", got: %s",
+		ErrorPolicyFail, ErrorPolicyWarn, ErrorPolicyThreshold, policy)
+}
+
+// toleratesSyncError reports whether err is a partial sync failure the
+// error policy lets the sync succeed with, logging a warning if so. The
+// failed resources stay queued for retry either way.
+func (t *TwingateApp) toleratesSyncError(ctx context.Context, err error) bool {
+	var partial *PartialSyncError
+	if !errors.As(err, &partial) {
+		return false
+	}
+	// The policy is checked by Validate.
+	tolerated, _ := parseErrorPolicy(t.ErrorPolicy)
+	if tolerated == 0 || tolerated > 0 && partial.Failures() > tolerated {
+		return false
+	}
+	t.log(ctx).Warn("Sync completed with failed resources, continuing per error_policy",
+		zap.String("error_policy", t.ErrorPolicy),
+		zap.Int("upsert_errors", partial.Upserts),
+		zap.Int("delete_errors", partial.Deletes))
+	return true
+}
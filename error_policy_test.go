@@ -0,0 +1,93 @@
+package twingate
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func TestParseErrorPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy    string
+		tolerated int
+		wantErr   bool
+	}{
+		{policy: "", tolerated: 0},
+		{policy: "fail", tolerated: 0},
+		{policy: "warn", tolerated: -1},
+		{policy: "threshold:5", tolerated: 5},
+		{policy: "threshold:", wantErr: true},
+		{policy: "threshold:-1", wantErr: true},
+		{policy: "ignore", wantErr: true},
+	} {
+		tolerated, err := parseErrorPolicy(tt.policy)
+		if (err != nil) != tt.wantErr || tolerated != tt.tolerated {
+			t.Errorf("parseErrorPolicy(%q) = %d, %v", tt.policy, tolerated, err)
+		}
+	}
+}
+
+func TestToleratesSyncError(t *testing.T) {
+	partial := fmt.Errorf("failed to sync resources: %w", &PartialSyncError{Upserts: 2, Deletes: 1})
+	for _, tt := range []struct {
+		policy string
+		err    error
+		want   bool
+	}{
+		{policy: "", err: partial, want: false},
+		{policy: "warn", err: partial, want: true},
+		{policy: "threshold:3", err: partial, want: true},
+		{policy: "threshold:2", err: partial, want: false},
+		{policy: "warn", err: errors.New("listing resources: timeout"), want: false},
+	} {
+		app := &TwingateApp{ErrorPolicy: tt.policy, logger: zap.NewNop()}
+		if got := app.toleratesSyncError(t.Context(), tt.err); got != tt.want {
+			t.Errorf("policy %q with %v: toleratesSyncError() = %v, want %v", tt.policy, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSyncResources_PartialSyncError(t *testing.T) {
+	mockClient := &MockTwingateClient{
+		Resources: map[string]Resource{
+			"res1": newTestResource("res1", "stale.example.com", "10.0.0.1", "net1"),
+		},
+		Networks:  map[string]RemoteNetwork{"Caddy": {ID: "net1", Name: "Caddy"}},
+		DeleteErr: errors.New("simulated deletion error"),
+	}
+	syncer := NewResourceSyncer(mockClient, zap.NewNop())
+
+	err := syncer.SyncResources(t.Context(), []ResourceMapping{{Name: "app.example.com", Address: "10.0.0.1"}},
+		"Caddy", &CleanupConfig{Enabled: true})
+
+	var partial *PartialSyncError
+	if !errors.As(err, &partial) || partial.Upserts != 0 || partial.Deletes != 1 {
+		t.Fatalf("expected a partial sync error with one delete, got %v", err)
+	}
+	if _, ok := syncer.SyncedResources()["app.example.com"]; !ok {
+		t.Error("resources that synced should be reported despite the failure")
+	}
+}
+
+func TestUnmarshalCaddyfile_ErrorPolicy(t *testing.T) {
+	app := &TwingateApp{}
+	if err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		error_policy threshold:3
+	}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.ErrorPolicy != "threshold:3" {
+		t.Errorf("ErrorPolicy = %q, want threshold:3", app.ErrorPolicy)
+	}
+
+	if err := (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		error_policy threshold:many
+	}`)); err == nil {
+		t.Error("expected error for an invalid policy")
+	}
+}
@@ -0,0 +1,302 @@
+package twingate
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(EtcdDiscoverer{})
+}
+
+const (
+	// DefaultEtcdEndpoint is the client URL of a local etcd member.
+	DefaultEtcdEndpoint = "http://127.0.0.1:2379"
+
+	// DefaultEtcdPrefix is the key prefix the services are registered
+	// under.
+	DefaultEtcdPrefix = "/twingate/services/"
+)
+
+// EtcdDiscoverer publishes the services registered under a key prefix in
+// etcd, read through etcd's v3 JSON gateway. Each key holds a JSON
+// service:
+//
+//	{"host": "app.example.com", "address": "10.0.0.20", "groups": ["Engineering"]}
+//
+// A service without a host is named by the rest of its key, and one
+// without an address is reached through Caddy.
+type EtcdDiscoverer struct {
+	// Endpoint is the client URL of an etcd member. Defaults to
+	// http://127.0.0.1:2379.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Prefix is the key prefix of the services. Defaults to
+	// /twingate/services/.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Username and PasswordEnv authenticate to an etcd with auth
+	// enabled. PasswordEnv names the environment variable holding the
+	// password.
+	Username    string `json:"username,omitempty"`
+	PasswordEnv string `json:"password_env,omitempty"`
+
+	// RemoteNetwork and Groups apply to services that set none.
+	RemoteNetwork string   `json:"remote_network,omitempty"`
+	Groups        []string `json:"groups,omitempty"`
+
+	logger *zap.Logger
+}
+
+func (EtcdDiscoverer) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "twingate.discoverers.etcd",
+		New: func() caddy.Module { return new(EtcdDiscoverer) },
+	}
+}
+
+func (e *EtcdDiscoverer) Provision(ctx caddy.Context) error {
+	e.logger = ctx.Logger()
+	return nil
+}
+
+func (e *EtcdDiscoverer) Validate() error {
+	if e.Endpoint != "" {
+		if err := validateAPIEndpoint(e.Endpoint); err != nil {
+			return fmt.Errorf("etcd endpoint: %w", err)
+		}
+	}
+	if (e.Username == "") != (e.PasswordEnv == "") {
+		return fmt.Errorf("etcd username and password_env must be set together")
+	}
+	return nil
+}
+
+// etcdService is the JSON value of a service key.
+type etcdService struct {
+	Host          string            `json:"host"`
+	Address       string            `json:"address"`
+	RemoteNetwork string            `json:"remote_network"`
+	Groups        []string          `json:"groups"`
+	Labels        map[string]string `json:"labels"`
+}
+
+func (e *EtcdDiscoverer) DiscoverEndpoints(ctx context.Context) ([]Endpoint, error) {
+	token, err := e.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := []byte(e.prefix())
+	var resp struct {
+		Kvs []struct {
+			Key   []byte `json:"key"`
+			Value []byte `json:"value"`
+		} `json:"kvs"`
+	}
+	req := map[string]string{
+		"key":       base64.StdEncoding.EncodeToString(prefix),
+		"range_end": base64.StdEncoding.EncodeToString(prefixRangeEnd(prefix)),
+	}
+	if err := e.post(ctx, "/v3/kv/range", token, req, &resp); err != nil {
+		return nil, err
+	}
+
+	// Keys come back sorted, so endpoints are in key order
+	endpoints := make([]Endpoint, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		var svc etcdService
+		if err := json.Unmarshal(kv.Value, &svc); err != nil {
+			e.log().Warn("Skipping etcd service with an invalid value",
+				zap.String("key", key),
+				zap.Error(err))
+			continue
+		}
+		if svc.Host == "" {
+			svc.Host = strings.TrimPrefix(key, string(prefix))
+		}
+		if !isDNSName(svc.Host) {
+			e.log().Warn("Skipping etcd service whose host is not a valid DNS name",
+				zap.String("key", key),
+				zap.String("host", svc.Host))
+			continue
+		}
+		if svc.Address != "" {
+			if err := validateCaddyAddress(svc.Address); err != nil {
+				e.log().Warn("Skipping etcd service with an unusable address",
+					zap.String("key", key),
+					zap.Error(err))
+				continue
+			}
+		}
+
+		ep := Endpoint{
+			Host:          svc.Host,
+			Address:       svc.Address,
+			RemoteNetwork: svc.RemoteNetwork,
+			Groups:        svc.Groups,
+			Labels:        svc.Labels,
+		}
+		if ep.RemoteNetwork == "" {
+			ep.RemoteNetwork = e.RemoteNetwork
+		}
+		if len(ep.Groups) == 0 {
+			ep.Groups = e.Groups
+		}
+		endpoints = append(endpoints, ep)
+	}
+	return endpoints, nil
+}
+
+// authenticate returns a token for the configured user, or an empty token
+// without one.
+func (e *EtcdDiscoverer) authenticate(ctx context.Context) (string, error) {
+	if e.Username == "" {
+		return "", nil
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	req := map[string]string{"name": e.Username, "password": os.Getenv(e.PasswordEnv)}
+	if err := e.post(ctx, "/v3/auth/authenticate", "", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+// post sends body to the etcd JSON gateway and decodes its response into v.
+func (e *EtcdDiscoverer) post(ctx context.Context, path, token string, body, v any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.endpoint(), "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := egressHTTPClient(ctx).Do(req)
+	if err != nil {
+		return fmt.Errorf("etcd: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("etcd %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("etcd %s: decoding response: %w", path, err)
+	}
+	return nil
+}
+
+// prefixRangeEnd returns the end of the key range covering prefix: the
+// prefix with its last byte below 0xff incremented.
+func prefixRangeEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// All 0xff: the range runs to the end of the keyspace
+	return []byte{0}
+}
+
+func (e *EtcdDiscoverer) endpoint() string {
+	if e.Endpoint != "" {
+		return e.Endpoint
+	}
+	return DefaultEtcdEndpoint
+}
+
+func (e *EtcdDiscoverer) prefix() string {
+	if e.Prefix != "" {
+		return e.Prefix
+	}
+	return DefaultEtcdPrefix
+}
+
+func (e *EtcdDiscoverer) log() *zap.Logger {
+	if e.logger == nil {
+		return zap.NewNop()
+	}
+	return e.logger
+}
+
+// UnmarshalCaddyfile sets up the discoverer from Caddyfile tokens. Syntax:
+//
+//	discoverer etcd [<endpoint>] {
+//	    endpoint       <url>
+//	    prefix         <key prefix>
+//	    username       <name>
+//	    password_env   <variable>
+//	    remote_network <name>
+//	    groups         <names...>
+//	}
+func (e *EtcdDiscoverer) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // discoverer name
+	if d.NextArg() {
+		e.Endpoint = d.Val()
+	}
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		switch d.Val() {
+		case "endpoint", "prefix", "username", "password_env", "remote_network":
+			opt := d.Val()
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			switch opt {
+			case "endpoint":
+				e.Endpoint = d.Val()
+			case "prefix":
+				e.Prefix = d.Val()
+			case "username":
+				e.Username = d.Val()
+			case "password_env":
+				e.PasswordEnv = d.Val()
+			case "remote_network":
+				e.RemoteNetwork = d.Val()
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+		case "groups":
+			groups := d.RemainingArgs()
+			if len(groups) == 0 {
+				return d.ArgErr()
+			}
+			e.Groups = append(e.Groups, groups...)
+		default:
+			return d.Errf("unrecognized etcd option: %s", d.Val())
+		}
+	}
+	return e.Validate()
+}
+
+var (
+	_ Discoverer            = (*EtcdDiscoverer)(nil)
+	_ caddy.Provisioner     = (*EtcdDiscoverer)(nil)
+	_ caddy.Validator       = (*EtcdDiscoverer)(nil)
+	_ caddyfile.Unmarshaler = (*EtcdDiscoverer)(nil)
+)
@@ -0,0 +1,119 @@
+package twingate
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func TestEtcdDiscoverEndpoints(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		switch r.URL.Path {
+		case "/v3/auth/authenticate":
+			if req["name"] != "caddy" || req["password"] != "secret" {
+				http.Error(w, `{"error":"authentication failed"}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"token": "tok"}`))
+		case "/v3/kv/range":
+			if r.Header.Get("Authorization") != "tok" {
+				http.Error(w, `{"error":"user name is empty"}`, http.StatusUnauthorized)
+				return
+			}
+			if req["key"] != b64([]byte("/svc/")) || req["range_end"] != b64([]byte("/svc0")) {
+				http.Error(w, "unexpected range", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"kvs": [
+				{"key": "` + b64([]byte("/svc/api.example.com")) + `", "value": "` + b64([]byte(`{"address": "10.0.0.20", "groups": ["Engineering"]}`)) + `"},
+				{"key": "` + b64([]byte("/svc/broken")) + `", "value": "` + b64([]byte(`{`)) + `"},
+				{"key": "` + b64([]byte("/svc/not a host")) + `", "value": "` + b64([]byte(`{"address": "10.0.0.21"}`)) + `"},
+				{"key": "` + b64([]byte("/svc/grafana")) + `", "value": "` + b64([]byte(`{"host": "grafana.example.com", "labels": {"team": "obs"}}`)) + `"}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("TEST_ETCD_PASSWORD", "secret")
+
+	e := &EtcdDiscoverer{
+		Endpoint:      server.URL,
+		Prefix:        "/svc/",
+		Username:      "caddy",
+		PasswordEnv:   "TEST_ETCD_PASSWORD",
+		RemoteNetwork: "Datacenter",
+		Groups:        []string{"Everyone"},
+		logger:        zap.NewNop(),
+	}
+	endpoints, err := e.DiscoverEndpoints(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverEndpoints() error = %v", err)
+	}
+	if len(endpoints) != 2 {
+		t.Fatalf("endpoints = %+v, want the two valid services", endpoints)
+	}
+	api, grafana := endpoints[0], endpoints[1]
+	if api.Host != "api.example.com" || api.Address != "10.0.0.20" || !slices.Equal(api.Groups, []string{"Engineering"}) || api.RemoteNetwork != "Datacenter" {
+		t.Errorf("api = %+v", api)
+	}
+	if grafana.Host != "grafana.example.com" || grafana.Address != "" || !slices.Equal(grafana.Groups, []string{"Everyone"}) || grafana.Labels["team"] != "obs" {
+		t.Errorf("grafana = %+v", grafana)
+	}
+
+	t.Setenv("TEST_ETCD_PASSWORD", "wrong")
+	if _, err := e.DiscoverEndpoints(context.Background()); err == nil {
+		t.Error("expected failed authentication to fail discovery")
+	}
+}
+
+func TestPrefixRangeEnd(t *testing.T) {
+	tests := []struct{ prefix, want []byte }{
+		{[]byte("/twingate/"), []byte("/twingate0")},
+		{[]byte{'a', 0xff}, []byte{'b'}},
+		{[]byte{0xff, 0xff}, []byte{0}},
+	}
+	for _, tt := range tests {
+		if got := prefixRangeEnd(tt.prefix); !bytes.Equal(got, tt.want) {
+			t.Errorf("prefixRangeEnd(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestEtcdDiscovererUnmarshalCaddyfile(t *testing.T) {
+	var e EtcdDiscoverer
+	err := e.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`etcd https://etcd.internal:2379 {
+		prefix /services/twingate/
+		username caddy
+		password_env ETCD_PASSWORD
+		remote_network Datacenter
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.Endpoint != "https://etcd.internal:2379" || e.prefix() != "/services/twingate/" || e.Username != "caddy" || e.PasswordEnv != "ETCD_PASSWORD" {
+		t.Errorf("unexpected config: %+v", e)
+	}
+
+	for _, input := range []string{
+		"etcd a b",
+		"etcd {\n\t\tusername caddy\n\t}",
+		"etcd {\n\t\tprefix\n\t}",
+		"etcd {\n\t\tbogus\n\t}",
+	} {
+		if err := (&EtcdDiscoverer{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package twingate
+
+import (
+	"context"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyevents"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultResyncEvent is subscribed to when resync_on is given without
+	// event names. Caddy emits it when a certificate, such as one for a new
+	// on-demand TLS host, has been obtained.
+	DefaultResyncEvent = "cert_obtained"
+
+	// resyncDebounce collects bursts of events into a single sync.
+	resyncDebounce = 5 * time.Second
+)
+
+// subscribeResyncEvents subscribes the app to the events in ResyncOn.
+// Subscriptions can only be made while provisioning.
+func (t *TwingateApp) subscribeResyncEvents() error {
+	if t.events == nil {
+		return nil
+	}
+	for _, name := range t.ResyncOn {
+		if err := t.events.On(name, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handle schedules a resync when a subscribed event names a host that has
+// no managed resource yet. It runs on the emitter's goroutine, so it only
+// schedules and never syncs inline.
+func (t *TwingateApp) Handle(ctx context.Context, e caddyevents.Event) error {
+	host, _ := e.Data["identifier"].(string)
+	if host != "" {
+		if !t.managesHost(normalizeHost(host)) {
+			return nil
+		}
+		if _, found := t.LookupResource(host); found {
+			return nil
+		}
+	}
+
+	t.scheduleResync(host)
+	return nil
+}
+
+// scheduleResync runs a sync after resyncDebounce, unless one is already
+// pending. Events arriving before Start are ignored, since Provision or
+// the initial sync will pick up the current state anyway.
+func (t *TwingateApp) scheduleResync(host string) {
+	t.resyncMu.Lock()
+	defer t.resyncMu.Unlock()
+
+	if t.resyncTimer != nil {
+		return
+	}
+	runCtx, done, ok := t.tasks.add("resync")
+	if !ok {
+		return
+	}
+
+	t.logger.Info("Scheduling resync after event",
+		zap.String("host", host),
+		zap.Duration("delay", resyncDebounce))
+
+	t.resyncDone = done
+	t.resyncTimer = time.AfterFunc(resyncDebounce, func() {
+		defer done()
+
+		t.resyncMu.Lock()
+		t.resyncTimer = nil
+		t.resyncDone = nil
+		t.resyncMu.Unlock()
+
+		ctx, cancel := context.WithTimeout(runCtx, 5*time.Minute)
+		defer cancel()
+
+		if err := t.requestSync(ctx, "event"); err != nil {
+			if runCtx.Err() != nil {
+				t.tasks.interrupt("resync")
+			}
+			t.logger.Error("Event-triggered resync failed", zap.Error(err))
+		}
+	})
+}
+
+// cancelResync stops a pending resync that has not started yet, recording
+// it as interrupted.
+func (t *TwingateApp) cancelResync() {
+	t.resyncMu.Lock()
+	defer t.resyncMu.Unlock()
+
+	if t.resyncTimer != nil && t.resyncTimer.Stop() {
+		t.tasks.interrupt("resync")
+		t.resyncDone()
+		t.resyncTimer = nil
+		t.resyncDone = nil
+	}
+}
+
+var _ caddyevents.Handler = (*TwingateApp)(nil)
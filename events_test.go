@@ -0,0 +1,74 @@
+package twingate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyevents"
+	"go.uber.org/zap"
+)
+
+func TestHandleSchedulesResyncForUnknownHost(t *testing.T) {
+	ctx := context.Background()
+	app := &TwingateApp{
+		logger:    zap.NewNop(),
+		resources: map[string]Resource{"api.example.com": newTestResource("r1", "api.example.com", "10.0.0.1", "net1")},
+	}
+	app.tasks.start()
+	defer app.cancelResync()
+
+	event := caddyevents.Event{Data: map[string]any{"identifier": "api.example.com"}}
+	if err := app.Handle(ctx, event); err != nil {
+		t.Fatalf("Handle() failed: %v", err)
+	}
+	if app.resyncTimer != nil {
+		t.Error("known host should not schedule a resync")
+	}
+
+	event = caddyevents.Event{Data: map[string]any{"identifier": "new.example.com"}}
+	if err := app.Handle(ctx, event); err != nil {
+		t.Fatalf("Handle() failed: %v", err)
+	}
+	if app.resyncTimer == nil {
+		t.Fatal("unknown host should schedule a resync")
+	}
+
+	first := app.resyncTimer
+	_ = app.Handle(ctx, caddyevents.Event{Data: map[string]any{"identifier": "other.example.com"}})
+	if app.resyncTimer != first {
+		t.Error("a pending resync should absorb further events")
+	}
+
+	app.cancelResync()
+	if app.resyncTimer != nil {
+		t.Error("cancelResync() should clear the pending resync")
+	}
+	if unfinished := app.tasks.shutdown(time.Second); len(unfinished) != 1 || unfinished[0] != "resync" {
+		t.Errorf("unfinished tasks = %v, want the canceled resync", unfinished)
+	}
+}
+
+func TestHandleIgnoredBeforeStart(t *testing.T) {
+	app := &TwingateApp{logger: zap.NewNop()}
+
+	_ = app.Handle(context.Background(), caddyevents.Event{Data: map[string]any{"identifier": "new.example.com"}})
+	if app.resyncTimer != nil {
+		t.Error("events before Start should be ignored")
+	}
+}
+
+func TestUnmarshalCaddyfile_ResyncOn(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		resync_on
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(app.ResyncOn) != 1 || app.ResyncOn[0] != DefaultResyncEvent {
+		t.Errorf("ResyncOn = %v, want [%s]", app.ResyncOn, DefaultResyncEvent)
+	}
+}
@@ -0,0 +1,143 @@
+package twingate
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// renderTerraform writes the manifest as resources for the Twingate
+// Terraform provider. Remote networks are declared as managed resources and
+// groups are looked up by name. The resources of each tenant block use a
+// provider alias named after the block's label.
+func renderTerraform(w io.Writer, m *Manifest) error {
+	names := newTerraformNames()
+
+	var b strings.Builder
+	if m.Tenant != "" {
+		fmt.Fprintf(&b, "# Generated by caddy twingate export for tenant %s\n", m.Tenant)
+		writeTerraformResources(&b, names, m, "")
+	}
+	for _, tenant := range m.Tenants {
+		fmt.Fprintf(&b, "\n# Tenant block %s (tenant %s)\n", tenant.Label, tenant.Tenant)
+		writeTerraformResources(&b, names, tenant, "twingate."+terraformIdentifier(tenant.Label))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeTerraformResources writes the blocks for the resources of m, using
+// provider if it is set.
+func writeTerraformResources(b *strings.Builder, names terraformNames, m *Manifest, provider string) {
+	networks := make(map[string]string)
+	groups := make(map[string]string)
+	for _, res := range m.Resources {
+		if _, ok := networks[res.RemoteNetwork]; !ok {
+			networks[res.RemoteNetwork] = ""
+		}
+		for _, group := range res.Groups {
+			groups[group] = ""
+		}
+	}
+
+	writeProvider := func() {
+		if provider != "" {
+			fmt.Fprintf(b, "  provider = %s\n", provider)
+		}
+	}
+
+	for _, network := range sortedKeys(networks) {
+		id := names.unique("twingate_remote_network", network)
+		networks[network] = id
+		fmt.Fprintf(b, "\nresource \"twingate_remote_network\" %q {\n", id)
+		writeProvider()
+		fmt.Fprintf(b, "  name = %s\n", strconv.Quote(network))
+		b.WriteString("}\n")
+	}
+
+	for _, group := range sortedKeys(groups) {
+		id := names.unique("twingate_groups", group)
+		groups[group] = id
+		fmt.Fprintf(b, "\ndata \"twingate_groups\" %q {\n", id)
+		writeProvider()
+		fmt.Fprintf(b, "  name = %s\n", strconv.Quote(group))
+		b.WriteString("}\n")
+	}
+
+	for _, res := range m.Resources {
+		id := names.unique("twingate_resource", res.Name)
+		fmt.Fprintf(b, "\nresource \"twingate_resource\" %q {\n", id)
+		writeProvider()
+		fmt.Fprintf(b, "  name              = %s\n", strconv.Quote(res.Name))
+		fmt.Fprintf(b, "  address           = %s\n", strconv.Quote(res.Address))
+		if res.Alias != nil {
+			fmt.Fprintf(b, "  alias             = %s\n", strconv.Quote(*res.Alias))
+		}
+		fmt.Fprintf(b, "  remote_network_id = twingate_remote_network.%s.id\n", networks[res.RemoteNetwork])
+		if len(res.Labels) > 0 {
+			b.WriteString("  tags = {\n")
+			for _, key := range sortedKeys(res.Labels) {
+				fmt.Fprintf(b, "    %s = %s\n", strconv.Quote(key), strconv.Quote(res.Labels[key]))
+			}
+			b.WriteString("  }\n")
+		}
+		for _, group := range res.Groups {
+			fmt.Fprintf(b, "\n  access_group {\n    group_id = data.twingate_groups.%s.groups[0].id\n  }\n", groups[group])
+		}
+		b.WriteString("}\n")
+	}
+}
+
+// terraformNames hands out unique Terraform identifiers per block type.
+type terraformNames map[string]map[string]bool
+
+func newTerraformNames() terraformNames {
+	return make(terraformNames)
+}
+
+func (n terraformNames) unique(blockType, value string) string {
+	base := terraformIdentifier(value)
+	if n[blockType] == nil {
+		n[blockType] = make(map[string]bool)
+	}
+
+	id := base
+	for i := 2; n[blockType][id]; i++ {
+		id = fmt.Sprintf("%s_%d", base, i)
+	}
+	n[blockType][id] = true
+	return id
+}
+
+// terraformIdentifier turns value into a valid Terraform identifier, for
+// example "*.dev.example.com" becomes "wildcard_dev_example_com".
+func terraformIdentifier(value string) string {
+	value = strings.ReplaceAll(strings.ToLower(value), "*", "wildcard")
+
+	var b strings.Builder
+	for _, c := range value {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+
+	id := b.String()
+	if id == "" || id[0] >= '0' && id[0] <= '9' {
+		id = "r_" + id
+	}
+	return id
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
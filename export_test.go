@@ -0,0 +1,102 @@
+package twingate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTerraform(t *testing.T) {
+	alias := "api.example.com"
+	manifest := &Manifest{
+		Tenant: "acme",
+		Resources: []ResourceMapping{
+			{Name: "api.example.com", Alias: &alias, Address: "10.0.0.1", RemoteNetwork: "Caddy-Managed", Labels: map[string]string{"team": "platform"}},
+			{Name: "*.dev.example.com", Address: "*.dev.example.com", RemoteNetwork: "Dev"},
+			{Name: "lab-net", Address: "10.10.0.0/24", RemoteNetwork: "Caddy-Managed", Groups: []string{"Engineering"}},
+		},
+	}
+
+	var b strings.Builder
+	if err := renderTerraform(&b, manifest); err != nil {
+		t.Fatalf("renderTerraform() failed: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		`resource "twingate_remote_network" "caddy_managed" {`,
+		`resource "twingate_remote_network" "dev" {`,
+		`data "twingate_groups" "engineering" {`,
+		`resource "twingate_resource" "api_example_com" {`,
+		`  alias             = "api.example.com"`,
+		`    "team" = "platform"`,
+		`resource "twingate_resource" "wildcard_dev_example_com" {`,
+		`  remote_network_id = twingate_remote_network.dev.id`,
+		`    group_id = data.twingate_groups.engineering.groups[0].id`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestTerraformNamesUnique(t *testing.T) {
+	names := newTerraformNames()
+
+	tests := []struct {
+		blockType, value, want string
+	}{
+		{"twingate_resource", "api.example.com", "api_example_com"},
+		{"twingate_resource", "api-example.com", "api_example_com_2"},
+		{"twingate_remote_network", "api.example.com", "api_example_com"},
+		{"twingate_resource", "10.0.0.1", "r_10_0_0_1"},
+	}
+
+	for _, tt := range tests {
+		if got := names.unique(tt.blockType, tt.value); got != tt.want {
+			t.Errorf("unique(%q, %q) = %q, want %q", tt.blockType, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRenderTerraform_TenantBlocks(t *testing.T) {
+	manifest := &Manifest{
+		Tenants: []*Manifest{
+			{
+				Tenant: "customer-a",
+				Label:  "a",
+				Resources: []ResourceMapping{
+					{Name: "app.customer-a.com", Address: "10.0.0.1", RemoteNetwork: "Caddy-Managed"},
+				},
+			},
+			{
+				Tenant: "customer-b",
+				Label:  "b",
+				Resources: []ResourceMapping{
+					{Name: "app.customer-b.com", Address: "10.0.0.1", RemoteNetwork: "Caddy-Managed"},
+				},
+			},
+		},
+	}
+
+	var b strings.Builder
+	if err := renderTerraform(&b, manifest); err != nil {
+		t.Fatalf("renderTerraform() failed: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# Tenant block a (tenant customer-a)",
+		`resource "twingate_remote_network" "caddy_managed" {`,
+		`resource "twingate_remote_network" "caddy_managed_2" {`,
+		"  provider = twingate.a\n",
+		"  provider = twingate.b\n",
+		`  remote_network_id = twingate_remote_network.caddy_managed_2.id`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Generated by caddy twingate export for tenant") {
+		t.Errorf("container-only manifest should not have a top-level header:\n%s", out)
+	}
+}
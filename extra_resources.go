@@ -0,0 +1,80 @@
+package twingate
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// ExtraResource declares a resource that does not correspond to any Caddy
+// route, such as a backend subnet exposed through the connector. Extra
+// resources are synced and cleaned up together with discovered ones.
+type ExtraResource struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Alias   string `json:"alias,omitempty"`
+
+	// Groups names the groups granted access to the resource.
+	Groups []string `json:"groups,omitempty"`
+
+	// RemoteNetwork overrides the app's remote network for this resource.
+	RemoteNetwork string `json:"remote_network,omitempty"`
+
+	// Profile names a profile whose settings apply where the resource
+	// sets none.
+	Profile string `json:"profile,omitempty"`
+}
+
+func (e ExtraResource) validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("name cannot be empty")
+	}
+	if err := validateResourceAddress(e.Address); err != nil {
+		return fmt.Errorf("%s: %w", e.Name, err)
+	}
+	if e.Alias != "" && !isDNSName(e.Alias) {
+		return fmt.Errorf("%s: alias '%s' is not a valid DNS name", e.Name, e.Alias)
+	}
+	return nil
+}
+
+// ToResourceMapping converts the declaration to the mapping synced to Twingate.
+func (e ExtraResource) ToResourceMapping() ResourceMapping {
+	mapping := ResourceMapping{
+		Name:          e.Name,
+		Address:       e.Address,
+		Groups:        e.Groups,
+		RemoteNetwork: e.RemoteNetwork,
+	}
+	if e.Alias != "" {
+		alias := e.Alias
+		mapping.Alias = &alias
+	}
+	return mapping
+}
+
+// appendExtraResources adds the configured extra resources to the discovered
+// mappings. Discovered mappings win when names collide.
+func (t *TwingateApp) appendExtraResources(mappings []ResourceMapping) []ResourceMapping {
+	seen := make(map[string]bool, len(mappings))
+	for _, m := range mappings {
+		seen[m.Name] = true
+	}
+
+	for _, extra := range t.ExtraResources {
+		if seen[extra.Name] {
+			t.logger.Warn("Extra resource has the same name as a discovered resource, ignoring it",
+				zap.String("name", extra.Name))
+			continue
+		}
+		seen[extra.Name] = true
+		// Profiles of extra resources are checked by Validate.
+		profile := t.Profiles[extra.Profile]
+		extra.RemoteNetwork, extra.Groups = profile.fill(extra.RemoteNetwork, extra.Groups)
+		mapping := extra.ToResourceMapping()
+		mapping.SecurityPolicy = profile.Policy
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings
+}
@@ -0,0 +1,105 @@
+package twingate
+
+import (
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func TestAppendExtraResources(t *testing.T) {
+	app := &TwingateApp{
+		logger: zap.NewNop(),
+		ExtraResources: []ExtraResource{
+			{Name: "lab-net", Address: "10.10.0.0/24"},
+			{Name: "api.example.com", Address: "10.0.0.9"},
+		},
+	}
+
+	mappings := app.appendExtraResources([]ResourceMapping{
+		{Name: "api.example.com", Address: "10.0.0.1"},
+	})
+
+	if len(mappings) != 2 {
+		t.Fatalf("expected 2 mappings, got %d: %+v", len(mappings), mappings)
+	}
+	if mappings[0].Address != "10.0.0.1" {
+		t.Errorf("discovered mapping should win, got address %s", mappings[0].Address)
+	}
+	if mappings[1].Name != "lab-net" || mappings[1].Address != "10.10.0.0/24" {
+		t.Errorf("unexpected extra mapping: %+v", mappings[1])
+	}
+}
+
+func TestUnmarshalCaddyfile_ExtraResource(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		extra_resource lab-net 10.10.0.0/24
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(app.ExtraResources) != 1 || app.ExtraResources[0].Address != "10.10.0.0/24" {
+		t.Errorf("unexpected extra resources: %+v", app.ExtraResources)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		extra_resource lab-net 10.10.0.0/33
+	}`))
+	if err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
+
+func TestUnmarshalCaddyfile_ExtraResourcesBlock(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		extra_resources {
+			nas 10.0.5.20
+			grafana {
+				address 10.0.5.30
+				alias grafana.internal
+				groups Engineering Ops
+				remote_network Monitoring
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(app.ExtraResources) != 2 {
+		t.Fatalf("expected 2 extra resources, got %+v", app.ExtraResources)
+	}
+	if app.ExtraResources[0].Name != "nas" || app.ExtraResources[0].Address != "10.0.5.20" {
+		t.Errorf("unexpected single-line entry: %+v", app.ExtraResources[0])
+	}
+
+	grafana := app.ExtraResources[1]
+	if grafana.Address != "10.0.5.30" || grafana.Alias != "grafana.internal" || grafana.RemoteNetwork != "Monitoring" {
+		t.Errorf("unexpected block entry: %+v", grafana)
+	}
+	if len(grafana.Groups) != 2 || grafana.Groups[1] != "Ops" {
+		t.Errorf("Groups = %v, want [Engineering Ops]", grafana.Groups)
+	}
+
+	mapping := grafana.ToResourceMapping()
+	if mapping.Alias == nil || *mapping.Alias != "grafana.internal" {
+		t.Errorf("mapping alias = %v, want grafana.internal", mapping.Alias)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		extra_resources {
+			broken {
+				alias broken.internal
+			}
+		}
+	}`))
+	if err == nil {
+		t.Error("expected error for extra resource without an address")
+	}
+}
@@ -0,0 +1,112 @@
+package twingate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultNodeNameTemplate names the resource of a host on one node of a
+// fleet.
+const DefaultNodeNameTemplate = "{host}@{node}"
+
+// FleetConfig declares the Caddy nodes that serve the discovered sites
+// from one shared config, as in an active/active deployment. A host
+// served by several nodes gets a resource per node, named by
+// NameTemplate and addressed at that node. A host served by a single
+// node gets one resource at that node's address, named and aliased like
+// any other host.
+type FleetConfig struct {
+	// Nodes are the nodes by label, such as web1.
+	Nodes map[string]FleetNode `json:"nodes"`
+
+	// NameTemplate names the per-node resources of a host, with {host}
+	// and {node} replaced. Defaults to {host}@{node}.
+	NameTemplate string `json:"name_template,omitempty"`
+}
+
+// FleetNode is one Caddy node of a fleet.
+type FleetNode struct {
+	// Address is the IPv4 address or DNS name the node's resources point
+	// at.
+	Address string `json:"address"`
+
+	// Hosts limits the hosts the node serves to those matching these
+	// patterns, such as *.eu.example.com. Empty serves every host.
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+func (f *FleetConfig) validate() error {
+	if len(f.Nodes) == 0 {
+		return fmt.Errorf("nodes needs at least one node")
+	}
+	for _, label := range f.labels() {
+		if label == "" {
+			return fmt.Errorf("nodes: node label cannot be empty")
+		}
+		if err := validateCaddyAddress(f.Nodes[label].Address); err != nil {
+			return fmt.Errorf("nodes: %s: %w", label, err)
+		}
+	}
+	if f.NameTemplate != "" && (!strings.Contains(f.NameTemplate, "{host}") || !strings.Contains(f.NameTemplate, "{node}")) {
+		return fmt.Errorf("nodes: name_template must contain {host} and {node}, got: %s", f.NameTemplate)
+	}
+	return nil
+}
+
+// labels returns the node labels in sorted order.
+func (f *FleetConfig) labels() []string {
+	labels := make([]string, 0, len(f.Nodes))
+	for label := range f.Nodes {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// addresses returns the addresses of all nodes, ordered by node label.
+func (f *FleetConfig) addresses() []string {
+	addrs := make([]string, 0, len(f.Nodes))
+	for _, label := range f.labels() {
+		addrs = append(addrs, f.Nodes[label].Address)
+	}
+	return addrs
+}
+
+// nodesFor returns the labels of the nodes serving host.
+func (f *FleetConfig) nodesFor(host string) []string {
+	var labels []string
+	for _, label := range f.labels() {
+		node := f.Nodes[label]
+		if len(node.Hosts) == 0 || matchHostPatterns(strings.ToLower(host), node.Hosts) {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// resourceName returns the name of host's resource on a node.
+func (f *FleetConfig) resourceName(host, node string) string {
+	template := f.NameTemplate
+	if template == "" {
+		template = DefaultNodeNameTemplate
+	}
+	return strings.NewReplacer("{host}", host, "{node}", node).Replace(template)
+}
+
+// endpointMappings returns the mappings of an endpoint across the nodes
+// serving it. Per-node resources carry no alias, since aliases must be
+// unique, and are tracked by node label so a node's new address updates
+// its resources in place.
+func (f *FleetConfig) endpointMappings(ep Endpoint) []ResourceMapping {
+	nodes := f.nodesFor(ep.Host)
+	if len(nodes) == 1 {
+		return []ResourceMapping{ep.ToResourceMapping(f.Nodes[nodes[0]].Address)}
+	}
+
+	mappings := make([]ResourceMapping, len(nodes))
+	for i, node := range nodes {
+		mappings[i] = ep.addressMapping(f.resourceName(ep.ResourceName(), node), f.Nodes[node].Address, "@node:"+node)
+	}
+	return mappings
+}
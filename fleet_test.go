@@ -0,0 +1,181 @@
+package twingate
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func TestFleetEndpointMappings(t *testing.T) {
+	fleet := &FleetConfig{Nodes: map[string]FleetNode{
+		"web1": {Address: "10.0.0.11"},
+		"web2": {Address: "10.0.0.12"},
+		"eu1":  {Address: "10.1.0.11", Hosts: []string{"*.eu.example.com"}},
+	}}
+
+	mappings := fleet.endpointMappings(Endpoint{Host: "app.example.com", Upstreams: []string{"localhost:9000"}})
+	var names, addrs []string
+	for _, m := range mappings {
+		names = append(names, m.Name)
+		addrs = append(addrs, m.Address)
+		if m.Alias != nil {
+			t.Errorf("per-node resource %s should have no alias", m.Name)
+		}
+	}
+	if want := []string{"app.example.com@web1", "app.example.com@web2"}; !slices.Equal(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+	if want := []string{"10.0.0.11", "10.0.0.12"}; !slices.Equal(addrs, want) {
+		t.Errorf("addresses = %v, want %v", addrs, want)
+	}
+	if mappings[0].Identity != "upstream:localhost:9000@node:web1" {
+		t.Errorf("identity = %q", mappings[0].Identity)
+	}
+
+	// Nodes without host patterns serve every host
+	mappings = fleet.endpointMappings(Endpoint{Host: "shop.eu.example.com"})
+	if len(mappings) != 3 {
+		t.Fatalf("mappings = %+v, want one per node", mappings)
+	}
+	fleet.Nodes["web1"] = FleetNode{Address: "10.0.0.11", Hosts: []string{"*.us.example.com"}}
+	fleet.Nodes["web2"] = FleetNode{Address: "10.0.0.12", Hosts: []string{"*.us.example.com"}}
+
+	// A host only one node serves keeps its plain name and alias
+	mappings = fleet.endpointMappings(Endpoint{Host: "shop.eu.example.com"})
+	if len(mappings) != 1 || mappings[0].Name != "shop.eu.example.com" || mappings[0].Address != "10.1.0.11" || mappings[0].Alias == nil {
+		t.Errorf("mappings = %+v, want a single aliased resource on eu1", mappings)
+	}
+
+	if mappings := fleet.endpointMappings(Endpoint{Host: "app.example.com"}); len(mappings) != 0 {
+		t.Errorf("mappings = %+v, want none for a host no node serves", mappings)
+	}
+}
+
+func TestFleetNameTemplate(t *testing.T) {
+	fleet := &FleetConfig{
+		Nodes:        map[string]FleetNode{"web1": {Address: "10.0.0.11"}, "web2": {Address: "10.0.0.12"}},
+		NameTemplate: "{node}.{host}",
+	}
+	mappings := fleet.endpointMappings(Endpoint{Host: "app.example.com"})
+	if len(mappings) != 2 || mappings[0].Name != "web1.app.example.com" || mappings[1].Name != "web2.app.example.com" {
+		t.Errorf("mappings = %+v", mappings)
+	}
+}
+
+func TestFleetValidate(t *testing.T) {
+	for _, fleet := range []FleetConfig{
+		{},
+		{Nodes: map[string]FleetNode{"web1": {}}},
+		{Nodes: map[string]FleetNode{"web1": {Address: "not an address"}}},
+		{Nodes: map[string]FleetNode{"web1": {Address: "10.0.0.11"}}, NameTemplate: "{host}"},
+	} {
+		if err := fleet.validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", fleet)
+		}
+	}
+
+	app := &TwingateApp{
+		Tenant:       "acme",
+		CaddyAddress: "10.0.0.5",
+		Fleet:        &FleetConfig{Nodes: map[string]FleetNode{"web1": {Address: "10.0.0.11"}}},
+	}
+	t.Setenv(DefaultAPIKeyEnv, "test-key")
+	if err := app.Validate(); err == nil {
+		t.Error("expected nodes and caddy_address to conflict")
+	}
+}
+
+func TestDiscoverMappings_Fleet(t *testing.T) {
+	app := &TwingateApp{
+		Fleet: &FleetConfig{Nodes: map[string]FleetNode{
+			"web1": {Address: "10.0.0.11"},
+			"web2": {Address: "10.0.0.12"},
+		}},
+		RoutesFrom: &RoutesSource{File: writeSourceConfig(t)},
+		logger:     zap.NewNop(),
+	}
+	mappings, err := app.discoverMappings(context.Background())
+	if err != nil {
+		t.Fatalf("discoverMappings() error = %v", err)
+	}
+	var names []string
+	for _, m := range mappings {
+		names = append(names, m.Name)
+	}
+	if want := []string{"app.example.com@web1", "app.example.com@web2"}; !slices.Equal(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
+
+func TestFleetWildcardHosts(t *testing.T) {
+	app := &TwingateApp{
+		Fleet: &FleetConfig{Nodes: map[string]FleetNode{
+			"web1": {Address: "10.0.0.11"},
+			"web2": {Address: "10.0.0.12", Hosts: []string{"*.eu.example.com"}},
+		}},
+		logger: zap.NewNop(),
+	}
+	wildcard := Endpoint{Host: "*.lab.example.com"}
+
+	// A wildcard only one node serves gets the wildcard as its alias
+	app.WildcardHosts = WildcardAlias
+	mappings := app.endpointMappings(wildcard, nil)
+	if len(mappings) != 1 || mappings[0].Address != "10.0.0.11" || mappings[0].Alias == nil || *mappings[0].Alias != "*.lab.example.com" {
+		t.Errorf("mappings = %+v, want one at web1 aliased to the wildcard", mappings)
+	}
+
+	// One served by several nodes gets a resource per node without alias
+	mappings = app.endpointMappings(Endpoint{Host: "*.eu.example.com"}, nil)
+	if len(mappings) != 2 || mappings[0].Alias != nil || mappings[1].Alias != nil {
+		t.Errorf("mappings = %+v, want two without alias", mappings)
+	}
+
+	// address publishes the wildcard itself once, whatever the nodes
+	app.WildcardHosts = WildcardAddress
+	mappings = app.endpointMappings(Endpoint{Host: "*.eu.example.com"}, nil)
+	if len(mappings) != 1 || mappings[0].Address != "*.eu.example.com" {
+		t.Errorf("mappings = %+v, want the wildcard as the address", mappings)
+	}
+}
+
+func TestUnmarshalCaddyfile_Nodes(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		nodes {
+			web1 10.0.0.11
+			eu1 eu1.internal.example.com {
+				hosts *.eu.example.com
+			}
+			name_template {host}@{node}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.Fleet == nil || len(app.Fleet.Nodes) != 2 || app.Fleet.NameTemplate != "{host}@{node}" {
+		t.Fatalf("Fleet = %+v", app.Fleet)
+	}
+	if node := app.Fleet.Nodes["eu1"]; node.Address != "eu1.internal.example.com" || !slices.Equal(node.Hosts, []string{"*.eu.example.com"}) {
+		t.Errorf("eu1 = %+v", node)
+	}
+
+	for _, input := range []string{
+		"nodes",
+		"nodes web1",
+		"nodes {\n\t\t\tweb1\n\t\t}",
+		"nodes {\n\t\t\tweb1 10.0.0.11 10.0.0.12\n\t\t}",
+		"nodes {\n\t\t\tweb1 10.0.0.11\n\t\t\tweb1 10.0.0.12\n\t\t}",
+		"nodes {\n\t\t\tweb1 10.0.0.11 {\n\t\t\t\tbogus\n\t\t\t}\n\t\t}",
+		"nodes {\n\t\t\tweb1 10.0.0.11\n\t\t\tname_template {node}\n\t\t}",
+	} {
+		app := &TwingateApp{}
+		err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n\t\ttenant acme\n\t\t" + input + "\n\t}"))
+		if err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
@@ -2,7 +2,13 @@ package twingate
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/hasura/go-graphql-client"
 	"go.uber.org/zap"
@@ -11,6 +17,25 @@ import (
 type TwingateClient struct {
 	client *graphql.Client
 	logger *zap.Logger
+
+	// breaker stops calls while the API is down. Nil disables it.
+	breaker *circuitBreaker
+
+	// rateLimit follows the rate limit the API reports. Nil disables it.
+	rateLimit *rateLimitTracker
+
+	// filterUnsupported is set once the API rejects the resources filter
+	// argument, after which lookups fall back to listing.
+	filterUnsupported atomic.Bool
+
+	// hashes holds the input hash CreateOrUpdateResource last applied to
+	// each resource, keyed by ID, so repeating a call is a no-op. The hash
+	// of a deleted resource is dropped.
+	hashes sync.Map
+
+	// schema holds the capabilities found by ProbeSchema. Nil until the
+	// schema is probed, when every capability is assumed.
+	schema atomic.Pointer[SchemaCapabilities]
 }
 
 func (c *TwingateClient) TestConnection(ctx context.Context) error {
@@ -22,12 +47,44 @@ func (c *TwingateClient) TestConnection(ctx context.Context) error {
 		} `graphql:"remoteNetworks(first: 1)"`
 	}
 
-	err := c.client.Query(ctx, &query, nil)
+	err := c.query(ctx, &query, nil)
 	if err != nil {
 		return fmt.Errorf("API connection test failed: %w", err)
 	}
 
-	c.logger.Debug("API connection test successful")
+	c.log(ctx).Debug("API connection test successful")
+	return nil
+}
+
+// preflightResourceID is a well-formed resource ID ("Resource:0") that
+// never exists, so a mutation of it changes nothing.
+const preflightResourceID = "UmVzb3VyY2U6MA=="
+
+// TestWriteAccess checks that the API key may make changes, which
+// TestConnection cannot tell, by updating a resource that does not exist.
+// A read-only key is refused with a permission error; any other outcome,
+// such as "not found", means writes are allowed.
+func (c *TwingateClient) TestWriteAccess(ctx context.Context) error {
+	var mutation struct {
+		ResourceUpdate struct {
+			OK    bool    `graphql:"ok"`
+			Error *string `graphql:"error"`
+		} `graphql:"resourceUpdate(id: $id)"`
+	}
+
+	err := c.mutate(ctx, &mutation, map[string]any{"id": graphql.ID(preflightResourceID)})
+	if err == nil && mutation.ResourceUpdate.Error != nil {
+		err = errors.New(*mutation.ResourceUpdate.Error)
+	}
+	if err == nil {
+		return nil
+	}
+
+	hinted := withHint(err)
+	if errors.Is(hinted, ErrPermissionDenied) || errors.Is(hinted, ErrInvalidAPIKey) {
+		return fmt.Errorf("API key cannot make changes: %w", hinted)
+	}
+	c.log(ctx).Debug("API write access check passed", zap.Error(err))
 	return nil
 }
 
@@ -37,7 +94,7 @@ func (c *TwingateClient) GetRemoteNetworks(ctx context.Context) ([]RemoteNetwork
 		"first": 100,
 	}
 
-	err := c.client.Query(ctx, &query, variables)
+	err := c.query(ctx, &query, variables)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query remote networks: %w", err)
 	}
@@ -47,26 +104,55 @@ func (c *TwingateClient) GetRemoteNetworks(ctx context.Context) ([]RemoteNetwork
 		networks[i] = edge.Node
 	}
 
-	c.logger.Debug("Retrieved remote networks", zap.Int("count", len(networks)))
+	c.log(ctx).Debug("Retrieved remote networks", zap.Int("count", len(networks)))
 	return networks, nil
 }
 
+// GetRemoteNetworkByName returns the remote network with the given name, or
+// nil if there is none. It fails with a DuplicateNetworkError if several
+// networks have the name, rather than picking one of them.
 func (c *TwingateClient) GetRemoteNetworkByName(ctx context.Context, name string) (*RemoteNetwork, error) {
 	networks, err := c.GetRemoteNetworks(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	var found *RemoteNetwork
+	var ids []string
 	for _, network := range networks {
 		if network.Name == name {
-			c.logger.Debug("Found remote network by name",
-				zap.String("name", name),
-				zap.String("id", network.ID))
-			return &network, nil
+			found = &network
+			ids = append(ids, network.ID)
 		}
 	}
+	if len(ids) > 1 {
+		return nil, &DuplicateNetworkError{Name: name, IDs: ids}
+	}
 
-	return nil, nil
+	if found != nil {
+		c.log(ctx).Debug("Found remote network by name",
+			zap.String("name", name),
+			zap.String("id", found.ID))
+	}
+	return found, nil
+}
+
+// GetRemoteNetwork returns the remote network with the given ID, or nil if
+// there is none.
+func (c *TwingateClient) GetRemoteNetwork(ctx context.Context, id string) (*RemoteNetwork, error) {
+	var query struct {
+		RemoteNetwork *RemoteNetwork `graphql:"remoteNetwork(id: $id)"`
+	}
+
+	variables := map[string]any{
+		"id": graphql.ID(id),
+	}
+
+	if err := c.query(ctx, &query, variables); err != nil {
+		return nil, fmt.Errorf("failed to query remote network: %w", err)
+	}
+
+	return query.RemoteNetwork, nil
 }
 
 func (c *TwingateClient) CreateRemoteNetwork(ctx context.Context, name string) (*RemoteNetwork, error) {
@@ -76,7 +162,7 @@ func (c *TwingateClient) CreateRemoteNetwork(ctx context.Context, name string) (
 		"name": name,
 	}
 
-	err := c.client.Mutate(ctx, &mutation, variables)
+	err := c.mutate(ctx, &mutation, variables)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create remote network: %w", err)
 	}
@@ -93,13 +179,77 @@ func (c *TwingateClient) CreateRemoteNetwork(ctx context.Context, name string) (
 		return nil, fmt.Errorf("remote network creation succeeded but no entity returned")
 	}
 
-	c.logger.Info("Created remote network",
+	c.log(ctx).Info("Created remote network",
 		zap.String("name", mutation.RemoteNetworkCreate.Entity.Name),
 		zap.String("id", mutation.RemoteNetworkCreate.Entity.ID))
 
 	return mutation.RemoteNetworkCreate.Entity, nil
 }
 
+// UpdateRemoteNetwork renames the remote network with the given ID.
+func (c *TwingateClient) UpdateRemoteNetwork(ctx context.Context, id, name string) (*RemoteNetwork, error) {
+	var mutation RemoteNetworkUpdateMutation
+
+	variables := map[string]any{
+		"id":   graphql.ID(id),
+		"name": name,
+	}
+
+	err := c.mutate(ctx, &mutation, variables)
+	if err != nil {
+		return nil, withHint(fmt.Errorf("failed to update remote network: %w", err))
+	}
+
+	if !mutation.RemoteNetworkUpdate.OK {
+		errorMsg := "unknown error"
+		if mutation.RemoteNetworkUpdate.Error != nil {
+			errorMsg = *mutation.RemoteNetworkUpdate.Error
+		}
+		return nil, withHint(fmt.Errorf("remote network update failed: %s", errorMsg))
+	}
+
+	if mutation.RemoteNetworkUpdate.Entity == nil {
+		return nil, fmt.Errorf("remote network update succeeded but no entity returned")
+	}
+
+	c.log(ctx).Info("Updated remote network",
+		zap.String("name", mutation.RemoteNetworkUpdate.Entity.Name),
+		zap.String("id", mutation.RemoteNetworkUpdate.Entity.ID))
+
+	return mutation.RemoteNetworkUpdate.Entity, nil
+}
+
+// DeleteRemoteNetwork deletes the remote network with the given ID. The
+// API refuses to delete a network that still has resources or connectors.
+func (c *TwingateClient) DeleteRemoteNetwork(ctx context.Context, id string) error {
+	var mutation struct {
+		RemoteNetworkDelete struct {
+			OK    bool    `graphql:"ok"`
+			Error *string `graphql:"error"`
+		} `graphql:"remoteNetworkDelete(id: $id)"`
+	}
+
+	variables := map[string]any{
+		"id": graphql.ID(id),
+	}
+
+	err := c.mutate(ctx, &mutation, variables)
+	if err != nil {
+		return withHint(fmt.Errorf("failed to delete remote network: %w", err))
+	}
+
+	if !mutation.RemoteNetworkDelete.OK {
+		errorMsg := "unknown error"
+		if mutation.RemoteNetworkDelete.Error != nil {
+			errorMsg = *mutation.RemoteNetworkDelete.Error
+		}
+		return withHint(fmt.Errorf("remote network deletion failed: %s", errorMsg))
+	}
+
+	c.log(ctx).Info("Deleted remote network", zap.String("id", id))
+	return nil
+}
+
 func (c *TwingateClient) GetOrCreateRemoteNetwork(ctx context.Context, name string) (*RemoteNetwork, error) {
 	network, err := c.GetRemoteNetworkByName(ctx, name)
 	if err != nil {
@@ -113,42 +263,187 @@ func (c *TwingateClient) GetOrCreateRemoteNetwork(ctx context.Context, name stri
 	return c.CreateRemoteNetwork(ctx, name)
 }
 
+// resourcesPageSize is the page size used when listing resources.
+const resourcesPageSize = 100
+
+// GetResources lists resources in a remote network, or the whole tenant when
+// remoteNetworkID is empty. Network-scoped listings query the network's own
+// resources connection so only that network's resources are transferred.
 func (c *TwingateClient) GetResources(ctx context.Context, remoteNetworkID string) ([]Resource, error) {
-	var query ResourcesQuery
-	variables := map[string]any{
-		"first": 100,
+	var (
+		resources []Resource
+		err       error
+	)
+	if remoteNetworkID == "" {
+		resources, err = c.getAllResources(ctx)
+	} else {
+		resources, err = c.getNetworkResources(ctx, remoteNetworkID)
 	}
-
-	err := c.client.Query(ctx, &query, variables)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query resources: %w", err)
+		return nil, err
 	}
 
+	c.log(ctx).Debug("Retrieved resources",
+		zap.Int("count", len(resources)),
+		zap.String("remote_network_id", remoteNetworkID))
+
+	return resources, nil
+}
+
+func (c *TwingateClient) getAllResources(ctx context.Context) ([]Resource, error) {
 	resources := make([]Resource, 0)
-	for _, edge := range query.Resources.Edges {
-		if remoteNetworkID == "" || edge.Node.RemoteNetwork.ID == remoteNetworkID {
+	var after *string
+
+	for {
+		var query ResourcesPageQuery
+		variables := map[string]any{
+			"first": resourcesPageSize,
+			"after": after,
+		}
+
+		if err := c.query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("failed to query resources: %w", err)
+		}
+
+		for _, edge := range query.Resources.Edges {
 			resources = append(resources, edge.Node)
 		}
+
+		if !query.Resources.PageInfo.HasNextPage || query.Resources.PageInfo.EndCursor == nil {
+			return resources, nil
+		}
+		after = query.Resources.PageInfo.EndCursor
 	}
+}
 
-	c.logger.Debug("Retrieved resources",
-		zap.Int("count", len(resources)),
-		zap.String("remote_network_id", remoteNetworkID))
+func (c *TwingateClient) getNetworkResources(ctx context.Context, remoteNetworkID string) ([]Resource, error) {
+	resources := make([]Resource, 0)
+	var after *string
 
-	return resources, nil
+	for {
+		var query RemoteNetworkResourcesQuery
+		variables := map[string]any{
+			"id":    graphql.ID(remoteNetworkID),
+			"first": resourcesPageSize,
+			"after": after,
+		}
+
+		if err := c.query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("failed to query resources: %w", err)
+		}
+
+		if query.RemoteNetwork == nil {
+			return nil, fmt.Errorf("remote network %s not found", remoteNetworkID)
+		}
+
+		for _, edge := range query.RemoteNetwork.Resources.Edges {
+			resources = append(resources, edge.Node)
+		}
+
+		pageInfo := query.RemoteNetwork.Resources.PageInfo
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == nil {
+			return resources, nil
+		}
+		after = pageInfo.EndCursor
+	}
+}
+
+// GetResource returns the resource with the given ID, or nil if there is
+// none.
+func (c *TwingateClient) GetResource(ctx context.Context, resourceID string) (*Resource, error) {
+	var query struct {
+		Resource *Resource `graphql:"resource(id: $id)"`
+	}
+
+	variables := map[string]any{
+		"id": graphql.ID(resourceID),
+	}
+
+	if err := c.query(ctx, &query, variables); err != nil {
+		return nil, fmt.Errorf("failed to query resource: %w", err)
+	}
+
+	return query.Resource, nil
 }
 
 func (c *TwingateClient) GetResourceByAlias(ctx context.Context, alias string, remoteNetworkID string) (*Resource, error) {
-	resources, err := c.GetResources(ctx, remoteNetworkID)
+	resource, err := c.findResource(ctx, ResourceFilterInput{
+		Alias: &StringFilterOperationInput{Eq: &alias},
+	}, remoteNetworkID, func(r Resource) bool {
+		return r.Alias != nil && *r.Alias == alias
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, resource := range resources {
-		if resource.Alias != nil && *resource.Alias == alias {
-			c.logger.Debug("Found resource by alias",
-				zap.String("alias", alias),
-				zap.String("id", resource.ID))
+	if resource != nil {
+		c.log(ctx).Debug("Found resource by alias",
+			zap.String("alias", alias),
+			zap.String("id", resource.ID))
+	}
+	return resource, nil
+}
+
+func (c *TwingateClient) GetResourceByName(ctx context.Context, name string, remoteNetworkID string) (*Resource, error) {
+	resource, err := c.findResource(ctx, ResourceFilterInput{
+		Name: &StringFilterOperationInput{Eq: &name},
+	}, remoteNetworkID, func(r Resource) bool {
+		return r.Name == name
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resource != nil {
+		c.log(ctx).Debug("Found resource by name",
+			zap.String("name", name),
+			zap.String("id", resource.ID))
+	}
+	return resource, nil
+}
+
+// findResource returns the first resource in remoteNetworkID that matches.
+// It asks the API to apply filter so at most one page is transferred, and
+// falls back to listing the network when the tenant's schema lacks the
+// filter argument. match is applied to the results either way.
+func (c *TwingateClient) findResource(ctx context.Context, filter ResourceFilterInput, remoteNetworkID string, match func(Resource) bool) (*Resource, error) {
+	var candidates []Resource
+
+	if !c.filterUnsupported.Load() {
+		var query FilteredResourcesQuery
+		variables := map[string]any{
+			"first":  resourcesPageSize,
+			"filter": filter,
+		}
+
+		err := c.query(ctx, &query, variables)
+		switch {
+		case err == nil:
+			for _, edge := range query.Resources.Edges {
+				candidates = append(candidates, edge.Node)
+			}
+		case isSchemaError(err):
+			c.log(ctx).Info("Resource filter not supported by API, falling back to listing",
+				zap.Error(err))
+			c.filterUnsupported.Store(true)
+		default:
+			return nil, fmt.Errorf("failed to query resources: %w", err)
+		}
+	}
+
+	if c.filterUnsupported.Load() {
+		resources, err := c.GetResources(ctx, remoteNetworkID)
+		if err != nil {
+			return nil, err
+		}
+		candidates = resources
+	}
+
+	for _, resource := range candidates {
+		if remoteNetworkID != "" && resource.RemoteNetwork.ID != remoteNetworkID {
+			continue
+		}
+		if match(resource) {
 			return &resource, nil
 		}
 	}
@@ -156,78 +451,440 @@ func (c *TwingateClient) GetResourceByAlias(ctx context.Context, alias string, r
 	return nil, nil
 }
 
-func (c *TwingateClient) CreateResource(ctx context.Context, input ResourceCreateInput) (*Resource, error) {
+// isSchemaError reports whether err is a GraphQL validation error caused by
+// the query using a field, argument or type the API does not define.
+func isSchemaError(err error) bool {
+	msg := err.Error()
+	for _, marker := range []string{
+		"Unknown argument",
+		"Unknown type",
+		"Cannot query field",
+		"is not defined by type",
+	} {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetGroupByName returns the group with the given name, or nil if there is
+// none.
+func (c *TwingateClient) GetGroupByName(ctx context.Context, name string) (*Group, error) {
+	var query FilteredGroupsQuery
+	variables := map[string]any{
+		"first":  2,
+		"filter": GroupFilterInput{Name: &StringFilterOperationInput{Eq: &name}},
+	}
+
+	if err := c.query(ctx, &query, variables); err != nil {
+		return nil, fmt.Errorf("failed to query groups: %w", err)
+	}
+
+	for _, edge := range query.Groups.Edges {
+		if edge.Node.Name == name {
+			return &edge.Node, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetGroups lists the groups matching filter, all of them with an empty
+// filter, following pagination.
+func (c *TwingateClient) GetGroups(ctx context.Context, filter GroupFilterInput) ([]Group, error) {
+	groups := make([]Group, 0)
+	var after *string
+
+	for {
+		var query GroupsPageQuery
+		variables := map[string]any{
+			"first":  resourcesPageSize,
+			"after":  after,
+			"filter": filter,
+		}
+
+		if err := c.query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("failed to query groups: %w", err)
+		}
+
+		for _, edge := range query.Groups.Edges {
+			groups = append(groups, edge.Node)
+		}
+
+		if !query.Groups.PageInfo.HasNextPage || query.Groups.PageInfo.EndCursor == nil {
+			c.log(ctx).Debug("Retrieved groups", zap.Int("count", len(groups)))
+			return groups, nil
+		}
+		after = query.Groups.PageInfo.EndCursor
+	}
+}
+
+// CreateGroup creates a group with the given users as its members.
+func (c *TwingateClient) CreateGroup(ctx context.Context, name string, userIDs []string) (*Group, error) {
+	var mutation GroupCreateMutation
+
+	variables := map[string]any{
+		"name":    name,
+		"userIds": graphqlIDs(userIDs),
+	}
+
+	err := c.mutate(ctx, &mutation, variables)
+	if err != nil {
+		return nil, withHint(fmt.Errorf("failed to create group: %w", err))
+	}
+
+	if !mutation.GroupCreate.OK {
+		errorMsg := "unknown error"
+		if mutation.GroupCreate.Error != nil {
+			errorMsg = *mutation.GroupCreate.Error
+		}
+		return nil, withHint(fmt.Errorf("group creation failed: %s", errorMsg))
+	}
+
+	if mutation.GroupCreate.Entity == nil {
+		return nil, fmt.Errorf("group creation succeeded but no entity returned")
+	}
+
+	c.log(ctx).Info("Created group",
+		zap.String("name", mutation.GroupCreate.Entity.Name),
+		zap.String("id", mutation.GroupCreate.Entity.ID))
+
+	return mutation.GroupCreate.Entity, nil
+}
+
+// DeleteGroup deletes the group with the given ID.
+func (c *TwingateClient) DeleteGroup(ctx context.Context, groupID string) error {
 	var mutation struct {
-		ResourceCreate struct {
-			OK     bool    `graphql:"ok"`
-			Error  *string `graphql:"error"`
-			Entity *struct {
-				ID      string `graphql:"id"`
-				Name    string `graphql:"name"`
-				Address struct {
-					Value string `graphql:"value"`
-				} `graphql:"address"`
-				Alias         *string `graphql:"alias"`
-				RemoteNetwork struct {
-					ID string `graphql:"id"`
-				} `graphql:"remoteNetwork"`
-			} `graphql:"entity"`
-		} `graphql:"resourceCreate(address: $address, name: $name, remoteNetworkId: $remoteNetworkId, alias: $alias)"`
+		GroupDelete struct {
+			OK    bool    `graphql:"ok"`
+			Error *string `graphql:"error"`
+		} `graphql:"groupDelete(id: $id)"`
+	}
+
+	variables := map[string]any{
+		"id": graphql.ID(groupID),
+	}
+
+	err := c.mutate(ctx, &mutation, variables)
+	if err != nil {
+		return withHint(fmt.Errorf("failed to delete group: %w", err))
+	}
+
+	if !mutation.GroupDelete.OK {
+		errorMsg := "unknown error"
+		if mutation.GroupDelete.Error != nil {
+			errorMsg = *mutation.GroupDelete.Error
+		}
+		return withHint(fmt.Errorf("group deletion failed: %s", errorMsg))
+	}
+
+	c.log(ctx).Info("Deleted group", zap.String("id", groupID))
+	return nil
+}
+
+// GetGroupMembers lists the users in a group, following pagination.
+func (c *TwingateClient) GetGroupMembers(ctx context.Context, groupID string) ([]User, error) {
+	users := make([]User, 0)
+	var after *string
+
+	for {
+		var query GroupUsersQuery
+		variables := map[string]any{
+			"id":    graphql.ID(groupID),
+			"first": resourcesPageSize,
+			"after": after,
+		}
+
+		if err := c.query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("failed to query group members: %w", err)
+		}
+
+		if query.Group == nil {
+			return nil, fmt.Errorf("group %s not found", groupID)
+		}
+
+		for _, edge := range query.Group.Users.Edges {
+			users = append(users, edge.Node)
+		}
+
+		pageInfo := query.Group.Users.PageInfo
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == nil {
+			return users, nil
+		}
+		after = pageInfo.EndCursor
+	}
+}
+
+// UpdateGroupMembers adds and removes users from a group.
+func (c *TwingateClient) UpdateGroupMembers(ctx context.Context, groupID string, addedUserIDs, removedUserIDs []string) error {
+	var mutation GroupUpdateMutation
+
+	variables := map[string]any{
+		"id":             graphql.ID(groupID),
+		"addedUserIds":   graphqlIDs(addedUserIDs),
+		"removedUserIds": graphqlIDs(removedUserIDs),
+	}
+
+	err := c.mutate(ctx, &mutation, variables)
+	if err != nil {
+		return withHint(fmt.Errorf("failed to update group members: %w", err))
+	}
+
+	if !mutation.GroupUpdate.OK {
+		errorMsg := "unknown error"
+		if mutation.GroupUpdate.Error != nil {
+			errorMsg = *mutation.GroupUpdate.Error
+		}
+		return withHint(fmt.Errorf("group update failed: %s", errorMsg))
+	}
+
+	c.log(ctx).Info("Updated group members",
+		zap.String("id", groupID),
+		zap.Int("added", len(addedUserIDs)),
+		zap.Int("removed", len(removedUserIDs)))
+	return nil
+}
+
+// GetSecurityPolicies lists the tenant's security policies, following
+// pagination.
+func (c *TwingateClient) GetSecurityPolicies(ctx context.Context) ([]SecurityPolicy, error) {
+	policies := make([]SecurityPolicy, 0)
+	var after *string
+
+	for {
+		var query SecurityPoliciesPageQuery
+		variables := map[string]any{
+			"first": resourcesPageSize,
+			"after": after,
+		}
+
+		if err := c.query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("failed to query security policies: %w", err)
+		}
+
+		for _, edge := range query.SecurityPolicies.Edges {
+			policies = append(policies, edge.Node)
+		}
+
+		pageInfo := query.SecurityPolicies.PageInfo
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == nil {
+			c.log(ctx).Debug("Retrieved security policies", zap.Int("count", len(policies)))
+			return policies, nil
+		}
+		after = pageInfo.EndCursor
+	}
+}
+
+// GetSecurityPolicyDetails lists the tenant's security policies with their
+// device requirements, following pagination. Schemas that do not expose
+// the requirements fail the query.
+func (c *TwingateClient) GetSecurityPolicyDetails(ctx context.Context) ([]SecurityPolicyDetails, error) {
+	policies := make([]SecurityPolicyDetails, 0)
+	var after *string
+
+	for {
+		var query SecurityPolicyDetailsPageQuery
+		variables := map[string]any{
+			"first": resourcesPageSize,
+			"after": after,
+		}
+
+		if err := c.query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("failed to query security policy details: %w", err)
+		}
+
+		for _, edge := range query.SecurityPolicies.Edges {
+			policies = append(policies, edge.Node)
+		}
+
+		pageInfo := query.SecurityPolicies.PageInfo
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == nil {
+			return policies, nil
+		}
+		after = pageInfo.EndCursor
+	}
+}
+
+// GetSecurityPolicyByName returns the security policy with the given name.
+// If there is none it fails with an UnknownSecurityPolicyError suggesting
+// the closest names, so a mistyped policy in the config is easy to fix.
+func (c *TwingateClient) GetSecurityPolicyByName(ctx context.Context, name string) (*SecurityPolicy, error) {
+	policies, err := c.GetSecurityPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(policies))
+	for i, policy := range policies {
+		if policy.Name == name {
+			return &policy, nil
+		}
+		names[i] = policy.Name
+	}
+	return nil, &UnknownSecurityPolicyError{Name: name, Suggestions: closestNames(name, names)}
+}
+
+// GetResourceSecurityPolicies returns the ID of the security policy set on
+// each resource in the tenant, keyed by resource ID. Resources without a
+// policy of their own, which fall under the tenant's default policy, map
+// to an empty ID.
+func (c *TwingateClient) GetResourceSecurityPolicies(ctx context.Context) (map[string]string, error) {
+	policies := make(map[string]string)
+	var after *string
+
+	for {
+		var query ResourcePoliciesQuery
+		variables := map[string]any{
+			"first": resourcesPageSize,
+			"after": after,
+		}
+
+		if err := c.query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("failed to query resource security policies: %w", err)
+		}
+
+		for _, edge := range query.Resources.Edges {
+			policies[edge.Node.ID] = ""
+			if edge.Node.SecurityPolicy != nil {
+				policies[edge.Node.ID] = edge.Node.SecurityPolicy.ID
+			}
+		}
+
+		pageInfo := query.Resources.PageInfo
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == nil {
+			return policies, nil
+		}
+		after = pageInfo.EndCursor
+	}
+}
+
+// GetResourcesWithoutAccess returns the IDs of the resources in the tenant
+// that no group or service account has access to. It reads only the first
+// principal of each resource, so one paginated query covers the tenant.
+func (c *TwingateClient) GetResourcesWithoutAccess(ctx context.Context) ([]string, error) {
+	var ids []string
+	var after *string
+
+	for {
+		var query ResourceAccessPresenceQuery
+		variables := map[string]any{
+			"first": resourcesPageSize,
+			"after": after,
+		}
+
+		if err := c.query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("failed to query resource access: %w", err)
+		}
+
+		for _, edge := range query.Resources.Edges {
+			if len(edge.Node.Access.Edges) == 0 {
+				ids = append(ids, edge.Node.ID)
+			}
+		}
+
+		pageInfo := query.Resources.PageInfo
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == nil {
+			return ids, nil
+		}
+		after = pageInfo.EndCursor
+	}
+}
+
+// graphqlIDs converts ids to a nullable ID list argument, nil when empty.
+func graphqlIDs(ids []string) *[]graphql.ID {
+	if len(ids) == 0 {
+		return nil
+	}
+	list := make([]graphql.ID, len(ids))
+	for i, id := range ids {
+		list[i] = graphql.ID(id)
+	}
+	return &list
+}
+
+// graphqlTags converts labels to a sorted tag list argument, or nil
+// without labels so that the argument is sent as null. Empty labels give
+// an empty list, which clears the tags.
+func graphqlTags(labels map[string]string) *[]TagInput {
+	if labels == nil {
+		return nil
+	}
+	tags := make([]TagInput, 0, len(labels))
+	for key, value := range labels {
+		tags = append(tags, TagInput{Key: key, Value: value})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+	return &tags
+}
+
+func (c *TwingateClient) GetUser(ctx context.Context, userID string) (*User, error) {
+	var query struct {
+		User *User `graphql:"user(id: $id)"`
 	}
 
+	variables := map[string]any{
+		"id": graphql.ID(userID),
+	}
+
+	if err := c.query(ctx, &query, variables); err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+
+	return query.User, nil
+}
+
+func (c *TwingateClient) CreateResource(ctx context.Context, input ResourceCreateInput) (*Resource, error) {
 	variables := map[string]any{
 		"name":            input.Name,
 		"address":         input.Address,
 		"remoteNetworkId": graphql.ID(input.RemoteNetworkID),
 		"alias":           input.Alias,
+		"groupIds":        graphqlIDs(input.GroupIDs),
+		"tags":            graphqlTags(input.Tags),
+		"protocols":       input.Protocols,
 	}
+	if input.SecurityPolicyID != "" {
+		variables["securityPolicyId"] = graphql.ID(input.SecurityPolicyID)
+	}
+	c.omitUnsupported(variables)
 
-	c.logger.Info("Creating resource with variables",
+	c.log(ctx).Debug("Creating resource with variables",
 		zap.String("name", input.Name),
 		zap.String("address", input.Address),
 		zap.String("remoteNetworkId", input.RemoteNetworkID))
 
-	err := c.client.Mutate(ctx, &mutation, variables)
+	mutation := newResourceMutation("resourceCreate", variables)
+	err := c.mutate(ctx, mutation.Interface(), variables)
 	if err != nil {
-		c.logger.Error("GraphQL mutation failed",
+		c.log(ctx).Error("GraphQL mutation failed",
 			zap.Error(err),
 			zap.String("error_type", fmt.Sprintf("%T", err)),
 			zap.String("error_string", err.Error()))
-		return nil, fmt.Errorf("failed to create resource: %w", err)
+		return nil, withHint(fmt.Errorf("failed to create resource: %w", err))
 	}
+	result := mutation.Elem().Field(0).Interface().(resourceMutationResult)
 
-	c.logger.Info("GraphQL mutation response",
-		zap.Bool("ok", mutation.ResourceCreate.OK),
-		zap.Any("error", mutation.ResourceCreate.Error),
-		zap.Any("entity", mutation.ResourceCreate.Entity))
+	c.log(ctx).Debug("GraphQL mutation response",
+		zap.Bool("ok", result.OK),
+		zap.Bool("entity", result.Entity != nil))
 
-	if !mutation.ResourceCreate.OK {
+	if !result.OK {
 		errorMsg := "unknown error"
-		if mutation.ResourceCreate.Error != nil {
-			errorMsg = *mutation.ResourceCreate.Error
+		if result.Error != nil {
+			errorMsg = *result.Error
 		}
-		c.logger.Error("Resource creation returned error",
+		c.log(ctx).Error("Resource creation returned error",
 			zap.String("error_message", errorMsg))
-		return nil, fmt.Errorf("resource creation failed: %s", errorMsg)
+		return nil, withHint(fmt.Errorf("resource creation failed: %s", errorMsg))
 	}
 
-	if mutation.ResourceCreate.Entity == nil {
+	if result.Entity == nil {
 		return nil, fmt.Errorf("resource creation succeeded but no entity returned")
 	}
 
-	resource := &Resource{
-		ID:   mutation.ResourceCreate.Entity.ID,
-		Name: mutation.ResourceCreate.Entity.Name,
-		Address: struct {
-			Value string `graphql:"value"`
-		}{Value: mutation.ResourceCreate.Entity.Address.Value},
-		Alias: mutation.ResourceCreate.Entity.Alias,
-		RemoteNetwork: struct {
-			ID string `graphql:"id"`
-		}{ID: mutation.ResourceCreate.Entity.RemoteNetwork.ID},
-	}
+	resource := result.Entity
 
-	c.logger.Info("Created resource",
+	c.log(ctx).Debug("Created resource",
 		zap.String("name", resource.Name),
 		zap.String("id", resource.ID),
 		zap.String("address", resource.Address.Value))
@@ -236,16 +893,9 @@ func (c *TwingateClient) CreateResource(ctx context.Context, input ResourceCreat
 }
 
 func (c *TwingateClient) UpdateResource(ctx context.Context, input ResourceUpdateInput) (*Resource, error) {
-	var mutation ResourceUpdateMutation
-
-	// All parameters must be provided to match the mutation signature
 	variables := map[string]any{
-		"id":      graphql.ID(input.ID),
-		"name":    "",
-		"address": "",
-		"alias":   "",
+		"id": graphql.ID(input.ID),
 	}
-
 	if input.Name != nil {
 		variables["name"] = *input.Name
 	}
@@ -255,30 +905,65 @@ func (c *TwingateClient) UpdateResource(ctx context.Context, input ResourceUpdat
 	if input.Alias != nil {
 		variables["alias"] = *input.Alias
 	}
+	if ids := graphqlIDs(input.AddedGroupIDs); ids != nil {
+		variables["addedGroupIds"] = ids
+	}
+	if input.Tags != nil {
+		variables["tags"] = graphqlTags(input.Tags)
+	}
+	if input.Protocols != nil {
+		variables["protocols"] = input.Protocols
+	}
+	c.omitUnsupported(variables)
 
-	err := c.client.Mutate(ctx, &mutation, variables)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update resource: %w", err)
+	mutation := newResourceMutation("resourceUpdate", variables)
+	if err := c.mutate(ctx, mutation.Interface(), variables); err != nil {
+		return nil, withHint(fmt.Errorf("failed to update resource: %w", err))
 	}
+	result := mutation.Elem().Field(0).Interface().(resourceMutationResult)
 
-	if !mutation.ResourceUpdate.OK {
+	if !result.OK {
 		errorMsg := "unknown error"
-		if mutation.ResourceUpdate.Error != nil {
-			errorMsg = *mutation.ResourceUpdate.Error
+		if result.Error != nil {
+			errorMsg = *result.Error
 		}
-		return nil, fmt.Errorf("resource update failed: %s", errorMsg)
+		return nil, withHint(fmt.Errorf("resource update failed: %s", errorMsg))
 	}
 
-	if mutation.ResourceUpdate.Entity == nil {
+	if result.Entity == nil {
 		return nil, fmt.Errorf("resource update succeeded but no entity returned")
 	}
 
-	c.logger.Info("Updated resource",
-		zap.String("name", mutation.ResourceUpdate.Entity.Name),
-		zap.String("id", mutation.ResourceUpdate.Entity.ID),
-		zap.String("address", mutation.ResourceUpdate.Entity.Address.Value))
+	c.log(ctx).Debug("Updated resource",
+		zap.String("name", result.Entity.Name),
+		zap.String("id", result.Entity.ID),
+		zap.String("address", result.Entity.Address.Value))
+
+	return result.Entity, nil
+}
+
+// newResourceMutation returns a pointer to a mutation struct selecting
+// field, resourceCreate or resourceUpdate, and passing exactly the given
+// variables, so arguments the caller leaves out are omitted from the
+// request rather than sent empty.
+func newResourceMutation(field string, variables map[string]any) reflect.Value {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]string, len(names))
+	for i, name := range names {
+		args[i] = name + ": $" + name
+	}
 
-	return mutation.ResourceUpdate.Entity, nil
+	mutationType := reflect.StructOf([]reflect.StructField{{
+		Name: "Result",
+		Type: reflect.TypeOf(resourceMutationResult{}),
+		Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"%s(%s)"`, field, strings.Join(args, ", "))),
+	}})
+	return reflect.New(mutationType)
 }
 
 func (c *TwingateClient) DeleteResource(ctx context.Context, resourceID string) error {
@@ -293,9 +978,9 @@ func (c *TwingateClient) DeleteResource(ctx context.Context, resourceID string)
 		"id": graphql.ID(resourceID),
 	}
 
-	err := c.client.Mutate(ctx, &mutation, variables)
+	err := c.mutate(ctx, &mutation, variables)
 	if err != nil {
-		return fmt.Errorf("failed to delete resource: %w", err)
+		return withHint(fmt.Errorf("failed to delete resource: %w", err))
 	}
 
 	if !mutation.ResourceDelete.OK {
@@ -303,49 +988,158 @@ func (c *TwingateClient) DeleteResource(ctx context.Context, resourceID string)
 		if mutation.ResourceDelete.Error != nil {
 			errorMsg = *mutation.ResourceDelete.Error
 		}
-		return fmt.Errorf("resource deletion failed: %s", errorMsg)
+		return withHint(fmt.Errorf("resource deletion failed: %s", errorMsg))
 	}
 
-	c.logger.Debug("Successfully deleted resource", zap.String("id", resourceID))
+	c.hashes.Delete(resourceID)
+	c.log(ctx).Debug("Successfully deleted resource", zap.String("id", resourceID))
 	return nil
 }
 
-func (c *TwingateClient) CreateOrUpdateResource(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) (*Resource, error) {
-	c.logger.Info("Processing resource mapping",
-		zap.String("name", mapping.Name),
-		zap.Any("alias", mapping.Alias),
-		zap.String("address", mapping.Address),
-		zap.String("remote_network_id", remoteNetworkID))
+// GetResourceAccess lists the groups and service accounts with access to
+// a resource.
+func (c *TwingateClient) GetResourceAccess(ctx context.Context, resourceID string) ([]AccessPrincipal, error) {
+	principals := make([]AccessPrincipal, 0)
+	var after *string
 
-	lookupAlias := mapping.Name
-	if mapping.Alias != nil {
-		lookupAlias = *mapping.Alias
+	for {
+		var query ResourceAccessQuery
+		variables := map[string]any{
+			"id":    graphql.ID(resourceID),
+			"first": resourcesPageSize,
+			"after": after,
+		}
+
+		if err := c.query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("failed to query resource access: %w", err)
+		}
+
+		if query.Resource == nil {
+			return nil, fmt.Errorf("resource %s not found", resourceID)
+		}
+
+		for _, edge := range query.Resource.Access.Edges {
+			node := edge.Node
+			id, name := node.Group.ID, node.Group.Name
+			if node.Typename == "ServiceAccount" {
+				id, name = node.ServiceAccount.ID, node.ServiceAccount.Name
+			}
+			principal := AccessPrincipal{ID: id, Type: node.Typename, Name: name}
+			if edge.SecurityPolicy != nil {
+				principal.SecurityPolicyID = edge.SecurityPolicy.ID
+			}
+			principals = append(principals, principal)
+		}
+
+		pageInfo := query.Resource.Access.PageInfo
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == nil {
+			return principals, nil
+		}
+		after = pageInfo.EndCursor
 	}
+}
 
-	existing, err := c.GetResourceByAlias(ctx, lookupAlias, remoteNetworkID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check for existing resource: %w", err)
+// AddResourceAccess grants groups and service accounts access to a
+// resource, each under the security policy it carries.
+func (c *TwingateClient) AddResourceAccess(ctx context.Context, resourceID string, principals []AccessPrincipal) error {
+	var mutation struct {
+		ResourceAccessAdd struct {
+			OK    bool    `graphql:"ok"`
+			Error *string `graphql:"error"`
+		} `graphql:"resourceAccessAdd(resourceId: $resourceId, access: $access)"`
+	}
+
+	access := make([]AccessInput, len(principals))
+	for i, principal := range principals {
+		access[i] = AccessInput{PrincipalID: principal.ID}
+		if principal.SecurityPolicyID != "" {
+			access[i].SecurityPolicyID = &principal.SecurityPolicyID
+		}
+	}
+	variables := map[string]any{
+		"resourceId": graphql.ID(resourceID),
+		"access":     access,
 	}
 
-	if existing != nil {
-		input := ResourceUpdateInput{
-			ID:      existing.ID,
-			Name:    &mapping.Name,
-			Address: &mapping.Address,
-			Alias:   mapping.Alias,
+	if err := c.mutate(ctx, &mutation, variables); err != nil {
+		return withHint(fmt.Errorf("failed to add resource access: %w", err))
+	}
+
+	if !mutation.ResourceAccessAdd.OK {
+		errorMsg := "unknown error"
+		if mutation.ResourceAccessAdd.Error != nil {
+			errorMsg = *mutation.ResourceAccessAdd.Error
 		}
-		return c.UpdateResource(ctx, input)
+		return withHint(fmt.Errorf("resource access add failed: %s", errorMsg))
+	}
+
+	c.log(ctx).Debug("Added resource access",
+		zap.String("id", resourceID),
+		zap.Int("principals", len(principals)))
+	return nil
+}
+
+// RemoveResourceAccess revokes the access of groups and service accounts
+// to a resource.
+func (c *TwingateClient) RemoveResourceAccess(ctx context.Context, resourceID string, principalIDs []string) error {
+	var mutation struct {
+		ResourceAccessRemove struct {
+			OK    bool    `graphql:"ok"`
+			Error *string `graphql:"error"`
+		} `graphql:"resourceAccessRemove(resourceId: $resourceId, principalIds: $principalIds)"`
 	}
 
-	input := ResourceCreateInput{
-		Name:            mapping.Name,
-		Address:         mapping.Address,
-		RemoteNetworkID: remoteNetworkID,
+	// principalIds is a required argument, so the list is not a pointer
+	ids := make([]graphql.ID, len(principalIDs))
+	for i, id := range principalIDs {
+		ids[i] = graphql.ID(id)
+	}
+	variables := map[string]any{
+		"resourceId":   graphql.ID(resourceID),
+		"principalIds": ids,
+	}
+
+	if err := c.mutate(ctx, &mutation, variables); err != nil {
+		return withHint(fmt.Errorf("failed to remove resource access: %w", err))
+	}
+
+	if !mutation.ResourceAccessRemove.OK {
+		errorMsg := "unknown error"
+		if mutation.ResourceAccessRemove.Error != nil {
+			errorMsg = *mutation.ResourceAccessRemove.Error
+		}
+		return withHint(fmt.Errorf("resource access removal failed: %s", errorMsg))
 	}
 
-	if mapping.Alias != nil {
-		input.Alias = *mapping.Alias
+	c.log(ctx).Debug("Removed resource access",
+		zap.String("id", resourceID),
+		zap.Int("principals", len(principalIDs)))
+	return nil
+}
+
+// CreateOrUpdateResource creates the resource for mapping, or updates the
+// one it already corresponds to. It compares them the way a sync does, so
+// an update is only sent when a field differs, or when groups, labels or
+// protocols differ from the last ones this client applied.
+func (c *TwingateClient) CreateOrUpdateResource(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) (*Resource, error) {
+	c.log(ctx).Debug("Processing resource mapping",
+		zap.String("name", mapping.Name),
+		zap.Any("alias", mapping.Alias),
+		zap.String("address", mapping.Address),
+		zap.String("remote_network_id", remoteNetworkID))
+
+	syncer := NewResourceSyncer(c, c.log(ctx))
+	syncer.loadHash = func(id string) (string, bool) {
+		hash, ok := c.hashes.Load(id)
+		if !ok {
+			return "", false
+		}
+		return hash.(string), true
 	}
 
-	return c.CreateResource(ctx, input)
+	resource, err := syncer.syncSingleResource(ctx, mapping, remoteNetworkID)
+	for id, hash := range syncer.Hashes() {
+		c.hashes.Store(id, hash)
+	}
+	return resource, err
 }
@@ -0,0 +1,584 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hasura/go-graphql-client"
+	"go.uber.org/zap"
+)
+
+// graphqlRequest is the body the client POSTs to the GraphQL endpoint.
+type graphqlRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+// newTestClient starts an httptest server that answers every GraphQL request
+// with the data returned by respond, and returns a client pointed at it. If
+// respond returns an error, it is sent as a GraphQL error instead.
+func newTestClient(t *testing.T, respond func(req graphqlRequest) any) *TwingateClient {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphqlRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		data := respond(req)
+		if err, ok := data.(error); ok {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"errors": []any{map[string]any{"message": err.Error()}},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(server.Close)
+
+	return &TwingateClient{
+		client: graphql.NewClient(server.URL, server.Client()),
+		logger: zap.NewNop(),
+	}
+}
+
+// resourceNode renders a resource the way the API returns it.
+func resourceNode(id, name, address, networkID string) map[string]any {
+	return map[string]any{
+		"node": map[string]any{
+			"id":            id,
+			"name":          name,
+			"address":       map[string]any{"value": address},
+			"alias":         nil,
+			"remoteNetwork": map[string]any{"id": networkID},
+		},
+	}
+}
+
+func TestGetResources_NetworkScopedPagination(t *testing.T) {
+	var requests []graphqlRequest
+
+	client := newTestClient(t, func(req graphqlRequest) any {
+		requests = append(requests, req)
+
+		if req.Variables["after"] == nil {
+			return map[string]any{
+				"remoteNetwork": map[string]any{
+					"resources": map[string]any{
+						"pageInfo": map[string]any{"hasNextPage": true, "endCursor": "c1"},
+						"edges":    []any{resourceNode("r1", "a.example.com", "10.0.0.1", "net1")},
+					},
+				},
+			}
+		}
+		return map[string]any{
+			"remoteNetwork": map[string]any{
+				"resources": map[string]any{
+					"pageInfo": map[string]any{"hasNextPage": false, "endCursor": "c2"},
+					"edges":    []any{resourceNode("r2", "b.example.com", "10.0.0.1", "net1")},
+				},
+			},
+		}
+	})
+
+	resources, err := client.GetResources(context.Background(), "net1")
+	if err != nil {
+		t.Fatalf("GetResources() failed: %v", err)
+	}
+
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+	if resources[0].ID != "r1" || resources[1].ID != "r2" {
+		t.Errorf("unexpected resources: %+v", resources)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	if !strings.Contains(requests[0].Query, "remoteNetwork(id: $id)") {
+		t.Errorf("expected network-scoped query, got: %s", requests[0].Query)
+	}
+	if requests[0].Variables["id"] != "net1" {
+		t.Errorf("expected id variable net1, got %v", requests[0].Variables["id"])
+	}
+	if requests[1].Variables["after"] != "c1" {
+		t.Errorf("expected second page after c1, got %v", requests[1].Variables["after"])
+	}
+}
+
+func TestGetResources_UnknownNetwork(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		return map[string]any{"remoteNetwork": nil}
+	})
+
+	if _, err := client.GetResources(context.Background(), "missing"); err == nil {
+		t.Error("GetResources() should fail for an unknown network")
+	}
+}
+
+func TestGetResources_TenantWide(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if strings.Contains(req.Query, "remoteNetwork(") {
+			t.Errorf("tenant-wide listing should not use the network query: %s", req.Query)
+		}
+		return map[string]any{
+			"resources": map[string]any{
+				"pageInfo": map[string]any{"hasNextPage": false},
+				"edges": []any{
+					resourceNode("r1", "a.example.com", "10.0.0.1", "net1"),
+					resourceNode("r2", "b.example.com", "10.0.0.1", "net2"),
+				},
+			},
+		}
+	})
+
+	resources, err := client.GetResources(context.Background(), "")
+	if err != nil {
+		t.Fatalf("GetResources() failed: %v", err)
+	}
+	if len(resources) != 2 {
+		t.Errorf("expected 2 resources, got %d", len(resources))
+	}
+}
+
+func TestGetResourceByName_ServerSideFilter(t *testing.T) {
+	var requests []graphqlRequest
+
+	client := newTestClient(t, func(req graphqlRequest) any {
+		requests = append(requests, req)
+		return map[string]any{
+			"resources": map[string]any{
+				"edges": []any{
+					resourceNode("r1", "api.example.com", "10.0.0.1", "other"),
+					resourceNode("r2", "api.example.com", "10.0.0.1", "net1"),
+				},
+			},
+		}
+	})
+
+	resource, err := client.GetResourceByName(context.Background(), "api.example.com", "net1")
+	if err != nil {
+		t.Fatalf("GetResourceByName() failed: %v", err)
+	}
+	if resource == nil || resource.ID != "r2" {
+		t.Fatalf("expected r2 from net1, got %+v", resource)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("expected a single request, got %d", len(requests))
+	}
+	filter, ok := requests[0].Variables["filter"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected filter variable, got %v", requests[0].Variables)
+	}
+	name, _ := filter["name"].(map[string]any)
+	if name["eq"] != "api.example.com" {
+		t.Errorf("expected name eq filter, got %v", filter)
+	}
+}
+
+func TestGetResourceByAlias_FallsBackWithoutFilter(t *testing.T) {
+	var filtered, listed int
+
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if strings.Contains(req.Query, "filter: $filter") {
+			filtered++
+			return errors.New(`Unknown argument "filter" on field "Query.resources".`)
+		}
+		listed++
+		alias := "api.example.com"
+		node := resourceNode("r1", "api", "10.0.0.1", "net1")
+		node["node"].(map[string]any)["alias"] = alias
+		return map[string]any{
+			"remoteNetwork": map[string]any{
+				"resources": map[string]any{
+					"pageInfo": map[string]any{"hasNextPage": false},
+					"edges":    []any{node},
+				},
+			},
+		}
+	})
+
+	for i := 0; i < 2; i++ {
+		resource, err := client.GetResourceByAlias(context.Background(), "api.example.com", "net1")
+		if err != nil {
+			t.Fatalf("GetResourceByAlias() failed: %v", err)
+		}
+		if resource == nil || resource.ID != "r1" {
+			t.Fatalf("expected r1, got %+v", resource)
+		}
+	}
+
+	if filtered != 1 {
+		t.Errorf("expected the filter to be tried once, got %d", filtered)
+	}
+	if listed != 2 {
+		t.Errorf("expected 2 listing fallbacks, got %d", listed)
+	}
+}
+
+func TestUpdateResource_SendsOnlySetFields(t *testing.T) {
+	var got graphqlRequest
+	client := newTestClient(t, func(req graphqlRequest) any {
+		got = req
+		node := resourceNode("r1", "api.example.com", "10.0.0.2", "net1")["node"]
+		return map[string]any{"resourceUpdate": map[string]any{"ok": true, "error": nil, "entity": node}}
+	})
+
+	address := "10.0.0.2"
+	res, err := client.UpdateResource(context.Background(), ResourceUpdateInput{ID: "r1", Address: &address})
+	if err != nil {
+		t.Fatalf("UpdateResource() failed: %v", err)
+	}
+	if res.Address.Value != "10.0.0.2" {
+		t.Errorf("unexpected entity: %+v", res)
+	}
+
+	if !strings.Contains(got.Query, "resourceUpdate(address: $address, id: $id)") {
+		t.Errorf("query should pass only address and id, got %s", got.Query)
+	}
+	for _, name := range []string{"name", "alias", "addedGroupIds", "tags"} {
+		if _, ok := got.Variables[name]; ok {
+			t.Errorf("unset field %s was sent: %v", name, got.Variables)
+		}
+	}
+
+	// An empty alias is sent, removing the alias
+	empty := ""
+	if _, err := client.UpdateResource(context.Background(), ResourceUpdateInput{ID: "r1", Alias: &empty}); err != nil {
+		t.Fatalf("UpdateResource() failed: %v", err)
+	}
+	if alias, ok := got.Variables["alias"]; !ok || alias != "" {
+		t.Errorf("alias = %v, want empty string", got.Variables["alias"])
+	}
+}
+
+func TestUpdateResource_Tags(t *testing.T) {
+	var got graphqlRequest
+	client := newTestClient(t, func(req graphqlRequest) any {
+		got = req
+		node := resourceNode("r1", "api.example.com", "10.0.0.1", "net1")["node"]
+		return map[string]any{"resourceUpdate": map[string]any{"ok": true, "error": nil, "entity": node}}
+	})
+
+	tags := map[string]string{"team": "platform", "env": "prod"}
+	if _, err := client.UpdateResource(context.Background(), ResourceUpdateInput{ID: "r1", Tags: tags}); err != nil {
+		t.Fatalf("UpdateResource() failed: %v", err)
+	}
+	if !strings.Contains(got.Query, "$tags:[TagInput!]") {
+		t.Errorf("tags should be declared as a TagInput list, got %s", got.Query)
+	}
+	list, _ := got.Variables["tags"].([]any)
+	if len(list) != 2 {
+		t.Fatalf("tags = %v, want 2 tags", got.Variables["tags"])
+	}
+	if first, _ := list[0].(map[string]any); first["key"] != "env" || first["value"] != "prod" {
+		t.Errorf("tags should be sorted by key, got %v", list)
+	}
+}
+
+func TestTestWriteAccess(t *testing.T) {
+	tests := []struct {
+		name     string
+		response any
+		wantErr  bool
+	}{
+		{
+			name:     "write key",
+			response: map[string]any{"resourceUpdate": map[string]any{"ok": false, "error": "resource not found"}},
+		},
+		{
+			name:     "read-only key",
+			response: errors.New("Permission denied: API key is read-only"),
+			wantErr:  true,
+		},
+		{
+			name:     "read-only key reported by the mutation",
+			response: map[string]any{"resourceUpdate": map[string]any{"ok": false, "error": "Not authorized"}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got graphqlRequest
+			client := newTestClient(t, func(req graphqlRequest) any {
+				got = req
+				return tt.response
+			})
+
+			err := client.TestWriteAccess(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TestWriteAccess() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrPermissionDenied) {
+				t.Errorf("expected a permission error, got %v", err)
+			}
+			if got.Variables["id"] != preflightResourceID {
+				t.Errorf("write check should target the preflight ID, got %v", got.Variables)
+			}
+		})
+	}
+}
+
+func TestGetResource(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if req.Variables["id"] != "r1" {
+			return map[string]any{"resource": nil}
+		}
+		return map[string]any{"resource": map[string]any{
+			"id":            "r1",
+			"name":          "app.example.com",
+			"address":       map[string]any{"value": "10.0.0.1"},
+			"alias":         nil,
+			"remoteNetwork": map[string]any{"id": "net1"},
+		}}
+	})
+
+	res, err := client.GetResource(context.Background(), "r1")
+	if err != nil {
+		t.Fatalf("GetResource() error = %v", err)
+	}
+	if res == nil || res.Name != "app.example.com" || res.RemoteNetwork.ID != "net1" {
+		t.Errorf("GetResource() = %+v", res)
+	}
+
+	res, err = client.GetResource(context.Background(), "missing")
+	if err != nil || res != nil {
+		t.Errorf("GetResource() of a missing ID = %+v, %v, want nil", res, err)
+	}
+}
+
+func TestGetResourceAccess(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if !strings.Contains(req.Query, "... on ServiceAccount") {
+			t.Errorf("access query should select service accounts, got %s", req.Query)
+		}
+		if req.Variables["after"] == nil {
+			return map[string]any{"resource": map[string]any{"access": map[string]any{
+				"pageInfo": map[string]any{"hasNextPage": true, "endCursor": "c1"},
+				"edges": []any{
+					map[string]any{"node": map[string]any{"__typename": "Group", "id": "g1", "name": "Engineering"}},
+				},
+			}}}
+		}
+		return map[string]any{"resource": map[string]any{"access": map[string]any{
+			"pageInfo": map[string]any{"hasNextPage": false, "endCursor": nil},
+			"edges": []any{
+				map[string]any{
+					"node":           map[string]any{"__typename": "ServiceAccount", "id": "sa1", "name": "ci"},
+					"securityPolicy": map[string]any{"id": "p1"},
+				},
+			},
+		}}}
+	})
+
+	principals, err := client.GetResourceAccess(context.Background(), "r1")
+	if err != nil {
+		t.Fatalf("GetResourceAccess() error = %v", err)
+	}
+	want := []AccessPrincipal{
+		{ID: "g1", Type: "Group", Name: "Engineering"},
+		{ID: "sa1", Type: "ServiceAccount", Name: "ci", SecurityPolicyID: "p1"},
+	}
+	if !slices.Equal(principals, want) {
+		t.Errorf("GetResourceAccess() = %+v, want %+v", principals, want)
+	}
+}
+
+func TestRemoveResourceAccess(t *testing.T) {
+	var got graphqlRequest
+	client := newTestClient(t, func(req graphqlRequest) any {
+		got = req
+		return map[string]any{"resourceAccessRemove": map[string]any{"ok": true, "error": nil}}
+	})
+
+	if err := client.RemoveResourceAccess(context.Background(), "r1", []string{"g1", "sa1"}); err != nil {
+		t.Fatalf("RemoveResourceAccess() error = %v", err)
+	}
+	if !strings.Contains(got.Query, "$principalIds:[ID!]!") {
+		t.Errorf("principalIds should be declared required, got %s", got.Query)
+	}
+	if got.Variables["resourceId"] != "r1" || len(got.Variables["principalIds"].([]any)) != 2 {
+		t.Errorf("unexpected variables: %v", got.Variables)
+	}
+}
+
+func TestCreateResource_Protocols(t *testing.T) {
+	var got graphqlRequest
+	client := newTestClient(t, func(req graphqlRequest) any {
+		got = req
+		node := resourceNode("r1", "db.example.com", "10.0.0.1", "net1")["node"]
+		return map[string]any{"resourceCreate": map[string]any{"ok": true, "error": nil, "entity": node}}
+	})
+
+	protocols := &ProtocolsInput{
+		AllowICMP: true,
+		TCP:       ProtocolInput{Policy: ProtocolRestricted, Ports: []PortRangeInput{{Start: 443, End: 443}}},
+		UDP:       ProtocolInput{Policy: ProtocolRestricted},
+	}
+	input := ResourceCreateInput{Name: "db.example.com", Address: "10.0.0.1", RemoteNetworkID: "net1", Protocols: protocols}
+	if _, err := client.CreateResource(context.Background(), input); err != nil {
+		t.Fatalf("CreateResource() failed: %v", err)
+	}
+	if !strings.Contains(got.Query, "$protocols:ProtocolsInput") {
+		t.Errorf("protocols should be declared as ProtocolsInput, got %s", got.Query)
+	}
+	tcp, _ := got.Variables["protocols"].(map[string]any)["tcp"].(map[string]any)
+	if tcp["policy"] != ProtocolRestricted || len(tcp["ports"].([]any)) != 1 {
+		t.Errorf("protocols = %v, want TCP restricted to 443", got.Variables["protocols"])
+	}
+
+	// Without protocols the argument is null, allowing all
+	input.Protocols = nil
+	if _, err := client.CreateResource(context.Background(), input); err != nil {
+		t.Fatalf("CreateResource() failed: %v", err)
+	}
+	if got.Variables["protocols"] != nil {
+		t.Errorf("protocols = %v, want null", got.Variables["protocols"])
+	}
+}
+
+func TestCreateOrUpdateResource_SkipsNoOpUpdates(t *testing.T) {
+	var updates int
+	client := newTestClient(t, func(req graphqlRequest) any {
+		node := resourceNode("r1", "api.example.com", "10.0.0.1", "net1")
+		node["node"].(map[string]any)["alias"] = "api.example.com"
+		if strings.Contains(req.Query, "resourceUpdate") {
+			updates++
+			return map[string]any{"resourceUpdate": map[string]any{"ok": true, "error": nil, "entity": node["node"]}}
+		}
+		if strings.Contains(req.Query, "resourceDelete") {
+			return map[string]any{"resourceDelete": map[string]any{"ok": true, "error": nil}}
+		}
+		return map[string]any{
+			"resources": map[string]any{
+				"edges": []any{node},
+			},
+		}
+	})
+
+	alias := "api.example.com"
+	mapping := ResourceMapping{Name: "api.example.com", Address: "10.0.0.1", Alias: &alias}
+	resource, err := client.CreateOrUpdateResource(context.Background(), mapping, "net1")
+	if err != nil {
+		t.Fatalf("CreateOrUpdateResource() failed: %v", err)
+	}
+	if resource.ID != "r1" || updates != 0 {
+		t.Errorf("an unchanged resource should not be updated, got %d updates", updates)
+	}
+
+	// Labels are not read back, so they are applied once and then skipped
+	// as long as they hash the same.
+	mapping.Labels = map[string]string{"env": "prod"}
+	for i := 0; i < 2; i++ {
+		if _, err := client.CreateOrUpdateResource(context.Background(), mapping, "net1"); err != nil {
+			t.Fatalf("CreateOrUpdateResource() failed: %v", err)
+		}
+	}
+	if updates != 1 {
+		t.Errorf("expected a single update for the new labels, got %d", updates)
+	}
+
+	// Deleting the resource drops its hash
+	if err := client.DeleteResource(context.Background(), "r1"); err != nil {
+		t.Fatalf("DeleteResource() failed: %v", err)
+	}
+	if _, ok := client.hashes.Load("r1"); ok {
+		t.Error("expected the hash of the deleted resource to be dropped")
+	}
+}
+
+func TestGetGroups_Paginates(t *testing.T) {
+	var filters []any
+	client := newTestClient(t, func(req graphqlRequest) any {
+		filters = append(filters, req.Variables["filter"])
+		if req.Variables["after"] == nil {
+			return map[string]any{"groups": map[string]any{
+				"pageInfo": map[string]any{"hasNextPage": true, "endCursor": "c1"},
+				"edges":    []any{map[string]any{"node": map[string]any{"id": "g1", "name": "Admins"}}},
+			}}
+		}
+		return map[string]any{"groups": map[string]any{
+			"pageInfo": map[string]any{"hasNextPage": false},
+			"edges":    []any{map[string]any{"node": map[string]any{"id": "g2", "name": "Admins-EU"}}},
+		}}
+	})
+
+	prefix := "Admins"
+	groups, err := client.GetGroups(context.Background(), GroupFilterInput{Name: &StringFilterOperationInput{StartsWith: &prefix}})
+	if err != nil {
+		t.Fatalf("GetGroups() failed: %v", err)
+	}
+	if len(groups) != 2 || groups[0].ID != "g1" || groups[1].ID != "g2" {
+		t.Errorf("expected both pages, got %+v", groups)
+	}
+	want := map[string]any{"name": map[string]any{"startsWith": "Admins"}}
+	if len(filters) != 2 || !reflect.DeepEqual(filters[0], want) || !reflect.DeepEqual(filters[1], want) {
+		t.Errorf("every page should send the filter, got %v", filters)
+	}
+}
+
+func TestGroupCRUD(t *testing.T) {
+	var mutations []graphqlRequest
+	client := newTestClient(t, func(req graphqlRequest) any {
+		switch {
+		case strings.Contains(req.Query, "groupCreate"):
+			mutations = append(mutations, req)
+			return map[string]any{"groupCreate": map[string]any{"ok": true, "entity": map[string]any{"id": "g1", "name": req.Variables["name"]}}}
+		case strings.Contains(req.Query, "groupUpdate"):
+			mutations = append(mutations, req)
+			return map[string]any{"groupUpdate": map[string]any{"ok": true, "entity": map[string]any{"id": "g1", "name": "Ops"}}}
+		case strings.Contains(req.Query, "groupDelete"):
+			mutations = append(mutations, req)
+			return map[string]any{"groupDelete": map[string]any{"ok": false, "error": "group is managed by SCIM"}}
+		default:
+			return map[string]any{"group": map[string]any{"users": map[string]any{
+				"pageInfo": map[string]any{"hasNextPage": false},
+				"edges": []any{
+					map[string]any{"node": map[string]any{"id": "u1", "email": "ada@example.com"}},
+					map[string]any{"node": map[string]any{"id": "u2", "email": "bob@example.com"}},
+				},
+			}}}
+		}
+	})
+	ctx := context.Background()
+
+	group, err := client.CreateGroup(ctx, "Ops", []string{"u1"})
+	if err != nil || group.ID != "g1" || group.Name != "Ops" {
+		t.Fatalf("CreateGroup() = %+v, %v", group, err)
+	}
+
+	members, err := client.GetGroupMembers(ctx, "g1")
+	if err != nil || len(members) != 2 || members[1].Email != "bob@example.com" {
+		t.Fatalf("GetGroupMembers() = %+v, %v", members, err)
+	}
+
+	if err := client.UpdateGroupMembers(ctx, "g1", []string{"u2"}, nil); err != nil {
+		t.Fatalf("UpdateGroupMembers() failed: %v", err)
+	}
+
+	if err := client.DeleteGroup(ctx, "g1"); err == nil || !strings.Contains(err.Error(), "SCIM") {
+		t.Errorf("expected the API error from DeleteGroup, got %v", err)
+	}
+
+	if len(mutations) != 3 {
+		t.Fatalf("expected three mutations, got %d", len(mutations))
+	}
+	if ids := mutations[0].Variables["userIds"]; !reflect.DeepEqual(ids, []any{"u1"}) {
+		t.Errorf("groupCreate userIds = %v", ids)
+	}
+	if vars := mutations[1].Variables; !reflect.DeepEqual(vars["addedUserIds"], []any{"u2"}) || vars["removedUserIds"] != nil {
+		t.Errorf("groupUpdate variables = %v", vars)
+	}
+}
@@ -0,0 +1,68 @@
+package twingate
+
+import "time"
+
+// defaultUnhealthyAfter is the default number of consecutive failed syncs
+// after which the app reports itself unhealthy.
+const defaultUnhealthyAfter = 3
+
+// Health reports whether syncs are succeeding. The app is unhealthy once
+// it, or any of its tenant blocks, has failed UnhealthyAfter syncs in a
+// row, and healthy again after the next successful sync.
+type Health struct {
+	Tenant              string     `json:"tenant,omitempty"`
+	Label               string     `json:"label,omitempty"`
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	UnhealthyAfter      int        `json:"unhealthy_after"`
+	LastSync            *time.Time `json:"last_sync,omitempty"`
+	LastSyncError       string     `json:"last_sync_error,omitempty"`
+
+	// Tenants holds the health of each tenant block.
+	Tenants []*Health `json:"tenants,omitempty"`
+}
+
+// recordHealth stores the health of the app itself as of the sync that
+// just ended. The caller holds syncMutex.
+func (t *TwingateApp) recordHealth() {
+	health := &Health{
+		Tenant:              t.Tenant,
+		Label:               t.label,
+		ConsecutiveFailures: t.failedSyncs,
+		UnhealthyAfter:      t.unhealthyAfter(),
+	}
+	if !t.lastSync.IsZero() {
+		lastSync := t.lastSync
+		health.LastSync = &lastSync
+	}
+	if t.lastSyncErr != nil {
+		health.LastSyncError = t.lastSyncErr.Error()
+	}
+	t.syncHealth.Store(health)
+}
+
+// health reports the health of the app and its tenant blocks as recorded
+// after their last syncs, so a probe never waits on a sync in progress.
+func (t *TwingateApp) health() *Health {
+	health := &Health{Tenant: t.Tenant, Label: t.label, UnhealthyAfter: t.unhealthyAfter()}
+	if recorded := t.syncHealth.Load(); recorded != nil {
+		*health = *recorded
+	}
+
+	health.Healthy = health.ConsecutiveFailures < health.UnhealthyAfter
+	for _, label := range t.tenantLabels() {
+		tenant := t.Tenants[label].health()
+		if !tenant.Healthy {
+			health.Healthy = false
+		}
+		health.Tenants = append(health.Tenants, tenant)
+	}
+	return health
+}
+
+func (t *TwingateApp) unhealthyAfter() int {
+	if t.UnhealthyAfter > 0 {
+		return t.UnhealthyAfter
+	}
+	return defaultUnhealthyAfter
+}
@@ -0,0 +1,166 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// Stages at which sync hooks are called.
+const (
+	HookBeforeSync   = "before_sync"
+	HookAfterSync    = "after_sync"
+	HookBeforeChange = "before_change"
+	HookAfterChange  = "after_change"
+)
+
+// Actions of a PlannedChange.
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// PlannedChange is a resource mutation a sync is about to make or has
+// made. Current is nil for creations and Desired for deletions. Diff holds
+// the fields an update changes; it is empty when an update only re-grants
+// groups.
+type PlannedChange struct {
+	Action     string            `json:"action"`
+	ResourceID string            `json:"resource_id,omitempty"`
+	Name       string            `json:"name"`
+	Current    *AppliedFields    `json:"current,omitempty"`
+	Desired    *AppliedFields    `json:"desired,omitempty"`
+	Diff       Diff              `json:"diff,omitempty"`
+	GroupIDs   []string          `json:"group_ids,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Protocols  *ProtocolsInput   `json:"protocols,omitempty"`
+}
+
+// HookEvent describes the point of a sync a hook is called at. Mappings is
+// set for the sync stages and Change for the change stages. Err is the
+// outcome at the after stages.
+type HookEvent struct {
+	Stage    string
+	Tenant   string
+	Mappings []ResourceMapping
+	Change   *PlannedChange
+	Err      error
+}
+
+// SyncHook is called before and after each sync and around each resource
+// mutation, for approval gates, notifications or recording changes
+// elsewhere. Hooks are Caddy modules in the twingate.hooks namespace.
+//
+// An error returned at a before stage stops the sync, or fails the change
+// as an API error would. Errors at after stages are only logged.
+type SyncHook interface {
+	HandleSyncHook(ctx context.Context, event HookEvent) error
+}
+
+// loadHooks loads the configured hook modules.
+func (t *TwingateApp) loadHooks(ctx caddy.Context) error {
+	if len(t.HooksRaw) == 0 {
+		return nil
+	}
+	mods, err := ctx.LoadModule(t, "HooksRaw")
+	if err != nil {
+		return fmt.Errorf("loading hooks: %w", err)
+	}
+	for _, mod := range mods.([]any) {
+		t.hooks = append(t.hooks, mod.(SyncHook))
+	}
+	return nil
+}
+
+// runHooks calls the hooks in order with event. At a before stage the
+// first error is returned and later hooks are not called.
+func (t *TwingateApp) runHooks(ctx context.Context, event HookEvent) error {
+	event.Tenant = t.Tenant
+	for _, hook := range t.hooks {
+		err := hook.HandleSyncHook(ctx, event)
+		if err == nil {
+			continue
+		}
+		name := hookName(hook)
+		if event.Stage == HookBeforeSync || event.Stage == HookBeforeChange {
+			return fmt.Errorf("hook %s: %w", name, err)
+		}
+		t.log(ctx).Warn("Sync hook failed",
+			zap.String("hook", name),
+			zap.String("stage", event.Stage),
+			zap.Error(err))
+	}
+	return nil
+}
+
+// hookChanges wires the hooks and the update event into syncer's
+// mutations.
+func (t *TwingateApp) hookChanges(syncer *ResourceSyncer) {
+	syncer.afterChange = func(ctx context.Context, change PlannedChange, err error) {
+		if err == nil && change.Action == ChangeUpdate {
+			t.emit(ctx, "twingate_resource_updated", map[string]any{
+				"id":     change.ResourceID,
+				"name":   change.Name,
+				"diff":   change.Diff,
+				"groups": change.GroupIDs,
+			})
+		}
+		t.reportChange(ctx, change, err)
+	}
+	if len(t.hooks) == 0 {
+		return
+	}
+	syncer.beforeChange = t.checkChange
+}
+
+// checkChange asks the hooks whether change may be made. The app calls it
+// directly for the mutations it makes outside a sync, such as deleting
+// the resource of an expired feed host or restoring a deleted one.
+func (t *TwingateApp) checkChange(ctx context.Context, change PlannedChange) error {
+	if len(t.hooks) == 0 {
+		return nil
+	}
+	return t.runHooks(ctx, HookEvent{Stage: HookBeforeChange, Change: &change})
+}
+
+// reportChange tells the hooks the outcome of change.
+func (t *TwingateApp) reportChange(ctx context.Context, change PlannedChange, err error) {
+	if len(t.hooks) > 0 {
+		t.runHooks(ctx, HookEvent{Stage: HookAfterChange, Change: &change, Err: err})
+	}
+}
+
+// hookName returns the module name of hook.
+func hookName(hook SyncHook) string {
+	if mod, ok := hook.(caddy.Module); ok {
+		return caddy.GetModuleName(mod)
+	}
+	return fmt.Sprintf("%T", hook)
+}
+
+// currentFields returns the attribute values resource has.
+func currentFields(resource Resource) *AppliedFields {
+	fields := AppliedFields{Name: resource.Name, Address: resource.Address.Value}
+	if resource.Alias != nil {
+		fields.Alias = *resource.Alias
+	}
+	return &fields
+}
+
+// checkChange asks the hooks whether change may be made.
+func (r *ResourceSyncer) checkChange(ctx context.Context, change PlannedChange) error {
+	if r.beforeChange == nil {
+		return nil
+	}
+	return r.beforeChange(ctx, change)
+}
+
+// reportChange tells the hooks the outcome of change.
+func (r *ResourceSyncer) reportChange(ctx context.Context, change PlannedChange, err error) {
+	if r.afterChange != nil {
+		r.afterChange(ctx, change, err)
+	}
+}
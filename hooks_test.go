@@ -0,0 +1,214 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(recordingHook{})
+}
+
+// recordingHook records the events it is called with and rejects the
+// changes of the actions in Reject.
+type recordingHook struct {
+	Reject []string `json:"reject,omitempty"`
+	events []HookEvent
+}
+
+func (recordingHook) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "twingate.hooks.test",
+		New: func() caddy.Module { return new(recordingHook) },
+	}
+}
+
+func (h *recordingHook) HandleSyncHook(_ context.Context, event HookEvent) error {
+	h.events = append(h.events, event)
+	if event.Stage == HookBeforeChange && slices.Contains(h.Reject, event.Change.Action) {
+		return errors.New("not approved")
+	}
+	return nil
+}
+
+func (h *recordingHook) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // hook name
+	h.Reject = d.RemainingArgs()
+	return nil
+}
+
+// stages returns the stage and, for changes, the action of each event.
+func (h *recordingHook) stages() []string {
+	var stages []string
+	for _, event := range h.events {
+		stage := event.Stage
+		if event.Change != nil {
+			stage += ":" + event.Change.Action + ":" + event.Change.Name
+		}
+		stages = append(stages, stage)
+	}
+	return stages
+}
+
+func TestSyncHooksAroundChanges(t *testing.T) {
+	existing := newTestResource("r1", "app.example.com", "10.0.0.5", "net1")
+	stale := newTestResource("r2", "old.example.com", "10.0.0.1", "net1")
+	mock := &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{"r1": existing, "r2": stale},
+	}
+	hook := &recordingHook{}
+	app := &TwingateApp{Tenant: "acme", logger: zap.NewNop(), hooks: []SyncHook{hook}}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop()}
+	app.hookChanges(syncer)
+
+	mappings := []ResourceMapping{
+		{Name: "app.example.com", Address: "10.0.0.1"},
+		{Name: "new.example.com", Address: "10.0.0.1"},
+	}
+	if err := syncer.SyncResources(context.Background(), mappings, "", &CleanupConfig{Enabled: true}); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+
+	want := []string{
+		"before_change:update:app.example.com", "after_change:update:app.example.com",
+		"before_change:create:new.example.com", "after_change:create:new.example.com",
+		"before_change:delete:old.example.com", "after_change:delete:old.example.com",
+	}
+	if got := hook.stages(); !slices.Equal(got, want) {
+		t.Errorf("hook stages = %v, want %v", got, want)
+	}
+
+	update := hook.events[0].Change
+	if update.ResourceID != "r1" || update.Current.Address != "10.0.0.5" || update.Desired.Address != "10.0.0.1" {
+		t.Errorf("unexpected update change: %+v", update)
+	}
+	if want := (Diff{FieldAddress: {Old: "10.0.0.5", New: "10.0.0.1"}}); !maps.Equal(update.Diff, want) {
+		t.Errorf("update diff = %v, want %v", update.Diff, want)
+	}
+	if created := hook.events[3]; created.Change.ResourceID == "" || created.Err != nil || created.Tenant != "acme" {
+		t.Errorf("after_change of a creation should carry the new ID, got %+v", created)
+	}
+}
+
+func TestSyncHooksRejectChanges(t *testing.T) {
+	stale := newTestResource("r2", "old.example.com", "10.0.0.1", "net1")
+	mock := &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{"r2": stale},
+	}
+	hook := &recordingHook{Reject: []string{ChangeCreate, ChangeDelete}}
+	app := &TwingateApp{logger: zap.NewNop(), hooks: []SyncHook{hook}}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop()}
+	app.hookChanges(syncer)
+
+	mappings := []ResourceMapping{{Name: "new.example.com", Address: "10.0.0.1"}}
+	err := syncer.SyncResources(context.Background(), mappings, "", &CleanupConfig{Enabled: true})
+	if err == nil {
+		t.Fatal("expected rejected changes to fail the sync")
+	}
+
+	if len(mock.Resources) != 1 || len(mock.DeletedIDs) != 0 {
+		t.Errorf("rejected changes should not be made, got %v deleted %v", mock.Resources, mock.DeletedIDs)
+	}
+	if failed := syncer.FailedMappings(); len(failed) != 1 || failed[0].Mapping.Name != "new.example.com" {
+		t.Errorf("rejected creation should be a failed mapping, got %+v", failed)
+	}
+	want := []string{"before_change:create:new.example.com", "before_change:delete:old.example.com"}
+	if got := hook.stages(); !slices.Equal(got, want) {
+		t.Errorf("hook stages = %v, want %v", got, want)
+	}
+}
+
+func TestHooksAroundAppChanges(t *testing.T) {
+	ctx := context.Background()
+	mock := &MockTwingateClient{
+		Resources: map[string]Resource{
+			"r1": newTestResource("r1", "gone.example.com", "10.0.0.1", "net1"),
+		},
+	}
+	hook := &recordingHook{Reject: []string{ChangeCreate}}
+	app := &TwingateApp{
+		Tenant:    "acme",
+		HostFeed:  &HostFeedConfig{TTL: caddy.Duration(time.Hour)},
+		feed:      newHostFeed(),
+		api:       mock,
+		logger:    zap.NewNop(),
+		hooks:     []SyncHook{hook},
+		state:     newStateStore(&certmagic.FileStorage{Path: t.TempDir()}, "acme"),
+		resources: map[string]Resource{"gone.example.com": mock.Resources["r1"]},
+	}
+	app.feed.restore(map[string]time.Time{"gone.example.com": time.Now().Add(-2 * time.Hour)})
+
+	// The resource of an expired feed host is deleted through the hooks
+	app.reapExpiredHosts(ctx, nil)
+	if !slices.Equal(mock.DeletedIDs, []string{"r1"}) {
+		t.Fatalf("expected r1 deleted, got %v", mock.DeletedIDs)
+	}
+
+	// and restoring it is a creation the hook rejects.
+	restored, err := app.undoDelete(ctx, []string{"gone.example.com"}, 0)
+	if err != nil {
+		t.Fatalf("undoDelete() failed: %v", err)
+	}
+	if len(restored) != 1 || restored[0].Error == "" || restored[0].ID != "" {
+		t.Errorf("rejected restore should fail, got %+v", restored)
+	}
+	if len(mock.Resources) != 0 {
+		t.Errorf("rejected restore should not create a resource, got %v", mock.Resources)
+	}
+	if state, _ := app.state.load(ctx); len(state.Deleted) != 1 {
+		t.Errorf("rejected restore should stay in the journal, got %+v", state.Deleted)
+	}
+
+	want := []string{
+		"before_change:delete:gone.example.com", "after_change:delete:gone.example.com",
+		"before_change:create:gone.example.com",
+	}
+	if got := hook.stages(); !slices.Equal(got, want) {
+		t.Errorf("hook stages = %v, want %v", got, want)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	first, second := &recordingHook{Reject: []string{ChangeDelete}}, &recordingHook{}
+	app := &TwingateApp{logger: zap.NewNop(), hooks: []SyncHook{first, second}}
+
+	change := &PlannedChange{Action: ChangeDelete, Name: "old.example.com"}
+	if err := app.runHooks(context.Background(), HookEvent{Stage: HookBeforeChange, Change: change}); err == nil {
+		t.Error("expected the rejection of the first hook")
+	}
+	if len(second.events) != 0 {
+		t.Error("hooks after a rejecting one should not be called")
+	}
+
+	if err := app.runHooks(context.Background(), HookEvent{Stage: HookAfterSync}); err != nil {
+		t.Errorf("after stages should not fail, got %v", err)
+	}
+	if len(second.events) != 1 {
+		t.Errorf("every hook should see after stages, got %d events", len(second.events))
+	}
+}
+
+func TestUnmarshalCaddyfile_Hook(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		hook test delete
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(app.HooksRaw) != 1 || string(app.HooksRaw[0]) != `{"hook":"test","reject":["delete"]}` {
+		t.Errorf("HooksRaw = %s", app.HooksRaw)
+	}
+}
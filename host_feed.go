@@ -0,0 +1,314 @@
+package twingate
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(FeedHandler{})
+	httpcaddyfile.RegisterHandlerDirective("twingate_feed", parseFeedHandler)
+	httpcaddyfile.RegisterDirectiveOrder("twingate_feed", httpcaddyfile.Before, "map")
+}
+
+const (
+	defaultHostFeedTTL = 24 * time.Hour
+
+	// maxFeedHosts bounds the hosts a feed tracks, so a flood of
+	// certificates cannot create unbounded resources.
+	maxFeedHosts = 1000
+)
+
+// HostFeedConfig enables the host feed: hosts served over TLS through the
+// twingate_feed handler become resources even though they are not in the
+// config, as with on-demand TLS. A host's resource is deleted once the
+// host has not been served for TTL.
+type HostFeedConfig struct {
+	// TTL is how long a host stays managed after it was last served.
+	// Defaults to 24h.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+
+	// Allow restricts recorded hosts to these names or *.suffix patterns.
+	// Empty allows any host that completed a TLS handshake.
+	Allow []string `json:"allow,omitempty"`
+}
+
+func (c *HostFeedConfig) ttl() time.Duration {
+	if c.TTL > 0 {
+		return time.Duration(c.TTL)
+	}
+	return defaultHostFeedTTL
+}
+
+func (c *HostFeedConfig) allows(host string) bool {
+	return len(c.Allow) == 0 || matchHostPatterns(host, c.Allow)
+}
+
+// hostFeed records when each host was last served.
+type hostFeed struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	now  func() time.Time
+}
+
+// hostFeeds holds a feed per tenant so observed hosts survive config
+// reloads, which replace the app instance.
+var (
+	hostFeedsMu sync.Mutex
+	hostFeeds   = make(map[string]*hostFeed)
+)
+
+func feedForTenant(tenant string) *hostFeed {
+	hostFeedsMu.Lock()
+	defer hostFeedsMu.Unlock()
+
+	feed, ok := hostFeeds[tenant]
+	if !ok {
+		feed = newHostFeed()
+		hostFeeds[tenant] = feed
+	}
+	return feed
+}
+
+func newHostFeed() *hostFeed {
+	return &hostFeed{
+		seen: make(map[string]time.Time),
+		now:  time.Now,
+	}
+}
+
+// observe records host as served now and reports whether it was new.
+func (f *hostFeed) observe(host string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, known := f.seen[host]
+	if !known && len(f.seen) >= maxFeedHosts {
+		return false
+	}
+	f.seen[host] = f.now()
+	return !known
+}
+
+// restore merges previously persisted observations, keeping the newest.
+func (f *hostFeed) restore(seen map[string]time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for host, at := range seen {
+		if at.After(f.seen[host]) {
+			f.seen[host] = at
+		}
+	}
+}
+
+// snapshot returns a copy of all observations.
+func (f *hostFeed) snapshot() map[string]time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seen := make(map[string]time.Time, len(f.seen))
+	for host, at := range f.seen {
+		seen[host] = at
+	}
+	return seen
+}
+
+// active returns the hosts served within ttl, sorted.
+func (f *hostFeed) active(ttl time.Duration) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cutoff := f.now().Add(-ttl)
+	var hosts []string
+	for host, at := range f.seen {
+		if !at.Before(cutoff) {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// expire removes and returns the hosts not served within ttl, sorted.
+func (f *hostFeed) expire(ttl time.Duration) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cutoff := f.now().Add(-ttl)
+	var expired []string
+	for host, at := range f.seen {
+		if at.Before(cutoff) {
+			expired = append(expired, host)
+			delete(f.seen, host)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// observeHost records the host of a request served over TLS and schedules
+// a resync if it has no resource yet. Only hosts that match the request's
+// SNI are recorded, so a bare Host header cannot create resources.
+func (t *TwingateApp) observeHost(r *http.Request) {
+	if t.feed == nil || r.TLS == nil {
+		return
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	if host != strings.ToLower(r.TLS.ServerName) || !isDNSName(host) || !t.HostFeed.allows(host) {
+		return
+	}
+
+	if !t.feed.observe(host) {
+		return
+	}
+	if _, found := t.LookupResource(host); !found {
+		t.scheduleResync(host)
+	}
+}
+
+// appendObservedHosts adds endpoints for the active feed hosts not already
+// discovered from the config.
+func (t *TwingateApp) appendObservedHosts(endpoints []Endpoint) []Endpoint {
+	if t.feed == nil {
+		return endpoints
+	}
+
+	known := make(map[string]bool, len(endpoints))
+	for _, ep := range endpoints {
+		known[ep.Host] = true
+	}
+
+	for _, host := range t.feed.active(t.HostFeed.ttl()) {
+		if !known[host] {
+			endpoints = append(endpoints, Endpoint{Host: host})
+		}
+	}
+	return endpoints
+}
+
+// reapExpiredHosts expires feed hosts past their TTL and deletes their
+// resources, unless a mapping still wants the host. It must be called
+// with syncMutex held.
+func (t *TwingateApp) reapExpiredHosts(ctx context.Context, mappings []ResourceMapping) {
+	if t.feed == nil {
+		return
+	}
+
+	wanted := make(map[string]bool, len(mappings))
+	for _, m := range mappings {
+		wanted[m.Name] = true
+	}
+
+	for _, host := range t.feed.expire(t.HostFeed.ttl()) {
+		for name, resource := range t.resources {
+			if name != host && !strings.HasPrefix(name, host+"@") || wanted[name] {
+				continue
+			}
+
+			if t.ReadOnly {
+				t.log(ctx).Info("Read-only, keeping resource for expired feed host",
+					zap.String("host", host),
+					zap.String("id", resource.ID))
+				continue
+			}
+			if t.ApprovalRequired {
+				// Left to resource cleanup, which plans its deletion
+				t.log(ctx).Info("Approval required, keeping resource for expired feed host",
+					zap.String("host", host),
+					zap.String("id", resource.ID))
+				continue
+			}
+			change := PlannedChange{Action: ChangeDelete, ResourceID: resource.ID, Name: resource.Name, Current: currentFields(resource)}
+			if err := t.checkChange(ctx, change); err != nil {
+				t.log(ctx).Warn("Keeping resource for expired feed host rejected by hook",
+					zap.String("host", host),
+					zap.String("id", resource.ID),
+					zap.Error(err))
+				continue
+			}
+			t.log(ctx).Info("Deleting resource for expired feed host",
+				zap.String("host", host),
+				zap.String("id", resource.ID))
+
+			if err := t.journalDeletion(ctx, resource); err != nil {
+				t.log(ctx).Error("Keeping resource for expired feed host that could not be journaled",
+					zap.String("host", host),
+					zap.Error(err))
+				continue
+			}
+			err := t.api.DeleteResource(ctx, resource.ID)
+			t.reportChange(ctx, change, err)
+			if err != nil {
+				t.log(ctx).Error("Failed to delete resource for expired feed host",
+					zap.String("host", host),
+					zap.Error(err))
+				continue
+			}
+			delete(t.resources, name)
+		}
+	}
+}
+
+// FeedHandler records the hosts it serves in the running Twingate app's
+// host feed. Place it in site blocks that use on-demand TLS.
+type FeedHandler struct{}
+
+func (FeedHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.twingate_feed",
+		New: func() caddy.Module { return new(FeedHandler) },
+	}
+}
+
+func (FeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if app := currentApp(); app != nil {
+		app.tenantFor(r.Host).observeHost(r)
+	}
+	return next.ServeHTTP(w, r)
+}
+
+// UnmarshalCaddyfile parses the twingate_feed directive, which takes no
+// arguments.
+func (FeedHandler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		if d.NextBlock(0) {
+			return d.Errf("twingate_feed does not take a block")
+		}
+	}
+	return nil
+}
+
+func parseFeedHandler(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(FeedHandler)
+	if err := handler.UnmarshalCaddyfile(h.Dispenser); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+var (
+	_ caddy.Module                = (*FeedHandler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*FeedHandler)(nil)
+	_ caddyfile.Unmarshaler       = (*FeedHandler)(nil)
+)
@@ -0,0 +1,132 @@
+package twingate
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func TestHostFeedExpire(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	feed := newHostFeed()
+	feed.now = func() time.Time { return now }
+
+	if !feed.observe("old.example.com") {
+		t.Error("first observation should be new")
+	}
+	if feed.observe("old.example.com") {
+		t.Error("repeated observation should not be new")
+	}
+
+	now = now.Add(2 * time.Hour)
+	feed.observe("fresh.example.com")
+
+	if active := feed.active(time.Hour); len(active) != 1 || active[0] != "fresh.example.com" {
+		t.Errorf("active = %v, want [fresh.example.com]", active)
+	}
+	if expired := feed.expire(time.Hour); len(expired) != 1 || expired[0] != "old.example.com" {
+		t.Errorf("expired = %v, want [old.example.com]", expired)
+	}
+	if _, ok := feed.snapshot()["old.example.com"]; ok {
+		t.Error("expired host should be removed")
+	}
+}
+
+func TestObserveHostRequiresMatchingSNI(t *testing.T) {
+	app := &TwingateApp{
+		HostFeed: &HostFeedConfig{Allow: []string{"*.tenant.example.com"}},
+		feed:     newHostFeed(),
+		logger:   zap.NewNop(),
+	}
+
+	tests := []struct {
+		host, sni string
+		recorded  bool
+	}{
+		{"a.tenant.example.com", "a.tenant.example.com", true},
+		{"b.tenant.example.com:443", "B.tenant.example.com", true},
+		{"c.tenant.example.com", "other.example.com", false},
+		{"d.example.org", "d.example.org", false},
+		{"plain.tenant.example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://"+tt.host+"/", nil)
+		if tt.sni != "" {
+			req.TLS = &tls.ConnectionState{ServerName: tt.sni}
+		}
+		app.observeHost(req)
+	}
+
+	seen := app.feed.snapshot()
+	for _, tt := range tests {
+		host := tt.host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if _, ok := seen[host]; ok != tt.recorded {
+			t.Errorf("host %s recorded = %v, want %v", tt.host, ok, tt.recorded)
+		}
+	}
+}
+
+func TestReapExpiredHosts(t *testing.T) {
+	now := time.Now()
+	mock := &MockTwingateClient{
+		Resources: map[string]Resource{
+			"r1": newTestResource("r1", "gone.example.com", "10.0.0.1", "net1"),
+			"r2": newTestResource("r2", "kept.example.com", "10.0.0.1", "net1"),
+		},
+	}
+	app := &TwingateApp{
+		HostFeed: &HostFeedConfig{TTL: caddy.Duration(time.Hour)},
+		feed:     newHostFeed(),
+		api:      mock,
+		logger:   zap.NewNop(),
+		resources: map[string]Resource{
+			"gone.example.com": mock.Resources["r1"],
+			"kept.example.com": mock.Resources["r2"],
+		},
+	}
+	app.feed.restore(map[string]time.Time{
+		"gone.example.com": now.Add(-2 * time.Hour),
+		"kept.example.com": now.Add(-2 * time.Hour),
+	})
+
+	// kept.example.com is also in the config, so its resource stays
+	app.reapExpiredHosts(context.Background(), []ResourceMapping{{Name: "kept.example.com"}})
+
+	if len(mock.DeletedIDs) != 1 || mock.DeletedIDs[0] != "r1" {
+		t.Errorf("expected only r1 deleted, got %v", mock.DeletedIDs)
+	}
+	if _, ok := app.resources["gone.example.com"]; ok {
+		t.Error("reaped resource should be removed from the index")
+	}
+}
+
+func TestUnmarshalCaddyfile_HostFeed(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		host_feed {
+			ttl 12h
+			allow *.customers.example.com
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.HostFeed == nil || time.Duration(app.HostFeed.TTL) != 12*time.Hour {
+		t.Fatalf("unexpected host feed config: %+v", app.HostFeed)
+	}
+	if !app.HostFeed.allows("a.customers.example.com") || app.HostFeed.allows("customers.example.org") {
+		t.Error("allow patterns not applied")
+	}
+}
@@ -0,0 +1,318 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule((*IdentityHandler)(nil))
+	httpcaddyfile.RegisterHandlerDirective("twingate_identity", parseIdentityHandler)
+	httpcaddyfile.RegisterDirectiveOrder("twingate_identity", httpcaddyfile.Before, "request_header")
+}
+
+const (
+	// DefaultIdentitySourceHeader is the request header the connector side
+	// is expected to carry the Twingate user ID or email in.
+	DefaultIdentitySourceHeader = "X-Twingate-Identity"
+
+	HeaderTwingateUser      = "X-Twingate-User"
+	HeaderTwingateUserID    = "X-Twingate-User-Id"
+	HeaderTwingateUserEmail = "X-Twingate-User-Email"
+	HeaderTwingateUserName  = "X-Twingate-User-Name"
+
+	defaultIdentityCacheTTL = 5 * time.Minute
+
+	// identityCacheSize bounds the number of looked-up users cached.
+	identityCacheSize = 1024
+)
+
+// IdentityHandler injects X-Twingate-User headers for requests that arrive
+// through a trusted Twingate connector. The identity is read from a header
+// set on the connector side and, with lookup enabled, resolved to the full
+// user record through the Twingate API.
+//
+// Incoming X-Twingate-User* headers are always stripped first, so upstream
+// apps can trust them regardless of where the request came from. The
+// source header is stripped too unless a trusted connector sent it.
+type IdentityHandler struct {
+	// TrustedConnectors lists the IPs or CIDR ranges of connector hosts.
+	TrustedConnectors []string `json:"trusted_connectors,omitempty"`
+
+	// SourceHeader names the header carrying the user ID or email.
+	// Defaults to X-Twingate-Identity.
+	SourceHeader string `json:"source_header,omitempty"`
+
+	// Lookup resolves user IDs through the Twingate API of the twingate app.
+	Lookup bool `json:"lookup,omitempty"`
+
+	// CacheTTL bounds how long looked-up users are cached. Defaults to 5m.
+	// At most 1024 users are cached; the one expiring first makes room.
+	CacheTTL caddy.Duration `json:"cache_ttl,omitempty"`
+
+	trusted    []netip.Prefix
+	lookupUser func(ctx context.Context, userID string) (*User, error)
+	logger     *zap.Logger
+
+	cacheMu sync.Mutex
+	cache   map[string]cachedUser
+}
+
+type cachedUser struct {
+	user    *User
+	expires time.Time
+}
+
+func (*IdentityHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.twingate_identity",
+		New: func() caddy.Module { return new(IdentityHandler) },
+	}
+}
+
+func (h *IdentityHandler) Provision(ctx caddy.Context) error {
+	h.logger = ctx.Logger(h)
+	h.cache = make(map[string]cachedUser)
+
+	if h.SourceHeader == "" {
+		h.SourceHeader = DefaultIdentitySourceHeader
+	}
+	if h.CacheTTL == 0 {
+		h.CacheTTL = caddy.Duration(defaultIdentityCacheTTL)
+	}
+
+	trusted, err := parsePrefixes(h.TrustedConnectors)
+	if err != nil {
+		return fmt.Errorf("trusted_connectors: %w", err)
+	}
+	h.trusted = trusted
+
+	if h.Lookup {
+		h.lookupUser = func(ctx context.Context, userID string) (*User, error) {
+			app := currentApp()
+			if app == nil {
+				return nil, fmt.Errorf("twingate app is not running")
+			}
+			return app.client.GetUser(ctx, userID)
+		}
+	}
+
+	return nil
+}
+
+func (h *IdentityHandler) Validate() error {
+	if len(h.TrustedConnectors) == 0 {
+		return fmt.Errorf("at least one trusted connector address is required")
+	}
+	return nil
+}
+
+func (h *IdentityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	for _, name := range []string{HeaderTwingateUser, HeaderTwingateUserID, HeaderTwingateUserEmail, HeaderTwingateUserName} {
+		r.Header.Del(name)
+	}
+
+	if !h.fromTrustedConnector(r) {
+		r.Header.Del(h.SourceHeader)
+		return next.ServeHTTP(w, r)
+	}
+	identity := r.Header.Get(h.SourceHeader)
+	if identity == "" {
+		return next.ServeHTTP(w, r)
+	}
+
+	if strings.Contains(identity, "@") || h.lookupUser == nil {
+		if strings.Contains(identity, "@") {
+			r.Header.Set(HeaderTwingateUserEmail, identity)
+		} else {
+			r.Header.Set(HeaderTwingateUserID, identity)
+		}
+		r.Header.Set(HeaderTwingateUser, identity)
+		return next.ServeHTTP(w, r)
+	}
+
+	user, err := h.resolveUser(r.Context(), identity)
+	if err != nil {
+		h.logger.Warn("Failed to resolve Twingate user",
+			zap.String("user_id", identity),
+			zap.Error(err))
+	}
+
+	r.Header.Set(HeaderTwingateUserID, identity)
+	if user != nil {
+		r.Header.Set(HeaderTwingateUser, user.Email)
+		r.Header.Set(HeaderTwingateUserEmail, user.Email)
+		if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+			r.Header.Set(HeaderTwingateUserName, name)
+		}
+	} else {
+		r.Header.Set(HeaderTwingateUser, identity)
+	}
+
+	return next.ServeHTTP(w, r)
+}
+
+func (h *IdentityHandler) fromTrustedConnector(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range h.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *IdentityHandler) resolveUser(ctx context.Context, userID string) (*User, error) {
+	h.cacheMu.Lock()
+	entry, ok := h.cache[userID]
+	h.cacheMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.user, nil
+	}
+
+	user, err := h.lookupUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	h.cacheMu.Lock()
+	if _, ok := h.cache[userID]; !ok && len(h.cache) >= identityCacheSize {
+		h.evictUser()
+	}
+	h.cache[userID] = cachedUser{
+		user:    user,
+		expires: time.Now().Add(time.Duration(h.CacheTTL)),
+	}
+	h.cacheMu.Unlock()
+
+	return user, nil
+}
+
+// evictUser makes room in the full user cache by dropping the expired
+// users or, if none has expired, the one expiring first. The caller holds
+// cacheMu.
+func (h *IdentityHandler) evictUser() {
+	now := time.Now()
+	var first string
+	for id, entry := range h.cache {
+		if !now.Before(entry.expires) {
+			delete(h.cache, id)
+		} else if first == "" || entry.expires.Before(h.cache[first].expires) {
+			first = id
+		}
+	}
+	if len(h.cache) >= identityCacheSize {
+		delete(h.cache, first)
+	}
+}
+
+// parsePrefixes parses CIDR ranges, accepting bare IPs as single-address ranges.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		if strings.Contains(v, "/") {
+			prefix, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// UnmarshalCaddyfile parses the twingate_identity directive:
+//
+//	twingate_identity {
+//	    trusted_connectors <ranges...>
+//	    source_header      <name>
+//	    lookup
+//	    cache_ttl          <duration>
+//	}
+func (h *IdentityHandler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "trusted_connectors":
+				ranges := d.RemainingArgs()
+				if len(ranges) == 0 {
+					return d.ArgErr()
+				}
+				h.TrustedConnectors = append(h.TrustedConnectors, ranges...)
+
+			case "source_header":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				h.SourceHeader = d.Val()
+
+			case "lookup":
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+				h.Lookup = true
+
+			case "cache_ttl":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				ttl, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid cache_ttl: %v", err)
+				}
+				h.CacheTTL = caddy.Duration(ttl)
+
+			default:
+				return d.Errf("unrecognized twingate_identity directive: %s", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+func parseIdentityHandler(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(IdentityHandler)
+	if err := handler.UnmarshalCaddyfile(h.Dispenser); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+var (
+	_ caddy.Module                = (*IdentityHandler)(nil)
+	_ caddy.Provisioner           = (*IdentityHandler)(nil)
+	_ caddy.Validator             = (*IdentityHandler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*IdentityHandler)(nil)
+	_ caddyfile.Unmarshaler       = (*IdentityHandler)(nil)
+)
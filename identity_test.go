@@ -0,0 +1,164 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func newTestIdentityHandler(t *testing.T, lookup func(ctx context.Context, userID string) (*User, error)) *IdentityHandler {
+	t.Helper()
+
+	trusted, err := parsePrefixes([]string{"10.1.0.0/16", "192.168.1.5"})
+	if err != nil {
+		t.Fatalf("parsePrefixes() failed: %v", err)
+	}
+
+	return &IdentityHandler{
+		SourceHeader: DefaultIdentitySourceHeader,
+		CacheTTL:     caddy.Duration(time.Minute),
+		trusted:      trusted,
+		lookupUser:   lookup,
+		logger:       zap.NewNop(),
+		cache:        make(map[string]cachedUser),
+	}
+}
+
+// serveIdentity runs a request through the handler and returns the headers
+// the next handler saw.
+func serveIdentity(t *testing.T, h *IdentityHandler, remoteAddr string, headers map[string]string) http.Header {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	var seen http.Header
+	next := caddyHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		seen = r.Header.Clone()
+		return nil
+	})
+
+	if err := h.ServeHTTP(httptest.NewRecorder(), req, next); err != nil {
+		t.Fatalf("ServeHTTP() failed: %v", err)
+	}
+	return seen
+}
+
+type caddyHandlerFunc func(http.ResponseWriter, *http.Request) error
+
+func (f caddyHandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	return f(w, r)
+}
+
+func TestIdentityHandler_TrustedConnector(t *testing.T) {
+	h := newTestIdentityHandler(t, nil)
+
+	seen := serveIdentity(t, h, "10.1.2.3:51000", map[string]string{
+		DefaultIdentitySourceHeader: "alice@example.com",
+	})
+
+	if got := seen.Get(HeaderTwingateUser); got != "alice@example.com" {
+		t.Errorf("%s = %q, want alice@example.com", HeaderTwingateUser, got)
+	}
+	if got := seen.Get(HeaderTwingateUserEmail); got != "alice@example.com" {
+		t.Errorf("%s = %q, want alice@example.com", HeaderTwingateUserEmail, got)
+	}
+}
+
+func TestIdentityHandler_UntrustedStripsSpoofedHeaders(t *testing.T) {
+	h := newTestIdentityHandler(t, nil)
+
+	seen := serveIdentity(t, h, "203.0.113.9:51000", map[string]string{
+		DefaultIdentitySourceHeader: "alice@example.com",
+		HeaderTwingateUser:          "admin@example.com",
+	})
+
+	if got := seen.Get(HeaderTwingateUser); got != "" {
+		t.Errorf("spoofed %s should be stripped, got %q", HeaderTwingateUser, got)
+	}
+	if got := seen.Get(DefaultIdentitySourceHeader); got != "" {
+		t.Errorf("untrusted %s should be stripped, got %q", DefaultIdentitySourceHeader, got)
+	}
+}
+
+func TestIdentityHandler_LookupIsCached(t *testing.T) {
+	calls := 0
+	h := newTestIdentityHandler(t, func(ctx context.Context, userID string) (*User, error) {
+		calls++
+		return &User{ID: userID, Email: "bob@example.com", FirstName: "Bob", LastName: "Smith"}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		seen := serveIdentity(t, h, "192.168.1.5:40000", map[string]string{
+			DefaultIdentitySourceHeader: "VXNlcjox",
+		})
+
+		if got := seen.Get(HeaderTwingateUser); got != "bob@example.com" {
+			t.Errorf("%s = %q, want bob@example.com", HeaderTwingateUser, got)
+		}
+		if got := seen.Get(HeaderTwingateUserID); got != "VXNlcjox" {
+			t.Errorf("%s = %q, want VXNlcjox", HeaderTwingateUserID, got)
+		}
+		if got := seen.Get(HeaderTwingateUserName); got != "Bob Smith" {
+			t.Errorf("%s = %q, want Bob Smith", HeaderTwingateUserName, got)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("expected 1 API lookup, got %d", calls)
+	}
+}
+
+func TestIdentityHandler_CacheIsBounded(t *testing.T) {
+	h := newTestIdentityHandler(t, func(ctx context.Context, userID string) (*User, error) {
+		return &User{ID: userID}, nil
+	})
+
+	for i := range identityCacheSize + 10 {
+		if _, err := h.resolveUser(context.Background(), fmt.Sprintf("user-%d", i)); err != nil {
+			t.Fatalf("resolveUser() failed: %v", err)
+		}
+	}
+	if len(h.cache) != identityCacheSize {
+		t.Errorf("cache holds %d users, want at most %d", len(h.cache), identityCacheSize)
+	}
+	if _, ok := h.cache[fmt.Sprintf("user-%d", identityCacheSize+9)]; !ok {
+		t.Error("the last looked-up user should be cached")
+	}
+}
+
+func TestIdentityHandlerUnmarshalCaddyfile(t *testing.T) {
+	h := &IdentityHandler{}
+	err := h.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate_identity {
+		trusted_connectors 10.1.0.0/16 192.168.1.5
+		source_header X-Connector-User
+		lookup
+		cache_ttl 10m
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(h.TrustedConnectors) != 2 {
+		t.Errorf("TrustedConnectors = %v, want 2 entries", h.TrustedConnectors)
+	}
+	if h.SourceHeader != "X-Connector-User" {
+		t.Errorf("SourceHeader = %q, want X-Connector-User", h.SourceHeader)
+	}
+	if !h.Lookup {
+		t.Error("Lookup should be enabled")
+	}
+	if time.Duration(h.CacheTTL) != 10*time.Minute {
+		t.Errorf("CacheTTL = %v, want 10m", time.Duration(h.CacheTTL))
+	}
+}
@@ -0,0 +1,363 @@
+package twingate_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	twingate "github.com/EngineeredDev/twingate-caddy"
+	"github.com/EngineeredDev/twingate-caddy/twingatetest"
+	"github.com/caddyserver/caddy/v2/caddytest"
+)
+
+// loadCaddyfile runs Caddy in-process with the given site blocks and a
+// twingate app pointed at fake. options are added to the twingate block.
+func loadCaddyfile(t *testing.T, fake *twingatetest.FakeAPI, options, sites string) *caddytest.Tester {
+	t.Helper()
+	t.Setenv("TWINGATE_API_KEY", "test-key")
+
+	return runCaddyfile(t, fmt.Sprintf(`
+		tenant acme
+		api_endpoint %s
+		caddy_address 10.0.0.1
+		%s
+	`, fake.URL, options), sites)
+}
+
+// runCaddyfile runs Caddy in-process with the given twingate block
+// contents and site blocks.
+func runCaddyfile(t *testing.T, twingate, sites string) *caddytest.Tester {
+	t.Helper()
+
+	// Caddy recognizes module maps by the json.RawMessage type, which
+	// toolchains built with encoding/json/v2 turn into an alias.
+	if reflect.TypeOf(json.RawMessage{}).PkgPath() != "encoding/json" {
+		t.Skip("Caddy cannot load module maps with this toolchain's encoding/json; run with GOEXPERIMENT=nojsonv2")
+	}
+
+	// Each test gets its own storage, so sync state recorded by one test
+	// does not match the resources of another.
+	tester := caddytest.NewTester(t)
+	tester.InitServer(fmt.Sprintf(`
+	{
+		skip_install_trust
+		admin localhost:2999
+		http_port 9080
+		https_port 9443
+		storage file_system %s
+		twingate {
+			%s
+		}
+	}
+	%s
+	`, t.TempDir(), twingate, sites), "caddyfile")
+
+	// Stop the twingate app so later tests don't see it.
+	t.Cleanup(func() {
+		caddytest.NewTester(t).InitServer(`
+		{
+			skip_install_trust
+			admin localhost:2999
+			http_port 9080
+			https_port 9443
+		}
+		`, "caddyfile")
+	})
+
+	return tester
+}
+
+func TestIntegration_SyncCreatesResources(t *testing.T) {
+	fake := twingatetest.NewFakeAPI(t)
+	engineering := fake.AddGroup("Engineering")
+
+	tester := loadCaddyfile(t, fake, `
+		extra_resources {
+			lab-net {
+				address 10.10.0.0/24
+				groups Engineering
+			}
+		}
+	`, `
+	http://api.localhost:9080 {
+		reverse_proxy localhost:9001
+	}
+	http://app.localhost:9080 {
+		reverse_proxy localhost:9002
+	}
+	`)
+	if t.Failed() {
+		return
+	}
+
+	want := []string{"api.localhost", "app.localhost", "lab-net"}
+	if got := fake.ResourceNames(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resources = %v, want %v", got, want)
+	}
+
+	network, ok := fake.RemoteNetworkByName("Caddy-Managed")
+	if !ok {
+		t.Fatal("expected the default remote network to be created")
+	}
+	for _, res := range fake.Resources() {
+		if res.RemoteNetwork.ID != network.ID {
+			t.Errorf("%s is in network %s, want %s", res.Name, res.RemoteNetwork.ID, network.ID)
+		}
+		if res.Name == "lab-net" && !reflect.DeepEqual(fake.Grants(res.ID), []string{engineering}) {
+			t.Errorf("lab-net grants = %v, want [%s]", fake.Grants(res.ID), engineering)
+		}
+		if res.Name == "api.localhost" && res.Address.Value != "10.0.0.1" {
+			t.Errorf("api.localhost address = %s, want 10.0.0.1", res.Address.Value)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:2999/twingate/status", nil)
+	tester.AssertResponseCode(req, http.StatusOK)
+
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost:2999/twingate/summary", nil)
+	resp := tester.AssertResponseCode(req, http.StatusOK)
+	defer resp.Body.Close()
+
+	var summary twingate.SyncSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatalf("decoding summary: %v", err)
+	}
+	if summary.ResourcesToCreate != 0 || summary.ResourcesToUpdate != 0 {
+		t.Errorf("after a sync the summary should plan no changes, got %+v", summary)
+	}
+}
+
+func TestIntegration_CleanupRemovesStaleResources(t *testing.T) {
+	fake := twingatetest.NewFakeAPI(t)
+	network := fake.AddRemoteNetwork("Caddy-Managed")
+	fake.AddResource(twingatetest.NewResource("", "old.localhost", "10.0.0.1", network.ID))
+	other := fake.AddRemoteNetwork("Office")
+	fake.AddResource(twingatetest.NewResource("", "printer", "10.20.0.5", other.ID))
+
+	loadCaddyfile(t, fake, `
+		resource_cleanup {
+			enabled true
+		}
+	`, `
+	http://api.localhost:9080 {
+		reverse_proxy localhost:9001
+	}
+	`)
+	if t.Failed() {
+		return
+	}
+
+	want := []string{"api.localhost", "printer"}
+	if got := fake.ResourceNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("resources = %v, want %v", got, want)
+	}
+}
+
+func TestIntegration_ManualCleanup(t *testing.T) {
+	fake := twingatetest.NewFakeAPI(t)
+	network := fake.AddRemoteNetwork("Caddy-Managed")
+	old := fake.AddResource(twingatetest.NewResource("", "old.localhost", "10.0.0.1", network.ID))
+	fake.AddResource(twingatetest.NewResource("", "older.localhost", "10.0.0.1", network.ID))
+
+	tester := loadCaddyfile(t, fake, "", `
+	http://api.localhost:9080 {
+		reverse_proxy localhost:9001
+	}
+	`)
+	if t.Failed() {
+		return
+	}
+
+	cleanup := func(body string) []twingate.CleanedResource {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, "http://localhost:2999/twingate/cleanup", strings.NewReader(body))
+		resp := tester.AssertResponseCode(req, http.StatusOK)
+		defer resp.Body.Close()
+
+		var result struct {
+			Resources []twingate.CleanedResource `json:"resources"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("decoding cleanup result: %v", err)
+		}
+		return result.Resources
+	}
+
+	// Without resource_cleanup, the sync leaves stale resources alone.
+	stale := cleanup(`{"dry_run": true}`)
+	if len(stale) != 2 || stale[0].Name != "old.localhost" || stale[0].Deleted {
+		t.Fatalf("dry run = %+v, want both stale resources, undeleted", stale)
+	}
+	want := []string{"api.localhost", "old.localhost", "older.localhost"}
+	if got := fake.ResourceNames(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("a dry run should delete nothing, resources = %v", got)
+	}
+
+	deleted := cleanup(fmt.Sprintf(`{"ids": [%q]}`, old.ID))
+	if len(deleted) != 1 || !deleted[0].Deleted || deleted[0].ID != old.ID {
+		t.Errorf("cleanup = %+v, want only %s deleted", deleted, old.ID)
+	}
+	want = []string{"api.localhost", "older.localhost"}
+	if got := fake.ResourceNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("resources = %v, want %v", got, want)
+	}
+}
+
+func TestIntegration_UpdatesExistingResource(t *testing.T) {
+	fake := twingatetest.NewFakeAPI(t)
+	network := fake.AddRemoteNetwork("Caddy-Managed")
+	alias := "api.localhost"
+	existing := twingatetest.NewResource("", "api.localhost", "10.9.9.9", network.ID)
+	existing.Alias = &alias
+	existing = fake.AddResource(existing)
+
+	loadCaddyfile(t, fake, "", `
+	http://api.localhost:9080 {
+		reverse_proxy localhost:9001
+	}
+	`)
+	if t.Failed() {
+		return
+	}
+
+	resources := fake.Resources()
+	if len(resources) != 1 {
+		t.Fatalf("expected the existing resource to be reused, got %v", fake.ResourceNames())
+	}
+	if resources[0].ID != existing.ID || resources[0].Address.Value != "10.0.0.1" {
+		t.Errorf("resource = %+v, want %s updated to 10.0.0.1", resources[0], existing.ID)
+	}
+}
+
+func TestIntegration_TenantBlocks(t *testing.T) {
+	customerA := twingatetest.NewFakeAPI(t)
+	customerB := twingatetest.NewFakeAPI(t)
+	t.Setenv("TWINGATE_API_KEY_A", "key-a")
+	t.Setenv("TWINGATE_API_KEY_B", "key-b")
+
+	runCaddyfile(t, fmt.Sprintf(`
+		caddy_address 10.0.0.1
+		tenants {
+			a {
+				tenant customer-a
+				api_endpoint %s
+				api_key_env TWINGATE_API_KEY_A
+				hosts *.customer-a.localhost
+			}
+			b {
+				tenant customer-b
+				api_endpoint %s
+				api_key_env TWINGATE_API_KEY_B
+			}
+		}
+	`, customerA.URL, customerB.URL), `
+	http://shop.customer-a.localhost:9080 {
+		reverse_proxy localhost:9001
+	}
+	http://api.localhost:9080 {
+		reverse_proxy localhost:9002
+	}
+	`)
+	if t.Failed() {
+		return
+	}
+
+	if got := customerA.ResourceNames(); !reflect.DeepEqual(got, []string{"shop.customer-a.localhost"}) {
+		t.Errorf("customer-a resources = %v", got)
+	}
+	if got := customerB.ResourceNames(); !reflect.DeepEqual(got, []string{"api.localhost"}) {
+		t.Errorf("customer-b resources = %v", got)
+	}
+}
+
+func TestIntegration_TenantAutoDetectedAtStart(t *testing.T) {
+	fake := twingatetest.NewFakeAPI(t)
+	t.Setenv("TWINGATE_API_KEY", "test-key")
+	t.Setenv(twingate.TenantEnv, "")
+
+	lookups := 0
+	lookup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		_, _ = w.Write([]byte(`{"tenant": "acme"}`))
+	}))
+	defer lookup.Close()
+
+	runCaddyfile(t, fmt.Sprintf(`
+		tenant auto
+		tenant_lookup_url %s
+		api_endpoint %s
+		caddy_address 10.0.0.1
+		skip_connection_test
+	`, lookup.URL, fake.URL), `
+	http://api.localhost:9080 {
+		reverse_proxy localhost:9001
+	}
+	`)
+	if t.Failed() {
+		return
+	}
+
+	if lookups != 1 {
+		t.Errorf("tenant lookups = %d, want one at start", lookups)
+	}
+	if got := fake.ResourceNames(); !reflect.DeepEqual(got, []string{"api.localhost"}) {
+		t.Errorf("resources = %v", got)
+	}
+}
+
+func TestIntegration_SchemaWithoutTags(t *testing.T) {
+	fake := twingatetest.NewFakeAPI(t)
+	fake.WithoutArguments("tags")
+
+	loadCaddyfile(t, fake, "", `
+	http://api.localhost:9080 {
+		twingate_label team web
+		reverse_proxy localhost:9001
+	}
+	`)
+	if t.Failed() {
+		return
+	}
+
+	resources := fake.Resources()
+	if len(resources) != 1 {
+		t.Fatalf("expected the resource to be created without tags, got %v", fake.ResourceNames())
+	}
+	if tags := fake.Tags(resources[0].ID); len(tags) != 0 {
+		t.Errorf("tags = %v, want none on a schema without tags", tags)
+	}
+}
+
+func TestIntegration_ReadOnlyKey(t *testing.T) {
+	fake := twingatetest.NewFakeAPI(t)
+	fake.AddRemoteNetwork("Caddy-Managed")
+	fake.ReadOnlyKey()
+
+	tester := loadCaddyfile(t, fake, "read_only", `
+	http://api.localhost:9080 {
+		reverse_proxy localhost:9001
+	}
+	`)
+	if t.Failed() {
+		return
+	}
+	if names := fake.ResourceNames(); len(names) != 0 {
+		t.Errorf("a read_only app should not create resources, got %v", names)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:2999/twingate/summary", nil)
+	resp := tester.AssertResponseCode(req, http.StatusOK)
+	defer resp.Body.Close()
+
+	var summary twingate.SyncSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatalf("decoding summary: %v", err)
+	}
+	if summary.ResourcesToCreate != 1 {
+		t.Errorf("the summary should plan the resource, got %+v", summary)
+	}
+}
@@ -0,0 +1,230 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// deletedRetention is how long deleted resources stay in the journal.
+const deletedRetention = 7 * 24 * time.Hour
+
+// DeletedResource is the definition of a resource as it was just before
+// the plugin deleted it.
+type DeletedResource struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Address         string    `json:"address"`
+	Alias           string    `json:"alias,omitempty"`
+	RemoteNetworkID string    `json:"remote_network_id"`
+	GroupIDs        []string  `json:"group_ids,omitempty"`
+	DeletedAt       time.Time `json:"deleted_at"`
+
+	// Access is every grant the resource had when it was deleted,
+	// including those made in the console.
+	Access *AccessSnapshot `json:"access,omitempty"`
+}
+
+// RestoredResource is the outcome of recreating a journaled resource.
+type RestoredResource struct {
+	Tenant string `json:"tenant"`
+	Name   string `json:"name"`
+	OldID  string `json:"old_id"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// journalDeletion records resource in the deletion journal before it is
+// deleted, along with the groups the plugin granted access to it and a
+// snapshot of all its access. Entries past deletedRetention are dropped.
+// Without storage nothing is journaled.
+func (t *TwingateApp) journalDeletion(ctx context.Context, resource Resource) error {
+	if t.state == nil {
+		return nil
+	}
+
+	state, err := t.state.load(ctx)
+	if err != nil {
+		return fmt.Errorf("loading deletion journal: %w", err)
+	}
+
+	access, err := captureAccess(ctx, t.api, resource.ID)
+	if err != nil {
+		return fmt.Errorf("capturing access: %w", err)
+	}
+
+	now := time.Now()
+	state.Deleted = slices.DeleteFunc(state.Deleted, func(d DeletedResource) bool {
+		return now.Sub(d.DeletedAt) > deletedRetention
+	})
+
+	entry := DeletedResource{
+		ID:              resource.ID,
+		Name:            resource.Name,
+		Address:         resource.Address.Value,
+		RemoteNetworkID: resource.RemoteNetwork.ID,
+		GroupIDs:        state.Managed[resource.ID].GroupIDs,
+		DeletedAt:       now,
+		Access:          access,
+	}
+	if resource.Alias != nil {
+		entry.Alias = *resource.Alias
+	}
+	state.Deleted = append(state.Deleted, entry)
+
+	if err := t.state.save(ctx, state); err != nil {
+		return fmt.Errorf("saving deletion journal: %w", err)
+	}
+	return nil
+}
+
+// undoDelete recreates journaled resources in this app and its tenant
+// blocks: the most recent deletion of each of names or, if names is
+// empty, every deletion within since, or all journaled ones if since is
+// zero. Recreated resources are removed from the journal and managed
+// again; the next cleanup deletes them again unless the configuration
+// wants them.
+func (t *TwingateApp) undoDelete(ctx context.Context, names []string, since time.Duration) ([]RestoredResource, error) {
+	var restored []RestoredResource
+	if t.Tenant != "" && t.state != nil {
+		var err error
+		restored, err = t.restoreDeleted(ctx, names, since)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, label := range t.tenantLabels() {
+		tenant, err := t.Tenants[label].undoDelete(ctx, names, since)
+		if err != nil {
+			return nil, fmt.Errorf("tenant block %s: %w", label, err)
+		}
+		restored = append(restored, tenant...)
+	}
+	return restored, nil
+}
+
+func (t *TwingateApp) restoreDeleted(ctx context.Context, names []string, since time.Duration) ([]RestoredResource, error) {
+	t.syncMutex.Lock()
+	defer t.syncMutex.Unlock()
+
+	state, err := t.state.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading deletion journal: %w", err)
+	}
+
+	selected := selectDeleted(state.Deleted, names, since, time.Now())
+	if len(selected) == 0 {
+		return nil, nil
+	}
+
+	var restored []RestoredResource
+	done := make(map[int]bool)
+	for _, i := range selected {
+		entry := state.Deleted[i]
+		result := RestoredResource{Tenant: t.Tenant, Name: entry.Name, OldID: entry.ID}
+
+		change := PlannedChange{
+			Action:   ChangeCreate,
+			Name:     entry.Name,
+			Desired:  &AppliedFields{Name: entry.Name, Address: entry.Address, Alias: entry.Alias},
+			GroupIDs: entry.GroupIDs,
+		}
+		if err := t.checkChange(ctx, change); err != nil {
+			t.logger.Warn("Restoring deleted resource rejected by hook",
+				zap.String("name", entry.Name),
+				zap.String("old_id", entry.ID),
+				zap.Error(err))
+			result.Error = err.Error()
+			restored = append(restored, result)
+			continue
+		}
+
+		resource, err := t.api.CreateResource(ctx, ResourceCreateInput{
+			Name:            entry.Name,
+			Address:         entry.Address,
+			RemoteNetworkID: entry.RemoteNetworkID,
+			Alias:           entry.Alias,
+			GroupIDs:        entry.GroupIDs,
+		})
+		if err == nil {
+			change.ResourceID = resource.ID
+		}
+		t.reportChange(ctx, change, err)
+		if err != nil {
+			t.logger.Error("Failed to restore deleted resource",
+				zap.String("name", entry.Name),
+				zap.String("old_id", entry.ID),
+				zap.Error(err))
+			result.Error = err.Error()
+			restored = append(restored, result)
+			continue
+		}
+
+		t.logger.Info("Restored deleted resource",
+			zap.String("name", entry.Name),
+			zap.String("old_id", entry.ID),
+			zap.String("id", resource.ID))
+		if _, err := reapplyAccess(ctx, t.api, resource.ID, entry, entry.GroupIDs); err != nil {
+			t.logger.Error("Failed to restore access to deleted resource",
+				zap.String("name", entry.Name),
+				zap.String("id", resource.ID),
+				zap.Error(err))
+			result.Error = err.Error()
+		}
+		result.ID = resource.ID
+		restored = append(restored, result)
+
+		state.Managed[resource.ID] = ManagedResource{
+			Name:     entry.Name,
+			Since:    time.Now(),
+			Applied:  &AppliedFields{Name: entry.Name, Address: entry.Address, Alias: entry.Alias},
+			GroupIDs: entry.GroupIDs,
+		}
+		done[i] = true
+	}
+	if len(done) == 0 {
+		return restored, nil
+	}
+
+	remaining := state.Deleted[:0]
+	for i, entry := range state.Deleted {
+		if !done[i] {
+			remaining = append(remaining, entry)
+		}
+	}
+	state.Deleted = remaining
+	if err := t.state.save(ctx, state); err != nil {
+		return restored, fmt.Errorf("saving deletion journal: %w", err)
+	}
+	return restored, nil
+}
+
+// selectDeleted returns the indexes in journal of the entries to restore:
+// the most recent entry for each of names, or without names every entry
+// deleted within since of now, or all of them if since is zero.
+func selectDeleted(journal []DeletedResource, names []string, since time.Duration, now time.Time) []int {
+	var selected []int
+	if len(names) > 0 {
+		for _, name := range names {
+			for i := len(journal) - 1; i >= 0; i-- {
+				if journal[i].Name == name {
+					selected = append(selected, i)
+					break
+				}
+			}
+		}
+		slices.Sort(selected)
+		return slices.Compact(selected)
+	}
+
+	for i, entry := range journal {
+		if since == 0 || now.Sub(entry.DeletedAt) <= since {
+			selected = append(selected, i)
+		}
+	}
+	return selected
+}
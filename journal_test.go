@@ -0,0 +1,121 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+)
+
+func TestUndoDeleteRestoresJournaledResource(t *testing.T) {
+	ctx := context.Background()
+
+	alias := "shop.internal"
+	stale := newTestResource("r1", "shop.example.com", "10.0.0.1", "net1")
+	stale.Alias = &alias
+	client := &MockTwingateClient{Resources: map[string]Resource{"r1": stale}}
+
+	app := &TwingateApp{
+		Tenant: "acme",
+		api:    client,
+		logger: zap.NewNop(),
+		state:  newStateStore(&certmagic.FileStorage{Path: t.TempDir()}, "acme"),
+	}
+	state, _ := app.state.load(ctx)
+	state.Managed["r1"] = ManagedResource{Name: "shop.example.com", GroupIDs: []string{"g1"}}
+	if err := app.state.save(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+
+	syncer := app.newSyncer(ctx)
+	deleted, errs := syncer.deleteStaleResources(ctx, nil, "net1", &CleanupConfig{Enabled: true})
+	if deleted != 1 || errs != 0 {
+		t.Fatalf("deleted = %d, errors = %d, want 1 and 0", deleted, errs)
+	}
+
+	state, _ = app.state.load(ctx)
+	if len(state.Deleted) != 1 {
+		t.Fatalf("journal has %d entries, want 1", len(state.Deleted))
+	}
+	entry := state.Deleted[0]
+	if entry.Name != "shop.example.com" || entry.Alias != alias || entry.RemoteNetworkID != "net1" || !slices.Equal(entry.GroupIDs, []string{"g1"}) {
+		t.Errorf("unexpected journal entry: %+v", entry)
+	}
+
+	restored, err := app.undoDelete(ctx, []string{"shop.example.com"}, 0)
+	if err != nil {
+		t.Fatalf("undoDelete() failed: %v", err)
+	}
+	if len(restored) != 1 || restored[0].Error != "" || restored[0].OldID != "r1" {
+		t.Fatalf("unexpected restore result: %+v", restored)
+	}
+
+	res, ok := client.Resources[restored[0].ID]
+	if !ok || res.Address.Value != "10.0.0.1" || res.Alias == nil || *res.Alias != alias {
+		t.Errorf("restored resource = %+v", res)
+	}
+	if !slices.Equal(client.Grants[res.ID], []string{"g1"}) {
+		t.Errorf("restored grants = %v, want [g1]", client.Grants[res.ID])
+	}
+
+	state, _ = app.state.load(ctx)
+	if len(state.Deleted) != 0 {
+		t.Errorf("restored entry should leave the journal: %+v", state.Deleted)
+	}
+	if _, ok := state.Managed[res.ID]; !ok {
+		t.Error("restored resource should be managed")
+	}
+}
+
+func TestDeleteStaleResourcesKeepsUnjournaled(t *testing.T) {
+	client := &MockTwingateClient{Resources: map[string]Resource{
+		"r1": newTestResource("r1", "stale.example.com", "10.0.0.1", "net1"),
+	}}
+	syncer := &ResourceSyncer{
+		client: client,
+		logger: zap.NewNop(),
+		beforeDelete: func(context.Context, Resource) error {
+			return errors.New("storage unavailable")
+		},
+	}
+
+	deleted, errs := syncer.deleteStaleResources(context.Background(), nil, "net1", &CleanupConfig{Enabled: true})
+	if deleted != 0 || errs != 1 {
+		t.Errorf("deleted = %d, errors = %d, want 0 and 1", deleted, errs)
+	}
+	if len(client.DeletedIDs) != 0 {
+		t.Errorf("resource deleted without a journal entry: %v", client.DeletedIDs)
+	}
+}
+
+func TestSelectDeleted(t *testing.T) {
+	now := time.Now()
+	journal := []DeletedResource{
+		{ID: "r1", Name: "a", DeletedAt: now.Add(-3 * time.Hour)},
+		{ID: "r2", Name: "b", DeletedAt: now.Add(-2 * time.Hour)},
+		{ID: "r3", Name: "a", DeletedAt: now.Add(-30 * time.Minute)},
+	}
+
+	tests := []struct {
+		name  string
+		names []string
+		since time.Duration
+		want  []int
+	}{
+		{name: "most recent by name", names: []string{"a", "a"}, want: []int{2}},
+		{name: "several names", names: []string{"b", "a", "missing"}, want: []int{1, 2}},
+		{name: "since", since: time.Hour, want: []int{2}},
+		{name: "all", want: []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectDeleted(journal, tt.names, tt.since, now); !slices.Equal(got, tt.want) {
+				t.Errorf("selectDeleted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
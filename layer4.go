@@ -0,0 +1,300 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddytls"
+)
+
+func init() {
+	caddy.RegisterModule(Layer4Discoverer{})
+}
+
+// Layer4Discoverer publishes the hostnames that the layer4 app (caddy-l4)
+// routes by TLS SNI, for setups where Caddy passes TLS through to the
+// upstreams that terminate it. Each host's resource only allows the ports
+// the layer4 servers listen on, per protocol.
+//
+// The layer4 app is read once it is provisioned, so this discoverer does
+// not depend on caddy-l4; without a layer4 app it finds nothing.
+type Layer4Discoverer struct {
+	// RemoteNetwork and Groups apply to the discovered hosts.
+	RemoteNetwork string   `json:"remote_network,omitempty"`
+	Groups        []string `json:"groups,omitempty"`
+
+	ctx caddy.Context
+}
+
+func (Layer4Discoverer) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "twingate.discoverers.layer4",
+		New: func() caddy.Module { return new(Layer4Discoverer) },
+	}
+}
+
+func (l *Layer4Discoverer) Provision(ctx caddy.Context) error {
+	l.ctx = ctx
+	return nil
+}
+
+func (l *Layer4Discoverer) DiscoverEndpoints(context.Context) ([]Endpoint, error) {
+	app, err := l.ctx.AppIfConfigured("layer4")
+	if errors.Is(err, caddy.ErrNotConfigured) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return layer4Endpoints(app, l.RemoteNetwork, l.Groups)
+}
+
+// layer4Endpoints returns an endpoint per SNI host of the layer4 app's
+// servers. The app's Go types belong to caddy-l4, so its servers are read
+// by field name.
+func layer4Endpoints(app any, remoteNetwork string, groups []string) ([]Endpoint, error) {
+	servers := reflect.Indirect(reflect.ValueOf(app))
+	if servers.Kind() == reflect.Struct {
+		servers = servers.FieldByName("Servers")
+	}
+	if servers.Kind() != reflect.Map {
+		return nil, fmt.Errorf("layer4 app of type %T has no servers", app)
+	}
+
+	ports := make(map[string]*ProtocolsInput)
+	iter := servers.MapRange()
+	for iter.Next() {
+		server := reflect.Indirect(iter.Value())
+		if server.Kind() != reflect.Struct {
+			continue
+		}
+		names, err := routeNames(server)
+		if err != nil {
+			return nil, fmt.Errorf("layer4 server %v: %w", iter.Key(), err)
+		}
+		hosts := uniqueSorted(names)
+		if len(hosts) == 0 {
+			continue
+		}
+
+		var listen []string
+		if field := server.FieldByName("Listen"); field.Kind() == reflect.Slice {
+			for i := 0; i < field.Len(); i++ {
+				listen = append(listen, field.Index(i).String())
+			}
+		}
+		for _, host := range hosts {
+			protocols, ok := ports[host]
+			if !ok {
+				protocols = &ProtocolsInput{
+					AllowICMP: true,
+					TCP:       ProtocolInput{Policy: ProtocolRestricted},
+					UDP:       ProtocolInput{Policy: ProtocolRestricted},
+				}
+				ports[host] = protocols
+			}
+			if err := addListenPorts(protocols, listen); err != nil {
+				return nil, fmt.Errorf("layer4 server %v: %w", iter.Key(), err)
+			}
+		}
+	}
+
+	hosts := make([]string, 0, len(ports))
+	for host := range ports {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	endpoints := make([]Endpoint, 0, len(hosts))
+	for _, host := range hosts {
+		endpoints = append(endpoints, Endpoint{
+			Host:          host,
+			RemoteNetwork: remoteNetwork,
+			Groups:        groups,
+			Protocols:     ports[host],
+		})
+	}
+	return endpoints, nil
+}
+
+// addListenPorts allows the ports of the listen addresses under their
+// network's protocol.
+func addListenPorts(protocols *ProtocolsInput, listen []string) error {
+	for _, addr := range listen {
+		na, err := caddy.ParseNetworkAddress(addr)
+		if err != nil {
+			return err
+		}
+		if na.IsUnixNetwork() {
+			continue
+		}
+		ports := PortRangeInput{Start: int(na.StartPort), End: int(na.EndPort)}
+		switch {
+		case strings.HasPrefix(na.Network, "udp"):
+			protocols.UDP.Ports = appendPortRange(protocols.UDP.Ports, ports)
+		default:
+			protocols.TCP.Ports = appendPortRange(protocols.TCP.Ports, ports)
+		}
+	}
+	return nil
+}
+
+func appendPortRange(ranges []PortRangeInput, r PortRangeInput) []PortRangeInput {
+	for _, existing := range ranges {
+		if existing == r {
+			return ranges
+		}
+	}
+	ranges = append(ranges, r)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	return ranges
+}
+
+// serverNameType is the type of the tls sni matcher.
+var serverNameType = reflect.TypeOf(caddytls.MatchServerName{})
+
+// layer4ModulePath is the module of the layer4 app.
+const layer4ModulePath = "github.com/mholt/caddy-l4"
+
+// layer4Version returns the version of caddy-l4 built into the binary, or
+// "unknown".
+var layer4Version = sync.OnceValue(func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != layer4ModulePath {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+		return dep.Version
+	}
+	return "unknown"
+})
+
+// layoutError reports a layer4 app whose provisioned matchers are not
+// where routeNames reads them, naming the caddy-l4 version built in.
+func layoutError(format string, args ...any) error {
+	return fmt.Errorf("unsupported layout of caddy-l4 %s: %s", layer4Version(), fmt.Sprintf(format, args...))
+}
+
+// routeNames returns the names of the SNI matchers of a layer4 server's
+// routes. caddy-l4 clears the routes' matcher config once provisioned and
+// keeps the matchers in unexported fields: each route's matcherSets, and
+// the handshake matchers of a tls matcher in its matchers. Only those
+// fields are read, by name, and a route without them fails with a
+// layoutError rather than its hosts going missing. Values are only read,
+// never converted to interfaces, which reflect allows for unexported
+// fields.
+func routeNames(server reflect.Value) ([]string, error) {
+	routes := server.FieldByName("Routes")
+	if routes.Kind() != reflect.Slice {
+		return nil, layoutError("server has no routes")
+	}
+
+	var names []string
+	for i := 0; i < routes.Len(); i++ {
+		route := reflect.Indirect(routes.Index(i))
+		if route.Kind() != reflect.Struct {
+			return nil, layoutError("route of kind %s", route.Kind())
+		}
+		sets := route.FieldByName("matcherSets")
+		if sets.Kind() != reflect.Slice {
+			return nil, layoutError("route of type %s has no matcher sets", route.Type())
+		}
+		for j := 0; j < sets.Len(); j++ {
+			set := sets.Index(j)
+			if set.Kind() != reflect.Slice {
+				return nil, layoutError("matcher set of kind %s", set.Kind())
+			}
+			for k := 0; k < set.Len(); k++ {
+				names = append(names, tlsMatcherNames(set.Index(k))...)
+			}
+		}
+	}
+	return names, nil
+}
+
+// tlsMatcherNames returns the names of the SNI matchers of a tls matcher,
+// or nothing for other matchers.
+func tlsMatcherNames(matcher reflect.Value) []string {
+	matcher = reflect.Indirect(unwrapInterface(matcher))
+	if matcher.Kind() != reflect.Struct {
+		return nil
+	}
+	matchers := matcher.FieldByName("matchers")
+	if matchers.Kind() != reflect.Slice {
+		return nil
+	}
+
+	var names []string
+	for i := 0; i < matchers.Len(); i++ {
+		sni := reflect.Indirect(unwrapInterface(matchers.Index(i)))
+		if !sni.IsValid() || sni.Type() != serverNameType {
+			continue
+		}
+		for j := 0; j < sni.Len(); j++ {
+			if name := strings.ToLower(sni.Index(j).String()); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// unwrapInterface returns the value held by an interface value, or v
+// itself.
+func unwrapInterface(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Interface {
+		return v.Elem()
+	}
+	return v
+}
+
+// UnmarshalCaddyfile sets up the discoverer from Caddyfile tokens. Syntax:
+//
+//	discoverer layer4 {
+//	    remote_network <name>
+//	    groups <name>...
+//	}
+func (l *Layer4Discoverer) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // discoverer name
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		switch d.Val() {
+		case "remote_network":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			l.RemoteNetwork = d.Val()
+		case "groups":
+			groups := d.RemainingArgs()
+			if len(groups) == 0 {
+				return d.ArgErr()
+			}
+			l.Groups = append(l.Groups, groups...)
+		default:
+			return d.Errf("unrecognized layer4 option: %s", d.Val())
+		}
+	}
+	return nil
+}
+
+var (
+	_ Discoverer            = (*Layer4Discoverer)(nil)
+	_ caddy.Provisioner     = (*Layer4Discoverer)(nil)
+	_ caddyfile.Unmarshaler = (*Layer4Discoverer)(nil)
+)
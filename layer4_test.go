@@ -0,0 +1,119 @@
+package twingate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddytls"
+)
+
+// The fake layer4 types mirror the fields of caddy-l4's App, Server,
+// Route and MatchTLS that layer4Endpoints reads, including the unexported
+// ones holding provisioned matchers.
+type fakeL4App struct {
+	Servers map[string]*fakeL4Server
+}
+
+type fakeL4Server struct {
+	Listen []string
+	Routes []*fakeL4Route
+}
+
+type fakeL4Route struct {
+	matcherSets [][]any
+}
+
+type fakeL4MatchTLS struct {
+	matchers []caddytls.ConnectionMatcher
+}
+
+func fakeSNIRoute(names ...string) *fakeL4Route {
+	sni := caddytls.MatchServerName(names)
+	return &fakeL4Route{matcherSets: [][]any{{&fakeL4MatchTLS{matchers: []caddytls.ConnectionMatcher{&sni}}}}}
+}
+
+func TestLayer4Endpoints(t *testing.T) {
+	tcp := &fakeL4Server{
+		Listen: []string{":443", ":8443"},
+		Routes: []*fakeL4Route{fakeSNIRoute("DB.example.com", "git.example.com"), {matcherSets: [][]any{{"not tls"}}}},
+	}
+	app := &fakeL4App{Servers: map[string]*fakeL4Server{
+		"tcp":   tcp,
+		"quic":  {Listen: []string{"udp/:443"}, Routes: []*fakeL4Route{fakeSNIRoute("git.example.com")}},
+		"plain": {Listen: []string{":22"}, Routes: []*fakeL4Route{{}}},
+	}}
+
+	endpoints, err := layer4Endpoints(app, "Passthrough", []string{"Engineering"})
+	if err != nil {
+		t.Fatalf("layer4Endpoints() error = %v", err)
+	}
+
+	var hosts []string
+	for _, ep := range endpoints {
+		hosts = append(hosts, ep.Host)
+	}
+	if want := []string{"db.example.com", "git.example.com"}; !slices.Equal(hosts, want) {
+		t.Fatalf("hosts = %v, want %v", hosts, want)
+	}
+
+	db, git := endpoints[0], endpoints[1]
+	if db.RemoteNetwork != "Passthrough" || !slices.Equal(db.Groups, []string{"Engineering"}) {
+		t.Errorf("unexpected endpoint settings: %+v", db)
+	}
+	wantTCP := []PortRangeInput{{Start: 443, End: 443}, {Start: 8443, End: 8443}}
+	if !slices.Equal(db.Protocols.TCP.Ports, wantTCP) || len(db.Protocols.UDP.Ports) != 0 {
+		t.Errorf("db.example.com protocols = %+v, want TCP 443 and 8443 only", db.Protocols)
+	}
+	if db.Protocols.TCP.Policy != ProtocolRestricted || db.Protocols.UDP.Policy != ProtocolRestricted {
+		t.Errorf("protocols should be restricted, got %+v", db.Protocols)
+	}
+	if !slices.Equal(git.Protocols.UDP.Ports, []PortRangeInput{{Start: 443, End: 443}}) {
+		t.Errorf("git.example.com UDP ports = %v, want 443", git.Protocols.UDP.Ports)
+	}
+
+	m := db.ToResourceMapping("10.0.0.1")
+	if m.Protocols != db.Protocols || m.Alias == nil || *m.Alias != "db.example.com" {
+		t.Errorf("unexpected mapping: %+v", m)
+	}
+
+	if _, err := layer4Endpoints(struct{}{}, "", nil); err == nil {
+		t.Error("expected error for an app without servers")
+	}
+
+	// A caddy-l4 that keeps its matchers elsewhere is reported rather than
+	// finding no hosts
+	type movedRoute struct{ matchers [][]any }
+	type movedServer struct {
+		Listen []string
+		Routes []*movedRoute
+	}
+	type movedApp struct{ Servers map[string]*movedServer }
+	_, err = layer4Endpoints(&movedApp{Servers: map[string]*movedServer{
+		"tcp": {Listen: []string{":443"}, Routes: []*movedRoute{{}}},
+	}}, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "unsupported layout of caddy-l4") {
+		t.Errorf("expected a layout error, got %v", err)
+	}
+}
+
+func TestLayer4DiscovererUnmarshalCaddyfile(t *testing.T) {
+	var l Layer4Discoverer
+	err := l.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`layer4 {
+		remote_network Passthrough
+		groups Engineering Ops
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if l.RemoteNetwork != "Passthrough" || !slices.Equal(l.Groups, []string{"Engineering", "Ops"}) {
+		t.Errorf("unexpected config: %+v", l)
+	}
+
+	if err := (&Layer4Discoverer{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`layer4 {
+		ports 443
+	}`)); err == nil {
+		t.Error("expected error for unknown option")
+	}
+}
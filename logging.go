@@ -0,0 +1,116 @@
+package twingate
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// redacted replaces resource addresses in logs when redact_addresses is set.
+const redacted = "[redacted]"
+
+// addressKeys are the log fields that hold resource or Caddy addresses.
+var addressKeys = map[string]bool{
+	"address":   true,
+	"addresses": true,
+}
+
+// valueKeys hold a field's old and new values in drift logs, which are
+// addresses when the entry's "field" is address.
+var valueKeys = map[string]bool{
+	"applied": true,
+	"actual":  true,
+}
+
+// moduleLogger applies the log_level and redact_addresses options to the
+// logger Caddy provides. log_level can only make the module quieter than
+// Caddy's own log configuration, never more verbose.
+func (t *TwingateApp) moduleLogger(logger *zap.Logger) *zap.Logger {
+	if t.LogLevel == "" && !t.RedactAddresses {
+		return logger
+	}
+
+	var level zapcore.Level
+	if t.LogLevel != "" {
+		// Validated by UnmarshalCaddyfile and Validate.
+		_ = level.Set(t.LogLevel)
+	}
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &moduleCore{Core: core, level: level, redact: t.RedactAddresses}
+	}))
+}
+
+func validateLogLevel(level string) error {
+	switch level {
+	case "debug", "info", "warn", "error":
+		return nil
+	}
+	return fmt.Errorf("log_level must be debug, info, warn or error, got: %s", level)
+}
+
+// moduleCore drops entries below level and, with redact set, replaces the
+// values of address fields.
+type moduleCore struct {
+	zapcore.Core
+	level  zapcore.Level
+	redact bool
+}
+
+func (c *moduleCore) Enabled(level zapcore.Level) bool {
+	return level >= c.level && c.Core.Enabled(level)
+}
+
+func (c *moduleCore) With(fields []zapcore.Field) zapcore.Core {
+	return &moduleCore{Core: c.Core.With(c.redactFields(fields)), level: c.level, redact: c.redact}
+}
+
+func (c *moduleCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *moduleCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, c.redactFields(fields))
+}
+
+// redactFields returns fields with the values of address fields replaced.
+// fields is not modified.
+func (c *moduleCore) redactFields(fields []zapcore.Field) []zapcore.Field {
+	if !c.redact {
+		return fields
+	}
+
+	addressValues := false
+	for _, f := range fields {
+		if f.Key == "field" && f.Type == zapcore.StringType && f.String == FieldAddress {
+			addressValues = true
+		}
+	}
+
+	var out []zapcore.Field
+	for i, f := range fields {
+		diff, isDiff := f.Interface.(Diff)
+		if isDiff {
+			if _, ok := diff[FieldAddress]; !ok {
+				continue
+			}
+		} else if !addressKeys[f.Key] && !(addressValues && valueKeys[f.Key]) {
+			continue
+		}
+		if out == nil {
+			out = append([]zapcore.Field(nil), fields...)
+		}
+		if isDiff {
+			out[i] = zap.Object(f.Key, diff.redacted())
+			continue
+		}
+		out[i] = zap.String(f.Key, redacted)
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
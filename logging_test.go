@@ -0,0 +1,65 @@
+package twingate
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestModuleLoggerLevel(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := (&TwingateApp{LogLevel: "warn"}).moduleLogger(zap.New(core))
+
+	logger.Info("chatty")
+	logger.Warn("important")
+	logger.With(zap.String("tenant_block", "b")).Info("chatty too")
+
+	if logs.Len() != 1 || logs.All()[0].Message != "important" {
+		t.Errorf("logged %v, want only the warning", logs.All())
+	}
+}
+
+func TestModuleLoggerRedactsAddresses(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := (&TwingateApp{RedactAddresses: true}).moduleLogger(zap.New(core))
+
+	logger.Info("Successfully created resource",
+		zap.String("name", "api.example.com"),
+		zap.String("address", "10.0.0.1"))
+	logger.Info("Successfully updated resource",
+		zap.Object("diff", Diff{
+			FieldAddress: {Old: "10.0.0.1", New: "10.0.0.2"},
+			FieldAlias:   {Old: "", New: "api.internal"},
+		}))
+	logger.Warn("Resource attribute drifted",
+		zap.String("field", FieldAlias),
+		zap.String("actual", "api.internal"))
+	logger.With(zap.Strings("addresses", []string{"10.0.0.1"})).Info("Resolved")
+
+	entries := logs.All()
+	if got := entries[0].ContextMap(); got["address"] != redacted || got["name"] != "api.example.com" {
+		t.Errorf("create entry = %v", got)
+	}
+	diff := entries[1].ContextMap()["diff"].(map[string]any)
+	if got := diff[FieldAddress].(map[string]any); got["old"] != redacted || got["new"] != redacted {
+		t.Errorf("address diff = %v", got)
+	}
+	if got := diff[FieldAlias].(map[string]any); got["new"] != "api.internal" {
+		t.Errorf("alias diff should not be redacted: %v", got)
+	}
+	if got := entries[2].ContextMap(); got["actual"] != "api.internal" {
+		t.Errorf("alias drift entry should not be redacted: %v", got)
+	}
+	if got := entries[3].ContextMap(); got["addresses"] != redacted {
+		t.Errorf("With() fields should be redacted: %v", got)
+	}
+}
+
+func TestModuleLoggerUnchangedByDefault(t *testing.T) {
+	logger := zap.NewNop()
+	if (&TwingateApp{}).moduleLogger(logger) != logger {
+		t.Error("moduleLogger should return the logger as is without options")
+	}
+}
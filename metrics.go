@@ -0,0 +1,115 @@
+package twingate
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics are registered on the default registry, which Caddy's metrics
+// handler serves, following the pattern of Caddy's own HTTP metrics.
+var (
+	metricsOnce     sync.Once
+	twingateMetrics struct {
+		retryAttempts      *prometheus.CounterVec
+		resourcesFailing   prometheus.Gauge
+		resourcesAbandoned prometheus.Counter
+		drift              *prometheus.CounterVec
+		apiRequests        *prometheus.CounterVec
+		apiDuration        *prometheus.HistogramVec
+		breakerState       *prometheus.GaugeVec
+		rateLimitRemaining *prometheus.GaugeVec
+		rateLimitLimit     *prometheus.GaugeVec
+		rateLimitReset     *prometheus.GaugeVec
+		resourcesNoAccess  *prometheus.GaugeVec
+		resourcesFlapping  *prometheus.GaugeVec
+		plannedChanges     *prometheus.GaugeVec
+	}
+)
+
+func initMetrics() {
+	const ns, sub = "caddy", "twingate"
+
+	metricsOnce.Do(func() {
+		twingateMetrics.retryAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "resource_retries_total",
+			Help:      "Retries of failed resource upserts, by result.",
+		}, []string{"result"})
+		twingateMetrics.resourcesFailing = promauto.NewGauge(prometheus.GaugeOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "resources_failing",
+			Help:      "Resources whose last upsert failed and are pending retry or abandoned.",
+		})
+		twingateMetrics.resourcesAbandoned = promauto.NewCounter(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "resources_abandoned_total",
+			Help:      "Resources given up on after exhausting retry attempts.",
+		})
+		twingateMetrics.drift = promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "resource_drift_total",
+			Help:      "Resource attributes found changed outside Caddy, by field and drift policy.",
+		}, []string{"field", "policy"})
+		twingateMetrics.apiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "api_requests_total",
+			Help:      "GraphQL requests to the Twingate API, by operation and result.",
+		}, []string{"operation", "result"})
+		twingateMetrics.apiDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "api_request_duration_seconds",
+			Help:      "Latency of GraphQL requests to the Twingate API, by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"})
+		twingateMetrics.breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "circuit_breaker_state",
+			Help:      "State of the Twingate API circuit breaker by endpoint: 1 for the current state, 0 otherwise.",
+		}, []string{"endpoint", "state"})
+		twingateMetrics.rateLimitRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "api_rate_limit_remaining",
+			Help:      "Requests left in the Twingate API rate limit window, by endpoint.",
+		}, []string{"endpoint"})
+		twingateMetrics.rateLimitLimit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "api_rate_limit_limit",
+			Help:      "Requests allowed per Twingate API rate limit window, by endpoint.",
+		}, []string{"endpoint"})
+		twingateMetrics.rateLimitReset = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "api_rate_limit_reset_timestamp_seconds",
+			Help:      "Unix time the Twingate API rate limit window resets, by endpoint.",
+		}, []string{"endpoint"})
+		twingateMetrics.resourcesNoAccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "resources_without_access",
+			Help:      "Managed resources no group or service account has access to, by tenant, as of the last access check.",
+		}, []string{"tenant"})
+		twingateMetrics.resourcesFlapping = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "resources_flapping",
+			Help:      "Resources held because syncs keep creating and deleting them, by tenant.",
+		}, []string{"tenant"})
+		twingateMetrics.plannedChanges = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "planned_changes",
+			Help:      "Changes the last read-only sync would have made, by tenant and action.",
+		}, []string{"tenant", "action"})
+	})
+}
@@ -0,0 +1,185 @@
+package twingate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// maxNameLength is the longest resource or remote network name, in
+// characters, the Twingate API accepts.
+const maxNameLength = 255
+
+// sanitizeName makes name acceptable as a Twingate resource or remote
+// network name: non-printable characters are replaced with spaces, runs
+// of spaces collapsed, surrounding space trimmed and the result truncated
+// to maxNameLength characters.
+func sanitizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range name {
+		if r == utf8.RuneError || !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+
+	sanitized := b.String()
+	if utf8.RuneCountInString(sanitized) > maxNameLength {
+		sanitized = strings.TrimSpace(string([]rune(sanitized)[:maxNameLength]))
+	}
+	return sanitized
+}
+
+// nameHashLength is the number of hex digits of the hash suffix added to
+// sanitized resource names.
+const nameHashLength = 8
+
+// sanitizeResourceName sanitizes a name derived from a host. Unlike
+// sanitizeName, any change appends a short hash of the original name, so
+// two hosts that sanitize to the same text still get distinct, stable
+// resource names.
+func sanitizeResourceName(name string) string {
+	if checkName(name) == nil {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(sum[:])[:nameHashLength]
+
+	base := []rune(sanitizeName(name))
+	if limit := maxNameLength - len(suffix); len(base) > limit {
+		base = base[:limit]
+	}
+	return strings.TrimSpace(string(base)) + suffix
+}
+
+// checkName describes why name is not accepted by the Twingate API as is,
+// or returns nil if it is.
+func checkName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name cannot be empty")
+	}
+	if n := utf8.RuneCountInString(name); n > maxNameLength {
+		return fmt.Errorf("name is %d characters long, the maximum is %d", n, maxNameLength)
+	}
+	if sanitizeName(name) != name {
+		return fmt.Errorf("name contains control characters or irregular whitespace")
+	}
+	return nil
+}
+
+// sanitizeConfigName sanitizes a name taken from the config, logging a
+// warning if it changed. It fails if nothing usable is left.
+func (t *TwingateApp) sanitizeConfigName(option, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	err := checkName(name)
+	if err == nil {
+		return name, nil
+	}
+
+	sanitized := sanitizeName(name)
+	if sanitized == "" {
+		return "", fmt.Errorf("%s %q: %v", option, name, err)
+	}
+
+	t.logger.Warn("Sanitized name to meet Twingate constraints",
+		zap.String("option", option),
+		zap.String("original", name),
+		zap.String("sanitized", sanitized),
+		zap.String("reason", err.Error()))
+	return sanitized, nil
+}
+
+// sanitizeConfigNames sanitizes the names set directly in the app config,
+// so invalid ones fail Provision with a clear message instead of an API
+// error during sync.
+func (t *TwingateApp) sanitizeConfigNames() error {
+	network, err := t.sanitizeConfigName("remote_network", t.RemoteNetwork)
+	if err != nil {
+		return err
+	}
+	t.RemoteNetwork = network
+
+	for i := range t.ExtraResources {
+		extra := &t.ExtraResources[i]
+
+		if extra.Name, err = t.sanitizeConfigName("extra_resource name", extra.Name); err != nil {
+			return err
+		}
+		if extra.RemoteNetwork, err = t.sanitizeConfigName("extra_resource remote_network", extra.RemoteNetwork); err != nil {
+			return err
+		}
+	}
+	if c := t.CatchAll; c != nil {
+		if c.Name, err = t.sanitizeConfigName("catch_all name", c.Name); err != nil {
+			return err
+		}
+		if c.RemoteNetwork, err = t.sanitizeConfigName("catch_all remote_network", c.RemoteNetwork); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sanitizeMappings sanitizes the names, aliases and remote networks of
+// discovered mappings in place. Renamed mappings keep their original name
+// in Host. Aliases that are not valid DNS names are removed, each with a
+// warning.
+func (t *TwingateApp) sanitizeMappings(mappings []ResourceMapping) []ResourceMapping {
+	for i := range mappings {
+		m := &mappings[i]
+
+		if err := checkName(m.Name); err != nil {
+			sanitized := sanitizeResourceName(m.Name)
+			t.logger.Warn("Sanitized resource name to meet Twingate constraints",
+				zap.String("original", m.Name),
+				zap.String("sanitized", sanitized),
+				zap.String("reason", err.Error()))
+			m.Host = m.Name
+			m.Name = sanitized
+		}
+
+		if m.Alias != nil && !isWildcardDNSName(*m.Alias) {
+			t.logger.Warn("Dropping alias that is not a valid DNS name",
+				zap.String("name", m.Name),
+				zap.String("alias", *m.Alias))
+			m.Alias = nil
+		}
+
+		if m.RemoteNetwork != "" {
+			if network := sanitizeName(m.RemoteNetwork); network != m.RemoteNetwork {
+				t.logger.Warn("Sanitized remote network name to meet Twingate constraints",
+					zap.String("original", m.RemoteNetwork),
+					zap.String("sanitized", network))
+				m.RemoteNetwork = network
+			}
+		}
+	}
+	return mappings
+}
+
+// renamedHosts maps the original host of each sanitized mapping to its
+// resource name.
+func renamedHosts(mappings []ResourceMapping) map[string]string {
+	renamed := make(map[string]string)
+	for _, m := range mappings {
+		if m.Host != "" {
+			renamed[m.Host] = m.Name
+		}
+	}
+	return renamed
+}
@@ -0,0 +1,116 @@
+package twingate
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"api.example.com", "api.example.com"},
+		{"  Caddy Managed  ", "Caddy Managed"},
+		{"Caddy\tManaged\n", "Caddy Managed"},
+		{"bad\x00name", "bad name"},
+		{"\x01\x02", ""},
+		{strings.Repeat("a", 300), strings.Repeat("a", maxNameLength)},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeName(tt.name); got != tt.want {
+			t.Errorf("sanitizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	if err := checkName("Caddy-Managed"); err != nil {
+		t.Errorf("valid name rejected: %v", err)
+	}
+	for _, name := range []string{"", "tab\there", strings.Repeat("x", maxNameLength+1)} {
+		if err := checkName(name); err == nil {
+			t.Errorf("checkName(%q) should fail", name)
+		}
+	}
+}
+
+func TestSanitizeConfigNames(t *testing.T) {
+	app := &TwingateApp{
+		RemoteNetwork:  "Caddy\nManaged",
+		ExtraResources: []ExtraResource{{Name: " lab-net ", Address: "10.10.0.0/24"}},
+		logger:         zap.NewNop(),
+	}
+	if err := app.sanitizeConfigNames(); err != nil {
+		t.Fatalf("sanitizeConfigNames() failed: %v", err)
+	}
+	if app.RemoteNetwork != "Caddy Managed" || app.ExtraResources[0].Name != "lab-net" {
+		t.Errorf("names not sanitized: %q, %q", app.RemoteNetwork, app.ExtraResources[0].Name)
+	}
+
+	app = &TwingateApp{RemoteNetwork: "\x00", logger: zap.NewNop()}
+	if err := app.sanitizeConfigNames(); err == nil {
+		t.Error("expected error for a remote network with no usable characters")
+	}
+}
+
+func TestSanitizeResourceName(t *testing.T) {
+	if got := sanitizeResourceName("api.example.com"); got != "api.example.com" {
+		t.Errorf("valid name should be unchanged, got %q", got)
+	}
+
+	long := strings.Repeat("a", 250) + ".example.com"
+	other := strings.Repeat("a", 250) + ".example.org"
+
+	got := sanitizeResourceName(long)
+	if len([]rune(got)) > maxNameLength {
+		t.Errorf("sanitized name is %d characters, want at most %d", len([]rune(got)), maxNameLength)
+	}
+	if got != sanitizeResourceName(long) {
+		t.Error("sanitization should be deterministic")
+	}
+	if got == sanitizeResourceName(other) {
+		t.Error("names sharing a truncated prefix should not collide")
+	}
+
+	if sanitizeResourceName("a\tb") == sanitizeResourceName("a b") {
+		t.Error("a sanitized name should not collide with a valid one")
+	}
+}
+
+func TestSanitizeMappings(t *testing.T) {
+	app := &TwingateApp{logger: zap.NewNop()}
+	badAlias := "under_score.example.com"
+	wildcardAlias := "*.lab.example.com"
+	long := strings.Repeat("a", 300) + ".example.com"
+
+	mappings := app.sanitizeMappings([]ResourceMapping{
+		{Name: "api.example.com", Address: "10.0.0.1"},
+		{Name: "under_score.example.com", Alias: &badAlias, Address: "10.0.0.1", RemoteNetwork: "Dev\tNet"},
+		{Name: long, Address: "10.0.0.1"},
+		{Name: "*.lab.example.com", Alias: &wildcardAlias, Address: "10.0.0.1"},
+	})
+
+	if mappings[1].Alias != nil {
+		t.Errorf("invalid alias should be dropped, got %q", *mappings[1].Alias)
+	}
+	if mappings[3].Alias == nil {
+		t.Error("wildcard alias should be kept")
+	}
+	if mappings[1].RemoteNetwork != "Dev Net" {
+		t.Errorf("RemoteNetwork = %q, want %q", mappings[1].RemoteNetwork, "Dev Net")
+	}
+	if mappings[0].Host != "" {
+		t.Errorf("unchanged mapping should have no Host, got %q", mappings[0].Host)
+	}
+	if mappings[2].Host != long || mappings[2].Name == long {
+		t.Errorf("long name should be sanitized and keep its host, got %+v", mappings[2])
+	}
+
+	renamed := renamedHosts(mappings)
+	if len(renamed) != 1 || renamed[long] != mappings[2].Name {
+		t.Errorf("unexpected renamed hosts: %v", renamed)
+	}
+}
@@ -0,0 +1,46 @@
+package twingate
+
+import (
+	"context"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// checkNoAccess returns the names of the synced resources no group or
+// service account has access to, for access_check. They cannot be reached
+// through Twingate, typically because the site sets no groups and nobody
+// granted access in the console. A failed lookup is logged and reports
+// none.
+func (t *TwingateApp) checkNoAccess(ctx context.Context, synced map[string]Resource) []string {
+	if t.client == nil {
+		return nil
+	}
+
+	ids, err := t.client.GetResourcesWithoutAccess(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to check resources for missing access", zap.Error(err))
+		return nil
+	}
+
+	without := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		without[id] = true
+	}
+	var names []string
+	for name, resource := range synced {
+		if without[resource.ID] {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	if twingateMetrics.resourcesNoAccess != nil {
+		twingateMetrics.resourcesNoAccess.WithLabelValues(t.Tenant).Set(float64(len(names)))
+	}
+	if len(names) > 0 {
+		t.log(ctx).Warn("Managed resources have no access granted and cannot be reached through Twingate",
+			zap.Strings("resources", names))
+	}
+	return names
+}
@@ -0,0 +1,48 @@
+package twingate
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestCheckNoAccess(t *testing.T) {
+	initMetrics()
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if !strings.Contains(req.Query, "access(first: 1)") {
+			t.Errorf("the check should read a single principal per resource: %s", req.Query)
+		}
+		granted := map[string]any{"edges": []any{map[string]any{"node": map[string]any{"__typename": "Group"}}}}
+		none := map[string]any{"edges": []any{}}
+		return map[string]any{"resources": map[string]any{"edges": []any{
+			map[string]any{"node": map[string]any{"id": "r1", "access": granted}},
+			map[string]any{"node": map[string]any{"id": "r2", "access": none}},
+			map[string]any{"node": map[string]any{"id": "r-console", "access": none}},
+		}}}
+	})
+	app := &TwingateApp{Tenant: "acme", AccessCheck: true, client: client, logger: zap.NewNop()}
+
+	synced := map[string]Resource{
+		"app.example.com":   newTestResource("r1", "app.example.com", "10.0.0.1", "net1"),
+		"admin.example.com": newTestResource("r2", "admin.example.com", "10.0.0.1", "net1"),
+	}
+	names := app.checkNoAccess(context.Background(), synced)
+	if !slices.Equal(names, []string{"admin.example.com"}) {
+		t.Fatalf("checkNoAccess() = %v, want only the managed resource without access", names)
+	}
+
+	report := &SyncReport{
+		Counts: map[string]int{},
+		Resources: []ReportEntry{
+			{Name: "admin.example.com", Action: ActionCreated},
+			{Name: "app.example.com", Action: ActionUnchanged},
+		},
+	}
+	report.markNoAccess(names)
+	if !report.Resources[0].NoAccess || report.Resources[1].NoAccess || report.Counts["no_access"] != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
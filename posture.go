@@ -0,0 +1,116 @@
+package twingate
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// PolicyTypeDefaultResource is the type of the tenant's default resource
+// policy, which applies to resources without a policy of their own.
+const PolicyTypeDefaultResource = "DEFAULT_RESOURCE"
+
+// ResourcePolicy is the security policy that applies to a resource, and
+// with it the device requirements users must meet.
+type ResourcePolicy struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+
+	// DeviceRequirements are the policy's device requirements, if the
+	// API exposes them.
+	DeviceRequirements []string `json:"device_requirements,omitempty"`
+
+	// Default is set when the resource has no policy of its own and the
+	// tenant's default resource policy applies.
+	Default bool `json:"default,omitempty"`
+
+	// Unknown is set when the resource's policy is not among the tenant's
+	// policies, so nothing but its ID is known.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// checkPosture looks up the security policy that applies to each managed
+// resource, and its device requirements, for the security_posture view in
+// /twingate/status. A failed lookup is logged and leaves the view empty,
+// without failing the sync.
+func (t *TwingateApp) checkPosture(ctx context.Context) map[string]ResourcePolicy {
+	if t.client == nil {
+		return nil
+	}
+
+	assigned, err := t.client.GetResourceSecurityPolicies(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to look up resource security policies", zap.Error(err))
+		return nil
+	}
+	policies, err := t.securityPolicies(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to look up security policies", zap.Error(err))
+		return nil
+	}
+
+	byID := make(map[string]ResourcePolicy, len(policies))
+	var fallback *ResourcePolicy
+	for i, policy := range policies {
+		byID[policy.ID] = policy
+		if policy.Type == PolicyTypeDefaultResource {
+			fallback = &policies[i]
+		}
+	}
+
+	posture := make(map[string]ResourcePolicy, len(t.resources))
+	var unknown []string
+	for name, resource := range t.resources {
+		id, ok := assigned[resource.ID]
+		if !ok {
+			continue
+		}
+		policy, found := byID[id]
+		switch {
+		case found:
+			posture[resource.ID] = policy
+		case id != "":
+			// Assigned a policy missing from the listing, such as one
+			// created since: the default does not apply to it.
+			posture[resource.ID] = ResourcePolicy{ID: id, Unknown: true}
+			unknown = append(unknown, name)
+		case fallback != nil:
+			policy := *fallback
+			policy.Default = true
+			posture[resource.ID] = policy
+		default:
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		t.log(ctx).Warn("Could not determine the security policy of some resources",
+			zap.Strings("resources", unknown))
+	}
+	return posture
+}
+
+// securityPolicies lists the tenant's policies with their device
+// requirements. A schema that does not expose the requirements gets the
+// policies without them.
+func (t *TwingateApp) securityPolicies(ctx context.Context) ([]ResourcePolicy, error) {
+	details, err := t.client.GetSecurityPolicyDetails(ctx)
+	if err == nil {
+		policies := make([]ResourcePolicy, len(details))
+		for i, policy := range details {
+			policies[i] = ResourcePolicy{ID: policy.ID, Name: policy.Name, Type: policy.PolicyType, DeviceRequirements: policy.DeviceRequirements}
+		}
+		return policies, nil
+	}
+	t.log(ctx).Debug("Could not look up device requirements, listing policies without them", zap.Error(err))
+
+	listed, err := t.client.GetSecurityPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]ResourcePolicy, len(listed))
+	for i, policy := range listed {
+		policies[i] = ResourcePolicy{ID: policy.ID, Name: policy.Name, Type: policy.PolicyType}
+	}
+	return policies, nil
+}
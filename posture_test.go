@@ -0,0 +1,87 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestCheckPosture(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if strings.Contains(req.Query, "securityPolicies") {
+			return map[string]any{"securityPolicies": map[string]any{"edges": []any{
+				map[string]any{"node": map[string]any{"id": "p-default", "name": "Default Policy", "policyType": PolicyTypeDefaultResource, "deviceRequirements": []string{}}},
+				map[string]any{"node": map[string]any{"id": "p-mfa", "name": "MFA + Trusted Device", "policyType": "RESOURCE", "deviceRequirements": []string{"TRUSTED_DEVICE", "SCREEN_LOCK"}}},
+			}}}
+		}
+		return map[string]any{"resources": map[string]any{"edges": []any{
+			map[string]any{"node": map[string]any{"id": "r1", "securityPolicy": map[string]any{"id": "p-mfa"}}},
+			map[string]any{"node": map[string]any{"id": "r2", "securityPolicy": nil}},
+			map[string]any{"node": map[string]any{"id": "r3", "securityPolicy": map[string]any{"id": "p-new"}}},
+			map[string]any{"node": map[string]any{"id": "r-other", "securityPolicy": nil}},
+		}}}
+	})
+
+	app := &TwingateApp{
+		Tenant:          "acme",
+		SecurityPosture: true,
+		client:          client,
+		logger:          zap.NewNop(),
+		resources: map[string]Resource{
+			"admin.example.com": newTestResource("r1", "admin.example.com", "10.0.0.1", "net1"),
+			"app.example.com":   newTestResource("r2", "app.example.com", "10.0.0.1", "net1"),
+			"new.example.com":   newTestResource("r3", "new.example.com", "10.0.0.1", "net1"),
+		},
+	}
+	app.posture = app.checkPosture(context.Background())
+
+	status := app.ownStatus()
+	policies := make(map[string]*ResourcePolicy)
+	for _, res := range status.Resources {
+		policies[res.Name] = res.SecurityPolicy
+	}
+	if p := policies["admin.example.com"]; p == nil || p.Name != "MFA + Trusted Device" || p.Default || !slices.Equal(p.DeviceRequirements, []string{"TRUSTED_DEVICE", "SCREEN_LOCK"}) {
+		t.Errorf("admin.example.com policy = %+v", p)
+	}
+	if p := policies["app.example.com"]; p == nil || p.ID != "p-default" || !p.Default {
+		t.Errorf("app.example.com should fall under the default policy, got %+v", p)
+	}
+	if p := policies["new.example.com"]; p == nil || p.ID != "p-new" || !p.Unknown || p.Default {
+		t.Errorf("new.example.com should have an unknown policy, got %+v", p)
+	}
+	if len(app.posture) != 3 {
+		t.Errorf("only managed resources should be listed, got %v", app.posture)
+	}
+}
+
+func TestCheckPosture_WithoutDeviceRequirements(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		switch {
+		case strings.Contains(req.Query, "deviceRequirements"):
+			return errors.New("Cannot query field \"deviceRequirements\" on type \"SecurityPolicy\"")
+		case strings.Contains(req.Query, "securityPolicies"):
+			return map[string]any{"securityPolicies": map[string]any{"edges": []any{
+				map[string]any{"node": map[string]any{"id": "p-mfa", "name": "MFA", "policyType": "RESOURCE"}},
+			}}}
+		}
+		return map[string]any{"resources": map[string]any{"edges": []any{
+			map[string]any{"node": map[string]any{"id": "r1", "securityPolicy": map[string]any{"id": "p-mfa"}}},
+		}}}
+	})
+
+	app := &TwingateApp{
+		client: client,
+		logger: zap.NewNop(),
+		resources: map[string]Resource{
+			"admin.example.com": newTestResource("r1", "admin.example.com", "10.0.0.1", "net1"),
+		},
+	}
+	posture := app.checkPosture(context.Background())
+	if p, ok := posture["r1"]; !ok || p.Name != "MFA" || p.DeviceRequirements != nil {
+		t.Errorf("posture = %+v, want the policy without requirements", posture)
+	}
+}
@@ -0,0 +1,82 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Profile is a named set of resource defaults defined once in the global
+// options and referenced by sites and extra resources, so large Caddyfiles
+// need not repeat them. Settings made on a site or extra resource itself
+// take precedence.
+type Profile struct {
+	// Groups names the groups granted access to the resources.
+	Groups []string `json:"groups,omitempty"`
+
+	// RemoteNetwork is the remote network the resources are placed in.
+	RemoteNetwork string `json:"remote_network,omitempty"`
+
+	// Policy names the security policy the resources are created with,
+	// in place of the one default_access sets.
+	Policy string `json:"policy,omitempty"`
+}
+
+// fill returns remoteNetwork and groups with the profile's values filled
+// in where they are unset.
+func (p Profile) fill(remoteNetwork string, groups []string) (string, []string) {
+	if remoteNetwork == "" {
+		remoteNetwork = p.RemoteNetwork
+	}
+	if len(groups) == 0 {
+		groups = p.Groups
+	}
+	return remoteNetwork, groups
+}
+
+// applyProfiles fills in the settings of endpoints from the profiles they
+// reference. Referencing an undefined profile is an error.
+func (t *TwingateApp) applyProfiles(endpoints []Endpoint) ([]Endpoint, error) {
+	for i, ep := range endpoints {
+		if ep.Profile == "" {
+			continue
+		}
+		profile, ok := t.Profiles[ep.Profile]
+		if !ok {
+			return nil, fmt.Errorf("site %s: unknown profile '%s'", ep.Host, ep.Profile)
+		}
+		endpoints[i].RemoteNetwork, endpoints[i].Groups = profile.fill(ep.RemoteNetwork, ep.Groups)
+		endpoints[i].SecurityPolicy = profile.Policy
+	}
+	return endpoints, nil
+}
+
+// resolveProfilePolicies looks up the security policies profiles name,
+// failing if one does not exist. Policies already resolved are not looked
+// up again.
+func (t *TwingateApp) resolveProfilePolicies(ctx context.Context) error {
+	for _, name := range sortedKeys(t.Profiles) {
+		policy := t.Profiles[name].Policy
+		if policy == "" {
+			continue
+		}
+		if _, ok := t.profilePolicies[policy]; ok {
+			continue
+		}
+
+		resolved, err := t.client.GetSecurityPolicyByName(ctx, policy)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		t.logger.Debug("Resolved profile security policy",
+			zap.String("profile", name),
+			zap.String("id", resolved.ID),
+			zap.String("name", resolved.Name))
+		if t.profilePolicies == nil {
+			t.profilePolicies = make(map[string]string)
+		}
+		t.profilePolicies[policy] = resolved.ID
+	}
+	return nil
+}
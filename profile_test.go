@@ -0,0 +1,174 @@
+package twingate
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/reverseproxy"
+	"go.uber.org/zap"
+)
+
+func TestUnmarshalCaddyfile_Profile(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		profile internal {
+			groups Devs Ops
+			remote_network Internal
+			policy Standard
+		}
+		extra_resources {
+			lab-net {
+				address 10.10.0.0/24
+				profile internal
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	profile := app.Profiles["internal"]
+	if !slices.Equal(profile.Groups, []string{"Devs", "Ops"}) || profile.RemoteNetwork != "Internal" || profile.Policy != "Standard" {
+		t.Errorf("profile = %+v", profile)
+	}
+	if app.ExtraResources[0].Profile != "internal" {
+		t.Errorf("extra resource profile = %q, want internal", app.ExtraResources[0].Profile)
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		profile internal {
+			groups Devs
+		}
+		profile internal {
+			groups Ops
+		}
+	}`))
+	if err == nil {
+		t.Error("expected error for a profile defined twice")
+	}
+}
+
+func TestSiteConfigProfile(t *testing.T) {
+	s := &SiteConfig{}
+	err := s.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		profile internal
+		groups Admins
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Profile != "internal" || !slices.Equal(s.Groups, []string{"Admins"}) {
+		t.Errorf("site config = %+v", s)
+	}
+}
+
+func TestApplyProfiles(t *testing.T) {
+	app := &TwingateApp{
+		logger: zap.NewNop(),
+		Profiles: map[string]Profile{
+			"internal": {Groups: []string{"Devs"}, RemoteNetwork: "Internal", Policy: "Standard"},
+		},
+	}
+	endpoints := discoverTestEndpoints(t,
+		siteRoute("api.example.com", &SiteConfig{Profile: "internal"}, &reverseproxy.Handler{}),
+		siteRoute("admin.example.com", &SiteConfig{Profile: "internal", Groups: []string{"Admins"}}, &reverseproxy.Handler{}),
+		siteRoute("www.example.com", &reverseproxy.Handler{}),
+	)
+
+	applied, err := app.applyProfiles([]Endpoint{
+		endpoints["admin.example.com"], endpoints["api.example.com"], endpoints["www.example.com"],
+	})
+	if err != nil {
+		t.Fatalf("applyProfiles() failed: %v", err)
+	}
+
+	api := applied[1].ToResourceMapping("10.0.0.1")
+	if !slices.Equal(api.Groups, []string{"Devs"}) || api.RemoteNetwork != "Internal" || api.SecurityPolicy != "Standard" {
+		t.Errorf("api mapping = %+v, want the profile's settings", api)
+	}
+	if admin := applied[0]; !slices.Equal(admin.Groups, []string{"Admins"}) || admin.RemoteNetwork != "Internal" {
+		t.Errorf("admin endpoint = %+v, want its own groups", admin)
+	}
+	if www := applied[2]; www.Groups != nil || www.RemoteNetwork != "" {
+		t.Errorf("www endpoint = %+v, want no profile settings", www)
+	}
+
+	if _, err := app.applyProfiles([]Endpoint{{Host: "x.example.com", Profile: "missing"}}); err == nil {
+		t.Error("expected error for an unknown profile")
+	}
+}
+
+func TestSyncSingleResource_ProfilePolicy(t *testing.T) {
+	mock := &MockTwingateClient{}
+	client := &createRecorder{MockTwingateClient: mock}
+	syncer := &ResourceSyncer{
+		client:          client,
+		logger:          zap.NewNop(),
+		defaultAccess:   &DefaultAccess{SecurityPolicy: "Default"},
+		defaultPolicyID: "p-default",
+		policyIDs:       map[string]string{"Standard": "p-standard"},
+	}
+
+	mappings := []ResourceMapping{
+		{Name: "app.example.com", Address: "10.0.0.1", SecurityPolicy: "Standard"},
+		{Name: "www.example.com", Address: "10.0.0.1"},
+	}
+	for _, mapping := range mappings {
+		if _, err := syncer.syncSingleResource(context.Background(), mapping, "net1"); err != nil {
+			t.Fatalf("syncSingleResource() failed: %v", err)
+		}
+	}
+	if got := client.inputs[0].SecurityPolicyID; got != "p-standard" {
+		t.Errorf("app.example.com created with policy %q, want the profile's", got)
+	}
+	if got := client.inputs[1].SecurityPolicyID; got != "p-default" {
+		t.Errorf("www.example.com created with policy %q, want the default", got)
+	}
+}
+
+func TestResolveProfilePolicies(t *testing.T) {
+	queries := 0
+	client := newTestClient(t, func(req graphqlRequest) any {
+		queries++
+		return map[string]any{"securityPolicies": map[string]any{
+			"edges": []any{
+				map[string]any{"node": map[string]any{"id": "p1", "name": "Standard", "policyType": "RESOURCE"}},
+			},
+			"pageInfo": map[string]any{"hasNextPage": false, "endCursor": nil},
+		}}
+	})
+	app := &TwingateApp{
+		client:   client,
+		logger:   zap.NewNop(),
+		Profiles: map[string]Profile{"internal": {Policy: "Standard"}, "open": {}},
+	}
+
+	for range 2 {
+		if err := app.resolveProfilePolicies(context.Background()); err != nil {
+			t.Fatalf("resolveProfilePolicies() failed: %v", err)
+		}
+	}
+	if app.profilePolicies["Standard"] != "p1" || queries != 1 {
+		t.Errorf("profilePolicies = %v after %d queries, want Standard resolved once", app.profilePolicies, queries)
+	}
+
+	app.Profiles["admin"] = Profile{Policy: "Strict"}
+	if err := app.resolveProfilePolicies(context.Background()); err == nil || !strings.Contains(err.Error(), "profile admin") {
+		t.Errorf("expected an unknown policy error for profile admin, got %v", err)
+	}
+}
+
+func TestValidateExtraResourceProfile(t *testing.T) {
+	t.Setenv("TWINGATE_API_KEY", "test-key")
+	app := &TwingateApp{
+		Tenant:         "acme",
+		ExtraResources: []ExtraResource{{Name: "lab-net", Address: "10.10.0.0/24", Profile: "missing"}},
+	}
+	if err := app.Validate(); err == nil {
+		t.Error("expected error for an unknown extra resource profile")
+	}
+}
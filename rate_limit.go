@@ -0,0 +1,222 @@
+package twingate
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultRateLimitWarning is the share of the rate limit left, in percent,
+// at which a warning is logged unless configured otherwise.
+const defaultRateLimitWarning = 10
+
+// RateLimitStatus is the API rate limit as the API last reported it.
+type RateLimitStatus struct {
+	// Limit is the number of requests allowed per window, if reported.
+	Limit int `json:"limit,omitempty"`
+
+	// Remaining is the number of requests left in the current window.
+	Remaining int `json:"remaining"`
+
+	// Reset is when the current window ends, if reported.
+	Reset *time.Time `json:"reset,omitempty"`
+
+	// Updated is when the API last reported the limit.
+	Updated time.Time `json:"updated"`
+}
+
+// parseRateLimitWarning parses a rate_limit_warning value: a number of
+// requests left, or a share of the limit such as "10%".
+func parseRateLimitWarning(s string) (count, percent int, err error) {
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		percent, err = strconv.Atoi(p)
+		if err != nil || percent < 0 || percent > 100 {
+			return 0, 0, fmt.Errorf("must be a number of requests or a percentage, got: %s", s)
+		}
+		return 0, percent, nil
+	}
+	count, err = strconv.Atoi(s)
+	if err != nil || count < 0 {
+		return 0, 0, fmt.Errorf("must be a number of requests or a percentage, got: %s", s)
+	}
+	return count, 0, nil
+}
+
+// rateLimitTracker follows the rate limit headers of API responses,
+// exports them as metrics and warns once per window when the requests
+// left drop to the warning threshold.
+type rateLimitTracker struct {
+	mu sync.Mutex
+
+	// warnCount, or warnPercent of the limit, is the warning threshold.
+	warnCount   int
+	warnPercent int
+
+	status *RateLimitStatus
+	warned bool
+
+	endpoint string
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+func newRateLimitTracker(endpoint string, logger *zap.Logger) *rateLimitTracker {
+	r := &rateLimitTracker{endpoint: endpoint, logger: logger, now: time.Now}
+	r.configure("")
+	return r
+}
+
+// configure sets the warning threshold from a rate_limit_warning value,
+// already validated. Like the circuit breaker, the tracker is shared by
+// every app instance using the same client, so the last started
+// configuration applies.
+func (r *rateLimitTracker) configure(warning string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.warnCount, r.warnPercent = 0, defaultRateLimitWarning
+	if warning != "" {
+		r.warnCount, r.warnPercent, _ = parseRateLimitWarning(warning)
+	}
+}
+
+// observe reads the rate limit headers of a response, in either the
+// X-RateLimit-* or the RateLimit-* form. A 429 response without them means
+// no requests are left until its Retry-After.
+func (r *rateLimitTracker) observe(resp *http.Response) {
+	if r == nil {
+		return
+	}
+	limit, hasLimit := headerInt(resp.Header, "X-RateLimit-Limit", "RateLimit-Limit")
+	remaining, hasRemaining := headerInt(resp.Header, "X-RateLimit-Remaining", "RateLimit-Remaining")
+	reset, hasReset := headerInt(resp.Header, "X-RateLimit-Reset", "RateLimit-Reset")
+	limited := resp.StatusCode == http.StatusTooManyRequests
+	if !hasLimit && !hasRemaining && !limited {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	status := &RateLimitStatus{Limit: limit, Remaining: remaining, Updated: now}
+	if !hasLimit && r.status != nil {
+		status.Limit = r.status.Limit
+	}
+	if limited && !hasRemaining {
+		status.Remaining = 0
+	}
+	var resetAt time.Time
+	switch {
+	case hasReset && reset > 1e9:
+		// An epoch timestamp rather than seconds left
+		resetAt = time.Unix(int64(reset), 0)
+	case hasReset:
+		resetAt = now.Add(time.Duration(reset) * time.Second)
+	case limited:
+		if retry := resp.Header.Get("Retry-After"); retry != "" {
+			if seconds, err := strconv.Atoi(retry); err == nil {
+				resetAt = now.Add(time.Duration(seconds) * time.Second)
+			} else if at, err := http.ParseTime(retry); err == nil {
+				resetAt = at
+			}
+		}
+	}
+	if !resetAt.IsZero() {
+		status.Reset = &resetAt
+	}
+	r.status = status
+	r.export(status)
+
+	threshold := r.warnCount
+	if r.warnPercent > 0 {
+		threshold = status.Limit * r.warnPercent / 100
+	}
+	if status.Remaining > threshold {
+		r.warned = false
+		return
+	}
+	if r.warned {
+		return
+	}
+	r.warned = true
+	fields := []zap.Field{
+		zap.String("endpoint", r.endpoint),
+		zap.Int("remaining", status.Remaining),
+	}
+	if status.Limit > 0 {
+		fields = append(fields, zap.Int("limit", status.Limit))
+	}
+	if status.Reset != nil {
+		fields = append(fields, zap.Time("reset", *status.Reset))
+	}
+	r.logger.Warn("Twingate API rate limit nearly used up, consider syncing less often", fields...)
+}
+
+// export sets the rate limit metrics. It must be called with r.mu held.
+func (r *rateLimitTracker) export(status *RateLimitStatus) {
+	if twingateMetrics.rateLimitRemaining == nil {
+		return
+	}
+	twingateMetrics.rateLimitRemaining.WithLabelValues(r.endpoint).Set(float64(status.Remaining))
+	if status.Limit > 0 {
+		twingateMetrics.rateLimitLimit.WithLabelValues(r.endpoint).Set(float64(status.Limit))
+	}
+	if status.Reset != nil {
+		twingateMetrics.rateLimitReset.WithLabelValues(r.endpoint).Set(float64(status.Reset.Unix()))
+	}
+}
+
+// snapshot returns the last reported rate limit, or nil if the API has
+// not reported one.
+func (r *rateLimitTracker) snapshot() *RateLimitStatus {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status == nil {
+		return nil
+	}
+	status := *r.status
+	return &status
+}
+
+// headerInt returns the integer value of the first of names present in h.
+// Parameters after the value, as in "100;w=60", are ignored.
+func headerInt(h http.Header, names ...string) (int, bool) {
+	for _, name := range names {
+		value := h.Get(name)
+		if value == "" {
+			continue
+		}
+		value, _, _ = strings.Cut(value, ";")
+		value, _, _ = strings.Cut(value, ",")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+// rateLimitTransport passes every API response to a rateLimitTracker.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	tracker *rateLimitTracker
+}
+
+func (t rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.tracker.observe(resp)
+	}
+	return resp, err
+}
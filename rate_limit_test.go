@@ -0,0 +1,144 @@
+package twingate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func rateLimitResponse(status int, headers ...string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	for i := 0; i < len(headers); i += 2 {
+		resp.Header.Set(headers[i], headers[i+1])
+	}
+	return resp
+}
+
+func TestRateLimitTracker_Observe(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	tracker := newRateLimitTracker("https://acme.twingate.com/api/graphql/", zap.New(core))
+	now := time.Unix(1700000000, 0)
+	tracker.now = func() time.Time { return now }
+
+	if tracker.observe(rateLimitResponse(http.StatusOK)); tracker.snapshot() != nil {
+		t.Fatal("a response without rate limit headers should not set a status")
+	}
+
+	tracker.observe(rateLimitResponse(http.StatusOK,
+		"X-RateLimit-Limit", "60", "X-RateLimit-Remaining", "30", "X-RateLimit-Reset", "20"))
+	status := tracker.snapshot()
+	if status == nil || status.Limit != 60 || status.Remaining != 30 || !status.Reset.Equal(now.Add(20*time.Second)) {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("no warning expected above the threshold, got %v", logs.All())
+	}
+
+	// The default threshold is 10% of the limit, warned about once
+	tracker.observe(rateLimitResponse(http.StatusOK, "RateLimit-Remaining", "6;w=60", "RateLimit-Reset", "1700000030"))
+	tracker.observe(rateLimitResponse(http.StatusOK, "RateLimit-Remaining", "5"))
+	if logs.Len() != 1 {
+		t.Fatalf("expected one warning, got %d", logs.Len())
+	}
+	if status := tracker.snapshot(); status.Limit != 60 || status.Reset != nil {
+		t.Errorf("limit should carry over and reset should not: %+v", status)
+	}
+	if reset := logs.All()[0].ContextMap()["reset"]; !reset.(time.Time).Equal(time.Unix(1700000030, 0)) {
+		t.Errorf("an epoch reset should be used as is, got %v", reset)
+	}
+
+	// A new window re-arms the warning, and a 429 leaves no requests
+	tracker.observe(rateLimitResponse(http.StatusOK, "X-RateLimit-Remaining", "59"))
+	tracker.observe(rateLimitResponse(http.StatusTooManyRequests, "Retry-After", "45"))
+	if logs.Len() != 2 {
+		t.Fatalf("expected a second warning, got %d", logs.Len())
+	}
+	status = tracker.snapshot()
+	if status.Remaining != 0 || !status.Reset.Equal(now.Add(45*time.Second)) {
+		t.Errorf("unexpected status after a 429: %+v", status)
+	}
+}
+
+func TestRateLimitTracker_Configure(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	tracker := newRateLimitTracker("test", zap.New(core))
+
+	tracker.configure("20")
+	tracker.observe(rateLimitResponse(http.StatusOK, "X-RateLimit-Limit", "1000", "X-RateLimit-Remaining", "21"))
+	tracker.observe(rateLimitResponse(http.StatusOK, "X-RateLimit-Limit", "1000", "X-RateLimit-Remaining", "20"))
+	if logs.Len() != 1 {
+		t.Fatalf("expected a warning at 20 requests left, got %d", logs.Len())
+	}
+
+	tracker.configure("50%")
+	tracker.observe(rateLimitResponse(http.StatusOK, "X-RateLimit-Limit", "1000", "X-RateLimit-Remaining", "600"))
+	tracker.observe(rateLimitResponse(http.StatusOK, "X-RateLimit-Limit", "1000", "X-RateLimit-Remaining", "500"))
+	if logs.Len() != 2 {
+		t.Fatalf("expected a warning at half the limit, got %d", logs.Len())
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	initMetrics()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		w.Write([]byte(`{"data": {}}`))
+	}))
+	defer server.Close()
+
+	client := NewTwingateClient(server.URL, "key")
+	if _, err := client.client.ExecRaw(t.Context(), "query { __typename }", nil); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if status := client.rateLimit.snapshot(); status == nil || status.Remaining != 42 || status.Limit != 60 {
+		t.Errorf("unexpected rate limit status: %+v", status)
+	}
+}
+
+func TestParseRateLimitWarning(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		count   int
+		percent int
+		wantErr bool
+	}{
+		{in: "25", count: 25},
+		{in: "5%", percent: 5},
+		{in: "0", count: 0},
+		{in: "150%", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "lots", wantErr: true},
+	} {
+		count, percent, err := parseRateLimitWarning(tt.in)
+		if (err != nil) != tt.wantErr || count != tt.count || percent != tt.percent {
+			t.Errorf("parseRateLimitWarning(%q) = %d, %d, %v", tt.in, count, percent, err)
+		}
+	}
+}
+
+func TestUnmarshalCaddyfile_RateLimitWarning(t *testing.T) {
+	app := &TwingateApp{}
+	if err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		rate_limit_warning 25%
+	}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.RateLimitWarning != "25%" {
+		t.Errorf("RateLimitWarning = %q, want 25%%", app.RateLimitWarning)
+	}
+
+	if err := (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		rate_limit_warning some
+	}`)); err == nil {
+		t.Error("expected error for an invalid threshold")
+	}
+}
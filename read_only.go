@@ -0,0 +1,188 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errReadOnly is returned for any change to the tenant while read_only is
+// set.
+var errReadOnly = errors.New("read_only is set, the tenant is not modified")
+
+// readOnlyAPI passes the lookups of a TwingateAPI through and refuses its
+// mutations, so no code path of a read_only app can change the tenant.
+type readOnlyAPI struct {
+	TwingateAPI
+}
+
+func (readOnlyAPI) CreateResource(context.Context, ResourceCreateInput) (*Resource, error) {
+	return nil, errReadOnly
+}
+
+func (readOnlyAPI) UpdateResource(context.Context, ResourceUpdateInput) (*Resource, error) {
+	return nil, errReadOnly
+}
+
+func (readOnlyAPI) DeleteResource(context.Context, string) error {
+	return errReadOnly
+}
+
+func (readOnlyAPI) AddResourceAccess(context.Context, string, []AccessPrincipal) error {
+	return errReadOnly
+}
+
+func (readOnlyAPI) RemoveResourceAccess(context.Context, string, []string) error {
+	return errReadOnly
+}
+
+// GetOrCreateRemoteNetwork only looks the network up. A network that does
+// not exist is an error, as it cannot be created.
+func (a readOnlyAPI) GetOrCreateRemoteNetwork(ctx context.Context, name string) (*RemoteNetwork, error) {
+	network, err := a.GetRemoteNetworkByName(ctx, name)
+	if err == nil && network == nil {
+		err = errReadOnly
+	}
+	return network, err
+}
+
+// Plan actions reported by a read_only sync, besides "unchanged",
+// "conflict" and "unknown".
+const (
+	ReportActionWouldCreate = "would_create"
+	ReportActionWouldUpdate = "would_update"
+	ReportActionWouldRename = "would_rename"
+)
+
+// planSync is the sync of a read_only app: it plans the changes a sync
+// would make and reports them, with the drift found, without making any.
+// The existing resources matched by the plan stand in for the synced ones
+// in the status, access and posture views.
+func (t *TwingateApp) planSync(ctx context.Context, syncer *ResourceSyncer, mappings []ResourceMapping, calls *apiStats) error {
+	logger := t.log(ctx)
+	started := time.Now()
+
+	plan, err := syncer.GetSyncSummary(ctx, mappings, t.remoteNetworkName(), t.ResourceCleanup)
+	t.recordAPIStats(ctx, calls.snapshot())
+	if err != nil {
+		if t.ReportPath != "" {
+			t.writeReport(ctx, newPlanReport(t.Tenant, t.lastSyncID, started, nil, err))
+		}
+		return fmt.Errorf("failed to plan sync: %w", err)
+	}
+
+	t.reportDrift(ctx, syncer.Drifts())
+	t.lastDrifts = syncer.Drifts()
+	t.lastPlan = plan
+	t.recordPlan(plan)
+
+	logger.Info("Read-only sync planned, tenant left unchanged",
+		zap.Int("create", plan.ResourcesToCreate),
+		zap.Int("update", plan.ResourcesToUpdate),
+		zap.Int("delete", plan.ResourcesToDelete),
+		zap.Int("drift", len(t.lastDrifts)))
+
+	t.lastSync = time.Now()
+	t.resources = plannedResources(plan)
+	t.renamed = renamedHosts(mappings)
+
+	var noAccess []string
+	if t.AccessCheck {
+		noAccess = t.checkNoAccess(ctx, t.resources)
+	}
+	if t.ReportPath != "" {
+		report := newPlanReport(t.Tenant, t.lastSyncID, started, plan, nil)
+		report.markNoAccess(noAccess)
+		t.writeReport(ctx, report)
+	}
+	if t.AddressCheck != nil {
+		t.addressProblems = t.checkAddresses(ctx, mappings)
+	}
+	if t.SecurityPosture {
+		t.posture = t.checkPosture(ctx)
+	}
+	if t.AccessListing {
+		t.access = t.listAccess(ctx)
+	}
+	return nil
+}
+
+// plannedResources returns the existing resources the plan matched to
+// mappings, keyed by mapping name.
+func plannedResources(plan *SyncSummary) map[string]Resource {
+	resources := make(map[string]Resource)
+	for _, item := range plan.Resources {
+		if item.ID == "" || item.Action == "delete" {
+			continue
+		}
+		resource := Resource{ID: item.ID, Name: item.Name}
+		resource.Address.Value = item.Address
+		resources[item.Name] = resource
+	}
+	return resources
+}
+
+// recordPlan sets the planned changes gauge from plan.
+func (t *TwingateApp) recordPlan(plan *SyncSummary) {
+	if twingateMetrics.plannedChanges == nil {
+		return
+	}
+	counts := map[string]int{"create": 0, "update": 0, "rename": 0, "delete": 0}
+	for _, item := range plan.Resources {
+		if _, ok := counts[item.Action]; ok {
+			counts[item.Action]++
+		}
+	}
+	for action, count := range counts {
+		twingateMetrics.plannedChanges.WithLabelValues(t.Tenant, action).Set(float64(count))
+	}
+}
+
+// newPlanReport returns the report of a read_only sync, listing what a
+// sync would have done to each resource.
+func newPlanReport(tenant, syncID string, started time.Time, plan *SyncSummary, planErr error) *SyncReport {
+	finished := time.Now()
+	report := &SyncReport{
+		Tenant:     tenant,
+		SyncID:     syncID,
+		ReadOnly:   true,
+		StartedAt:  started.UTC(),
+		FinishedAt: finished.UTC(),
+		DurationMS: finished.Sub(started).Milliseconds(),
+		Success:    planErr == nil,
+		Counts:     make(map[string]int),
+	}
+	if planErr != nil {
+		report.Error = planErr.Error()
+		return report
+	}
+
+	for _, item := range plan.Resources {
+		entry := ReportEntry{
+			Name:          item.Name,
+			ID:            item.ID,
+			Address:       item.Address,
+			RemoteNetwork: item.RemoteNetwork,
+			Action:        item.Action,
+		}
+		switch item.Action {
+		case "create":
+			entry.Action = ReportActionWouldCreate
+		case "update":
+			entry.Action = ReportActionWouldUpdate
+		case "rename":
+			entry.Action = ReportActionWouldRename
+		case "delete":
+			entry.Action = ReportActionWouldDelete
+			report.Deletions = append(report.Deletions, entry)
+			report.Counts[entry.Action]++
+			continue
+		}
+		report.Resources = append(report.Resources, entry)
+		report.Counts[entry.Action]++
+	}
+	return report
+}
@@ -0,0 +1,191 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func TestReadOnlyAPI(t *testing.T) {
+	mock := &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{"r1": newTestResource("r1", "api.example.com", "10.0.0.1", "net1")},
+	}
+	api := readOnlyAPI{mock}
+	ctx := context.Background()
+
+	if _, err := api.CreateResource(ctx, ResourceCreateInput{Name: "new.example.com"}); !errors.Is(err, errReadOnly) {
+		t.Errorf("CreateResource() error = %v, want errReadOnly", err)
+	}
+	if _, err := api.UpdateResource(ctx, ResourceUpdateInput{ID: "r1"}); !errors.Is(err, errReadOnly) {
+		t.Errorf("UpdateResource() error = %v, want errReadOnly", err)
+	}
+	if err := api.DeleteResource(ctx, "r1"); !errors.Is(err, errReadOnly) {
+		t.Errorf("DeleteResource() error = %v, want errReadOnly", err)
+	}
+	if len(mock.Resources) != 1 || len(mock.DeletedIDs) != 0 {
+		t.Errorf("mutations should not reach the client: %v", mock.CallLog)
+	}
+
+	// Lookups pass through, and an existing network is used as is
+	if resource, err := api.GetResource(ctx, "r1"); err != nil || resource == nil {
+		t.Errorf("GetResource() = %v, %v", resource, err)
+	}
+	if network, err := api.GetOrCreateRemoteNetwork(ctx, "Caddy-Managed"); err != nil || network.ID != "net1" {
+		t.Errorf("GetOrCreateRemoteNetwork() = %v, %v", network, err)
+	}
+	if _, err := api.GetOrCreateRemoteNetwork(ctx, "IoT"); !errors.Is(err, errReadOnly) {
+		t.Errorf("missing network error = %v, want errReadOnly", err)
+	}
+	if _, ok := mock.Networks["IoT"]; ok {
+		t.Error("a missing network should not be created")
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	initMetrics()
+
+	mock := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{
+			"r1": newTestResource("r1", "api.example.com", "10.0.0.1", "net1"),
+			"r2": newTestResource("r2", "web.example.com", "10.0.0.9", "net1"),
+			"r3": newTestResource("r3", "old.example.com", "10.0.0.1", "net1"),
+		},
+	}
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	app := &TwingateApp{
+		Tenant:          "acme",
+		ReadOnly:        true,
+		ReportPath:      reportPath,
+		ResourceCleanup: &CleanupConfig{Enabled: true},
+		api:             readOnlyAPI{mock},
+		logger:          zap.NewNop(),
+	}
+	// web.example.com was last set to 10.0.0.1 and changed since
+	syncer := &ResourceSyncer{
+		client: app.api,
+		logger: zap.NewNop(),
+		applied: map[string]AppliedFields{
+			"r2": {Name: "web.example.com", Address: "10.0.0.1"},
+		},
+	}
+	mappings := []ResourceMapping{
+		{Name: "api.example.com", Address: "10.0.0.1"},
+		{Name: "web.example.com", Address: "10.0.0.1"},
+		{Name: "new.example.com", Address: "10.0.0.1"},
+	}
+
+	if err := app.planSync(context.Background(), syncer, mappings, &apiStats{}); err != nil {
+		t.Fatalf("planSync() failed: %v", err)
+	}
+	if len(mock.Resources) != 3 || len(mock.DeletedIDs) != 0 {
+		t.Errorf("planSync should not change the tenant: %v", mock.CallLog)
+	}
+
+	if app.lastPlan == nil || app.lastPlan.ResourcesToCreate != 1 ||
+		app.lastPlan.ResourcesToUpdate != 1 || app.lastPlan.ResourcesToDelete != 1 {
+		t.Fatalf("unexpected plan: %+v", app.lastPlan)
+	}
+	if len(app.resources) != 2 || app.resources["web.example.com"].ID != "r2" {
+		t.Errorf("resources should hold the matched existing ones: %+v", app.resources)
+	}
+	if len(app.lastDrifts) != 1 || app.lastDrifts[0].ResourceID != "r2" ||
+		app.lastDrifts[0].Field != FieldAddress || app.lastDrifts[0].Actual != "10.0.0.9" {
+		t.Errorf("unexpected drift: %+v", app.lastDrifts)
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("report not written: %v", err)
+	}
+	var report SyncReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+	if !report.ReadOnly || !report.Success {
+		t.Errorf("report should be a successful read-only one: %+v", report)
+	}
+	want := map[string]int{
+		ReportActionWouldCreate: 1,
+		ReportActionWouldUpdate: 1,
+		ReportActionWouldDelete: 1,
+		"unchanged":             1,
+	}
+	for action, count := range want {
+		if report.Counts[action] != count {
+			t.Errorf("Counts[%s] = %d, want %d (%v)", action, report.Counts[action], count, report.Counts)
+		}
+	}
+	if len(report.Deletions) != 1 || report.Deletions[0].ID != "r3" {
+		t.Errorf("unexpected deletions: %+v", report.Deletions)
+	}
+}
+
+func TestNewPlanReport_Error(t *testing.T) {
+	report := newPlanReport("acme", "sync-1", time.Now(), nil, errors.New("rate limited"))
+	if report.Success || report.Error != "rate limited" || !report.ReadOnly || len(report.Resources) != 0 {
+		t.Errorf("unexpected failed plan report: %+v", report)
+	}
+}
+
+func TestAdminAPI_ReadOnly(t *testing.T) {
+	initMetrics()
+
+	mock := &MockTwingateClient{}
+	app := &TwingateApp{
+		Tenant:   "acme",
+		ReadOnly: true,
+		api:      readOnlyAPI{mock},
+		logger:   zap.NewNop(),
+		retries:  newRetryQueue(nil),
+	}
+	setActiveApp(t, app)
+
+	a := &adminAPI{}
+	err := a.handleRetryFailures(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/twingate/failures/retry", strings.NewReader(`{"all": true}`)))
+	var apiErr caddy.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusConflict {
+		t.Errorf("handleRetryFailures() error = %v, want 409", err)
+	}
+
+	err = a.handleCleanup(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/twingate/cleanup", strings.NewReader(`{"ids": ["r1"]}`)))
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusConflict {
+		t.Errorf("handleCleanup() error = %v, want 409", err)
+	}
+}
+
+func TestUnmarshalCaddyfile_ReadOnly(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		read_only
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !app.ReadOnly {
+		t.Error("ReadOnly should be set")
+	}
+
+	err = (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		read_only yes
+	}`))
+	if err == nil {
+		t.Error("expected error for an argument to read_only")
+	}
+}
@@ -0,0 +1,61 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// DuplicateNetworkError is returned when a remote network is looked up by
+// a name that several networks share. Setting remote_network_id to one
+// of IDs selects it.
+type DuplicateNetworkError struct {
+	Name string
+	IDs  []string
+}
+
+func (e *DuplicateNetworkError) Error() string {
+	return fmt.Sprintf("%d remote networks are named %q (%s); rename one or set remote_network_id to choose one",
+		len(e.IDs), e.Name, strings.Join(e.IDs, ", "))
+}
+
+// resolveRemoteNetworkID looks up the network configured by
+// remote_network_id, failing if it does not exist. Without
+// remote_network_id, or once resolved, it does nothing.
+func (t *TwingateApp) resolveRemoteNetworkID(ctx context.Context) error {
+	if t.RemoteNetworkID == "" || t.remoteNetwork != nil {
+		return nil
+	}
+
+	network, err := t.client.GetRemoteNetwork(ctx, t.RemoteNetworkID)
+	if err != nil {
+		return fmt.Errorf("remote_network_id: %w", err)
+	}
+	if network == nil {
+		return fmt.Errorf("remote_network_id: no remote network with ID %s", t.RemoteNetworkID)
+	}
+
+	t.logger.Info("Using remote network by ID",
+		zap.String("id", network.ID),
+		zap.String("name", network.Name))
+	t.remoteNetwork = network
+	return nil
+}
+
+// remoteNetworkName returns the name of the default remote network: that
+// of the network configured by ID, remote_network, or
+// DefaultRemoteNetworkName. It is empty while remote_network_id is not
+// resolved yet.
+func (t *TwingateApp) remoteNetworkName() string {
+	switch {
+	case t.remoteNetwork != nil:
+		return t.remoteNetwork.Name
+	case t.RemoteNetworkID != "":
+		return ""
+	case t.RemoteNetwork != "":
+		return t.RemoteNetwork
+	}
+	return DefaultRemoteNetworkName
+}
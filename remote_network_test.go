@@ -0,0 +1,141 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func TestGetRemoteNetwork(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if req.Variables["id"] == "net-1" {
+			return map[string]any{"remoteNetwork": map[string]any{"id": "net-1", "name": "Edge"}}
+		}
+		return map[string]any{"remoteNetwork": nil}
+	})
+
+	network, err := client.GetRemoteNetwork(context.Background(), "net-1")
+	if err != nil || network == nil || network.Name != "Edge" {
+		t.Fatalf("GetRemoteNetwork() = %+v, %v", network, err)
+	}
+	if network, err := client.GetRemoteNetwork(context.Background(), "missing"); err != nil || network != nil {
+		t.Errorf("expected no network for an unknown ID, got %+v, %v", network, err)
+	}
+}
+
+func TestGetRemoteNetworkByName_Duplicates(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		return map[string]any{"remoteNetworks": map[string]any{"edges": []any{
+			map[string]any{"node": map[string]any{"id": "net-1", "name": "Edge"}},
+			map[string]any{"node": map[string]any{"id": "net-2", "name": "Core"}},
+			map[string]any{"node": map[string]any{"id": "net-3", "name": "Edge"}},
+		}}}
+	})
+
+	if network, err := client.GetRemoteNetworkByName(context.Background(), "Core"); err != nil || network == nil || network.ID != "net-2" {
+		t.Errorf("GetRemoteNetworkByName(Core) = %+v, %v", network, err)
+	}
+
+	_, err := client.GetRemoteNetworkByName(context.Background(), "Edge")
+	var dup *DuplicateNetworkError
+	if !errors.As(err, &dup) || !slices.Equal(dup.IDs, []string{"net-1", "net-3"}) {
+		t.Fatalf("expected a duplicate network error listing both IDs, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "net-1, net-3") {
+		t.Errorf("error should list the candidate IDs: %v", err)
+	}
+}
+
+func TestUpdateAndDeleteRemoteNetwork(t *testing.T) {
+	var queries []string
+	client := newTestClient(t, func(req graphqlRequest) any {
+		queries = append(queries, req.Query)
+		switch {
+		case strings.Contains(req.Query, "remoteNetworkUpdate"):
+			if req.Variables["id"] != "net-1" || req.Variables["name"] != "Edge-2" {
+				t.Errorf("unexpected update variables: %v", req.Variables)
+			}
+			return map[string]any{"remoteNetworkUpdate": map[string]any{
+				"ok": true, "entity": map[string]any{"id": "net-1", "name": "Edge-2"},
+			}}
+		case req.Variables["id"] == "busy":
+			return map[string]any{"remoteNetworkDelete": map[string]any{"ok": false, "error": "network has resources"}}
+		default:
+			return map[string]any{"remoteNetworkDelete": map[string]any{"ok": true}}
+		}
+	})
+
+	network, err := client.UpdateRemoteNetwork(context.Background(), "net-1", "Edge-2")
+	if err != nil || network.Name != "Edge-2" {
+		t.Fatalf("UpdateRemoteNetwork() = %+v, %v", network, err)
+	}
+	if err := client.DeleteRemoteNetwork(context.Background(), "net-1"); err != nil {
+		t.Fatalf("DeleteRemoteNetwork() failed: %v", err)
+	}
+	if err := client.DeleteRemoteNetwork(context.Background(), "busy"); err == nil || !strings.Contains(err.Error(), "network has resources") {
+		t.Errorf("expected the API error, got %v", err)
+	}
+	if len(queries) != 3 || !strings.Contains(queries[1], "remoteNetworkDelete") {
+		t.Errorf("unexpected requests: %v", queries)
+	}
+}
+
+func TestResolveRemoteNetworkID(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		return map[string]any{"remoteNetwork": nil}
+	})
+	app := &TwingateApp{RemoteNetworkID: "missing", client: client, logger: zap.NewNop()}
+	if err := app.resolveRemoteNetworkID(context.Background()); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected an error for an unknown network ID, got %v", err)
+	}
+	if got := app.remoteNetworkName(); got != "" {
+		t.Errorf("remoteNetworkName() = %q before resolving, want empty", got)
+	}
+}
+
+func TestSyncResources_DefaultNetworkByID(t *testing.T) {
+	network := &RemoteNetwork{ID: "net-9", Name: "Shared-Name"}
+	mock := &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Shared-Name": {ID: "net-1", Name: "Shared-Name"}},
+		Resources: map[string]Resource{},
+	}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop(), defaultNetwork: network}
+
+	mappings := []ResourceMapping{{Name: "app.example.com", Address: "10.0.0.1"}}
+	if err := syncer.SyncResources(context.Background(), mappings, network.Name, nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+
+	if slices.ContainsFunc(mock.CallLog, func(call string) bool {
+		return strings.HasPrefix(call, "GetOrCreateRemoteNetwork")
+	}) {
+		t.Errorf("the network configured by ID should not be looked up by name: %v", mock.CallLog)
+	}
+	if got := syncer.SyncedResources()["app.example.com"]; got.RemoteNetwork.ID != "net-9" {
+		t.Errorf("resource created in network %q, want net-9", got.RemoteNetwork.ID)
+	}
+}
+
+func TestRemoteNetworkIDConfig(t *testing.T) {
+	app := &TwingateApp{}
+	if err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		remote_network_id UmVtb3RlTmV0d29yazox
+	}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.RemoteNetworkID != "UmVtb3RlTmV0d29yazox" {
+		t.Errorf("RemoteNetworkID = %q", app.RemoteNetworkID)
+	}
+
+	t.Setenv("TWINGATE_API_KEY", "test-api-key-123")
+	app = &TwingateApp{Tenant: "acme", RemoteNetwork: "Edge", RemoteNetworkID: "UmVtb3RlTmV0d29yazox"}
+	if err := app.Validate(); err == nil {
+		t.Error("expected error when both remote_network and remote_network_id are set")
+	}
+}
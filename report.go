@@ -0,0 +1,229 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultReportKeep = 10
+
+	// reportTimeFormat is used in the file names of timestamped reports.
+	// The fixed-width fraction keeps syncs within one second apart and
+	// the names sorting in time order.
+	reportTimeFormat = "20060102T150405.000000000Z"
+
+	// reportPrefix sets the timestamped reports apart from other files
+	// named after report_path, which pruning must leave alone.
+	reportPrefix = "-report-"
+)
+
+// SyncReport is the machine-readable summary of one sync, written to
+// report_path for external compliance tooling.
+type SyncReport struct {
+	Tenant     string         `json:"tenant"`
+	SyncID     string         `json:"sync_id,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	DurationMS int64          `json:"duration_ms"`
+	Success    bool           `json:"success"`
+	Error      string         `json:"error,omitempty"`
+	Resources  []ReportEntry  `json:"resources"`
+	Deletions  []ReportEntry  `json:"deletions,omitempty"`
+	Counts     map[string]int `json:"counts"`
+
+	// ReadOnly marks the report of a read_only sync, whose actions were
+	// only planned.
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+// ReportEntry describes what a sync did to a single resource.
+type ReportEntry struct {
+	Name          string  `json:"name"`
+	ID            string  `json:"id,omitempty"`
+	Address       string  `json:"address"`
+	Alias         *string `json:"alias,omitempty"`
+	RemoteNetwork string  `json:"remote_network,omitempty"`
+	Action        string  `json:"action"`
+	Error         string  `json:"error,omitempty"`
+	DurationMS    int64   `json:"duration_ms,omitempty"`
+
+	// NoAccess flags a resource no group or service account has access
+	// to, with access_check enabled.
+	NoAccess bool `json:"no_access,omitempty"`
+}
+
+// Report actions besides the syncer's upsert actions.
+const (
+	ReportActionFailed       = "failed"
+	ReportActionSkipped      = "skipped"
+	ReportActionDeleted      = "deleted"
+	ReportActionWouldDelete  = "would_delete"
+	ReportActionDeleteFailed = "delete_failed"
+)
+
+func newSyncReport(tenant string, started time.Time, mappings []ResourceMapping, syncer *ResourceSyncer, syncErr error) *SyncReport {
+	finished := time.Now()
+	report := &SyncReport{
+		Tenant:     tenant,
+		StartedAt:  started.UTC(),
+		FinishedAt: finished.UTC(),
+		DurationMS: finished.Sub(started).Milliseconds(),
+		Success:    syncErr == nil,
+		Counts:     make(map[string]int),
+	}
+	if syncErr != nil {
+		report.Error = syncErr.Error()
+	}
+
+	failures := make(map[string]error)
+	for _, f := range syncer.FailedMappings() {
+		failures[f.Mapping.Name] = f.Err
+	}
+
+	for _, m := range mappings {
+		entry := ReportEntry{
+			Name:          m.Name,
+			Address:       m.Address,
+			Alias:         m.Alias,
+			RemoteNetwork: m.RemoteNetwork,
+			Action:        syncer.Actions()[m.Name],
+			DurationMS:    syncer.Durations()[m.Name].Milliseconds(),
+		}
+		if res, ok := syncer.SyncedResources()[m.Name]; ok {
+			entry.ID = res.ID
+		}
+		if err, ok := failures[m.Name]; ok {
+			entry.Action = ReportActionFailed
+			entry.Error = err.Error()
+		}
+		if entry.Action == "" {
+			// The sync stopped before reaching this mapping
+			entry.Action = ReportActionSkipped
+		}
+		report.Resources = append(report.Resources, entry)
+		report.Counts[entry.Action]++
+	}
+
+	for _, d := range syncer.Deletions() {
+		entry := ReportEntry{
+			Name:    d.Resource.Name,
+			ID:      d.Resource.ID,
+			Address: d.Resource.Address.Value,
+			Alias:   d.Resource.Alias,
+			Action:  ReportActionDeleted,
+		}
+		switch {
+		case d.DryRun:
+			entry.Action = ReportActionWouldDelete
+		case d.Err != nil:
+			entry.Action = ReportActionDeleteFailed
+			entry.Error = d.Err.Error()
+		}
+		report.Deletions = append(report.Deletions, entry)
+		report.Counts[entry.Action]++
+	}
+
+	return report
+}
+
+// markNoAccess flags the resources in names as having no access, and
+// counts them under no_access.
+func (r *SyncReport) markNoAccess(names []string) {
+	for i := range r.Resources {
+		if slices.Contains(names, r.Resources[i].Name) {
+			r.Resources[i].NoAccess = true
+			r.Counts["no_access"]++
+		}
+	}
+}
+
+// writeReport writes report to a timestamped file next to ReportPath,
+// replaces ReportPath itself with the latest report, and prunes all but
+// the newest ReportKeep timestamped files. Failures are logged, never
+// returned, so reporting cannot fail a sync.
+func (t *TwingateApp) writeReport(ctx context.Context, report *SyncReport) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		t.log(ctx).Error("Failed to encode sync report", zap.Error(err))
+		return
+	}
+
+	dir := filepath.Dir(t.ReportPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.log(ctx).Error("Failed to create sync report directory", zap.Error(err))
+		return
+	}
+
+	stamped := timestampedReportPath(t.ReportPath, report.StartedAt)
+	if err := os.WriteFile(stamped, data, 0o644); err != nil {
+		t.log(ctx).Error("Failed to write sync report", zap.String("path", stamped), zap.Error(err))
+		return
+	}
+
+	tmp := t.ReportPath + ".tmp"
+	err = os.WriteFile(tmp, data, 0o644)
+	if err == nil {
+		err = os.Rename(tmp, t.ReportPath)
+	}
+	if err != nil {
+		t.log(ctx).Error("Failed to update latest sync report", zap.String("path", t.ReportPath), zap.Error(err))
+	}
+
+	keep := t.ReportKeep
+	if keep <= 0 {
+		keep = defaultReportKeep
+	}
+	if err := pruneReports(t.ReportPath, keep); err != nil {
+		t.log(ctx).Warn("Failed to prune old sync reports", zap.Error(err))
+	}
+
+	t.log(ctx).Debug("Wrote sync report", zap.String("path", stamped))
+}
+
+// timestampedReportPath turns /var/log/twingate.json into
+// /var/log/twingate-report-20260102T150405.000000000Z.json.
+func timestampedReportPath(reportPath string, at time.Time) string {
+	ext := filepath.Ext(reportPath)
+	base := strings.TrimSuffix(reportPath, ext)
+	return base + reportPrefix + at.UTC().Format(reportTimeFormat) + ext
+}
+
+// pruneReports removes all but the newest keep timestamped reports. Only
+// files whose names carry a report timestamp count.
+func pruneReports(reportPath string, keep int) error {
+	ext := filepath.Ext(reportPath)
+	prefix := strings.TrimSuffix(reportPath, ext) + reportPrefix
+
+	globbed, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return err
+	}
+	var matches []string
+	for _, match := range globbed {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext)
+		if _, err := time.Parse(reportTimeFormat, stamp); err == nil {
+			matches = append(matches, match)
+		}
+	}
+	if len(matches) <= keep {
+		return nil
+	}
+
+	// The timestamp format sorts lexically in time order
+	sort.Strings(matches)
+	for _, old := range matches[:len(matches)-keep] {
+		if err := os.Remove(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package twingate
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestNewSyncReport(t *testing.T) {
+	mappings := []ResourceMapping{
+		{Name: "api.example.com", Address: "10.0.0.1"},
+		{Name: "broken.example.com", Address: "10.0.0.1"},
+	}
+
+	syncer := &ResourceSyncer{
+		synced:    map[string]Resource{"api.example.com": newTestResource("r1", "api.example.com", "10.0.0.1", "net1")},
+		actions:   map[string]string{"api.example.com": ActionCreated},
+		durations: map[string]time.Duration{"api.example.com": 250 * time.Millisecond},
+		failed: []FailedMapping{
+			{Mapping: mappings[1], Err: errors.New("boom")},
+		},
+		deletions: []Deletion{
+			{Resource: newTestResource("r9", "old.example.com", "10.0.0.1", "net1")},
+		},
+	}
+
+	report := newSyncReport("acme", time.Now(), mappings, syncer, errors.New("sync completed with 1 errors"))
+
+	if report.Success || report.Error == "" {
+		t.Errorf("report should record the sync error: %+v", report)
+	}
+	if got := report.Resources[0]; got.ID != "r1" || got.Action != ActionCreated || got.DurationMS != 250 {
+		t.Errorf("unexpected entry: %+v", got)
+	}
+	if got := report.Resources[1]; got.Action != ReportActionFailed || got.Error != "boom" {
+		t.Errorf("unexpected failed entry: %+v", got)
+	}
+	if len(report.Deletions) != 1 || report.Deletions[0].Action != ReportActionDeleted {
+		t.Errorf("unexpected deletions: %+v", report.Deletions)
+	}
+	if report.Counts[ActionCreated] != 1 || report.Counts[ReportActionFailed] != 1 {
+		t.Errorf("unexpected counts: %v", report.Counts)
+	}
+}
+
+func TestWriteReportRotates(t *testing.T) {
+	dir := t.TempDir()
+	app := &TwingateApp{
+		ReportPath: filepath.Join(dir, "reports", "twingate.json"),
+		ReportKeep: 2,
+		logger:     zap.NewNop(),
+	}
+
+	// Another app's report next to this one is not pruned
+	other := filepath.Join(dir, "reports", "twingate-staging.json")
+	if err := os.MkdirAll(filepath.Dir(other), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(other, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Syncs within the same second get reports of their own
+	start := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		app.writeReport(t.Context(), &SyncReport{Tenant: "acme", StartedAt: start.Add(time.Duration(i) * time.Millisecond)})
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "reports", "twingate-report-*.json"))
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 timestamped reports, got %v", matches)
+	}
+	if filepath.Base(matches[0]) != "twingate-report-20260102T150405.001000000Z.json" {
+		t.Errorf("oldest report should have been pruned, got %v", matches)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("another app's report was removed: %v", err)
+	}
+
+	data, err := os.ReadFile(app.ReportPath)
+	if err != nil {
+		t.Fatalf("latest report missing: %v", err)
+	}
+	var latest SyncReport
+	if err := json.Unmarshal(data, &latest); err != nil {
+		t.Fatalf("latest report is not valid JSON: %v", err)
+	}
+	if !latest.StartedAt.Equal(start.Add(2 * time.Millisecond)) {
+		t.Errorf("latest report should be the newest, got %v", latest.StartedAt)
+	}
+}
@@ -0,0 +1,376 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRetryInitialDelay = 30 * time.Second
+	defaultRetryMaxDelay     = 30 * time.Minute
+	defaultRetryMaxAttempts  = 10
+
+	// retryPollInterval is how often the retry loop looks for due entries.
+	retryPollInterval = 5 * time.Second
+)
+
+// RetryConfig controls how resources that failed to upsert are retried
+// between full syncs.
+type RetryConfig struct {
+	Disabled     bool           `json:"disabled,omitempty"`
+	InitialDelay caddy.Duration `json:"initial_delay,omitempty"`
+	MaxDelay     caddy.Duration `json:"max_delay,omitempty"`
+	MaxAttempts  int            `json:"max_attempts,omitempty"`
+}
+
+// FailedMapping is a mapping whose upsert failed during a sync.
+type FailedMapping struct {
+	Mapping   ResourceMapping
+	NetworkID string
+	Err       error
+}
+
+// retryEntry tracks a failed mapping awaiting retry.
+type retryEntry struct {
+	Mapping   ResourceMapping `json:"mapping"`
+	NetworkID string          `json:"network_id"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	NextRetry time.Time       `json:"next_retry"`
+	GaveUp    bool            `json:"gave_up,omitempty"`
+}
+
+// retryQueue holds failed mappings keyed by name and schedules their
+// retries with exponential backoff.
+type retryQueue struct {
+	mu      sync.Mutex
+	entries map[string]*retryEntry
+
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	maxAttempts  int
+	now          func() time.Time
+}
+
+func newRetryQueue(cfg *RetryConfig) *retryQueue {
+	q := &retryQueue{
+		entries:      make(map[string]*retryEntry),
+		initialDelay: defaultRetryInitialDelay,
+		maxDelay:     defaultRetryMaxDelay,
+		maxAttempts:  defaultRetryMaxAttempts,
+		now:          time.Now,
+	}
+	if cfg != nil {
+		if cfg.InitialDelay > 0 {
+			q.initialDelay = time.Duration(cfg.InitialDelay)
+		}
+		if cfg.MaxDelay > 0 {
+			q.maxDelay = time.Duration(cfg.MaxDelay)
+		}
+		if cfg.MaxAttempts > 0 {
+			q.maxAttempts = cfg.MaxAttempts
+		}
+	}
+	return q
+}
+
+// backoff returns the delay before the next retry after attempts failures.
+func (q *retryQueue) backoff(attempts int) time.Duration {
+	delay := q.initialDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= q.maxDelay {
+			return q.maxDelay
+		}
+	}
+	return delay
+}
+
+// fail records a failed attempt for mapping and reports whether the entry
+// has now exhausted its attempts.
+func (q *retryQueue) fail(mapping ResourceMapping, networkID string, err error) (retryEntry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.entries[mapping.Name]
+	if !ok {
+		entry = &retryEntry{}
+		q.entries[mapping.Name] = entry
+	}
+
+	entry.Mapping = mapping
+	entry.NetworkID = networkID
+	// Calls refused by the open circuit breaker never reached the API.
+	if !errors.Is(err, ErrCircuitOpen) {
+		entry.Attempts++
+	}
+	entry.LastError = err.Error()
+	entry.NextRetry = q.now().Add(q.backoff(entry.Attempts))
+
+	gaveUp := !entry.GaveUp && entry.Attempts >= q.maxAttempts
+	if gaveUp {
+		entry.GaveUp = true
+	}
+
+	q.updateGauge()
+	return *entry, gaveUp
+}
+
+// succeed drops the entry for name, reporting whether one existed.
+func (q *retryQueue) succeed(name string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, ok := q.entries[name]
+	delete(q.entries, name)
+	q.updateGauge()
+	return ok
+}
+
+// reconcile applies the outcome of a full sync: failures are recorded,
+// and entries for mappings that synced or are no longer desired are
+// dropped. Entries for desired mappings the sync never reached, as when it
+// failed early, are kept.
+func (q *retryQueue) reconcile(desired []ResourceMapping, synced map[string]Resource, failures []FailedMapping) []retryEntry {
+	wanted := make(map[string]bool, len(desired))
+	for _, mapping := range desired {
+		wanted[mapping.Name] = true
+	}
+
+	q.mu.Lock()
+	for name := range q.entries {
+		if _, ok := synced[name]; ok || !wanted[name] {
+			delete(q.entries, name)
+		}
+	}
+	q.mu.Unlock()
+
+	var abandoned []retryEntry
+	for _, f := range failures {
+		if entry, gaveUp := q.fail(f.Mapping, f.NetworkID, f.Err); gaveUp {
+			abandoned = append(abandoned, entry)
+		}
+	}
+
+	q.mu.Lock()
+	q.updateGauge()
+	q.mu.Unlock()
+
+	return abandoned
+}
+
+// due returns the entries whose next retry time has passed, oldest first.
+func (q *retryQueue) due() []retryEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	var due []retryEntry
+	for _, entry := range q.entries {
+		if !entry.GaveUp && !now.Before(entry.NextRetry) {
+			due = append(due, *entry)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextRetry.Before(due[j].NextRetry)
+	})
+	return due
+}
+
+// snapshot returns a copy of all entries sorted by name.
+func (q *retryQueue) snapshot() []retryEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := make([]retryEntry, 0, len(q.entries))
+	for _, entry := range q.entries {
+		entries = append(entries, *entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Mapping.Name < entries[j].Mapping.Name
+	})
+	return entries
+}
+
+// statusFailures returns the entries as listed in /twingate/status.
+func (q *retryQueue) statusFailures() []StatusFailure {
+	var failures []StatusFailure
+	for _, entry := range q.snapshot() {
+		failures = append(failures, StatusFailure{
+			Name:      entry.Mapping.Name,
+			Attempts:  entry.Attempts,
+			LastError: entry.LastError,
+			NextRetry: entry.NextRetry,
+			GaveUp:    entry.GaveUp,
+		})
+	}
+	return failures
+}
+
+// updateGauge must be called with q.mu held.
+func (q *retryQueue) updateGauge() {
+	if twingateMetrics.resourcesFailing != nil {
+		twingateMetrics.resourcesFailing.Set(float64(len(q.entries)))
+	}
+}
+
+// runRetryLoop retries failed mappings as they come due until ctx is done.
+func (t *TwingateApp) runRetryLoop(ctx context.Context) {
+	ticker := time.NewTicker(retryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.retryDue(ctx)
+		}
+	}
+}
+
+// retryDue retries the failed mappings that are due. With
+// approval_required nothing is retried: a failed mapping is planned again
+// by the next sync and waits for approval like any other change.
+func (t *TwingateApp) retryDue(ctx context.Context) {
+	if t.ApprovalRequired {
+		return
+	}
+	if t.client != nil && !t.client.breaker.ready() {
+		return
+	}
+	for _, entry := range t.retries.due() {
+		if ctx.Err() != nil {
+			return
+		}
+		t.retryOne(ctx, entry)
+	}
+}
+
+// retryOne retries a failed mapping, returning the error if it failed again.
+func (t *TwingateApp) retryOne(ctx context.Context, entry retryEntry) error {
+	t.syncMutex.Lock()
+	defer t.syncMutex.Unlock()
+
+	ctx = withSyncID(ctx)
+	syncer := t.newSyncer(ctx)
+	t.loadSyncState(ctx, syncer)
+	resource, err := syncer.syncSingleResource(ctx, entry.Mapping, entry.NetworkID)
+	t.reportDrift(ctx, syncer.Drifts())
+	if err != nil {
+		twingateMetrics.retryAttempts.WithLabelValues("failure").Inc()
+
+		updated, gaveUp := t.retries.fail(entry.Mapping, entry.NetworkID, err)
+		if gaveUp {
+			t.reportAbandoned(ctx, updated)
+			return err
+		}
+
+		t.log(ctx).Warn("Retry of failed resource did not succeed",
+			zap.String("name", entry.Mapping.Name),
+			zap.Int("attempts", updated.Attempts),
+			zap.Time("next_retry", updated.NextRetry),
+			zap.Error(err))
+		return err
+	}
+
+	twingateMetrics.retryAttempts.WithLabelValues("success").Inc()
+	t.retries.succeed(entry.Mapping.Name)
+
+	if t.resources == nil {
+		t.resources = make(map[string]Resource)
+	}
+	t.resources[entry.Mapping.Name] = *resource
+
+	t.log(ctx).Info("Retry of failed resource succeeded",
+		zap.String("name", entry.Mapping.Name),
+		zap.Int("previous_attempts", entry.Attempts))
+
+	t.emit(ctx, "twingate_resource_recovered", map[string]any{
+		"name":     entry.Mapping.Name,
+		"id":       resource.ID,
+		"attempts": entry.Attempts + 1,
+	})
+	return nil
+}
+
+// RetriedResource is the outcome of a forced retry of a failed resource.
+type RetriedResource struct {
+	Tenant    string `json:"tenant"`
+	Name      string `json:"name"`
+	Recovered bool   `json:"recovered"`
+	Error     string `json:"error,omitempty"`
+}
+
+// forceRetry retries the named failed resources, or every one without
+// names, in the app and each tenant block right away. Resources given up
+// on are retried too; one that fails again stays given up.
+func (t *TwingateApp) forceRetry(ctx context.Context, names []string) []RetriedResource {
+	var retried []RetriedResource
+	if t.retries != nil {
+		for _, entry := range t.retries.snapshot() {
+			if ctx.Err() != nil {
+				break
+			}
+			if len(names) > 0 && !slices.Contains(names, entry.Mapping.Name) {
+				continue
+			}
+			t.log(ctx).Info("Forcing retry of failed resource",
+				zap.String("name", entry.Mapping.Name),
+				zap.Int("attempts", entry.Attempts))
+			result := RetriedResource{Tenant: t.Tenant, Name: entry.Mapping.Name, Recovered: true}
+			if err := t.retryOne(ctx, entry); err != nil {
+				result.Recovered = false
+				result.Error = err.Error()
+			}
+			retried = append(retried, result)
+		}
+	}
+
+	for _, label := range t.tenantLabels() {
+		retried = append(retried, t.Tenants[label].forceRetry(ctx, names)...)
+	}
+	return retried
+}
+
+// failures lists the resources awaiting retry in the app and each tenant
+// block.
+func (t *TwingateApp) failures() []StatusFailure {
+	var failures []StatusFailure
+	if t.retries != nil {
+		for _, failure := range t.retries.statusFailures() {
+			failure.Tenant = t.Tenant
+			failures = append(failures, failure)
+		}
+	}
+	for _, label := range t.tenantLabels() {
+		failures = append(failures, t.Tenants[label].failures()...)
+	}
+	return failures
+}
+
+// reportAbandoned logs, counts and emits an event for a mapping that has
+// exhausted its retry attempts. It stays listed until the next full sync.
+func (t *TwingateApp) reportAbandoned(ctx context.Context, entry retryEntry) {
+	twingateMetrics.resourcesAbandoned.Inc()
+
+	t.log(ctx).Error("Giving up on resource after repeated failures",
+		zap.String("name", entry.Mapping.Name),
+		zap.Int("attempts", entry.Attempts),
+		zap.String("last_error", entry.LastError))
+
+	t.emit(ctx, "twingate_resource_failed", map[string]any{
+		"name":       entry.Mapping.Name,
+		"attempts":   entry.Attempts,
+		"last_error": entry.LastError,
+	})
+}
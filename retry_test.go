@@ -0,0 +1,130 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func TestRetryQueueBackoff(t *testing.T) {
+	q := newRetryQueue(&RetryConfig{
+		InitialDelay: caddy.Duration(10 * time.Second),
+		MaxDelay:     caddy.Duration(time.Minute),
+	})
+
+	expected := []time.Duration{
+		10 * time.Second,
+		20 * time.Second,
+		40 * time.Second,
+		time.Minute,
+		time.Minute,
+	}
+	for i, want := range expected {
+		if got := q.backoff(i + 1); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestRetryQueueGivesUp(t *testing.T) {
+	initMetrics()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := newRetryQueue(&RetryConfig{MaxAttempts: 2})
+	q.now = func() time.Time { return now }
+
+	mapping := ResourceMapping{Name: "api.example.com", Address: "10.0.0.1"}
+
+	entry, gaveUp := q.fail(mapping, "net1", errors.New("boom"))
+	if gaveUp {
+		t.Fatal("should not give up after the first failure")
+	}
+	if !entry.NextRetry.Equal(now.Add(defaultRetryInitialDelay)) {
+		t.Errorf("NextRetry = %v, want %v", entry.NextRetry, now.Add(defaultRetryInitialDelay))
+	}
+	if len(q.due()) != 0 {
+		t.Error("entry should not be due before its backoff elapses")
+	}
+
+	now = now.Add(defaultRetryInitialDelay)
+	if len(q.due()) != 1 {
+		t.Fatal("entry should be due once its backoff elapses")
+	}
+
+	if _, gaveUp := q.fail(mapping, "net1", errors.New("boom")); !gaveUp {
+		t.Error("should give up after max_attempts failures")
+	}
+
+	now = now.Add(time.Hour)
+	if len(q.due()) != 0 {
+		t.Error("abandoned entries should not be retried")
+	}
+	if len(q.snapshot()) != 1 {
+		t.Error("abandoned entries should stay listed until the next full sync")
+	}
+}
+
+func TestRetryQueueReconcile(t *testing.T) {
+	initMetrics()
+
+	q := newRetryQueue(nil)
+	a := ResourceMapping{Name: "a.example.com"}
+	b := ResourceMapping{Name: "b.example.com"}
+
+	c := ResourceMapping{Name: "c.example.com"}
+	gone := ResourceMapping{Name: "gone.example.com"}
+
+	q.fail(a, "net1", errors.New("boom"))
+	q.fail(b, "net1", errors.New("boom"))
+	q.fail(c, "net1", errors.New("boom"))
+	q.fail(gone, "net1", errors.New("boom"))
+
+	// a succeeded in the full sync, b failed again, the sync stopped
+	// before reaching c, and gone is no longer desired
+	synced := map[string]Resource{"a.example.com": newTestResource("r1", "a.example.com", "10.0.0.1", "net1")}
+	q.reconcile([]ResourceMapping{a, b, c}, synced, []FailedMapping{{Mapping: b, NetworkID: "net1", Err: errors.New("again")}})
+
+	entries := q.snapshot()
+	if len(entries) != 2 || entries[0].Mapping.Name != "b.example.com" || entries[1].Mapping.Name != "c.example.com" {
+		t.Fatalf("expected b and c to remain, got %+v", entries)
+	}
+	if entries[0].Attempts != 2 {
+		t.Errorf("Attempts = %d, want 2", entries[0].Attempts)
+	}
+	if entries[0].LastError != "again" {
+		t.Errorf("LastError = %q, want %q", entries[0].LastError, "again")
+	}
+	if entries[1].Attempts != 1 || entries[1].LastError != "boom" {
+		t.Errorf("c = %+v, want it kept as it was", entries[1])
+	}
+}
+
+func TestRetryOneSuccess(t *testing.T) {
+	initMetrics()
+
+	mockClient := &MockTwingateClient{}
+	app := &TwingateApp{
+		api:     mockClient,
+		logger:  zap.NewNop(),
+		retries: newRetryQueue(nil),
+	}
+
+	mapping := ResourceMapping{Name: "api.example.com", Address: "10.0.0.1"}
+	entry, _ := app.retries.fail(mapping, "net1", errors.New("transient"))
+
+	app.retryOne(context.Background(), entry)
+
+	if len(app.retries.snapshot()) != 0 {
+		t.Error("successful retry should clear the entry")
+	}
+	if _, ok := app.resources["api.example.com"]; !ok {
+		t.Error("successful retry should add the resource to the index")
+	}
+	if len(mockClient.Resources) != 1 {
+		t.Errorf("expected 1 created resource, got %d", len(mockClient.Resources))
+	}
+}
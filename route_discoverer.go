@@ -1,28 +1,77 @@
 package twingate
 
 import (
-	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
-	"github.com/caddyserver/caddy/v2/modules/caddyhttp/reverseproxy"
 	"go.uber.org/zap"
 )
 
 type RouteDiscoverer struct {
-	logger       *zap.Logger
-	caddyAddress string
+	logger         *zap.Logger
+	caddyAddresses []string
+
+	// errorRoutes also walks each server's error routes. Only hosts and
+	// paths not found in the regular routes are taken from them.
+	errorRoutes bool
 }
 
 type RouteContext struct {
-	Hosts []string
-	Path  string
+	Hosts         []string
+	Path          string
+	RemoteNetwork string
+	ID            string
+	Groups        []string
+	Profile       string
+	Labels        map[string]string
+	TTL           time.Duration
+
+	// ExcludedHosts are host patterns negated by not matchers on the
+	// way to the route. Matching hosts are not emitted.
+	ExcludedHosts []string
 }
 
 type Endpoint struct {
-	Host string
-	Path string
+	Host          string
+	Path          string
+	RemoteNetwork string
+
+	// ID is the identity label set by the site's twingate directive.
+	ID string
+
+	// Groups and Profile are set by the site's twingate directive. The
+	// profile supplies defaults for the settings the site leaves unset.
+	Groups  []string
+	Profile string
+
+	// SecurityPolicy names the security policy of the endpoint's
+	// resources, from its profile.
+	SecurityPolicy string
+
+	// Labels are set by the twingate_label directive, the site's twingate
+	// directive or twingate_label.* route variables.
+	Labels map[string]string
+
+	// TTL is set by the site's twingate directive: the endpoint's
+	// resources are deleted that long after they were created.
+	TTL time.Duration
+
+	// Upstreams are the dial addresses of the host's reverse proxies.
+	Upstreams []string
+
+	// Address is the address of an endpoint reached directly rather than
+	// through Caddy, such as a service registered in Consul. Empty points
+	// the endpoint's resource at Caddy.
+	Address string
+
+	// Protocols restricts the protocols and ports of the host's resource.
+	// Nil allows all.
+	Protocols *ProtocolsInput
 }
 
 func (e *Endpoint) CanonicalKey() string {
@@ -34,27 +83,116 @@ func (e *Endpoint) ResourceName() string {
 	return e.Host
 }
 
-// ResourceAlias returns nil for wildcard hosts, otherwise returns the hostname as a valid DNS name
+// IsWildcard reports whether the host is a wildcard pattern such as
+// *.lab.example.com.
+func (e *Endpoint) IsWildcard() bool {
+	return strings.Contains(e.Host, "*")
+}
+
+// ResourceAlias returns nil for wildcard hosts, otherwise returns the
+// hostname as a valid DNS name. The wildcard_hosts option can set a
+// wildcard host as the alias instead.
 func (e *Endpoint) ResourceAlias() *string {
-	if strings.Contains(e.Host, "*") {
+	if e.IsWildcard() {
 		return nil
 	}
 
 	return &e.Host
 }
 
+// Identity returns the key the endpoint's resource is tracked by across
+// host renames: the site's id label if it has one, otherwise its upstreams.
+// It is empty when neither is known.
+func (e *Endpoint) Identity() string {
+	if e.ID != "" {
+		return "id:" + e.ID
+	}
+	if len(e.Upstreams) > 0 {
+		return "upstream:" + strings.Join(e.Upstreams, ",")
+	}
+	return ""
+}
+
 func (e *Endpoint) ToResourceMapping(caddyAddress string) ResourceMapping {
 	return ResourceMapping{
-		Name:    e.ResourceName(),
-		Alias:   e.ResourceAlias(),
-		Address: caddyAddress,
+		Name:           e.ResourceName(),
+		Alias:          e.ResourceAlias(),
+		Address:        caddyAddress,
+		Groups:         e.Groups,
+		RemoteNetwork:  e.RemoteNetwork,
+		SecurityPolicy: e.SecurityPolicy,
+		Identity:       e.Identity(),
+		Labels:         e.Labels,
+		Protocols:      e.Protocols,
+		TTL:            e.TTL,
+	}
+}
+
+// ToDNSResourceMapping returns a mapping whose address is the host pattern
+// itself. No alias is needed since clients resolve the address directly.
+func (e *Endpoint) ToDNSResourceMapping() ResourceMapping {
+	return ResourceMapping{
+		Name:           e.ResourceName(),
+		Address:        e.Host,
+		Groups:         e.Groups,
+		RemoteNetwork:  e.RemoteNetwork,
+		SecurityPolicy: e.SecurityPolicy,
+		Identity:       e.Identity(),
+		Labels:         e.Labels,
+		Protocols:      e.Protocols,
+		TTL:            e.TTL,
+	}
+}
+
+// ToResourceMappings returns one mapping per Caddy address. With a single
+// address this is the same as ToResourceMapping. With several, each resource
+// is named "host@address" and carries no alias, since Twingate aliases must
+// be unique; use a DNS-name caddy_address to keep the alias across nodes.
+func (e *Endpoint) ToResourceMappings(caddyAddresses []string) []ResourceMapping {
+	if len(caddyAddresses) == 1 {
+		return []ResourceMapping{e.ToResourceMapping(caddyAddresses[0])}
+	}
+
+	mappings := make([]ResourceMapping, len(caddyAddresses))
+	for i, addr := range caddyAddresses {
+		mappings[i] = e.addressMapping(e.ResourceName()+"@"+addr, addr, "@"+addr)
+	}
+	return mappings
+}
+
+// addressMapping returns the mapping named name of one of the several
+// addresses the endpoint is published at. It carries no alias, and its
+// identity, if any, ends in suffix to tell it from the others.
+func (e *Endpoint) addressMapping(name, address, suffix string) ResourceMapping {
+	mapping := ResourceMapping{
+		Name:           name,
+		Address:        address,
+		Groups:         e.Groups,
+		RemoteNetwork:  e.RemoteNetwork,
+		SecurityPolicy: e.SecurityPolicy,
+		Labels:         e.Labels,
+		Protocols:      e.Protocols,
+		TTL:            e.TTL,
+	}
+	if identity := e.Identity(); identity != "" {
+		mapping.Identity = identity + suffix
 	}
+	return mapping
 }
 
 func (d *RouteDiscoverer) DiscoverEndpoints(httpApp *caddyhttp.App) ([]Endpoint, error) {
 	endpointMap := make(map[string]Endpoint)
 
-	for serverName, server := range httpApp.Servers {
+	// Servers and endpoints are visited in a fixed order, so conflicts
+	// between hosts resolve the same way on every run.
+	serverNames := make([]string, 0, len(httpApp.Servers))
+	for serverName := range httpApp.Servers {
+		serverNames = append(serverNames, serverName)
+	}
+	sort.Strings(serverNames)
+
+	for _, serverName := range serverNames {
+		server := httpApp.Servers[serverName]
 		d.logger.Debug("Scanning server", zap.String("server", serverName))
 
 		ctx := RouteContext{
@@ -66,12 +204,16 @@ func (d *RouteDiscoverer) DiscoverEndpoints(httpApp *caddyhttp.App) ([]Endpoint,
 			ctx.Hosts = []string{serverName}
 		}
 
-		for i, route := range server.Routes {
-			d.logger.Debug("Scanning route",
-				zap.String("server", serverName),
-				zap.Int("route_index", i))
+		d.traverseRoutes(server.Routes, ctx, endpointMap)
 
-			d.traverseRoute(route, ctx, endpointMap)
+		if d.errorRoutes && server.Errors != nil {
+			errorMap := make(map[string]Endpoint)
+			d.traverseRoutes(server.Errors.Routes, ctx, errorMap)
+			for key, ep := range errorMap {
+				if _, exists := endpointMap[key]; !exists {
+					endpointMap[key] = ep
+				}
+			}
 		}
 	}
 
@@ -79,22 +221,66 @@ func (d *RouteDiscoverer) DiscoverEndpoints(httpApp *caddyhttp.App) ([]Endpoint,
 	for _, ep := range endpointMap {
 		endpoints = append(endpoints, ep)
 	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].CanonicalKey() < endpoints[j].CanonicalKey()
+	})
 
 	// Deduplicate by host - Twingate works at the host level, not per-path
 	hostMap := make(map[string]Endpoint)
 	for _, ep := range endpoints {
-		if _, exists := hostMap[ep.Host]; !exists {
+		existing, exists := hostMap[ep.Host]
+		if !exists {
 			hostMap[ep.Host] = Endpoint{
-				Host: ep.Host,
-				Path: "",
+				Host:          ep.Host,
+				Path:          "",
+				RemoteNetwork: ep.RemoteNetwork,
+				ID:            ep.ID,
+				Groups:        ep.Groups,
+				Profile:       ep.Profile,
+				Labels:        ep.Labels,
+				Upstreams:     ep.Upstreams,
+				TTL:           ep.TTL,
 			}
+			continue
+		}
+		if existing.RemoteNetwork != ep.RemoteNetwork {
+			d.logger.Warn("Conflicting remote_network overrides for host, keeping first",
+				zap.String("host", ep.Host),
+				zap.String("kept", existing.RemoteNetwork),
+				zap.String("ignored", ep.RemoteNetwork))
+		}
+		if existing.ID == "" {
+			existing.ID = ep.ID
 		}
+		if existing.Profile == "" {
+			existing.Profile = ep.Profile
+		}
+		// Paths with different TTLs expire the host's resource with the
+		// shortest.
+		if ep.TTL > 0 && (existing.TTL == 0 || ep.TTL < existing.TTL) {
+			existing.TTL = ep.TTL
+		}
+		// Labels of other paths on the host are added, keeping the first
+		// path's value for a key set on both.
+		if len(ep.Labels) > 0 {
+			labels := maps.Clone(ep.Labels)
+			maps.Copy(labels, existing.Labels)
+			existing.Labels = labels
+		}
+		existing.Groups = slices.Concat(existing.Groups, ep.Groups)
+		existing.Upstreams = slices.Concat(existing.Upstreams, ep.Upstreams)
+		hostMap[ep.Host] = existing
 	}
 
 	endpoints = make([]Endpoint, 0, len(hostMap))
 	for _, ep := range hostMap {
+		ep.Upstreams = uniqueSorted(ep.Upstreams)
+		ep.Groups = uniqueSorted(ep.Groups)
 		endpoints = append(endpoints, ep)
 	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Host < endpoints[j].Host
+	})
 
 	d.logger.Info("Route discovery complete",
 		zap.Int("endpoints_found", len(endpoints)))
@@ -102,90 +288,253 @@ func (d *RouteDiscoverer) DiscoverEndpoints(httpApp *caddyhttp.App) ([]Endpoint,
 	return endpoints, nil
 }
 
-func (d *RouteDiscoverer) traverseRoute(route caddyhttp.Route, parentCtx RouteContext, endpointMap map[string]Endpoint) {
-	ctx := d.mergeMatchers(route, parentCtx)
-
-	for _, handler := range route.Handlers {
-		d.traverseHandler(handler, ctx, endpointMap)
+// traverseRoutes walks a list of sibling routes. An unconditional route
+// holding a twingate site handler applies its settings to every sibling,
+// which is how the Caddyfile adapter lays out a site block's directives.
+// A matched one applies them to the siblings with the same matchers, which
+// is how it lays out directives sharing a named matcher, such as
+// twingate @internal and reverse_proxy @internal.
+func (d *RouteDiscoverer) traverseRoutes(routes caddyhttp.RouteList, ctx RouteContext, endpointMap map[string]Endpoint) {
+	matchedSites := make(map[string][]SiteConfig)
+	for _, route := range routes {
+		sites := d.siteConfigs(route)
+		if len(sites) == 0 {
+			continue
+		}
+		if !hasMatchers(route) {
+			for _, site := range sites {
+				ctx = site.apply(ctx)
+			}
+			continue
+		}
+		key := matcherSetsKey(route)
+		matchedSites[key] = append(matchedSites[key], sites...)
 	}
 
-	if len(route.Handlers) == 0 && len(route.HandlersRaw) > 0 {
-		for _, handlerRaw := range route.HandlersRaw {
-			d.traverseHandlerRaw(handlerRaw, ctx, endpointMap)
+	for i, route := range routes {
+		d.logger.Debug("Scanning route", zap.Int("route_index", i))
+		routeCtx := ctx
+		if len(matchedSites) > 0 && hasMatchers(route) {
+			for _, site := range matchedSites[matcherSetsKey(route)] {
+				routeCtx = site.apply(routeCtx)
+			}
 		}
+		d.traverseRoute(route, routeCtx, endpointMap)
 	}
 }
 
-func (d *RouteDiscoverer) traverseHandler(handler caddyhttp.MiddlewareHandler, ctx RouteContext, endpointMap map[string]Endpoint) {
-	switch h := handler.(type) {
-	case *reverseproxy.Handler:
-		d.emitEndpoints(ctx, endpointMap)
+// siteConfigs returns the twingate site handlers configured directly on a
+// route. A vars handler setting twingate_label.* variables counts as a
+// site handler holding those labels.
+func (d *RouteDiscoverer) siteConfigs(route caddyhttp.Route) []SiteConfig {
+	var sites []SiteConfig
+	for _, h := range routeHandlers(route) {
+		switch h.name {
+		case "twingate":
+			var site SiteConfig
+			if err := h.decode(&site); err == nil {
+				sites = append(sites, site)
+			}
+		case "vars":
+			var vars map[string]any
+			if err := h.decode(&vars); err == nil {
+				if labels := varLabels(vars); labels != nil {
+					sites = append(sites, SiteConfig{Labels: labels})
+				}
+			}
+		}
+	}
+	return sites
+}
 
-	case *caddyhttp.Subroute:
-		for _, route := range h.Routes {
-			d.traverseRoute(route, ctx, endpointMap)
+// varLabels returns the labels set by twingate_label.* route variables.
+// Values that are not strings are formatted as text.
+func varLabels(vars map[string]any) map[string]string {
+	var labels map[string]string
+	for name, value := range vars {
+		key, ok := strings.CutPrefix(name, labelVarPrefix)
+		if !ok || key == "" {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string)
 		}
+		if s, ok := value.(string); ok {
+			labels[key] = s
+		} else {
+			labels[key] = fmt.Sprint(value)
+		}
+	}
+	return labels
+}
+
+func (d *RouteDiscoverer) traverseRoute(route caddyhttp.Route, parentCtx RouteContext, endpointMap map[string]Endpoint) {
+	ctx := d.mergeMatchers(route, parentCtx)
 
-	default:
-		d.logger.Debug("Skipping handler type",
-			zap.String("type", fmt.Sprintf("%T", handler)))
+	for _, site := range d.siteConfigs(route) {
+		ctx = site.apply(ctx)
 	}
+
+	for _, h := range routeHandlers(route) {
+		d.traverseHandler(h, ctx, endpointMap)
+	}
+}
+
+// handlerKinds maps handler names to how discovery treats them. Other
+// handlers are descended into if they nest routes, like subroute does.
+var handlerKinds = map[string]func(d *RouteDiscoverer, h routeHandler, ctx RouteContext, endpointMap map[string]Endpoint){
+	"reverse_proxy": (*RouteDiscoverer).traverseReverseProxy,
+
+	// Applied by traverseRoute/traverseRoutes
+	"twingate": nil,
+	"vars":     nil,
 }
 
-func (d *RouteDiscoverer) traverseHandlerRaw(handlerRaw json.RawMessage, ctx RouteContext, endpointMap map[string]Endpoint) {
-	var handlerConfig map[string]any
-	if err := json.Unmarshal(handlerRaw, &handlerConfig); err != nil {
-		d.logger.Warn("Failed to unmarshal handler", zap.Error(err))
+func (d *RouteDiscoverer) traverseHandler(h routeHandler, ctx RouteContext, endpointMap map[string]Endpoint) {
+	if visit, ok := handlerKinds[h.name]; ok {
+		if visit != nil {
+			visit(d, h, ctx, endpointMap)
+		}
 		return
 	}
 
-	handlerType, ok := handlerConfig["handler"].(string)
-	if !ok {
+	if len(h.routes) == 0 {
+		d.logger.Debug("Skipping handler type", zap.String("type", h.kind()))
 		return
 	}
+	if h.name != "subroute" {
+		d.logger.Debug("Descending into routes of handler",
+			zap.String("type", h.kind()),
+			zap.Int("routes", len(h.routes)))
+	}
+	d.traverseRoutes(h.routes, ctx, endpointMap)
+}
 
-	switch handlerType {
-	case "reverse_proxy":
-		d.emitEndpoints(ctx, endpointMap)
+// traverseReverseProxy emits the endpoints a reverse proxy serves, with
+// its upstreams' dial addresses.
+func (d *RouteDiscoverer) traverseReverseProxy(h routeHandler, ctx RouteContext, endpointMap map[string]Endpoint) {
+	var config struct {
+		Upstreams []struct {
+			Dial string `json:"dial"`
+		} `json:"upstreams"`
+	}
+	if err := h.decode(&config); err != nil {
+		d.logger.Warn("Failed to read reverse_proxy upstreams", zap.Error(err))
+	}
 
-	case "subroute":
-		if routes, ok := handlerConfig["routes"].([]any); ok {
-			for _, routeAny := range routes {
-				if routeBytes, err := json.Marshal(routeAny); err == nil {
-					var route caddyhttp.Route
-					if err := json.Unmarshal(routeBytes, &route); err == nil {
-						d.traverseRoute(route, ctx, endpointMap)
-					}
-				}
-			}
+	var upstreams []string
+	for _, upstream := range config.Upstreams {
+		if upstream.Dial != "" {
+			upstreams = append(upstreams, upstream.Dial)
 		}
 	}
+	d.emitEndpoints(ctx, upstreams, endpointMap)
 }
 
 func (d *RouteDiscoverer) mergeMatchers(route caddyhttp.Route, parentCtx RouteContext) RouteContext {
+	matcherSets := routeMatcherSets(route)
 	ctx := RouteContext{
-		Hosts: parentCtx.Hosts,
-		Path:  parentCtx.Path,
+		Hosts:         parentCtx.Hosts,
+		Path:          parentCtx.Path,
+		RemoteNetwork: parentCtx.RemoteNetwork,
+		ID:            parentCtx.ID,
+		Groups:        parentCtx.Groups,
+		Profile:       parentCtx.Profile,
+		Labels:        parentCtx.Labels,
+		TTL:           parentCtx.TTL,
+		ExcludedHosts: parentCtx.ExcludedHosts,
 	}
 
-	for _, matcherSet := range route.MatcherSets {
+	// Matcher sets are alternatives, so the route matches the union of
+	// their hosts. A set without a host matcher keeps the parent's hosts.
+	var hosts, dropped []string
+	for _, matcherSet := range matcherSets {
+		setHosts := parentCtx.Hosts
+		var setExcluded []string
 		for _, matcher := range matcherSet {
 			switch m := matcher.(type) {
 			case *caddyhttp.MatchHost:
-				ctx.Hosts = []string(*m)
+				setHosts = []string(*m)
 
 			case *caddyhttp.MatchPath:
 				paths := []string(*m)
 				if len(paths) > 0 {
 					ctx.Path = d.normalizePath(paths[0])
 				}
+
+			case *caddyhttp.MatchNot:
+				setExcluded = slices.Concat(setExcluded, d.negatedHosts(m))
+
+			case *caddyhttp.MatchExpression:
+				d.logger.Debug("Expression matcher is not evaluated, its hosts may be discovered anyway",
+					zap.String("expression", m.Expr))
+			}
+		}
+
+		if len(matcherSets) == 1 {
+			hosts = setHosts
+			if len(setExcluded) > 0 {
+				ctx.ExcludedHosts = slices.Concat(ctx.ExcludedHosts, setExcluded)
+			}
+			break
+		}
+
+		// Another set may match a host this one negates, so negations
+		// only drop hosts within their own set.
+		for _, host := range setHosts {
+			if matchHostPatterns(strings.ToLower(host), setExcluded) {
+				dropped = append(dropped, host)
+			} else if !slices.Contains(hosts, host) {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	if len(matcherSets) > 0 {
+		// Hosts dropped by every set that has them stay in the context as
+		// excluded hosts, so an emptied host list doesn't fall back to
+		// localhost.
+		for _, host := range dropped {
+			if !slices.Contains(hosts, host) {
+				hosts = append(hosts, host)
+				ctx.ExcludedHosts = append(slices.Clip(ctx.ExcludedHosts), host)
 			}
 		}
+		ctx.Hosts = hosts
 	}
 
 	return ctx
 }
 
+// negatedHosts returns the host patterns a not matcher excludes. Only a
+// negated set consisting of host matchers excludes its hosts; a set that
+// also holds other matchers, such as not { host a; path /b }, still lets
+// some requests to the host through, so it is logged and excludes
+// nothing.
+func (d *RouteDiscoverer) negatedHosts(m *caddyhttp.MatchNot) []string {
+	var excluded []string
+	for _, set := range m.MatcherSets {
+		var hosts []string
+		onlyHosts := true
+		for _, matcher := range set {
+			if host, ok := matcher.(*caddyhttp.MatchHost); ok {
+				hosts = append(hosts, *host...)
+			} else {
+				onlyHosts = false
+			}
+		}
+		switch {
+		case len(hosts) == 0:
+			// Negations of paths and the like don't restrict hosts.
+		case onlyHosts:
+			excluded = append(excluded, hosts...)
+		default:
+			d.logger.Debug("Negated matcher set is too complex to evaluate, not excluding its hosts",
+				zap.Strings("hosts", hosts))
+		}
+	}
+	return excluded
+}
+
 // normalizePath converts path matchers to consistent format:
 // "/api/*" -> "/api/", "/api" -> "/api/", "/" -> ""
 func (d *RouteDiscoverer) normalizePath(path string) string {
@@ -202,7 +551,7 @@ func (d *RouteDiscoverer) normalizePath(path string) string {
 	return path
 }
 
-func (d *RouteDiscoverer) emitEndpoints(ctx RouteContext, endpointMap map[string]Endpoint) {
+func (d *RouteDiscoverer) emitEndpoints(ctx RouteContext, upstreams []string, endpointMap map[string]Endpoint) {
 	hosts := ctx.Hosts
 	if len(hosts) == 0 {
 		hosts = []string{"localhost"}
@@ -211,14 +560,31 @@ func (d *RouteDiscoverer) emitEndpoints(ctx RouteContext, endpointMap map[string
 	}
 
 	for _, host := range hosts {
+		if matchHostPatterns(strings.ToLower(host), ctx.ExcludedHosts) {
+			d.logger.Debug("Skipping host excluded by a not matcher",
+				zap.String("host", host))
+			continue
+		}
 		ep := Endpoint{
-			Host: host,
-			Path: ctx.Path,
+			Host:          host,
+			Path:          ctx.Path,
+			RemoteNetwork: ctx.RemoteNetwork,
+			ID:            ctx.ID,
+			Groups:        ctx.Groups,
+			Profile:       ctx.Profile,
+			Labels:        ctx.Labels,
+			Upstreams:     upstreams,
+			TTL:           ctx.TTL,
 		}
 
 		key := ep.CanonicalKey()
 
-		if _, exists := endpointMap[key]; !exists {
+		if existing, exists := endpointMap[key]; exists {
+			// Several reverse proxies on one path, e.g. behind different
+			// matchers, all contribute to the host's identity.
+			existing.Upstreams = slices.Concat(existing.Upstreams, upstreams)
+			endpointMap[key] = existing
+		} else {
 			endpointMap[key] = ep
 			d.logger.Debug("Discovered endpoint",
 				zap.String("host", ep.Host),
@@ -227,3 +593,13 @@ func (d *RouteDiscoverer) emitEndpoints(ctx RouteContext, endpointMap map[string
 		}
 	}
 }
+
+// uniqueSorted returns the distinct values of s in sorted order.
+func uniqueSorted(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), s...)
+	sort.Strings(sorted)
+	return slices.Compact(sorted)
+}
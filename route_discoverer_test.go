@@ -1,7 +1,17 @@
 package twingate
 
 import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
 	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/reverseproxy"
+	"go.uber.org/zap"
 )
 
 func TestNormalizePath(t *testing.T) {
@@ -117,3 +127,600 @@ func TestResourceName(t *testing.T) {
 func strPtr(s string) *string {
 	return &s
 }
+
+func TestToResourceMappings(t *testing.T) {
+	ep := Endpoint{Host: "api.example.com"}
+
+	single := ep.ToResourceMappings([]string{"10.0.0.1"})
+	if len(single) != 1 {
+		t.Fatalf("expected 1 mapping, got %d", len(single))
+	}
+	if single[0].Name != "api.example.com" || single[0].Alias == nil || single[0].Address != "10.0.0.1" {
+		t.Errorf("unexpected single-address mapping: %+v", single[0])
+	}
+
+	multi := ep.ToResourceMappings([]string{"10.0.0.1", "10.0.0.2"})
+	if len(multi) != 2 {
+		t.Fatalf("expected 2 mappings, got %d", len(multi))
+	}
+	for i, addr := range []string{"10.0.0.1", "10.0.0.2"} {
+		if multi[i].Name != "api.example.com@"+addr {
+			t.Errorf("mapping %d name = %q, want %q", i, multi[i].Name, "api.example.com@"+addr)
+		}
+		if multi[i].Address != addr {
+			t.Errorf("mapping %d address = %q, want %q", i, multi[i].Address, addr)
+		}
+		if multi[i].Alias != nil {
+			t.Errorf("mapping %d should have no alias, got %q", i, *multi[i].Alias)
+		}
+	}
+}
+
+// siteRoute builds a route shaped like the Caddyfile adapter's output for a
+// site block: a host matcher wrapping a subroute of the site's directives.
+func siteRoute(host string, handlers ...caddyhttp.MiddlewareHandler) caddyhttp.Route {
+	var routes caddyhttp.RouteList
+	for _, h := range handlers {
+		routes = append(routes, caddyhttp.Route{
+			Handlers: []caddyhttp.MiddlewareHandler{h},
+		})
+	}
+
+	matchHost := caddyhttp.MatchHost{host}
+	return caddyhttp.Route{
+		MatcherSets: caddyhttp.MatcherSets{{&matchHost}},
+		Handlers: []caddyhttp.MiddlewareHandler{
+			&caddyhttp.Subroute{Routes: routes},
+		},
+	}
+}
+
+func discoverTestEndpoints(t *testing.T, routes ...caddyhttp.Route) map[string]Endpoint {
+	t.Helper()
+
+	httpApp := &caddyhttp.App{
+		Servers: map[string]*caddyhttp.Server{
+			"srv0": {Routes: routes},
+		},
+	}
+
+	d := &RouteDiscoverer{logger: zap.NewNop()}
+	endpoints, err := d.DiscoverEndpoints(httpApp)
+	if err != nil {
+		t.Fatalf("DiscoverEndpoints() failed: %v", err)
+	}
+
+	byHost := make(map[string]Endpoint)
+	for _, ep := range endpoints {
+		byHost[ep.Host] = ep
+	}
+	return byHost
+}
+
+func TestDiscoverEndpoints_SiteRemoteNetwork(t *testing.T) {
+	endpoints := discoverTestEndpoints(t,
+		siteRoute("api.example.com", &reverseproxy.Handler{}),
+		siteRoute("cam.example.com", &SiteConfig{RemoteNetwork: "IoT"}, &reverseproxy.Handler{}),
+	)
+
+	if len(endpoints) != 2 {
+		t.Fatalf("expected 2 endpoints, got %d", len(endpoints))
+	}
+	if got := endpoints["api.example.com"].RemoteNetwork; got != "" {
+		t.Errorf("api.example.com RemoteNetwork = %q, want default", got)
+	}
+	if got := endpoints["cam.example.com"].RemoteNetwork; got != "IoT" {
+		t.Errorf("cam.example.com RemoteNetwork = %q, want %q", got, "IoT")
+	}
+
+	mapping := endpoints["cam.example.com"]
+	if m := mapping.ToResourceMapping("10.0.0.1"); m.RemoteNetwork != "IoT" {
+		t.Errorf("ToResourceMapping() RemoteNetwork = %q, want %q", m.RemoteNetwork, "IoT")
+	}
+}
+
+func TestToDNSResourceMapping(t *testing.T) {
+	ep := Endpoint{Host: "*.dev.example.com", RemoteNetwork: "Dev"}
+	m := ep.ToDNSResourceMapping()
+
+	if m.Name != "*.dev.example.com" || m.Address != "*.dev.example.com" {
+		t.Errorf("unexpected mapping: %+v", m)
+	}
+	if m.Alias != nil {
+		t.Errorf("DNS host mappings should have no alias, got %q", *m.Alias)
+	}
+	if m.RemoteNetwork != "Dev" {
+		t.Errorf("RemoteNetwork = %q, want Dev", m.RemoteNetwork)
+	}
+}
+
+func TestDiscoverEndpoints_Identity(t *testing.T) {
+	proxy := func(dials ...string) *reverseproxy.Handler {
+		h := &reverseproxy.Handler{}
+		for _, dial := range dials {
+			h.Upstreams = append(h.Upstreams, &reverseproxy.Upstream{Dial: dial})
+		}
+		return h
+	}
+
+	endpoints := discoverTestEndpoints(t,
+		siteRoute("api.example.com", proxy("localhost:9002", "localhost:9001")),
+		siteRoute("app.example.com", &SiteConfig{ID: "storefront"}, proxy("localhost:9003")),
+		siteRoute("static.example.com", proxy()),
+	)
+
+	api := endpoints["api.example.com"]
+	if got, want := api.Identity(), "upstream:localhost:9001,localhost:9002"; got != want {
+		t.Errorf("api.example.com Identity() = %q, want %q", got, want)
+	}
+	app := endpoints["app.example.com"]
+	if got := app.Identity(); got != "id:storefront" {
+		t.Errorf("app.example.com Identity() = %q, want id:storefront", got)
+	}
+	static := endpoints["static.example.com"]
+	if got := static.Identity(); got != "" {
+		t.Errorf("static.example.com Identity() = %q, want none", got)
+	}
+
+	multi := app.ToResourceMappings([]string{"10.0.0.1", "10.0.0.2"})
+	if multi[1].Identity != "id:storefront@10.0.0.2" {
+		t.Errorf("per-address identity = %q, want id:storefront@10.0.0.2", multi[1].Identity)
+	}
+}
+
+func TestDiscoverEndpoints_Order(t *testing.T) {
+	httpApp := &caddyhttp.App{
+		Servers: map[string]*caddyhttp.Server{
+			"srv1": {Routes: caddyhttp.RouteList{
+				siteRoute("shared.example.com", &SiteConfig{RemoteNetwork: "B"}, &reverseproxy.Handler{}),
+				siteRoute("c.example.com", &reverseproxy.Handler{}),
+			}},
+			"srv0": {Routes: caddyhttp.RouteList{
+				siteRoute("shared.example.com", &SiteConfig{RemoteNetwork: "A"}, &reverseproxy.Handler{}),
+				siteRoute("a.example.com", &reverseproxy.Handler{}),
+			}},
+		},
+	}
+
+	d := &RouteDiscoverer{logger: zap.NewNop()}
+	for i := 0; i < 10; i++ {
+		endpoints, err := d.DiscoverEndpoints(httpApp)
+		if err != nil {
+			t.Fatalf("DiscoverEndpoints() failed: %v", err)
+		}
+		var hosts []string
+		for _, ep := range endpoints {
+			hosts = append(hosts, ep.Host)
+		}
+		if want := []string{"a.example.com", "c.example.com", "shared.example.com"}; !slices.Equal(hosts, want) {
+			t.Fatalf("hosts = %v, want %v", hosts, want)
+		}
+		if got := endpoints[2].RemoteNetwork; got != "A" {
+			t.Fatalf("conflicting remote_network should resolve to the first server's, got %q", got)
+		}
+	}
+}
+
+func TestEndpointMappingsWildcardHosts(t *testing.T) {
+	wildcard := Endpoint{Host: "*.lab.example.com"}
+	plain := Endpoint{Host: "api.example.com"}
+	addrs := []string{"10.0.0.1"}
+
+	if m := (&TwingateApp{}).endpointMappings(wildcard, addrs); m[0].Alias != nil || m[0].Address != "10.0.0.1" {
+		t.Errorf("default mapping = %+v, want the Caddy address and no alias", m[0])
+	}
+
+	app := &TwingateApp{WildcardHosts: WildcardAlias}
+	m := app.endpointMappings(wildcard, addrs)
+	if m[0].Alias == nil || *m[0].Alias != "*.lab.example.com" || m[0].Address != "10.0.0.1" {
+		t.Errorf("alias mapping = %+v, want the wildcard as alias", m[0])
+	}
+	if m := app.endpointMappings(wildcard, []string{"10.0.0.1", "10.0.0.2"}); m[0].Alias != nil {
+		t.Errorf("mappings of several addresses should have no alias, got %q", *m[0].Alias)
+	}
+	if m := app.endpointMappings(plain, addrs); *m[0].Alias != "api.example.com" {
+		t.Errorf("plain host alias = %q", *m[0].Alias)
+	}
+
+	app = &TwingateApp{WildcardHosts: WildcardAddress}
+	if m := app.endpointMappings(wildcard, addrs); m[0].Address != "*.lab.example.com" || m[0].Alias != nil {
+		t.Errorf("address mapping = %+v, want the wildcard as address", m[0])
+	}
+	if m := app.endpointMappings(plain, addrs); m[0].Address != "10.0.0.1" {
+		t.Errorf("plain host address = %q, want the Caddy address", m[0].Address)
+	}
+}
+
+func TestDiscoverEndpoints_Labels(t *testing.T) {
+	matchPath := caddyhttp.MatchPath{"/admin/*"}
+	admin := &caddyhttp.Subroute{Routes: caddyhttp.RouteList{{
+		MatcherSets: caddyhttp.MatcherSets{{&matchPath}},
+		Handlers: []caddyhttp.MiddlewareHandler{
+			&caddyhttp.VarsMiddleware{"twingate_label.env": "staging", "twingate_label.port": 8080, "other": "x"},
+			&reverseproxy.Handler{},
+		},
+	}}}
+	raw := &caddyhttp.Subroute{Routes: caddyhttp.RouteList{{
+		HandlersRaw: []json.RawMessage{
+			json.RawMessage(`{"handler":"vars","twingate_label.tier":"gold"}`),
+			json.RawMessage(`{"handler":"reverse_proxy"}`),
+		},
+	}}}
+
+	endpoints := discoverTestEndpoints(t,
+		siteRoute("api.example.com",
+			&SiteConfig{Labels: map[string]string{"team": "platform", "env": "prod"}},
+			&reverseproxy.Handler{},
+			admin,
+		),
+		siteRoute("raw.example.com", raw),
+		siteRoute("plain.example.com", &reverseproxy.Handler{}),
+	)
+
+	// The site's own path comes first, so its env wins over the nested
+	// route's; keys only set on the nested route are still added.
+	want := map[string]string{"team": "platform", "env": "prod", "port": "8080"}
+	if got := endpoints["api.example.com"].Labels; !maps.Equal(got, want) {
+		t.Errorf("api.example.com Labels = %v, want %v", got, want)
+	}
+	if got := endpoints["raw.example.com"].Labels; !maps.Equal(got, map[string]string{"tier": "gold"}) {
+		t.Errorf("raw.example.com Labels = %v, want tier=gold", got)
+	}
+	if got := endpoints["plain.example.com"].Labels; got != nil {
+		t.Errorf("plain.example.com Labels = %v, want none", got)
+	}
+
+	api := endpoints["api.example.com"]
+	if m := api.ToResourceMapping("10.0.0.1"); !maps.Equal(m.Labels, want) {
+		t.Errorf("ToResourceMapping() Labels = %v, want %v", m.Labels, want)
+	}
+	if m := api.ToResourceMappings([]string{"10.0.0.1", "10.0.0.2"}); !maps.Equal(m[1].Labels, want) {
+		t.Errorf("ToResourceMappings() Labels = %v, want %v", m[1].Labels, want)
+	}
+}
+
+func TestDiscoverEndpoints_ErrorRoutes(t *testing.T) {
+	proxy := func(dial string) *reverseproxy.Handler {
+		return &reverseproxy.Handler{Upstreams: reverseproxy.UpstreamPool{{Dial: dial}}}
+	}
+	httpApp := &caddyhttp.App{
+		Servers: map[string]*caddyhttp.Server{
+			"srv0": {
+				Routes: caddyhttp.RouteList{
+					siteRoute("api.example.com", proxy("localhost:9000")),
+				},
+				Errors: &caddyhttp.HTTPErrorConfig{Routes: caddyhttp.RouteList{
+					siteRoute("api.example.com", proxy("localhost:9999")),
+					siteRoute("maintenance.example.com", proxy("localhost:9999")),
+				}},
+			},
+		},
+	}
+
+	hosts := func(d *RouteDiscoverer) map[string]Endpoint {
+		t.Helper()
+		endpoints, err := d.DiscoverEndpoints(httpApp)
+		if err != nil {
+			t.Fatalf("DiscoverEndpoints() failed: %v", err)
+		}
+		byHost := make(map[string]Endpoint)
+		for _, ep := range endpoints {
+			byHost[ep.Host] = ep
+		}
+		return byHost
+	}
+
+	endpoints := hosts(&RouteDiscoverer{logger: zap.NewNop()})
+	if _, ok := endpoints["maintenance.example.com"]; ok || len(endpoints) != 1 {
+		t.Errorf("error routes should be skipped by default, got %v", endpoints)
+	}
+
+	endpoints = hosts(&RouteDiscoverer{logger: zap.NewNop(), errorRoutes: true})
+	if _, ok := endpoints["maintenance.example.com"]; !ok {
+		t.Errorf("expected error-only host to be discovered, got %v", endpoints)
+	}
+	// The error route of a host already found keeps out of its identity
+	if got := endpoints["api.example.com"].Upstreams; !slices.Equal(got, []string{"localhost:9000"}) {
+		t.Errorf("api.example.com Upstreams = %v, want only the regular route's", got)
+	}
+}
+
+func TestDiscoverEndpoints_NotMatcher(t *testing.T) {
+	notHost := func(hosts ...string) caddyhttp.RequestMatcher {
+		matchHost := caddyhttp.MatchHost(hosts)
+		return &caddyhttp.MatchNot{MatcherSets: []caddyhttp.MatcherSet{{&matchHost}}}
+	}
+	matchPath := caddyhttp.MatchPath{"/admin/*"}
+	matchInternal := caddyhttp.MatchHost{"internal.example.com"}
+	notComplex := &caddyhttp.MatchNot{MatcherSets: []caddyhttp.MatcherSet{{&matchInternal, &matchPath}}}
+
+	matchHosts := caddyhttp.MatchHost{"app.example.com", "internal.example.com", "a.corp.example.com", "b.corp.example.com"}
+	route := caddyhttp.Route{
+		MatcherSets: caddyhttp.MatcherSets{{&matchHosts}},
+		Handlers: []caddyhttp.MiddlewareHandler{&caddyhttp.Subroute{Routes: caddyhttp.RouteList{
+			{
+				MatcherSets: caddyhttp.MatcherSets{{notHost("internal.example.com", "*.corp.example.com")}},
+				Handlers:    []caddyhttp.MiddlewareHandler{&reverseproxy.Handler{}},
+			},
+		}}},
+	}
+	endpoints := discoverTestEndpoints(t, route)
+	if len(endpoints) != 1 {
+		t.Fatalf("expected only app.example.com, got %v", endpoints)
+	}
+	if _, ok := endpoints["app.example.com"]; !ok {
+		t.Errorf("expected app.example.com, got %v", endpoints)
+	}
+
+	// A negation that also involves a path still matches requests to the
+	// host, so the host is kept.
+	route.Handlers = []caddyhttp.MiddlewareHandler{&caddyhttp.Subroute{Routes: caddyhttp.RouteList{
+		{
+			MatcherSets: caddyhttp.MatcherSets{{notComplex}},
+			Handlers:    []caddyhttp.MiddlewareHandler{&reverseproxy.Handler{}},
+		},
+	}}}
+	endpoints = discoverTestEndpoints(t, route)
+	if _, ok := endpoints["internal.example.com"]; !ok {
+		t.Errorf("complex negation should not exclude internal.example.com, got %v", endpoints)
+	}
+
+	// Without any host context, a negated localhost leaves nothing
+	endpoints = discoverTestEndpoints(t, caddyhttp.Route{
+		MatcherSets: caddyhttp.MatcherSets{{notHost("localhost")}},
+		Handlers:    []caddyhttp.MiddlewareHandler{&reverseproxy.Handler{}},
+	})
+	if len(endpoints) != 0 {
+		t.Errorf("expected no endpoints, got %v", endpoints)
+	}
+}
+
+func TestDiscoverEndpoints_MatcherSetsUnion(t *testing.T) {
+	matchA := caddyhttp.MatchHost{"a.example.com"}
+	matchB := caddyhttp.MatchHost{"b.example.com"}
+	matchPath := caddyhttp.MatchPath{"/api/*"}
+	endpoints := discoverTestEndpoints(t, caddyhttp.Route{
+		MatcherSets: caddyhttp.MatcherSets{{&matchA}, {&matchB, &matchPath}},
+		Handlers:    []caddyhttp.MiddlewareHandler{&reverseproxy.Handler{}},
+	})
+	if len(endpoints) != 2 {
+		t.Fatalf("expected the hosts of both matcher sets, got %v", endpoints)
+	}
+
+	// A host negated in one set but matched by another is kept; one
+	// negated in every set is not.
+	matchSite := caddyhttp.MatchHost{"x.example.com", "y.example.com"}
+	matchX := caddyhttp.MatchHost{"x.example.com"}
+	notX := &caddyhttp.MatchNot{MatcherSets: []caddyhttp.MatcherSet{{&matchX}}}
+	site := func(sets caddyhttp.MatcherSets) caddyhttp.Route {
+		return caddyhttp.Route{
+			MatcherSets: caddyhttp.MatcherSets{{&matchSite}},
+			Handlers: []caddyhttp.MiddlewareHandler{&caddyhttp.Subroute{Routes: caddyhttp.RouteList{{
+				MatcherSets: sets,
+				Handlers:    []caddyhttp.MiddlewareHandler{&reverseproxy.Handler{}},
+			}}}},
+		}
+	}
+
+	endpoints = discoverTestEndpoints(t, site(caddyhttp.MatcherSets{{notX}, {&matchPath}}))
+	if _, ok := endpoints["x.example.com"]; !ok || len(endpoints) != 2 {
+		t.Errorf("x.example.com is matched by the second set, got %v", endpoints)
+	}
+
+	endpoints = discoverTestEndpoints(t, site(caddyhttp.MatcherSets{{notX}, {notX, &matchPath}}))
+	if _, ok := endpoints["x.example.com"]; ok || len(endpoints) != 1 {
+		t.Errorf("x.example.com is negated by every set, got %v", endpoints)
+	}
+
+	matchY := caddyhttp.MatchHost{"y.example.com"}
+	notXY := &caddyhttp.MatchNot{MatcherSets: []caddyhttp.MatcherSet{{&matchX}, {&matchY}}}
+	endpoints = discoverTestEndpoints(t, site(caddyhttp.MatcherSets{{notXY}, {notXY, &matchPath}}))
+	if len(endpoints) != 0 {
+		t.Errorf("all hosts are negated, expected no endpoints, got %v", endpoints)
+	}
+}
+
+// groupHandler stands in for a handler from another module that nests
+// routes.
+type groupHandler struct {
+	Routes caddyhttp.RouteList `json:"routes,omitempty"`
+}
+
+func (groupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	return next.ServeHTTP(w, r)
+}
+
+func TestDiscoverEndpoints_NestedRoutes(t *testing.T) {
+	upstream := reverseproxy.UpstreamPool{{Dial: "localhost:9000"}}
+	group := &groupHandler{Routes: caddyhttp.RouteList{{
+		Handlers: []caddyhttp.MiddlewareHandler{&reverseproxy.Handler{Upstreams: upstream}},
+	}}}
+	raw := &caddyhttp.Subroute{Routes: caddyhttp.RouteList{{
+		HandlersRaw: []json.RawMessage{json.RawMessage(
+			`{"handler":"custom_group","routes":[{"handle":[{"handler":"reverse_proxy","upstreams":[{"dial":"localhost:9001"}]}]}]}`,
+		)},
+	}}}
+
+	endpoints := discoverTestEndpoints(t,
+		siteRoute("group.example.com", group),
+		siteRoute("raw.example.com", raw),
+	)
+	if got := endpoints["group.example.com"].Upstreams; !slices.Equal(got, []string{"localhost:9000"}) {
+		t.Errorf("group.example.com Upstreams = %v, want the nested proxy's", got)
+	}
+	if got := endpoints["raw.example.com"].Upstreams; !slices.Equal(got, []string{"localhost:9001"}) {
+		t.Errorf("raw.example.com Upstreams = %v, want the nested proxy's", got)
+	}
+}
+
+func TestDiscoverEndpoints_RawParity(t *testing.T) {
+	// The same site as raw JSON, as in an unprovisioned config, and as
+	// handler modules.
+	var raw caddyhttp.App
+	err := json.Unmarshal([]byte(`{"servers": {"srv0": {"routes": [{
+		"match": [{"host": ["app.example.com", "internal.example.com"]}],
+		"handle": [{"handler": "subroute", "routes": [
+			{"handle": [{"handler": "twingate", "remote_network": "Apps"}]},
+			{"handle": [{"handler": "vars", "twingate_label.team": "web"}]},
+			{
+				"match": [{"not": [{"host": ["internal.example.com"]}], "path": ["/api/*"]}],
+				"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "localhost:9000"}]}]
+			}
+		]}]
+	}]}}}`), &raw)
+	if err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+
+	matchHosts := caddyhttp.MatchHost{"app.example.com", "internal.example.com"}
+	matchInternal := caddyhttp.MatchHost{"internal.example.com"}
+	matchPath := caddyhttp.MatchPath{"/api/*"}
+	typed := siteRoute("", &SiteConfig{RemoteNetwork: "Apps"}, &caddyhttp.VarsMiddleware{"twingate_label.team": "web"})
+	typed.MatcherSets = caddyhttp.MatcherSets{{&matchHosts}}
+	subroute := typed.Handlers[0].(*caddyhttp.Subroute)
+	subroute.Routes = append(subroute.Routes, caddyhttp.Route{
+		MatcherSets: caddyhttp.MatcherSets{{
+			&caddyhttp.MatchNot{MatcherSets: []caddyhttp.MatcherSet{{&matchInternal}}},
+			&matchPath,
+		}},
+		Handlers: []caddyhttp.MiddlewareHandler{
+			&reverseproxy.Handler{Upstreams: reverseproxy.UpstreamPool{{Dial: "localhost:9000"}}},
+		},
+	})
+
+	d := &RouteDiscoverer{logger: zap.NewNop()}
+	fromRaw, err := d.DiscoverEndpoints(&raw)
+	if err != nil {
+		t.Fatalf("DiscoverEndpoints() failed: %v", err)
+	}
+	fromTyped := discoverTestEndpoints(t, typed)
+
+	if len(fromRaw) != 1 || len(fromTyped) != 1 {
+		t.Fatalf("expected only app.example.com, got raw %v and typed %v", fromRaw, fromTyped)
+	}
+	want := fromTyped["app.example.com"]
+	if got := fromRaw[0]; got.Host != want.Host || got.RemoteNetwork != "Apps" || want.RemoteNetwork != "Apps" ||
+		!slices.Equal(got.Upstreams, want.Upstreams) || !maps.Equal(got.Labels, want.Labels) {
+		t.Errorf("raw endpoint %+v differs from typed %+v", got, want)
+	}
+}
+
+// discoverCaddyfileEndpoints adapts a Caddyfile and discovers the
+// endpoints of its unprovisioned HTTP app.
+func discoverCaddyfileEndpoints(t *testing.T, input string) map[string]Endpoint {
+	t.Helper()
+
+	adapter := caddyfile.Adapter{ServerType: httpcaddyfile.ServerType{}}
+	adapted, _, err := adapter.Adapt([]byte(input), nil)
+	if err != nil {
+		t.Fatalf("adapt Caddyfile: %v", err)
+	}
+	var config struct {
+		Apps struct {
+			HTTP caddyhttp.App `json:"http"`
+		} `json:"apps"`
+	}
+	if err := json.Unmarshal(adapted, &config); err != nil {
+		t.Fatalf("unmarshal adapted config: %v", err)
+	}
+
+	d := &RouteDiscoverer{logger: zap.NewNop()}
+	endpoints, err := d.DiscoverEndpoints(&config.Apps.HTTP)
+	if err != nil {
+		t.Fatalf("DiscoverEndpoints() failed: %v", err)
+	}
+	byHost := make(map[string]Endpoint)
+	for _, ep := range endpoints {
+		byHost[ep.Host] = ep
+	}
+	return byHost
+}
+
+func TestDiscoverEndpoints_ImportedNamedMatchers(t *testing.T) {
+	// The snippet defines a named matcher, and the twingate settings for
+	// it, in each site that imports it.
+	endpoints := discoverCaddyfileEndpoints(t, `
+(internal) {
+	@{args[0]} host {args[1:]}
+	twingate @{args[0]} {
+		remote_network Internal
+		groups Ops
+	}
+}
+
+*.example.com {
+	import internal dashboards grafana.example.com prometheus.example.com
+	reverse_proxy @dashboards localhost:3000
+	reverse_proxy localhost:8080
+}
+
+*.corp.example.com {
+	import internal wiki wiki.corp.example.com
+	handle @wiki {
+		reverse_proxy localhost:4000
+	}
+	handle {
+		reverse_proxy localhost:8081
+	}
+}
+`)
+
+	want := map[string]struct {
+		remoteNetwork string
+		upstream      string
+	}{
+		"grafana.example.com":    {"Internal", "localhost:3000"},
+		"prometheus.example.com": {"Internal", "localhost:3000"},
+		"wiki.corp.example.com":  {"Internal", "localhost:4000"},
+		"*.example.com":          {"", "localhost:8080"},
+		"*.corp.example.com":     {"", "localhost:8081"},
+	}
+	if len(endpoints) != len(want) {
+		t.Errorf("discovered %d endpoints, want %d: %v", len(endpoints), len(want), slices.Sorted(maps.Keys(endpoints)))
+	}
+	for host, w := range want {
+		ep, ok := endpoints[host]
+		if !ok {
+			t.Errorf("%s was not discovered", host)
+			continue
+		}
+		if ep.RemoteNetwork != w.remoteNetwork || !slices.Equal(ep.Upstreams, []string{w.upstream}) {
+			t.Errorf("%s: remote network %q, upstreams %v; want %q, [%s]", host, ep.RemoteNetwork, ep.Upstreams, w.remoteNetwork, w.upstream)
+		}
+		if wantGroups := w.remoteNetwork != ""; wantGroups != slices.Equal(ep.Groups, []string{"Ops"}) {
+			t.Errorf("%s: groups = %v", host, ep.Groups)
+		}
+	}
+}
+
+func TestDiscoverEndpoints_SharedMatcherProvisioned(t *testing.T) {
+	// Provisioned matchers are compared by config, not identity
+	internal := func() caddyhttp.MatcherSets {
+		hosts := caddyhttp.MatchHost{"grafana.example.com"}
+		public := caddyhttp.MatchHost{"public.example.com"}
+		return caddyhttp.MatcherSets{{&caddyhttp.MatchNot{MatcherSets: []caddyhttp.MatcherSet{{&public}}}, &hosts}}
+	}
+	other := caddyhttp.MatchHost{"other.example.com"}
+
+	endpoints := discoverTestEndpoints(t,
+		caddyhttp.Route{
+			MatcherSets: internal(),
+			Handlers:    []caddyhttp.MiddlewareHandler{&SiteConfig{RemoteNetwork: "Internal"}},
+		},
+		caddyhttp.Route{
+			MatcherSets: internal(),
+			Handlers:    []caddyhttp.MiddlewareHandler{&reverseproxy.Handler{}},
+		},
+		caddyhttp.Route{
+			MatcherSets: caddyhttp.MatcherSets{{&other}},
+			Handlers:    []caddyhttp.MiddlewareHandler{&reverseproxy.Handler{}},
+		},
+	)
+
+	if got := endpoints["grafana.example.com"].RemoteNetwork; got != "Internal" {
+		t.Errorf("grafana.example.com remote network = %q, want Internal", got)
+	}
+	if got := endpoints["other.example.com"].RemoteNetwork; got != "" {
+		t.Errorf("other.example.com remote network = %q, want none", got)
+	}
+}
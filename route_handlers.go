@@ -0,0 +1,207 @@
+package twingate
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// routeHandler is a route's handler as discovery sees it. Routes of a
+// provisioned config hold handler modules and unprovisioned ones raw JSON;
+// both become a routeHandler so they are traversed the same way.
+type routeHandler struct {
+	// name is the handler name, such as "reverse_proxy". It is empty for
+	// handlers that are not Caddy modules.
+	name string
+
+	// routes are the routes nested in the handler, if any.
+	routes caddyhttp.RouteList
+
+	handler caddyhttp.MiddlewareHandler
+	raw     json.RawMessage
+}
+
+// routeHandlers returns the handlers of a route, from its provisioned
+// handlers if it has any and its raw ones otherwise.
+func routeHandlers(route caddyhttp.Route) []routeHandler {
+	var handlers []routeHandler
+	for _, handler := range route.Handlers {
+		h := routeHandler{handler: handler, routes: nestedRoutes(handler)}
+		if module, ok := handler.(caddy.Module); ok {
+			h.name = module.CaddyModule().ID.Name()
+		}
+		handlers = append(handlers, h)
+	}
+	if len(route.Handlers) > 0 {
+		return handlers
+	}
+
+	for _, raw := range route.HandlersRaw {
+		var config struct {
+			Handler string          `json:"handler"`
+			Routes  json.RawMessage `json:"routes"`
+		}
+		if err := json.Unmarshal(raw, &config); err != nil {
+			continue
+		}
+		h := routeHandler{name: config.Handler, raw: raw}
+		if len(config.Routes) > 0 {
+			// A routes field that is not a route list is not one to
+			// descend into.
+			_ = json.Unmarshal(config.Routes, &h.routes)
+		}
+		handlers = append(handlers, h)
+	}
+	return handlers
+}
+
+// decode reads the handler's JSON config into v. A provisioned handler is
+// encoded first, so its fields are read the same way as raw ones.
+func (h routeHandler) decode(v any) error {
+	raw := h.raw
+	if raw == nil {
+		var err error
+		if raw, err = json.Marshal(h.handler); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// kind describes the handler for logs.
+func (h routeHandler) kind() string {
+	if h.handler != nil {
+		return fmt.Sprintf("%T", h.handler)
+	}
+	return h.name
+}
+
+// routeListType is the type of the route lists handlers nest.
+var routeListType = reflect.TypeOf(caddyhttp.RouteList{})
+
+// nestedRoutes returns the routes held by the exported RouteList fields of
+// a handler, such as a subroute, a routing group or a plugin that wraps
+// routes, so the proxies behind it are discovered too.
+func nestedRoutes(handler caddyhttp.MiddlewareHandler) caddyhttp.RouteList {
+	v := reflect.ValueOf(handler)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var routes caddyhttp.RouteList
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.IsExported() && field.Type == routeListType {
+			routes = append(routes, v.Field(i).Interface().(caddyhttp.RouteList)...)
+		}
+	}
+	return routes
+}
+
+// routeMatcherSets returns the matcher sets of a route, decoding the raw
+// ones of an unprovisioned route. Only the matchers discovery evaluates
+// are decoded; the others are kept as unevaluatedMatcher.
+func routeMatcherSets(route caddyhttp.Route) caddyhttp.MatcherSets {
+	if len(route.MatcherSets) > 0 {
+		return route.MatcherSets
+	}
+	return rawMatcherSets(route.MatcherSetsRaw)
+}
+
+// hasMatchers reports whether a route only handles some requests.
+func hasMatchers(route caddyhttp.Route) bool {
+	return len(route.MatcherSets) > 0 || len(route.MatcherSetsRaw) > 0
+}
+
+// matcherSetsKey returns a key that is the same for routes with the same
+// matchers. The Caddyfile adapter copies a named matcher into each route
+// that references it, so the routes sharing one have the same key.
+func matcherSetsKey(route caddyhttp.Route) string {
+	if len(route.MatcherSets) == 0 {
+		// Encoding sorts the matcher names and compacts their configs
+		raw, _ := json.Marshal(route.MatcherSetsRaw)
+		return string(raw)
+	}
+	return provisionedSetsKey(route.MatcherSets)
+}
+
+// provisionedSetsKey keys matcher modules, whose raw JSON is released once
+// they are provisioned. Matchers are loaded from a map, so a set's order is
+// not kept.
+func provisionedSetsKey(sets caddyhttp.MatcherSets) string {
+	keys := make([]string, 0, len(sets))
+	for _, set := range sets {
+		matchers := make([]string, 0, len(set))
+		for _, matcher := range set {
+			if not, ok := matcher.(*caddyhttp.MatchNot); ok {
+				matchers = append(matchers, "not"+provisionedSetsKey(not.MatcherSets))
+				continue
+			}
+			config, err := json.Marshal(matcher)
+			if err != nil {
+				config = fmt.Appendf(nil, "%v", matcher)
+			}
+			matchers = append(matchers, fmt.Sprintf("%T%s", matcher, config))
+		}
+		slices.Sort(matchers)
+		keys = append(keys, "{"+strings.Join(matchers, ",")+"}")
+	}
+	return "[" + strings.Join(keys, ",") + "]"
+}
+
+func rawMatcherSets(sets []caddy.ModuleMap) caddyhttp.MatcherSets {
+	var matcherSets caddyhttp.MatcherSets
+	for _, set := range sets {
+		var matcherSet caddyhttp.MatcherSet
+		for _, name := range slices.Sorted(maps.Keys(set)) {
+			matcherSet = append(matcherSet, rawMatcher(name, set[name]))
+		}
+		matcherSets = append(matcherSets, matcherSet)
+	}
+	return matcherSets
+}
+
+func rawMatcher(name string, raw json.RawMessage) caddyhttp.RequestMatcher {
+	switch name {
+	case "host":
+		var m caddyhttp.MatchHost
+		if err := json.Unmarshal(raw, &m); err == nil {
+			return &m
+		}
+	case "path":
+		var m caddyhttp.MatchPath
+		if err := json.Unmarshal(raw, &m); err == nil {
+			return &m
+		}
+	case "not":
+		var sets []caddy.ModuleMap
+		if err := json.Unmarshal(raw, &sets); err == nil {
+			return &caddyhttp.MatchNot{MatcherSets: rawMatcherSets(sets)}
+		}
+	case "expression":
+		var m caddyhttp.MatchExpression
+		if err := json.Unmarshal(raw, &m); err == nil {
+			return &m
+		}
+	}
+	return unevaluatedMatcher(name)
+}
+
+// unevaluatedMatcher stands in for a raw matcher discovery does not
+// evaluate, so that matcher sets keep their shape.
+type unevaluatedMatcher string
+
+func (unevaluatedMatcher) Match(*http.Request) bool { return false }
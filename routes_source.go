@@ -0,0 +1,221 @@
+package twingate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// defaultRoutesPollInterval is how often the routes source is checked for
+// changes unless configured otherwise.
+const defaultRoutesPollInterval = 10 * time.Second
+
+// sourceFetchTimeout bounds each request to a routes_from admin API.
+const sourceFetchTimeout = 10 * time.Second
+
+// RoutesSource reads the routes to discover from the config of another
+// Caddy instead of this one's HTTP app, so the sync can run out of
+// process, as twingate-syncer does, or on a management node syncing for
+// other Caddy servers. The source is read on every sync and polled for
+// changes, which trigger a sync.
+type RoutesSource struct {
+	// File is a Caddy JSON config whose HTTP app is discovered, such as
+	// the output of `caddy adapt`.
+	File string `json:"file,omitempty"`
+
+	// Admin is the admin API of another Caddy, such as
+	// http://10.0.0.11:2019, whose running config is discovered.
+	Admin string `json:"admin,omitempty"`
+
+	// PollInterval is how often the source is checked for changes.
+	// Defaults to 10s.
+	PollInterval caddy.Duration `json:"poll_interval,omitempty"`
+}
+
+func (s *RoutesSource) pollInterval() time.Duration {
+	if s.PollInterval > 0 {
+		return time.Duration(s.PollInterval)
+	}
+	return defaultRoutesPollInterval
+}
+
+func (s *RoutesSource) validate() error {
+	if (s.File == "") == (s.Admin == "") {
+		return fmt.Errorf("routes_from needs either a file or an admin URL")
+	}
+	if s.Admin != "" {
+		if err := validateAPIEndpoint(s.Admin); err != nil {
+			return fmt.Errorf("routes_from admin: %w", err)
+		}
+	}
+	if s.PollInterval < 0 {
+		return fmt.Errorf("routes_from: poll_interval must not be negative")
+	}
+	return nil
+}
+
+// String describes the source for logs.
+func (s *RoutesSource) String() string {
+	if s.Admin != "" {
+		return redactURL(s.Admin)
+	}
+	return s.File
+}
+
+// read returns the raw config of the source.
+func (s *RoutesSource) read(ctx context.Context) ([]byte, error) {
+	if s.Admin == "" {
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return nil, fmt.Errorf("reading routes_from file: %w", err)
+		}
+		return data, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sourceFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(s.Admin, "/")+"/config/", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := egressHTTPClient(ctx).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading routes_from admin API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading routes_from admin API: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("routes_from admin API returned %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+// adminHost returns the host of the admin URL when it can serve as the
+// Caddy address: an IPv4 address or DNS name that is not a loopback.
+func (s *RoutesSource) adminHost() string {
+	if s == nil || s.Admin == "" {
+		return ""
+	}
+	u, err := url.Parse(s.Admin)
+	if err != nil {
+		return ""
+	}
+	host := u.Hostname()
+	if isLoopbackHost(host) {
+		return ""
+	}
+	if validateCaddyAddress(host) != nil {
+		return ""
+	}
+	return host
+}
+
+// sourceConfig is the part of a Caddy config the routes source reads.
+type sourceConfig struct {
+	Apps struct {
+		HTTP *caddyhttp.App `json:"http"`
+	} `json:"apps"`
+}
+
+// decodeSourceConfig returns the HTTP app of a Caddy JSON config.
+func decodeSourceConfig(data []byte) (*caddyhttp.App, error) {
+	var cfg sourceConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("decoding Caddy config: %w", err)
+	}
+	if cfg.Apps.HTTP == nil {
+		return &caddyhttp.App{}, nil
+	}
+	return cfg.Apps.HTTP, nil
+}
+
+// httpApp returns the HTTP app whose routes are discovered: the one of
+// routes_from if set, otherwise this instance's. The routes of a
+// routes_from config are not provisioned, which discovery handles like a
+// provisioned app.
+func (t *TwingateApp) httpApp(ctx context.Context) (*caddyhttp.App, error) {
+	if t.RoutesFrom != nil {
+		data, err := t.RoutesFrom.read(t.withEgress(ctx))
+		if err != nil {
+			return nil, err
+		}
+		t.routesDigest.Store(sourceDigest(data))
+		return decodeSourceConfig(data)
+	}
+
+	httpAppIface, err := t.ctx.App("http")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HTTP app: %w", err)
+	}
+
+	httpApp, ok := httpAppIface.(*caddyhttp.App)
+	if !ok {
+		return nil, fmt.Errorf("HTTP app is not of expected type")
+	}
+	return httpApp, nil
+}
+
+// sourceDigest returns the digest of a routes_from config.
+func sourceDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// runRoutesWatch polls the routes source until ctx is done, syncing
+// whenever its config differs from the one the last discovery read. A
+// change arriving during a sync runs one more sync afterwards. A source
+// that cannot be read is tried again at the next poll.
+func (t *TwingateApp) runRoutesWatch(ctx context.Context) {
+	src := t.RoutesFrom
+	ticker := time.NewTicker(src.pollInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, err := src.read(t.withEgress(ctx))
+			if err != nil {
+				t.logger.Warn("Failed to poll routes source",
+					zap.Stringer("source", src),
+					zap.Error(err))
+				continue
+			}
+			if sourceDigest(data) != t.routesDigest.Load() {
+				t.routesChanged(ctx, zap.Stringer("source", src))
+			}
+		}
+	}
+}
+
+func (t *TwingateApp) routesChanged(runCtx context.Context, source zap.Field) {
+	t.logger.Info("Routes source changed, syncing", source)
+
+	ctx, cancel := context.WithTimeout(runCtx, 5*time.Minute)
+	defer cancel()
+
+	if err := t.requestSync(ctx, "routes_from"); err != nil {
+		if runCtx.Err() != nil {
+			t.tasks.interrupt("routes_watch")
+		}
+		t.logger.Error("Sync after routes change failed", source, zap.Error(err))
+	}
+}
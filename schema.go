@@ -0,0 +1,102 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// SchemaCapabilities are the optional parts of the Twingate API schema the
+// plugin uses. Tenants get schema changes at different times, so the
+// arguments a tenant's schema lacks are left out of mutations instead of
+// failing them with unknown-argument errors.
+type SchemaCapabilities struct {
+	// Tags is whether resources take tags, which carry route labels.
+	Tags bool `json:"tags"`
+
+	// Protocols is whether resources take protocol and port restrictions,
+	// used for TLS passthrough hosts.
+	Protocols bool `json:"protocols"`
+}
+
+// fullSchema assumes every capability, for schemas that could not be
+// probed.
+var fullSchema = SchemaCapabilities{Tags: true, Protocols: true}
+
+// ProbeSchema finds the capabilities of the API schema by introspecting
+// the arguments of the resource mutations. A capability is only assumed
+// if both resourceCreate and resourceUpdate take its argument.
+func (c *TwingateClient) ProbeSchema(ctx context.Context) (SchemaCapabilities, error) {
+	var query struct {
+		Type *struct {
+			Fields []struct {
+				Name string `graphql:"name"`
+				Args []struct {
+					Name string `graphql:"name"`
+				} `graphql:"args"`
+			} `graphql:"fields"`
+		} `graphql:"__type(name: \"Mutation\")"`
+	}
+	if err := c.query(ctx, &query, nil); err != nil {
+		return fullSchema, fmt.Errorf("schema introspection failed: %w", err)
+	}
+	if query.Type == nil {
+		return fullSchema, fmt.Errorf("schema introspection returned no Mutation type")
+	}
+
+	args := make(map[string][]string)
+	for _, field := range query.Type.Fields {
+		for _, arg := range field.Args {
+			args[field.Name] = append(args[field.Name], arg.Name)
+		}
+	}
+	takes := func(arg string) bool {
+		return slices.Contains(args["resourceCreate"], arg) && slices.Contains(args["resourceUpdate"], arg)
+	}
+	return SchemaCapabilities{
+		Tags:      takes("tags"),
+		Protocols: takes("protocols"),
+	}, nil
+}
+
+// detectSchema probes the schema once per client and keeps the result for
+// its mutations. A schema that cannot be introspected, such as one with
+// introspection turned off, is assumed to have every capability.
+func (c *TwingateClient) detectSchema(ctx context.Context) {
+	if c.schema.Load() != nil {
+		return
+	}
+	caps, err := c.ProbeSchema(ctx)
+	if err != nil {
+		c.log(ctx).Debug("Could not probe the API schema, assuming every capability", zap.Error(err))
+	} else if caps != fullSchema {
+		c.log(ctx).Warn("API schema lacks some capabilities, leaving them out of resource changes",
+			zap.Bool("tags", caps.Tags),
+			zap.Bool("protocols", caps.Protocols))
+	}
+	c.schema.Store(&caps)
+}
+
+// SchemaCapabilities returns the capabilities of the API schema, or every
+// capability if it has not been probed.
+func (c *TwingateClient) SchemaCapabilities() SchemaCapabilities {
+	if caps := c.schema.Load(); caps != nil {
+		return *caps
+	}
+	return fullSchema
+}
+
+// omitUnsupported removes the mutation variables that the schema has no
+// argument for.
+func (c *TwingateClient) omitUnsupported(variables map[string]any) {
+	caps := c.SchemaCapabilities()
+	for arg, supported := range map[string]bool{"tags": caps.Tags, "protocols": caps.Protocols} {
+		if _, ok := variables[arg]; ok && !supported {
+			delete(variables, arg)
+			c.logger.Debug("Leaving out argument the API schema does not take",
+				zap.String("argument", arg))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// mutationType renders the introspected Mutation type with the given
+// arguments for both resource mutations.
+func mutationType(args ...string) map[string]any {
+	var argList []any
+	for _, arg := range args {
+		argList = append(argList, map[string]any{"name": arg})
+	}
+	return map[string]any{"__type": map[string]any{"fields": []any{
+		map[string]any{"name": "resourceCreate", "args": argList},
+		map[string]any{"name": "resourceUpdate", "args": argList},
+	}}}
+}
+
+func TestProbeSchema(t *testing.T) {
+	var query string
+	client := newTestClient(t, func(req graphqlRequest) any {
+		query = req.Query
+		return mutationType("name", "address", "tags")
+	})
+
+	caps, err := client.ProbeSchema(context.Background())
+	if err != nil {
+		t.Fatalf("ProbeSchema() failed: %v", err)
+	}
+	if !strings.Contains(query, `__type(name: "Mutation")`) {
+		t.Errorf("unexpected introspection query: %s", query)
+	}
+	if want := (SchemaCapabilities{Tags: true}); caps != want {
+		t.Errorf("ProbeSchema() = %+v, want %+v", caps, want)
+	}
+
+	// A schema that cannot be introspected keeps every capability
+	client = newTestClient(t, func(graphqlRequest) any {
+		return errors.New("introspection is disabled")
+	})
+	client.detectSchema(context.Background())
+	if caps := client.SchemaCapabilities(); caps != fullSchema {
+		t.Errorf("SchemaCapabilities() = %+v, want every capability", caps)
+	}
+}
+
+func TestCreateResource_OmitsUnsupportedArguments(t *testing.T) {
+	var got graphqlRequest
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if strings.Contains(req.Query, "__type") {
+			return mutationType("name", "address", "remoteNetworkId", "alias", "groupIds", "id", "addedGroupIds")
+		}
+		got = req
+		node := resourceNode("r1", "app.example.com", "10.0.0.1", "net1")["node"]
+		field := "resourceCreate"
+		if strings.Contains(req.Query, "resourceUpdate") {
+			field = "resourceUpdate"
+		}
+		return map[string]any{field: map[string]any{"ok": true, "error": nil, "entity": node}}
+	})
+	client.detectSchema(context.Background())
+
+	tags := map[string]string{"team": "web"}
+	protocols := &ProtocolsInput{TCP: ProtocolInput{Policy: ProtocolAllowAll}, UDP: ProtocolInput{Policy: ProtocolAllowAll}}
+	_, err := client.CreateResource(context.Background(), ResourceCreateInput{
+		Name: "app.example.com", Address: "10.0.0.1", RemoteNetworkID: "net1", Tags: tags, Protocols: protocols,
+	})
+	if err != nil {
+		t.Fatalf("CreateResource() failed: %v", err)
+	}
+	if strings.Contains(got.Query, "tags") || strings.Contains(got.Query, "protocols") {
+		t.Errorf("unsupported arguments should be left out of resourceCreate, got %s", got.Query)
+	}
+	if !strings.Contains(got.Query, "groupIds: $groupIds") {
+		t.Errorf("supported arguments should be kept, got %s", got.Query)
+	}
+
+	_, err = client.UpdateResource(context.Background(), ResourceUpdateInput{ID: "r1", Tags: tags, Protocols: protocols})
+	if err != nil {
+		t.Fatalf("UpdateResource() failed: %v", err)
+	}
+	if !strings.Contains(got.Query, "resourceUpdate(id: $id)") {
+		t.Errorf("unsupported arguments should be left out of resourceUpdate, got %s", got.Query)
+	}
+}
+
+func TestInputHashCoversOnlySentArguments(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		return mutationType("name", "address", "protocols")
+	})
+	client.detectSchema(context.Background())
+
+	syncer := NewResourceSyncer(client, nil)
+	existing := newTestResource("r1", "app.example.com", "10.0.0.1", "net1")
+	mapping := ResourceMapping{Name: "app.example.com", Address: "10.0.0.1", Labels: map[string]string{"team": "web"}}
+
+	// The labels are not sent, so they must not be in the hash: once the
+	// schema takes tags, the hash no longer matches and they are applied
+	update := syncer.planUpdate(&existing, mapping, nil, true)
+	if update.send || update.input.Tags != nil {
+		t.Errorf("update = %+v, want nothing sent for labels the schema cannot take", update)
+	}
+	if want := inputHash(update.next, nil, nil, nil); update.hash != want {
+		t.Errorf("hash = %s, want %s without the labels", update.hash, want)
+	}
+
+	client.schema.Store(&fullSchema)
+	update = syncer.planUpdate(&existing, mapping, nil, true)
+	if !update.send || update.input.Tags == nil {
+		t.Errorf("update = %+v, want the labels sent once the schema takes tags", update)
+	}
+}
@@ -0,0 +1,81 @@
+package twingate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxSuggestions is the number of names a "did you mean" hint lists.
+const maxSuggestions = 3
+
+// UnknownSecurityPolicyError is returned when no security policy has the
+// requested name. Suggestions lists the closest existing names.
+type UnknownSecurityPolicyError struct {
+	Name        string
+	Suggestions []string
+}
+
+func (e *UnknownSecurityPolicyError) Error() string {
+	msg := fmt.Sprintf("no security policy named %q", e.Name)
+	if len(e.Suggestions) > 0 {
+		quoted := make([]string, len(e.Suggestions))
+		for i, s := range e.Suggestions {
+			quoted[i] = strconv.Quote(s)
+		}
+		msg += "; did you mean " + strings.Join(quoted, " or ") + "?"
+	}
+	return msg
+}
+
+// closestNames returns up to maxSuggestions candidates that name is likely a
+// misspelling of, closest first. Case is ignored, and a candidate qualifies
+// if it is within a third of its length in edits or contains name.
+func closestNames(name string, candidates []string) []string {
+	type match struct {
+		name     string
+		distance int
+	}
+
+	lower := strings.ToLower(name)
+	var matches []match
+	for _, candidate := range candidates {
+		c := strings.ToLower(candidate)
+		d := editDistance(lower, c)
+		if d <= max(2, len(c)/3) || (lower != "" && strings.Contains(c, lower)) {
+			matches = append(matches, match{candidate, d})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+	var names []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		names = append(names, matches[i].name)
+	}
+	return names
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,70 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGetSecurityPolicyByName(t *testing.T) {
+	client := newTestClient(t, func(req graphqlRequest) any {
+		if req.Variables["after"] == nil {
+			return map[string]any{"securityPolicies": map[string]any{
+				"pageInfo": map[string]any{"hasNextPage": true, "endCursor": "c1"},
+				"edges": []any{
+					map[string]any{"node": map[string]any{"id": "p1", "name": "Default Policy", "policyType": "DEFAULT_RESOURCE"}},
+					map[string]any{"node": map[string]any{"id": "p2", "name": "Engineering", "policyType": "RESOURCE"}},
+				},
+			}}
+		}
+		return map[string]any{"securityPolicies": map[string]any{
+			"pageInfo": map[string]any{"hasNextPage": false},
+			"edges": []any{
+				map[string]any{"node": map[string]any{"id": "p3", "name": "Engineering MFA", "policyType": "RESOURCE"}},
+			},
+		}}
+	})
+	ctx := context.Background()
+
+	policies, err := client.GetSecurityPolicies(ctx)
+	if err != nil || len(policies) != 3 || policies[0].PolicyType != "DEFAULT_RESOURCE" {
+		t.Fatalf("GetSecurityPolicies() = %+v, %v", policies, err)
+	}
+
+	policy, err := client.GetSecurityPolicyByName(ctx, "Engineering MFA")
+	if err != nil || policy.ID != "p3" {
+		t.Fatalf("GetSecurityPolicyByName() = %+v, %v", policy, err)
+	}
+
+	_, err = client.GetSecurityPolicyByName(ctx, "Enginering")
+	var unknown *UnknownSecurityPolicyError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("expected an unknown policy error, got %v", err)
+	}
+	if !slices.Equal(unknown.Suggestions, []string{"Engineering", "Engineering MFA"}) {
+		t.Errorf("Suggestions = %v", unknown.Suggestions)
+	}
+	if !strings.Contains(err.Error(), `did you mean "Engineering" or "Engineering MFA"?`) {
+		t.Errorf("unexpected message: %v", err)
+	}
+}
+
+func TestClosestNames(t *testing.T) {
+	candidates := []string{"Default Policy", "Engineering", "Contractors", "Finance"}
+	for _, tt := range []struct {
+		name string
+		want []string
+	}{
+		{"default policy", []string{"Default Policy"}},
+		{"Contractor", []string{"Contractors"}},
+		{"Fnance", []string{"Finance"}},
+		{"Default", []string{"Default Policy"}},
+		{"Marketing", nil},
+	} {
+		if got := closestNames(tt.name, candidates); !slices.Equal(got, tt.want) {
+			t.Errorf("closestNames(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
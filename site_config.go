@@ -0,0 +1,214 @@
+package twingate
+
+import (
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(SiteConfig{})
+	httpcaddyfile.RegisterHandlerDirective("twingate", parseSiteConfig)
+	httpcaddyfile.RegisterDirectiveOrder("twingate", httpcaddyfile.Before, "map")
+	httpcaddyfile.RegisterHandlerDirective("twingate_label", parseLabel)
+	httpcaddyfile.RegisterDirectiveOrder("twingate_label", httpcaddyfile.Before, "map")
+}
+
+// labelVarPrefix marks the route variables, set with the vars handler,
+// that are read as labels. The rest of the name is the label key.
+const labelVarPrefix = "twingate_label."
+
+// SiteConfig carries per-site Twingate settings. It does nothing at request
+// time; RouteDiscoverer reads it from the route tree and applies it to the
+// endpoints discovered alongside it.
+type SiteConfig struct {
+	RemoteNetwork string `json:"remote_network,omitempty"`
+
+	// ID labels the site's resources so they keep their identity, and
+	// their access grants, when the site's host is renamed. Without it
+	// the site is identified by its reverse_proxy upstreams.
+	ID string `json:"id,omitempty"`
+
+	// Groups names the groups granted access to the site's resources.
+	Groups []string `json:"groups,omitempty"`
+
+	// Profile names a profile defined in the global twingate options
+	// whose settings apply where the site sets none.
+	Profile string `json:"profile,omitempty"`
+
+	// Labels are key-value labels carried into the mappings of the site's
+	// resources and set on them as tags. Labels of nested routes add to
+	// and override those of the enclosing ones.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// TTL deletes the site's resources that long after they were
+	// created, even while the site remains, for preview environments.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+}
+
+func (SiteConfig) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.twingate",
+		New: func() caddy.Module { return new(SiteConfig) },
+	}
+}
+
+func (s SiteConfig) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	return next.ServeHTTP(w, r)
+}
+
+// apply overlays the site settings onto a route context.
+func (s SiteConfig) apply(ctx RouteContext) RouteContext {
+	if s.RemoteNetwork != "" {
+		ctx.RemoteNetwork = s.RemoteNetwork
+	}
+	if s.ID != "" {
+		ctx.ID = s.ID
+	}
+	if len(s.Groups) > 0 {
+		ctx.Groups = s.Groups
+	}
+	if s.Profile != "" {
+		ctx.Profile = s.Profile
+	}
+	if len(s.Labels) > 0 {
+		labels := maps.Clone(ctx.Labels)
+		if labels == nil {
+			labels = make(map[string]string, len(s.Labels))
+		}
+		maps.Copy(labels, s.Labels)
+		ctx.Labels = labels
+	}
+	if s.TTL > 0 {
+		ctx.TTL = time.Duration(s.TTL)
+	}
+	return ctx
+}
+
+// UnmarshalCaddyfile parses the site-level twingate directive:
+//
+//	twingate {
+//	    remote_network <name>
+//	    id <label>
+//	    groups <name>...
+//	    profile <name>
+//	    label <key> <value>
+//	    ttl <duration>
+//	}
+func (s *SiteConfig) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "remote_network":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				s.RemoteNetwork = d.Val()
+
+			case "id":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				s.ID = d.Val()
+
+			case "groups":
+				groups := d.RemainingArgs()
+				if len(groups) == 0 {
+					return d.ArgErr()
+				}
+				s.Groups = append(s.Groups, groups...)
+
+			case "profile":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				s.Profile = d.Val()
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "label":
+				key, value, err := parseLabelArgs(d)
+				if err != nil {
+					return err
+				}
+				s.setLabel(key, value)
+
+			case "ttl":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				ttl, err := caddy.ParseDuration(d.Val())
+				if err != nil || ttl <= 0 {
+					return d.Errf("ttl must be a positive duration, got: %s", d.Val())
+				}
+				s.TTL = caddy.Duration(ttl)
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			default:
+				return d.Errf("unrecognized twingate site directive: %s", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+// setLabel sets a label, allocating the map on first use.
+func (s *SiteConfig) setLabel(key, value string) {
+	if s.Labels == nil {
+		s.Labels = make(map[string]string)
+	}
+	s.Labels[key] = value
+}
+
+// parseLabelArgs reads the key and value arguments of a label.
+func parseLabelArgs(d *caddyfile.Dispenser) (string, string, error) {
+	args := d.RemainingArgs()
+	if len(args) != 2 {
+		return "", "", d.ArgErr()
+	}
+	if args[0] == "" {
+		return "", "", d.Err("label key must not be empty")
+	}
+	return args[0], args[1], nil
+}
+
+// parseLabel parses the twingate_label directive, shorthand for a twingate
+// block holding a single label:
+//
+//	twingate_label <key> <value>
+func parseLabel(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	s := new(SiteConfig)
+	for h.Next() {
+		key, value, err := parseLabelArgs(h.Dispenser)
+		if err != nil {
+			return nil, err
+		}
+		s.setLabel(key, value)
+	}
+	return s, nil
+}
+
+func parseSiteConfig(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	s := new(SiteConfig)
+	if err := s.UnmarshalCaddyfile(h.Dispenser); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+var (
+	_ caddy.Module                = (*SiteConfig)(nil)
+	_ caddyhttp.MiddlewareHandler = (*SiteConfig)(nil)
+	_ caddyfile.Unmarshaler       = (*SiteConfig)(nil)
+)
@@ -0,0 +1,380 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+)
+
+// ManagedResource records a Twingate resource the plugin has taken
+// ownership of.
+type ManagedResource struct {
+	Name    string    `json:"name"`
+	Since   time.Time `json:"since"`
+	Adopted bool      `json:"adopted,omitempty"`
+
+	// Applied holds the attribute values the plugin last set, against
+	// which drift is detected.
+	Applied *AppliedFields `json:"applied,omitempty"`
+
+	// GroupIDs are the groups the plugin granted access to the resource,
+	// restored along with it if it is deleted and then undone.
+	GroupIDs []string `json:"group_ids,omitempty"`
+
+	// Access is the access to the resource captured before the plugin
+	// last updated it.
+	Access *AccessSnapshot `json:"access,omitempty"`
+
+	// InputHash is the hash of the attribute values and groups last
+	// applied to the resource, used to skip updates that would change
+	// nothing.
+	InputHash string `json:"input_hash,omitempty"`
+
+	// ExpiresAt is when the resource is deleted, for a site with a ttl.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// syncState is the state persisted between syncs and config reloads.
+type syncState struct {
+	// Managed is keyed by Twingate resource ID.
+	Managed map[string]ManagedResource `json:"managed"`
+
+	// Observed records when each host feed host was last served.
+	Observed map[string]time.Time `json:"observed,omitempty"`
+
+	// Identities maps mapping identities to the IDs of the resources
+	// they last synced to.
+	Identities map[string]string `json:"identities,omitempty"`
+
+	// IDs maps mapping names to the IDs of the resources they last synced
+	// to.
+	IDs map[string]string `json:"ids,omitempty"`
+
+	// Deleted journals the resources the plugin deleted, oldest first, so
+	// they can be recreated.
+	Deleted []DeletedResource `json:"deleted,omitempty"`
+
+	// Churn records when each resource was created or deleted within the
+	// churn window, by name, to detect flapping resources.
+	Churn map[string][]time.Time `json:"churn,omitempty"`
+
+	// Expired records when the resource of each site with a ttl expired,
+	// by mapping name, so syncs do not recreate it while the site stays.
+	Expired map[string]time.Time `json:"expired,omitempty"`
+
+	// Networks are the remote networks resources were synced to, so a
+	// cleanup still reaches a network after its last site is removed.
+	Networks []string `json:"networks,omitempty"`
+
+	// Pending is the work left unfinished by the last stop.
+	Pending *PendingWork `json:"pending,omitempty"`
+}
+
+// stateStore persists syncState in Caddy's configured storage, so it is
+// shared by every instance using the same storage backend.
+type stateStore struct {
+	storage certmagic.Storage
+	key     string
+}
+
+func newStateStore(storage certmagic.Storage, tenant string) *stateStore {
+	return &stateStore{
+		storage: storage,
+		key:     path.Join("twingate", tenant, "state.json"),
+	}
+}
+
+// load returns the stored state, or an empty state if none has been saved.
+func (s *stateStore) load(ctx context.Context) (*syncState, error) {
+	state := &syncState{Managed: make(map[string]ManagedResource)}
+
+	data, err := s.storage.Load(ctx, s.key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Managed == nil {
+		state.Managed = make(map[string]ManagedResource)
+	}
+	return state, nil
+}
+
+// lock takes the storage lock on the state, for updates that instances
+// sharing the storage must not interleave, and returns the func releasing
+// it.
+func (s *stateStore) lock(ctx context.Context) (func(), error) {
+	if err := s.storage.Lock(ctx, s.key); err != nil {
+		return nil, err
+	}
+	return func() {
+		// Unlock must run even when ctx is done
+		s.storage.Unlock(context.WithoutCancel(ctx), s.key)
+	}, nil
+}
+
+func (s *stateStore) save(ctx context.Context, state *syncState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.storage.Store(ctx, s.key, data)
+}
+
+// loadSyncState seeds syncer with the stored state: the managed resource
+// IDs, the attribute values last applied to them and the resources mapping
+// identities resolved to. If the state cannot be read, adoption reporting,
+// drift detection and rename tracking are disabled for this sync rather
+// than failing it.
+func (t *TwingateApp) loadSyncState(ctx context.Context, syncer *ResourceSyncer) {
+	if t.state == nil {
+		return
+	}
+
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+
+	syncer.managed = make(map[string]bool, len(state.Managed))
+	syncer.applied = make(map[string]AppliedFields)
+	syncer.hashes = make(map[string]string)
+	for id, managed := range state.Managed {
+		syncer.managed[id] = true
+		if managed.Applied != nil {
+			syncer.applied[id] = *managed.Applied
+		}
+		if managed.InputHash != "" {
+			syncer.hashes[id] = managed.InputHash
+		}
+	}
+	syncer.identities = state.Identities
+	syncer.ids = state.IDs
+	if t.RestoreAccess == nil || !t.RestoreAccess.Disabled {
+		syncer.returning = returningResources(state.Deleted, t.RestoreAccess.window(), time.Now())
+	}
+	if t.ChurnLimit.enabled() {
+		syncer.held = flapping(state.Churn, t.ChurnLimit.changes(), t.ChurnLimit.window(), time.Now())
+	}
+}
+
+// recordManaged adds the resources synced by syncer to the stored state,
+// along with the attribute values applied to them and the identities they
+// resolved to, and reports the resources adopted and created by the sync.
+func (t *TwingateApp) recordManaged(ctx context.Context, syncer *ResourceSyncer) {
+	var adopted, created []string
+	for name, action := range syncer.Actions() {
+		switch action {
+		case ActionAdopted:
+			adopted = append(adopted, name)
+		case ActionCreated:
+			created = append(created, name)
+		}
+	}
+	sort.Strings(adopted)
+	sort.Strings(created)
+
+	if t.Adopt && (len(adopted) > 0 || len(created) > 0) {
+		t.log(ctx).Info("Adoption report",
+			zap.Strings("adopted", adopted),
+			zap.Strings("created", created))
+		t.emit(ctx, "twingate_resources_adopted", map[string]any{
+			"adopted": adopted,
+			"created": created,
+		})
+	}
+
+	if t.state == nil {
+		return
+	}
+
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+
+	changed := false
+	if t.feed != nil {
+		state.Observed = t.feed.snapshot()
+		changed = true
+	}
+
+	now := time.Now()
+	for name, resource := range syncer.SyncedResources() {
+		if _, ok := state.Managed[resource.ID]; ok {
+			continue
+		}
+		state.Managed[resource.ID] = ManagedResource{
+			Name:    name,
+			Since:   now,
+			Adopted: syncer.Actions()[name] == ActionAdopted,
+		}
+		changed = true
+	}
+
+	for id, fields := range syncer.Applied() {
+		managed, ok := state.Managed[id]
+		if !ok || (managed.Applied != nil && *managed.Applied == fields) {
+			continue
+		}
+		managed.Applied = &fields
+		state.Managed[id] = managed
+		changed = true
+	}
+
+	for id, hash := range syncer.Hashes() {
+		managed, ok := state.Managed[id]
+		if !ok || managed.InputHash == hash {
+			continue
+		}
+		managed.InputHash = hash
+		state.Managed[id] = managed
+		changed = true
+	}
+
+	for id, groupIDs := range syncer.Granted() {
+		managed, ok := state.Managed[id]
+		if !ok {
+			continue
+		}
+		merged := uniqueSorted(slices.Concat(managed.GroupIDs, groupIDs))
+		if slices.Equal(merged, managed.GroupIDs) {
+			continue
+		}
+		managed.GroupIDs = merged
+		state.Managed[id] = managed
+		changed = true
+	}
+
+	for id, snapshot := range syncer.Snapshots() {
+		managed, ok := state.Managed[id]
+		if !ok {
+			continue
+		}
+		managed.Access = &snapshot
+		state.Managed[id] = managed
+		changed = true
+	}
+
+	if len(syncer.Restored()) > 0 {
+		state.Deleted = slices.DeleteFunc(state.Deleted, func(d DeletedResource) bool {
+			return syncer.Restored()[d.Name] == d.ID
+		})
+		changed = true
+	}
+
+	if recordIdentities(state, syncer) {
+		changed = true
+	}
+	if recordIDs(state, syncer) {
+		changed = true
+	}
+	for _, name := range syncer.SyncedNetworks() {
+		if !slices.Contains(state.Networks, name) {
+			state.Networks = append(state.Networks, name)
+			changed = true
+		}
+	}
+	slices.Sort(state.Networks)
+
+	if !changed {
+		return
+	}
+	if err := t.state.save(ctx, state); err != nil {
+		t.log(ctx).Warn("Failed to save Twingate sync state", zap.Error(err))
+	}
+}
+
+// recordIdentities stores the identities resolved by syncer and forgets
+// those of the resources it deleted. It reports whether state changed.
+func recordIdentities(state *syncState, syncer *ResourceSyncer) bool {
+	changed := false
+	for identity, id := range syncer.Identities() {
+		if state.Identities == nil {
+			state.Identities = make(map[string]string)
+		}
+		if state.Identities[identity] != id {
+			state.Identities[identity] = id
+			changed = true
+		}
+	}
+
+	deleted := make(map[string]bool)
+	for _, deletion := range syncer.Deletions() {
+		if !deletion.DryRun && deletion.Err == nil {
+			deleted[deletion.Resource.ID] = true
+		}
+	}
+	for identity, id := range state.Identities {
+		if deleted[id] {
+			delete(state.Identities, identity)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// recordIDs stores the ID of the resource each mapping synced to. Names
+// whose resource was deleted, or now belongs to another name, are
+// forgotten. It reports whether state changed.
+func recordIDs(state *syncState, syncer *ResourceSyncer) bool {
+	changed := false
+	claimed := make(map[string]bool)
+	for name, resource := range syncer.SyncedResources() {
+		claimed[resource.ID] = true
+		if state.IDs == nil {
+			state.IDs = make(map[string]string)
+		}
+		if state.IDs[name] != resource.ID {
+			state.IDs[name] = resource.ID
+			changed = true
+		}
+	}
+
+	deleted := make(map[string]bool)
+	for _, deletion := range syncer.Deletions() {
+		if !deletion.DryRun && deletion.Err == nil {
+			deleted[deletion.Resource.ID] = true
+		}
+	}
+	for name, id := range state.IDs {
+		if _, synced := syncer.SyncedResources()[name]; synced {
+			continue
+		}
+		if deleted[id] || claimed[id] {
+			delete(state.IDs, name)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// restoreObservedHosts seeds the host feed from the stored state, so hosts
+// observed before a restart are still reaped when they expire.
+func (t *TwingateApp) restoreObservedHosts(ctx context.Context) {
+	if t.state == nil || t.feed == nil {
+		return
+	}
+
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.logger.Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+	t.feed.restore(state.Observed)
+}
@@ -0,0 +1,169 @@
+package twingate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+)
+
+func TestStateStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := newStateStore(&certmagic.FileStorage{Path: t.TempDir()}, "acme")
+
+	state, err := store.load(ctx)
+	if err != nil {
+		t.Fatalf("load() of missing state failed: %v", err)
+	}
+	if len(state.Managed) != 0 {
+		t.Fatalf("expected empty state, got %+v", state)
+	}
+
+	state.Managed["r1"] = ManagedResource{Name: "api.example.com", Adopted: true}
+	if err := store.save(ctx, state); err != nil {
+		t.Fatalf("save() failed: %v", err)
+	}
+
+	loaded, err := store.load(ctx)
+	if err != nil {
+		t.Fatalf("load() failed: %v", err)
+	}
+	if got := loaded.Managed["r1"]; got.Name != "api.example.com" || !got.Adopted {
+		t.Errorf("unexpected managed entry: %+v", got)
+	}
+}
+
+func TestRecordManaged(t *testing.T) {
+	ctx := context.Background()
+	app := &TwingateApp{
+		Adopt:  true,
+		logger: zap.NewNop(),
+		state:  newStateStore(&certmagic.FileStorage{Path: t.TempDir()}, "acme"),
+	}
+
+	syncer := &ResourceSyncer{
+		synced: map[string]Resource{
+			"api.example.com": newTestResource("r1", "api.example.com", "10.0.0.1", "net1"),
+			"web.example.com": newTestResource("r2", "web.example.com", "10.0.0.1", "net1"),
+		},
+		actions: map[string]string{
+			"api.example.com": ActionAdopted,
+			"web.example.com": ActionCreated,
+		},
+	}
+	app.recordManaged(ctx, syncer)
+
+	loaded := &ResourceSyncer{}
+	app.loadSyncState(ctx, loaded)
+	if !loaded.managed["r1"] || !loaded.managed["r2"] {
+		t.Errorf("expected r1 and r2 to be managed, got %v", loaded.managed)
+	}
+
+	state, _ := app.state.load(ctx)
+	if !state.Managed["r1"].Adopted || state.Managed["r2"].Adopted {
+		t.Errorf("only r1 should be recorded as adopted: %+v", state.Managed)
+	}
+}
+
+func TestRecordManagedIdentities(t *testing.T) {
+	ctx := context.Background()
+	app := &TwingateApp{
+		logger: zap.NewNop(),
+		state:  newStateStore(&certmagic.FileStorage{Path: t.TempDir()}, "acme"),
+	}
+
+	app.recordManaged(ctx, &ResourceSyncer{
+		identified: map[string]string{"id:shop": "r1", "id:blog": "r2"},
+	})
+	loaded := &ResourceSyncer{}
+	app.loadSyncState(ctx, loaded)
+	if got := loaded.identities; got["id:shop"] != "r1" || got["id:blog"] != "r2" {
+		t.Fatalf("identities = %v, want shop and blog", got)
+	}
+
+	// A deleted resource's identity is forgotten; a dry run keeps it.
+	app.recordManaged(ctx, &ResourceSyncer{
+		deletions: []Deletion{
+			{Resource: newTestResource("r1", "shop.example.com", "10.0.0.1", "net1")},
+			{Resource: newTestResource("r2", "blog.example.com", "10.0.0.1", "net1"), DryRun: true},
+		},
+	})
+	loaded = &ResourceSyncer{}
+	app.loadSyncState(ctx, loaded)
+	if _, ok := loaded.identities["id:shop"]; ok || loaded.identities["id:blog"] != "r2" {
+		t.Errorf("identities = %v, want only blog", loaded.identities)
+	}
+}
+
+func TestRecordManagedIDs(t *testing.T) {
+	ctx := context.Background()
+	app := &TwingateApp{
+		logger: zap.NewNop(),
+		state:  newStateStore(&certmagic.FileStorage{Path: t.TempDir()}, "acme"),
+	}
+
+	app.recordManaged(ctx, &ResourceSyncer{
+		synced: map[string]Resource{
+			"shop.example.com": newTestResource("r1", "shop.example.com", "10.0.0.1", "net1"),
+			"blog.example.com": newTestResource("r2", "blog.example.com", "10.0.0.1", "net1"),
+		},
+	})
+	loaded := &ResourceSyncer{}
+	app.loadSyncState(ctx, loaded)
+	if got := loaded.ids; got["shop.example.com"] != "r1" || got["blog.example.com"] != "r2" {
+		t.Fatalf("ids = %v, want shop and blog", got)
+	}
+
+	// r1 now serves another name and r2 was deleted
+	app.recordManaged(ctx, &ResourceSyncer{
+		synced: map[string]Resource{
+			"store.example.com": newTestResource("r1", "store.example.com", "10.0.0.1", "net1"),
+		},
+		deletions: []Deletion{
+			{Resource: newTestResource("r2", "blog.example.com", "10.0.0.1", "net1")},
+		},
+	})
+	loaded = &ResourceSyncer{}
+	app.loadSyncState(ctx, loaded)
+	if got := loaded.ids; len(got) != 1 || got["store.example.com"] != "r1" {
+		t.Errorf("ids = %v, want only store", got)
+	}
+}
+
+func TestRecordManagedApplied(t *testing.T) {
+	ctx := context.Background()
+	app := &TwingateApp{
+		logger: zap.NewNop(),
+		state:  newStateStore(&certmagic.FileStorage{Path: t.TempDir()}, "acme"),
+	}
+
+	applied := AppliedFields{Name: "api.example.com", Address: "10.0.0.1", Alias: "api.example.com"}
+	app.recordManaged(ctx, &ResourceSyncer{
+		synced:  map[string]Resource{"api.example.com": newTestResource("r1", "api.example.com", "10.0.0.1", "net1")},
+		written: map[string]AppliedFields{"r1": applied},
+	})
+
+	loaded := &ResourceSyncer{}
+	app.loadSyncState(ctx, loaded)
+	if got := loaded.applied["r1"]; got != applied {
+		t.Errorf("applied[r1] = %+v, want %+v", got, applied)
+	}
+}
+
+func TestRecordManagedGroups(t *testing.T) {
+	ctx := context.Background()
+	app := &TwingateApp{
+		logger: zap.NewNop(),
+		state:  newStateStore(&certmagic.FileStorage{Path: t.TempDir()}, "acme"),
+	}
+
+	synced := map[string]Resource{"api.example.com": newTestResource("r1", "api.example.com", "10.0.0.1", "net1")}
+	app.recordManaged(ctx, &ResourceSyncer{synced: synced, granted: map[string][]string{"r1": {"g2"}}})
+	app.recordManaged(ctx, &ResourceSyncer{synced: synced, granted: map[string][]string{"r1": {"g1", "g2"}}})
+
+	state, _ := app.state.load(ctx)
+	if got := state.Managed["r1"].GroupIDs; len(got) != 2 || got[0] != "g1" || got[1] != "g2" {
+		t.Errorf("GroupIDs = %v, want [g1 g2]", got)
+	}
+}
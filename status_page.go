@@ -0,0 +1,171 @@
+package twingate
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(StatusPageHandler{})
+	httpcaddyfile.RegisterHandlerDirective("twingate_status", parseStatusPageHandler)
+	httpcaddyfile.RegisterDirectiveOrder("twingate_status", httpcaddyfile.Before, "respond")
+}
+
+// StatusPageHandler responds with an HTML page showing the sync health of
+// the running Twingate app: the managed resources, the last sync and its
+// error, drift and resources awaiting retry. It is a terminal handler;
+// protect it with Caddy's own authentication, such as basic_auth.
+type StatusPageHandler struct{}
+
+func (StatusPageHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.twingate_status",
+		New: func() caddy.Module { return new(StatusPageHandler) },
+	}
+}
+
+func (StatusPageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		return caddyhttp.Error(http.StatusMethodNotAllowed, nil)
+	}
+
+	page := statusPage{Generated: time.Now()}
+	code := http.StatusOK
+	if app := currentApp(); app != nil {
+		page.Status = app.status()
+	} else {
+		code = http.StatusServiceUnavailable
+	}
+
+	var buf bytes.Buffer
+	if err := statusPageTemplate.Execute(&buf, page); err != nil {
+		return caddyhttp.Error(http.StatusInternalServerError, err)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if r.Method == http.MethodGet {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	return nil
+}
+
+type statusPage struct {
+	Status    *Status
+	Generated time.Time
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"since": func(t time.Time) string {
+		return time.Since(t).Round(time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Twingate sync status</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; }
+.ok { color: #176f2c; } .bad { color: #b00020; } .muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>Twingate sync status</h1>
+{{- if not .Status}}
+<p class="bad">The Twingate app is not running.</p>
+{{- else}}
+{{- template "tenant" .Status}}
+{{- range .Status.Tenants}}{{template "tenant" .}}{{end}}
+{{- end}}
+<p class="muted">Generated {{.Generated.UTC.Format "2006-01-02 15:04:05 MST"}}</p>
+</body>
+</html>
+{{- define "tenant"}}
+{{- if .Tenant}}
+<h2>{{if .Label}}{{.Label}}: {{end}}{{.Tenant}}</h2>
+<p>
+{{- if .LastSync}}Last successful sync {{since .LastSync}} ago.{{else}}<span class="muted">No successful sync yet.</span>{{end}}
+{{- if .LastSyncError}} <span class="bad">Last sync failed: {{.LastSyncError}}</span>{{else if .LastSync}} <span class="ok">Healthy.</span>{{end}}
+</p>
+<h3>Resources ({{.ResourceCount}})</h3>
+{{- if .Resources}}
+<table>
+<tr><th>Name</th><th>Address</th><th>Host</th><th>ID</th></tr>
+{{- range .Resources}}
+<tr><td>{{.Name}}</td><td>{{.Address}}</td><td>{{.Host}}</td><td class="muted">{{.ID}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="muted">None.</p>
+{{- end}}
+{{- if .Failing}}
+<h3 class="bad">Failing ({{len .Failing}})</h3>
+<table>
+<tr><th>Name</th><th>Attempts</th><th>Last error</th><th>Next retry</th></tr>
+{{- range .Failing}}
+<tr><td>{{.Name}}</td><td>{{.Attempts}}</td><td>{{.LastError}}</td><td>{{if .GaveUp}}gave up{{else}}{{.NextRetry.UTC.Format "15:04:05 MST"}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .AddressProblems}}
+<h3 class="bad">Unreachable addresses ({{len .AddressProblems}})</h3>
+<table>
+<tr><th>Resource</th><th>Address</th><th>Ports</th><th>Error</th></tr>
+{{- range .AddressProblems}}
+<tr><td>{{.Name}}</td><td>{{.Address}}</td><td>{{.Ports}}</td><td>{{.Error}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Drifts}}
+<h3>Drift ({{len .Drifts}})</h3>
+<table>
+<tr><th>Resource</th><th>Field</th><th>Applied</th><th>Actual</th><th>Policy</th></tr>
+{{- range .Drifts}}
+<tr><td>{{.Name}}</td><td>{{.Field}}</td><td>{{.Applied}}</td><td>{{.Actual}}</td><td>{{.Policy}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+{{- end}}
+`))
+
+// UnmarshalCaddyfile parses the twingate_status directive, which takes no
+// arguments.
+func (StatusPageHandler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		if d.NextBlock(0) {
+			return d.Errf("twingate_status does not take a block")
+		}
+	}
+	return nil
+}
+
+func parseStatusPageHandler(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(StatusPageHandler)
+	if err := handler.UnmarshalCaddyfile(h.Dispenser); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+var (
+	_ caddy.Module                = (*StatusPageHandler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*StatusPageHandler)(nil)
+	_ caddyfile.Unmarshaler       = (*StatusPageHandler)(nil)
+)
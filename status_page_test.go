@@ -0,0 +1,73 @@
+package twingate
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusPageHandler(t *testing.T) {
+	app := &TwingateApp{
+		Tenant:      "acme",
+		lastSync:    time.Now().Add(-time.Minute),
+		lastSyncErr: errors.New("rate limited <retry later>"),
+		lastDrifts: []Drift{
+			{ResourceID: "r1", Name: "api.example.com", Field: FieldAlias, Applied: "api.internal", Actual: "console.internal", Policy: DriftWarn},
+		},
+		resources: map[string]Resource{
+			"api.example.com": newTestResource("r1", "api.example.com", "10.0.0.1", "net1"),
+		},
+		retries: newRetryQueue(nil),
+	}
+	app.retries.fail(ResourceMapping{Name: "web.example.com"}, "net1", errors.New("timeout"))
+	setActiveApp(t, app)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/twingate", nil)
+	if err := (StatusPageHandler{}).ServeHTTP(rec, req, nil); err != nil {
+		t.Fatalf("ServeHTTP() failed: %v", err)
+	}
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"<h2>acme</h2>",
+		"api.example.com",
+		"10.0.0.1",
+		"Last sync failed: rate limited &lt;retry later&gt;",
+		"web.example.com",
+		"console.internal",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page is missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestStatusPageHandler_NotRunning(t *testing.T) {
+	setActiveApp(t, nil)
+
+	rec := httptest.NewRecorder()
+	if err := (StatusPageHandler{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP() failed: %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "not running") {
+		t.Errorf("unexpected page:\n%s", rec.Body.String())
+	}
+
+	err := (StatusPageHandler{}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil), nil)
+	if err == nil {
+		t.Error("expected an error for POST")
+	}
+}
@@ -0,0 +1,90 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// summary previews the next sync of the currently discovered mappings,
+// followed by the summary of each tenant block. It makes read-only API
+// calls.
+func (t *TwingateApp) summary(ctx context.Context) (*SyncSummary, error) {
+	var tenants []*SyncSummary
+	for _, label := range t.tenantLabels() {
+		tenant, err := t.Tenants[label].summary(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("tenant block %s: %w", label, err)
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	summary := &SyncSummary{
+		Networks:  []NetworkSummary{},
+		Resources: []ResourceSummary{},
+	}
+	if t.Tenant != "" {
+		mappings, err := t.discoverMappings(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := t.resolveRemoteNetworkID(ctx); err != nil {
+			return nil, err
+		}
+		syncer := t.newSyncer(ctx)
+		t.loadSyncState(ctx, syncer)
+		summary, err = syncer.GetSyncSummary(ctx, mappings, t.remoteNetworkName(), t.ResourceCleanup)
+		if err != nil {
+			return nil, err
+		}
+		if t.AccessListing {
+			t.addSummaryAccess(ctx, summary)
+		}
+	}
+
+	summary.Tenant = t.Tenant
+	summary.Label = t.label
+	summary.Tenants = tenants
+	return summary, nil
+}
+
+// renderSummary writes the summary as a table of planned resource actions
+// per tenant.
+func renderSummary(w io.Writer, s *SyncSummary) error {
+	var b strings.Builder
+	if s.Tenant != "" {
+		writeSummary(&b, s, "Tenant "+s.Tenant)
+	}
+	for _, tenant := range s.Tenants {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		writeSummary(&b, tenant, fmt.Sprintf("Tenant block %s (tenant %s)", tenant.Label, tenant.Tenant))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeSummary(b *strings.Builder, s *SyncSummary, title string) {
+	fmt.Fprintf(b, "%s: %d to create, %d to update, %d to delete\n",
+		title, s.ResourcesToCreate, s.ResourcesToUpdate, s.ResourcesToDelete)
+
+	tw := tabwriter.NewWriter(b, 0, 4, 2, ' ', 0)
+	for _, network := range s.Networks {
+		if network.Action == "create" {
+			fmt.Fprintf(tw, "  create\tremote network %s\t\t\n", network.Name)
+		}
+	}
+	for _, res := range s.Resources {
+		detail := res.Address
+		if len(res.Changes) > 0 {
+			detail += " (" + strings.Join(res.Changes, ", ") + ")"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", res.Action, res.Name, res.RemoteNetwork, detail)
+	}
+	tw.Flush()
+}
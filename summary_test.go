@@ -0,0 +1,42 @@
+package twingate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderSummary(t *testing.T) {
+	summary := &SyncSummary{
+		Tenant:            "acme",
+		ResourcesToCreate: 1,
+		ResourcesToUpdate: 1,
+		ResourcesToDelete: 1,
+		Networks:          []NetworkSummary{{Name: "IoT", Action: "create"}},
+		Resources: []ResourceSummary{
+			{Name: "cam.example.com", Action: "create", Address: "10.0.0.1", RemoteNetwork: "IoT"},
+			{Name: "web.example.com", Action: "update", Address: "10.0.0.1", RemoteNetwork: "Caddy-Managed", Changes: []string{"address"}},
+			{Name: "old.example.com", Action: "delete", Address: "10.0.0.1", RemoteNetwork: "Caddy-Managed"},
+		},
+		Tenants: []*SyncSummary{{Tenant: "customer-b", Label: "b"}},
+	}
+
+	var b strings.Builder
+	if err := renderSummary(&b, summary); err != nil {
+		t.Fatalf("renderSummary() failed: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"Tenant acme: 1 to create, 1 to update, 1 to delete",
+		"remote network IoT",
+		"10.0.0.1 (address)",
+		"Tenant block b (tenant customer-b): 0 to create, 0 to update, 0 to delete",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, "  delete") || !strings.Contains(out, "old.example.com") {
+		t.Errorf("output missing the deletion:\n%s", out)
+	}
+}
@@ -2,8 +2,16 @@ package twingate
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -12,9 +20,288 @@ const (
 	DefaultRemoteNetworkName = "Caddy-Managed"
 )
 
+// TwingateAPI is the subset of TwingateClient used by ResourceSyncer. The
+// twingatetest package provides a mock implementation.
+type TwingateAPI interface {
+	GetResources(ctx context.Context, remoteNetworkID string) ([]Resource, error)
+	GetResource(ctx context.Context, resourceID string) (*Resource, error)
+	GetResourceByAlias(ctx context.Context, alias string, remoteNetworkID string) (*Resource, error)
+	GetResourceByName(ctx context.Context, name string, remoteNetworkID string) (*Resource, error)
+	CreateResource(ctx context.Context, input ResourceCreateInput) (*Resource, error)
+	UpdateResource(ctx context.Context, input ResourceUpdateInput) (*Resource, error)
+	DeleteResource(ctx context.Context, resourceID string) error
+	GetResourceAccess(ctx context.Context, resourceID string) ([]AccessPrincipal, error)
+	AddResourceAccess(ctx context.Context, resourceID string, principals []AccessPrincipal) error
+	RemoveResourceAccess(ctx context.Context, resourceID string, principalIDs []string) error
+	GetRemoteNetworkByName(ctx context.Context, name string) (*RemoteNetwork, error)
+	GetOrCreateRemoteNetwork(ctx context.Context, name string) (*RemoteNetwork, error)
+	GetGroupByName(ctx context.Context, name string) (*Group, error)
+}
+
 type ResourceSyncer struct {
-	client *TwingateClient
+	client TwingateAPI
 	logger *zap.Logger
+
+	// synced records the resource each mapping resolved to, keyed by
+	// mapping name, for the app's resource index.
+	synced map[string]Resource
+
+	// networks records the names of the remote networks synced to.
+	networks []string
+
+	// failed records the mappings whose upsert failed, for retry.
+	failed []FailedMapping
+
+	// groupIDs caches group name lookups for the lifetime of the syncer.
+	groupIDs map[string]string
+
+	// adopt matches existing resources by name as well as alias, and
+	// reports resources not yet in managed as adopted.
+	adopt   bool
+	managed map[string]bool
+
+	// defaultNetwork, if set, is the default remote network as configured
+	// by ID. Mappings in it are synced without looking it up by name.
+	defaultNetwork *RemoteNetwork
+
+	// matchOn selects the attributes existing resources are matched by:
+	// MatchOnAlias, MatchOnName or MatchOnNameOrAlias. Empty means
+	// MatchOnAlias.
+	matchOn string
+
+	// defaultAccess, if set, is granted to resources on creation, with
+	// the security policy defaultPolicyID.
+	defaultAccess   *DefaultAccess
+	defaultPolicyID string
+
+	// policyIDs maps the security policies mappings name to their IDs.
+	policyIDs map[string]string
+
+	// managedFields restricts updates of existing resources to these
+	// attributes. Nil means all of them.
+	managedFields map[string]bool
+
+	// cleanup, if set, is marked running during cleanup and checked for
+	// an abort before each deletion.
+	cleanup *cleanupControl
+
+	// confirmed, if set, restricts cleanup to these resource IDs, so a
+	// manual cleanup deletes only the resources an operator confirmed.
+	confirmed map[string]bool
+
+	// held names the flapping resources, which are not deleted when stale.
+	held map[string]bool
+
+	// unlocked, if set, runs fn with the lock the caller holds over the
+	// sync released, so the pauses between cleanup batches and warm-up
+	// waves do not block status readers and other work.
+	unlocked func(fn func())
+
+	// beforeDelete, if set, is called before each stale resource is
+	// deleted. The resource is kept if it returns an error.
+	beforeDelete func(ctx context.Context, resource Resource) error
+
+	// beforeChange and afterChange, if set, are called around each
+	// create, update and delete. The change is not made if beforeChange
+	// returns an error.
+	beforeChange func(ctx context.Context, change PlannedChange) error
+	afterChange  func(ctx context.Context, change PlannedChange, err error)
+
+	// applied holds the attribute values last set on each resource, keyed
+	// by ID, against which drift is detected. written records the values
+	// set or confirmed by the last sync, and drifts the drift it found.
+	applied     map[string]AppliedFields
+	written     map[string]AppliedFields
+	drifts      []Drift
+	driftPolicy *DriftPolicy
+
+	// granted records the groups granted access to each resource by the
+	// last sync, keyed by ID.
+	granted map[string][]string
+
+	// hashes holds the input hash of the last create or update applied to
+	// each resource, keyed by ID. An update whose inputs hash the same is
+	// skipped. hashed records the hashes of the last sync.
+	hashes map[string]string
+	hashed map[string]string
+
+	// loadHash, if set, is consulted for resources hashes does not hold,
+	// so a caller keeping the hashes elsewhere need not copy them in.
+	loadHash func(resourceID string) (string, bool)
+
+	// snapshotAccess captures the access to each resource before it is
+	// updated. snapshots records the captures of the last sync, keyed by
+	// resource ID.
+	snapshotAccess bool
+	snapshots      map[string]AccessSnapshot
+
+	// returning holds the latest journal entry of each name deleted within
+	// the restore window. A resource created for one of these names gets
+	// the access of the deleted one. restored records the names whose
+	// entries the last sync consumed, with the deleted resource's ID.
+	returning map[string]DeletedResource
+	restored  map[string]string
+
+	// pacer, if set, slows the upserts down to a warm-up's rate.
+	pacer *warmupPacer
+
+	// ids maps mapping names to the IDs of the resources they synced to
+	// before. A mapping is looked up by this ID first, so its resource is
+	// found even after its alias was cleared in the console.
+	ids map[string]string
+
+	// identities maps mapping identities to the resource IDs they synced
+	// to before, so a mapping whose host was renamed updates its old
+	// resource in place instead of creating a new one.
+	identities map[string]string
+
+	// listed caches the resources of each network during a sync, keyed
+	// by network ID and then resource ID, so mappings are matched by
+	// identity without listing the network once per mapping. Resources
+	// the sync changes are updated in it as they are synced.
+	listed map[string]map[string]Resource
+
+	// identified records the resource each mapping identity resolved to
+	// during the last sync. ambiguous holds identities shared by several
+	// mappings, which are not tracked, and desired the mapping names.
+	identified map[string]string
+	ambiguous  map[string]bool
+	desired    map[string]bool
+
+	// matched records the IDs of the resources the mappings matched
+	// during the last sync. Cleanup never deletes them as stale, even
+	// when they keep a name no mapping wants.
+	matched map[string]bool
+
+	// actions records what happened to each mapping, keyed by name.
+	actions map[string]string
+
+	// durations records how long each mapping's upsert took, keyed by name.
+	durations map[string]time.Duration
+
+	// deletions records the outcome of each stale resource deletion.
+	deletions []Deletion
+}
+
+// Deletion is the outcome of deleting, or in dry-run mode skipping, a
+// stale resource.
+type Deletion struct {
+	Resource Resource
+	DryRun   bool
+	Err      error
+}
+
+// Actions recorded per mapping by ResourceSyncer.
+const (
+	ActionCreated   = "created"
+	ActionUpdated   = "updated"
+	ActionUnchanged = "unchanged"
+	ActionAdopted   = "adopted"
+	ActionRenamed   = "renamed"
+)
+
+// Resource attributes the plugin can manage, as named by managed_fields.
+const (
+	FieldName      = "name"
+	FieldAddress   = "address"
+	FieldAlias     = "alias"
+	FieldGroups    = "groups"
+	FieldTags      = "tags"
+	FieldProtocols = "protocols"
+)
+
+// FieldSecurityPolicy names the security policy a resource is created
+// with in a plan's changes. It is not a managed field.
+const FieldSecurityPolicy = "security_policy"
+
+// resourceFields lists the attributes in the order they are documented.
+var resourceFields = []string{FieldName, FieldAddress, FieldAlias, FieldGroups, FieldTags, FieldProtocols}
+
+// Deletions returns the stale resources handled by the last SyncResources
+// call.
+func (r *ResourceSyncer) Deletions() []Deletion {
+	return r.deletions
+}
+
+// Durations returns how long each mapping's upsert took during the last
+// SyncResources call, keyed by mapping name.
+func (r *ResourceSyncer) Durations() map[string]time.Duration {
+	return r.durations
+}
+
+// Actions returns the action taken for each mapping during the last
+// SyncResources call, keyed by mapping name.
+func (r *ResourceSyncer) Actions() map[string]string {
+	return r.actions
+}
+
+// Applied returns the attribute values set or confirmed on each resource
+// during the last SyncResources call, keyed by resource ID.
+func (r *ResourceSyncer) Applied() map[string]AppliedFields {
+	return r.written
+}
+
+// Drifts returns the attributes found changed outside the plugin during
+// the last SyncResources call.
+func (r *ResourceSyncer) Drifts() []Drift {
+	return r.drifts
+}
+
+// Granted returns the IDs of the groups granted access to each resource,
+// keyed by resource ID, during the last SyncResources call.
+func (r *ResourceSyncer) Granted() map[string][]string {
+	return r.granted
+}
+
+// Snapshots returns the access captured before each resource was updated
+// during the last SyncResources call, keyed by resource ID.
+func (r *ResourceSyncer) Snapshots() map[string]AccessSnapshot {
+	return r.snapshots
+}
+
+// Restored returns the names of the resources recreated by the last
+// SyncResources call whose deleted predecessor's access was restored,
+// mapped to the deleted resource's ID.
+func (r *ResourceSyncer) Restored() map[string]string {
+	return r.restored
+}
+
+// Hashes returns the input hash applied to or confirmed on each resource
+// during the last SyncResources call, keyed by resource ID.
+func (r *ResourceSyncer) Hashes() map[string]string {
+	return r.hashed
+}
+
+// Identities returns the resource ID each mapping identity resolved to
+// during the last SyncResources call.
+func (r *ResourceSyncer) Identities() map[string]string {
+	return r.identified
+}
+
+// NewResourceSyncer returns a syncer that applies mappings through client.
+func NewResourceSyncer(client TwingateAPI, logger *zap.Logger) *ResourceSyncer {
+	return &ResourceSyncer{
+		client: client,
+		logger: logger,
+	}
+}
+
+// FailedMappings returns the mappings whose upsert failed during the last
+// SyncResources call.
+func (r *ResourceSyncer) FailedMappings() []FailedMapping {
+	return r.failed
+}
+
+// SyncedResources returns the resources created or confirmed by the last
+// SyncResources call, keyed by mapping name.
+func (r *ResourceSyncer) SyncedResources() map[string]Resource {
+	return r.synced
+}
+
+// SyncedNetworks returns the names of the remote networks the last
+// SyncResources call synced to.
+func (r *ResourceSyncer) SyncedNetworks() []string {
+	return r.networks
 }
 
 func (r *ResourceSyncer) SyncResources(ctx context.Context, mappings []ResourceMapping, remoteNetworkName string, cleanupConfig *CleanupConfig) error {
@@ -23,48 +310,152 @@ func (r *ResourceSyncer) SyncResources(ctx context.Context, mappings []ResourceM
 		return nil
 	}
 
-	networkName := remoteNetworkName
-	if networkName == "" {
-		networkName = DefaultRemoteNetworkName
+	defaultNetwork := remoteNetworkName
+	if defaultNetwork == "" {
+		defaultNetwork = DefaultRemoteNetworkName
+	}
+
+	r.synced = make(map[string]Resource, len(mappings))
+	r.networks = nil
+	r.failed = nil
+	r.actions = make(map[string]string, len(mappings))
+	r.durations = make(map[string]time.Duration, len(mappings))
+	r.deletions = nil
+	r.identified = make(map[string]string)
+	r.matched = make(map[string]bool)
+	r.written = make(map[string]AppliedFields)
+	r.drifts = nil
+	r.granted = make(map[string][]string)
+	r.hashed = make(map[string]string)
+	r.snapshots = make(map[string]AccessSnapshot)
+	r.restored = make(map[string]string)
+	r.listed = make(map[string]map[string]Resource)
+	r.desired, r.ambiguous = indexMappings(mappings)
+	groups := groupMappingsByNetwork(sortMappings(mappings), defaultNetwork)
+
+	networkNames := make([]string, 0, len(groups))
+	for name := range groups {
+		networkNames = append(networkNames, name)
+	}
+	sort.Strings(networkNames)
+
+	if r.cleanup != nil && cleanupConfig != nil && cleanupConfig.Enabled {
+		r.cleanup.start()
+		defer r.cleanup.stop()
+	}
+
+	var errorCount, deleteErrors int
+	for _, networkName := range networkNames {
+		upsertErrs, delErrs, err := r.syncNetwork(ctx, networkName, groups[networkName], cleanupConfig)
+		if err != nil {
+			return err
+		}
+		errorCount += upsertErrs
+		deleteErrors += delErrs
+	}
+
+	if errorCount+deleteErrors > 0 {
+		return &PartialSyncError{Upserts: errorCount, Deletes: deleteErrors}
 	}
 
+	return nil
+}
+
+// indexMappings returns the set of mapping names and the identities shared
+// by more than one mapping.
+func indexMappings(mappings []ResourceMapping) (names, ambiguous map[string]bool) {
+	names = make(map[string]bool, len(mappings))
+	ambiguous = make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, mapping := range mappings {
+		names[mapping.Name] = true
+		if mapping.Identity == "" {
+			continue
+		}
+		if seen[mapping.Identity] {
+			ambiguous[mapping.Identity] = true
+		}
+		seen[mapping.Identity] = true
+	}
+	return names, ambiguous
+}
+
+// sortMappings returns a copy of mappings sorted by name, so resources are
+// processed in the same order on every sync.
+func sortMappings(mappings []ResourceMapping) []ResourceMapping {
+	sorted := slices.Clone(mappings)
+	slices.SortStableFunc(sorted, func(a, b ResourceMapping) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return sorted
+}
+
+// sortResources sorts resources by name, then ID.
+func sortResources(resources []Resource) {
+	slices.SortFunc(resources, func(a, b Resource) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+// groupMappingsByNetwork buckets mappings by their target remote network,
+// using defaultNetwork for mappings without a per-site override.
+func groupMappingsByNetwork(mappings []ResourceMapping, defaultNetwork string) map[string][]ResourceMapping {
+	groups := make(map[string][]ResourceMapping)
+	for _, mapping := range mappings {
+		name := mapping.RemoteNetwork
+		if name == "" {
+			name = defaultNetwork
+		}
+		groups[name] = append(groups[name], mapping)
+	}
+	return groups
+}
+
+// syncNetwork upserts mappings into a single remote network and, when cleanup
+// is enabled, deletes resources in that network that are not among them.
+// Cleanup only ever sees the mappings targeting this network, so a host that
+// lives in another network is never treated as stale here.
+func (r *ResourceSyncer) syncNetwork(ctx context.Context, networkName string, mappings []ResourceMapping, cleanupConfig *CleanupConfig) (upsertErrors, deleteErrors int, err error) {
 	r.logger.Info("Starting resource synchronization",
 		zap.String("remote_network", networkName),
 		zap.Int("mappings_count", len(mappings)))
 
-	network, err := r.client.GetOrCreateRemoteNetwork(ctx, networkName)
-	if err != nil {
-		return fmt.Errorf("failed to get or create remote network: %w", err)
+	network := r.defaultNetwork
+	if network == nil || network.Name != networkName {
+		network, err = r.client.GetOrCreateRemoteNetwork(ctx, networkName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to get or create remote network: %w", err)
+		}
 	}
 
 	r.logger.Info("Using remote network",
 		zap.String("name", network.Name),
 		zap.String("id", network.ID))
+	r.networks = append(r.networks, network.Name)
 
 	successCount, errorCount := r.upsertResources(ctx, mappings, network.ID)
 
 	r.logger.Info("Resource upsert completed",
+		zap.String("remote_network", network.Name),
 		zap.Int("success", successCount),
 		zap.Int("errors", errorCount))
 
-	var deleteCount, deleteErrors int
+	var deleteCount int
 	if cleanupConfig != nil && cleanupConfig.Enabled {
 		deleteCount, deleteErrors = r.deleteStaleResources(ctx, mappings, network.ID, cleanupConfig)
 
 		r.logger.Info("Resource cleanup completed",
+			zap.String("remote_network", network.Name),
 			zap.Int("deleted", deleteCount),
 			zap.Int("errors", deleteErrors))
 	} else {
 		r.logger.Debug("Resource cleanup disabled, skipping deletion phase")
 	}
 
-	totalErrors := errorCount + deleteErrors
-	if totalErrors > 0 {
-		return fmt.Errorf("sync completed with %d errors (upsert: %d, delete: %d)",
-			totalErrors, errorCount, deleteErrors)
-	}
-
-	return nil
+	return errorCount, deleteErrors, nil
 }
 
 func (r *ResourceSyncer) upsertResources(ctx context.Context, mappings []ResourceMapping, networkID string) (success, errors int) {
@@ -74,13 +465,36 @@ func (r *ResourceSyncer) upsertResources(ctx context.Context, mappings []Resourc
 			zap.Int("total", len(mappings)),
 			zap.String("name", mapping.Name))
 
-		if err := r.syncSingleResource(ctx, mapping, networkID); err != nil {
+		var resource *Resource
+		err := r.pacer.wait(ctx, r.unlocked)
+		if err == nil {
+			started := time.Now()
+			resource, err = r.syncSingleResource(ctx, mapping, networkID)
+			if r.durations != nil {
+				r.durations[mapping.Name] = time.Since(started)
+			}
+		}
+		if err != nil {
 			r.logger.Error("Failed to upsert resource",
 				zap.String("name", mapping.Name),
 				zap.Error(err))
 			errors++
+			r.failed = append(r.failed, FailedMapping{
+				Mapping:   mapping,
+				NetworkID: networkID,
+				Err:       err,
+			})
 		} else {
 			success++
+			if r.synced != nil {
+				r.synced[mapping.Name] = *resource
+			}
+			if listed, ok := r.listed[networkID]; ok {
+				listed[resource.ID] = *resource
+			}
+			if r.identified != nil && mapping.Identity != "" && !r.ambiguous[mapping.Identity] {
+				r.identified[mapping.Identity] = resource.ID
+			}
 		}
 	}
 
@@ -104,109 +518,313 @@ func (r *ResourceSyncer) deleteStaleResources(ctx context.Context, desiredMappin
 
 	var staleResources []Resource
 	for _, resource := range existingResources {
-		if !desiredNames[resource.Name] {
-			staleResources = append(staleResources, resource)
+		if desiredNames[resource.Name] || r.matched[resource.ID] || !cleanupConfig.inScope(resource.Name) || (r.confirmed != nil && !r.confirmed[resource.ID]) {
+			continue
+		}
+		if r.held[resource.Name] {
+			r.logger.Info("Keeping stale resource while it is flapping",
+				zap.String("id", resource.ID),
+				zap.String("name", resource.Name))
+			continue
 		}
+		staleResources = append(staleResources, resource)
 	}
 
 	if len(staleResources) == 0 {
 		r.logger.Info("No stale resources to delete")
 		return 0, 0
 	}
+	sortResources(staleResources)
+
+	var access map[string][]AccessPrincipal
+	if cleanupConfig.RevokeAccess {
+		access = r.lookupAccess(ctx, staleResources)
+		orderByAccess(staleResources, access)
+	}
 
 	r.logger.Info("Found stale resources",
 		zap.Int("count", len(staleResources)),
+		zap.String("scope", cleanupConfig.Scope),
 		zap.Bool("dry_run", cleanupConfig.DryRun))
 
-	for _, resource := range staleResources {
+	for i, resource := range staleResources {
+		if !cleanupConfig.DryRun && cleanupConfig.BatchSize > 0 && i > 0 && i%cleanupConfig.BatchSize == 0 {
+			if !r.pauseBetweenBatches(ctx, cleanupConfig, i, len(staleResources)-i) {
+				r.logger.Warn("Resource cleanup stopped, keeping remaining stale resources",
+					zap.Int("remaining", len(staleResources)-i))
+				break
+			}
+		}
+		if r.cleanup.isAborted() {
+			r.logger.Warn("Resource cleanup aborted, keeping remaining stale resources",
+				zap.Int("remaining", len(staleResources)-i))
+			break
+		}
+
 		if cleanupConfig.DryRun {
 			r.logger.Info("[DRY RUN] Would delete resource",
 				zap.String("id", resource.ID),
 				zap.String("name", resource.Name),
 				zap.String("address", resource.Address.Value))
+			if principals := access[resource.ID]; len(principals) > 0 {
+				r.logger.Info("[DRY RUN] Would revoke access to resource",
+					zap.String("id", resource.ID),
+					zap.Int("principals", len(principals)))
+			}
 			deleted++
+			r.deletions = append(r.deletions, Deletion{Resource: resource, DryRun: true})
 			continue
 		}
 
+		change := PlannedChange{Action: ChangeDelete, ResourceID: resource.ID, Name: resource.Name, Current: currentFields(resource)}
+		if err := r.checkChange(ctx, change); err != nil {
+			r.logger.Warn("Keeping stale resource rejected by hook",
+				zap.String("id", resource.ID),
+				zap.String("name", resource.Name),
+				zap.Error(err))
+			errors++
+			r.deletions = append(r.deletions, Deletion{Resource: resource, Err: err})
+			continue
+		}
+
+		if r.beforeDelete != nil {
+			if err := r.beforeDelete(ctx, resource); err != nil {
+				r.logger.Error("Keeping stale resource that could not be journaled",
+					zap.String("id", resource.ID),
+					zap.String("name", resource.Name),
+					zap.Error(err))
+				errors++
+				r.deletions = append(r.deletions, Deletion{Resource: resource, Err: err})
+				continue
+			}
+		}
+
+		var revoked []AccessPrincipal
+		if cleanupConfig.RevokeAccess {
+			var err error
+			if revoked, err = r.revokeAccess(ctx, resource, access); err != nil {
+				r.logger.Error("Keeping stale resource whose access could not be revoked",
+					zap.String("id", resource.ID),
+					zap.String("name", resource.Name),
+					zap.Error(err))
+				errors++
+				r.deletions = append(r.deletions, Deletion{Resource: resource, Err: err})
+				continue
+			}
+		}
+
 		r.logger.Info("Deleting stale resource",
 			zap.String("id", resource.ID),
 			zap.String("name", resource.Name))
 
-		if err := r.client.DeleteResource(ctx, resource.ID); err != nil {
+		err := r.client.DeleteResource(ctx, resource.ID)
+		r.reportChange(ctx, change, err)
+		if err != nil {
 			r.logger.Error("Failed to delete resource",
 				zap.String("id", resource.ID),
 				zap.String("name", resource.Name),
 				zap.Error(err))
+			r.regrantAccess(ctx, resource, revoked)
 			errors++
 		} else {
 			deleted++
 		}
+		r.deletions = append(r.deletions, Deletion{Resource: resource, Err: err})
 	}
 
 	return deleted, errors
 }
 
-func (r *ResourceSyncer) syncSingleResource(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) error {
+func (r *ResourceSyncer) syncSingleResource(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) (*Resource, error) {
 	if err := r.validateMapping(mapping); err != nil {
-		return fmt.Errorf("invalid mapping: %w", err)
+		return nil, fmt.Errorf("invalid mapping: %w", err)
 	}
 
-	var existingResource *Resource
-	var err error
+	existingResource, rule, err := r.matchResource(ctx, mapping, remoteNetworkID)
+	if err != nil {
+		return nil, err
+	}
 
-	if mapping.Alias != nil {
-		r.logger.Info("Checking for existing resource by alias",
-			zap.String("alias", *mapping.Alias),
-			zap.String("remote_network_id", remoteNetworkID))
+	action := ActionUpdated
+	if rule == MatchIdentity && existingResource.Name != mapping.Name {
+		r.logger.Info("Found resource of renamed host",
+			zap.String("resource_id", existingResource.ID),
+			zap.String("old_name", existingResource.Name),
+			zap.String("new_name", mapping.Name))
+		action = ActionRenamed
+	}
 
-		existingResource, err = r.client.GetResourceByAlias(ctx, *mapping.Alias, remoteNetworkID)
-		if err != nil {
-			return fmt.Errorf("failed to check for existing resource: %w", err)
+	groupIDs, err := r.resolveGroups(ctx, mapping.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	if existingResource == nil {
+		resource, err := r.createNewResource(ctx, mapping, remoteNetworkID, groupIDs)
+		if err == nil {
+			r.recordAction(mapping.Name, ActionCreated)
 		}
+		return resource, err
+	}
 
-		if existingResource != nil {
-			r.logger.Info("Found existing resource by alias",
-				zap.String("resource_id", existingResource.ID),
-				zap.String("name", existingResource.Name))
-		} else {
-			r.logger.Info("No existing resource found by alias",
-				zap.String("alias", *mapping.Alias))
+	if action == ActionUpdated && r.adopt && r.managed != nil && !r.managed[existingResource.ID] {
+		action = ActionAdopted
+	}
+
+	resource, err := r.updateExistingResource(ctx, mapping, existingResource, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+	if resource == existingResource && action == ActionUpdated {
+		action = ActionUnchanged
+	}
+	r.recordAction(mapping.Name, action)
+	return resource, nil
+}
+
+// validateManagedFields checks that fields only names resource attributes
+// the plugin can manage.
+func validateManagedFields(fields []string) error {
+	for _, field := range fields {
+		if !slices.Contains(resourceFields, field) {
+			return fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(resourceFields, ", "))
 		}
-	} else {
-		r.logger.Info("Checking for existing resource by name",
-			zap.String("name", mapping.Name),
-			zap.String("remote_network_id", remoteNetworkID))
+	}
+	return nil
+}
 
-		resources, err := r.client.GetResources(ctx, remoteNetworkID)
-		if err != nil {
-			return fmt.Errorf("failed to list resources: %w", err)
+// recordApplied records the attribute values a sync set or confirmed on a
+// resource.
+func (r *ResourceSyncer) recordApplied(resourceID string, fields AppliedFields) {
+	if r.written == nil {
+		r.written = make(map[string]AppliedFields)
+	}
+	r.written[resourceID] = fields
+}
+
+// lastHash returns the input hash of the last create or update applied
+// to a resource, or "" if there is none.
+func (r *ResourceSyncer) lastHash(resourceID string) string {
+	if hash, ok := r.hashes[resourceID]; ok || r.loadHash == nil {
+		return hash
+	}
+	hash, _ := r.loadHash(resourceID)
+	return hash
+}
+
+// recordHash records the input hash last applied to a resource. Empty
+// hashes are not recorded.
+func (r *ResourceSyncer) recordHash(resourceID, hash string) {
+	if hash == "" {
+		return
+	}
+	if r.hashed == nil {
+		r.hashed = make(map[string]string)
+	}
+	r.hashed[resourceID] = hash
+}
+
+// sentInputs returns the tags and protocols a mutation actually sends,
+// without those the API schema takes no argument for. Hashes only cover
+// what is sent, so values left out are applied once the schema takes
+// them.
+func (r *ResourceSyncer) sentInputs(tags map[string]string, protocols *ProtocolsInput) (map[string]string, *ProtocolsInput) {
+	schema := r.schema()
+	if !schema.Tags {
+		tags = nil
+	}
+	if !schema.Protocols {
+		protocols = nil
+	}
+	return tags, protocols
+}
+
+// schema returns the capabilities of the client's API schema, or every
+// capability for clients that do not probe it.
+func (r *ResourceSyncer) schema() SchemaCapabilities {
+	if probed, ok := r.client.(interface{ SchemaCapabilities() SchemaCapabilities }); ok {
+		return probed.SchemaCapabilities()
+	}
+	return fullSchema
+}
+
+// inputHash returns a hash of the attribute values, groups, tags and
+// protocols a create or update applies to a resource. Tags and protocols
+// only contribute when set, so hashes recorded before they existed still
+// match.
+func inputHash(fields AppliedFields, groupIDs []string, tags map[string]string, protocols *ProtocolsInput) string {
+	h := sha256.New()
+	for _, value := range slices.Concat([]string{fields.Name, fields.Address, fields.Alias}, uniqueSorted(groupIDs)) {
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	if len(tags) > 0 {
+		h.Write([]byte{1})
+		for _, tag := range *graphqlTags(tags) {
+			h.Write([]byte(tag.Key + "=" + tag.Value))
+			h.Write([]byte{0})
 		}
+	}
+	if protocols != nil {
+		h.Write([]byte{2})
+		// Marshaling a struct of plain values cannot fail.
+		encoded, _ := json.Marshal(protocols)
+		h.Write(encoded)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func (r *ResourceSyncer) recordGranted(resourceID string, groupIDs []string) {
+	if len(groupIDs) == 0 {
+		return
+	}
+	if r.granted == nil {
+		r.granted = make(map[string][]string)
+	}
+	r.granted[resourceID] = groupIDs
+}
 
-		r.logger.Info("Fetched resources from API",
-			zap.Int("count", len(resources)),
-			zap.String("remote_network_id", remoteNetworkID))
+// manages reports whether updates may change the given resource attribute.
+func (r *ResourceSyncer) manages(field string) bool {
+	return r.managedFields == nil || r.managedFields[field]
+}
 
-		for _, res := range resources {
-			if res.Name == mapping.Name {
-				existingResource = &res
-				r.logger.Info("Found existing resource by name",
-					zap.String("resource_id", res.ID),
-					zap.String("name", res.Name))
-				break
-			}
+func (r *ResourceSyncer) recordAction(name, action string) {
+	if r.actions == nil {
+		r.actions = make(map[string]string)
+	}
+	r.actions[name] = action
+}
+
+// resolveGroups looks up the IDs of the named groups. A group that does not
+// exist is an error, so a typo never silently leaves a resource unreachable.
+func (r *ResourceSyncer) resolveGroups(ctx context.Context, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if r.groupIDs == nil {
+		r.groupIDs = make(map[string]string)
+	}
+
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		if id, ok := r.groupIDs[name]; ok {
+			ids = append(ids, id)
+			continue
 		}
 
-		if existingResource == nil {
-			r.logger.Info("No existing resource found by name",
-				zap.String("name", mapping.Name))
+		group, err := r.client.GetGroupByName(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up group %q: %w", name, err)
+		}
+		if group == nil {
+			return nil, fmt.Errorf("group %q not found", name)
 		}
-	}
 
-	if existingResource != nil {
-		return r.updateExistingResource(ctx, mapping, existingResource)
-	} else {
-		return r.createNewResource(ctx, mapping, remoteNetworkID)
+		r.groupIDs[name] = group.ID
+		ids = append(ids, group.ID)
 	}
+	return ids, nil
 }
 
 func (r *ResourceSyncer) validateMapping(mapping ResourceMapping) error {
@@ -216,20 +834,73 @@ func (r *ResourceSyncer) validateMapping(mapping ResourceMapping) error {
 	if mapping.Address == "" {
 		return fmt.Errorf("resource address cannot be empty")
 	}
+	if mapping.Alias != nil && !isWildcardDNSName(*mapping.Alias) {
+		return fmt.Errorf("alias '%s' is not a valid DNS name", *mapping.Alias)
+	}
+
+	return validateResourceAddress(mapping.Address)
+}
 
-	// Twingate API currently only supports IPv4 addresses
-	ip := net.ParseIP(mapping.Address)
+// validateResourceAddress checks that address is one the Twingate API
+// accepts: an IPv4 address, an IPv4 CIDR range, or a DNS name, which may
+// be a wildcard.
+func validateResourceAddress(address string) error {
+	if strings.Contains(address, "/") {
+		ip, _, err := net.ParseCIDR(address)
+		if err != nil {
+			return fmt.Errorf("address '%s' is not a valid CIDR range", address)
+		}
+		if ip.To4() == nil {
+			return fmt.Errorf("address '%s' is IPv6, but only IPv4 is currently supported", address)
+		}
+		return nil
+	}
+
+	ip := net.ParseIP(address)
 	if ip == nil {
-		return fmt.Errorf("address '%s' is not a valid IP address", mapping.Address)
+		if !isWildcardDNSName(address) {
+			return fmt.Errorf("address '%s' is not a valid IP address or DNS name", address)
+		}
+		return nil
 	}
 	if ip.To4() == nil {
-		return fmt.Errorf("address '%s' is IPv6, but only IPv4 is currently supported", mapping.Address)
+		return fmt.Errorf("address '%s' is IPv6, but only IPv4 is currently supported", address)
 	}
 
 	return nil
 }
 
-func (r *ResourceSyncer) createNewResource(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) error {
+// isDNSName reports whether s is a syntactically valid DNS hostname.
+func isDNSName(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || len(s) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// isWildcardDNSName reports whether s is a DNS hostname, optionally with
+// a leading wildcard label such as *.lab.example.com.
+func isWildcardDNSName(s string) bool {
+	return isDNSName(strings.TrimPrefix(s, "*."))
+}
+
+func (r *ResourceSyncer) createNewResource(ctx context.Context, mapping ResourceMapping, remoteNetworkID string, groupIDs []string) (*Resource, error) {
 	aliasStr := "<none>"
 	if mapping.Alias != nil {
 		aliasStr = *mapping.Alias
@@ -240,19 +911,43 @@ func (r *ResourceSyncer) createNewResource(ctx context.Context, mapping Resource
 		zap.String("address", mapping.Address),
 		zap.String("alias", aliasStr))
 
+	createGroupIDs, policyID, err := r.withDefaultAccess(ctx, groupIDs, mapping.SecurityPolicy)
+	if err != nil {
+		return nil, err
+	}
+
 	input := ResourceCreateInput{
-		Name:            mapping.Name,
-		Address:         mapping.Address,
-		RemoteNetworkID: remoteNetworkID,
+		Name:             mapping.Name,
+		Address:          mapping.Address,
+		RemoteNetworkID:  remoteNetworkID,
+		GroupIDs:         createGroupIDs,
+		SecurityPolicyID: policyID,
 	}
+	input.Tags, input.Protocols = r.sentInputs(mapping.Labels, mapping.Protocols)
 
 	if mapping.Alias != nil {
 		input.Alias = *mapping.Alias
 	}
 
+	if mapping.Alias != nil {
+		if err := r.checkAliasFree(ctx, *mapping.Alias); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := AppliedFields{Name: input.Name, Address: input.Address, Alias: input.Alias, Tagged: len(input.Tags) > 0}
+	change := PlannedChange{Action: ChangeCreate, Name: input.Name, Desired: &fields, GroupIDs: input.GroupIDs, Tags: input.Tags, Protocols: input.Protocols}
+	if err := r.checkChange(ctx, change); err != nil {
+		return nil, fmt.Errorf("resource creation rejected: %w", err)
+	}
+
 	resource, err := r.client.CreateResource(ctx, input)
+	if err == nil {
+		change.ResourceID = resource.ID
+	}
+	r.reportChange(ctx, change, err)
 	if err != nil {
-		return fmt.Errorf("failed to create resource: %w", err)
+		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
 	r.logger.Info("Successfully created resource",
@@ -260,154 +955,464 @@ func (r *ResourceSyncer) createNewResource(ctx context.Context, mapping Resource
 		zap.String("name", resource.Name),
 		zap.String("address", resource.Address.Value))
 
-	return nil
+	// The hash leaves the default access out, as updates never apply it.
+	r.recordApplied(resource.ID, fields)
+	r.recordGranted(resource.ID, input.GroupIDs)
+	r.recordHash(resource.ID, inputHash(fields, groupIDs, input.Tags, input.Protocols))
+	if entry, ok := r.returning[mapping.Name]; ok {
+		r.restoreAccess(ctx, resource.ID, entry, input.GroupIDs)
+	}
+	return resource, nil
 }
 
-func (r *ResourceSyncer) updateExistingResource(ctx context.Context, mapping ResourceMapping, existing *Resource) error {
-	needsUpdate := false
+// checkAliasFree looks the alias up across the whole tenant so that a
+// conflict names the resource holding it, rather than surfacing as a bare
+// "alias already exists" from resourceCreate. A failed lookup is not
+// fatal; the create itself still rejects duplicates.
+func (r *ResourceSyncer) checkAliasFree(ctx context.Context, alias string) error {
+	owner, err := r.client.GetResourceByAlias(ctx, alias, "")
+	if err != nil {
+		r.logger.Debug("Alias lookup failed, creating resource anyway",
+			zap.String("alias", alias),
+			zap.Error(err))
+		return nil
+	}
+	if owner == nil {
+		return nil
+	}
+	return &AliasConflictError{
+		Alias:           alias,
+		ResourceID:      owner.ID,
+		ResourceName:    owner.Name,
+		RemoteNetworkID: owner.RemoteNetwork.ID,
+	}
+}
 
-	// Initialize all mutation fields with existing values, then update as needed
-	updateInput := ResourceUpdateInput{
-		ID:      existing.ID,
-		Name:    &existing.Name,
-		Address: &existing.Address.Value,
-		Alias:   existing.Alias,
+// resourceUpdate is the update that brings an existing resource in line
+// with its mapping, as worked out by planUpdate. next holds the attribute
+// values the resource has after it and hash the hash of its inputs. send
+// is set if there is anything to send.
+type resourceUpdate struct {
+	input ResourceUpdateInput
+	diff  Diff
+	next  AppliedFields
+	hash  string
+	send  bool
+}
+
+// changes lists the attributes the update changes, in resourceFields
+// order.
+func (u resourceUpdate) changes() []string {
+	if !u.send {
+		return nil
+	}
+	changes := u.diff.fields()
+	if len(u.input.AddedGroupIDs) > 0 {
+		changes = append(changes, FieldGroups)
+	}
+	if u.input.Tags != nil {
+		changes = append(changes, FieldTags)
 	}
+	if u.input.Protocols != nil {
+		changes = append(changes, FieldProtocols)
+	}
+	return changes
+}
 
-	if existing.Name != mapping.Name {
-		needsUpdate = true
-		updateInput.Name = &mapping.Name
-		r.logger.Debug("Resource name needs update",
-			zap.String("resource_id", existing.ID),
-			zap.String("current", existing.Name),
-			zap.String("new", mapping.Name))
+// planUpdate works out the update of existing that applies mapping and
+// groupIDs, without making it. A preview records drift without logging it.
+func (r *ResourceSyncer) planUpdate(existing *Resource, mapping ResourceMapping, groupIDs []string, preview bool) resourceUpdate {
+	current, desired := appliedFromResource(existing), appliedFromMapping(mapping)
+
+	var last *AppliedFields
+	next := current
+	if applied, ok := r.applied[existing.ID]; ok {
+		last = &applied
+		next = applied
 	}
 
-	if existing.Address.Value != mapping.Address {
-		needsUpdate = true
-		updateInput.Address = &mapping.Address
-		r.logger.Debug("Resource address needs update",
-			zap.String("resource_id", existing.ID),
-			zap.String("current", existing.Address.Value),
-			zap.String("new", mapping.Address))
+	// Only changed fields the plugin manages are sent; the rest keep the
+	// values they have in the console.
+	update := resourceUpdate{input: ResourceUpdateInput{ID: existing.ID}, diff: Diff{}}
+
+	for _, field := range driftFields {
+		from, to := current.get(field), desired.get(field)
+		if from == to {
+			next.set(field, to)
+			continue
+		}
+		if !r.reconcileField(existing, field, from, to, last, preview) {
+			continue
+		}
+
+		update.send = true
+		next.set(field, to)
+		switch field {
+		case FieldName:
+			update.input.Name = &to
+		case FieldAddress:
+			update.input.Address = &to
+		case FieldAlias:
+			update.input.Alias = &to
+		}
+		update.diff.set(field, from, to)
 	}
 
-	currentAlias := ""
-	if existing.Alias != nil {
-		currentAlias = *existing.Alias
+	// Current grants, tags and protocols are not fetched, so configured
+	// groups, labels and protocols are applied again unless the same
+	// inputs were already applied to the resource.
+	var tags map[string]string
+	if r.manages(FieldTags) {
+		tags = mapping.Labels
 	}
-	desiredAlias := ""
-	if mapping.Alias != nil {
-		desiredAlias = *mapping.Alias
+	var protocols *ProtocolsInput
+	if r.manages(FieldProtocols) {
+		protocols = mapping.Protocols
+	}
+	tags, protocols = r.sentInputs(tags, protocols)
+	// Tags the plugin applied are cleared with an empty list once the
+	// labels are removed. Tags of resources it never tagged are left to
+	// the console.
+	untag := false
+	if r.manages(FieldTags) && r.schema().Tags {
+		untag = len(tags) == 0 && next.Tagged
+		next.Tagged = len(tags) > 0
 	}
-	if currentAlias != desiredAlias {
-		needsUpdate = true
-		updateInput.Alias = mapping.Alias
-		r.logger.Debug("Resource alias needs update",
+	if untag {
+		tags = map[string]string{}
+	}
+	grant := r.manages(FieldGroups) && len(groupIDs) > 0
+	update.next = next
+	update.hash = inputHash(next, groupIDs, tags, protocols)
+	if grant || len(tags) > 0 || protocols != nil || untag {
+		if !update.send && !untag && r.lastHash(existing.ID) == update.hash {
+			if !preview {
+				r.logger.Debug("Skipping update identical to the last one applied",
+					zap.String("resource_id", existing.ID),
+					zap.String("hash", update.hash))
+			}
+		} else {
+			update.send = true
+			if grant {
+				update.input.AddedGroupIDs = groupIDs
+			}
+			update.input.Tags = tags
+			update.input.Protocols = protocols
+		}
+	}
+	return update
+}
+
+func (r *ResourceSyncer) updateExistingResource(ctx context.Context, mapping ResourceMapping, existing *Resource, groupIDs []string) (*Resource, error) {
+	update := r.planUpdate(existing, mapping, groupIDs, false)
+	current := appliedFromResource(existing)
+
+	if update.send && len(update.input.AddedGroupIDs) > 0 && r.alreadyGranted(ctx, existing.ID, &update) {
+		r.logger.Debug("Resource already has the configured access",
 			zap.String("resource_id", existing.ID),
-			zap.String("current", currentAlias),
-			zap.String("new", desiredAlias))
+			zap.String("name", existing.Name))
+		r.recordApplied(existing.ID, update.next)
+		r.recordHash(existing.ID, update.hash)
+		return existing, nil
 	}
 
-	if !needsUpdate {
+	if !update.send {
 		r.logger.Debug("Resource is already up to date",
 			zap.String("resource_id", existing.ID),
 			zap.String("name", existing.Name))
-		return nil
+		r.recordApplied(existing.ID, update.next)
+		r.recordHash(existing.ID, r.lastHash(existing.ID))
+		return existing, nil
 	}
 
 	r.logger.Debug("Updating existing resource",
 		zap.String("id", existing.ID),
-		zap.String("name", existing.Name))
+		zap.String("name", existing.Name),
+		zap.Object("diff", update.diff))
+
+	change := PlannedChange{
+		Action:     ChangeUpdate,
+		ResourceID: existing.ID,
+		Name:       existing.Name,
+		Current:    &current,
+		Desired:    &update.next,
+		Diff:       update.diff,
+		GroupIDs:   update.input.AddedGroupIDs,
+		Tags:       update.input.Tags,
+		Protocols:  update.input.Protocols,
+	}
+	if err := r.checkChange(ctx, change); err != nil {
+		return nil, fmt.Errorf("resource update rejected: %w", err)
+	}
+	if r.snapshotAccess {
+		r.recordSnapshot(ctx, existing.ID)
+	}
 
-	resource, err := r.client.UpdateResource(ctx, updateInput)
+	resource, err := r.client.UpdateResource(ctx, update.input)
+	r.reportChange(ctx, change, err)
 	if err != nil {
-		return fmt.Errorf("failed to update resource: %w", err)
+		return nil, fmt.Errorf("failed to update resource: %w", err)
 	}
 
 	r.logger.Info("Successfully updated resource",
 		zap.String("id", resource.ID),
 		zap.String("name", resource.Name),
-		zap.String("address", resource.Address.Value))
+		zap.String("address", resource.Address.Value),
+		zap.Object("diff", update.diff))
 
-	return nil
+	r.recordApplied(resource.ID, update.next)
+	r.recordGranted(resource.ID, update.input.AddedGroupIDs)
+	r.recordHash(resource.ID, update.hash)
+	return resource, nil
 }
 
-func (r *ResourceSyncer) GetSyncSummary(ctx context.Context, mappings []ResourceMapping, remoteNetworkName string) (*SyncSummary, error) {
+// alreadyGranted leaves the groups that already have access to the
+// resource out of update, and reports whether that leaves nothing to send.
+// Without the input hash of a previous sync, as after a restart without
+// stored state, this keeps the grants from being sent again on every sync.
+// A failed access lookup sends every group.
+func (r *ResourceSyncer) alreadyGranted(ctx context.Context, resourceID string, update *resourceUpdate) bool {
+	principals, err := r.client.GetResourceAccess(ctx, resourceID)
+	if err != nil {
+		r.logger.Debug("Failed to read resource access, granting every group",
+			zap.String("resource_id", resourceID),
+			zap.Error(err))
+		return false
+	}
+
+	granted := make(map[string]bool, len(principals))
+	for _, principal := range principals {
+		granted[principal.ID] = true
+	}
+	var missing []string
+	for _, id := range update.input.AddedGroupIDs {
+		if !granted[id] {
+			missing = append(missing, id)
+		}
+	}
+	update.input.AddedGroupIDs = missing
+	return len(missing) == 0 && len(update.diff) == 0 && update.input.Tags == nil && update.input.Protocols == nil
+}
+
+// GetSyncSummary previews what SyncResources would do with mappings
+// without changing anything: which remote networks would be created, what
+// would happen to each resource and, when cleanup is enabled, which stale
+// resources would be deleted. Drifts lists the drift found meanwhile.
+func (r *ResourceSyncer) GetSyncSummary(ctx context.Context, mappings []ResourceMapping, remoteNetworkName string, cleanupConfig *CleanupConfig) (*SyncSummary, error) {
 	summary := &SyncSummary{
 		TotalMappings: len(mappings),
+		Networks:      []NetworkSummary{},
+		Resources:     []ResourceSummary{},
 	}
+	r.drifts = nil
 
 	if len(mappings) == 0 {
 		return summary, nil
 	}
 
-	networkName := remoteNetworkName
-	if networkName == "" {
-		networkName = DefaultRemoteNetworkName
+	defaultNetwork := remoteNetworkName
+	if defaultNetwork == "" {
+		defaultNetwork = DefaultRemoteNetworkName
 	}
 
-	network, err := r.client.GetRemoteNetworkByName(ctx, networkName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check remote network: %w", err)
-	}
+	r.desired, r.ambiguous = indexMappings(mappings)
+	r.matched = make(map[string]bool)
+	groups := groupMappingsByNetwork(sortMappings(mappings), defaultNetwork)
 
-	if network == nil {
-		summary.RemoteNetworkAction = "create"
-		summary.RemoteNetworkName = networkName
-	} else {
-		summary.RemoteNetworkAction = "use_existing"
-		summary.RemoteNetworkName = network.Name
-		summary.RemoteNetworkID = network.ID
+	networkNames := make([]string, 0, len(groups))
+	for name := range groups {
+		networkNames = append(networkNames, name)
 	}
+	sort.Strings(networkNames)
 
-	for _, mapping := range mappings {
-		if network != nil {
-			var existing *Resource
+	for _, networkName := range networkNames {
+		network := r.defaultNetwork
+		if network == nil || network.Name != networkName {
 			var err error
-
-			if mapping.Alias != nil {
-				existing, err = r.client.GetResourceByAlias(ctx, *mapping.Alias, network.ID)
-				if err != nil {
-					r.logger.Warn("Failed to check existing resource during summary",
-						zap.String("name", mapping.Name),
-						zap.Error(err))
-					continue
-				}
-			} else {
-				resources, err := r.client.GetResources(ctx, network.ID)
-				if err != nil {
-					r.logger.Warn("Failed to list resources during summary",
-						zap.String("name", mapping.Name),
-						zap.Error(err))
-					continue
-				}
-				for _, res := range resources {
-					if res.Name == mapping.Name {
-						existing = &res
-						break
-					}
-				}
+			network, err = r.client.GetRemoteNetworkByName(ctx, networkName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check remote network: %w", err)
 			}
+		}
 
-			if existing != nil {
-				summary.ResourcesToUpdate++
-			} else {
-				summary.ResourcesToCreate++
+		networkSummary := NetworkSummary{Name: networkName, Action: "create"}
+		if network != nil {
+			networkSummary = NetworkSummary{Name: network.Name, ID: network.ID, Action: "use_existing"}
+		}
+		summary.Networks = append(summary.Networks, networkSummary)
+		if networkName == defaultNetwork {
+			summary.RemoteNetworkAction = networkSummary.Action
+			summary.RemoteNetworkName = networkSummary.Name
+			summary.RemoteNetworkID = networkSummary.ID
+		}
+
+		for _, mapping := range groups[networkName] {
+			summary.add(r.summarizeMapping(ctx, mapping, network, networkName))
+		}
+
+		if network == nil || cleanupConfig == nil || !cleanupConfig.Enabled {
+			continue
+		}
+		existing, err := r.client.GetResources(ctx, network.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list resources in network: %w", err)
+		}
+		sortResources(existing)
+		for _, resource := range existing {
+			if r.desired[resource.Name] || r.matched[resource.ID] || r.held[resource.Name] || !cleanupConfig.inScope(resource.Name) {
+				continue
 			}
-		} else {
-			summary.ResourcesToCreate++
+			summary.add(ResourceSummary{
+				Name:          resource.Name,
+				Action:        "delete",
+				ID:            resource.ID,
+				Address:       resource.Address.Value,
+				RemoteNetwork: networkName,
+			})
 		}
 	}
 
 	return summary, nil
 }
 
+// summarizeMapping previews the sync of one mapping into network, which
+// is nil if it does not exist yet.
+func (r *ResourceSyncer) summarizeMapping(ctx context.Context, mapping ResourceMapping, network *RemoteNetwork, networkName string) ResourceSummary {
+	item := ResourceSummary{
+		Name:          mapping.Name,
+		Action:        "create",
+		Address:       mapping.Address,
+		RemoteNetwork: networkName,
+	}
+	if network == nil {
+		return item
+	}
+
+	existing, rule, err := r.matchResource(ctx, mapping, network.ID)
+	var conflict *MatchConflictError
+	if errors.As(err, &conflict) {
+		item.Action = "conflict"
+		return item
+	}
+	var groupIDs []string
+	if err == nil {
+		groupIDs, err = r.resolveGroups(ctx, mapping.Groups)
+	}
+	if err != nil {
+		r.logger.Warn("Failed to check existing resource during summary",
+			zap.String("name", mapping.Name),
+			zap.Error(err))
+		item.Action = "unknown"
+		return item
+	}
+	if existing == nil {
+		return r.summarizeCreate(ctx, item, mapping, groupIDs)
+	}
+	if rule == MatchIdentity && existing.Name != mapping.Name {
+		item.Action = "rename"
+	}
+
+	item.ID = existing.ID
+	update := r.planUpdate(existing, mapping, groupIDs, true)
+	item.Changes = update.changes()
+	if update.send {
+		item.inputs = update.hash
+	}
+
+	switch {
+	case item.Action == "rename":
+	case len(item.Changes) > 0:
+		item.Action = "update"
+	default:
+		item.Action = "unchanged"
+	}
+	return item
+}
+
+// summarizeCreate previews the creation of the resource for mapping,
+// listing the access, tags and protocols it is created with as changes.
+func (r *ResourceSyncer) summarizeCreate(ctx context.Context, item ResourceSummary, mapping ResourceMapping, groupIDs []string) ResourceSummary {
+	createGroupIDs, policyID, err := r.withDefaultAccess(ctx, groupIDs, mapping.SecurityPolicy)
+	if err != nil {
+		r.logger.Warn("Failed to resolve default access during summary",
+			zap.String("name", mapping.Name),
+			zap.Error(err))
+		item.Action = "unknown"
+		return item
+	}
+	tags, protocols := r.sentInputs(mapping.Labels, mapping.Protocols)
+	if len(createGroupIDs) > 0 {
+		item.Changes = append(item.Changes, FieldGroups)
+	}
+	if len(tags) > 0 {
+		item.Changes = append(item.Changes, FieldTags)
+	}
+	if protocols != nil {
+		item.Changes = append(item.Changes, FieldProtocols)
+	}
+	if policyID != "" {
+		item.Changes = append(item.Changes, FieldSecurityPolicy)
+	}
+	item.inputs = inputHash(appliedFromMapping(mapping), createGroupIDs, tags, protocols) + policyID
+	return item
+}
+
+// SyncSummary is a preview of a sync, as returned by GetSyncSummary. The
+// RemoteNetwork fields describe the default remote network.
 type SyncSummary struct {
+	Tenant              string `json:"tenant,omitempty"`
+	Label               string `json:"label,omitempty"`
 	TotalMappings       int    `json:"total_mappings"`
-	RemoteNetworkAction string `json:"remote_network_action"` // "create" or "use_existing"
-	RemoteNetworkName   string `json:"remote_network_name"`
+	RemoteNetworkAction string `json:"remote_network_action,omitempty"` // "create" or "use_existing"
+	RemoteNetworkName   string `json:"remote_network_name,omitempty"`
 	RemoteNetworkID     string `json:"remote_network_id,omitempty"`
 	ResourcesToCreate   int    `json:"resources_to_create"`
 	ResourcesToUpdate   int    `json:"resources_to_update"`
+	ResourcesToDelete   int    `json:"resources_to_delete"`
+
+	Networks  []NetworkSummary  `json:"networks"`
+	Resources []ResourceSummary `json:"resources"`
+
+	// Tenants holds the summary of each tenant block.
+	Tenants []*SyncSummary `json:"tenants,omitempty"`
+}
+
+// NetworkSummary is the planned action for a remote network.
+type NetworkSummary struct {
+	Name   string `json:"name"`
+	ID     string `json:"id,omitempty"`
+	Action string `json:"action"` // "create" or "use_existing"
+}
+
+// ResourceSummary is the planned action for a resource: "create",
+// "update", "rename", "unchanged" or "delete", "conflict" if its name and
+// alias match different resources, or "unknown" if its lookup failed.
+// Changes lists the fields an update would change.
+type ResourceSummary struct {
+	Name          string   `json:"name"`
+	Action        string   `json:"action"`
+	ID            string   `json:"id,omitempty"`
+	Address       string   `json:"address"`
+	RemoteNetwork string   `json:"remote_network"`
+	Changes       []string `json:"changes,omitempty"`
+
+	// inputs is a hash of the values the change applies, such as the
+	// groups granted, so a plan whose values change gets a new ID.
+	inputs string
+
+	// Access lists who has access to an existing resource, with
+	// access_listing enabled.
+	Access []AccessPrincipal `json:"access,omitempty"`
+}
+
+func (s *SyncSummary) add(item ResourceSummary) {
+	switch item.Action {
+	case "create":
+		s.ResourcesToCreate++
+	case "update", "rename":
+		s.ResourcesToUpdate++
+	case "delete":
+		s.ResourcesToDelete++
+	}
+	s.Resources = append(s.Resources, item)
 }
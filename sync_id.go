@@ -0,0 +1,50 @@
+package twingate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+)
+
+// Each sync run, and each retry of a failed resource, gets a sync ID
+// carried in its context. Log lines, events, sync reports and exemplars
+// of the API metrics of the run include it, so the output of overlapping
+// runs can be told apart.
+
+type syncIDKey struct{}
+
+// newSyncID returns a random 16-character hex ID.
+func newSyncID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// withSyncID returns a context carrying a new sync ID.
+func withSyncID(ctx context.Context) context.Context {
+	return context.WithValue(ctx, syncIDKey{}, newSyncID())
+}
+
+// syncIDFrom returns the sync ID of ctx, or "" outside a sync run.
+func syncIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(syncIDKey{}).(string)
+	return id
+}
+
+// log returns the app's logger with the sync ID of ctx, if any.
+func (t *TwingateApp) log(ctx context.Context) *zap.Logger {
+	if id := syncIDFrom(ctx); id != "" {
+		return t.logger.With(zap.String("sync_id", id))
+	}
+	return t.logger
+}
+
+// log returns the client's logger with the sync ID of ctx, if any.
+func (c *TwingateClient) log(ctx context.Context) *zap.Logger {
+	if id := syncIDFrom(ctx); id != "" {
+		return c.logger.With(zap.String("sync_id", id))
+	}
+	return c.logger
+}
@@ -0,0 +1,66 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSyncIDOnLogLines(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	app := &TwingateApp{
+		api:    &MockTwingateClient{},
+		logger: zap.New(core),
+	}
+
+	ctx := withSyncID(context.Background())
+	id := syncIDFrom(ctx)
+	if len(id) != 16 {
+		t.Fatalf("unexpected sync ID %q", id)
+	}
+	if other := syncIDFrom(withSyncID(context.Background())); other == id {
+		t.Error("each sync should get its own ID")
+	}
+
+	syncer := app.newSyncer(ctx)
+	if err := syncer.SyncResources(ctx, []ResourceMapping{{Name: "app.example.com", Address: "10.0.0.1"}}, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	app.recordAPIStats(ctx, APIStats{Queries: 1})
+
+	if logs.Len() == 0 {
+		t.Fatal("expected log lines")
+	}
+	for _, entry := range logs.All() {
+		if got := entry.ContextMap()["sync_id"]; got != id {
+			t.Errorf("log line %q has sync_id %v, want %s", entry.Message, got, id)
+		}
+	}
+
+	if app.log(context.Background()) != app.logger {
+		t.Error("outside a sync the app logger should be used as is")
+	}
+}
+
+func TestSyncIDOnRetries(t *testing.T) {
+	initMetrics()
+	core, logs := observer.New(zapcore.InfoLevel)
+	app := &TwingateApp{
+		api:     &MockTwingateClient{},
+		logger:  zap.New(core),
+		retries: newRetryQueue(nil),
+	}
+	entry, _ := app.retries.fail(ResourceMapping{Name: "api.example.com", Address: "10.0.0.1"}, "net1", errors.New("timeout"))
+
+	if err := app.retryOne(context.Background(), entry); err != nil {
+		t.Fatalf("retryOne() failed: %v", err)
+	}
+	recovered := logs.FilterMessage("Retry of failed resource succeeded").All()
+	if len(recovered) != 1 || recovered[0].ContextMap()["sync_id"] == nil {
+		t.Errorf("a retry should log with its own sync ID: %+v", recovered)
+	}
+}
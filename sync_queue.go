@@ -0,0 +1,198 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// syncQueue runs an app's syncs one at a time. A sync requested while
+// another runs is queued, and requests made while one is queued join it,
+// so a burst of triggers during a long sync leads to a single follow-up
+// run instead of a line of syncs each waiting on syncMutex.
+type syncQueue struct {
+	mu sync.Mutex
+
+	// current is the running sync and queued the one to run after it.
+	current *queuedSync
+	queued  *queuedSync
+
+	// coalesced counts the requests that joined a queued sync.
+	coalesced int
+
+	// spawn starts a queued sync as a background task of the app, under
+	// the context of its run. Without it, queued syncs run in a plain
+	// goroutine.
+	spawn func(name string, fn func(context.Context)) bool
+}
+
+// errSyncQueueStopped fails the syncs queued when the app is not running.
+var errSyncQueueStopped = errors.New("sync queue stopped: the app is not running")
+
+// queuedSync is a sync run shared by the requests that joined it.
+type queuedSync struct {
+	sources []string
+	started time.Time
+
+	// timeout bounds a queued run from when it starts. It is the longest
+	// time any of its requests was willing to wait, zero for no bound.
+	timeout time.Duration
+
+	progress syncProgress
+
+	done chan struct{}
+	err  error
+}
+
+// SyncQueueStatus is the state of the sync queue.
+type SyncQueueStatus struct {
+	Running bool `json:"running"`
+
+	// RunningSince and RunningSources describe the running sync: when it
+	// started and what requested it.
+	RunningSince   *time.Time `json:"running_since,omitempty"`
+	RunningSources []string   `json:"running_sources,omitempty"`
+
+	// LastProgress is when the running sync last made progress, if it
+	// has: an API call returned or the warm-up pacer let it go on.
+	LastProgress *time.Time `json:"last_progress,omitempty"`
+
+	// QueuedSources lists what requested the sync queued to run next.
+	QueuedSources []string `json:"queued_sources,omitempty"`
+
+	// Coalesced counts the requests that joined an already queued sync
+	// instead of running their own.
+	Coalesced int `json:"coalesced"`
+}
+
+// run runs sync for a request from source, or queues it behind the
+// running sync, and waits for the result. A request that joins a queued
+// sync shares its result. A queued sync does not run under the context of
+// any request: giving up through ctx leaves it to run for the others.
+func (q *syncQueue) run(ctx context.Context, source string, sync func(context.Context) error) error {
+	q.mu.Lock()
+	var s *queuedSync
+	switch {
+	case q.current == nil:
+		s = &queuedSync{sources: []string{source}, started: time.Now(), done: make(chan struct{})}
+		q.current = s
+		q.mu.Unlock()
+		// The first request runs the sync itself, and any sync queued
+		// meanwhile in the background.
+		q.execute(ctx, s, sync)
+		return s.err
+
+	case q.queued == nil:
+		s = &queuedSync{sources: []string{source}, timeout: budget(ctx), done: make(chan struct{})}
+		q.queued = s
+
+	default:
+		s = q.queued
+		s.sources = append(s.sources, source)
+		if s.timeout > 0 {
+			if b := budget(ctx); b == 0 || b > s.timeout {
+				s.timeout = b
+			}
+		}
+		q.coalesced++
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// execute runs s under ctx, then starts the sync queued meanwhile, if
+// any. A queued sync that cannot be started fails, and so does the next.
+func (q *syncQueue) execute(ctx context.Context, s *queuedSync, sync func(context.Context) error) {
+	s.err = sync(context.WithValue(ctx, syncProgressKey{}, &s.progress))
+	close(s.done)
+
+	q.mu.Lock()
+	next := q.queued
+	q.queued = nil
+	q.current = next
+	if next != nil {
+		next.started = time.Now()
+	}
+	q.mu.Unlock()
+
+	if next == nil {
+		return
+	}
+	run := func(ctx context.Context) {
+		if next.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, next.timeout)
+			defer cancel()
+		}
+		q.execute(ctx, next, sync)
+	}
+	if q.spawn == nil {
+		go run(context.Background())
+	} else if !q.spawn("queued_sync", run) {
+		q.execute(context.Background(), next, func(context.Context) error {
+			return errSyncQueueStopped
+		})
+	}
+}
+
+// syncProgress records when a running sync last made progress, so a
+// long sync that keeps working is told apart from a hung one.
+type syncProgress struct {
+	last atomic.Int64
+}
+
+type syncProgressKey struct{}
+
+// markProgress records that the sync running with ctx, if any, made
+// progress.
+func markProgress(ctx context.Context) {
+	if p, ok := ctx.Value(syncProgressKey{}).(*syncProgress); ok {
+		p.last.Store(time.Now().UnixNano())
+	}
+}
+
+// budget returns how long ctx leaves to run, or zero when it has no
+// deadline.
+func budget(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	return max(time.Until(deadline), time.Millisecond)
+}
+
+// status returns the state of the queue.
+func (q *syncQueue) status() *SyncQueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := &SyncQueueStatus{Coalesced: q.coalesced}
+	if q.current != nil {
+		started := q.current.started
+		status.Running = true
+		status.RunningSince = &started
+		status.RunningSources = append([]string(nil), q.current.sources...)
+		if last := q.current.progress.last.Load(); last != 0 {
+			progress := time.Unix(0, last)
+			status.LastProgress = &progress
+		}
+	}
+	if q.queued != nil {
+		status.QueuedSources = append([]string(nil), q.queued.sources...)
+	}
+	return status
+}
+
+// requestSync runs a sync through the app's sync queue. Source names what
+// requested it, such as "manual" or "event", for the status endpoint.
+func (t *TwingateApp) requestSync(ctx context.Context, source string) error {
+	return t.syncs.run(ctx, source, t.performSync)
+}
@@ -0,0 +1,181 @@
+package twingate
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSyncQueueCoalesces(t *testing.T) {
+	var q syncQueue
+	var runs atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	syncFn := func(ctx context.Context) error {
+		runs.Add(1)
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	request := func(source string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.run(context.Background(), source, syncFn); err != nil {
+				t.Errorf("run(%s) failed: %v", source, err)
+			}
+		}()
+	}
+
+	request("initial")
+	<-started
+	request("manual")
+	request("event")
+	waitFor(t, func() bool { return len(q.status().QueuedSources) == 2 })
+
+	status := q.status()
+	if !status.Running || !slices.Equal(status.RunningSources, []string{"initial"}) || status.Coalesced != 1 {
+		t.Errorf("unexpected status while running: %+v", status)
+	}
+
+	release <- struct{}{}
+	<-started
+	if status := q.status(); !status.Running || len(status.RunningSources) != 2 || status.QueuedSources != nil {
+		t.Errorf("the queued sync should be running: %+v", status)
+	}
+	release <- struct{}{}
+	wg.Wait()
+
+	if got := runs.Load(); got != 2 {
+		t.Errorf("expected 2 runs for 3 requests, got %d", got)
+	}
+	waitFor(t, func() bool { return !q.status().Running })
+}
+
+func TestSyncQueueWaiterGivesUp(t *testing.T) {
+	var q syncQueue
+	release := make(chan struct{})
+	go q.run(context.Background(), "initial", func(context.Context) error {
+		<-release
+		return nil
+	})
+	waitFor(t, func() bool { return q.status().Running })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.run(ctx, "manual", func(context.Context) error { return nil }); err != context.DeadlineExceeded {
+		t.Errorf("expected the waiter to give up, got %v", err)
+	}
+	close(release)
+}
+
+func TestSyncQueueTracksProgress(t *testing.T) {
+	var q syncQueue
+	progressed, release := make(chan struct{}), make(chan struct{})
+	go q.run(context.Background(), "initial", func(ctx context.Context) error {
+		markProgress(ctx)
+		close(progressed)
+		<-release
+		return nil
+	})
+	<-progressed
+
+	status := q.status()
+	if status.LastProgress == nil || status.LastProgress.Before(*status.RunningSince) {
+		t.Errorf("the running sync's progress should be reported: %+v", status)
+	}
+	close(release)
+	waitFor(t, func() bool { return !q.status().Running })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncQueueQueuedSyncOutlivesFirstWaiter(t *testing.T) {
+	var q syncQueue
+	var tasks taskRegistry
+	tasks.start()
+	defer tasks.shutdown(time.Second)
+	q.spawn = tasks.spawn
+
+	release := make(chan struct{})
+	go q.run(context.Background(), "initial", func(context.Context) error {
+		<-release
+		return nil
+	})
+	waitFor(t, func() bool { return q.status().Running })
+
+	syncFn := func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("the queued sync should run with a timeout")
+		}
+		return ctx.Err()
+	}
+
+	// The first waiter gives up while queued; the sync it queued still
+	// runs for the request that joined it.
+	first, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	firstErr := make(chan error, 1)
+	go func() { firstErr <- q.run(first, "event", syncFn) }()
+	waitFor(t, func() bool { return q.status().QueuedSources != nil })
+
+	secondErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		secondErr <- q.run(ctx, "manual", syncFn)
+	}()
+	waitFor(t, func() bool { return len(q.status().QueuedSources) == 2 })
+
+	if err := <-firstErr; err != context.DeadlineExceeded {
+		t.Errorf("expected the first waiter to give up, got %v", err)
+	}
+	close(release)
+	if err := <-secondErr; err != nil {
+		t.Errorf("the queued sync should succeed for the remaining waiter, got %v", err)
+	}
+}
+
+func TestSyncQueueStoppedFailsQueuedSync(t *testing.T) {
+	var q syncQueue
+	var tasks taskRegistry
+	tasks.start()
+	q.spawn = tasks.spawn
+
+	release := make(chan struct{})
+	go q.run(context.Background(), "initial", func(context.Context) error {
+		<-release
+		return nil
+	})
+	waitFor(t, func() bool { return q.status().Running })
+
+	queued := make(chan error, 1)
+	go func() {
+		queued <- q.run(context.Background(), "manual", func(context.Context) error {
+			t.Error("a queued sync should not run after shutdown")
+			return nil
+		})
+	}()
+	waitFor(t, func() bool { return q.status().QueuedSources != nil })
+
+	tasks.shutdown(time.Second)
+	close(release)
+	if err := <-queued; err != errSyncQueueStopped {
+		t.Errorf("expected the queued sync to fail once stopped, got %v", err)
+	}
+	waitFor(t, func() bool { return !q.status().Running })
+}
@@ -2,99 +2,31 @@ package twingate
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
 
 	"go.uber.org/zap"
 )
 
-// clientInterface defines the subset of TwingateClient methods needed for testing
-type clientInterface interface {
-	GetResources(ctx context.Context, remoteNetworkID string) ([]Resource, error)
-	DeleteResource(ctx context.Context, resourceID string) error
-	GetResourceByAlias(ctx context.Context, alias string, remoteNetworkID string) (*Resource, error)
-	CreateResource(ctx context.Context, input ResourceCreateInput) (*Resource, error)
-	UpdateResource(ctx context.Context, input ResourceUpdateInput) (*Resource, error)
-	GetOrCreateRemoteNetwork(ctx context.Context, name string) (*RemoteNetwork, error)
-}
-
-// testableResourceSyncer wraps ResourceSyncer to allow dependency injection for testing
-type testableResourceSyncer struct {
-	client clientInterface
-	logger *zap.Logger
-}
-
-// deleteStaleResources mirrors the ResourceSyncer implementation but uses the interface
-func (r *testableResourceSyncer) deleteStaleResources(ctx context.Context, desiredMappings []ResourceMapping, networkID string, cleanupConfig *CleanupConfig) (deleted, errors int) {
-	// Get ALL resources in this network (no filtering)
-	existingResources, err := r.client.GetResources(ctx, networkID)
-	if err != nil {
-		r.logger.Error("Failed to list resources in network", zap.Error(err))
-		return 0, 1
-	}
-
-	r.logger.Info("Found existing resources in network",
-		zap.Int("count", len(existingResources)))
-
-	// Build set of desired resource names for quick lookup
-	desiredNames := make(map[string]bool)
-	for _, mapping := range desiredMappings {
-		desiredNames[mapping.Name] = true
-	}
-
-	// Find stale resources (existing but not desired)
-	var staleResources []Resource
-	for _, resource := range existingResources {
-		if !desiredNames[resource.Name] {
-			staleResources = append(staleResources, resource)
-		}
-	}
-
-	if len(staleResources) == 0 {
-		r.logger.Info("No stale resources to delete")
-		return 0, 0
-	}
-
-	r.logger.Info("Found stale resources",
-		zap.Int("count", len(staleResources)),
-		zap.Bool("dry_run", cleanupConfig.DryRun))
-
-	// Delete each stale resource
-	for _, resource := range staleResources {
-		if cleanupConfig.DryRun {
-			r.logger.Info("[DRY RUN] Would delete resource",
-				zap.String("id", resource.ID),
-				zap.String("name", resource.Name),
-				zap.String("address", resource.Address.Value))
-			deleted++
-			continue
-		}
-
-		r.logger.Info("Deleting stale resource",
-			zap.String("id", resource.ID),
-			zap.String("name", resource.Name))
-
-		if err := r.client.DeleteResource(ctx, resource.ID); err != nil {
-			r.logger.Error("Failed to delete resource",
-				zap.String("id", resource.ID),
-				zap.String("name", resource.Name),
-				zap.Error(err))
-			errors++
-		} else {
-			deleted++
-		}
-	}
-
-	return deleted, errors
-}
-
-// MockTwingateClient is a mock implementation of clientInterface for testing
+// MockTwingateClient is a mock implementation of TwingateAPI for testing.
+// twingatetest exports an equivalent mock for use outside this package.
 type MockTwingateClient struct {
-	Resources       map[string]Resource // key is resource ID
+	Resources       map[string]Resource          // key is resource ID
+	Networks        map[string]RemoteNetwork     // key is network name
+	Groups          map[string]string            // group name to ID
+	Grants          map[string][]string          // resource ID to granted group IDs
+	ServiceAccounts map[string][]string          // resource ID to service account IDs with access
+	Tags            map[string]map[string]string // resource ID to tags
 	DeletedIDs      []string
 	GetResourcesErr error
 	DeleteErr       error
+	RevokeErr       error
+	GrantErr        error
 	CallLog         []string // Track method calls for verification
+	nextID          int
 }
 
 // GetResources returns mock resources filtered by network ID
@@ -127,26 +59,198 @@ func (m *MockTwingateClient) DeleteResource(ctx context.Context, resourceID stri
 	return nil
 }
 
-// CreateResource creates a new resource (needed for interface compatibility)
+// GetResourceAccess returns the groups in Grants and the service accounts
+// in ServiceAccounts as principals
+func (m *MockTwingateClient) GetResourceAccess(ctx context.Context, resourceID string) ([]AccessPrincipal, error) {
+	m.CallLog = append(m.CallLog, fmt.Sprintf("GetResourceAccess(%s)", resourceID))
+
+	var principals []AccessPrincipal
+	for _, id := range m.Grants[resourceID] {
+		principals = append(principals, AccessPrincipal{ID: id, Type: "Group"})
+	}
+	for _, id := range m.ServiceAccounts[resourceID] {
+		principals = append(principals, AccessPrincipal{ID: id, Type: "ServiceAccount"})
+	}
+	return principals, nil
+}
+
+// AddResourceAccess adds principals to Grants or ServiceAccounts
+func (m *MockTwingateClient) AddResourceAccess(ctx context.Context, resourceID string, principals []AccessPrincipal) error {
+	m.CallLog = append(m.CallLog, fmt.Sprintf("AddResourceAccess(%s)", resourceID))
+
+	if m.GrantErr != nil {
+		return m.GrantErr
+	}
+	for _, principal := range principals {
+		if principal.Type == "ServiceAccount" {
+			if m.ServiceAccounts == nil {
+				m.ServiceAccounts = make(map[string][]string)
+			}
+			m.ServiceAccounts[resourceID] = append(m.ServiceAccounts[resourceID], principal.ID)
+			continue
+		}
+		m.grant(resourceID, []string{principal.ID})
+	}
+	return nil
+}
+
+// RemoveResourceAccess removes principals from Grants
+func (m *MockTwingateClient) RemoveResourceAccess(ctx context.Context, resourceID string, principalIDs []string) error {
+	m.CallLog = append(m.CallLog, fmt.Sprintf("RemoveResourceAccess(%s)", resourceID))
+
+	if m.RevokeErr != nil {
+		return m.RevokeErr
+	}
+	revoked := func(id string) bool {
+		return slices.Contains(principalIDs, id)
+	}
+	if len(m.Grants[resourceID]) > 0 {
+		m.Grants[resourceID] = slices.DeleteFunc(m.Grants[resourceID], revoked)
+	}
+	if len(m.ServiceAccounts[resourceID]) > 0 {
+		m.ServiceAccounts[resourceID] = slices.DeleteFunc(m.ServiceAccounts[resourceID], revoked)
+	}
+	return nil
+}
+
+// CreateResource stores a new resource with a generated ID
 func (m *MockTwingateClient) CreateResource(ctx context.Context, input ResourceCreateInput) (*Resource, error) {
-	return nil, nil
+	m.CallLog = append(m.CallLog, fmt.Sprintf("CreateResource(%s)", input.Name))
+
+	if m.Resources == nil {
+		m.Resources = make(map[string]Resource)
+	}
+	m.nextID++
+	res := newTestResource(fmt.Sprintf("new%d", m.nextID), input.Name, input.Address, input.RemoteNetworkID)
+	if input.Alias != "" {
+		res.Alias = &input.Alias
+	}
+	m.Resources[res.ID] = res
+	m.grant(res.ID, input.GroupIDs)
+	m.tag(res.ID, input.Tags)
+	return &res, nil
+}
+
+func (m *MockTwingateClient) grant(resourceID string, groupIDs []string) {
+	if len(groupIDs) == 0 {
+		return
+	}
+	if m.Grants == nil {
+		m.Grants = make(map[string][]string)
+	}
+	m.Grants[resourceID] = append(m.Grants[resourceID], groupIDs...)
 }
 
-// UpdateResource updates a resource (needed for interface compatibility)
+// UpdateResource applies the non-nil fields of input to a stored resource;
+// an empty alias removes it
 func (m *MockTwingateClient) UpdateResource(ctx context.Context, input ResourceUpdateInput) (*Resource, error) {
-	return nil, nil
+	m.CallLog = append(m.CallLog, fmt.Sprintf("UpdateResource(%s)", input.ID))
+
+	res, ok := m.Resources[input.ID]
+	if !ok {
+		return nil, fmt.Errorf("resource %s not found", input.ID)
+	}
+	if input.Name != nil {
+		res.Name = *input.Name
+	}
+	if input.Address != nil {
+		res.Address.Value = *input.Address
+	}
+	if input.Alias != nil {
+		res.Alias = input.Alias
+		if *input.Alias == "" {
+			res.Alias = nil
+		}
+	}
+	m.Resources[input.ID] = res
+	m.grant(input.ID, input.AddedGroupIDs)
+	m.tag(input.ID, input.Tags)
+	return &res, nil
+}
+
+// tag replaces a resource's tags when tags is non-nil
+func (m *MockTwingateClient) tag(resourceID string, tags map[string]string) {
+	if tags == nil {
+		return
+	}
+	if m.Tags == nil {
+		m.Tags = make(map[string]map[string]string)
+	}
+	m.Tags[resourceID] = tags
 }
 
-// GetResourceByAlias finds a resource by alias (needed for interface compatibility)
+// GetResourceByAlias finds a resource by alias within a network, or in any
+// network when remoteNetworkID is empty
 func (m *MockTwingateClient) GetResourceByAlias(ctx context.Context, alias string, remoteNetworkID string) (*Resource, error) {
+	for _, r := range m.Resources {
+		if (remoteNetworkID == "" || r.RemoteNetwork.ID == remoteNetworkID) && r.Alias != nil && *r.Alias == alias {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetResource finds a resource by ID
+func (m *MockTwingateClient) GetResource(ctx context.Context, resourceID string) (*Resource, error) {
+	m.CallLog = append(m.CallLog, fmt.Sprintf("GetResource(%s)", resourceID))
+
+	if r, ok := m.Resources[resourceID]; ok {
+		return &r, nil
+	}
+	return nil, nil
+}
+
+// GetResourceByName finds a resource by name within a network
+func (m *MockTwingateClient) GetResourceByName(ctx context.Context, name string, remoteNetworkID string) (*Resource, error) {
+	for _, r := range m.Resources {
+		if r.RemoteNetwork.ID == remoteNetworkID && r.Name == name {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetRemoteNetworkByName returns a network from the Networks map
+func (m *MockTwingateClient) GetRemoteNetworkByName(ctx context.Context, name string) (*RemoteNetwork, error) {
+	if network, ok := m.Networks[name]; ok {
+		return &network, nil
+	}
 	return nil, nil
 }
 
-// GetOrCreateRemoteNetwork gets or creates a remote network (needed for interface compatibility)
+// GetOrCreateRemoteNetwork returns a network from the Networks map, creating it if needed
 func (m *MockTwingateClient) GetOrCreateRemoteNetwork(ctx context.Context, name string) (*RemoteNetwork, error) {
+	m.CallLog = append(m.CallLog, fmt.Sprintf("GetOrCreateRemoteNetwork(%s)", name))
+
+	if m.Networks == nil {
+		m.Networks = make(map[string]RemoteNetwork)
+	}
+	network, ok := m.Networks[name]
+	if !ok {
+		network = RemoteNetwork{ID: "net-" + name, Name: name}
+		m.Networks[name] = network
+	}
+	return &network, nil
+}
+
+// GetGroupByName returns a group from the Groups map
+func (m *MockTwingateClient) GetGroupByName(ctx context.Context, name string) (*Group, error) {
+	m.CallLog = append(m.CallLog, fmt.Sprintf("GetGroupByName(%s)", name))
+
+	if id, ok := m.Groups[name]; ok {
+		return &Group{ID: id, Name: name}, nil
+	}
 	return nil, nil
 }
 
+// newTestResource builds a Resource without spelling out the anonymous struct fields
+func newTestResource(id, name, address, networkID string) Resource {
+	res := Resource{ID: id, Name: name}
+	res.Address.Value = address
+	res.RemoteNetwork.ID = networkID
+	return res
+}
+
 // TestDeleteStaleResources tests that only stale resources are deleted
 func TestDeleteStaleResources(t *testing.T) {
 	tests := []struct {
@@ -267,7 +371,7 @@ func TestDeleteStaleResources(t *testing.T) {
 
 			// Create syncer with mock client
 			logger := zap.NewNop()
-			syncer := &testableResourceSyncer{
+			syncer := &ResourceSyncer{
 				client: mockClient,
 				logger: logger,
 			}
@@ -359,7 +463,7 @@ func TestDeleteStaleResourcesDryRun(t *testing.T) {
 
 	// Create syncer with mock client
 	logger := zap.NewNop()
-	syncer := &testableResourceSyncer{
+	syncer := &ResourceSyncer{
 		client: mockClient,
 		logger: logger,
 	}
@@ -481,7 +585,7 @@ func TestDeleteStaleResourcesPartialFailure(t *testing.T) {
 
 			// Create syncer with mock client
 			logger := zap.NewNop()
-			syncer := &testableResourceSyncer{
+			syncer := &ResourceSyncer{
 				client: mockClient,
 				logger: logger,
 			}
@@ -538,7 +642,7 @@ func TestDeleteStaleResourcesGetResourcesError(t *testing.T) {
 
 	// Create syncer with mock client
 	logger := zap.NewNop()
-	syncer := &testableResourceSyncer{
+	syncer := &ResourceSyncer{
 		client: mockClient,
 		logger: logger,
 	}
@@ -706,3 +810,711 @@ func TestDeleteStaleResourcesMixedSuccess(t *testing.T) {
 		t.Error("Resource res2 should still exist (deletion failed)")
 	}
 }
+
+func TestSyncResourcesGroupsByNetwork(t *testing.T) {
+	mockClient := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{
+			"Default": {ID: "net1", Name: "Default"},
+			"IoT":     {ID: "net2", Name: "IoT"},
+		},
+		Resources: map[string]Resource{
+			// Lives in IoT and is still desired there
+			"res1": newTestResource("res1", "cam.example.com", "10.0.0.1", "net2"),
+			// Stale in the default network
+			"res2": newTestResource("res2", "old.example.com", "10.0.0.1", "net1"),
+		},
+	}
+
+	syncer := &ResourceSyncer{
+		client: mockClient,
+		logger: zap.NewNop(),
+	}
+
+	mappings := []ResourceMapping{
+		{Name: "api.example.com", Address: "10.0.0.1"},
+		{Name: "cam.example.com", Address: "10.0.0.1", RemoteNetwork: "IoT"},
+	}
+
+	err := syncer.SyncResources(context.Background(), mappings, "Default", &CleanupConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+
+	if _, exists := mockClient.Resources["res1"]; !exists {
+		t.Error("cam.example.com in IoT should not be deleted by the default network's cleanup")
+	}
+	if _, exists := mockClient.Resources["res2"]; exists {
+		t.Error("old.example.com should have been deleted from the default network")
+	}
+
+	var created *Resource
+	for _, res := range mockClient.Resources {
+		if res.Name == "api.example.com" {
+			created = &res
+		}
+	}
+	if created == nil {
+		t.Fatal("api.example.com should have been created")
+	}
+	if created.RemoteNetwork.ID != "net1" {
+		t.Errorf("api.example.com created in %q, want net1", created.RemoteNetwork.ID)
+	}
+}
+
+func TestValidateMapping(t *testing.T) {
+	r := &ResourceSyncer{logger: zap.NewNop()}
+
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{"10.0.0.1", false},
+		{"caddy.internal", false},
+		{"*.dev.example.com", false},
+		{"10.10.0.0/24", false},
+		{"10.10.0.0/33", true},
+		{"fd00::/64", true},
+		{"api.*.example.com", true},
+		{"::1", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		err := r.validateMapping(ResourceMapping{Name: "test", Address: tt.address})
+		if tt.wantErr && err == nil {
+			t.Errorf("validateMapping(%q) should fail", tt.address)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("validateMapping(%q) unexpected error: %v", tt.address, err)
+		}
+	}
+
+	for alias, wantErr := range map[string]bool{"*.lab.example.com": false, "lab.*.example.com": true} {
+		err := r.validateMapping(ResourceMapping{Name: "test", Address: "10.0.0.1", Alias: &alias})
+		if (err != nil) != wantErr {
+			t.Errorf("validateMapping(alias %q) error = %v, want error %v", alias, err, wantErr)
+		}
+	}
+}
+
+func TestSyncSingleResourceGrantsGroups(t *testing.T) {
+	mock := &MockTwingateClient{
+		Groups: map[string]string{"Engineering": "g1", "Ops": "g2"},
+	}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop()}
+
+	mapping := ResourceMapping{Name: "lab-net", Address: "10.10.0.0/24", Groups: []string{"Engineering", "Ops"}}
+	for i := 0; i < 2; i++ {
+		if _, err := syncer.syncSingleResource(context.Background(), mapping, "net1"); err != nil {
+			t.Fatalf("syncSingleResource() failed: %v", err)
+		}
+	}
+
+	// The update finds both groups granted and sends nothing
+	if grants := mock.Grants["new1"]; !slices.Equal(grants, []string{"g1", "g2"}) {
+		t.Errorf("expected g1, g2 granted on create only, got %v", grants)
+	}
+	if slices.Contains(mock.CallLog, "UpdateResource(new1)") {
+		t.Errorf("granted groups should not be sent again, got %v", mock.CallLog)
+	}
+
+	// Access removed in the console is granted again, alone
+	mock.Grants["new1"] = []string{"g1"}
+	if _, err := syncer.syncSingleResource(context.Background(), mapping, "net1"); err != nil {
+		t.Fatalf("syncSingleResource() failed: %v", err)
+	}
+	if grants := mock.Grants["new1"]; !slices.Equal(grants, []string{"g1", "g2"}) {
+		t.Errorf("expected g2 granted again, got %v", grants)
+	}
+
+	lookups := 0
+	for _, call := range mock.CallLog {
+		if call == "GetGroupByName(Engineering)" {
+			lookups++
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("expected group lookups to be cached, got %d lookups", lookups)
+	}
+
+	mapping.Groups = []string{"Missing"}
+	if _, err := syncer.syncSingleResource(context.Background(), mapping, "net1"); err == nil {
+		t.Error("expected error for unknown group")
+	}
+}
+
+func TestSyncResourcesSkipsAppliedInputs(t *testing.T) {
+	mock := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Groups:   map[string]string{"Engineering": "g1"},
+	}
+	mappings := []ResourceMapping{{Name: "lab-net", Address: "10.10.0.0/24", Groups: []string{"Engineering"}}}
+
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop()}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	hashes := syncer.Hashes()
+	if hashes["new1"] == "" {
+		t.Fatalf("expected the creation's input hash to be recorded, got %v", hashes)
+	}
+
+	// The next sync knows the inputs were applied and makes no mutation
+	mock.CallLog = nil
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop(), hashes: hashes}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if slices.Contains(mock.CallLog, "UpdateResource(new1)") {
+		t.Errorf("identical inputs should not be applied again, got %v", mock.CallLog)
+	}
+	if got := syncer.Actions()["lab-net"]; got != ActionUnchanged {
+		t.Errorf("action = %q, want %q", got, ActionUnchanged)
+	}
+	if syncer.Hashes()["new1"] != hashes["new1"] {
+		t.Error("skipped update should keep its input hash")
+	}
+
+	// Changed groups are applied
+	mock.Groups["Ops"] = "g2"
+	mappings[0].Groups = []string{"Engineering", "Ops"}
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop(), hashes: hashes}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if !slices.Contains(mock.CallLog, "UpdateResource(new1)") {
+		t.Errorf("changed groups should be applied, got %v", mock.CallLog)
+	}
+	if syncer.Hashes()["new1"] == hashes["new1"] {
+		t.Error("changed inputs should record a new hash")
+	}
+}
+
+func TestSyncResourcesAppliesLabelsAsTags(t *testing.T) {
+	mock := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+	}
+	mappings := []ResourceMapping{{Name: "api", Address: "10.0.0.1", Labels: map[string]string{"team": "platform"}}}
+
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop()}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if got := mock.Tags["new1"]["team"]; got != "platform" {
+		t.Errorf("tags on create = %v, want team=platform", mock.Tags["new1"])
+	}
+
+	// Unchanged labels are not sent again
+	hashes := syncer.Hashes()
+	mock.CallLog = nil
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop(), hashes: hashes}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if slices.Contains(mock.CallLog, "UpdateResource(new1)") {
+		t.Errorf("unchanged labels should not be applied again, got %v", mock.CallLog)
+	}
+
+	// Changed labels replace the tags
+	mappings[0].Labels = map[string]string{"team": "payments"}
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop(), hashes: hashes}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if got := mock.Tags["new1"]["team"]; got != "payments" {
+		t.Errorf("tags after update = %v, want team=payments", mock.Tags["new1"])
+	}
+	applied := syncer.Applied()
+	if !applied["new1"].Tagged {
+		t.Errorf("applied = %+v, want the resource marked tagged", applied["new1"])
+	}
+
+	// Without the tags field managed, labels only apply on create
+	mappings[0].Labels = map[string]string{"team": "search"}
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop(), managedFields: map[string]bool{FieldName: true}}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if got := mock.Tags["new1"]["team"]; got != "payments" {
+		t.Errorf("unmanaged tags were changed to %v", mock.Tags["new1"])
+	}
+
+	// Removing every label clears the tags the plugin applied, once
+	mappings[0].Labels = nil
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop(), hashes: hashes, applied: applied}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if tags, ok := mock.Tags["new1"]; !ok || len(tags) != 0 {
+		t.Errorf("tags after removing the labels = %v, want none", tags)
+	}
+	mock.CallLog = nil
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop(), hashes: syncer.Hashes(), applied: syncer.Applied()}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if slices.Contains(mock.CallLog, "UpdateResource(new1)") {
+		t.Errorf("cleared tags should not be cleared again, got %v", mock.CallLog)
+	}
+}
+
+func TestInputHashLabels(t *testing.T) {
+	fields := AppliedFields{Name: "api", Address: "10.0.0.1"}
+	if inputHash(fields, nil, nil, nil) != inputHash(fields, nil, map[string]string{}, nil) {
+		t.Error("empty labels should not change the hash")
+	}
+	if inputHash(fields, nil, nil, nil) == inputHash(fields, nil, map[string]string{"team": "platform"}, nil) {
+		t.Error("labels should change the hash")
+	}
+}
+
+func TestSyncResourcesOrder(t *testing.T) {
+	mock := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{
+			"s1": newTestResource("s1", "stale-c.example.com", "10.0.0.1", "net1"),
+			"s2": newTestResource("s2", "stale-a.example.com", "10.0.0.1", "net1"),
+			"s3": newTestResource("s3", "stale-b.example.com", "10.0.0.1", "net1"),
+		},
+	}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop()}
+	mappings := []ResourceMapping{
+		{Name: "c.example.com", Address: "10.0.0.1"},
+		{Name: "a.example.com", Address: "10.0.0.1"},
+		{Name: "b.example.com", Address: "10.0.0.1"},
+	}
+	if err := syncer.SyncResources(context.Background(), mappings, "", &CleanupConfig{Enabled: true}); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+
+	var mutations []string
+	for _, call := range mock.CallLog {
+		if strings.HasPrefix(call, "CreateResource") || strings.HasPrefix(call, "DeleteResource") {
+			mutations = append(mutations, call)
+		}
+	}
+	want := []string{
+		"CreateResource(a.example.com)", "CreateResource(b.example.com)", "CreateResource(c.example.com)",
+		"DeleteResource(s2)", "DeleteResource(s3)", "DeleteResource(s1)",
+	}
+	if !slices.Equal(mutations, want) {
+		t.Errorf("mutations = %v, want %v", mutations, want)
+	}
+	if mappings[0].Name != "c.example.com" {
+		t.Error("SyncResources should not reorder the caller's mappings")
+	}
+}
+
+func TestSyncResourcesAdopt(t *testing.T) {
+	alias := "api.example.com"
+	mappings := []ResourceMapping{
+		{Name: "api.example.com", Alias: &alias, Address: "10.0.0.1"},
+		{Name: "new.example.com", Address: "10.0.0.1"},
+	}
+
+	newMock := func() *MockTwingateClient {
+		return &MockTwingateClient{
+			Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+			Resources: map[string]Resource{
+				// Created by hand in the console, without an alias
+				"manual": newTestResource("manual", "api.example.com", "10.0.0.5", "net1"),
+			},
+		}
+	}
+
+	mock := newMock()
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop(), adopt: true, managed: map[string]bool{}}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+
+	if got := syncer.Actions()["api.example.com"]; got != ActionAdopted {
+		t.Errorf("api.example.com action = %q, want %q", got, ActionAdopted)
+	}
+	if got := syncer.Actions()["new.example.com"]; got != ActionCreated {
+		t.Errorf("new.example.com action = %q, want %q", got, ActionCreated)
+	}
+	if res := mock.Resources["manual"]; res.Address.Value != "10.0.0.1" || res.Alias == nil {
+		t.Errorf("adopted resource should be updated in place, got %+v", res)
+	}
+	if len(mock.Resources) != 2 {
+		t.Errorf("expected no duplicate resource, got %d resources", len(mock.Resources))
+	}
+
+	// Without adopt the aliased mapping does not match the manual resource
+	mock = newMock()
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop()}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if got := syncer.Actions()["api.example.com"]; got != ActionCreated {
+		t.Errorf("without adopt, action = %q, want %q", got, ActionCreated)
+	}
+}
+
+func TestSyncResourcesRenameKeepsResource(t *testing.T) {
+	oldAlias, newAlias := "old.example.com", "new.example.com"
+	identity := "upstream:localhost:9001"
+
+	newMock := func() *MockTwingateClient {
+		old := newTestResource("r1", "old.example.com", "10.0.0.1", "net1")
+		old.Alias = &oldAlias
+		return &MockTwingateClient{
+			Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+			Resources: map[string]Resource{"r1": old},
+		}
+	}
+	cleanup := &CleanupConfig{Enabled: true}
+
+	mock := newMock()
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop(), identities: map[string]string{identity: "r1"}}
+	mappings := []ResourceMapping{
+		{Name: "new.example.com", Alias: &newAlias, Address: "10.0.0.1", Identity: identity},
+	}
+	if err := syncer.SyncResources(context.Background(), mappings, "", cleanup); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+
+	if got := syncer.Actions()["new.example.com"]; got != ActionRenamed {
+		t.Errorf("action = %q, want %q", got, ActionRenamed)
+	}
+	res, ok := mock.Resources["r1"]
+	if !ok || res.Name != "new.example.com" || res.Alias == nil || *res.Alias != newAlias {
+		t.Errorf("expected r1 to be renamed in place, got %+v", mock.Resources)
+	}
+	if len(mock.Resources) != 1 || len(mock.DeletedIDs) != 0 {
+		t.Errorf("rename should neither create nor delete, got %v deleted %v", mock.Resources, mock.DeletedIDs)
+	}
+	if got := syncer.Identities()[identity]; got != "r1" {
+		t.Errorf("Identities()[%q] = %q, want r1", identity, got)
+	}
+
+	// The old name is still wanted by another mapping, so the renamed
+	// host gets a resource of its own.
+	mock = newMock()
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop(), identities: map[string]string{identity: "r1"}}
+	mappings = append(mappings, ResourceMapping{Name: "old.example.com", Alias: &oldAlias, Address: "10.0.0.1"})
+	if err := syncer.SyncResources(context.Background(), mappings, "", cleanup); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if got := syncer.Actions()["new.example.com"]; got != ActionCreated {
+		t.Errorf("action = %q, want %q", got, ActionCreated)
+	}
+	if mock.Resources["r1"].Name != "old.example.com" {
+		t.Errorf("r1 should keep its name, got %+v", mock.Resources["r1"])
+	}
+}
+
+func TestSyncResourcesRewrittenAlias(t *testing.T) {
+	hostAlias, rewritten, previous := "app.example.com", "app.internal.corp", "app.old.corp"
+
+	// Created before the rewrite, so the resource carries the host alias
+	existing := newTestResource("r1", "app.example.com", "10.0.0.1", "net1")
+	existing.Alias = &hostAlias
+	mock := &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{"r1": existing},
+	}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop()}
+	mappings := []ResourceMapping{
+		{Name: "app.example.com", Alias: &rewritten, OriginalAlias: hostAlias, Address: "10.0.0.1"},
+	}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if got := syncer.Actions()["app.example.com"]; got != ActionUpdated {
+		t.Errorf("action = %q, want %q", got, ActionUpdated)
+	}
+	if res := mock.Resources["r1"]; len(mock.Resources) != 1 || res.Alias == nil || *res.Alias != rewritten {
+		t.Errorf("expected r1 to get the rewritten alias, got %+v", mock.Resources)
+	}
+
+	// A changed rewrite is matched through the mapping's identity
+	identity := "upstream:localhost:9001"
+	existing.Alias = &previous
+	mock = &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{"r1": existing},
+	}
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop(), identities: map[string]string{identity: "r1"}}
+	mappings[0].Identity = identity
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if got := syncer.Actions()["app.example.com"]; got != ActionUpdated {
+		t.Errorf("action = %q, want %q", got, ActionUpdated)
+	}
+	if res := mock.Resources["r1"]; len(mock.Resources) != 1 || res.Alias == nil || *res.Alias != rewritten {
+		t.Errorf("expected r1 to get the rewritten alias, got %+v", mock.Resources)
+	}
+}
+
+func TestSyncResourcesAliasConflict(t *testing.T) {
+	alias := "app.example.com"
+	other := newTestResource("r9", "legacy-app", "10.9.9.9", "net2")
+	other.Alias = &alias
+	mock := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{
+			"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"},
+			"Legacy":        {ID: "net2", Name: "Legacy"},
+		},
+		Resources: map[string]Resource{"r9": other},
+	}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop()}
+	mappings := []ResourceMapping{{Name: "app.example.com", Alias: &alias, Address: "10.0.0.1"}}
+
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err == nil {
+		t.Fatal("expected an alias conflict")
+	}
+	failed := syncer.FailedMappings()
+	if len(failed) != 1 {
+		t.Fatalf("expected 1 failed mapping, got %d", len(failed))
+	}
+	err := failed[0].Err
+	if !errors.Is(err, ErrDuplicateAlias) {
+		t.Errorf("errors.Is(err, ErrDuplicateAlias) = false for %v", err)
+	}
+	var conflict *AliasConflictError
+	if !errors.As(err, &conflict) || conflict.ResourceID != "r9" || conflict.RemoteNetworkID != "net2" {
+		t.Errorf("expected conflict with r9 in net2, got %v", err)
+	}
+	for _, call := range mock.CallLog {
+		if strings.HasPrefix(call, "CreateResource") {
+			t.Errorf("resource should not be created, got %s", call)
+		}
+	}
+}
+
+func TestSyncResourcesFindsResourceByID(t *testing.T) {
+	// The alias was cleared in the console
+	existing := newTestResource("r1", "app.example.com", "10.0.0.1", "net1")
+	mock := &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{"r1": existing},
+	}
+	alias := "app.example.com"
+	mappings := []ResourceMapping{{Name: "app.example.com", Alias: &alias, Address: "10.0.0.1"}}
+
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop(), ids: map[string]string{"app.example.com": "r1"}}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if got := syncer.Actions()["app.example.com"]; got != ActionUpdated {
+		t.Errorf("action = %q, want %q", got, ActionUpdated)
+	}
+	if res := mock.Resources["r1"]; len(mock.Resources) != 1 || res.Alias == nil || *res.Alias != alias {
+		t.Errorf("expected r1 to get its alias back without a duplicate, got %+v", mock.Resources)
+	}
+	if slices.Contains(mock.CallLog, "GetResources(net1)") {
+		t.Errorf("ID lookup should not list the network, got %v", mock.CallLog)
+	}
+
+	// A resource that is gone falls back to the alias lookup
+	delete(mock.Resources, "r1")
+	syncer = &ResourceSyncer{client: mock, logger: zap.NewNop(), ids: map[string]string{"app.example.com": "r1"}}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if got := syncer.Actions()["app.example.com"]; got != ActionCreated {
+		t.Errorf("action = %q, want %q", got, ActionCreated)
+	}
+}
+
+func TestSyncResourcesListsNetworkOnceForIdentities(t *testing.T) {
+	mock := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{
+			"r1": newTestResource("r1", "old-a.example.com", "10.0.0.1", "net1"),
+			"r2": newTestResource("r2", "old-b.example.com", "10.0.0.2", "net1"),
+		},
+	}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop(), identities: map[string]string{
+		"upstream:localhost:9001": "r1",
+		"upstream:localhost:9002": "r2",
+	}}
+	mappings := []ResourceMapping{
+		{Name: "a.example.com", Address: "10.0.0.1", Identity: "upstream:localhost:9001"},
+		{Name: "b.example.com", Address: "10.0.0.2", Identity: "upstream:localhost:9002"},
+	}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+
+	var listings int
+	for _, call := range mock.CallLog {
+		if call == "GetResources(net1)" {
+			listings++
+		}
+	}
+	if listings != 1 {
+		t.Errorf("expected the network to be listed once, got %d listings: %v", listings, mock.CallLog)
+	}
+	if mock.Resources["r1"].Name != "a.example.com" || mock.Resources["r2"].Name != "b.example.com" {
+		t.Errorf("expected both resources renamed in place, got %+v", mock.Resources)
+	}
+}
+
+func TestSyncResourcesAmbiguousIdentity(t *testing.T) {
+	identity := "upstream:localhost:9001"
+	mock := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{
+			"r1": newTestResource("r1", "old.example.com", "10.0.0.1", "net1"),
+		},
+	}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop(), identities: map[string]string{identity: "r1"}}
+
+	mappings := []ResourceMapping{
+		{Name: "a.example.com", Address: "10.0.0.1", Identity: identity},
+		{Name: "b.example.com", Address: "10.0.0.1", Identity: identity},
+	}
+	if err := syncer.SyncResources(context.Background(), mappings, "", nil); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+
+	for _, name := range []string{"a.example.com", "b.example.com"} {
+		if got := syncer.Actions()[name]; got != ActionCreated {
+			t.Errorf("%s action = %q, want %q", name, got, ActionCreated)
+		}
+	}
+	if mock.Resources["r1"].Name != "old.example.com" {
+		t.Errorf("shared identity should not rename r1, got %+v", mock.Resources["r1"])
+	}
+	if len(syncer.Identities()) != 0 {
+		t.Errorf("shared identity should not be recorded, got %v", syncer.Identities())
+	}
+}
+
+func TestUpdateExistingResourceManagedFields(t *testing.T) {
+	consoleAlias := "internal.example.com"
+	existing := newTestResource("r1", "api.example.com", "10.0.0.5", "net1")
+	existing.Alias = &consoleAlias
+
+	mock := &MockTwingateClient{Resources: map[string]Resource{"r1": existing}}
+	syncer := &ResourceSyncer{
+		client:        mock,
+		logger:        zap.NewNop(),
+		managedFields: map[string]bool{FieldName: true, FieldAddress: true},
+	}
+
+	mapping := ResourceMapping{Name: "api.example.com", Address: "10.0.0.1"}
+	if _, err := syncer.updateExistingResource(context.Background(), mapping, &existing, []string{"g1"}); err != nil {
+		t.Fatalf("updateExistingResource() failed: %v", err)
+	}
+
+	res := mock.Resources["r1"]
+	if res.Address.Value != "10.0.0.1" {
+		t.Errorf("address = %q, want 10.0.0.1", res.Address.Value)
+	}
+	if res.Alias == nil || *res.Alias != consoleAlias {
+		t.Errorf("unmanaged alias should be kept, got %v", res.Alias)
+	}
+	if len(mock.Grants["r1"]) != 0 {
+		t.Errorf("unmanaged groups should not be granted, got %v", mock.Grants["r1"])
+	}
+
+	// Nothing the plugin manages differs, so no update is sent
+	mock.CallLog = nil
+	if _, err := syncer.updateExistingResource(context.Background(), mapping, &res, nil); err != nil {
+		t.Fatalf("updateExistingResource() failed: %v", err)
+	}
+	if len(mock.CallLog) != 0 {
+		t.Errorf("expected no API calls, got %v", mock.CallLog)
+	}
+}
+
+func TestSyncResourcesKeepsMatchedResourceUnderOtherName(t *testing.T) {
+	alias := "api.example.com"
+	existing := newTestResource("r1", "API (console)", "10.0.0.1", "net1")
+	existing.Alias = &alias
+	mock := &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{"r1": existing},
+	}
+	syncer := &ResourceSyncer{
+		client:        mock,
+		logger:        zap.NewNop(),
+		managedFields: map[string]bool{FieldAddress: true},
+	}
+
+	mappings := []ResourceMapping{{Name: "api.example.com", Address: "10.0.0.2", Alias: &alias}}
+	if err := syncer.SyncResources(context.Background(), mappings, "", &CleanupConfig{Enabled: true}); err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+	if len(mock.DeletedIDs) != 0 {
+		t.Fatalf("the resource matched by alias should not be deleted as stale: %v", mock.CallLog)
+	}
+	if res := mock.Resources["r1"]; res.Name != "API (console)" || res.Address.Value != "10.0.0.2" {
+		t.Errorf("only the address should be updated, got %+v", res)
+	}
+}
+
+func TestGetSyncSummary(t *testing.T) {
+	alias := "api.example.com"
+	api := newTestResource("r1", "api.example.com", "10.0.0.1", "net1")
+	api.Alias = &alias
+	mock := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{
+			"r1": api,
+			"r2": newTestResource("r2", "web.example.com", "10.0.0.9", "net1"),
+			"r3": newTestResource("r3", "old.example.com", "10.0.0.1", "net1"),
+		},
+	}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop()}
+
+	mappings := []ResourceMapping{
+		{Name: "api.example.com", Alias: &alias, Address: "10.0.0.1"},
+		{Name: "web.example.com", Address: "10.0.0.1"},
+		{Name: "new.example.com", Address: "10.0.0.1"},
+		{Name: "cam.example.com", Address: "10.0.0.1", RemoteNetwork: "IoT"},
+	}
+	summary, err := syncer.GetSyncSummary(context.Background(), mappings, "", &CleanupConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("GetSyncSummary() failed: %v", err)
+	}
+
+	if summary.ResourcesToCreate != 2 || summary.ResourcesToUpdate != 1 || summary.ResourcesToDelete != 1 {
+		t.Errorf("counts = %d/%d/%d, want 2 create, 1 update, 1 delete",
+			summary.ResourcesToCreate, summary.ResourcesToUpdate, summary.ResourcesToDelete)
+	}
+	if summary.RemoteNetworkAction != "use_existing" || summary.RemoteNetworkID != "net1" {
+		t.Errorf("default network = %s %s, want use_existing net1", summary.RemoteNetworkAction, summary.RemoteNetworkID)
+	}
+
+	actions := make(map[string]ResourceSummary)
+	for _, res := range summary.Resources {
+		actions[res.Name] = res
+	}
+	want := map[string]string{
+		"api.example.com": "unchanged",
+		"web.example.com": "update",
+		"new.example.com": "create",
+		"cam.example.com": "create",
+		"old.example.com": "delete",
+	}
+	for name, action := range want {
+		if got := actions[name].Action; got != action {
+			t.Errorf("%s action = %q, want %q", name, got, action)
+		}
+	}
+	if changes := actions["web.example.com"].Changes; len(changes) != 1 || changes[0] != FieldAddress {
+		t.Errorf("web.example.com changes = %v, want [address]", changes)
+	}
+
+	var iot NetworkSummary
+	for _, network := range summary.Networks {
+		if network.Name == "IoT" {
+			iot = network
+		}
+	}
+	if iot.Action != "create" {
+		t.Errorf("IoT network action = %q, want create", iot.Action)
+	}
+
+	for _, call := range mock.CallLog {
+		if strings.HasPrefix(call, "Create") || strings.HasPrefix(call, "Update") || strings.HasPrefix(call, "Delete") {
+			t.Errorf("summary made a write call: %s", call)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	// ReadyAfterSync holds systemd's READY notification until the first
+	// sync succeeds. This is the default.
+	ReadyAfterSync = "after_sync"
+
+	// ReadyOnLoad lets Caddy report READY once the config loads, even
+	// while the first sync runs in the background.
+	ReadyOnLoad = "load"
+)
+
+const (
+	// defaultReadyTimeout bounds the wait for the first sync before READY.
+	defaultReadyTimeout = 5 * time.Minute
+
+	// defaultStallTimeout is how long a sync may go without progress
+	// before the watchdog considers it hung.
+	defaultStallTimeout = 10 * time.Minute
+)
+
+// SystemdConfig integrates with systemd when Caddy runs as a Type=notify
+// service. Outside systemd, where NOTIFY_SOCKET is unset, it does nothing.
+//
+// Caddy reports READY itself once its config has loaded, which in the
+// default initial_sync provision mode is already after the first sync.
+// With initial_sync start or a warm-up, the first sync runs in Start
+// instead, so READY still waits for it: Caddy reports READY once every app
+// has started, so Start blocks for up to ReadyTimeout, and so do the
+// starts of the apps Caddy starts after this one. When the unit sets
+// WatchdogSec, the app sends WATCHDOG pings for as long as no sync has
+// gone StallTimeout without progress, so systemd restarts a service whose
+// sync hung. A sync makes progress whenever an API call returns or the
+// warm-up pacer lets it go on, so a long warm-up is not taken for a hang.
+type SystemdConfig struct {
+	// Ready is when READY may be reported: after_sync (default) or load.
+	Ready string `json:"ready,omitempty"`
+
+	// ReadyTimeout bounds the wait for the first sync, which blocks
+	// Start. A first sync that fails or times out fails the start.
+	// Defaults to 5m; a warm-up likely needs more.
+	ReadyTimeout caddy.Duration `json:"ready_timeout,omitempty"`
+
+	// DisableWatchdog stops the WATCHDOG pings even if the unit sets
+	// WatchdogSec.
+	DisableWatchdog bool `json:"disable_watchdog,omitempty"`
+
+	// StallTimeout is how long a sync may go without progress before
+	// the pings stop. Defaults to 10m.
+	StallTimeout caddy.Duration `json:"stall_timeout,omitempty"`
+}
+
+func (c *SystemdConfig) validate() error {
+	switch c.Ready {
+	case "", ReadyAfterSync, ReadyOnLoad:
+	default:
+		return fmt.Errorf("systemd: ready must be %q or %q, got: %s", ReadyAfterSync, ReadyOnLoad, c.Ready)
+	}
+	if c.ReadyTimeout < 0 || c.StallTimeout < 0 {
+		return fmt.Errorf("systemd: ready_timeout and stall_timeout cannot be negative")
+	}
+	return nil
+}
+
+func (c *SystemdConfig) readyTimeout() time.Duration {
+	if c.ReadyTimeout > 0 {
+		return time.Duration(c.ReadyTimeout)
+	}
+	return defaultReadyTimeout
+}
+
+func (c *SystemdConfig) stallTimeout() time.Duration {
+	if c.StallTimeout > 0 {
+		return time.Duration(c.StallTimeout)
+	}
+	return defaultStallTimeout
+}
+
+// systemdStarted is set once an app has started in this process. Caddy
+// has reported READY by then, so the starts of reloaded configs need not
+// hold it.
+var systemdStarted atomic.Bool
+
+// holdsReady reports whether Start must run the first sync itself before
+// Caddy reports READY.
+func (t *TwingateApp) holdsReady() bool {
+	return t.Systemd != nil && t.Systemd.Ready != ReadyOnLoad &&
+		os.Getenv("NOTIFY_SOCKET") != "" && !systemdStarted.Load()
+}
+
+// syncBeforeReady runs the first sync, extending systemd's start timeout
+// to cover it. It blocks Start, which is what holds READY, for up to the
+// ready timeout.
+func (t *TwingateApp) syncBeforeReady() error {
+	timeout := t.Systemd.readyTimeout()
+	t.sdNotify(fmt.Sprintf("EXTEND_TIMEOUT_USEC=%d\nSTATUS=Waiting for the first Twingate sync", timeout.Microseconds()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := t.requestSync(ctx, "initial"); err != nil {
+		return fmt.Errorf("initial sync failed before ready: %w", err)
+	}
+	return nil
+}
+
+// notifySyncStatus reports the result of a sync as the service status.
+func (t *TwingateApp) notifySyncStatus(resources int, err error) {
+	if t.Systemd == nil {
+		return
+	}
+	prefix := "Twingate"
+	if t.label != "" {
+		prefix += " " + t.label
+	}
+	if err != nil {
+		t.sdNotify(fmt.Sprintf("STATUS=%s sync failed: %s", prefix, strings.ReplaceAll(err.Error(), "\n", " ")))
+		return
+	}
+	t.sdNotify(fmt.Sprintf("STATUS=%s: %d resources synced", prefix, resources))
+}
+
+// watchdogInterval returns how often to ping systemd's watchdog, half its
+// timeout, or false if the unit has no watchdog for this process.
+func watchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond / 2, true
+}
+
+// runWatchdog pings systemd's watchdog until ctx is done, skipping the
+// pings while a sync of the app or its tenant blocks is stalled.
+func (t *TwingateApp) runWatchdog(ctx context.Context) {
+	interval, ok := watchdogInterval()
+	if !ok {
+		return
+	}
+	t.logger.Info("Pinging systemd watchdog",
+		zap.Duration("interval", interval),
+		zap.Duration("stall_timeout", t.Systemd.stallTimeout()))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stalled := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		label, since := t.stalledSync(time.Now())
+		if since.IsZero() {
+			stalled = false
+			t.sdNotify("WATCHDOG=1")
+			continue
+		}
+		if !stalled {
+			stalled = true
+			t.logger.Error("Sync appears hung, stopping systemd watchdog pings",
+				zap.String("tenant_block", label),
+				zap.Time("last_progress", since))
+		}
+	}
+}
+
+// stalledSync returns the tenant block label of a sync that has gone
+// longer than the stall timeout without progress, and when it last made
+// progress or started, or a zero time if no sync is stalled.
+func (t *TwingateApp) stalledSync(now time.Time) (string, time.Time) {
+	apps := []*TwingateApp{t}
+	for _, label := range t.tenantLabels() {
+		apps = append(apps, t.Tenants[label])
+	}
+	for _, app := range apps {
+		status := app.syncs.status()
+		if status.RunningSince == nil {
+			continue
+		}
+		since := *status.RunningSince
+		if status.LastProgress != nil && status.LastProgress.After(since) {
+			since = *status.LastProgress
+		}
+		if now.Sub(since) > t.Systemd.stallTimeout() {
+			return app.label, since
+		}
+	}
+	return "", time.Time{}
+}
+
+// sdNotify sends state to systemd's notify socket, if there is one.
+func (t *TwingateApp) sdNotify(state string) {
+	if err := sdNotify(state); err != nil {
+		t.logger.Warn("Failed to notify systemd", zap.Error(err))
+	}
+}
+
+// sdNotify sends state to the socket named by NOTIFY_SOCKET. Caddy's
+// notify package covers READY and STATUS but not the watchdog or timeout
+// extensions.
+func sdNotify(state string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
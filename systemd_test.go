@@ -0,0 +1,188 @@
+package twingate
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+// listenNotify listens on a notify socket and points NOTIFY_SOCKET at it.
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+// readNotify returns the next state sent to conn.
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("reading notify socket: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestSdNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("sdNotify() without a socket error = %v", err)
+	}
+
+	conn := listenNotify(t)
+	if err := sdNotify("WATCHDOG=1"); err != nil {
+		t.Fatalf("sdNotify() error = %v", err)
+	}
+	if got := readNotify(t, conn); got != "WATCHDOG=1" {
+		t.Errorf("state = %q", got)
+	}
+
+	app := &TwingateApp{Systemd: &SystemdConfig{}, label: "eu", logger: zap.NewNop()}
+	app.notifySyncStatus(3, nil)
+	if got := readNotify(t, conn); got != "STATUS=Twingate eu: 3 resources synced" {
+		t.Errorf("state = %q", got)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	if _, ok := watchdogInterval(); ok {
+		t.Error("expected no watchdog without WATCHDOG_USEC")
+	}
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if interval, ok := watchdogInterval(); !ok || interval != 15*time.Second {
+		t.Errorf("watchdogInterval() = %v, %v, want half the timeout", interval, ok)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if _, ok := watchdogInterval(); ok {
+		t.Error("expected no watchdog for another process")
+	}
+}
+
+func TestRunWatchdog(t *testing.T) {
+	conn := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	app := &TwingateApp{Systemd: &SystemdConfig{StallTimeout: caddy.Duration(time.Minute)}, logger: zap.NewNop()}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.runWatchdog(ctx)
+		close(done)
+	}()
+	if got := readNotify(t, conn); got != "WATCHDOG=1" {
+		t.Errorf("state = %q", got)
+	}
+	cancel()
+	<-done
+}
+
+func TestStalledSync(t *testing.T) {
+	now := time.Now()
+	tenant := &TwingateApp{label: "eu"}
+	app := &TwingateApp{
+		Systemd: &SystemdConfig{},
+		Tenants: map[string]*TwingateApp{"eu": tenant},
+	}
+	if _, since := app.stalledSync(now); !since.IsZero() {
+		t.Error("expected no stalled sync while idle")
+	}
+
+	tenant.syncs.current = &queuedSync{started: now.Add(-time.Minute)}
+	if _, since := app.stalledSync(now); !since.IsZero() {
+		t.Error("a sync running for a minute is not stalled")
+	}
+
+	tenant.syncs.current.started = now.Add(-defaultStallTimeout - time.Second)
+	if label, since := app.stalledSync(now); label != "eu" || since.IsZero() {
+		t.Errorf("stalledSync() = %q, %v, want the tenant block's sync", label, since)
+	}
+
+	// A long sync that keeps making progress is not stalled
+	tenant.syncs.current.progress.last.Store(now.Add(-time.Minute).UnixNano())
+	if _, since := app.stalledSync(now); !since.IsZero() {
+		t.Error("a sync that made progress a minute ago is not stalled")
+	}
+	tenant.syncs.current.progress.last.Store(now.Add(-defaultStallTimeout - time.Second).UnixNano())
+	if _, since := app.stalledSync(now); since.IsZero() {
+		t.Error("expected a sync without progress for the stall timeout to be stalled")
+	}
+}
+
+func TestHoldsReady(t *testing.T) {
+	app := &TwingateApp{Systemd: &SystemdConfig{}}
+	t.Setenv("NOTIFY_SOCKET", "")
+	if app.holdsReady() {
+		t.Error("expected READY not to be held outside systemd")
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "/run/systemd/notify")
+	if !app.holdsReady() {
+		t.Error("expected READY to be held under systemd")
+	}
+	app.Systemd.Ready = ReadyOnLoad
+	if app.holdsReady() {
+		t.Error("expected ready load not to hold READY")
+	}
+
+	app.Systemd.Ready = ""
+	systemdStarted.Store(true)
+	defer systemdStarted.Store(false)
+	if app.holdsReady() {
+		t.Error("expected reloads not to hold READY")
+	}
+}
+
+func TestUnmarshalCaddyfile_Systemd(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		systemd {
+			ready after_sync
+			ready_timeout 15m
+			stall_timeout 20m
+			watchdog off
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := app.Systemd
+	if cfg == nil || cfg.Ready != ReadyAfterSync || cfg.readyTimeout() != 15*time.Minute || cfg.stallTimeout() != 20*time.Minute || !cfg.DisableWatchdog {
+		t.Errorf("Systemd = %+v", cfg)
+	}
+
+	for _, input := range []string{
+		"systemd on",
+		"systemd {\n\t\t\tready never\n\t\t}",
+		"systemd {\n\t\t\tready_timeout 0s\n\t\t}",
+		"systemd {\n\t\t\twatchdog maybe\n\t\t}",
+		"systemd {\n\t\t\tbogus\n\t\t}",
+	} {
+		app := &TwingateApp{}
+		err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n\t\ttenant acme\n\t\t" + input + "\n\t}"))
+		if err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package twingate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// stopTimeout bounds how long Stop waits for background tasks to return.
+const stopTimeout = 10 * time.Second
+
+// taskRegistry tracks the app's background tasks: the initial sync,
+// event triggered resyncs, the sync trigger and the retry loop. Stop
+// cancels them through the registry's context and waits for them, and
+// the tasks that could not finish are reported so their work can be
+// resumed by the next start.
+type taskRegistry struct {
+	mu          sync.Mutex
+	wg          sync.WaitGroup
+	ctx         context.Context
+	cancel      context.CancelFunc
+	running     map[string]int
+	interrupted []string
+}
+
+// start allows tasks to be added until shutdown.
+func (r *taskRegistry) start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.running = make(map[string]int)
+	r.interrupted = nil
+}
+
+// add registers a task about to run. It returns the context the task must
+// honor and a func to call once the task returns, or false before start
+// and after shutdown.
+func (r *taskRegistry) add(name string) (context.Context, func(), bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ctx == nil || r.ctx.Err() != nil {
+		return nil, nil, false
+	}
+	r.running[name]++
+	r.wg.Add(1)
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			r.mu.Lock()
+			if r.running[name]--; r.running[name] == 0 {
+				delete(r.running, name)
+			}
+			r.mu.Unlock()
+			r.wg.Done()
+		})
+	}
+	return r.ctx, done, true
+}
+
+// spawn runs fn as a registered task in its own goroutine, reporting
+// whether it was started.
+func (r *taskRegistry) spawn(name string, fn func(ctx context.Context)) bool {
+	ctx, done, ok := r.add(name)
+	if !ok {
+		return false
+	}
+	go func() {
+		defer done()
+		fn(ctx)
+	}()
+	return true
+}
+
+// interrupt records that a task was stopped before finishing its work.
+func (r *taskRegistry) interrupt(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interrupted = append(r.interrupted, name)
+}
+
+// shutdown cancels every task and waits up to timeout for them to return.
+// It returns the names of the tasks that were interrupted or were still
+// running at the deadline.
+func (r *taskRegistry) shutdown(timeout time.Duration) []string {
+	r.mu.Lock()
+	if r.cancel == nil {
+		r.mu.Unlock()
+		return nil
+	}
+	r.cancel()
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unfinished := append([]string(nil), r.interrupted...)
+	for name := range r.running {
+		unfinished = append(unfinished, name)
+	}
+	return uniqueSorted(unfinished)
+}
+
+// PendingWork is the background work a stopped instance left unfinished,
+// persisted so the next start can resume it.
+type PendingWork struct {
+	StoppedAt   time.Time    `json:"stopped_at"`
+	Interrupted []string     `json:"interrupted,omitempty"`
+	Retries     []retryEntry `json:"retries,omitempty"`
+}
+
+// resumers maps state keys to the running instance that resumes the work
+// saved under them. On reload the new instance has already started when
+// the old one stops and saves its work, so the save is handed over to it.
+var resumers sync.Map
+
+// savePending persists the tasks interrupted by Stop along with the queued
+// retries, or clears the previously saved work if there is none. Saved
+// work is handed to the instance running in its place, if any. A
+// read_only instance saves nothing, since the state is shared with the
+// instance that writes.
+func (t *TwingateApp) savePending(interrupted []string) {
+	if t.state == nil || t.ReadOnly {
+		return
+	}
+
+	var retries []retryEntry
+	if t.retries != nil {
+		retries = t.retries.snapshot()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	unlock, err := t.state.lock(ctx)
+	if err != nil {
+		t.logger.Warn("Failed to lock Twingate sync state", zap.Error(err))
+		return
+	}
+	defer unlock()
+
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.logger.Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+
+	if len(interrupted) == 0 && len(retries) == 0 {
+		if state.Pending == nil {
+			return
+		}
+		state.Pending = nil
+	} else {
+		state.Pending = &PendingWork{
+			StoppedAt:   time.Now(),
+			Interrupted: interrupted,
+			Retries:     retries,
+		}
+		t.logger.Info("Saving unfinished work for the next start",
+			zap.Strings("interrupted", interrupted),
+			zap.Int("retries", len(retries)))
+	}
+
+	if err := t.state.save(ctx, state); err != nil {
+		t.logger.Warn("Failed to save Twingate sync state", zap.Error(err))
+		return
+	}
+	if state.Pending == nil {
+		return
+	}
+	if next, ok := resumers.Load(t.state.key); ok && next != t {
+		next := next.(*TwingateApp)
+		next.tasks.spawn("resume_pending", next.resumePending)
+	}
+}
+
+// resumePending restores the work a previous instance left unfinished.
+// Queued retries keep their attempt counts and schedule; interrupted syncs
+// need nothing beyond the initial sync, which always runs. The saved work
+// is cleared once restored. A read_only instance leaves it to the instance
+// that writes. It runs at provision and again whenever an instance stopping
+// in this one's place saves its work.
+func (t *TwingateApp) resumePending(ctx context.Context) {
+	if t.state == nil || t.ReadOnly {
+		return
+	}
+
+	unlock, err := t.state.lock(ctx)
+	if err != nil {
+		t.logger.Warn("Failed to lock Twingate sync state", zap.Error(err))
+		return
+	}
+	defer unlock()
+
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.logger.Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+	if state.Pending == nil {
+		return
+	}
+
+	pending := state.Pending
+	t.logger.Info("Resuming work left unfinished by the previous shutdown",
+		zap.Time("stopped_at", pending.StoppedAt),
+		zap.Strings("interrupted", pending.Interrupted),
+		zap.Int("retries", len(pending.Retries)))
+	if t.retries != nil {
+		t.retries.restore(pending.Retries)
+	}
+
+	state.Pending = nil
+	if err := t.state.save(ctx, state); err != nil {
+		t.logger.Warn("Failed to save Twingate sync state", zap.Error(err))
+	}
+}
+
+// restore adds entries saved by a previous instance, keeping any already
+// queued under the same name.
+func (q *retryQueue) restore(entries []retryEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, entry := range entries {
+		if _, ok := q.entries[entry.Mapping.Name]; ok {
+			continue
+		}
+		restored := entry
+		q.entries[entry.Mapping.Name] = &restored
+	}
+	q.updateGauge()
+}
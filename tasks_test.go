@@ -0,0 +1,131 @@
+package twingate
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+)
+
+func TestTaskRegistryShutdown(t *testing.T) {
+	var tasks taskRegistry
+	if tasks.spawn("early", func(context.Context) {}) {
+		t.Fatal("tasks should not start before start()")
+	}
+
+	tasks.start()
+	tasks.spawn("loop", func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	tasks.spawn("sync", func(ctx context.Context) {
+		<-ctx.Done()
+		tasks.interrupt("sync")
+	})
+	stuck := make(chan struct{})
+	defer close(stuck)
+	tasks.spawn("stuck", func(context.Context) {
+		<-stuck
+	})
+
+	unfinished := tasks.shutdown(50 * time.Millisecond)
+	if !slices.Equal(unfinished, []string{"stuck", "sync"}) {
+		t.Errorf("unfinished = %v, want [stuck sync]", unfinished)
+	}
+	if tasks.spawn("late", func(context.Context) {}) {
+		t.Error("tasks should not start after shutdown")
+	}
+}
+
+func TestPendingWorkResumedOnNextStart(t *testing.T) {
+	ctx := context.Background()
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
+
+	stopped := &TwingateApp{
+		logger:  zap.NewNop(),
+		state:   newStateStore(storage, "acme"),
+		retries: newRetryQueue(nil),
+	}
+	stopped.retries.fail(ResourceMapping{Name: "api.example.com", Address: "10.0.0.1"}, "net1", context.DeadlineExceeded)
+	stopped.retries.fail(ResourceMapping{Name: "api.example.com", Address: "10.0.0.1"}, "net1", context.DeadlineExceeded)
+	stopped.savePending([]string{"resync"})
+
+	started := &TwingateApp{
+		logger:  zap.NewNop(),
+		state:   newStateStore(storage, "acme"),
+		retries: newRetryQueue(nil),
+	}
+	started.resumePending(ctx)
+
+	entries := started.retries.snapshot()
+	if len(entries) != 1 || entries[0].Mapping.Name != "api.example.com" || entries[0].Attempts != 2 {
+		t.Errorf("restored retries = %+v, want api.example.com after 2 attempts", entries)
+	}
+
+	state, _ := started.state.load(ctx)
+	if state.Pending != nil {
+		t.Errorf("resumed work should be cleared: %+v", state.Pending)
+	}
+}
+
+func TestPendingWorkHandedToRunningInstance(t *testing.T) {
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
+
+	// On reload the new instance provisions and starts first
+	started := &TwingateApp{
+		logger:  zap.NewNop(),
+		state:   newStateStore(storage, "acme"),
+		retries: newRetryQueue(nil),
+	}
+	started.resumePending(context.Background())
+	started.tasks.start()
+	defer started.tasks.shutdown(time.Second)
+	resumers.Store(started.state.key, started)
+	defer resumers.CompareAndDelete(started.state.key, started)
+
+	stopped := &TwingateApp{
+		logger:  zap.NewNop(),
+		state:   newStateStore(storage, "acme"),
+		retries: newRetryQueue(nil),
+	}
+	stopped.retries.fail(ResourceMapping{Name: "api.example.com", Address: "10.0.0.1"}, "net1", context.DeadlineExceeded)
+	stopped.savePending(nil)
+
+	waitFor(t, func() bool { return len(started.retries.snapshot()) == 1 })
+	waitFor(t, func() bool {
+		state, _ := started.state.load(context.Background())
+		return state.Pending == nil
+	})
+}
+
+func TestPendingWorkLeftByReadOnly(t *testing.T) {
+	ctx := context.Background()
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
+
+	stopped := &TwingateApp{
+		logger:  zap.NewNop(),
+		state:   newStateStore(storage, "acme"),
+		retries: newRetryQueue(nil),
+	}
+	stopped.retries.fail(ResourceMapping{Name: "api.example.com", Address: "10.0.0.1"}, "net1", context.DeadlineExceeded)
+	stopped.savePending(nil)
+
+	readOnly := &TwingateApp{
+		ReadOnly: true,
+		logger:   zap.NewNop(),
+		state:    newStateStore(storage, "acme"),
+		retries:  newRetryQueue(nil),
+	}
+	readOnly.resumePending(ctx)
+	if entries := readOnly.retries.snapshot(); len(entries) != 0 {
+		t.Errorf("a read_only instance should not take over retries: %+v", entries)
+	}
+	readOnly.savePending([]string{"resync"})
+
+	state, _ := readOnly.state.load(ctx)
+	if state.Pending == nil || len(state.Pending.Retries) != 1 || len(state.Pending.Interrupted) != 0 {
+		t.Errorf("the saved work should be left as it was: %+v", state.Pending)
+	}
+}
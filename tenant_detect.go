@@ -0,0 +1,127 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TenantAuto as the tenant detects the tenant at provision time instead of
+// naming it, so one config can be shared by environments with their own
+// API keys.
+const TenantAuto = "auto"
+
+// TenantEnv is the environment variable consulted for the tenant when it is
+// set to auto. It is the variable the Twingate Terraform provider uses.
+const TenantEnv = "TWINGATE_NETWORK"
+
+// tenantLookupTimeout bounds the request to tenant_lookup_url.
+const tenantLookupTimeout = 10 * time.Second
+
+// detectTenant resolves the tenant of an app configured with tenant auto.
+// It takes, in order, the subdomain of a twingate.com api_endpoint, the
+// TWINGATE_NETWORK environment variable, and the tenant reported by
+// tenant_lookup_url for the app's API key.
+func (t *TwingateApp) detectTenant(ctx context.Context) (string, error) {
+	if tenant := tenantFromEndpoint(t.APIEndpoint); tenant != "" {
+		return tenant, nil
+	}
+	if tenant := os.Getenv(TenantEnv); tenant != "" {
+		return tenant, nil
+	}
+	if t.TenantLookupURL == "" {
+		return "", fmt.Errorf("no tenant found: set %s, a twingate.com api_endpoint or tenant_lookup_url", TenantEnv)
+	}
+
+	apiKey := os.Getenv(t.apiKeyEnv())
+	if apiKey == "" {
+		return "", fmt.Errorf("%s environment variable is required", t.apiKeyEnv())
+	}
+	return lookupTenant(t.withEgress(ctx), t.TenantLookupURL, apiKey)
+}
+
+// tenantFromEndpoint returns the tenant of a https://<tenant>.twingate.com
+// endpoint, or "" for other endpoints.
+func tenantFromEndpoint(endpoint string) string {
+	if endpoint == "" {
+		return ""
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	tenant, ok := strings.CutSuffix(strings.ToLower(u.Hostname()), ".twingate.com")
+	if !ok || tenant == "" || strings.Contains(tenant, ".") {
+		return ""
+	}
+	return tenant
+}
+
+// validateLookupURL checks that lookupURL is an https URL, since the API
+// key is sent to it. Plain http is accepted only for loopback hosts.
+func validateLookupURL(lookupURL string) error {
+	if err := validateAPIEndpoint(lookupURL); err != nil {
+		return err
+	}
+	u, _ := url.Parse(lookupURL)
+	if u.Scheme != "https" && !isLoopbackHost(u.Hostname()) {
+		return fmt.Errorf("must be an https URL, as the API key is sent to it, got: %s", lookupURL)
+	}
+	return nil
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP.
+func isLoopbackHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	return strings.EqualFold(host, "localhost")
+}
+
+// lookupTenant asks the account info endpoint at lookupURL which tenant
+// apiKey belongs to. The endpoint receives the key in the X-API-KEY header
+// and answers with a JSON object such as {"tenant": "acme"}.
+func lookupTenant(ctx context.Context, lookupURL, apiKey string) (string, error) {
+	if err := validateLookupURL(lookupURL); err != nil {
+		return "", fmt.Errorf("tenant_lookup_url: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, tenantLookupTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, lookupURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-API-KEY", apiKey)
+	req.Header.Set("Accept", "application/json")
+	identifyRequest(req)
+
+	resp, err := egressHTTPClient(ctx).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("tenant lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("tenant lookup failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var info struct {
+		Tenant string `json:"tenant"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("tenant lookup returned invalid JSON: %w", err)
+	}
+	if info.Tenant == "" || info.Tenant == TenantAuto {
+		return "", fmt.Errorf("tenant lookup returned no tenant")
+	}
+	return info.Tenant, nil
+}
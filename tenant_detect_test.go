@@ -0,0 +1,82 @@
+package twingate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantFromEndpoint(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"":                                       "",
+		"https://acme.twingate.com/api/graphql/": "acme",
+		"https://ACME.twingate.com/api/graphql/": "acme",
+		"https://twingate.com/api/graphql/":      "",
+		"https://a.b.twingate.com/api/graphql/":  "",
+		"http://localhost:8080/graphql":          "",
+	} {
+		if got := tenantFromEndpoint(endpoint); got != want {
+			t.Errorf("tenantFromEndpoint(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
+
+func TestDetectTenant(t *testing.T) {
+	t.Setenv(TenantEnv, "")
+	t.Setenv("TWINGATE_API_KEY", "test-key")
+
+	var gotKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("X-API-KEY")
+		w.Write([]byte(`{"tenant": "looked-up"}`))
+	}))
+	defer srv.Close()
+
+	app := &TwingateApp{Tenant: TenantAuto}
+	if _, err := app.detectTenant(context.Background()); err == nil {
+		t.Error("expected error without any way to detect the tenant")
+	}
+
+	app.TenantLookupURL = srv.URL
+	tenant, err := app.detectTenant(context.Background())
+	if err != nil {
+		t.Fatalf("detectTenant() error = %v", err)
+	}
+	if tenant != "looked-up" || gotKey != "test-key" {
+		t.Errorf("detectTenant() = %q with key %q, want looked-up with test-key", tenant, gotKey)
+	}
+
+	t.Setenv(TenantEnv, "from-env")
+	if tenant, _ := app.detectTenant(context.Background()); tenant != "from-env" {
+		t.Errorf("detectTenant() = %q, want the %s value", tenant, TenantEnv)
+	}
+
+	app.APIEndpoint = "https://from-endpoint.twingate.com/api/graphql/"
+	if tenant, _ := app.detectTenant(context.Background()); tenant != "from-endpoint" {
+		t.Errorf("detectTenant() = %q, want the api_endpoint tenant", tenant)
+	}
+}
+
+func TestLookupTenantErrors(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"status": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "invalid key", http.StatusUnauthorized)
+		},
+		"empty": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{}`))
+		},
+		"invalid json": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`acme`))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			if tenant, err := lookupTenant(context.Background(), srv.URL, "key"); err == nil {
+				t.Errorf("lookupTenant() = %q, want error", tenant)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package twingate
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// DefaultAPIKeyEnv is the environment variable the API key is read from
+// unless api_key_env names another.
+const DefaultAPIKeyEnv = "TWINGATE_API_KEY"
+
+// apiKeyEnv returns the name of the environment variable holding the API key.
+func (t *TwingateApp) apiKeyEnv() string {
+	if t.APIKeyEnv != "" {
+		return t.APIKeyEnv
+	}
+	return DefaultAPIKeyEnv
+}
+
+// tenantLabels returns the labels of the tenant blocks in sorted order.
+func (t *TwingateApp) tenantLabels() []string {
+	labels := make([]string, 0, len(t.Tenants))
+	for label := range t.Tenants {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// provisionTenants provisions each tenant block as an app of its own.
+// Options a block leaves unset are inherited from the top level, except
+// for the API key, cleanup and reporting settings. Hosts claimed by a
+// block with host patterns are excluded from apps without patterns.
+func (t *TwingateApp) provisionTenants(ctx caddy.Context) error {
+	if len(t.Tenants) == 0 {
+		return nil
+	}
+
+	var claimed []string
+	claimed = append(claimed, t.Hosts...)
+	for _, label := range t.tenantLabels() {
+		claimed = append(claimed, t.Tenants[label].Hosts...)
+	}
+	if len(t.Hosts) == 0 {
+		t.excludeHosts = claimed
+	}
+
+	for _, label := range t.tenantLabels() {
+		tenant := t.Tenants[label]
+		tenant.label = label
+		t.inherit(tenant)
+		if len(tenant.Hosts) == 0 {
+			tenant.excludeHosts = claimed
+		}
+
+		if err := tenant.Provision(ctx); err != nil {
+			return fmt.Errorf("tenant block %s: %w", label, err)
+		}
+	}
+	return nil
+}
+
+// inherit copies the top-level settings a tenant block leaves unset.
+func (t *TwingateApp) inherit(tenant *TwingateApp) {
+	if tenant.RemoteNetwork == "" && tenant.RemoteNetworkID == "" {
+		tenant.RemoteNetwork = t.RemoteNetwork
+	}
+	if len(tenant.configuredAddresses()) == 0 && tenant.AddressResolverRaw == nil && tenant.Fleet == nil {
+		tenant.CaddyAddress = t.CaddyAddress
+		tenant.CaddyAddresses = t.CaddyAddresses
+		tenant.AddressResolverRaw = t.AddressResolverRaw
+		tenant.Fleet = t.Fleet
+	}
+	if len(tenant.DiscoverersRaw) == 0 {
+		tenant.DiscoverersRaw = t.DiscoverersRaw
+	}
+	if len(tenant.HooksRaw) == 0 {
+		tenant.HooksRaw = t.HooksRaw
+	}
+	if tenant.AddressMode == "" {
+		tenant.AddressMode = t.AddressMode
+	}
+	if tenant.WildcardHosts == "" && tenant.AddressMode != AddressModeDNSHost {
+		tenant.WildcardHosts = t.WildcardHosts
+	}
+	if !tenant.ErrorRoutes {
+		tenant.ErrorRoutes = t.ErrorRoutes
+	}
+	if tenant.InitialSync == "" {
+		tenant.InitialSync = t.InitialSync
+	}
+	if !tenant.SkipConnectionTest {
+		tenant.SkipConnectionTest = t.SkipConnectionTest
+	}
+	if tenant.CircuitBreaker == nil {
+		tenant.CircuitBreaker = t.CircuitBreaker
+	}
+	if tenant.MatchOn == "" {
+		tenant.MatchOn = t.MatchOn
+	}
+	if tenant.ErrorPolicy == "" {
+		tenant.ErrorPolicy = t.ErrorPolicy
+	}
+	if tenant.RateLimitWarning == "" {
+		tenant.RateLimitWarning = t.RateLimitWarning
+	}
+	if tenant.SyncTrigger == nil {
+		tenant.SyncTrigger = t.SyncTrigger
+	}
+	if tenant.RoutesFrom == nil {
+		tenant.RoutesFrom = t.RoutesFrom
+	}
+	if tenant.Systemd == nil {
+		tenant.Systemd = t.Systemd
+	}
+	if !tenant.ReadOnly {
+		tenant.ReadOnly = t.ReadOnly
+	}
+	if !tenant.ApprovalRequired {
+		tenant.ApprovalRequired = t.ApprovalRequired
+	}
+	if tenant.RestoreAccess == nil {
+		tenant.RestoreAccess = t.RestoreAccess
+	}
+	if tenant.Retry == nil {
+		tenant.Retry = t.Retry
+	}
+	if tenant.Profiles == nil {
+		tenant.Profiles = t.Profiles
+	}
+	if tenant.ChurnLimit == nil {
+		tenant.ChurnLimit = t.ChurnLimit
+	}
+	if tenant.ProxyURL == "" {
+		tenant.ProxyURL = t.ProxyURL
+	}
+	if tenant.TLSClientAuth == nil {
+		tenant.TLSClientAuth = t.TLSClientAuth
+	}
+	if tenant.DefaultAccess == nil {
+		tenant.DefaultAccess = t.DefaultAccess
+	}
+	if tenant.Warmup == nil {
+		tenant.Warmup = t.Warmup
+	}
+	if tenant.AddressCheck == nil {
+		tenant.AddressCheck = t.AddressCheck
+	}
+	if tenant.AliasSuffix == "" && len(tenant.AliasRewrites) == 0 {
+		tenant.AliasSuffix = t.AliasSuffix
+		tenant.AliasRewrites = t.AliasRewrites
+	}
+	if tenant.TenantLookupURL == "" {
+		tenant.TenantLookupURL = t.TenantLookupURL
+	}
+	if tenant.LogLevel == "" {
+		tenant.LogLevel = t.LogLevel
+	}
+	if t.RedactAddresses {
+		tenant.RedactAddresses = true
+	}
+}
+
+// managesHost reports whether host is one of this tenant's hosts: it
+// matches the tenant's host patterns or, without patterns, is not claimed
+// by another tenant.
+func (t *TwingateApp) managesHost(host string) bool {
+	if len(t.Hosts) > 0 {
+		return matchHostPatterns(host, t.Hosts)
+	}
+	return !matchHostPatterns(host, t.excludeHosts)
+}
+
+// filterManagedHosts drops the endpoints of hosts managed by other tenants.
+func (t *TwingateApp) filterManagedHosts(endpoints []Endpoint) []Endpoint {
+	if len(t.Hosts) == 0 && len(t.excludeHosts) == 0 {
+		return endpoints
+	}
+
+	kept := endpoints[:0]
+	for _, ep := range endpoints {
+		if t.managesHost(strings.ToLower(ep.Host)) {
+			kept = append(kept, ep)
+			continue
+		}
+		t.logger.Debug("Skipping host managed by another tenant",
+			zap.String("host", ep.Host))
+	}
+	return kept
+}
+
+// tenantFor returns the app that manages host: this app if it has a tenant
+// and manages host, otherwise the first tenant block that does. It falls
+// back to this app, which then knows of no resource for host.
+func (t *TwingateApp) tenantFor(host string) *TwingateApp {
+	if len(t.Tenants) == 0 {
+		return t
+	}
+
+	host = normalizeHost(host)
+	if t.Tenant != "" && t.managesHost(host) {
+		return t
+	}
+	for _, label := range t.tenantLabels() {
+		if tenant := t.Tenants[label]; tenant.managesHost(host) {
+			return tenant
+		}
+	}
+	return t
+}
+
+// defaultTenant returns this app if it has a tenant, otherwise its first
+// tenant block.
+func (t *TwingateApp) defaultTenant() *TwingateApp {
+	if t.Tenant == "" {
+		if labels := t.tenantLabels(); len(labels) > 0 {
+			return t.Tenants[labels[0]]
+		}
+	}
+	return t
+}
+
+// normalizeHost strips any port from host and lowercases it.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// matchHostPatterns reports whether host matches one of patterns, either
+// exactly or, for patterns starting with *, by suffix.
+func matchHostPatterns(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package twingate
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func newTenantTestApp() *TwingateApp {
+	app := &TwingateApp{
+		Tenant: "main",
+		Tenants: map[string]*TwingateApp{
+			"a": {Tenant: "customer-a", Hosts: []string{"*.customer-a.com"}},
+			"b": {Tenant: "customer-b", Hosts: []string{"app.b.example"}},
+		},
+		logger: zap.NewNop(),
+	}
+	app.excludeHosts = []string{"*.customer-a.com", "app.b.example"}
+	for label, tenant := range app.Tenants {
+		tenant.label = label
+		tenant.logger = zap.NewNop()
+	}
+	return app
+}
+
+func TestTenantFor(t *testing.T) {
+	app := newTenantTestApp()
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"shop.customer-a.com", "customer-a"},
+		{"SHOP.customer-a.com:443", "customer-a"},
+		{"app.b.example", "customer-b"},
+		{"other.b.example", "main"},
+		{"api.example.com", "main"},
+	}
+
+	for _, tt := range tests {
+		if got := app.tenantFor(tt.host).Tenant; got != tt.want {
+			t.Errorf("tenantFor(%q) = %s, want %s", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestLookupResource_TenantBlocks(t *testing.T) {
+	app := newTenantTestApp()
+	app.resources = map[string]Resource{"api.example.com": {ID: "main-1"}}
+	app.Tenants["a"].resources = map[string]Resource{"shop.customer-a.com": {ID: "a-1"}}
+
+	if res, ok := app.LookupResource("shop.customer-a.com"); !ok || res.ID != "a-1" {
+		t.Errorf("expected tenant block a's resource, got %+v, %v", res, ok)
+	}
+	if res, ok := app.LookupResource("api.example.com"); !ok || res.ID != "main-1" {
+		t.Errorf("expected the top-level resource, got %+v, %v", res, ok)
+	}
+}
+
+func TestFilterManagedHosts(t *testing.T) {
+	app := newTenantTestApp()
+	endpoints := []Endpoint{
+		{Host: "api.example.com"},
+		{Host: "shop.customer-a.com"},
+		{Host: "*.customer-a.com"},
+		{Host: "app.b.example"},
+	}
+
+	kept := app.filterManagedHosts(append([]Endpoint(nil), endpoints...))
+	if len(kept) != 1 || kept[0].Host != "api.example.com" {
+		t.Errorf("top-level kept %+v, want only api.example.com", kept)
+	}
+
+	kept = app.Tenants["a"].filterManagedHosts(append([]Endpoint(nil), endpoints...))
+	if len(kept) != 2 {
+		t.Errorf("tenant block a kept %+v, want its 2 hosts", kept)
+	}
+}
+
+func TestInheritTenantSettings(t *testing.T) {
+	parent := &TwingateApp{
+		RemoteNetwork: "Shared",
+		CaddyAddress:  "10.0.0.1",
+		AddressMode:   AddressModeDNSHost,
+		Retry:         &RetryConfig{MaxAttempts: 3},
+		ReportPath:    "/var/log/twingate.json",
+	}
+	tenant := &TwingateApp{RemoteNetwork: "Customer"}
+
+	parent.inherit(tenant)
+
+	if tenant.RemoteNetwork != "Customer" {
+		t.Errorf("RemoteNetwork = %q, want the block's own value", tenant.RemoteNetwork)
+	}
+	if tenant.CaddyAddress != "10.0.0.1" || tenant.AddressMode != AddressModeDNSHost || tenant.Retry != parent.Retry {
+		t.Errorf("expected unset settings to be inherited, got %+v", tenant)
+	}
+	if tenant.ReportPath != "" {
+		t.Errorf("ReportPath should not be inherited, got %q", tenant.ReportPath)
+	}
+}
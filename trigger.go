@@ -0,0 +1,165 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// defaultTriggerPollInterval is how often the trigger file is checked
+// unless configured otherwise.
+const defaultTriggerPollInterval = 5 * time.Second
+
+// SyncTriggerConfig forces a sync from outside the process, for setups
+// where the admin API is not reachable: an OS signal, as in
+// `kill -USR1 <pid>`, or touching a file, as in
+// `touch /var/run/twingate-sync`.
+type SyncTriggerConfig struct {
+	// Signal forces a sync when the process receives it: SIGUSR1 or
+	// SIGUSR2. Not available on Windows.
+	Signal string `json:"signal,omitempty"`
+
+	// File forces a sync whenever its modification time changes. It need
+	// not exist when Caddy starts.
+	File string `json:"file,omitempty"`
+
+	// PollInterval is how often File is checked. Defaults to 5s.
+	PollInterval caddy.Duration `json:"poll_interval,omitempty"`
+}
+
+func (c *SyncTriggerConfig) pollInterval() time.Duration {
+	if c.PollInterval > 0 {
+		return time.Duration(c.PollInterval)
+	}
+	return defaultTriggerPollInterval
+}
+
+func (c *SyncTriggerConfig) validate() error {
+	if c.Signal == "" && c.File == "" {
+		return fmt.Errorf("sync_trigger needs a signal or a file")
+	}
+	if c.Signal != "" {
+		if _, _, err := triggerSignal(c.Signal); err != nil {
+			return fmt.Errorf("sync_trigger: %w", err)
+		}
+	}
+	if c.PollInterval < 0 {
+		return fmt.Errorf("sync_trigger: poll_interval must not be negative")
+	}
+	return nil
+}
+
+// triggerSignal looks up a signal by name, with or without the SIG
+// prefix, and returns it along with its canonical name.
+func triggerSignal(name string) (os.Signal, string, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if len(triggerSignals) == 0 {
+		return nil, "", fmt.Errorf("signals are not supported on this platform; use a trigger file")
+	}
+	sig, ok := triggerSignals[name]
+	if !ok {
+		names := make([]string, 0, len(triggerSignals))
+		for n := range triggerSignals {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return nil, "", fmt.Errorf("unsupported signal %s; use one of: %s", name, strings.Join(names, ", "))
+	}
+	return sig, name, nil
+}
+
+// runSyncTrigger syncs whenever the configured signal arrives or the
+// trigger file is touched, until ctx is done. A trigger arriving during a
+// sync runs one more sync afterwards.
+func (t *TwingateApp) runSyncTrigger(ctx context.Context) {
+	cfg := t.SyncTrigger
+
+	var sigs chan os.Signal
+	var sigName string
+	if cfg.Signal != "" {
+		var sig os.Signal
+		sig, sigName, _ = triggerSignal(cfg.Signal) // checked by Validate
+		sigs = make(chan os.Signal, 1)
+		signal.Notify(sigs, sig)
+		defer signal.Stop(sigs)
+	}
+
+	var poll <-chan time.Time
+	var file *fileTrigger
+	if cfg.File != "" {
+		file = newFileTrigger(cfg.File)
+		ticker := time.NewTicker(cfg.pollInterval())
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigs:
+			t.triggeredSync(ctx, zap.String("signal", sigName))
+		case <-poll:
+			if file.touched() {
+				t.triggeredSync(ctx, zap.String("file", cfg.File))
+			}
+		}
+	}
+}
+
+func (t *TwingateApp) triggeredSync(runCtx context.Context, source zap.Field) {
+	t.logger.Info("Sync triggered", source)
+
+	ctx, cancel := context.WithTimeout(runCtx, 5*time.Minute)
+	defer cancel()
+
+	if err := t.requestSync(ctx, "trigger"); err != nil {
+		if runCtx.Err() != nil {
+			t.tasks.interrupt("sync_trigger")
+		}
+		t.logger.Error("Triggered sync failed", source, zap.Error(err))
+	}
+}
+
+// fileTrigger detects touches of a file through its modification time.
+type fileTrigger struct {
+	path    string
+	modTime time.Time
+}
+
+// newFileTrigger starts watching path. A file left over from before is
+// not a touch.
+func newFileTrigger(path string) *fileTrigger {
+	return &fileTrigger{path: path, modTime: fileModTime(path)}
+}
+
+// touched reports whether the file was created or modified since the
+// last call. Removing it is not a touch.
+func (f *fileTrigger) touched() bool {
+	current := fileModTime(f.path)
+	if current.Equal(f.modTime) {
+		return false
+	}
+	f.modTime = current
+	return !current.IsZero()
+}
+
+// fileModTime returns the modification time of path, or the zero time if
+// it cannot be read.
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
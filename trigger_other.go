@@ -0,0 +1,8 @@
+//go:build !unix
+
+package twingate
+
+import "os"
+
+// triggerSignals is empty where there are no user-defined signals.
+var triggerSignals = map[string]os.Signal{}
@@ -0,0 +1,106 @@
+package twingate
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func TestFileTrigger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "twingate-sync")
+	trigger := newFileTrigger(path)
+
+	if trigger.touched() {
+		t.Error("a missing file should not be a touch")
+	}
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !trigger.touched() {
+		t.Error("creating the file should be a touch")
+	}
+	if trigger.touched() {
+		t.Error("an unchanged file should not be a touch")
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !trigger.touched() {
+		t.Error("a new modification time should be a touch")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if trigger.touched() {
+		t.Error("removing the file should not be a touch")
+	}
+
+	// A file that exists when watching starts is not a touch
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if newFileTrigger(path).touched() {
+		t.Error("a leftover file should not be a touch")
+	}
+}
+
+func TestTriggerSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		if _, _, err := triggerSignal("USR1"); err == nil {
+			t.Error("expected signals to be unsupported on windows")
+		}
+		return
+	}
+
+	for _, name := range []string{"USR1", "usr1", "SIGUSR1"} {
+		_, canonical, err := triggerSignal(name)
+		if err != nil {
+			t.Errorf("triggerSignal(%q) failed: %v", name, err)
+		} else if canonical != "SIGUSR1" {
+			t.Errorf("triggerSignal(%q) name = %s, want SIGUSR1", name, canonical)
+		}
+	}
+	for _, name := range []string{"TERM", "SIGHUP", "bogus"} {
+		if _, _, err := triggerSignal(name); err == nil {
+			t.Errorf("triggerSignal(%q) should fail", name)
+		}
+	}
+}
+
+func TestUnmarshalCaddyfile_SyncTrigger(t *testing.T) {
+	app := &TwingateApp{}
+	err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		sync_trigger {
+			file /var/run/twingate-sync
+			poll_interval 2s
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.SyncTrigger == nil || app.SyncTrigger.File != "/var/run/twingate-sync" || app.SyncTrigger.pollInterval() != 2*time.Second {
+		t.Errorf("SyncTrigger = %+v", app.SyncTrigger)
+	}
+
+	for _, input := range []string{
+		"sync_trigger",
+		"sync_trigger {\n\t\t\tpoll_interval 2s\n\t\t}",
+		"sync_trigger {\n\t\t\tsignal TERM\n\t\t}",
+		"sync_trigger {\n\t\t\tfile\n\t\t}",
+		"sync_trigger {\n\t\t\tfile /tmp/a /tmp/b\n\t\t}",
+	} {
+		app := &TwingateApp{}
+		err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n\t\ttenant acme\n\t\t" + input + "\n\t}"))
+		if err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package twingate
+
+import (
+	"os"
+	"syscall"
+)
+
+// triggerSignals are the signals sync_trigger accepts. Caddy only logs
+// these, so handling them does not interfere with its own signals.
+var triggerSignals = map[string]os.Signal{
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
@@ -0,0 +1,319 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ttlReapInterval is how often resources past their ttl are looked for.
+const ttlReapInterval = time.Minute
+
+// runTTLReaper deletes resources past their ttl until ctx is done.
+func (t *TwingateApp) runTTLReaper(ctx context.Context) {
+	ticker := time.NewTicker(ttlReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.reapExpiredTTL(ctx, time.Now())
+		}
+	}
+}
+
+// reapExpiredTTL deletes the managed resources whose ttl has passed by
+// now and records their mappings as expired, so syncs stop recreating
+// them. With approval_required the resources are only recorded, and the
+// next sync plans their deletion.
+func (t *TwingateApp) reapExpiredTTL(ctx context.Context, now time.Time) {
+	if t.state == nil {
+		return
+	}
+	t.syncMutex.Lock()
+	defer t.syncMutex.Unlock()
+
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+
+	// expired maps the IDs of the resources that expired to their names
+	expired := make(map[string]string)
+	for id, managed := range state.Managed {
+		if managed.ExpiresAt == nil || now.Before(*managed.ExpiresAt) {
+			continue
+		}
+		if _, done := state.Expired[managed.Name]; done {
+			continue
+		}
+		if !t.ApprovalRequired && !t.deleteExpired(ctx, id, managed) {
+			continue
+		}
+		expired[id] = managed.Name
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	// Deletions were journaled in the meantime
+	state, err = t.state.load(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+	if state.Expired == nil {
+		state.Expired = make(map[string]time.Time)
+	}
+	for id, name := range expired {
+		state.Expired[name] = now
+		if !t.ApprovalRequired {
+			delete(state.Managed, id)
+		}
+	}
+	if err := t.state.save(ctx, state); err != nil {
+		t.log(ctx).Warn("Failed to save Twingate sync state", zap.Error(err))
+	}
+}
+
+// deleteExpired journals and deletes a resource past its ttl, and reports
+// whether it is gone. The hooks are asked first, as for any deletion, and
+// a rejected resource is kept until the hooks allow it.
+func (t *TwingateApp) deleteExpired(ctx context.Context, id string, managed ManagedResource) bool {
+	logger := t.log(ctx).With(
+		zap.String("name", managed.Name),
+		zap.String("id", id),
+		zap.Time("expires_at", *managed.ExpiresAt))
+
+	resource, err := t.api.GetResource(ctx, id)
+	if err != nil {
+		logger.Error("Failed to look up resource past its ttl", zap.Error(err))
+		return false
+	}
+	if resource != nil {
+		change := PlannedChange{Action: ChangeDelete, ResourceID: id, Name: resource.Name, Current: currentFields(*resource)}
+		if err := t.checkChange(ctx, change); err != nil {
+			logger.Warn("Keeping resource past its ttl rejected by hook", zap.Error(err))
+			return false
+		}
+		if err := t.journalDeletion(ctx, *resource); err != nil {
+			logger.Error("Keeping resource past its ttl that could not be journaled", zap.Error(err))
+			return false
+		}
+		err := t.api.DeleteResource(ctx, id)
+		t.reportChange(ctx, change, err)
+		if err != nil {
+			logger.Error("Failed to delete resource past its ttl", zap.Error(err))
+			return false
+		}
+	}
+
+	logger.Info("Deleted resource past its ttl")
+	delete(t.resources, managed.Name)
+	delete(t.expiries, managed.Name)
+	t.emit(ctx, "twingate_resource_expired", map[string]any{
+		"id":         id,
+		"name":       managed.Name,
+		"expires_at": managed.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+	return true
+}
+
+// expiredManaged returns the managed resources the reaper recorded as
+// expired but left in place, with approval_required, keyed by ID.
+func (t *TwingateApp) expiredManaged(ctx context.Context) (map[string]ManagedResource, error) {
+	expired := make(map[string]ManagedResource)
+	if t.state == nil {
+		return expired, nil
+	}
+	state, err := t.state.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for id, managed := range state.Managed {
+		if _, ok := state.Expired[managed.Name]; ok && managed.ExpiresAt != nil {
+			expired[id] = managed
+		}
+	}
+	return expired, nil
+}
+
+// planExpired adds the deletion of the resources left past their ttl to
+// plan, so they are deleted once it is approved even without cleanup.
+func (t *TwingateApp) planExpired(ctx context.Context, plan *SyncSummary) error {
+	expired, err := t.expiredManaged(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load sync state: %w", err)
+	}
+
+	networks := make(map[string]string)
+	for _, network := range plan.Networks {
+		networks[network.ID] = network.Name
+	}
+	for _, id := range slices.Sorted(maps.Keys(expired)) {
+		if slices.ContainsFunc(plan.Resources, func(item ResourceSummary) bool { return item.ID == id }) {
+			continue
+		}
+		resource, err := t.api.GetResource(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to look up resource past its ttl: %w", err)
+		}
+		if resource == nil {
+			continue
+		}
+		network := networks[resource.RemoteNetwork.ID]
+		if network == "" {
+			network = resource.RemoteNetwork.ID
+		}
+		plan.add(ResourceSummary{
+			Name:          resource.Name,
+			Action:        "delete",
+			ID:            id,
+			Address:       resource.Address.Value,
+			RemoteNetwork: network,
+		})
+	}
+	return nil
+}
+
+// deleteApprovedExpired deletes the resources left past their ttl, whose
+// deletion planExpired added to the plan the sync ran.
+func (t *TwingateApp) deleteApprovedExpired(ctx context.Context) {
+	expired, err := t.expiredManaged(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+
+	var deleted []string
+	for _, id := range slices.Sorted(maps.Keys(expired)) {
+		if t.deleteExpired(ctx, id, expired[id]) {
+			deleted = append(deleted, id)
+		}
+	}
+	if len(deleted) == 0 {
+		return
+	}
+
+	// Deletions were journaled in the meantime
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+	for _, id := range deleted {
+		delete(state.Managed, id)
+	}
+	if err := t.state.save(ctx, state); err != nil {
+		t.log(ctx).Warn("Failed to save Twingate sync state", zap.Error(err))
+	}
+}
+
+// dropExpired removes the mappings whose resource expired from mappings.
+// Expiries of mappings that no longer have a ttl are forgotten, so a site
+// removed and added back, or whose ttl is removed, gets a new resource.
+func (t *TwingateApp) dropExpired(ctx context.Context, mappings []ResourceMapping) []ResourceMapping {
+	if t.state == nil {
+		return mappings
+	}
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to load Twingate sync state", zap.Error(err))
+		return mappings
+	}
+	if len(state.Expired) == 0 {
+		return mappings
+	}
+
+	withTTL := make(map[string]bool)
+	kept := make([]ResourceMapping, 0, len(mappings))
+	for _, m := range mappings {
+		if m.TTL > 0 {
+			withTTL[m.Name] = true
+			if _, ok := state.Expired[m.Name]; ok {
+				t.log(ctx).Debug("Skipping mapping whose resource expired",
+					zap.String("name", m.Name))
+				continue
+			}
+		}
+		kept = append(kept, m)
+	}
+
+	changed := false
+	for name := range state.Expired {
+		if !withTTL[name] {
+			delete(state.Expired, name)
+			changed = true
+		}
+	}
+	if changed && !t.ReadOnly {
+		if err := t.state.save(ctx, state); err != nil {
+			t.log(ctx).Warn("Failed to save Twingate sync state", zap.Error(err))
+		}
+	}
+	return kept
+}
+
+// recordExpiries stores when each resource synced for a mapping with a
+// ttl expires, counted from when the plugin took it over, and clears the
+// expiry of the others.
+func (t *TwingateApp) recordExpiries(ctx context.Context, mappings []ResourceMapping, syncer *ResourceSyncer) {
+	ttls := make(map[string]time.Duration)
+	for _, m := range mappings {
+		if m.TTL > 0 {
+			ttls[m.Name] = m.TTL
+		}
+	}
+	if t.state == nil {
+		return
+	}
+
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.log(ctx).Warn("Failed to load Twingate sync state", zap.Error(err))
+		return
+	}
+
+	synced := syncer.SyncedResources()
+	expiries := make(map[string]time.Time)
+	wanted := make(map[string]time.Time)
+	for name, ttl := range ttls {
+		resource, ok := synced[name]
+		if !ok {
+			continue
+		}
+		if managed, ok := state.Managed[resource.ID]; ok {
+			expiries[name] = managed.Since.Add(ttl)
+			wanted[resource.ID] = expiries[name]
+		}
+	}
+	t.expiries = expiries
+
+	changed := false
+	for id, managed := range state.Managed {
+		expiresAt, ok := wanted[id]
+		switch {
+		case ok && (managed.ExpiresAt == nil || !managed.ExpiresAt.Equal(expiresAt)):
+			managed.ExpiresAt = &expiresAt
+		case !ok && managed.ExpiresAt != nil:
+			managed.ExpiresAt = nil
+		default:
+			continue
+		}
+		state.Managed[id] = managed
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if err := t.state.save(ctx, state); err != nil {
+		t.log(ctx).Warn("Failed to save Twingate sync state", zap.Error(err))
+	}
+}
@@ -0,0 +1,225 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// ttlHandler sets a ttl on the site of sourceCaddyJSON.
+const ttlHandler = `{"handler": "twingate", "ttl": "1h"}`
+
+// newTTLApp returns an app syncing the site of sourceCaddyJSON with a ttl
+// into mock, keeping its sync state.
+func newTTLApp(t *testing.T, mock *MockTwingateClient) *TwingateApp {
+	t.Helper()
+	app := newApprovalApp(t, mock)
+	app.ApprovalRequired = false
+	rewriteSourceConfig(t, app.RoutesFrom.File, ttlHandler)
+	return app
+}
+
+func TestResourceTTL(t *testing.T) {
+	initMetrics()
+	ctx := context.Background()
+
+	mock := &MockTwingateClient{}
+	app := newTTLApp(t, mock)
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	resource, ok := app.resources["app.example.com"]
+	if !ok {
+		t.Fatalf("resource not synced: %v", mock.CallLog)
+	}
+
+	state, err := app.state.load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	managed := state.Managed[resource.ID]
+	if managed.ExpiresAt == nil || !managed.ExpiresAt.Equal(managed.Since.Add(time.Hour)) {
+		t.Fatalf("expiry = %v, want an hour after %v", managed.ExpiresAt, managed.Since)
+	}
+	if status := app.status(); len(status.Resources) != 1 || status.Resources[0].ExpiresAt == nil {
+		t.Errorf("status should show the expiry: %+v", status.Resources)
+	}
+
+	// Nothing is due yet
+	app.reapExpiredTTL(ctx, time.Now().Add(30*time.Minute))
+	if len(mock.DeletedIDs) != 0 {
+		t.Fatalf("resource deleted before its ttl: %v", mock.DeletedIDs)
+	}
+
+	app.reapExpiredTTL(ctx, time.Now().Add(2*time.Hour))
+	if len(mock.DeletedIDs) != 1 || mock.DeletedIDs[0] != resource.ID {
+		t.Fatalf("expired resource should be deleted: %v", mock.CallLog)
+	}
+	if _, ok := app.resources["app.example.com"]; ok {
+		t.Error("expired resource should no longer be listed")
+	}
+	state, err = app.state.load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.Expired["app.example.com"]; !ok || len(state.Deleted) != 1 {
+		t.Errorf("expiry and deletion should be recorded: %+v", state)
+	}
+
+	// The site stays, but its resource is not recreated
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if creates := countCalls(mock, "CreateResource"); creates != 1 {
+		t.Errorf("expired resource recreated: %v", mock.CallLog)
+	}
+
+	// Without its ttl the site gets a resource again
+	rewriteSourceConfig(t, app.RoutesFrom.File, "")
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if creates := countCalls(mock, "CreateResource"); creates != 2 {
+		t.Errorf("resource should be recreated once the ttl is removed: %v", mock.CallLog)
+	}
+	state, err = app.state.load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Expired) != 0 {
+		t.Errorf("expiry should be forgotten: %v", state.Expired)
+	}
+	for id, managed := range state.Managed {
+		if managed.ExpiresAt != nil {
+			t.Errorf("resource %s without a ttl should not expire: %v", id, managed.ExpiresAt)
+		}
+	}
+}
+
+func TestResourceTTL_ApprovalRequired(t *testing.T) {
+	initMetrics()
+
+	for name, cleanup := range map[string]*CleanupConfig{
+		"without cleanup": nil,
+		"with cleanup":    {Enabled: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mock := &MockTwingateClient{}
+			app := newTTLApp(t, mock)
+			// A resource that stays keeps the sync running
+			app.ExtraResources = []ExtraResource{{Name: "lab", Address: "10.1.0.0/16"}}
+			if err := app.requestSync(ctx, "test"); err != nil {
+				t.Fatalf("sync failed: %v", err)
+			}
+			app.ApprovalRequired = true
+			app.ResourceCleanup = cleanup
+
+			// The expired resource is left to an approved sync
+			app.reapExpiredTTL(ctx, time.Now().Add(2*time.Hour))
+			if len(mock.DeletedIDs) != 0 {
+				t.Fatalf("resource deleted without approval: %v", mock.DeletedIDs)
+			}
+			if err := app.requestSync(ctx, "test"); err != nil {
+				t.Fatalf("sync failed: %v", err)
+			}
+			if app.pending == nil || app.pending.Plan.ResourcesToDelete != 1 {
+				t.Fatalf("the deletion should be held for approval: %+v", app.pending)
+			}
+
+			if approved := app.approve(ctx, nil); len(approved) != 1 || !approved[0].Applied {
+				t.Fatalf("unexpected approval: %+v", approved)
+			}
+			if len(mock.DeletedIDs) != 1 || countCalls(mock, "CreateResource") != 2 {
+				t.Errorf("the approved sync should delete the expired resource: %v", mock.CallLog)
+			}
+			state, err := app.state.load(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(state.Managed) != 1 || len(state.Deleted) != 1 {
+				t.Errorf("the deletion should be recorded: %+v", state)
+			}
+
+			// Nothing is left to approve
+			if err := app.requestSync(ctx, "test"); err != nil {
+				t.Fatalf("sync failed: %v", err)
+			}
+			if app.pending != nil {
+				t.Errorf("nothing should be pending: %+v", app.pending)
+			}
+		})
+	}
+}
+
+func TestResourceTTL_Hooks(t *testing.T) {
+	initMetrics()
+	ctx := context.Background()
+
+	mock := &MockTwingateClient{}
+	app := newTTLApp(t, mock)
+	if err := app.requestSync(ctx, "test"); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	resource := app.resources["app.example.com"]
+
+	hook := &recordingHook{Reject: []string{ChangeDelete}}
+	app.hooks = []SyncHook{hook}
+	app.reapExpiredTTL(ctx, time.Now().Add(2*time.Hour))
+	if len(mock.DeletedIDs) != 0 {
+		t.Fatalf("deletion rejected by a hook should not be made: %v", mock.DeletedIDs)
+	}
+	if state, _ := app.state.load(ctx); len(state.Expired) != 0 || len(state.Deleted) != 0 {
+		t.Errorf("a rejected deletion should not be recorded: %+v", state)
+	}
+
+	// Once the hook allows it, the next tick deletes the resource
+	hook.Reject = nil
+	app.reapExpiredTTL(ctx, time.Now().Add(2*time.Hour))
+	if len(mock.DeletedIDs) != 1 || mock.DeletedIDs[0] != resource.ID {
+		t.Fatalf("expired resource should be deleted: %v", mock.CallLog)
+	}
+	want := []string{
+		"before_change:delete:app.example.com",
+		"before_change:delete:app.example.com", "after_change:delete:app.example.com",
+	}
+	if got := hook.stages(); !slices.Equal(got, want) {
+		t.Errorf("hook stages = %v, want %v", got, want)
+	}
+}
+
+func TestSiteConfigUnmarshalCaddyfile_TTL(t *testing.T) {
+	s := &SiteConfig{}
+	err := s.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		ttl 3d
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.TTL != caddy.Duration(72*time.Hour) {
+		t.Errorf("TTL = %v, want 72h", time.Duration(s.TTL))
+	}
+
+	for _, input := range []string{"ttl", "ttl soon", "ttl 0s", "ttl -1h", "ttl 1h 2h"} {
+		err := (&SiteConfig{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser("twingate {\n\t\t" + input + "\n\t}"))
+		if err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestResourceMappingJSON_TTL(t *testing.T) {
+	data, err := json.Marshal(ResourceMapping{Name: "preview.example.com", TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "ttl") {
+		t.Errorf("mappings should not carry the ttl: %s", data)
+	}
+}
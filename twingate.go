@@ -2,17 +2,19 @@ package twingate
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
-	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
-	"github.com/hasura/go-graphql-client"
+	"github.com/caddyserver/caddy/v2/modules/caddyevents"
 	"go.uber.org/zap"
 )
 
@@ -21,24 +23,419 @@ func init() {
 	httpcaddyfile.RegisterGlobalOption("twingate", parseTwingateApp)
 }
 
+const (
+	// InitialSyncProvision runs the first sync inside Provision, so a failed
+	// sync fails the config load. This is the default.
+	InitialSyncProvision = "provision"
+
+	// InitialSyncStart defers the first sync to a background goroutine
+	// launched from Start, so a config POSTed to /load begins serving
+	// without waiting on the Twingate API.
+	InitialSyncStart = "start"
+)
+
+const (
+	// AddressModeIP publishes the Caddy server's IP as each resource's
+	// address, with the host as its alias. This is the default.
+	AddressModeIP = "ip"
+
+	// AddressModeDNSHost publishes the host pattern itself as the resource
+	// address, so wildcard sites such as *.dev.example.com become wildcard
+	// DNS resources that clients resolve through Twingate.
+	AddressModeDNSHost = "dns_host"
+)
+
+const (
+	// WildcardAlias sets a wildcard host itself as the alias of its
+	// resource, which keeps the Caddy server's IP as its address.
+	WildcardAlias = "alias"
+
+	// WildcardAddress publishes a wildcard host as its resource's address,
+	// as address_mode dns_host does for every host.
+	WildcardAddress = "address"
+)
+
 type CleanupConfig struct {
 	Enabled bool `json:"enabled"`
 	DryRun  bool `json:"dry_run,omitempty"`
+
+	// BatchSize deletes stale resources this many at a time, pausing for
+	// BatchPause between batches so a runaway cleanup can be aborted
+	// through the admin API. Zero deletes them all at once.
+	BatchSize  int            `json:"batch_size,omitempty"`
+	BatchPause caddy.Duration `json:"batch_pause,omitempty"`
+
+	// Scope limits stale detection to resources whose names start with a
+	// prefix, given as "prefix:<string>", so cleanup can run in a remote
+	// network shared with resources managed elsewhere. Empty inspects every
+	// resource in the network.
+	Scope string `json:"scope,omitempty"`
+
+	// RevokeAccess removes the access groups and service accounts have to
+	// a stale resource before deleting it, keeping the resource if that
+	// fails. Stale resources with fewer grants are then deleted first.
+	RevokeAccess bool `json:"revoke_access,omitempty"`
+}
+
+// CleanupScopePrefix introduces the name prefix of a cleanup scope.
+const CleanupScopePrefix = "prefix:"
+
+// inScope reports whether cleanup may delete a resource named name.
+func (c *CleanupConfig) inScope(name string) bool {
+	return strings.HasPrefix(name, strings.TrimPrefix(c.Scope, CleanupScopePrefix))
+}
+
+func validateCleanupScope(scope string) error {
+	if scope == "" {
+		return nil
+	}
+	prefix, ok := strings.CutPrefix(scope, CleanupScopePrefix)
+	if !ok || prefix == "" {
+		return fmt.Errorf("scope must be %s<string>, got: %s", CleanupScopePrefix, scope)
+	}
+	return nil
 }
 
 type TwingateApp struct {
 	Tenant          string         `json:"tenant,omitempty"`
 	RemoteNetwork   string         `json:"remote_network,omitempty"`
 	CaddyAddress    string         `json:"caddy_address,omitempty"`
+	CaddyAddresses  []string       `json:"caddy_addresses,omitempty"`
 	ResourceCleanup *CleanupConfig `json:"resource_cleanup,omitempty"`
+	InitialSync     string         `json:"initial_sync,omitempty"`
+	AddressMode     string         `json:"address_mode,omitempty"`
+	Adopt           bool           `json:"adopt,omitempty"`
+	ReportPath      string         `json:"report_path,omitempty"`
+	ReportKeep      int            `json:"report_keep,omitempty"`
+	Retry           *RetryConfig   `json:"retry,omitempty"`
+
+	// WildcardHosts selects how wildcard hosts are registered under
+	// address_mode ip: WildcardAlias or WildcardAddress. By default their
+	// resources get the Caddy address and no alias.
+	WildcardHosts string `json:"wildcard_hosts,omitempty"`
+
+	// ErrorRoutes also discovers hosts from the servers' error routes,
+	// such as maintenance fallbacks in handle_errors. Hosts only found
+	// there are otherwise not published.
+	ErrorRoutes bool `json:"error_routes,omitempty"`
+
+	// CircuitBreaker stops API calls while the Twingate API is down,
+	// probing it at widening intervals. Enabled by default.
+	CircuitBreaker *BreakerConfig `json:"circuit_breaker,omitempty"`
+
+	// RateLimitWarning is the number of API requests left, or the share
+	// of the rate limit such as "10%", at which a warning is logged.
+	// Defaults to 10%.
+	RateLimitWarning string `json:"rate_limit_warning,omitempty"`
+
+	// RestoreAccess gives a resource recreated because its host came back
+	// the access it had when it was deleted. Enabled by default.
+	RestoreAccess *RestoreAccessConfig `json:"restore_access,omitempty"`
+
+	// Profiles are named resource defaults referenced by sites and extra
+	// resources.
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+
+	// DefaultAccess is granted to the resources the plugin creates, only
+	// at creation.
+	DefaultAccess *DefaultAccess `json:"default_access,omitempty"`
+
+	// ChurnLimit holds resources that successive syncs keep creating and
+	// deleting. Off unless set.
+	ChurnLimit *ChurnLimitConfig `json:"churn_limit,omitempty"`
+
+	// TLSClientAuth is the client certificate presented to the API
+	// endpoint, for egress that requires mutual TLS.
+	TLSClientAuth *ClientTLSConfig `json:"tls_client_auth,omitempty"`
+
+	// ProxyURL is the proxy the API client connects through. Without it
+	// the HTTPS_PROXY and HTTP_PROXY environment variables are used.
+	// NO_PROXY applies either way.
+	ProxyURL string `json:"proxy_url,omitempty"`
+
+	// Warmup paces the first sync against a tenant without stored state.
+	Warmup *WarmupConfig `json:"warmup,omitempty"`
+
+	// SecurityPosture looks up after each sync which security policy
+	// applies to each managed resource, shown in /twingate/status.
+	SecurityPosture bool `json:"security_posture,omitempty"`
+
+	// AccessListing reads after each sync which groups and service
+	// accounts have access to each managed resource, shown in
+	// /twingate/status and the sync summary.
+	AccessListing bool `json:"access_listing,omitempty"`
+
+	// AccessCheck flags after each sync the managed resources nobody has
+	// access to, in the sync report and metrics.
+	AccessCheck bool `json:"access_check,omitempty"`
+
+	// AddressCheck checks after each sync that resource addresses reach
+	// Caddy's listeners.
+	AddressCheck *AddressCheckConfig `json:"address_check,omitempty"`
+
+	// AddressResolverRaw selects how the Caddy address is found when
+	// caddy_address is not set. Defaults to the outbound resolver.
+	AddressResolverRaw json.RawMessage `json:"address_resolver,omitempty" caddy:"namespace=twingate.address_resolvers inline_key=resolver"`
+
+	// DiscoverersRaw are modules in the twingate.discoverers namespace
+	// that supply endpoints besides Caddy's own routes.
+	DiscoverersRaw []json.RawMessage `json:"discoverers,omitempty" caddy:"namespace=twingate.discoverers inline_key=discoverer"`
+
+	// HooksRaw are modules in the twingate.hooks namespace called before
+	// and after each sync and around each resource change.
+	HooksRaw []json.RawMessage `json:"hooks,omitempty" caddy:"namespace=twingate.hooks inline_key=hook"`
+
+	ExtraResources []ExtraResource `json:"extra_resources,omitempty"`
+
+	// CatchAll is a resource for the fallback site of a server with a
+	// default_sni or a site matching any host.
+	CatchAll *CatchAll `json:"catch_all,omitempty"`
+
+	HostFeed *HostFeedConfig `json:"host_feed,omitempty"`
+
+	// ResyncOn names Caddy events that trigger a resync when they concern
+	// a host without a managed resource, such as cert_obtained.
+	ResyncOn []string `json:"resync_on,omitempty"`
+
+	// SyncTrigger forces a sync on an OS signal or when a file is
+	// touched, without going through the admin API.
+	SyncTrigger *SyncTriggerConfig `json:"sync_trigger,omitempty"`
+
+	// ManagedFields lists the resource attributes the plugin owns: name,
+	// address, alias and groups. Updates leave the others as they are in
+	// the console. Empty means all of them.
+	ManagedFields []string `json:"managed_fields,omitempty"`
+
+	// AliasSuffix replaces the domain of discovered hosts in resource
+	// aliases, so app.example.com with suffix internal.corp is aliased
+	// app.internal.corp. AliasRewrites take precedence.
+	AliasSuffix string `json:"alias_suffix,omitempty"`
+
+	// AliasRewrites replace domain suffixes of discovered hosts in
+	// resource aliases. The first matching rewrite applies.
+	AliasRewrites []AliasRewrite `json:"alias_rewrite,omitempty"`
+
+	// APICallBudget is the number of API calls a sync may make before a
+	// warning is logged. Zero disables the warning.
+	APICallBudget int `json:"api_call_budget,omitempty"`
+
+	// LogLevel is the minimum level of the module's own log entries:
+	// debug, info, warn or error. It cannot lower the level set by Caddy's
+	// log configuration.
+	LogLevel string `json:"log_level,omitempty"`
+
+	// RedactAddresses replaces resource and Caddy addresses in the
+	// module's log entries.
+	RedactAddresses bool `json:"redact_addresses,omitempty"`
+
+	// UnhealthyAfter is the number of consecutive failed syncs after which
+	// /twingate/healthz reports the app unhealthy. Defaults to 3.
+	UnhealthyAfter int `json:"unhealthy_after,omitempty"`
+
+	// DriftPolicy decides what happens to attributes changed in the
+	// console since the plugin last set them. Defaults to overwrite.
+	DriftPolicy *DriftPolicy `json:"drift_policy,omitempty"`
+
+	// MatchOn selects how mappings are matched to existing resources:
+	// "alias", "name" or "name_or_alias". Defaults to alias.
+	MatchOn string `json:"match_on,omitempty"`
+
+	// ErrorPolicy decides whether a sync in which some resources failed
+	// fails: "fail", "warn" or "threshold:<n>". Defaults to fail.
+	ErrorPolicy string `json:"error_policy,omitempty"`
+
+	// APIEndpoint overrides the GraphQL endpoint derived from Tenant, for
+	// example to point the app at a fake API in integration tests.
+	APIEndpoint string `json:"api_endpoint,omitempty"`
+
+	// TenantLookupURL is an account info endpoint that reports the tenant
+	// of the API key, used when Tenant is auto and the tenant cannot be
+	// found otherwise.
+	TenantLookupURL string `json:"tenant_lookup_url,omitempty"`
+
+	// APIKeyEnv names the environment variable holding the API key.
+	// Defaults to TWINGATE_API_KEY.
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+
+	// Hosts limits the discovered hosts this tenant manages to those
+	// matching these patterns, such as *.customer-a.com.
+	Hosts []string `json:"hosts,omitempty"`
+
+	// Tenants configures additional tenants by label. Each is synced with
+	// its own client, state and sync loop. Without a top-level Tenant the
+	// app only hosts these.
+	Tenants map[string]*TwingateApp `json:"tenants,omitempty"`
+
+	// RemoteNetworkID selects the default remote network by ID instead of
+	// by name, which skips the lookup among all networks and cannot pick
+	// the wrong one of several with the same name. The network must exist;
+	// it is checked with the connection test. Not inherited by tenant
+	// blocks, since IDs belong to one tenant.
+	RemoteNetworkID string `json:"remote_network_id,omitempty"`
+
+	// Fleet publishes the discovered sites on each of several Caddy
+	// nodes, in place of caddy_address.
+	Fleet *FleetConfig `json:"fleet,omitempty"`
+
+	// RoutesFrom discovers the routes of another Caddy's config instead
+	// of this instance's, syncing when they change.
+	RoutesFrom *RoutesSource `json:"routes_from,omitempty"`
+
+	// Systemd holds READY until the first sync and pings systemd's
+	// watchdog while syncs make progress, when Caddy runs under systemd.
+	Systemd *SystemdConfig `json:"systemd,omitempty"`
+
+	// SkipConnectionTest defers the API connection test, and an initial
+	// sync run during provisioning, to Start, so the config can be
+	// provisioned without network access. Provisioning under
+	// `caddy validate` always skips it.
+	SkipConnectionTest bool `json:"skip_connection_test,omitempty"`
+
+	// ReadOnly runs discovery, planning, drift detection, metrics and
+	// reports without ever changing the tenant, for an evaluation or a
+	// second observer instance. Tenant blocks inherit it.
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// ApprovalRequired holds each sync that would change the tenant until
+	// its plan is approved through the admin API. Tenant blocks inherit
+	// it.
+	ApprovalRequired bool `json:"approval_required,omitempty"`
+
+	client     *TwingateClient
+	api        TwingateAPI  // client as used by ResourceSyncer
+	httpClient *http.Client // egress client, see egressClient
+	clientKey  string
+	events     *caddyevents.App
+	retries    *retryQueue
+	state      *stateStore
+	feed       *hostFeed
+	ctx        caddy.Context
+	logger     *zap.Logger
+	tasks      taskRegistry
+	lastSync   time.Time
+	syncMutex  sync.RWMutex
+
+	resyncMu    sync.Mutex
+	resyncTimer *time.Timer
+	resyncDone  func()
+
+	// syncs runs syncs one at a time, coalescing the requests made while
+	// one runs.
+	syncs syncQueue
+
+	// resources indexes the managed resources from the last successful
+	// sync by mapping name. Guarded by syncMutex.
+	resources map[string]Resource
+
+	// cleanup is shared with the syncers so a cleanup in progress can be
+	// aborted.
+	cleanup cleanupControl
+
+	// lastAPIStats counts the API calls of the last sync. Guarded by
+	// syncMutex.
+	lastAPIStats *APIStats
+
+	// lastSyncErr is the error of the last sync attempt, lastDrifts the
+	// drift it found and lastSyncID its sync ID. Guarded by syncMutex.
+	lastSyncErr error
+	lastDrifts  []Drift
+	lastSyncID  string
+
+	// lastPlan is the plan of the last read_only sync. Guarded by
+	// syncMutex.
+	lastPlan *SyncSummary
+
+	// pending is the plan held for approval and approved the ID of the
+	// plan approved to run next. Guarded by syncMutex.
+	pending  *PendingPlan
+	approved string
+
+	// expiries is when the resource of each mapping with a ttl expires,
+	// by mapping name. Guarded by syncMutex.
+	expiries map[string]time.Time
+
+	// posture is the security policy of each managed resource, keyed by
+	// resource ID, as of the last sync. Guarded by syncMutex.
+	posture map[string]ResourcePolicy
+
+	// access lists the principals with access to each managed resource,
+	// keyed by resource ID, as of the last sync. Guarded by syncMutex.
+	access map[string][]AccessPrincipal
+
+	// addressProblems are the resources the last address check flagged.
+	// Guarded by syncMutex.
+	addressProblems []AddressProblem
+
+	// failedSyncs counts the consecutive failed syncs. Guarded by
+	// syncMutex.
+	failedSyncs int
+
+	// syncHealth is the app's health as of its last sync, read by
+	// /twingate/healthz without taking syncMutex.
+	syncHealth atomic.Pointer[Health]
+
+	// discovered is the number of mappings the last discovery found.
+	// Guarded by syncMutex.
+	discovered int
+
+	// untested is the client whose connection test was deferred to Start.
+	untested *pooledClient
+
+	// remoteNetwork is the network configured by RemoteNetworkID, once
+	// resolved.
+	remoteNetwork *RemoteNetwork
+
+	// defaultPolicy is the security policy named by DefaultAccess, once
+	// resolved.
+	defaultPolicy *SecurityPolicy
+
+	// profilePolicies maps the security policies named by Profiles to
+	// their IDs, once resolved.
+	profilePolicies map[string]string
+
+	// flapping names the resources held for flapping as of the last sync.
+	// Guarded by syncMutex.
+	flapping []string
+
+	// warming is set while the initial sync is still to run as a warm-up.
+	// Guarded by syncMutex.
+	warming bool
+
+	// renamed maps original hosts to the sanitized names of their
+	// mappings. Guarded by syncMutex.
+	renamed map[string]string
+
+	// routesDigest is the digest of the routes_from config the last
+	// discovery read, a string.
+	routesDigest atomic.Value
 
-	client    *TwingateClient
-	ctx       caddy.Context
-	logger    *zap.Logger
-	cancel    context.CancelFunc
-	wg        sync.WaitGroup
-	lastSync  time.Time
-	syncMutex sync.RWMutex
+	// label is this app's key in its parent's Tenants, empty for the
+	// top-level app.
+	label string
+
+	// excludeHosts are the host patterns claimed by other tenants.
+	excludeHosts []string
+
+	// resolver, discoverers and hooks are the loaded address_resolver,
+	// discoverer and hook modules.
+	resolver    AddressResolver
+	discoverers []Discoverer
+	hooks       []SyncHook
+}
+
+// activeApp is the most recently started TwingateApp. HTTP handlers and the
+// admin API look it up at request time rather than during Provision, since
+// the twingate app itself provisions the http app that holds the handlers.
+var (
+	activeAppMu sync.RWMutex
+	activeApp   *TwingateApp
+)
+
+// currentApp returns the running TwingateApp, or nil if none is running.
+func currentApp() *TwingateApp {
+	activeAppMu.RLock()
+	defer activeAppMu.RUnlock()
+	return activeApp
 }
 
 func (*TwingateApp) CaddyModule() caddy.ModuleInfo {
@@ -50,52 +447,149 @@ func (*TwingateApp) CaddyModule() caddy.ModuleInfo {
 
 func (t *TwingateApp) Provision(ctx caddy.Context) error {
 	t.ctx = ctx
-	t.logger = ctx.Logger(t)
+	t.logger = t.moduleLogger(ctx.Logger(t))
+	t.syncs.spawn = t.tasks.spawn
+	if t.label != "" {
+		t.logger = t.logger.With(zap.String("tenant_block", t.label))
+	}
 
-	if t.Tenant == "" {
+	if t.Tenant == "" && len(t.Tenants) == 0 {
 		return fmt.Errorf("tenant is required")
 	}
 
-	apiKey := os.Getenv("TWINGATE_API_KEY")
-	if apiKey == "" {
-		return fmt.Errorf("TWINGATE_API_KEY environment variable is required")
+	if err := t.provisionTenants(ctx); err != nil {
+		return err
+	}
+	if t.Tenant == "" {
+		return nil
 	}
 
-	endpoint := fmt.Sprintf("https://%s.twingate.com/api/graphql/", t.Tenant)
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
+	httpClient, err := t.egressClient(ctx)
+	if err != nil {
+		return err
 	}
+	t.httpClient = httpClient
 
-	graphqlClient := graphql.NewClient(endpoint, httpClient).
-		WithRequestModifier(func(r *http.Request) {
-			r.Header.Set("X-API-KEY", apiKey)
-			r.Header.Set("Content-Type", "application/json")
-		})
+	if err := t.sanitizeConfigNames(); err != nil {
+		return err
+	}
 
-	t.client = &TwingateClient{
-		client: graphqlClient,
-		logger: t.logger,
+	if t.AddressResolverRaw != nil {
+		mod, err := ctx.LoadModule(t, "AddressResolverRaw")
+		if err != nil {
+			return fmt.Errorf("loading address resolver: %w", err)
+		}
+		t.resolver = mod.(AddressResolver)
+	}
+	if err := t.loadDiscoverers(ctx); err != nil {
+		return err
+	}
+	if err := t.loadHooks(ctx); err != nil {
+		return err
 	}
 
-	if err := t.client.TestConnection(context.Background()); err != nil {
-		return fmt.Errorf("failed to connect to Twingate API: %w", err)
+	if t.Tenant == TenantAuto && t.deferConnectionTest() {
+		// The tenant lookup is an API round-trip like the connection
+		// test, so Start detects the tenant and sets up the rest.
+		t.logger.Info("Deferring tenant detection to start")
+		if _, err := t.discoverMappings(ctx); err != nil {
+			return fmt.Errorf("initial discovery failed: %w", err)
+		}
+		return nil
+	}
+	return t.provisionTenant(ctx)
+}
+
+// provisionTenant sets up the state, API client and initial sync of the
+// app's tenant, detecting the tenant first under tenant auto.
+func (t *TwingateApp) provisionTenant(ctx caddy.Context) error {
+	if t.Tenant == TenantAuto {
+		tenant, err := t.detectTenant(context.Background())
+		if err != nil {
+			return fmt.Errorf("tenant auto: %w", err)
+		}
+		t.Tenant = tenant
+		t.logger.Info("Detected tenant", zap.String("tenant", tenant))
+	}
+
+	initMetrics()
+	t.retries = newRetryQueue(t.Retry)
+	t.state = newStateStore(ctx.Storage(), t.Tenant)
+	t.resumePending(context.Background())
+	if t.HostFeed != nil {
+		t.feed = feedForTenant(t.Tenant)
+		t.restoreObservedHosts(context.Background())
+	}
+
+	eventsAppIface, err := ctx.App("events")
+	if err != nil {
+		return fmt.Errorf("failed to get events app: %w", err)
+	}
+	t.events = eventsAppIface.(*caddyevents.App)
+
+	if err := t.subscribeResyncEvents(); err != nil {
+		return fmt.Errorf("failed to subscribe to resync events: %w", err)
 	}
 
-	t.logger.Info("Twingate module provisioned successfully",
-		zap.String("tenant", t.Tenant),
-		zap.String("endpoint", endpoint))
+	apiKey := os.Getenv(t.apiKeyEnv())
+	if apiKey == "" {
+		return fmt.Errorf("%s environment variable is required", t.apiKeyEnv())
+	}
 
-	if t.ResourceCleanup != nil && t.ResourceCleanup.Enabled {
+	endpoint := t.apiEndpoint()
+	t.clientKey = clientPoolKey(endpoint, apiKey, t.egressKey())
+	clientOptions := t.clientOptions()
+
+	pooled, err := acquireClient(t.clientKey, t.logger, func(logger *zap.Logger) *TwingateClient {
+		return NewTwingateClient(endpoint, apiKey, append(clientOptions, WithLogger(logger))...)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Twingate client: %w", err)
+	}
+	t.client = pooled.client
+	t.api = pooled.client
+	if t.ReadOnly {
+		t.api = readOnlyAPI{pooled.client}
+	}
+	if t.deferConnectionTest() {
+		// Provision makes no API calls; Start tests the connection.
+		t.logger.Info("Deferring Twingate API connection test to start")
+		t.untested = pooled
+	} else if err := pooled.testConnection(context.Background(), t.ReadOnly); err != nil {
+		return fmt.Errorf("failed to connect to Twingate API: %w", err)
+	} else if err := t.resolveRemoteNetworkID(context.Background()); err != nil {
+		return err
+	}
+
+	if t.ResourceCleanup != nil && t.ResourceCleanup.Enabled && t.ResourceCleanup.Scope != "" {
+		t.logger.Warn("Resource cleanup ENABLED - resources in scope will be managed",
+			zap.Bool("dry_run", t.ResourceCleanup.DryRun),
+			zap.String("remote_network", t.remoteNetworkName()),
+			zap.String("scope", t.ResourceCleanup.Scope),
+			zap.String("warning", "All resources in scope not in Caddyfile will be deleted"))
+	} else if t.ResourceCleanup != nil && t.ResourceCleanup.Enabled {
 		t.logger.Warn("Resource cleanup ENABLED - ALL resources in network will be managed",
 			zap.Bool("dry_run", t.ResourceCleanup.DryRun),
-			zap.String("remote_network", t.RemoteNetwork),
+			zap.String("remote_network", t.remoteNetworkName()),
 			zap.String("warning", "Ensure this is a dedicated remote network - all resources not in Caddyfile will be deleted"))
 	}
 
-	if err := t.performSync(context.Background()); err != nil {
+	// A warm-up can take many minutes, so it always runs in the background.
+	t.warming = t.warmupApplies(context.Background())
+	if t.InitialSync == InitialSyncStart || t.warming || t.untested != nil {
+		// Surface config errors (address resolution, route discovery) now;
+		// only the API round-trips are deferred to Start.
+		mappings, err := t.discoverMappings(ctx)
+		if err != nil {
+			return fmt.Errorf("initial discovery failed: %w", err)
+		}
+		t.discovered = len(mappings)
+	} else if err := t.requestSync(context.Background(), "initial"); err != nil {
 		return fmt.Errorf("initial sync failed: %w", err)
 	}
 
+	t.logCapabilities()
+
 	// NOTE: Config reload handling is automatic via the App lifecycle.
 	// When config is reloaded, Caddy creates a new instance of this app,
 	// calls Provision() (which performs initial sync above), then Start().
@@ -106,26 +600,286 @@ func (t *TwingateApp) Provision(ctx caddy.Context) error {
 }
 
 func (t *TwingateApp) Validate() error {
+	if t.Systemd != nil {
+		if err := t.Systemd.validate(); err != nil {
+			return err
+		}
+	}
+	if t.ReadOnly && t.ApprovalRequired {
+		return fmt.Errorf("read_only and approval_required cannot be combined")
+	}
+	for _, label := range t.tenantLabels() {
+		tenant := t.Tenants[label]
+		if len(tenant.Tenants) > 0 {
+			return fmt.Errorf("tenant block %s: tenant blocks cannot be nested", label)
+		}
+		if err := tenant.Validate(); err != nil {
+			return fmt.Errorf("tenant block %s: %w", label, err)
+		}
+	}
 	if t.Tenant == "" {
+		if len(t.Tenants) > 0 {
+			return nil
+		}
 		return fmt.Errorf("tenant is required")
 	}
-	if os.Getenv("TWINGATE_API_KEY") == "" {
-		return fmt.Errorf("TWINGATE_API_KEY environment variable is required")
+	if len(t.configuredAddresses()) > 0 && t.AddressResolverRaw != nil {
+		return fmt.Errorf("caddy_address and address_resolver cannot both be set")
+	}
+	if t.Fleet != nil {
+		if len(t.configuredAddresses()) > 0 || t.AddressResolverRaw != nil {
+			return fmt.Errorf("nodes cannot be combined with caddy_address or address_resolver")
+		}
+		if t.AddressMode == AddressModeDNSHost {
+			return fmt.Errorf("nodes cannot be used with address_mode %s, which publishes hosts instead of node addresses", AddressModeDNSHost)
+		}
+		if err := t.Fleet.validate(); err != nil {
+			return err
+		}
+	}
+	for _, addr := range t.configuredAddresses() {
+		if err := validateCaddyAddress(addr); err != nil {
+			return fmt.Errorf("caddy_address: %w", err)
+		}
+	}
+	for _, extra := range t.ExtraResources {
+		if err := extra.validate(); err != nil {
+			return fmt.Errorf("extra_resource: %w", err)
+		}
+		if _, ok := t.Profiles[extra.Profile]; extra.Profile != "" && !ok {
+			return fmt.Errorf("extra_resource: %s: unknown profile '%s'", extra.Name, extra.Profile)
+		}
+	}
+	if t.CatchAll != nil {
+		if err := t.CatchAll.validate(); err != nil {
+			return fmt.Errorf("catch_all: %w", err)
+		}
+		if _, ok := t.Profiles[t.CatchAll.Profile]; t.CatchAll.Profile != "" && !ok {
+			return fmt.Errorf("catch_all: unknown profile '%s'", t.CatchAll.Profile)
+		}
+	}
+	if t.SyncTrigger != nil {
+		if err := t.SyncTrigger.validate(); err != nil {
+			return err
+		}
+	}
+	if t.RoutesFrom != nil {
+		if err := t.RoutesFrom.validate(); err != nil {
+			return err
+		}
+	}
+	if t.RemoteNetwork != "" && t.RemoteNetworkID != "" {
+		return fmt.Errorf("remote_network and remote_network_id cannot both be set")
+	}
+	if churn := t.ChurnLimit; churn != nil && (churn.Changes == 1 || churn.Changes < 0 || churn.Window < 0) {
+		return fmt.Errorf("churn_limit needs at least 2 changes and a positive window")
+	}
+	if t.ProxyURL != "" {
+		if err := validateProxyURL(t.ProxyURL); err != nil {
+			return fmt.Errorf("proxy_url: %w", err)
+		}
+	}
+	if t.TLSClientAuth != nil {
+		if err := t.TLSClientAuth.validate(); err != nil {
+			return err
+		}
+	}
+	if access := t.DefaultAccess; access != nil && len(access.Groups) == 0 && access.SecurityPolicy == "" {
+		return fmt.Errorf("default_access needs a group or a security_policy")
+	}
+	switch t.MatchOn {
+	case "", MatchOnAlias, MatchOnName, MatchOnNameOrAlias:
+	default:
+		return fmt.Errorf("match_on must be %q, %q or %q, got: %s", MatchOnAlias, MatchOnName, MatchOnNameOrAlias, t.MatchOn)
+	}
+	if _, err := parseErrorPolicy(t.ErrorPolicy); err != nil {
+		return err
+	}
+	if t.RateLimitWarning != "" {
+		if _, _, err := parseRateLimitWarning(t.RateLimitWarning); err != nil {
+			return fmt.Errorf("rate_limit_warning %w", err)
+		}
+	}
+	if t.AliasSuffix != "" && !isDNSName(t.AliasSuffix) {
+		return fmt.Errorf("alias_suffix '%s' is not a valid DNS name", t.AliasSuffix)
+	}
+	for _, rw := range t.AliasRewrites {
+		if err := rw.validate(); err != nil {
+			return fmt.Errorf("alias_rewrite: %w", err)
+		}
+	}
+	switch t.AddressMode {
+	case "", AddressModeIP, AddressModeDNSHost:
+	default:
+		return fmt.Errorf("address_mode must be %q or %q, got: %s", AddressModeIP, AddressModeDNSHost, t.AddressMode)
+	}
+	switch t.WildcardHosts {
+	case "":
+	case WildcardAlias, WildcardAddress:
+		if t.AddressMode == AddressModeDNSHost {
+			return fmt.Errorf("wildcard_hosts cannot be used with address_mode %s, which already publishes wildcard hosts as addresses", AddressModeDNSHost)
+		}
+	default:
+		return fmt.Errorf("wildcard_hosts must be %q or %q, got: %s", WildcardAlias, WildcardAddress, t.WildcardHosts)
+	}
+	switch t.InitialSync {
+	case "", InitialSyncProvision, InitialSyncStart:
+	default:
+		return fmt.Errorf("initial_sync must be %q or %q, got: %s", InitialSyncProvision, InitialSyncStart, t.InitialSync)
+	}
+	if t.LogLevel != "" {
+		if err := validateLogLevel(t.LogLevel); err != nil {
+			return err
+		}
+	}
+	if t.UnhealthyAfter < 0 {
+		return fmt.Errorf("unhealthy_after cannot be negative")
+	}
+	if err := validateManagedFields(t.ManagedFields); err != nil {
+		return fmt.Errorf("managed_fields: %w", err)
+	}
+	if t.ResourceCleanup != nil {
+		if t.ResourceCleanup.BatchSize < 0 || t.ResourceCleanup.BatchPause < 0 {
+			return fmt.Errorf("resource_cleanup: batch_size and batch_pause cannot be negative")
+		}
+		if err := validateCleanupScope(t.ResourceCleanup.Scope); err != nil {
+			return fmt.Errorf("resource_cleanup: %w", err)
+		}
+	}
+	if err := t.DriftPolicy.validate(); err != nil {
+		return fmt.Errorf("drift_policy: %w", err)
+	}
+	if t.APIEndpoint != "" {
+		if err := validateAPIEndpoint(t.APIEndpoint); err != nil {
+			return fmt.Errorf("api_endpoint: %w", err)
+		}
+	}
+	if t.TenantLookupURL != "" {
+		if err := validateLookupURL(t.TenantLookupURL); err != nil {
+			return fmt.Errorf("tenant_lookup_url: %w", err)
+		}
+	}
+	if os.Getenv(t.apiKeyEnv()) == "" {
+		return fmt.Errorf("%s environment variable is required", t.apiKeyEnv())
 	}
 	return nil
 }
 
+// deferConnectionTest reports whether Provision leaves API calls to Start:
+// under skip_connection_test, and under `caddy validate`, which never
+// starts the config.
+func (t *TwingateApp) deferConnectionTest() bool {
+	return t.SkipConnectionTest || isValidateCommand(os.Args)
+}
+
+// isValidateCommand reports whether args are those of `caddy validate`,
+// which provisions the config without ever starting it.
+func isValidateCommand(args []string) bool {
+	return len(args) > 1 && args[1] == "validate"
+}
+
 func (t *TwingateApp) Start() error {
 	t.logger.Info("Starting Twingate app")
 
-	_, cancel := context.WithCancel(context.Background())
-	t.cancel = cancel
+	t.tasks.start()
 
-	// NOTE: No need to perform sync here - Provision() already performed
-	// the initial sync synchronously. This avoids duplicate resource creation
-	// and ensures proper error handling (Provision fails if sync fails).
-	// Config reloads automatically create a new app instance which will
-	// call Provision() again, triggering a fresh sync.
+	if t.label == "" {
+		activeAppMu.Lock()
+		activeApp = t
+		activeAppMu.Unlock()
+		defer systemdStarted.Store(true)
+	}
+
+	for _, label := range t.tenantLabels() {
+		if err := t.Tenants[label].Start(); err != nil {
+			return fmt.Errorf("tenant block %s: %w", label, err)
+		}
+	}
+	if t.label == "" && t.Systemd != nil && !t.Systemd.DisableWatchdog {
+		t.tasks.spawn("systemd_watchdog", t.runWatchdog)
+	}
+	if t.Tenant == "" {
+		return nil
+	}
+	if t.Tenant == TenantAuto {
+		if err := t.provisionTenant(t.ctx); err != nil {
+			return err
+		}
+	}
+
+	// The client is shared with the running instance on reload, so a config
+	// only applies its breaker and rate limit settings once it starts,
+	// which a config that failed to provision never does.
+	if t.client != nil {
+		t.client.breaker.configure(t.CircuitBreaker)
+		t.client.rateLimit.configure(t.RateLimitWarning)
+	}
+	if t.state != nil && !t.ReadOnly {
+		resumers.Store(t.state.key, t)
+	}
+
+	// NOTE: In the default mode there is no need to perform sync here -
+	// Provision() already performed the initial sync synchronously. This
+	// avoids duplicate resource creation and ensures proper error handling
+	// (Provision fails if sync fails). Config reloads automatically create
+	// a new app instance which will call Provision() again, triggering a
+	// fresh sync.
+	if t.untested != nil {
+		if err := t.untested.testConnection(context.Background(), t.ReadOnly); err != nil {
+			return fmt.Errorf("failed to connect to Twingate API: %w", err)
+		}
+		t.untested = nil
+		if err := t.resolveRemoteNetworkID(context.Background()); err != nil {
+			return err
+		}
+		if t.InitialSync != InitialSyncStart && !t.warming {
+			if err := t.requestSync(context.Background(), "initial"); err != nil {
+				return fmt.Errorf("initial sync failed: %w", err)
+			}
+		}
+	}
+
+	if (t.Retry == nil || !t.Retry.Disabled) && !t.ReadOnly && !t.ApprovalRequired {
+		t.tasks.spawn("retry_loop", t.runRetryLoop)
+	}
+	if t.state != nil && !t.ReadOnly {
+		t.tasks.spawn("ttl_reaper", t.runTTLReaper)
+	}
+	if t.SyncTrigger != nil {
+		t.tasks.spawn("sync_trigger", t.runSyncTrigger)
+	}
+	if t.RoutesFrom != nil {
+		t.tasks.spawn("routes_watch", t.runRoutesWatch)
+	}
+
+	if (t.InitialSync == InitialSyncStart || t.warming) && t.holdsReady() {
+		// Caddy reports READY to systemd once Start returns.
+		if err := t.syncBeforeReady(); err != nil {
+			return err
+		}
+	} else if t.InitialSync == InitialSyncStart || t.warming {
+		// A warm-up takes as long as its pacing needs, so only stopping
+		// the app bounds it.
+		timeout := 5 * time.Minute
+		if t.warming {
+			timeout = 0
+		}
+		t.tasks.spawn("initial_sync", func(runCtx context.Context) {
+			ctx := runCtx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(runCtx, timeout)
+				defer cancel()
+			}
+
+			if err := t.requestSync(ctx, "initial"); err != nil {
+				if runCtx.Err() != nil {
+					t.tasks.interrupt("initial_sync")
+				}
+				t.logger.Error("Background initial sync failed", zap.Error(err))
+			}
+		})
+	}
 
 	return nil
 }
@@ -133,84 +887,296 @@ func (t *TwingateApp) Start() error {
 func (t *TwingateApp) Stop() error {
 	t.logger.Info("Stopping Twingate app")
 
-	if t.cancel != nil {
-		t.cancel()
+	// On reload the new instance has already started and replaced us
+	activeAppMu.Lock()
+	if activeApp == t {
+		activeApp = nil
 	}
+	activeAppMu.Unlock()
 
-	done := make(chan struct{})
-	go func() {
-		t.wg.Wait()
-		close(done)
-	}()
+	for _, label := range t.tenantLabels() {
+		if err := t.Tenants[label].Stop(); err != nil {
+			t.logger.Error("Failed to stop tenant block",
+				zap.String("tenant_block", label),
+				zap.Error(err))
+		}
+	}
 
-	select {
-	case <-done:
+	t.cancelResync()
+	unfinished := t.tasks.shutdown(stopTimeout)
+	if len(unfinished) == 0 {
 		t.logger.Info("Twingate app stopped gracefully")
-	case <-time.After(10 * time.Second):
-		t.logger.Warn("Twingate app stop timeout, some operations may not have completed")
+	} else {
+		t.logger.Warn("Twingate app stopped with unfinished work",
+			zap.Strings("tasks", unfinished))
+	}
+	if t.Tenant != "" {
+		if t.state != nil {
+			resumers.CompareAndDelete(t.state.key, t)
+		}
+		t.savePending(unfinished)
 	}
 
 	return nil
 }
 
-func (t *TwingateApp) performSync(ctx context.Context) error {
+// Cleanup releases this instance's hold on the pooled API client.
+func (t *TwingateApp) Cleanup() error {
+	for _, label := range t.tenantLabels() {
+		if err := t.Tenants[label].Cleanup(); err != nil {
+			return err
+		}
+	}
+	if t.clientKey != "" {
+		if _, err := clientPool.Delete(t.clientKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TwingateApp) performSync(ctx context.Context) (err error) {
 	t.syncMutex.Lock()
 	defer t.syncMutex.Unlock()
+	defer func() {
+		t.lastSyncErr = err
+		if err != nil {
+			t.failedSyncs++
+		} else {
+			t.failedSyncs = 0
+		}
+		t.recordHealth()
+		t.notifySyncStatus(len(t.resources), err)
+	}()
+
+	ctx = withSyncID(ctx)
+	t.lastSyncID = syncIDFrom(ctx)
+	logger := t.log(ctx)
+	logger.Info("Starting Twingate sync")
 
-	t.logger.Info("Starting Twingate sync")
+	ctx, calls := withAPIStats(ctx)
 
-	caddyAddress, err := t.resolveCaddyAddress()
+	mappings, err := t.discoverMappings(ctx)
 	if err != nil {
 		return err
 	}
+	t.discovered = len(mappings)
 
-	httpAppIface, err := t.ctx.App("http")
-	if err != nil {
-		return fmt.Errorf("failed to get HTTP app: %w", err)
+	mappings = t.dropExpired(ctx, mappings)
+	t.reapExpiredHosts(ctx, mappings)
+
+	if len(mappings) == 0 {
+		logger.Info("No reverse_proxy endpoints found, skipping sync")
+		return nil
 	}
 
-	httpApp, ok := httpAppIface.(*caddyhttp.App)
-	if !ok {
-		return fmt.Errorf("HTTP app is not of expected type")
+	logger.Info("Discovered reverse_proxy endpoints",
+		zap.Int("count", len(mappings)))
+
+	if err := t.runHooks(ctx, HookEvent{Stage: HookBeforeSync, Mappings: mappings}); err != nil {
+		return fmt.Errorf("sync stopped: %w", err)
 	}
 
-	discoverer := &RouteDiscoverer{
-		logger:       t.logger,
-		caddyAddress: caddyAddress,
+	if err := t.resolveRemoteNetworkID(ctx); err != nil {
+		return err
+	}
+	if err := t.resolveDefaultPolicy(ctx); err != nil {
+		return err
+	}
+	if err := t.resolveProfilePolicies(ctx); err != nil {
+		return err
 	}
 
-	endpoints, err := discoverer.DiscoverEndpoints(httpApp)
+	syncer := t.newSyncer(ctx)
+	syncer.unlocked = t.withoutSyncLock
+	t.loadSyncState(ctx, syncer)
+	if t.ReadOnly {
+		t.warming = false
+		return t.planSync(ctx, syncer, mappings, calls)
+	}
+	if t.ApprovalRequired {
+		held, err := t.holdForApproval(ctx, syncer, mappings)
+		if err != nil || held {
+			t.recordAPIStats(ctx, calls.snapshot())
+			return err
+		}
+	}
+	if t.warming {
+		t.warming = false
+		syncer.pacer = newWarmupPacer(t.Warmup)
+		logger.Info("Running warm-up sync",
+			zap.Int("resources", len(mappings)),
+			zap.Int("per_minute", t.Warmup.rate()))
+	}
+
+	started := time.Now()
+	err = syncer.SyncResources(ctx, mappings, t.remoteNetworkName(), t.ResourceCleanup)
+	t.runHooks(ctx, HookEvent{Stage: HookAfterSync, Mappings: mappings, Err: err})
+	t.recordAPIStats(ctx, calls.snapshot())
+	t.reportDrift(ctx, syncer.Drifts())
+	t.lastDrifts = syncer.Drifts()
+	t.recordChurn(ctx, syncer)
+	var noAccess []string
+	if t.AccessCheck {
+		noAccess = t.checkNoAccess(ctx, syncer.SyncedResources())
+	}
+	if t.ReportPath != "" {
+		report := newSyncReport(t.Tenant, started, mappings, syncer, err)
+		report.SyncID = t.lastSyncID
+		report.markNoAccess(noAccess)
+		t.writeReport(ctx, report)
+	}
+	if t.retries != nil {
+		for _, entry := range t.retries.reconcile(mappings, syncer.SyncedResources(), syncer.FailedMappings()) {
+			t.reportAbandoned(ctx, entry)
+		}
+	}
+	if err != nil && t.toleratesSyncError(ctx, err) {
+		err = nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to discover endpoints: %w", err)
+		return fmt.Errorf("failed to sync resources: %w", err)
 	}
 
-	if len(endpoints) == 0 {
-		t.logger.Info("No reverse_proxy endpoints found, skipping sync")
-		return nil
+	t.recordManaged(ctx, syncer)
+	if t.ApprovalRequired {
+		t.deleteApprovedExpired(ctx)
 	}
+	t.recordExpiries(ctx, mappings, syncer)
+
+	t.lastSync = time.Now()
+	t.resources = syncer.SyncedResources()
+	t.renamed = renamedHosts(mappings)
+	logger.Info("Twingate sync completed successfully",
+		zap.Time("last_sync", t.lastSync))
 
-	mappings := make([]ResourceMapping, len(endpoints))
-	for i, ep := range endpoints {
-		mappings[i] = ep.ToResourceMapping(caddyAddress)
+	if t.AddressCheck != nil {
+		t.addressProblems = t.checkAddresses(ctx, mappings)
+	}
+	if t.SecurityPosture {
+		t.posture = t.checkPosture(ctx)
+	}
+	if t.AccessListing {
+		t.access = t.listAccess(ctx)
 	}
 
-	t.logger.Info("Discovered reverse_proxy endpoints",
-		zap.Int("count", len(mappings)))
+	return nil
+}
 
-	syncer := &ResourceSyncer{
-		client: t.client,
-		logger: t.logger,
+// newSyncer returns a syncer for the app, logging with the sync ID of ctx.
+func (t *TwingateApp) newSyncer(ctx context.Context) *ResourceSyncer {
+	syncer := NewResourceSyncer(t.api, t.log(ctx))
+	syncer.adopt = t.Adopt
+	syncer.matchOn = t.MatchOn
+	syncer.defaultNetwork = t.remoteNetwork
+	syncer.defaultAccess = t.DefaultAccess
+	if t.defaultPolicy != nil {
+		syncer.defaultPolicyID = t.defaultPolicy.ID
+	}
+	syncer.policyIDs = t.profilePolicies
+	syncer.driftPolicy = t.DriftPolicy
+	syncer.cleanup = &t.cleanup
+	syncer.beforeDelete = t.journalDeletion
+	syncer.snapshotAccess = t.state != nil
+	t.hookChanges(syncer)
+	if len(t.ManagedFields) > 0 {
+		syncer.managedFields = make(map[string]bool, len(t.ManagedFields))
+		for _, field := range t.ManagedFields {
+			syncer.managedFields[field] = true
+		}
 	}
+	return syncer
+}
 
-	if err := syncer.SyncResources(ctx, mappings, t.RemoteNetwork, t.ResourceCleanup); err != nil {
-		return fmt.Errorf("failed to sync resources: %w", err)
+// emit fires a Caddy event from this app, if the events app is available.
+func (t *TwingateApp) emit(ctx context.Context, name string, data map[string]any) {
+	if t.events == nil {
+		return
+	}
+	if id := syncIDFrom(ctx); id != "" {
+		data["sync_id"] = id
 	}
+	t.events.Emit(t.ctx, name, data)
+}
 
-	t.lastSync = time.Now()
-	t.logger.Info("Twingate sync completed successfully",
-		zap.Time("last_sync", t.lastSync))
+// discoverMappings resolves the Caddy address and walks the HTTP app's routes
+// to build the desired resource mappings. It makes no Twingate API calls.
+func (t *TwingateApp) discoverMappings(ctx context.Context) ([]ResourceMapping, error) {
+	var caddyAddresses []string
+	if t.AddressMode != AddressModeDNSHost {
+		addrs, err := t.resolveCaddyAddresses(ctx)
+		if err != nil {
+			return nil, err
+		}
+		caddyAddresses = addrs
+	}
 
-	return nil
+	httpApp, err := t.httpApp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	discoverer := &RouteDiscoverer{
+		logger:         t.logger,
+		caddyAddresses: caddyAddresses,
+		errorRoutes:    t.ErrorRoutes,
+	}
+
+	endpoints, err := discoverer.DiscoverEndpoints(httpApp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover endpoints: %w", err)
+	}
+	endpoints, err = t.appendDiscovered(ctx, endpoints)
+	if err != nil {
+		return nil, err
+	}
+	endpoints = t.filterManagedHosts(t.appendObservedHosts(endpoints))
+	endpoints, err = t.applyProfiles(endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	mappings := make([]ResourceMapping, 0, len(endpoints))
+	for _, ep := range endpoints {
+		mappings = append(mappings, t.endpointMappings(ep, caddyAddresses)...)
+	}
+
+	mappings, err = t.appendCatchAll(ctx, t.rewriteAliases(mappings), httpApp, caddyAddresses)
+	if err != nil {
+		return nil, err
+	}
+	return t.sanitizeMappings(t.appendExtraResources(mappings)), nil
+}
+
+// endpointMappings returns the mappings of an endpoint under the address
+// mode and wildcard_hosts setting, at the Caddy addresses or across the
+// nodes of a fleet. An endpoint with its own address is not behind Caddy
+// and keeps it.
+func (t *TwingateApp) endpointMappings(ep Endpoint, caddyAddresses []string) []ResourceMapping {
+	if ep.Address != "" {
+		return []ResourceMapping{ep.ToResourceMapping(ep.Address)}
+	}
+	if t.Fleet != nil && len(t.Fleet.nodesFor(ep.Host)) == 0 {
+		t.logger.Warn("No node serves host, skipping it",
+			zap.String("host", ep.Host))
+		return nil
+	}
+	if t.AddressMode == AddressModeDNSHost || ep.IsWildcard() && t.WildcardHosts == WildcardAddress {
+		return []ResourceMapping{ep.ToDNSResourceMapping()}
+	}
+
+	var mappings []ResourceMapping
+	if t.Fleet != nil {
+		mappings = t.Fleet.endpointMappings(ep)
+	} else {
+		mappings = ep.ToResourceMappings(caddyAddresses)
+	}
+	// Aliases must be unique, so several addresses or nodes get none.
+	if ep.IsWildcard() && t.WildcardHosts == WildcardAlias && len(mappings) == 1 {
+		host := ep.Host
+		mappings[0].Alias = &host
+	}
+	return mappings
 }
 
 func (t *TwingateApp) GetLastSyncTime() time.Time {
@@ -219,12 +1185,51 @@ func (t *TwingateApp) GetLastSyncTime() time.Time {
 	return t.lastSync
 }
 
+// ResourceCount returns the number of resources managed by the last
+// successful sync.
+func (t *TwingateApp) ResourceCount() int {
+	t.syncMutex.RLock()
+	defer t.syncMutex.RUnlock()
+	return len(t.resources)
+}
+
+// LookupResource returns the managed resource serving host, matching exact
+// names first and then wildcard resources such as *.dev.example.com.
+func (t *TwingateApp) LookupResource(host string) (Resource, bool) {
+	if tenant := t.tenantFor(host); tenant != t {
+		return tenant.LookupResource(host)
+	}
+
+	t.syncMutex.RLock()
+	defer t.syncMutex.RUnlock()
+
+	host = normalizeHost(host)
+
+	if name, ok := t.renamed[host]; ok {
+		host = name
+	}
+	if res, ok := t.resources[host]; ok {
+		return res, true
+	}
+
+	for labels := host; ; {
+		dot := strings.IndexByte(labels, '.')
+		if dot < 0 {
+			return Resource{}, false
+		}
+		labels = labels[dot+1:]
+		if res, ok := t.resources["*."+labels]; ok {
+			return res, true
+		}
+	}
+}
+
 func (t *TwingateApp) TriggerSync() error {
 	t.logger.Info("Manual sync triggered")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	return t.performSync(ctx)
+	return t.requestSync(ctx, "manual")
 }
 
 // NOTE: onConfigReload is no longer needed because Caddy's App lifecycle
@@ -255,38 +1260,87 @@ func (t *TwingateApp) onConfigReload(event caddyevents.Event) error {
 // GetOutboundIP uses a UDP dial to 8.8.8.8:80 to determine the local outbound IP
 // without actually sending any data over the network
 func GetOutboundIP() (string, error) {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		return "", fmt.Errorf("failed to detect outbound IP: %w", err)
-	}
-	defer conn.Close()
-
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	return localAddr.IP.String(), nil
+	return outboundIP(defaultOutboundTarget)
 }
 
-func (t *TwingateApp) resolveCaddyAddress() (string, error) {
+// configuredAddresses returns the explicitly configured Caddy addresses,
+// combining the single caddy_address with the caddy_addresses list.
+func (t *TwingateApp) configuredAddresses() []string {
+	var addrs []string
 	if t.CaddyAddress != "" {
+		addrs = append(addrs, t.CaddyAddress)
+	}
+	return append(addrs, t.CaddyAddresses...)
+}
+
+func (t *TwingateApp) resolveCaddyAddresses(ctx context.Context) ([]string, error) {
+	if addrs := t.configuredAddresses(); len(addrs) > 0 {
 		t.logger.Info("Using explicitly configured Caddy address",
-			zap.String("address", t.CaddyAddress))
-		return t.CaddyAddress, nil
+			zap.Strings("addresses", addrs))
+		return addrs, nil
 	}
 
-	ip, err := GetOutboundIP()
+	if t.Fleet != nil {
+		return t.Fleet.addresses(), nil
+	}
+	if addr := t.RoutesFrom.adminHost(); addr != "" && t.resolver == nil {
+		t.logger.Info("Using the host of the routes_from admin API as Caddy address",
+			zap.String("address", addr))
+		return []string{addr}, nil
+	}
+
+	resolver := t.resolver
+	if resolver == nil {
+		resolver = OutboundResolver{}
+	}
+	addrs, err := resolver.ResolveAddresses(t.withEgress(ctx))
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("no address found")
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve Caddy address: %w. Consider setting caddy_address explicitly in Twingate config", err)
+		return nil, fmt.Errorf("failed to resolve Caddy address: %w. Consider setting caddy_address explicitly in Twingate config", err)
+	}
+	for _, addr := range addrs {
+		if err := validateCaddyAddress(addr); err != nil {
+			return nil, fmt.Errorf("address resolver: %w", err)
+		}
 	}
 
-	t.logger.Info("Auto-detected Caddy address from outbound interface",
-		zap.String("address", ip),
-		zap.String("method", "udp_dial"))
+	t.logger.Info("Resolved Caddy address",
+		zap.Strings("addresses", addrs),
+		zap.String("resolver", resolverName(resolver)))
+
+	return addrs, nil
+}
+
+// resolverName returns the module name of resolver, such as outbound.
+func resolverName(resolver AddressResolver) string {
+	if mod, ok := resolver.(caddy.Module); ok {
+		return caddy.GetModuleName(mod)
+	}
+	return fmt.Sprintf("%T", resolver)
+}
 
-	return ip, nil
+// validateCaddyAddress accepts an IPv4 address or a DNS name. A DNS name is
+// the way to publish several Caddy nodes behind one resource: the connector
+// resolves it, so round-robin records cover the whole set.
+func validateCaddyAddress(addr string) error {
+	if ip := net.ParseIP(addr); ip != nil {
+		if ip.To4() == nil {
+			return fmt.Errorf("address '%s' is IPv6, but only IPv4 is currently supported", addr)
+		}
+		return nil
+	}
+	if !isDNSName(addr) {
+		return fmt.Errorf("must be a valid IPv4 address or DNS name, got: %s", addr)
+	}
+	return nil
 }
 
 var (
-	_ caddy.Module      = (*TwingateApp)(nil)
-	_ caddy.App         = (*TwingateApp)(nil)
-	_ caddy.Provisioner = (*TwingateApp)(nil)
-	_ caddy.Validator   = (*TwingateApp)(nil)
+	_ caddy.Module       = (*TwingateApp)(nil)
+	_ caddy.App          = (*TwingateApp)(nil)
+	_ caddy.Provisioner  = (*TwingateApp)(nil)
+	_ caddy.Validator    = (*TwingateApp)(nil)
+	_ caddy.CleanerUpper = (*TwingateApp)(nil)
 )
@@ -86,3 +86,93 @@ func TestValidate_MissingTenant(t *testing.T) {
 		t.Errorf("Validate() returned unexpected error message: %v", err)
 	}
 }
+
+func TestValidateCaddyAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"192.168.1.10", false},
+		{"caddy.internal.example.com", false},
+		{"caddy-nodes", false},
+		{"::1", true},
+		{"not a host", true},
+		{"-bad.example.com", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		err := validateCaddyAddress(tt.addr)
+		if tt.wantErr && err == nil {
+			t.Errorf("validateCaddyAddress(%q) should fail", tt.addr)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("validateCaddyAddress(%q) unexpected error: %v", tt.addr, err)
+		}
+	}
+}
+
+func TestLookupResource(t *testing.T) {
+	app := &TwingateApp{
+		resources: map[string]Resource{
+			"api.example.com":   newTestResource("r1", "api.example.com", "10.0.0.1", "net1"),
+			"*.dev.example.com": newTestResource("r2", "*.dev.example.com", "10.0.0.1", "net1"),
+		},
+	}
+
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"api.example.com", "r1"},
+		{"API.example.com:443", "r1"},
+		{"foo.dev.example.com", "r2"},
+		{"a.b.dev.example.com", "r2"},
+		{"other.example.com", ""},
+	}
+
+	for _, tt := range tests {
+		res, found := app.LookupResource(tt.host)
+		if tt.expected == "" {
+			if found {
+				t.Errorf("LookupResource(%q) should not match, got %s", tt.host, res.ID)
+			}
+			continue
+		}
+		if !found || res.ID != tt.expected {
+			t.Errorf("LookupResource(%q) = %q, want %q", tt.host, res.ID, tt.expected)
+		}
+	}
+}
+
+func TestIsValidateCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"caddy", "validate", "--config", "Caddyfile"}, true},
+		{[]string{"caddy", "run", "--config", "Caddyfile"}, false},
+		{[]string{"caddy"}, false},
+	}
+	for _, tt := range tests {
+		if got := isValidateCommand(tt.args); got != tt.want {
+			t.Errorf("isValidateCommand(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// setActiveApp registers app as the running TwingateApp for the duration of the test.
+func setActiveApp(t *testing.T, app *TwingateApp) {
+	t.Helper()
+
+	activeAppMu.Lock()
+	prev := activeApp
+	activeApp = app
+	activeAppMu.Unlock()
+
+	t.Cleanup(func() {
+		activeAppMu.Lock()
+		activeApp = prev
+		activeAppMu.Unlock()
+	})
+}
@@ -0,0 +1,51 @@
+package twingatetest
+
+import twingate "github.com/EngineeredDev/twingate-caddy"
+
+// NewResource builds a Resource without spelling out its anonymous struct
+// fields.
+func NewResource(id, name, address, networkID string) twingate.Resource {
+	res := twingate.Resource{ID: id, Name: name}
+	res.Address.Value = address
+	res.RemoteNetwork.ID = networkID
+	return res
+}
+
+// MappingOption customizes a mapping built by NewMapping.
+type MappingOption func(*twingate.ResourceMapping)
+
+// WithAlias sets the mapping's alias.
+func WithAlias(alias string) MappingOption {
+	return func(m *twingate.ResourceMapping) {
+		m.Alias = &alias
+	}
+}
+
+// WithGroups sets the groups granted access to the mapping's resource.
+func WithGroups(groups ...string) MappingOption {
+	return func(m *twingate.ResourceMapping) {
+		m.Groups = groups
+	}
+}
+
+// WithRemoteNetwork places the mapping in a remote network other than the
+// default.
+func WithRemoteNetwork(name string) MappingOption {
+	return func(m *twingate.ResourceMapping) {
+		m.RemoteNetwork = name
+	}
+}
+
+// NewMapping builds a ResourceMapping.
+func NewMapping(name, address string, opts ...MappingOption) twingate.ResourceMapping {
+	m := twingate.ResourceMapping{Name: name, Address: address}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	return m
+}
+
+// NewEndpoint builds an Endpoint as the route discoverer would for host.
+func NewEndpoint(host string) twingate.Endpoint {
+	return twingate.Endpoint{Host: host, Path: "/"}
+}
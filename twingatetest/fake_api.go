@@ -0,0 +1,529 @@
+package twingatetest
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	twingate "github.com/EngineeredDev/twingate-caddy"
+)
+
+// FakeAPI is a stateful, in-memory Twingate tenant served over GraphQL. It
+// implements the subset of the schema the plugin uses: remote networks,
+// resources with filters and pagination, groups, users, the resource
+// mutations and introspection of their arguments. Point the app's
+// api_endpoint at URL to run it against a fake.
+//
+// Responses only carry the fields the plugin's queries select, since the
+// GraphQL client rejects unknown fields.
+type FakeAPI struct {
+	*GraphQLServer
+
+	mu        sync.Mutex
+	networks  []twingate.RemoteNetwork
+	resources []twingate.Resource
+	groups    []twingate.Group
+	users     []twingate.User
+	grants    map[string][]string
+	tags      map[string]map[string]string
+	nextID    int
+
+	// missingArgs are the optional mutation arguments the schema lacks.
+	missingArgs []string
+	// readOnly makes every mutation fail, as for a read-only API key.
+	readOnly bool
+}
+
+// mutationArgs are the arguments the fake's resource mutations take.
+var mutationArgs = map[string][]string{
+	"resourceCreate": {"address", "name", "remoteNetworkId", "alias", "groupIds", "tags", "protocols"},
+	"resourceUpdate": {"id", "name", "address", "alias", "addedGroupIds", "tags", "protocols"},
+}
+
+// NewFakeAPI starts a fake Twingate API that is closed when the test ends.
+func NewFakeAPI(t testing.TB) *FakeAPI {
+	t.Helper()
+
+	f := &FakeAPI{grants: make(map[string][]string), tags: make(map[string]map[string]string)}
+	f.GraphQLServer = NewGraphQLServer(t, f.respond)
+	return f
+}
+
+// WithoutArguments makes the schema lack the given arguments of the
+// resource mutations, such as "tags", as on a tenant that does not have
+// them yet. Introspection leaves them out and mutations passing them
+// fail with an unknown-argument error.
+func (f *FakeAPI) WithoutArguments(names ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.missingArgs = append(f.missingArgs, names...)
+}
+
+// ReadOnlyKey makes every mutation fail with a permission error, as for an
+// API key that cannot make changes. Queries keep working.
+func (f *FakeAPI) ReadOnlyKey() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readOnly = true
+}
+
+func (f *FakeAPI) newID(kind string) string {
+	f.nextID++
+	return fmt.Sprintf("%s:%d", kind, f.nextID)
+}
+
+// AddRemoteNetwork creates a remote network and returns it.
+func (f *FakeAPI) AddRemoteNetwork(name string) twingate.RemoteNetwork {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	network := twingate.RemoteNetwork{ID: f.newID("RemoteNetwork"), Name: name}
+	f.networks = append(f.networks, network)
+	return network
+}
+
+// AddResource stores a resource, assigning an ID if it has none, and
+// returns it.
+func (f *FakeAPI) AddResource(res twingate.Resource) twingate.Resource {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if res.ID == "" {
+		res.ID = f.newID("Resource")
+	}
+	f.resources = append(f.resources, res)
+	return res
+}
+
+// AddGroup creates a group and returns its ID.
+func (f *FakeAPI) AddGroup(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	group := twingate.Group{ID: f.newID("Group"), Name: name}
+	f.groups = append(f.groups, group)
+	return group.ID
+}
+
+// AddUser stores a user for the user query.
+func (f *FakeAPI) AddUser(user twingate.User) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.users = append(f.users, user)
+}
+
+// RemoteNetworks returns the tenant's remote networks.
+func (f *FakeAPI) RemoteNetworks() []twingate.RemoteNetwork {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]twingate.RemoteNetwork(nil), f.networks...)
+}
+
+// RemoteNetworkByName returns the named remote network, if it exists.
+func (f *FakeAPI) RemoteNetworkByName(name string) (twingate.RemoteNetwork, bool) {
+	for _, network := range f.RemoteNetworks() {
+		if network.Name == name {
+			return network, true
+		}
+	}
+	return twingate.RemoteNetwork{}, false
+}
+
+// Resources returns the tenant's resources sorted by name.
+func (f *FakeAPI) Resources() []twingate.Resource {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resources := append([]twingate.Resource(nil), f.resources...)
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Name < resources[j].Name
+	})
+	return resources
+}
+
+// ResourceNames returns the sorted names of the tenant's resources.
+func (f *FakeAPI) ResourceNames() []string {
+	var names []string
+	for _, res := range f.Resources() {
+		names = append(names, res.Name)
+	}
+	return names
+}
+
+// Grants returns the IDs of the groups granted access to a resource.
+func (f *FakeAPI) Grants(resourceID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.grants[resourceID]...)
+}
+
+// Tags returns the tags set on a resource.
+func (f *FakeAPI) Tags(resourceID string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return maps.Clone(f.tags[resourceID])
+}
+
+func (f *FakeAPI) respond(req GraphQLRequest) any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	field := rootField(req.Query)
+	vars := req.Variables
+	if f.readOnly && strings.HasPrefix(strings.TrimSpace(req.Query), "mutation") {
+		return fmt.Errorf("Permission denied: API key is read-only")
+	}
+	for _, arg := range f.missingArgs {
+		if _, ok := vars[arg]; ok && mutationArgs[field] != nil {
+			return fmt.Errorf("Unknown argument %q on field %q of type \"Mutation\"", arg, field)
+		}
+	}
+	switch field {
+	case "__type":
+		var fields []any
+		for _, name := range slices.Sorted(maps.Keys(mutationArgs)) {
+			var args []any
+			for _, arg := range mutationArgs[name] {
+				if !slices.Contains(f.missingArgs, arg) {
+					args = append(args, map[string]any{"name": arg})
+				}
+			}
+			fields = append(fields, map[string]any{"name": name, "args": args})
+		}
+		return map[string]any{field: map[string]any{"fields": fields}}
+
+	case "remoteNetworks":
+		var edges []any
+		for _, network := range f.networks {
+			edges = append(edges, map[string]any{"node": networkNode(network)})
+		}
+		return map[string]any{field: map[string]any{"edges": edges}}
+
+	case "remoteNetwork":
+		id, _ := vars["id"].(string)
+		if f.networkIndex(id) < 0 {
+			return map[string]any{field: nil}
+		}
+		conn := f.resourceConnection(req, func(r twingate.Resource) bool {
+			return r.RemoteNetwork.ID == id
+		})
+		return map[string]any{field: map[string]any{"resources": conn}}
+
+	case "resource":
+		id, _ := vars["id"].(string)
+		if i := f.resourceIndex(id); i >= 0 {
+			// The access query selects nothing else of the resource
+			if strings.Contains(req.Query, "access") {
+				return map[string]any{field: map[string]any{"access": f.accessConnection(id)}}
+			}
+			return map[string]any{field: resourceNode(f.resources[i])}
+		}
+		return map[string]any{field: nil}
+
+	case "resources":
+		name, alias := filterEq(vars, "name"), filterEq(vars, "alias")
+		conn := f.resourceConnection(req, func(r twingate.Resource) bool {
+			if name != nil && r.Name != *name {
+				return false
+			}
+			if alias != nil && (r.Alias == nil || *r.Alias != *alias) {
+				return false
+			}
+			return true
+		})
+		return map[string]any{field: conn}
+
+	case "groups":
+		name := filterEq(vars, "name")
+		var edges []any
+		for _, group := range f.groups {
+			if name == nil || group.Name == *name {
+				edges = append(edges, map[string]any{
+					"node": map[string]any{"id": group.ID, "name": group.Name},
+				})
+			}
+		}
+		return map[string]any{field: map[string]any{"edges": edges}}
+
+	case "user":
+		id, _ := vars["id"].(string)
+		for _, user := range f.users {
+			if user.ID == id {
+				return map[string]any{field: map[string]any{
+					"id":        user.ID,
+					"email":     user.Email,
+					"firstName": user.FirstName,
+					"lastName":  user.LastName,
+				}}
+			}
+		}
+		return map[string]any{field: nil}
+
+	case "remoteNetworkCreate":
+		name, _ := vars["name"].(string)
+		if name == "" {
+			return mutationResult(field, "name is required", nil)
+		}
+		network := twingate.RemoteNetwork{ID: f.newID("RemoteNetwork"), Name: name}
+		f.networks = append(f.networks, network)
+		return mutationResult(field, "", networkNode(network))
+
+	case "resourceCreate":
+		return f.createResource(vars)
+
+	case "resourceUpdate":
+		return f.updateResource(vars)
+
+	case "resourceAccessAdd":
+		id, _ := vars["resourceId"].(string)
+		if f.resourceIndex(id) < 0 {
+			return map[string]any{field: map[string]any{"ok": false, "error": "resource not found"}}
+		}
+		access, _ := vars["access"].([]any)
+		for _, a := range access {
+			input, _ := a.(map[string]any)
+			f.grant(id, []any{input["principalId"]})
+		}
+		return map[string]any{field: map[string]any{"ok": true, "error": nil}}
+
+	case "resourceAccessRemove":
+		id, _ := vars["resourceId"].(string)
+		if f.resourceIndex(id) < 0 {
+			return map[string]any{field: map[string]any{"ok": false, "error": "resource not found"}}
+		}
+		removed, _ := vars["principalIds"].([]any)
+		f.grants[id] = slices.DeleteFunc(f.grants[id], func(g string) bool {
+			return slices.Contains(removed, any(g))
+		})
+		return map[string]any{field: map[string]any{"ok": true, "error": nil}}
+
+	case "resourceDelete":
+		id, _ := vars["id"].(string)
+		i := f.resourceIndex(id)
+		if i < 0 {
+			return map[string]any{field: map[string]any{"ok": false, "error": "resource not found"}}
+		}
+		f.resources = append(f.resources[:i], f.resources[i+1:]...)
+		delete(f.grants, id)
+		return map[string]any{field: map[string]any{"ok": true, "error": nil}}
+	}
+
+	return fmt.Errorf("Cannot query field %q on type \"Query\"", field)
+}
+
+func (f *FakeAPI) createResource(vars map[string]any) any {
+	name, _ := vars["name"].(string)
+	address, _ := vars["address"].(string)
+	networkID, _ := vars["remoteNetworkId"].(string)
+
+	switch {
+	case name == "":
+		return mutationResult("resourceCreate", "name is required", nil)
+	case address == "":
+		return mutationResult("resourceCreate", "address is required", nil)
+	case f.networkIndex(networkID) < 0:
+		return mutationResult("resourceCreate", "remote network not found", nil)
+	}
+
+	res := NewResource(f.newID("Resource"), name, address, networkID)
+	if alias, _ := vars["alias"].(string); alias != "" {
+		res.Alias = &alias
+	}
+	f.resources = append(f.resources, res)
+	f.grant(res.ID, vars["groupIds"])
+	f.tag(res.ID, vars["tags"])
+	return mutationResult("resourceCreate", "", resourceNode(res))
+}
+
+func (f *FakeAPI) updateResource(vars map[string]any) any {
+	id, _ := vars["id"].(string)
+	i := f.resourceIndex(id)
+	if i < 0 {
+		return mutationResult("resourceUpdate", "resource not found", nil)
+	}
+
+	// The client only sends the fields it changes; an empty alias removes
+	// the alias.
+	res := &f.resources[i]
+	if name, ok := vars["name"].(string); ok {
+		res.Name = name
+	}
+	if address, ok := vars["address"].(string); ok {
+		res.Address.Value = address
+	}
+	if alias, ok := vars["alias"].(string); ok {
+		res.Alias = &alias
+		if alias == "" {
+			res.Alias = nil
+		}
+	}
+	f.grant(id, vars["addedGroupIds"])
+	f.tag(id, vars["tags"])
+	return mutationResult("resourceUpdate", "", resourceNode(*res))
+}
+
+func (f *FakeAPI) grant(resourceID string, groupIDs any) {
+	ids, _ := groupIDs.([]any)
+	for _, id := range ids {
+		if s, ok := id.(string); ok {
+			f.grants[resourceID] = append(f.grants[resourceID], s)
+		}
+	}
+}
+
+// tag replaces a resource's tags with a tags argument. A missing or null
+// argument leaves them unchanged.
+func (f *FakeAPI) tag(resourceID string, tags any) {
+	list, ok := tags.([]any)
+	if !ok {
+		return
+	}
+	set := make(map[string]string, len(list))
+	for _, tagAny := range list {
+		tag, _ := tagAny.(map[string]any)
+		key, _ := tag["key"].(string)
+		value, _ := tag["value"].(string)
+		set[key] = value
+	}
+	f.tags[resourceID] = set
+}
+
+// accessConnection renders the groups granted access to a resource as a
+// single page of its access connection.
+func (f *FakeAPI) accessConnection(resourceID string) map[string]any {
+	var edges []any
+	for _, id := range f.grants[resourceID] {
+		node := map[string]any{"__typename": "Group", "id": id}
+		for _, group := range f.groups {
+			if group.ID == id {
+				node["name"] = group.Name
+			}
+		}
+		edges = append(edges, map[string]any{
+			"node":           node,
+			"securityPolicy": nil,
+		})
+	}
+	return map[string]any{
+		"edges":    edges,
+		"pageInfo": map[string]any{"hasNextPage": false, "endCursor": nil},
+	}
+}
+
+// resourceConnection renders the resources matching keep as a connection,
+// paginated by the first and after variables.
+func (f *FakeAPI) resourceConnection(req GraphQLRequest, keep func(twingate.Resource) bool) map[string]any {
+	first := len(f.resources)
+	if n, ok := req.Variables["first"].(float64); ok && n > 0 {
+		first = int(n)
+	}
+	after, _ := req.Variables["after"].(string)
+
+	var matched []twingate.Resource
+	for _, res := range f.resources {
+		if keep(res) {
+			matched = append(matched, res)
+		}
+	}
+
+	start := 0
+	if after != "" {
+		for i, res := range matched {
+			if res.ID == after {
+				start = i + 1
+				break
+			}
+		}
+	}
+	end := min(start+first, len(matched))
+
+	var edges []any
+	for _, res := range matched[start:end] {
+		edges = append(edges, map[string]any{"node": resourceNode(res)})
+	}
+
+	conn := map[string]any{"edges": edges}
+	if strings.Contains(req.Query, "pageInfo") {
+		var endCursor any
+		if end > start {
+			endCursor = matched[end-1].ID
+		}
+		conn["pageInfo"] = map[string]any{
+			"hasNextPage": end < len(matched),
+			"endCursor":   endCursor,
+		}
+	}
+	return conn
+}
+
+func (f *FakeAPI) networkIndex(id string) int {
+	for i, network := range f.networks {
+		if network.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *FakeAPI) resourceIndex(id string) int {
+	for i, res := range f.resources {
+		if res.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// rootField returns the name of the first field selected by query.
+func rootField(query string) string {
+	i := strings.Index(query, "{")
+	if i < 0 {
+		return ""
+	}
+	rest := strings.TrimSpace(query[i+1:])
+	if end := strings.IndexAny(rest, "({ \n"); end >= 0 {
+		rest = rest[:end]
+	}
+	return rest
+}
+
+// filterEq returns the eq operand for field in the filter variable.
+func filterEq(vars map[string]any, field string) *string {
+	filter, _ := vars["filter"].(map[string]any)
+	op, _ := filter[field].(map[string]any)
+	if eq, ok := op["eq"].(string); ok {
+		return &eq
+	}
+	return nil
+}
+
+func mutationResult(field, errMsg string, entity any) map[string]any {
+	result := map[string]any{"ok": errMsg == "", "error": nil, "entity": entity}
+	if errMsg != "" {
+		result["error"] = errMsg
+	}
+	return map[string]any{field: result}
+}
+
+func networkNode(network twingate.RemoteNetwork) map[string]any {
+	return map[string]any{"id": network.ID, "name": network.Name}
+}
+
+func resourceNode(res twingate.Resource) map[string]any {
+	var alias any
+	if res.Alias != nil {
+		alias = *res.Alias
+	}
+	return map[string]any{
+		"id":            res.ID,
+		"name":          res.Name,
+		"address":       map[string]any{"value": res.Address.Value},
+		"alias":         alias,
+		"remoteNetwork": map[string]any{"id": res.RemoteNetwork.ID},
+	}
+}
@@ -0,0 +1,272 @@
+// Package twingatetest provides test doubles for code built on the
+// twingate package: a mock TwingateAPI, a fake GraphQL server and
+// builders for resources and mappings.
+package twingatetest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	twingate "github.com/EngineeredDev/twingate-caddy"
+)
+
+// MockTwingateClient is an in-memory implementation of twingate.TwingateAPI.
+// The zero value is ready to use. Set the Err fields to make the matching
+// calls fail.
+type MockTwingateClient struct {
+	mu sync.Mutex
+
+	Resources map[string]twingate.Resource      // key is resource ID
+	Networks  map[string]twingate.RemoteNetwork // key is network name
+	Groups    map[string]string                 // group name to ID
+	Grants    map[string][]string               // resource ID to granted group IDs
+
+	DeletedIDs []string
+	CallLog    []string // Method calls, e.g. "CreateResource(api.example.com)"
+
+	GetResourcesErr error
+	CreateErr       error
+	UpdateErr       error
+	DeleteErr       error
+	RevokeErr       error
+
+	nextID int
+}
+
+func (m *MockTwingateClient) logCall(format string, args ...any) {
+	m.CallLog = append(m.CallLog, fmt.Sprintf(format, args...))
+}
+
+// Calls returns a copy of the call log.
+func (m *MockTwingateClient) Calls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.CallLog...)
+}
+
+// GetResources returns the resources in a network, or all resources when
+// remoteNetworkID is empty.
+func (m *MockTwingateClient) GetResources(ctx context.Context, remoteNetworkID string) ([]twingate.Resource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logCall("GetResources(%s)", remoteNetworkID)
+
+	if m.GetResourcesErr != nil {
+		return nil, m.GetResourcesErr
+	}
+
+	var resources []twingate.Resource
+	for _, r := range m.Resources {
+		if remoteNetworkID == "" || r.RemoteNetwork.ID == remoteNetworkID {
+			resources = append(resources, r)
+		}
+	}
+	return resources, nil
+}
+
+// GetResource finds a resource by ID.
+func (m *MockTwingateClient) GetResource(ctx context.Context, resourceID string) (*twingate.Resource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.Resources[resourceID]; ok {
+		return &r, nil
+	}
+	return nil, nil
+}
+
+// GetResourceByAlias finds a resource by alias within a network, or in any
+// network when remoteNetworkID is empty.
+func (m *MockTwingateClient) GetResourceByAlias(ctx context.Context, alias string, remoteNetworkID string) (*twingate.Resource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.Resources {
+		if (remoteNetworkID == "" || r.RemoteNetwork.ID == remoteNetworkID) && r.Alias != nil && *r.Alias == alias {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetResourceByName finds a resource by name within a network.
+func (m *MockTwingateClient) GetResourceByName(ctx context.Context, name string, remoteNetworkID string) (*twingate.Resource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.Resources {
+		if r.RemoteNetwork.ID == remoteNetworkID && r.Name == name {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateResource stores a new resource with a generated ID.
+func (m *MockTwingateClient) CreateResource(ctx context.Context, input twingate.ResourceCreateInput) (*twingate.Resource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logCall("CreateResource(%s)", input.Name)
+
+	if m.CreateErr != nil {
+		return nil, m.CreateErr
+	}
+
+	if m.Resources == nil {
+		m.Resources = make(map[string]twingate.Resource)
+	}
+	m.nextID++
+	res := NewResource(fmt.Sprintf("new%d", m.nextID), input.Name, input.Address, input.RemoteNetworkID)
+	if input.Alias != "" {
+		alias := input.Alias
+		res.Alias = &alias
+	}
+	m.Resources[res.ID] = res
+	m.grant(res.ID, input.GroupIDs)
+	return &res, nil
+}
+
+// UpdateResource applies the non-nil fields of input to a stored resource.
+// An empty alias removes the alias.
+func (m *MockTwingateClient) UpdateResource(ctx context.Context, input twingate.ResourceUpdateInput) (*twingate.Resource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logCall("UpdateResource(%s)", input.ID)
+
+	if m.UpdateErr != nil {
+		return nil, m.UpdateErr
+	}
+
+	res, ok := m.Resources[input.ID]
+	if !ok {
+		return nil, fmt.Errorf("resource %s not found", input.ID)
+	}
+	if input.Name != nil {
+		res.Name = *input.Name
+	}
+	if input.Address != nil {
+		res.Address.Value = *input.Address
+	}
+	if input.Alias != nil {
+		res.Alias = input.Alias
+		if *input.Alias == "" {
+			res.Alias = nil
+		}
+	}
+	m.Resources[input.ID] = res
+	m.grant(input.ID, input.AddedGroupIDs)
+	return &res, nil
+}
+
+func (m *MockTwingateClient) grant(resourceID string, groupIDs []string) {
+	if len(groupIDs) == 0 {
+		return
+	}
+	if m.Grants == nil {
+		m.Grants = make(map[string][]string)
+	}
+	m.Grants[resourceID] = append(m.Grants[resourceID], groupIDs...)
+}
+
+// DeleteResource deletes a resource by ID.
+func (m *MockTwingateClient) DeleteResource(ctx context.Context, resourceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logCall("DeleteResource(%s)", resourceID)
+
+	if m.DeleteErr != nil {
+		return m.DeleteErr
+	}
+
+	m.DeletedIDs = append(m.DeletedIDs, resourceID)
+	delete(m.Resources, resourceID)
+	return nil
+}
+
+// GetResourceAccess returns the groups in Grants as principals.
+func (m *MockTwingateClient) GetResourceAccess(ctx context.Context, resourceID string) ([]twingate.AccessPrincipal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logCall("GetResourceAccess(%s)", resourceID)
+
+	var principals []twingate.AccessPrincipal
+	for _, id := range m.Grants[resourceID] {
+		principals = append(principals, twingate.AccessPrincipal{ID: id, Type: "Group"})
+	}
+	return principals, nil
+}
+
+// AddResourceAccess adds principals to Grants.
+func (m *MockTwingateClient) AddResourceAccess(ctx context.Context, resourceID string, principals []twingate.AccessPrincipal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logCall("AddResourceAccess(%s)", resourceID)
+
+	for _, principal := range principals {
+		m.grant(resourceID, []string{principal.ID})
+	}
+	return nil
+}
+
+// RemoveResourceAccess removes principals from Grants.
+func (m *MockTwingateClient) RemoveResourceAccess(ctx context.Context, resourceID string, principalIDs []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logCall("RemoveResourceAccess(%s)", resourceID)
+
+	if m.RevokeErr != nil {
+		return m.RevokeErr
+	}
+	if len(m.Grants[resourceID]) == 0 {
+		return nil
+	}
+	m.Grants[resourceID] = slices.DeleteFunc(m.Grants[resourceID], func(id string) bool {
+		return slices.Contains(principalIDs, id)
+	})
+	return nil
+}
+
+// GetRemoteNetworkByName returns a network from the Networks map.
+func (m *MockTwingateClient) GetRemoteNetworkByName(ctx context.Context, name string) (*twingate.RemoteNetwork, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if network, ok := m.Networks[name]; ok {
+		return &network, nil
+	}
+	return nil, nil
+}
+
+// GetOrCreateRemoteNetwork returns a network from the Networks map,
+// creating it with the ID "net-<name>" if needed.
+func (m *MockTwingateClient) GetOrCreateRemoteNetwork(ctx context.Context, name string) (*twingate.RemoteNetwork, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logCall("GetOrCreateRemoteNetwork(%s)", name)
+
+	if m.Networks == nil {
+		m.Networks = make(map[string]twingate.RemoteNetwork)
+	}
+	network, ok := m.Networks[name]
+	if !ok {
+		network = twingate.RemoteNetwork{ID: "net-" + name, Name: name}
+		m.Networks[name] = network
+	}
+	return &network, nil
+}
+
+// GetGroupByName returns a group from the Groups map.
+func (m *MockTwingateClient) GetGroupByName(ctx context.Context, name string) (*twingate.Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logCall("GetGroupByName(%s)", name)
+
+	if id, ok := m.Groups[name]; ok {
+		return &twingate.Group{ID: id, Name: name}, nil
+	}
+	return nil, nil
+}
+
+var _ twingate.TwingateAPI = (*MockTwingateClient)(nil)
@@ -0,0 +1,77 @@
+package twingatetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// GraphQLRequest is the body a client POSTs to the GraphQL endpoint.
+type GraphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+// GraphQLServer is an httptest server answering GraphQL requests through
+// a Respond function. It records every request it receives.
+type GraphQLServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []GraphQLRequest
+}
+
+// NewGraphQLServer starts a server that answers each request with the data
+// returned by respond, and closes it when the test ends. If respond
+// returns an error, it is sent as a GraphQL error instead.
+func NewGraphQLServer(t testing.TB, respond func(req GraphQLRequest) any) *GraphQLServer {
+	t.Helper()
+
+	s := &GraphQLServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		data := respond(req)
+		if err, ok := data.(error); ok {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"errors": []any{map[string]any{"message": err.Error()}},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Requests returns the requests received so far.
+func (s *GraphQLServer) Requests() []GraphQLRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]GraphQLRequest(nil), s.requests...)
+}
+
+// ResourceNode renders a resource edge the way the API returns it.
+func ResourceNode(id, name, address, networkID string) map[string]any {
+	return map[string]any{
+		"node": map[string]any{
+			"id":            id,
+			"name":          name,
+			"address":       map[string]any{"value": address},
+			"alias":         nil,
+			"remoteNetwork": map[string]any{"id": networkID},
+		},
+	}
+}
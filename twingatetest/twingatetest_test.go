@@ -0,0 +1,60 @@
+package twingatetest_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	twingate "github.com/EngineeredDev/twingate-caddy"
+	"github.com/EngineeredDev/twingate-caddy/twingatetest"
+	"go.uber.org/zap"
+)
+
+func TestMockDrivesSyncFlow(t *testing.T) {
+	mock := &twingatetest.MockTwingateClient{
+		Groups: map[string]string{"Engineering": "g1"},
+		Resources: map[string]twingate.Resource{
+			"old": twingatetest.NewResource("old", "old.example.com", "10.0.0.1", "net-Caddy-Managed"),
+		},
+	}
+
+	mappings := []twingate.ResourceMapping{
+		twingatetest.NewMapping("api.example.com", "10.0.0.1", twingatetest.WithAlias("api.example.com")),
+		twingatetest.NewMapping("lab-net", "10.10.0.0/24", twingatetest.WithGroups("Engineering")),
+	}
+
+	syncer := twingate.NewResourceSyncer(mock, zap.NewNop())
+	err := syncer.SyncResources(context.Background(), mappings, "Caddy-Managed", &twingate.CleanupConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("SyncResources() failed: %v", err)
+	}
+
+	if len(mock.Resources) != 2 {
+		t.Errorf("expected 2 resources after sync, got %d", len(mock.Resources))
+	}
+	if len(mock.DeletedIDs) != 1 || mock.DeletedIDs[0] != "old" {
+		t.Errorf("expected stale resource deleted, got %v", mock.DeletedIDs)
+	}
+	if syncer.Actions()["lab-net"] != twingate.ActionCreated {
+		t.Errorf("unexpected actions: %v", syncer.Actions())
+	}
+}
+
+func TestGraphQLServerRecordsRequests(t *testing.T) {
+	server := twingatetest.NewGraphQLServer(t, func(req twingatetest.GraphQLRequest) any {
+		return map[string]any{"ok": true}
+	})
+
+	body := strings.NewReader(`{"query":"query{ok}","variables":{"id":"1"}}`)
+	resp, err := http.Post(server.URL, "application/json", body)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	requests := server.Requests()
+	if len(requests) != 1 || requests[0].Variables["id"] != "1" {
+		t.Errorf("unexpected recorded requests: %+v", requests)
+	}
+}
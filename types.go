@@ -1,10 +1,39 @@
 package twingate
 
+import "time"
+
 type RemoteNetwork struct {
 	ID   string `graphql:"id"`
 	Name string `graphql:"name"`
 }
 
+type User struct {
+	ID        string `graphql:"id"`
+	Email     string `graphql:"email"`
+	FirstName string `graphql:"firstName"`
+	LastName  string `graphql:"lastName"`
+}
+
+type Group struct {
+	ID   string `graphql:"id"`
+	Name string `graphql:"name"`
+}
+
+type SecurityPolicy struct {
+	ID         string `graphql:"id"`
+	Name       string `graphql:"name"`
+	PolicyType string `graphql:"policyType"`
+}
+
+// SecurityPolicyDetails is a security policy with the device requirements
+// users must meet to reach the resources it guards.
+type SecurityPolicyDetails struct {
+	ID                 string   `graphql:"id"`
+	Name               string   `graphql:"name"`
+	PolicyType         string   `graphql:"policyType"`
+	DeviceRequirements []string `graphql:"deviceRequirements"`
+}
+
 type ResourceAddress struct {
 	Value string `json:"value"`
 }
@@ -26,13 +55,38 @@ type ResourceCreateInput struct {
 	Address         string `json:"address"`
 	RemoteNetworkID string `json:"remoteNetworkId"`
 	Alias           string `json:"alias,omitempty"`
+
+	// GroupIDs are granted access to the new resource.
+	GroupIDs []string `json:"groupIds,omitempty"`
+
+	// SecurityPolicyID, if set, is the security policy of the new
+	// resource.
+	SecurityPolicyID string `json:"securityPolicyId,omitempty"`
+
+	// Tags are set on the new resource.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Protocols restricts the new resource's protocols. Nil allows all.
+	Protocols *ProtocolsInput `json:"protocols,omitempty"`
 }
 
+// ResourceUpdateInput describes a resourceUpdate call. Only the non-nil
+// fields are sent, so attributes managed in the console are left alone. An
+// empty Alias removes the resource's alias.
 type ResourceUpdateInput struct {
 	ID      string  `json:"id"`
 	Name    *string `json:"name,omitempty"`
 	Address *string `json:"address,omitempty"`
 	Alias   *string `json:"alias,omitempty"`
+
+	// AddedGroupIDs are granted access in addition to existing grants.
+	AddedGroupIDs []string `json:"addedGroupIds,omitempty"`
+
+	// Tags replace the resource's tags when non-nil.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Protocols replaces the resource's protocol policy when non-nil.
+	Protocols *ProtocolsInput `json:"protocols,omitempty"`
 }
 
 type RemoteNetworkCreateInput struct {
@@ -71,6 +125,252 @@ type ResourcesQuery struct {
 	} `graphql:"resources(first: $first)"`
 }
 
+type PageInfo struct {
+	HasNextPage bool    `graphql:"hasNextPage"`
+	EndCursor   *string `graphql:"endCursor"`
+}
+
+// AccessPrincipal is a group or service account with access to a
+// resource.
+type AccessPrincipal struct {
+	ID string `json:"id"`
+
+	// Type is Group or ServiceAccount.
+	Type string `json:"type"`
+
+	// Name is the group or service account's name, when read from the
+	// API.
+	Name string `json:"name,omitempty"`
+
+	// SecurityPolicyID is the policy the grant was given with, if it
+	// overrides the resource's.
+	SecurityPolicyID string `json:"security_policy_id,omitempty"`
+}
+
+// AccessInput grants a principal access to a resource, under its own
+// security policy if SecurityPolicyID is set.
+type AccessInput struct {
+	PrincipalID      string  `json:"principalId"`
+	SecurityPolicyID *string `json:"securityPolicyId,omitempty"`
+}
+
+func (AccessInput) GetGraphQLType() string {
+	return "AccessInput"
+}
+
+// ProtocolsInput restricts the protocols and ports a resource allows.
+type ProtocolsInput struct {
+	AllowICMP bool          `json:"allowIcmp"`
+	TCP       ProtocolInput `json:"tcp"`
+	UDP       ProtocolInput `json:"udp"`
+}
+
+// GetGraphQLType has a pointer receiver so that a nil *ProtocolsInput,
+// sent as null, still names its type.
+func (*ProtocolsInput) GetGraphQLType() string {
+	return "ProtocolsInput"
+}
+
+// Protocol policies of a ProtocolInput.
+const (
+	ProtocolAllowAll   = "ALLOW_ALL"
+	ProtocolRestricted = "RESTRICTED"
+)
+
+// ProtocolInput is the policy of one protocol. Under ProtocolRestricted
+// only Ports are allowed; none means the protocol is blocked.
+type ProtocolInput struct {
+	Policy string           `json:"policy"`
+	Ports  []PortRangeInput `json:"ports"`
+}
+
+// PortRangeInput is an inclusive range of ports.
+type PortRangeInput struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// TagInput is a key-value tag set on a resource.
+type TagInput struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (TagInput) GetGraphQLType() string {
+	return "TagInput"
+}
+
+type ResourceAccessQuery struct {
+	Resource *struct {
+		Access struct {
+			PageInfo PageInfo `graphql:"pageInfo"`
+			Edges    []struct {
+				Node struct {
+					Typename string `graphql:"__typename"`
+					Group    struct {
+						ID   string `graphql:"id"`
+						Name string `graphql:"name"`
+					} `graphql:"... on Group"`
+					ServiceAccount struct {
+						ID   string `graphql:"id"`
+						Name string `graphql:"name"`
+					} `graphql:"... on ServiceAccount"`
+				} `graphql:"node"`
+				SecurityPolicy *struct {
+					ID string `graphql:"id"`
+				} `graphql:"securityPolicy"`
+			} `graphql:"edges"`
+		} `graphql:"access(first: $first, after: $after)"`
+	} `graphql:"resource(id: $id)"`
+}
+
+type ResourcesPageQuery struct {
+	Resources struct {
+		PageInfo PageInfo `graphql:"pageInfo"`
+		Edges    []struct {
+			Node Resource `graphql:"node"`
+		} `graphql:"edges"`
+	} `graphql:"resources(first: $first, after: $after)"`
+}
+
+type RemoteNetworkResourcesQuery struct {
+	RemoteNetwork *struct {
+		Resources struct {
+			PageInfo PageInfo `graphql:"pageInfo"`
+			Edges    []struct {
+				Node Resource `graphql:"node"`
+			} `graphql:"edges"`
+		} `graphql:"resources(first: $first, after: $after)"`
+	} `graphql:"remoteNetwork(id: $id)"`
+}
+
+// StringFilterOperationInput matches a string field in a filter argument.
+type StringFilterOperationInput struct {
+	Eq         *string `json:"eq,omitempty"`
+	StartsWith *string `json:"startsWith,omitempty"`
+}
+
+// ResourceFilterInput is the filter argument of the resources query.
+type ResourceFilterInput struct {
+	Name  *StringFilterOperationInput `json:"name,omitempty"`
+	Alias *StringFilterOperationInput `json:"alias,omitempty"`
+}
+
+func (ResourceFilterInput) GetGraphQLType() string {
+	return "ResourceFilterInput"
+}
+
+// GroupFilterInput is the filter argument of the groups query.
+type GroupFilterInput struct {
+	Name *StringFilterOperationInput `json:"name,omitempty"`
+}
+
+func (GroupFilterInput) GetGraphQLType() string {
+	return "GroupFilterInput"
+}
+
+type FilteredGroupsQuery struct {
+	Groups struct {
+		Edges []struct {
+			Node Group `graphql:"node"`
+		} `graphql:"edges"`
+	} `graphql:"groups(first: $first, filter: $filter)"`
+}
+
+type GroupsPageQuery struct {
+	Groups struct {
+		PageInfo PageInfo `graphql:"pageInfo"`
+		Edges    []struct {
+			Node Group `graphql:"node"`
+		} `graphql:"edges"`
+	} `graphql:"groups(first: $first, after: $after, filter: $filter)"`
+}
+
+type GroupUsersQuery struct {
+	Group *struct {
+		Users struct {
+			PageInfo PageInfo `graphql:"pageInfo"`
+			Edges    []struct {
+				Node User `graphql:"node"`
+			} `graphql:"edges"`
+		} `graphql:"users(first: $first, after: $after)"`
+	} `graphql:"group(id: $id)"`
+}
+
+type GroupCreateMutation struct {
+	GroupCreate struct {
+		OK     bool    `graphql:"ok"`
+		Error  *string `graphql:"error"`
+		Entity *Group  `graphql:"entity"`
+	} `graphql:"groupCreate(name: $name, userIds: $userIds)"`
+}
+
+type GroupUpdateMutation struct {
+	GroupUpdate struct {
+		OK     bool    `graphql:"ok"`
+		Error  *string `graphql:"error"`
+		Entity *Group  `graphql:"entity"`
+	} `graphql:"groupUpdate(id: $id, addedUserIds: $addedUserIds, removedUserIds: $removedUserIds)"`
+}
+
+type SecurityPoliciesPageQuery struct {
+	SecurityPolicies struct {
+		PageInfo PageInfo `graphql:"pageInfo"`
+		Edges    []struct {
+			Node SecurityPolicy `graphql:"node"`
+		} `graphql:"edges"`
+	} `graphql:"securityPolicies(first: $first, after: $after)"`
+}
+
+type SecurityPolicyDetailsPageQuery struct {
+	SecurityPolicies struct {
+		PageInfo PageInfo `graphql:"pageInfo"`
+		Edges    []struct {
+			Node SecurityPolicyDetails `graphql:"node"`
+		} `graphql:"edges"`
+	} `graphql:"securityPolicies(first: $first, after: $after)"`
+}
+
+type ResourcePoliciesQuery struct {
+	Resources struct {
+		PageInfo PageInfo `graphql:"pageInfo"`
+		Edges    []struct {
+			Node struct {
+				ID             string `graphql:"id"`
+				SecurityPolicy *struct {
+					ID string `graphql:"id"`
+				} `graphql:"securityPolicy"`
+			} `graphql:"node"`
+		} `graphql:"edges"`
+	} `graphql:"resources(first: $first, after: $after)"`
+}
+
+type ResourceAccessPresenceQuery struct {
+	Resources struct {
+		PageInfo PageInfo `graphql:"pageInfo"`
+		Edges    []struct {
+			Node struct {
+				ID     string `graphql:"id"`
+				Access struct {
+					Edges []struct {
+						Node struct {
+							Typename string `graphql:"__typename"`
+						} `graphql:"node"`
+					} `graphql:"edges"`
+				} `graphql:"access(first: 1)"`
+			} `graphql:"node"`
+		} `graphql:"edges"`
+	} `graphql:"resources(first: $first, after: $after)"`
+}
+
+type FilteredResourcesQuery struct {
+	Resources struct {
+		Edges []struct {
+			Node Resource `graphql:"node"`
+		} `graphql:"edges"`
+	} `graphql:"resources(first: $first, filter: $filter)"`
+}
+
 type ResourceCreateMutation struct {
 	ResourceCreate struct {
 		OK     bool      `graphql:"ok"`
@@ -79,12 +379,26 @@ type ResourceCreateMutation struct {
 	} `graphql:"resourceCreate(address: $address, name: $name, remoteNetworkId: $remoteNetworkId)"`
 }
 
+// ResourceUpdateMutation is resourceUpdate with the arguments the plugin
+// sent before it sent only the changed ones.
+//
+// Deprecated: UpdateResource builds the mutation for the arguments of the
+// ResourceUpdateInput it is given, so attributes left nil are not changed.
 type ResourceUpdateMutation struct {
 	ResourceUpdate struct {
 		OK     bool      `graphql:"ok"`
 		Error  *string   `graphql:"error"`
 		Entity *Resource `graphql:"entity"`
-	} `graphql:"resourceUpdate(id: $id, name: $name, address: $address, alias: $alias)"`
+	} `graphql:"resourceUpdate(id: $id, name: $name, address: $address, alias: $alias, addedGroupIds: $addedGroupIds)"`
+}
+
+// resourceMutationResult is the payload of resourceCreate and
+// resourceUpdate, selected through a mutation built for the arguments
+// sent.
+type resourceMutationResult struct {
+	OK     bool      `graphql:"ok"`
+	Error  *string   `graphql:"error"`
+	Entity *Resource `graphql:"entity"`
 }
 
 type RemoteNetworkCreateMutation struct {
@@ -95,8 +409,51 @@ type RemoteNetworkCreateMutation struct {
 	} `graphql:"remoteNetworkCreate(name: $name)"`
 }
 
+type RemoteNetworkUpdateMutation struct {
+	RemoteNetworkUpdate struct {
+		OK     bool           `graphql:"ok"`
+		Error  *string        `graphql:"error"`
+		Entity *RemoteNetwork `graphql:"entity"`
+	} `graphql:"remoteNetworkUpdate(id: $id, name: $name)"`
+}
+
 type ResourceMapping struct {
-	Name    string
-	Alias   *string
-	Address string
+	Name    string  `json:"name"`
+	Alias   *string `json:"alias,omitempty"`
+	Address string  `json:"address"`
+
+	// Groups names the groups granted access to the resource.
+	Groups []string `json:"groups,omitempty"`
+
+	// RemoteNetwork overrides the app-level remote network for this
+	// mapping. Empty means use the default.
+	RemoteNetwork string `json:"remote_network,omitempty"`
+
+	// SecurityPolicy names the security policy the resource is created
+	// with, from the profile of its site. Empty means default_access's.
+	SecurityPolicy string `json:"security_policy,omitempty"`
+
+	// Host is the original host when Name had to be sanitized.
+	Host string `json:"host,omitempty"`
+
+	// Identity is a stable key for the mapping that survives renames of
+	// its host. Empty means the mapping is only matched by alias and name.
+	Identity string `json:"identity,omitempty"`
+
+	// OriginalAlias is the alias before alias rewriting. A resource still
+	// carrying it is matched and given the rewritten alias.
+	OriginalAlias string `json:"original_alias,omitempty"`
+
+	// Labels are the key-value labels set on the mapping's routes. They
+	// are applied to the resource as tags.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Protocols restricts the protocols and ports the resource allows,
+	// such as the ports of a TLS passthrough route. Nil allows all.
+	Protocols *ProtocolsInput `json:"protocols,omitempty"`
+
+	// TTL is how long after its creation the resource is deleted, even
+	// if the mapping still wants it. Zero keeps it. It is left out of the
+	// mappings served and exported; /twingate/status shows the expiry.
+	TTL time.Duration `json:"-"`
 }
@@ -0,0 +1,314 @@
+package twingate
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Rules by which a mapping is matched to an existing resource, in the
+// order they are tried. See matchResource.
+const (
+	// MatchID matches the resource the mapping synced to last time.
+	MatchID = "id"
+	// MatchAlias matches a resource carrying the mapping's alias.
+	MatchAlias = "alias"
+	// MatchOriginalAlias matches a resource carrying the alias the
+	// mapping had before it was rewritten.
+	MatchOriginalAlias = "original_alias"
+	// MatchName matches a resource by name, for mappings without an alias,
+	// in adopt mode and under match_on name or name_or_alias.
+	MatchName = "name"
+	// MatchIdentity matches the resource the mapping's identity synced to
+	// last time, such as one whose host was renamed.
+	MatchIdentity = "identity"
+)
+
+const (
+	// MatchOnAlias matches a mapping with an alias by alias only, and one
+	// without by name. Adopt mode adds the name for every mapping. This is
+	// the default.
+	MatchOnAlias = "alias"
+
+	// MatchOnName matches mappings by name only, ignoring their aliases.
+	MatchOnName = "name"
+
+	// MatchOnNameOrAlias matches mappings by both name and alias. When
+	// they find different resources the mapping fails with a
+	// MatchConflictError instead of guessing.
+	MatchOnNameOrAlias = "name_or_alias"
+)
+
+// MatchConflictError is returned when match_on name_or_alias finds one
+// resource by a mapping's alias and another by its name.
+type MatchConflictError struct {
+	Name  string
+	Alias string
+
+	// ByName and ByAlias are the IDs of the resources matched by name and
+	// by alias, and ByAliasName the name of the latter.
+	ByName      string
+	ByAlias     string
+	ByAliasName string
+}
+
+func (e *MatchConflictError) Error() string {
+	return fmt.Sprintf("resource %s matches the name of %s, but its alias %s matches %s (%s)",
+		e.Name, e.ByName, e.Alias, e.ByAliasName, e.ByAlias)
+}
+
+// matchResource finds the existing resource in the network that mapping
+// corresponds to, along with the rule that matched, or nil if there is
+// none and the resource is to be created. It is the one place the
+// matching rules live: syncs, retries, CreateOrUpdateResource and the sync
+// summary all go through it. The resource found is recorded as matched,
+// so cleanup keeps it whatever its name.
+//
+// The rules are tried in order: the stored ID, the alias, the original
+// alias and the name as match_on allows, and last the stored identity.
+// Matches by ID, alias or identity can resolve to a resource under
+// another name. The caller renames it if the plugin manages names.
+func (r *ResourceSyncer) matchResource(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) (*Resource, string, error) {
+	existing, rule, err := r.findMatch(ctx, mapping, remoteNetworkID)
+	if existing != nil && r.matched != nil {
+		r.matched[existing.ID] = true
+	}
+	return existing, rule, err
+}
+
+// findMatch tries the rules of matchResource in order.
+func (r *ResourceSyncer) findMatch(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) (*Resource, string, error) {
+	existing, err := r.findByID(ctx, mapping, remoteNetworkID)
+	if err != nil {
+		return nil, "", err
+	}
+	if existing != nil {
+		return existing, MatchID, nil
+	}
+
+	existing, rule, err := r.findExisting(ctx, mapping, remoteNetworkID)
+	if err != nil || existing != nil {
+		return existing, rule, err
+	}
+
+	existing, err = r.findByIdentity(ctx, mapping, remoteNetworkID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to check for renamed resource: %w", err)
+	}
+	if existing != nil {
+		return existing, MatchIdentity, nil
+	}
+	return nil, "", nil
+}
+
+// appliedFromMapping returns the attribute values mapping asks for.
+func appliedFromMapping(mapping ResourceMapping) AppliedFields {
+	fields := AppliedFields{Name: mapping.Name, Address: mapping.Address}
+	if mapping.Alias != nil {
+		fields.Alias = *mapping.Alias
+	}
+	return fields
+}
+
+// appliedFromResource returns the attribute values resource has.
+func appliedFromResource(resource *Resource) AppliedFields {
+	fields := AppliedFields{Name: resource.Name, Address: resource.Address.Value}
+	if resource.Alias != nil {
+		fields.Alias = *resource.Alias
+	}
+	return fields
+}
+
+// findByID returns the resource the mapping synced to last time, looked up
+// by ID. It returns nil on first contact, and when the resource is gone,
+// has moved to another network or now carries the name of another mapping,
+// leaving the mapping to the alias and name lookups.
+func (r *ResourceSyncer) findByID(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) (*Resource, error) {
+	id, ok := r.ids[mapping.Name]
+	if !ok {
+		return nil, nil
+	}
+
+	resource, err := r.client.GetResource(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up resource %s: %w", id, err)
+	}
+	if resource == nil || resource.RemoteNetwork.ID != remoteNetworkID {
+		return nil, nil
+	}
+	if resource.Name != mapping.Name && r.desired[resource.Name] {
+		return nil, nil
+	}
+
+	r.logger.Debug("Found resource by ID",
+		zap.String("resource_id", resource.ID),
+		zap.String("name", mapping.Name))
+	return resource, nil
+}
+
+// findExisting returns the resource in the network that mapping already
+// corresponds to, along with the rule that matched, or nil if there is
+// none. Under match_on alias, the default, it matches by alias, then by
+// the alias before rewriting and, without an alias or in adopt mode, by
+// name. Under match_on name it matches by name only, and under
+// name_or_alias by both, failing with a MatchConflictError if they find
+// different resources.
+func (r *ResourceSyncer) findExisting(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) (*Resource, string, error) {
+	var byAlias *Resource
+	var aliasRule string
+	if r.matchOn != MatchOnName {
+		var err error
+		byAlias, aliasRule, err = r.findByAlias(ctx, mapping, remoteNetworkID)
+		if err != nil {
+			return nil, "", err
+		}
+		if byAlias != nil && r.matchOn != MatchOnNameOrAlias {
+			return byAlias, aliasRule, nil
+		}
+	}
+
+	// In adopt mode a manually created resource is matched by name even
+	// when it has no alias yet.
+	if mapping.Alias != nil && !r.adopt && r.matchOn != MatchOnName && r.matchOn != MatchOnNameOrAlias {
+		return nil, "", nil
+	}
+	byName, err := r.findByName(ctx, mapping, remoteNetworkID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch {
+	case byAlias != nil && byName != nil && byAlias.ID != byName.ID:
+		// Neither candidate is stale, so cleanup keeps both.
+		if r.matched != nil {
+			r.matched[byAlias.ID] = true
+			r.matched[byName.ID] = true
+		}
+		return nil, "", &MatchConflictError{
+			Name:        mapping.Name,
+			Alias:       *mapping.Alias,
+			ByName:      byName.ID,
+			ByAlias:     byAlias.ID,
+			ByAliasName: byAlias.Name,
+		}
+	case byAlias != nil:
+		return byAlias, aliasRule, nil
+	case byName != nil:
+		return byName, MatchName, nil
+	}
+	return nil, "", nil
+}
+
+// findByAlias returns the resource in the network carrying the mapping's
+// alias or, failing that, the alias it had before rewriting, along with
+// the rule that matched.
+func (r *ResourceSyncer) findByAlias(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) (*Resource, string, error) {
+	if mapping.Alias == nil {
+		return nil, "", nil
+	}
+
+	r.logger.Info("Checking for existing resource by alias",
+		zap.String("alias", *mapping.Alias),
+		zap.String("remote_network_id", remoteNetworkID))
+
+	existingResource, err := r.client.GetResourceByAlias(ctx, *mapping.Alias, remoteNetworkID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to check for existing resource: %w", err)
+	}
+	if existingResource != nil {
+		r.logger.Info("Found existing resource by alias",
+			zap.String("resource_id", existingResource.ID),
+			zap.String("name", existingResource.Name))
+		return existingResource, MatchAlias, nil
+	}
+	r.logger.Info("No existing resource found by alias",
+		zap.String("alias", *mapping.Alias))
+
+	// A resource created before its alias was rewritten still carries the
+	// original alias.
+	if mapping.OriginalAlias != "" {
+		existingResource, err = r.client.GetResourceByAlias(ctx, mapping.OriginalAlias, remoteNetworkID)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to check for existing resource: %w", err)
+		}
+		if existingResource != nil {
+			r.logger.Info("Found existing resource by original alias",
+				zap.String("resource_id", existingResource.ID),
+				zap.String("original_alias", mapping.OriginalAlias),
+				zap.String("alias", *mapping.Alias))
+			return existingResource, MatchOriginalAlias, nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+// findByName returns the resource in the network named like the mapping.
+func (r *ResourceSyncer) findByName(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) (*Resource, error) {
+	r.logger.Info("Checking for existing resource by name",
+		zap.String("name", mapping.Name),
+		zap.String("remote_network_id", remoteNetworkID))
+
+	existingResource, err := r.client.GetResourceByName(ctx, mapping.Name, remoteNetworkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for existing resource: %w", err)
+	}
+	if existingResource != nil {
+		r.logger.Info("Found existing resource by name",
+			zap.String("resource_id", existingResource.ID),
+			zap.String("name", existingResource.Name))
+	} else {
+		r.logger.Info("No existing resource found by name",
+			zap.String("name", mapping.Name))
+	}
+	return existingResource, nil
+}
+
+// findByIdentity returns the resource the mapping's identity last synced
+// to, if it still exists in the network, such as one whose host or alias
+// changed. A resource whose name is still wanted by another mapping is
+// left to that mapping, and none is returned when the plugin may not
+// rename resources.
+func (r *ResourceSyncer) findByIdentity(ctx context.Context, mapping ResourceMapping, remoteNetworkID string) (*Resource, error) {
+	if mapping.Identity == "" || r.ambiguous[mapping.Identity] || !r.manages(FieldName) {
+		return nil, nil
+	}
+	id, ok := r.identities[mapping.Identity]
+	if !ok {
+		return nil, nil
+	}
+
+	resources, err := r.listResources(ctx, remoteNetworkID)
+	if err != nil {
+		return nil, err
+	}
+	resource, ok := resources[id]
+	if !ok {
+		return nil, nil
+	}
+	if r.desired[resource.Name] && resource.Name != mapping.Name {
+		return nil, nil
+	}
+	return &resource, nil
+}
+
+// listResources returns the resources in the network keyed by ID, listing
+// the network once per sync.
+func (r *ResourceSyncer) listResources(ctx context.Context, remoteNetworkID string) (map[string]Resource, error) {
+	if listed, ok := r.listed[remoteNetworkID]; ok {
+		return listed, nil
+	}
+	resources, err := r.client.GetResources(ctx, remoteNetworkID)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]Resource, len(resources))
+	for _, resource := range resources {
+		listed[resource.ID] = resource
+	}
+	if r.listed != nil {
+		r.listed[remoteNetworkID] = listed
+	}
+	return listed, nil
+}
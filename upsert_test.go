@@ -0,0 +1,238 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+func TestMatchResource(t *testing.T) {
+	alias := func(s string) *string { return &s }
+	withAlias := func(r Resource, a string) Resource {
+		r.Alias = &a
+		return r
+	}
+
+	for _, tt := range []struct {
+		name       string
+		resources  []Resource
+		ids        map[string]string
+		identities map[string]string
+		adopt      bool
+		matchOn    string
+		mapping    ResourceMapping
+		wantID     string
+		wantRule   string
+		wantErr    bool
+	}{
+		{
+			name:      "stored ID",
+			resources: []Resource{newTestResource("r1", "old-name", "10.0.0.1", "net1")},
+			ids:       map[string]string{"app": "r1"},
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1"},
+			wantID:    "r1",
+			wantRule:  MatchID,
+		},
+		{
+			name:      "stored ID in another network",
+			resources: []Resource{newTestResource("r1", "app", "10.0.0.1", "net2")},
+			ids:       map[string]string{"app": "r1"},
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1"},
+		},
+		{
+			name:      "alias",
+			resources: []Resource{withAlias(newTestResource("r1", "other", "10.0.0.1", "net1"), "app.internal")},
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1", Alias: alias("app.internal")},
+			wantID:    "r1",
+			wantRule:  MatchAlias,
+		},
+		{
+			name:      "original alias",
+			resources: []Resource{withAlias(newTestResource("r1", "app", "10.0.0.1", "net1"), "app.example.com")},
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1", Alias: alias("app.internal"), OriginalAlias: "app.example.com"},
+			wantID:    "r1",
+			wantRule:  MatchOriginalAlias,
+		},
+		{
+			name:      "name without alias",
+			resources: []Resource{newTestResource("r1", "app", "10.0.0.1", "net1")},
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1"},
+			wantID:    "r1",
+			wantRule:  MatchName,
+		},
+		{
+			name:      "name with alias needs adopt",
+			resources: []Resource{newTestResource("r1", "app", "10.0.0.1", "net1")},
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1", Alias: alias("app.internal")},
+		},
+		{
+			name:      "name with alias in adopt mode",
+			resources: []Resource{newTestResource("r1", "app", "10.0.0.1", "net1")},
+			adopt:     true,
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1", Alias: alias("app.internal")},
+			wantID:    "r1",
+			wantRule:  MatchName,
+		},
+		{
+			name:       "identity",
+			resources:  []Resource{newTestResource("r1", "old.example.com", "10.0.0.1", "net1")},
+			identities: map[string]string{"upstream:localhost:9001": "r1"},
+			mapping:    ResourceMapping{Name: "new.example.com", Address: "10.0.0.1", Identity: "upstream:localhost:9001"},
+			wantID:     "r1",
+			wantRule:   MatchIdentity,
+		},
+		{
+			name:       "alias before identity",
+			resources:  []Resource{withAlias(newTestResource("r1", "app", "10.0.0.1", "net1"), "app.internal"), newTestResource("r2", "old", "10.0.0.1", "net1")},
+			identities: map[string]string{"upstream:localhost:9001": "r2"},
+			mapping:    ResourceMapping{Name: "app", Address: "10.0.0.1", Alias: alias("app.internal"), Identity: "upstream:localhost:9001"},
+			wantID:     "r1",
+			wantRule:   MatchAlias,
+		},
+		{
+			name:      "match_on name ignores alias",
+			resources: []Resource{withAlias(newTestResource("r1", "other", "10.0.0.1", "net1"), "app.internal"), newTestResource("r2", "app", "10.0.0.1", "net1")},
+			matchOn:   MatchOnName,
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1", Alias: alias("app.internal")},
+			wantID:    "r2",
+			wantRule:  MatchName,
+		},
+		{
+			name:      "match_on name_or_alias by name",
+			resources: []Resource{newTestResource("r1", "app", "10.0.0.1", "net1")},
+			matchOn:   MatchOnNameOrAlias,
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1", Alias: alias("app.internal")},
+			wantID:    "r1",
+			wantRule:  MatchName,
+		},
+		{
+			name:      "match_on name_or_alias agreeing",
+			resources: []Resource{withAlias(newTestResource("r1", "app", "10.0.0.1", "net1"), "app.internal")},
+			matchOn:   MatchOnNameOrAlias,
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1", Alias: alias("app.internal")},
+			wantID:    "r1",
+			wantRule:  MatchAlias,
+		},
+		{
+			name:      "match_on name_or_alias conflict",
+			resources: []Resource{withAlias(newTestResource("r1", "other", "10.0.0.1", "net1"), "app.internal"), newTestResource("r2", "app", "10.0.0.1", "net1")},
+			matchOn:   MatchOnNameOrAlias,
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1", Alias: alias("app.internal")},
+			wantErr:   true,
+		},
+		{
+			name:      "no match",
+			resources: []Resource{newTestResource("r1", "other", "10.0.0.1", "net1")},
+			mapping:   ResourceMapping{Name: "app", Address: "10.0.0.1"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockTwingateClient{Resources: map[string]Resource{}}
+			for _, r := range tt.resources {
+				mock.Resources[r.ID] = r
+			}
+			syncer := &ResourceSyncer{
+				client:     mock,
+				logger:     zap.NewNop(),
+				ids:        tt.ids,
+				identities: tt.identities,
+				adopt:      tt.adopt,
+				matchOn:    tt.matchOn,
+			}
+
+			existing, rule, err := syncer.matchResource(context.Background(), tt.mapping, "net1")
+			if tt.wantErr {
+				var conflict *MatchConflictError
+				if !errors.As(err, &conflict) || conflict.ByName != "r2" || conflict.ByAlias != "r1" {
+					t.Fatalf("expected a match conflict, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("matchResource() failed: %v", err)
+			}
+			gotID := ""
+			if existing != nil {
+				gotID = existing.ID
+			}
+			if gotID != tt.wantID || rule != tt.wantRule {
+				t.Errorf("matchResource() = %q by %q, want %q by %q", gotID, rule, tt.wantID, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestGetSyncSummary_MatchesLikeSync(t *testing.T) {
+	mock := &MockTwingateClient{
+		Networks:  map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{"r1": newTestResource("r1", "old-name", "10.0.0.1", "net1")},
+	}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop(), ids: map[string]string{"app": "r1"}}
+
+	summary, err := syncer.GetSyncSummary(context.Background(), []ResourceMapping{{Name: "app", Address: "10.0.0.2"}}, "Caddy-Managed", nil)
+	if err != nil {
+		t.Fatalf("GetSyncSummary() failed: %v", err)
+	}
+	if len(summary.Resources) != 1 {
+		t.Fatalf("expected one resource, got %+v", summary.Resources)
+	}
+	item := summary.Resources[0]
+	if item.ID != "r1" || item.Action != "update" {
+		t.Errorf("summary should match by stored ID like a sync, got %+v", item)
+	}
+}
+
+func TestUnmarshalCaddyfile_MatchOn(t *testing.T) {
+	app := &TwingateApp{}
+	if err := app.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		match_on name_or_alias
+	}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.MatchOn != MatchOnNameOrAlias {
+		t.Errorf("MatchOn = %q, want %q", app.MatchOn, MatchOnNameOrAlias)
+	}
+
+	if err := (&TwingateApp{}).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`twingate {
+		tenant acme
+		match_on id
+	}`)); err == nil {
+		t.Error("expected error for an unknown match_on value")
+	}
+}
+
+func TestSyncResources_MatchConflictKeepsCandidates(t *testing.T) {
+	alias := "app.internal"
+	byAlias := newTestResource("r1", "other", "10.0.0.1", "net1")
+	byAlias.Alias = &alias
+	mock := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+		Resources: map[string]Resource{
+			"r1": byAlias,
+			"r2": newTestResource("r2", "app", "10.0.0.1", "net1"),
+		},
+	}
+	syncer := &ResourceSyncer{client: mock, logger: zap.NewNop(), matchOn: MatchOnNameOrAlias}
+
+	mappings := []ResourceMapping{{Name: "app", Address: "10.0.0.1", Alias: &alias}}
+	err := syncer.SyncResources(context.Background(), mappings, "", &CleanupConfig{Enabled: true})
+	var partial *PartialSyncError
+	if !errors.As(err, &partial) || partial.Upserts != 1 {
+		t.Fatalf("SyncResources() error = %v, want the conflicting mapping to fail", err)
+	}
+	if len(mock.DeletedIDs) != 0 {
+		t.Errorf("conflict candidates should not be deleted as stale: %v", mock.DeletedIDs)
+	}
+
+	summary, err := syncer.GetSyncSummary(context.Background(), mappings, "", &CleanupConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("GetSyncSummary() failed: %v", err)
+	}
+	if summary.ResourcesToDelete != 0 {
+		t.Errorf("conflict candidates should not be planned for deletion: %+v", summary.Resources)
+	}
+}
@@ -0,0 +1,126 @@
+package twingate
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(VarsHandler{})
+	httpcaddyfile.RegisterHandlerDirective("twingate_vars", parseVarsHandler)
+	httpcaddyfile.RegisterDirectiveOrder("twingate_vars", httpcaddyfile.Before, "map")
+}
+
+// VarsHandler exposes the sync state of the running Twingate app to the
+// rest of the route as placeholders:
+//
+//	{twingate.tenant}          the configured tenant
+//	{twingate.last_sync}       time of the last successful sync (RFC 3339)
+//	{twingate.last_sync_unix}  the same, as a Unix timestamp
+//	{twingate.resource_count}  number of managed resources
+//	{twingate.resource}        name of the resource for the requested host
+//	{twingate.resource_id}     ID of the resource for the requested host
+//
+// Placeholders are empty when the app is not running or has not synced.
+type VarsHandler struct{}
+
+func (VarsHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.twingate_vars",
+		New: func() caddy.Module { return new(VarsHandler) },
+	}
+}
+
+func (VarsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if ok {
+		repl.Map(twingatePlaceholders(currentApp(), r.Host))
+	}
+	return next.ServeHTTP(w, r)
+}
+
+// twingatePlaceholders returns a replacer provider for the twingate.*
+// placeholders. Values are read when the placeholder is evaluated.
+func twingatePlaceholders(app *TwingateApp, host string) caddy.ReplacerFunc {
+	if app != nil {
+		app = app.tenantFor(host)
+	}
+	return func(key string) (any, bool) {
+		if app == nil {
+			switch key {
+			case "twingate.tenant", "twingate.last_sync", "twingate.last_sync_unix",
+				"twingate.resource_count", "twingate.resource", "twingate.resource_id":
+				return "", true
+			}
+			return nil, false
+		}
+
+		switch key {
+		case "twingate.tenant":
+			return app.Tenant, true
+
+		case "twingate.last_sync":
+			if last := app.GetLastSyncTime(); !last.IsZero() {
+				return last.UTC().Format(time.RFC3339), true
+			}
+			return "", true
+
+		case "twingate.last_sync_unix":
+			if last := app.GetLastSyncTime(); !last.IsZero() {
+				return strconv.FormatInt(last.Unix(), 10), true
+			}
+			return "", true
+
+		case "twingate.resource_count":
+			return strconv.Itoa(app.ResourceCount()), true
+
+		case "twingate.resource":
+			if res, found := app.LookupResource(host); found {
+				return res.Name, true
+			}
+			return "", true
+
+		case "twingate.resource_id":
+			if res, found := app.LookupResource(host); found {
+				return res.ID, true
+			}
+			return "", true
+		}
+
+		return nil, false
+	}
+}
+
+// UnmarshalCaddyfile parses the twingate_vars directive, which takes no
+// arguments.
+func (VarsHandler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		if d.NextBlock(0) {
+			return d.Errf("twingate_vars does not take a block")
+		}
+	}
+	return nil
+}
+
+func parseVarsHandler(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(VarsHandler)
+	if err := handler.UnmarshalCaddyfile(h.Dispenser); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+var (
+	_ caddy.Module                = (*VarsHandler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*VarsHandler)(nil)
+	_ caddyfile.Unmarshaler       = (*VarsHandler)(nil)
+)
@@ -0,0 +1,57 @@
+package twingate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestVarsHandlerPlaceholders(t *testing.T) {
+	lastSync := time.Date(2025, 11, 2, 10, 30, 0, 0, time.UTC)
+	setActiveApp(t, &TwingateApp{
+		Tenant:   "acme",
+		lastSync: lastSync,
+		resources: map[string]Resource{
+			"api.example.com": newTestResource("r1", "api.example.com", "10.0.0.1", "net1"),
+			"app.example.com": newTestResource("r2", "app.example.com", "10.0.0.1", "net1"),
+		},
+	})
+
+	repl := caddy.NewReplacer()
+	req := httptest.NewRequest(http.MethodGet, "http://api.example.com/status", nil)
+	req = req.WithContext(context.WithValue(req.Context(), caddy.ReplacerCtxKey, repl))
+
+	next := caddyHandlerFunc(func(w http.ResponseWriter, r *http.Request) error { return nil })
+	if err := (VarsHandler{}).ServeHTTP(httptest.NewRecorder(), req, next); err != nil {
+		t.Fatalf("ServeHTTP() failed: %v", err)
+	}
+
+	tests := map[string]string{
+		"{twingate.tenant}":         "acme",
+		"{twingate.last_sync}":      "2025-11-02T10:30:00Z",
+		"{twingate.resource_count}": "2",
+		"{twingate.resource}":       "api.example.com",
+		"{twingate.resource_id}":    "r1",
+	}
+	for input, expected := range tests {
+		if got := repl.ReplaceAll(input, "?"); got != expected {
+			t.Errorf("%s = %q, want %q", input, got, expected)
+		}
+	}
+}
+
+func TestVarsHandlerPlaceholders_NoApp(t *testing.T) {
+	setActiveApp(t, nil)
+
+	provider := twingatePlaceholders(nil, "api.example.com")
+	if val, ok := provider("twingate.last_sync"); !ok || val != "" {
+		t.Errorf("expected empty last_sync without a running app, got %v, %v", val, ok)
+	}
+	if _, ok := provider("http.request.host"); ok {
+		t.Error("provider should not claim placeholders outside twingate.*")
+	}
+}
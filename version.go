@@ -0,0 +1,132 @@
+package twingate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+	"golang.org/x/mod/module"
+)
+
+// modulePath is the plugin's Go module path, used to find its version in
+// the build info of the binary it is built into.
+const modulePath = "github.com/EngineeredDev/twingate-caddy"
+
+// requestIDHeader carries the ID of each API request, so it can be found
+// in Twingate's audit logs and by its support.
+const requestIDHeader = "X-Request-ID"
+
+// buildInfo describes the plugin as built into the running binary.
+type buildInfo struct {
+	// Version is the plugin module's version, such as v1.4.0, "devel"
+	// when built from a checkout, or "unknown" without build info.
+	Version string `json:"version"`
+
+	// Commit is the plugin's git commit, from the VCS stamp of a build
+	// from a checkout or from a pseudo-version.
+	Commit string `json:"commit,omitempty"`
+
+	// Modified is set when the checkout had uncommitted changes.
+	Modified bool `json:"modified,omitempty"`
+
+	Caddy string `json:"caddy"`
+	Go    string `json:"go"`
+}
+
+// pluginBuild returns the build info of the plugin, read once from the
+// build info embedded in the running binary.
+var pluginBuild = sync.OnceValue(func() buildInfo {
+	build := buildInfo{Version: "unknown", Go: runtime.Version()}
+	build.Caddy, _ = caddy.Version()
+	build.Caddy, _, _ = strings.Cut(build.Caddy, " ")
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	mod := &info.Main
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			mod = dep
+			break
+		}
+	}
+	if mod.Path != modulePath {
+		return build
+	}
+	if mod.Replace != nil && mod.Replace.Version != "" {
+		mod = mod.Replace
+	}
+
+	build.Version = mod.Version
+	if build.Version == "" || build.Version == "(devel)" {
+		build.Version = "devel"
+	}
+	if module.IsPseudoVersion(mod.Version) {
+		build.Commit, _ = module.PseudoVersionRev(mod.Version)
+	}
+	if mod == &info.Main {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				build.Commit = setting.Value
+			case "vcs.modified":
+				build.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return build
+})
+
+// pluginVersion returns the version of the plugin built into the binary.
+func pluginVersion() string {
+	return pluginBuild().Version
+}
+
+// userAgent returns the User-Agent of the plugin's API requests, naming
+// the plugin and Caddy versions, such as
+// "twingate-caddy/v1.4.0 caddy/v2.8.4".
+func userAgent() string {
+	build := pluginBuild()
+	return "twingate-caddy/" + build.Version + " caddy/" + build.Caddy
+}
+
+// requestIDKey is the context key of the ID set by withMutationID.
+type requestIDKey struct{}
+
+// withMutationID returns a context whose API requests carry an ID derived
+// from mutation m and its variables. Every retry of a mutation, in the same
+// sync or a later one, is then sent with the same ID.
+func withMutationID(ctx context.Context, m any, variables map[string]any) context.Context {
+	data, _ := json.Marshal(variables)
+	sum := sha256.Sum256(append([]byte(fmt.Sprintf("%T", m)), data...))
+	return context.WithValue(ctx, requestIDKey{}, "m-"+hex.EncodeToString(sum[:12]))
+}
+
+// newRequestID returns the ID of an API request made with ctx: the ID of
+// the mutation it sends, or else the sync ID of the run making it, if any,
+// followed by a random part, so the requests of a sync can be matched to
+// its log lines.
+func newRequestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	if id := syncIDFrom(ctx); id != "" {
+		return id + "-" + newSyncID()
+	}
+	return newSyncID()
+}
+
+// identifyRequest sets the User-Agent and request ID headers of r.
+func identifyRequest(r *http.Request) {
+	r.Header.Set("User-Agent", userAgent())
+	r.Header.Set(requestIDHeader, newRequestID(r.Context()))
+}
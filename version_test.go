@@ -0,0 +1,90 @@
+package twingate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewTwingateClient_IdentifiesRequests(t *testing.T) {
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"remoteNetworks": map[string]any{"edges": []any{}},
+		}})
+	}))
+	defer server.Close()
+
+	client := NewTwingateClient(server.URL, "secret")
+	ctx := withSyncID(context.Background())
+	for i := 0; i < 2; i++ {
+		if err := client.TestConnection(ctx); err != nil {
+			t.Fatalf("TestConnection() failed: %v", err)
+		}
+	}
+
+	if len(headers) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(headers))
+	}
+	if ua := headers[0].Get("User-Agent"); ua != userAgent() || !strings.HasPrefix(ua, "twingate-caddy/devel caddy/") {
+		t.Errorf("User-Agent = %q", ua)
+	}
+	first, second := headers[0].Get(requestIDHeader), headers[1].Get(requestIDHeader)
+	if !strings.HasPrefix(first, syncIDFrom(ctx)+"-") {
+		t.Errorf("request ID %q should start with the sync ID %s", first, syncIDFrom(ctx))
+	}
+	if first == second {
+		t.Errorf("each request should get its own ID, got %q twice", first)
+	}
+}
+
+func TestMutationRequestID(t *testing.T) {
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(requestIDHeader))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"resourceDelete": map[string]any{"ok": true, "error": nil},
+		}})
+	}))
+	defer server.Close()
+	client := NewTwingateClient(server.URL, "secret")
+
+	// A retry in a later sync is sent with the same ID
+	for _, id := range []string{"r1", "r1", "r2"} {
+		if err := client.DeleteResource(withSyncID(context.Background()), id); err != nil {
+			t.Fatalf("DeleteResource() failed: %v", err)
+		}
+	}
+	if ids[0] != ids[1] || !strings.HasPrefix(ids[0], "m-") {
+		t.Errorf("retried mutation IDs = %q and %q, want the same mutation ID", ids[0], ids[1])
+	}
+	if ids[2] == ids[0] {
+		t.Errorf("another mutation should get another ID, got %q", ids[2])
+	}
+}
+
+func TestStatus_Version(t *testing.T) {
+	app := &TwingateApp{Tenant: "acme"}
+	if got := app.status().Version; got != pluginVersion() || got == "" {
+		t.Errorf("Version = %q, want %q", got, pluginVersion())
+	}
+}
+
+func TestPluginBuild(t *testing.T) {
+	build := pluginBuild()
+	if build.Version != "devel" {
+		t.Errorf("Version = %q, want devel in a test binary", build.Version)
+	}
+	if build.Caddy == "" || build.Go == "" {
+		t.Errorf("expected the Caddy and Go versions, got %+v", build)
+	}
+	if caps := (&TwingateApp{Tenant: "acme"}).ownCapabilities(); caps.Version != build.Version || caps.Commit != build.Commit {
+		t.Errorf("capabilities should include the build, got %s %s", caps.Version, caps.Commit)
+	}
+}
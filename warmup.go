@@ -0,0 +1,91 @@
+package twingate
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultWarmupRate is the number of resources a warm-up sync processes per
+// minute unless configured otherwise.
+const defaultWarmupRate = 60
+
+// WarmupConfig paces the first sync against a tenant the plugin has no
+// stored state for, such as right after a mass deployment, so it does not
+// hammer the Twingate API. Later syncs and syncs after reloads run at full
+// speed.
+type WarmupConfig struct {
+	// Rate is the number of resources synced per minute. Defaults to 60.
+	Rate int `json:"rate,omitempty"`
+}
+
+func (w *WarmupConfig) rate() int {
+	if w.Rate > 0 {
+		return w.Rate
+	}
+	return defaultWarmupRate
+}
+
+// warmupPacer lets a sync process resources in waves of size, starting a
+// new wave at most once per period.
+type warmupPacer struct {
+	size   int
+	period time.Duration
+
+	count int
+	wave  time.Time
+}
+
+func newWarmupPacer(cfg *WarmupConfig) *warmupPacer {
+	return &warmupPacer{size: cfg.rate(), period: time.Minute}
+}
+
+// wait blocks until the next resource may be processed, waiting through
+// unlocked if set. It returns the context's error if the context is done
+// first. A nil pacer never waits.
+func (p *warmupPacer) wait(ctx context.Context, unlocked func(fn func())) error {
+	if p == nil {
+		return nil
+	}
+	if p.count == 0 {
+		p.wave = time.Now()
+	} else if p.count%p.size == 0 {
+		if delay := p.period - time.Since(p.wave); delay > 0 {
+			sleep := func() {
+				timer := time.NewTimer(delay)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+				}
+			}
+			if unlocked != nil {
+				unlocked(sleep)
+			} else {
+				sleep()
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		p.wave = time.Now()
+	}
+	p.count++
+	markProgress(ctx)
+	return nil
+}
+
+// warmupApplies reports whether the initial sync should be a warm-up: one
+// is configured and no resources are stored as managed for the tenant.
+func (t *TwingateApp) warmupApplies(ctx context.Context) bool {
+	if t.Warmup == nil || t.state == nil {
+		return false
+	}
+	state, err := t.state.load(ctx)
+	if err != nil {
+		t.logger.Warn("Failed to load Twingate sync state, skipping warm-up", zap.Error(err))
+		return false
+	}
+	return len(state.Managed) == 0
+}
@@ -0,0 +1,85 @@
+package twingate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWarmupPacerWaves(t *testing.T) {
+	pacer := &warmupPacer{size: 2, period: 50 * time.Millisecond}
+	ctx := context.Background()
+
+	started := time.Now()
+	for range 2 {
+		if err := pacer.wait(ctx, nil); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed >= 50*time.Millisecond {
+		t.Fatalf("first wave waited %v", elapsed)
+	}
+
+	if err := pacer.wait(ctx, nil); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Errorf("second wave started after %v, want at least 50ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	pacer.wait(ctx, nil)
+	if err := pacer.wait(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait on canceled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestWarmupPacerWaitsUnlocked(t *testing.T) {
+	pacer := &warmupPacer{size: 1, period: 10 * time.Millisecond}
+	unlocked := 0
+	release := func(fn func()) {
+		unlocked++
+		fn()
+	}
+
+	for range 3 {
+		if err := pacer.wait(context.Background(), release); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	}
+	if unlocked != 2 {
+		t.Errorf("waited unlocked %d times, want only the 2 waits between waves", unlocked)
+	}
+}
+
+func TestSyncResourcesWarmupCanceled(t *testing.T) {
+	mock := &MockTwingateClient{
+		Networks: map[string]RemoteNetwork{"Caddy-Managed": {ID: "net1", Name: "Caddy-Managed"}},
+	}
+	syncer := &ResourceSyncer{
+		client: mock,
+		logger: zap.NewNop(),
+		pacer:  &warmupPacer{size: 1, period: time.Hour},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	mappings := []ResourceMapping{
+		{Name: "a.example.com", Address: "10.0.0.1"},
+		{Name: "b.example.com", Address: "10.0.0.1"},
+	}
+	err := syncer.SyncResources(ctx, mappings, "", nil)
+	if err == nil {
+		t.Fatal("expected error for unfinished warm-up")
+	}
+	if len(mock.Resources) != 1 {
+		t.Errorf("created %d resources, want 1", len(mock.Resources))
+	}
+	if failed := syncer.FailedMappings(); len(failed) != 1 || failed[0].Mapping.Name != "b.example.com" {
+		t.Errorf("failed = %+v, want b.example.com", failed)
+	}
+}